@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// certReloader serves a TLS certificate from files and picks up renewals
+// without a restart: Reload reads them again on SIGHUP, and Watch does when
+// they change on disk.
+type certReloader struct {
+	logger *slog.Logger
+
+	mu       sync.RWMutex
+	certFile string
+	keyFile  string
+	cert     *tls.Certificate
+	modTime  time.Time // newest modification time of the files when loaded
+}
+
+func newCertReloader(certFile, keyFile string, logger *slog.Logger) (*certReloader, error) {
+	c := &certReloader{logger: logger}
+	if err := c.Reload(certFile, keyFile); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload loads the certificate and key from certFile and keyFile. On error
+// the current certificate stays in use.
+func (c *certReloader) Reload(certFile, keyFile string) error {
+	modTime := newestModTime(certFile, keyFile)
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.certFile, c.keyFile = certFile, keyFile
+	c.cert = &cert
+	c.modTime = modTime
+	return nil
+}
+
+// GetCertificate is a tls.Config.GetCertificate returning the current
+// certificate.
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+// Watch reloads the certificate whenever its files change, checking every
+// interval until ctx is done. A half-written renewal fails to load and is
+// retried on the next check.
+func (c *certReloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		c.mu.RLock()
+		certFile, keyFile, loaded := c.certFile, c.keyFile, c.modTime
+		c.mu.RUnlock()
+		if !newestModTime(certFile, keyFile).After(loaded) {
+			continue
+		}
+		if err := c.Reload(certFile, keyFile); err != nil {
+			c.logger.Warn("changed certificate failed to load, keeping the old one", "cert_file", certFile, "error", err)
+			continue
+		}
+		c.logger.Info("certificate reloaded", "cert_file", certFile)
+	}
+}
+
+func newestModTime(files ...string) time.Time {
+	var newest time.Time
+	for _, f := range files {
+		if info, err := os.Stat(f); err == nil && info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+	}
+	return newest
+}
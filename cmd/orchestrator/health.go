@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/client"
+
+	"warren/internal/admin"
+	"warren/internal/alerts"
+	"warren/internal/config"
+	"warren/internal/dnscheck"
+	"warren/internal/events"
+	"warren/internal/hermes"
+	"warren/internal/human"
+	"warren/internal/services"
+	"warren/internal/store"
+)
+
+// certExpiryWarning is how close to expiry the http3 certificate may get
+// before the tls check fails.
+const certExpiryWarning = 7 * 24 * time.Hour
+
+// eventDropWindow is how long after the event queue last dropped an event
+// the events check keeps failing.
+const eventDropWindow = 5 * time.Minute
+
+// healthDeps are the subsystems /admin/health checks. Nil fields are
+// subsystems that aren't configured and get no check.
+type healthDeps struct {
+	docker   *client.Client
+	registry *services.Registry
+	emitter  *events.Emitter
+	hermes   *hermes.Client
+	alerter  *alerts.WebhookAlerter
+	store    *store.PostgresStore
+	http3    config.HTTP3Config
+	dns      *dnscheck.Checker
+}
+
+// registerHealthChecks adds a subsystem check per configured dependency.
+func registerHealthChecks(srv *admin.Server, d healthDeps) {
+	srv.AddCheck("runtime", func(ctx context.Context) (string, error) {
+		ping, err := d.docker.Ping(ctx)
+		if err != nil {
+			return "", err
+		}
+		return "docker API " + ping.APIVersion, nil
+	})
+
+	srv.AddCheck("registry", func(ctx context.Context) (string, error) {
+		return fmt.Sprintf("%d services", len(d.registry.List())), nil
+	})
+
+	// The event queue fails the check for a while after it drops events,
+	// whoever is polling and however often.
+	srv.AddCheck("events", func(ctx context.Context) (string, error) {
+		dropped := d.emitter.Dropped()
+		if last := d.emitter.LastDropped(); !last.IsZero() && time.Since(last) < eventDropWindow {
+			return "", fmt.Errorf("events dropped %s ago (queue full), %d in total", human.Approx(time.Since(last)), dropped)
+		}
+		return fmt.Sprintf("%d dropped in total", dropped), nil
+	})
+
+	if d.hermes != nil {
+		srv.AddCheck("hermes", func(ctx context.Context) (string, error) {
+			return "", d.hermes.Ping(ctx)
+		})
+	}
+
+	if d.alerter != nil {
+		srv.AddCheck("webhooks", func(ctx context.Context) (string, error) {
+			n, capacity := d.alerter.Pending()
+			if n >= capacity {
+				return "", fmt.Errorf("delivery queue full (%d), dropping events", capacity)
+			}
+			return fmt.Sprintf("%d/%d queued", n, capacity), nil
+		})
+	}
+
+	if d.http3.Listen != "" {
+		srv.AddCheck("tls", func(ctx context.Context) (string, error) {
+			cert, err := tls.LoadX509KeyPair(d.http3.CertFile, d.http3.KeyFile)
+			if err != nil {
+				return "", err
+			}
+			left := time.Until(cert.Leaf.NotAfter)
+			if left < certExpiryWarning {
+				if left <= 0 {
+					return "", fmt.Errorf("certificate expired %s ago", human.Approx(-left))
+				}
+				return "", fmt.Errorf("certificate expires in %s", human.Approx(left))
+			}
+			return "certificate expires in " + human.Approx(left), nil
+		})
+	}
+
+	if d.dns != nil {
+		srv.AddCheck("dns", func(ctx context.Context) (string, error) {
+			if m := d.dns.All(); len(m) > 0 {
+				names := make([]string, len(m))
+				for i := range m {
+					names[i] = m[i].Hostname
+				}
+				return "", fmt.Errorf("not resolving to warren: %s", strings.Join(names, ", "))
+			}
+			return "all hostnames resolve to warren", nil
+		})
+	}
+
+	if d.store != nil {
+		srv.AddCheck("storage", func(ctx context.Context) (string, error) {
+			return "", d.store.Pool().Ping(ctx)
+		})
+	}
+}
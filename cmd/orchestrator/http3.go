@@ -0,0 +1,87 @@
+//go:build !nohttp3
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+
+	"warren/internal/config"
+	"warren/internal/handoff"
+)
+
+// serveHTTP3 serves handler over HTTPS on TCP and HTTP/3 on UDP at
+// cfg.Listen until ctx is done. Like listen, the address isn't reloadable,
+// but the certificate is: the returned reloader picks up changed files on
+// its own and takes new ones on SIGHUP. If tcp is set, HTTPS is served on it
+// instead of a listener of its own, as when TLS passthrough shares the port.
+func serveHTTP3(ctx context.Context, cfg config.HTTP3Config, handler http.Handler, lns *handoff.Listeners, tcp net.Listener, logger *slog.Logger) *certReloader {
+	certs, err := newCertReloader(cfg.CertFile, cfg.KeyFile, logger.With("component", "http3"))
+	if err != nil {
+		logger.Error("failed to load http3 certificate", "error", err)
+		os.Exit(1)
+	}
+	go certs.Watch(ctx, time.Minute)
+	tlsConf := &tls.Config{GetCertificate: certs.GetCertificate, MinVersion: tls.VersionTLS12}
+
+	h3 := &http3.Server{
+		Addr:      cfg.Listen,
+		Handler:   handler,
+		TLSConfig: http3.ConfigureTLSConfig(tlsConf),
+	}
+	// Browsers only try HTTP/3 once an HTTPS response tells them to.
+	https := &http.Server{
+		Addr: cfg.Listen,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_ = h3.SetQUICHeaders(w.Header())
+			handler.ServeHTTP(w, r)
+		}),
+		TLSConfig:   tlsConf,
+		ReadTimeout: 30 * time.Second,
+		IdleTimeout: 120 * time.Second,
+	}
+
+	pc, err := lns.ListenPacket("udp", cfg.Listen)
+	if err != nil {
+		logger.Error("failed to listen for http3", "addr", cfg.Listen, "error", err)
+		os.Exit(1)
+	}
+	ln := tcp
+	if ln == nil {
+		ln, err = lns.Listen("tcp", cfg.Listen)
+		if err != nil {
+			logger.Error("failed to listen for https", "addr", cfg.Listen, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = https.Shutdown(shutCtx)
+		_ = h3.Shutdown(shutCtx)
+	}()
+	go func() {
+		logger.Info("http3 server starting", "addr", cfg.Listen, "proto", "udp")
+		if err := h3.Serve(pc); err != nil && err != http.ErrServerClosed {
+			logger.Error("http3 server failed", "error", err)
+			os.Exit(1)
+		}
+	}()
+	go func() {
+		logger.Info("https server starting", "addr", cfg.Listen, "proto", "tcp")
+		if err := https.ServeTLS(ln, "", ""); err != nil && err != http.ErrServerClosed {
+			logger.Error("https server failed", "error", err)
+			os.Exit(1)
+		}
+	}()
+	return certs
+}
@@ -0,0 +1,21 @@
+//go:build nohttp3
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+
+	"warren/internal/config"
+	"warren/internal/handoff"
+)
+
+// serveHTTP3 refuses to start: this binary was built without QUIC support.
+func serveHTTP3(_ context.Context, cfg config.HTTP3Config, _ http.Handler, _ *handoff.Listeners, _ net.Listener, logger *slog.Logger) *certReloader {
+	logger.Error("http3.listen is set but warren-server was built with the nohttp3 tag", "addr", cfg.Listen)
+	os.Exit(1)
+	return nil
+}
@@ -6,33 +6,54 @@ import (
 	"flag"
 	"fmt"
 	"log/slog"
+	"maps"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
-	"syscall"
+	"reflect"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/docker/docker/client"
 
 	"warren/internal/admin"
+	"warren/internal/agents"
 	"warren/internal/alexandria"
 	"warren/internal/alerts"
+	"warren/internal/auth"
+	"warren/internal/balance"
+	"warren/internal/ban"
 	"warren/internal/config"
 	"warren/internal/container"
+	"warren/internal/dns"
+	"warren/internal/dnscheck"
 	"warren/internal/events"
+	"warren/internal/handoff"
+	"warren/internal/headers"
 	"warren/internal/hermes"
 	"warren/internal/metrics"
+	"warren/internal/openclaw"
 	"warren/internal/policy"
 	"warren/internal/process"
 	"warren/internal/proxy"
+	"warren/internal/revisions"
+	"warren/internal/realip"
 	"warren/internal/services"
+	"warren/internal/sla"
+	"warren/internal/transport"
 	"warren/internal/store"
 	"warren/internal/tailer"
 	"warren/internal/usage"
 )
 
+// upgradeTimeout is how long a new process gets to load its config and
+// open its listeners before an upgrade is abandoned.
+const upgradeTimeout = time.Minute
+
 func main() {
 	configPath := flag.String("config", "./orchestrator.yaml", "path to config file")
 	flag.Parse()
@@ -47,8 +68,20 @@ func main() {
 	}
 	logger.Info("config loaded", "agents", len(cfg.Agents), "listen", cfg.Listen)
 
-	// Docker client.
-	docker, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	// Sockets handed over by the process this one is replacing, if any.
+	listeners, err := handoff.New()
+	if err != nil {
+		logger.Error("failed to inherit listeners", "error", err)
+		os.Exit(1)
+	}
+
+	// Docker client. docker_host overrides DOCKER_HOST, e.g. for Docker
+	// Desktop's named pipe on Windows.
+	dockerOpts := []client.Opt{client.FromEnv, client.WithAPIVersionNegotiation()}
+	if cfg.DockerHost != "" {
+		dockerOpts = append(dockerOpts, client.WithHost(cfg.DockerHost))
+	}
+	docker, err := client.NewClientWithOpts(dockerOpts...)
 	if err != nil {
 		logger.Error("failed to create docker client", "error", err)
 		os.Exit(1)
@@ -68,6 +101,22 @@ func main() {
 
 	serviceMgr := container.NewManagerWithConfig(docker, logger, cfg, "/usr/local/shared-bin")
 	emitter := events.NewEmitter(logger)
+	emitter.SetQueueSize(cfg.EventQueueSize)
+	emitter.Start(ctx)
+
+	// Policies' health ticks and idle timers share one timer goroutine, so
+	// hundreds of agents don't each keep runtime timers churning.
+	wheel := policy.NewTimerWheel(100*time.Millisecond, 600)
+	// Always-on agents past container.max_lifetime restart one at a time.
+	recycles := &policy.RecycleGate{}
+	go wheel.Run(ctx)
+	// On-demand agents wake their depends_on first.
+	deps := policy.NewDependencies(logger)
+
+	// Track availability against agents' sla targets.
+	slas := sla.New(emitter, logger)
+	emitter.OnEvent(slas.HandleEvent)
+	go slas.Run(ctx)
 
 	// Connect to Hermes (NATS) if enabled.
 	var hermesClient *hermes.Client
@@ -75,8 +124,8 @@ func main() {
 		hermesClient, err = hermes.Connect(hermes.Config{
 			URL:            cfg.Hermes.URL,
 			Token:          cfg.Hermes.Token,
-			ConnectTimeout: cfg.Hermes.ConnectTimeout,
-			ReconnectWait:  cfg.Hermes.ReconnectWait,
+			ConnectTimeout: time.Duration(cfg.Hermes.ConnectTimeout),
+			ReconnectWait:  time.Duration(cfg.Hermes.ReconnectWait),
 			MaxReconnects:  cfg.Hermes.MaxReconnects,
 		}, "warren-orchestrator", logger)
 		if err != nil {
@@ -132,8 +181,9 @@ func main() {
 
 	// Usage store (Supabase/Postgres).
 	var usageStore store.UsageStore
+	var pgStore *store.PostgresStore
 	if cfg.DatabaseURL != "" && cfg.Usage.Enabled {
-		pgStore, err := store.NewPostgresStore(ctx, cfg.DatabaseURL)
+		pgStore, err = store.NewPostgresStore(ctx, cfg.DatabaseURL)
 		if err != nil {
 			logger.Error("failed to connect usage store", "error", err)
 			os.Exit(1)
@@ -147,7 +197,7 @@ func main() {
 		logger.Info("usage store connected")
 
 		// Start JSONL tailer.
-		t := tailer.New(usageStore, cfg.Usage.JSONLPath, cfg.Usage.FlushInterval, cfg.Usage.PollInterval, logger)
+		t := tailer.New(usageStore, cfg.Usage.JSONLPath, time.Duration(cfg.Usage.FlushInterval), time.Duration(cfg.Usage.PollInterval), logger)
 		go t.Run(ctx)
 		logger.Info("usage tailer started", "path", cfg.Usage.JSONLPath)
 	}
@@ -177,21 +227,74 @@ func main() {
 		alexClient = alexandria.NewClient(alexandria.Config{
 			Enabled: cfg.Alexandria.Enabled,
 			URL:     cfg.Alexandria.URL,
-			Timeout: cfg.Alexandria.Timeout,
+			Timeout: time.Duration(cfg.Alexandria.Timeout),
 		}, logger)
 		logger.Info("alexandria client configured", "url", cfg.Alexandria.URL)
 	}
 
 	// Build proxy and policies.
 	registry := services.NewRegistry(logger)
+	registry.SetTrashRetention(time.Duration(cfg.TrashRetention))
+	registry.SetEmitter(emitter)
+
+	// Allocate container.publish host ports from port_range and record them
+	// in the registry.
+	portMin, portMax, _ := cfg.PortRangeBounds() // validated on load
+	portAlloc := container.NewPortAllocator(portMin, portMax)
+	portAlloc.OnAssign = func(agent string, ports []container.PublishedPort) {
+		mappings := make([]services.PortMapping, 0, len(ports))
+		for _, p := range ports {
+			mappings = append(mappings, services.PortMapping{Agent: agent, Target: p.Target, Published: p.Published, Protocol: p.Protocol})
+		}
+		registry.RecordPorts(agent, mappings)
+	}
+	serviceMgr.SetPortAllocator(portAlloc)
 
-	// Wire event-driven service cleanup: purge dynamic routes when agents sleep.
+	// Wire event-driven service cleanup: purge dynamic routes when agents
+	// sleep, keeping those registered to wake them.
 	emitter.OnEvent(func(ev events.Event) {
 		if ev.Type == events.AgentSleep {
-			registry.DeregisterByAgent(ev.Agent)
+			registry.DeregisterSleeping(ev.Agent)
 		}
 	})
 	p := proxy.New(registry, cfg.ProxyToken, logger)
+	p.Ports().SetListener(listeners)
+	p.SetEmitter(emitter)
+	revs := revisions.NewLog(revisions.DefaultMax)
+	p.SetRevisionLog(revs)
+	p.SetMaxRequestBody(int64(cfg.MaxRequestBody))
+	p.SetMaxProxyBody(int64(cfg.MaxProxyBody))
+	p.SetCompress(cfg.Compress)
+	p.SetReplayBuffer(int64(cfg.ReplayBuffer.Memory), int64(cfg.ReplayBuffer.Disk), cfg.ReplayBuffer.Dir)
+	metrics.RegisterReplayBuffer(func() (int64, int64, uint64) {
+		st := p.ReplayBufferStats()
+		return st.MemoryBytes, st.DiskBytes, st.Spills
+	})
+	metrics.RegisterBlockedPaths(p.BlockedPaths)
+	if res, err := realip.New(cfg.TrustedProxies, cfg.ClientIPHeader); err == nil {
+		p.SetClientIPResolver(res)
+	}
+	p.SetRequestObserver(requestObserver(cfg.Metrics, logger))
+	if cfg.SplashTemplate != "" {
+		splash, err := proxy.NewSplash(cfg.SplashTemplate)
+		if err != nil {
+			logger.Error("invalid splash template", "error", err)
+			os.Exit(1)
+		}
+		p.SetSplash(splash)
+	}
+	errorPages, err := proxy.NewErrorPages(cfg.ErrorPages)
+	if err != nil {
+		logger.Error("invalid error pages", "error", err)
+		os.Exit(1)
+	}
+	p.SetErrorPages(errorPages)
+	redirects, err := cfg.RedirectTable()
+	if err != nil {
+		logger.Error("invalid redirects", "error", err)
+		os.Exit(1)
+	}
+	p.SetRedirects(redirects)
 	policyByName := make(map[string]policy.Policy)
 	policyCancels := make(map[string]context.CancelFunc)
 
@@ -201,20 +304,54 @@ func main() {
 		discoveredState[dc.Name] = dc.State
 	}
 
+	sessions := openclaw.NewSessionMonitor(p.Activity(), logger)
+
+	// Stamp the running container ID and image digest onto agent events.
+	identities := container.NewIdentityTracker(serviceMgr, logger)
+	identities.RegisterEventHandler(emitter)
+
+	// Wake budget counts survive restarts next to the config.
+	budgetsFile := filepath.Join(filepath.Dir(*configPath), "warren-wake-budgets.json")
+	budgets, err := policy.NewBudgetStore(budgetsFile, logger)
+	if err != nil {
+		logger.Error("failed to load wake budgets, counting from zero", "file", budgetsFile, "error", err)
+	}
+
+	builder := &agents.Builder{
+		Runtime:    serviceMgr,
+		Proxy:      p,
+		Emitter:    emitter,
+		Wheel:      wheel,
+		Recycles:   recycles,
+		Deps:       deps,
+		Budgets:    budgets,
+		Logger:     logger,
+		Discovered: discoveredState,
+	}
+
 	for name, agent := range cfg.Agents {
 		target, err := url.Parse(agent.Backend)
 		if err != nil {
 			logger.Error("invalid backend URL", "agent", name, "error", err)
 			os.Exit(1)
 		}
+		if _, err := revs.Record(revisions.KindAgent, name, revisions.ActionLoaded, "config", "", agent); err != nil {
+			logger.Error("failed to record agent revision", "agent", name, "error", err)
+		}
+		target = publishTarget(ctx, serviceMgr, name, agent, target, logger)
 
-		pol, polCancel := createPolicy(name, agent, serviceMgr, p, emitter, discoveredState, logger)
+		pol, polCancel := builder.Policy(name, agent)
+		trackSLA(slas, name, agent)
+		trackIdentity(identities, name, agent)
 
-		// Register primary hostname and any additional hostnames.
-		p.Register(agent.Hostname, name, target, pol)
-		for _, h := range agent.Hostnames {
-			p.Register(h, name, target, pol)
+		opts, err := builder.RouteOptions(name, agent)
+		if err != nil {
+			logger.Error("invalid route options", "agent", name, "error", err)
+			os.Exit(1)
 		}
+
+		// Register primary hostname and any additional hostnames.
+		builder.Route(name, agent, target, pol, opts)
 		// Wire Alexandria briefing hook for on-demand agents.
 		if od, ok := pol.(*policy.OnDemand); ok && alexClient != nil {
 			agentName := name
@@ -230,7 +367,7 @@ func main() {
 				}
 
 				// Write briefing to file.
-				dir := "/tmp/warren-briefings"
+				dir := filepath.Join(os.TempDir(), "warren-briefings")
 				if err := os.MkdirAll(dir, 0755); err != nil {
 					logger.Error("failed to create briefing dir", "error", err)
 					return
@@ -259,19 +396,126 @@ func main() {
 
 		policyByName[name] = pol
 		policyCancels[name] = polCancel
+		if t, ok := sessionTarget(name, agent, pol); ok {
+			sessions.Register(ctx, t)
+		}
+		if err := builder.OpenPorts(ctx, name, agent, target, pol); err != nil {
+			logger.Error("failed to open agent ports", "agent", name, "error", err)
+			os.Exit(1)
+		}
 		logger.Info("agent configured", "name", name, "hostname", agent.Hostname, "extra_hostnames", len(agent.Hostnames), "policy", agent.Policy)
 	}
 
+	registerServices(registry, nil, cfg.Services, logger)
+
 	// Wire metrics into event system.
 	metrics.RegisterEventHandler(emitter)
 
+	// Learn wake durations for splash page estimates.
+	emitter.OnEvent(p.WakeTimes().HandleEvent)
+
 	// Wire webhook alerting.
+	var alerter *alerts.WebhookAlerter
 	if len(cfg.Webhooks) > 0 {
-		alerter := alerts.NewWebhookAlerter(cfg.Webhooks, logger)
+		alerter = alerts.NewWebhookAlerter(cfg.Webhooks, logger)
+		alerter.SetWorkers(cfg.WebhookWorkers)
 		alerter.Start(ctx)
 		alerter.RegisterEventHandler(emitter)
 		logger.Info("webhook alerting configured", "webhooks", len(cfg.Webhooks))
 	}
+	metrics.RegisterDroppedEvents(func() (uint64, uint64) {
+		var webhook uint64
+		if alerter != nil {
+			webhook = alerter.Dropped()
+		}
+		return emitter.Dropped(), webhook
+	})
+
+	// Warn about hostnames whose DNS doesn't point at Warren.
+	var dnsChecker *dnscheck.Checker
+	if len(cfg.DNSCheck.PublicIPs) > 0 {
+		expected, _ := dnscheck.ParsePrefixes(cfg.DNSCheck.PublicIPs) // validated by config
+		dnsChecker = dnscheck.New(expected, func() map[string]string {
+			hostnames := make(map[string]string)
+			for hostname, b := range p.Backends() {
+				hostnames[hostname] = b.AgentName
+			}
+			return hostnames
+		}, emitter, logger)
+		go dnsChecker.Run(ctx, time.Duration(cfg.DNSCheck.Interval))
+		logger.Info("dns check configured", "public_ips", cfg.DNSCheck.PublicIPs)
+	}
+
+	// Point DNS records for routed hostnames at Warren.
+	if d := cfg.DNS; d.Provider != "" {
+		var provider dns.Provider
+		switch d.Provider {
+		case "cloudflare":
+			provider = dns.NewCloudflare(d.Cloudflare.APIToken, d.Cloudflare.Proxied)
+		case "route53":
+			provider = dns.NewRoute53(d.Route53.AccessKeyID, d.Route53.SecretAccessKey, d.Route53.SessionToken)
+		}
+		syncer := dns.New(provider, dns.Options{Zones: d.ManagedZones, Target: d.Target, TTL: time.Duration(d.TTL), DryRun: d.DryRun}, func() map[string]dns.Route {
+			routes := make(map[string]dns.Route)
+			for hostname, b := range p.Backends() {
+				routes[hostname] = dns.Route{Agent: b.AgentName}
+			}
+			for _, svc := range registry.List() {
+				routes[svc.Hostname] = dns.Route{Agent: svc.Agent, Service: true}
+			}
+			return routes
+		}, emitter, logger)
+		emitter.OnEvent(func(ev events.Event) {
+			if ev.Type == events.AgentAdded || ev.Type == events.AgentRemoved {
+				syncer.Trigger()
+			}
+		})
+		go syncer.Run(ctx, dns.DefaultInterval)
+		logger.Info("dns records managed", "provider", d.Provider, "zones", d.ManagedZones, "target", d.Target, "dry_run", d.DryRun)
+	}
+
+	// Ban client addresses that keep failing auth or hitting limits.
+	var jail *ban.Jail
+	if cfg.Bans.Enabled {
+		file := cfg.Bans.File
+		if file == "" {
+			file = filepath.Join(filepath.Dir(*configPath), "warren-bans.json")
+		}
+		ignore, _ := dnscheck.ParsePrefixes(cfg.Bans.Ignore) // validated by config
+		jail, err = ban.New(ban.Config{
+			MaxStrikes: cfg.Bans.MaxStrikes,
+			Window:     time.Duration(cfg.Bans.Window),
+			Duration:   time.Duration(cfg.Bans.Duration),
+			Ignore:     ignore,
+			File:       file,
+		}, logger)
+		if err != nil {
+			logger.Error("failed to load bans", "file", file, "error", err)
+			os.Exit(1)
+		}
+		jail.OnBan(func(b ban.Ban) {
+			emitter.Emit(events.Event{Type: events.SecurityBanned, Fields: map[string]string{
+				"remote":  b.IP,
+				"reason":  b.Reason,
+				"strikes": strconv.Itoa(b.Strikes),
+				"until":   b.Until.UTC().Format(time.RFC3339),
+			}})
+		})
+		p.SetJail(jail)
+		logger.Info("ip bans enabled", "file", file)
+		if len(cfg.TrustedProxies) == 0 {
+			logger.Warn("ip bans enabled without trusted_proxies; behind a tunnel or load balancer every client shares its address and may be banned together")
+		}
+	}
+
+	// Dead-man's-switch heartbeat. It runs even without heartbeat_url, so a
+	// reload can set one, but doesn't ping until then.
+	hb := alerts.NewHeartbeat(cfg.HeartbeatURL, time.Duration(cfg.HeartbeatInterval), logger)
+	hb.RegisterEventHandler(emitter)
+	go hb.Run(ctx)
+	if cfg.HeartbeatURL != "" {
+		logger.Info("heartbeat configured", "interval", cfg.HeartbeatInterval)
+	}
 
 	// Wire LRU eviction.
 	lruMgr := policy.NewLRUManager(p.Activity(), logger)
@@ -284,7 +528,7 @@ func main() {
 	if cfg.MaxReadyAgents > 0 {
 		emitter.OnEvent(func(ev events.Event) {
 			if ev.Type == events.AgentReady {
-				lruMgr.EvictIfNeeded(ctx, cfg.MaxReadyAgents)
+				lruMgr.Trigger(ctx, cfg.MaxReadyAgents)
 			}
 		})
 		logger.Info("LRU eviction enabled", "max_ready_agents", cfg.MaxReadyAgents)
@@ -324,14 +568,66 @@ func main() {
 			}
 		}
 		adminSrv = admin.NewServer(agentInfos, policyByName, policyCancels, registry, emitter, serviceMgr, p, cfg, *configPath, p.WSCounter().Total, hermesClient, procTracker, logger)
+		adminSrv.SetSessionMonitor(sessions)
+		adminSrv.SetIdentityTracker(identities)
+		adminSrv.SetRevisionLog(revs)
+		adminSrv.SetSLATracker(slas)
+		adminSrv.SetDependencies(deps)
+		trashFile := filepath.Join(filepath.Dir(*configPath), "warren-trash.yaml")
+		if err := adminSrv.SetTrashFile(trashFile); err != nil {
+			logger.Error("failed to load agent trash", "file", trashFile, "error", err)
+		}
+		metrics.RegisterWakeBudgets(adminSrv.WakeBudgets)
+		registerHealthChecks(adminSrv, healthDeps{
+			docker:   docker,
+			registry: registry,
+			emitter:  emitter,
+			hermes:   hermesClient,
+			alerter:  alerter,
+			store:    pgStore,
+			http3:    cfg.HTTP3,
+			dns:      dnsChecker,
+		})
+		if dnsChecker != nil {
+			adminSrv.SetDNSChecker(dnsChecker)
+		}
+		if jail != nil {
+			adminSrv.SetJail(jail)
+		}
+		adminSrv.SetAgentStarter(func(name string, agent *config.Agent) (policy.Policy, context.CancelFunc, error) {
+			target, err := url.Parse(agent.Backend)
+			if err != nil {
+				return nil, nil, err
+			}
+			opts, err := builder.RouteOptions(name, agent)
+			if err != nil {
+				return nil, nil, err
+			}
+			target = publishTarget(ctx, serviceMgr, name, agent, target, logger)
+			pol, polCancel := builder.Policy(name, agent)
+			trackSLA(slas, name, agent)
+			trackIdentity(identities, name, agent)
+			builder.Route(name, agent, target, pol, opts)
+			if t, ok := sessionTarget(name, agent, pol); ok {
+				sessions.Register(ctx, t)
+			}
+			if err := builder.OpenPorts(ctx, name, agent, target, pol); err != nil {
+				logger.Error("failed to open restored agent ports", "agent", name, "error", err)
+			}
+			go pol.Start(ctx)
+			return pol, polCancel, nil
+		})
 
 		// Mount metrics on admin handler.
 		adminMux := http.NewServeMux()
-		adminMux.Handle("/metrics", metrics.Handler())
+		if metrics.Enabled {
+			adminMux.Handle("/metrics", metrics.Handler())
+		}
 		adminMux.Handle("/api/services", http.HandlerFunc(p.HandleServiceAPI))
 		// Mount SSH handler (without auth, localhost-only protected)
 		adminMux.Handle("/ssh/", adminSrv.SSHHandler())
 		adminMux.HandleFunc("/api/services/", p.HandleServiceAPI)
+		adminMux.HandleFunc("/api/agents/", p.HandleAgentAPI)
 		// Mount usage API if store is available.
 		if usageStore != nil {
 			usageHandler := usage.NewHandler(usageStore)
@@ -340,8 +636,17 @@ func main() {
 		}
 		adminMux.Handle("/", adminSrv.Handler())
 
+		adminLn, err := listeners.Listen("tcp", cfg.AdminListen)
+		if err != nil {
+			logger.Error("failed to listen for admin server", "addr", cfg.AdminListen, "error", err)
+			os.Exit(1)
+		}
 		go func() {
-			srv := &http.Server{Addr: cfg.AdminListen, Handler: adminMux}
+			var handler http.Handler = adminMux
+			if jail != nil {
+				handler = jail.Guard(adminMux)
+			}
+			srv := &http.Server{Addr: cfg.AdminListen, Handler: handler}
 			go func() {
 				<-ctx.Done()
 				shutCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -349,12 +654,24 @@ func main() {
 				_ = srv.Shutdown(shutCtx)
 			}()
 			logger.Info("admin server starting", "addr", cfg.AdminListen)
-			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			if err := srv.Serve(adminLn); err != nil && err != http.ErrServerClosed {
 				logger.Error("admin server failed", "error", err)
 			}
 		}()
 	}
 
+	// Service registration API for agent containers, apart from the admin
+	// port.
+	var serviceAPI *proxy.ServiceAPI
+	if cfg.ServiceAPI.Listen != "" {
+		serviceAPI = p.ServiceAPI(cfg.ServiceAPI.Tokens)
+		var handler http.Handler = serviceAPI
+		if jail != nil {
+			handler = jail.Guard(serviceAPI)
+		}
+		serveServiceAPI(ctx, cfg.ServiceAPI, handler, listeners, logger)
+	}
+
 	// HTTP server.
 	srv := &http.Server{
 		Addr:         cfg.Listen,
@@ -367,24 +684,89 @@ func main() {
 		WriteTimeout: 0,
 		IdleTimeout:  120 * time.Second,
 	}
+	// gRPC clients speak HTTP/2 with prior knowledge, so accept it without
+	// TLS alongside HTTP/1.1. Like listen, this isn't reloadable, so it's on
+	// whether or not any agent sets grpc yet; the proxy refuses it for
+	// routes without grpc.
+	var protocols http.Protocols
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(true)
+	srv.Protocols = &protocols
+
+	// TLS passthrough listener. Like listen, it isn't reloadable. Sharing
+	// the port with http3, it hands the connections no agent claims to the
+	// HTTPS server.
+	var httpsLn net.Listener
+	if cfg.TLSListen != "" {
+		ln, err := listeners.Listen("tcp", cfg.TLSListen)
+		if err != nil {
+			logger.Error("failed to listen for tls passthrough", "addr", cfg.TLSListen, "error", err)
+			os.Exit(1)
+		}
+		logger.Info("tls passthrough listening", "addr", cfg.TLSListen)
+		if cfg.TLSListen == cfg.HTTP3.Listen {
+			httpsLn = p.SNI().ServeShared(ctx, ln)
+		} else {
+			go p.SNI().Serve(ctx, ln)
+		}
+	}
+
+	var certs *certReloader
+	if cfg.HTTP3.Listen != "" {
+		certs = serveHTTP3(ctx, cfg.HTTP3, p, listeners, httpsLn, logger)
+	}
 
 	// Start server in goroutine.
+	ln, err := listeners.Listen("tcp", cfg.Listen)
+	if err != nil {
+		logger.Error("failed to listen", "addr", cfg.Listen, "error", err)
+		os.Exit(1)
+	}
 	go func() {
 		logger.Info("server starting", "addr", cfg.Listen)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
 			logger.Error("server failed", "error", err)
 			os.Exit(1)
 		}
 	}()
 
-	// Wait for shutdown signal or SIGHUP for reload.
+	// Every socket is open, so an upgrading predecessor can stop accepting.
+	// Its connections don't count as activity here, so keep agents awake
+	// until it has drained them and exited.
+	if listeners.Inherited() {
+		logger.Info("took over listeners from the previous process")
+		hold := policy.HoldUntil(listeners.PredecessorDone(), time.Minute, "previous process still draining connections")
+		for _, pol := range policyByName {
+			if od, ok := pol.(*policy.OnDemand); ok {
+				od.AddSleepGuard(hold)
+			}
+		}
+	}
+	if err := listeners.Ready(); err != nil {
+		logger.Error("failed to signal readiness to the previous process", "error", err)
+	}
+
+	// Wait for shutdown signal, SIGHUP for reload or SIGUSR2 for upgrade.
+	// Windows has neither, so there only shutdown signals are delivered.
 	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	signal.Notify(sigCh, append(append(shutdownSignals, reloadSignals...), upgradeSignals...)...)
 
 	var sig os.Signal
+	upgraded := false
 	for {
 		sig = <-sigCh
-		if sig != syscall.SIGHUP {
+		if isUpgradeSignal(sig) {
+			logger.Info("SIGUSR2 received, starting new process")
+			pid, err := listeners.Upgrade(upgradeTimeout)
+			if err != nil {
+				logger.Error("upgrade failed, still serving", "error", err)
+				continue
+			}
+			logger.Info("new process ready, handing over", "pid", pid)
+			upgraded = true
+			break
+		}
+		if !isReloadSignal(sig) {
 			break
 		}
 		logger.Info("SIGHUP received, reloading config")
@@ -393,23 +775,43 @@ func main() {
 			logger.Error("failed to reload config", "error", err)
 			continue
 		}
-		reloadConfig(ctx, logger, cfg, newCfg, policyByName, policyCancels, p, serviceMgr, emitter, adminSrv, discoveredState)
+		registerServices(registry, cfg.Services, newCfg.Services, logger)
+		reloadConfig(ctx, logger, cfg, newCfg, policyByName, policyCancels, p, serviceMgr, emitter, builder, adminSrv, sessions, revs, slas, identities, hb)
+		if serviceAPI != nil {
+			serviceAPI.SetTokens(newCfg.ServiceAPI.Tokens)
+		}
+		if certs != nil && newCfg.HTTP3.CertFile != "" {
+			if err := certs.Reload(newCfg.HTTP3.CertFile, newCfg.HTTP3.KeyFile); err != nil {
+				logger.Error("config reload: failed to load http3 certificate, keeping the old one", "error", err)
+			}
+		}
 		cfg = newCfg
 	}
 
 	activeWS := p.WSCounter().Total()
 	logger.Info("shutting down", "signal", sig, "active_websockets", activeWS)
 	cancel() // stop policy goroutines
+	if upgraded {
+		// The new process accepts from here on. Stop accepting so requests
+		// reach it, and finish in-flight ones while WebSockets drain.
+		go srv.Shutdown(context.Background()) //nolint:errcheck
+	}
 
 	// Calculate drain timeout: use the max drain_timeout across all agents.
 	drainTimeout := 30 * time.Second
 	for _, agent := range cfg.Agents {
-		if agent.Idle.DrainTimeout > drainTimeout {
-			drainTimeout = agent.Idle.DrainTimeout
+		if time.Duration(agent.Idle.DrainTimeout) > drainTimeout {
+			drainTimeout = time.Duration(agent.Idle.DrainTimeout)
 		}
 	}
+	// After an upgrade nothing is waiting on this process, so WebSockets
+	// get much longer to close on their own rather than all reconnecting
+	// to the new one at once.
+	if upgraded {
+		drainTimeout = time.Duration(cfg.UpgradeDrainTimeout)
+	}
 
-	// Wait for WebSocket connections to drain naturally.
+	// Wait for WebSocket and forwarded TCP connections to drain naturally.
 	if activeWS > 0 {
 		logger.Info("waiting for WebSocket connections to drain", "timeout", drainTimeout, "active", activeWS)
 		if p.WSCounter().Wait(drainTimeout) {
@@ -418,6 +820,7 @@ func main() {
 			logger.Warn("drain timeout reached, forcing shutdown", "remaining_websockets", p.WSCounter().Total())
 		}
 	}
+	p.CloseConnections()
 
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer shutdownCancel()
@@ -425,59 +828,202 @@ func main() {
 	if err := srv.Shutdown(shutdownCtx); err != nil {
 		logger.Error("shutdown error", "error", err)
 	}
+	// Deliver events still queued for webhooks and Hermes.
+	if err := emitter.Flush(shutdownCtx); err != nil {
+		logger.Warn("events still queued at exit", "error", err)
+	}
 
 	fmt.Println("orchestrator stopped")
 }
 
-func createPolicy(name string, agent *config.Agent, serviceMgr *container.Manager, p *proxy.Proxy, emitter *events.Emitter, discoveredState map[string]string, logger *slog.Logger) (policy.Policy, context.CancelFunc) {
-	policyCtx, policyCancel := context.WithCancel(context.Background())
-
-	var pol policy.Policy
-	switch agent.Policy {
-	case "always-on":
-		pol = policy.NewAlwaysOn(policy.AlwaysOnConfig{
-			Agent:         name,
-			HealthURL:     agent.Health.URL,
-			CheckInterval: agent.Health.CheckInterval,
-			MaxFailures:   agent.Health.MaxFailures,
-		}, emitter, logger)
-	case "on-demand":
-		pol = policy.NewOnDemand(serviceMgr, policy.OnDemandConfig{
-			Agent:              name,
-			ContainerName:      agent.Container.Name,
-			HealthURL:          agent.Health.URL,
-			Hostname:           agent.Hostname,
-			CheckInterval:      agent.Health.CheckInterval,
-			StartupTimeout:     agent.Health.StartupTimeout,
-			IdleTimeout:        agent.Idle.Timeout,
-			WakeCooldown:       agent.Idle.WakeCooldown,
-			MaxFailures:        agent.Health.MaxFailures,
-			MaxRestartAttempts: agent.Health.MaxRestartAttempts,
-		}, p.Activity(), p.WSCounter(), emitter, logger)
-
-		// Startup reconciliation: inform policy if container is already running.
-		if state, ok := discoveredState[agent.Container.Name]; ok {
-			pol.(*policy.OnDemand).SetInitialState(state == "running")
-		}
-	case "unmanaged":
-		pol = policy.NewUnmanaged()
-	}
-
-	// The caller is responsible for starting the goroutine with policyCtx.
-	// We wrap Start to use the policy-specific context.
-	wrapper := &policyWrapper{inner: pol, ctx: policyCtx}
-	_ = wrapper // not used directly; we return the raw policy and cancel
-
-	return pol, policyCancel
+// trackSLA sets or clears an agent's availability target.
+func trackSLA(slas *sla.Tracker, name string, agent *config.Agent) {
+	if agent.SLA == nil {
+		slas.Set(name, 0, 0)
+		return
+	}
+	slas.Set(name, agent.SLA.Target, time.Duration(agent.SLA.Window))
+}
+
+// trackIdentity registers the agent's Swarm service with the identity
+// tracker, or unregisters it if Warren doesn't run its container.
+func trackIdentity(identities *container.IdentityTracker, name string, agent *config.Agent) {
+	if agent.Policy == "unmanaged" || agent.Container.Name == "" {
+		identities.Unregister(name)
+		return
+	}
+	identities.Register(name, agent.Container.Name)
+}
+
+// sessionTarget returns the OpenClaw session polling target for an agent,
+// or false if the agent has no sessions endpoint.
+func sessionTarget(name string, agent *config.Agent, pol policy.Policy) (openclaw.Target, bool) {
+	if agent.OpenClaw == nil || agent.OpenClaw.SessionsURL == "" {
+		return openclaw.Target{}, false
+	}
+	return openclaw.Target{
+		Agent:        name,
+		Hostname:     agent.Hostname,
+		URL:          agent.OpenClaw.SessionsURL,
+		Token:        agent.OpenClaw.Token,
+		PollInterval: time.Duration(agent.OpenClaw.PollInterval),
+		ActiveWindow: time.Duration(agent.OpenClaw.ActiveWindow),
+		State:        pol.State,
+	}, true
 }
 
-// policyWrapper is unused but reserved for future use.
-type policyWrapper struct {
-	inner policy.Policy
-	ctx   context.Context
+// recordReload records an agent change picked up from a config reload.
+func recordReload(revs *revisions.Log, name, action string, agent *config.Agent, logger *slog.Logger) {
+	var spec any
+	if agent != nil {
+		spec = agent
+	}
+	if _, err := revs.Record(revisions.KindAgent, name, action, "config-reload", "", spec); err != nil {
+		logger.Error("failed to record agent revision", "agent", name, "error", err)
+	}
 }
 
-func reloadConfig(ctx context.Context, logger *slog.Logger, old, new_ *config.Config, policyByName map[string]policy.Policy, policyCancels map[string]context.CancelFunc, p *proxy.Proxy, serviceMgr *container.Manager, emitter *events.Emitter, adminSrv *admin.Server, discoveredState map[string]string) {
+// requestObserver records proxied requests in the metrics and, if enabled,
+// the access log.
+func requestObserver(cfg config.MetricsConfig, logger *slog.Logger) proxy.RequestObserver {
+	var accessLog *slog.Logger
+	if cfg.AccessLog {
+		accessLog = logger.With("component", "access")
+	}
+	return metrics.NewRequests(cfg.SampleRate(), accessLog).Observe
+}
+
+// serviceOptions builds the registration options for a service from the
+// config.
+func serviceOptions(svc *config.Service) (services.Options, error) {
+	opts := services.Options{
+		Replicas: svc.Replicas,
+		Balance:  svc.Balance,
+		Weights:  svc.Weights,
+		Wake:     svc.Wake,
+		MaxBody:  int64(svc.MaxBody),
+	}
+	if st := svc.Sticky; st != nil {
+		opts.Sticky = &balance.Sticky{Cookie: st.Cookie, TTL: time.Duration(st.TTL)}
+	}
+	if to := svc.Timeouts; to != nil {
+		opts.Timeouts = &transport.Timeouts{Dial: time.Duration(to.Dial), ResponseHeader: time.Duration(to.ResponseHeader), Idle: time.Duration(to.Idle)}
+	}
+	if c := svc.CORS; c != nil {
+		policy, err := c.Policy()
+		if err != nil {
+			return opts, err
+		}
+		opts.CORS = policy
+	}
+	if h := svc.Headers; h != nil {
+		rw, err := headers.New(*h)
+		if err != nil {
+			return opts, err
+		}
+		opts.Headers = rw
+	}
+	if c := svc.Cache; c != nil {
+		opts.Cache = c.New()
+	}
+	if fb := svc.Fallback; fb != nil {
+		opts.Fallback = &services.Fallback{Retries: fb.Retries, Wake: fb.Wake, URL: fb.URL, Page: fb.Page}
+	}
+	if svc.BasicAuth != nil {
+		entries, err := svc.BasicAuth.Entries()
+		if err != nil {
+			return opts, err
+		}
+		basic, err := auth.NewBasic(svc.BasicAuth.Realm, entries)
+		if err != nil {
+			return opts, err
+		}
+		opts.BasicAuth = basic
+	}
+	return opts, nil
+}
+
+// registerServices registers the config's services, skipping those
+// unchanged since old, and removes services old had that are gone. A
+// service that fails to register is logged and left out.
+func registerServices(registry *services.Registry, old, new_ map[string]*config.Service, logger *slog.Logger) {
+	registry.SetConfigured(slices.Collect(maps.Keys(new_)))
+	for hostname := range old {
+		if _, ok := new_[hostname]; !ok {
+			registry.Deregister(hostname)
+		}
+	}
+	for hostname, svc := range new_ {
+		if reflect.DeepEqual(old[hostname], svc) {
+			continue
+		}
+		opts, err := serviceOptions(svc)
+		if err == nil {
+			err = registry.RegisterWithOptions(hostname, svc.Target, svc.Agent, opts)
+		}
+		if err != nil {
+			logger.Error("failed to register configured service", "hostname", hostname, "error", err)
+			continue
+		}
+		logger.Info("service configured", "hostname", hostname, "target", svc.Target, "agent", svc.Agent)
+	}
+}
+
+// publishTarget allocates the host ports the agent lists under
+// container.publish and returns the URL to route it to: the backend with
+// its port swapped for the mapped host port when that port is published,
+// otherwise the backend unchanged. Agents without container.publish have
+// any ports they held released.
+func publishTarget(ctx context.Context, serviceMgr *container.Manager, name string, agent *config.Agent, target *url.URL, logger *slog.Logger) *url.URL {
+	want := make([]container.PublishSpec, 0, len(agent.Container.Publish))
+	for _, p := range agent.Container.Publish {
+		want = append(want, container.PublishSpec{Target: p.Target, Published: p.Published, Protocol: p.Protocol})
+	}
+	ports, err := serviceMgr.PublishPorts(ctx, name, agent.Container.Name, want)
+	if err != nil {
+		logger.Error("failed to allocate published ports", "agent", name, "error", err)
+		return target
+	}
+	for _, p := range ports {
+		if p.Protocol == "tcp" && strconv.Itoa(p.Target) == target.Port() {
+			mapped := *target
+			mapped.Host = net.JoinHostPort(target.Hostname(), strconv.Itoa(p.Published))
+			return &mapped
+		}
+	}
+	return target
+}
+
+func reloadConfig(ctx context.Context, logger *slog.Logger, old, new_ *config.Config, policyByName map[string]policy.Policy, policyCancels map[string]context.CancelFunc, p *proxy.Proxy, serviceMgr *container.Manager, emitter *events.Emitter, builder *agents.Builder, adminSrv *admin.Server, sessions *openclaw.SessionMonitor, revs *revisions.Log, slas *sla.Tracker, identities *container.IdentityTracker, hb *alerts.Heartbeat) {
+	p.SetMaxRequestBody(int64(new_.MaxRequestBody))
+	p.SetMaxProxyBody(int64(new_.MaxProxyBody))
+	p.SetCompress(new_.Compress)
+	p.SetReplayBuffer(int64(new_.ReplayBuffer.Memory), int64(new_.ReplayBuffer.Disk), new_.ReplayBuffer.Dir)
+	if res, err := realip.New(new_.TrustedProxies, new_.ClientIPHeader); err == nil {
+		p.SetClientIPResolver(res)
+	}
+	p.SetRequestObserver(requestObserver(new_.Metrics, logger))
+	hb.SetTarget(new_.HeartbeatURL, time.Duration(new_.HeartbeatInterval))
+	if new_.SplashTemplate != old.SplashTemplate {
+		if splash, err := proxy.NewSplash(new_.SplashTemplate); err != nil {
+			logger.Error("config reload: invalid splash template", "error", err)
+		} else {
+			p.SetSplash(splash)
+		}
+	}
+	if redirects, err := new_.RedirectTable(); err != nil {
+		logger.Error("config reload: invalid redirects", "error", err)
+	} else {
+		p.SetRedirects(redirects)
+	}
+	if !maps.Equal(new_.ErrorPages, old.ErrorPages) {
+		if pages, err := proxy.NewErrorPages(new_.ErrorPages); err != nil {
+			logger.Error("config reload: invalid error pages", "error", err)
+		} else {
+			p.SetErrorPages(pages)
+		}
+	}
+
 	// Add new agents.
 	for name, agent := range new_.Agents {
 		if _, ok := old.Agents[name]; ok {
@@ -491,15 +1037,27 @@ func reloadConfig(ctx context.Context, logger *slog.Logger, old, new_ *config.Co
 			continue
 		}
 
-		pol, polCancel := createPolicy(name, agent, serviceMgr, p, emitter, discoveredState, logger)
-
-		p.Register(agent.Hostname, name, target, pol)
-		for _, h := range agent.Hostnames {
-			p.Register(h, name, target, pol)
+		opts, err := builder.RouteOptions(name, agent)
+		if err != nil {
+			logger.Error("config reload: invalid route options for new agent", "agent", name, "error", err)
+			continue
 		}
+		target = publishTarget(ctx, serviceMgr, name, agent, target, logger)
+
+		pol, polCancel := builder.Policy(name, agent)
+		trackSLA(slas, name, agent)
+		trackIdentity(identities, name, agent)
+
+		builder.Route(name, agent, target, pol, opts)
 
 		policyByName[name] = pol
 		policyCancels[name] = polCancel
+		if t, ok := sessionTarget(name, agent, pol); ok {
+			sessions.Register(ctx, t)
+		}
+		if err := builder.OpenPorts(ctx, name, agent, target, pol); err != nil {
+			logger.Error("config reload: failed to open agent ports", "agent", name, "error", err)
+		}
 
 		// Start policy goroutine.
 		go pol.Start(ctx)
@@ -516,6 +1074,7 @@ func reloadConfig(ctx context.Context, logger *slog.Logger, old, new_ *config.Co
 			}, pol, polCancel)
 		}
 
+		recordReload(revs, name, revisions.ActionCreated, agent, logger)
 		emitter.Emit(events.Event{Type: events.AgentAdded, Agent: name})
 		logger.Info("config reload: agent added", "agent", name, "hostname", agent.Hostname)
 	}
@@ -541,11 +1100,19 @@ func reloadConfig(ctx context.Context, logger *slog.Logger, old, new_ *config.Co
 		}
 
 		delete(policyByName, name)
+		builder.Deps.Remove(name)
+		sessions.Unregister(name)
+		identities.Unregister(name)
+		p.Jobs().Forget(name)
+		p.Ports().Unregister(name)
+		p.SNI().Unregister(name)
+		serviceMgr.ReleasePorts(name)
 
 		if adminSrv != nil {
 			adminSrv.RemoveAgentInternal(name)
 		}
 
+		recordReload(revs, name, revisions.ActionRemoved, nil, logger)
 		emitter.Emit(events.Event{Type: events.AgentRemoved, Agent: name})
 		logger.Info("config reload: agent removed", "agent", name)
 	}
@@ -556,11 +1123,59 @@ func reloadConfig(ctx context.Context, logger *slog.Logger, old, new_ *config.Co
 		if !ok {
 			continue
 		}
-		switch p := pol.(type) {
+		if oldAgent, ok := old.Agents[name]; ok && !reflect.DeepEqual(oldAgent, newAgent) {
+			recordReload(revs, name, revisions.ActionUpdated, newAgent, logger)
+		}
+		oldAgent := old.Agents[name]
+		republish := oldAgent == nil || !reflect.DeepEqual(oldAgent.Container.Publish, newAgent.Container.Publish)
+		if opts, err := builder.RouteOptions(name, newAgent); err != nil {
+			logger.Error("config reload: invalid route options", "agent", name, "error", err)
+		} else if target, err := url.Parse(newAgent.Backend); err == nil && republish {
+			// The mapped host port may have changed, so route again.
+			target = publishTarget(ctx, serviceMgr, name, newAgent, target, logger)
+			p.RegisterWithOptions(newAgent.Hostname, name, target, pol, opts)
+			for _, h := range newAgent.Hostnames {
+				p.RegisterWithOptions(h, name, target, pol, opts)
+			}
+		} else {
+			p.SetOptions(newAgent.Hostname, opts)
+			for _, h := range newAgent.Hostnames {
+				p.SetOptions(h, opts)
+			}
+		}
+		if t, ok := sessionTarget(name, newAgent, pol); ok {
+			sessions.Register(ctx, t)
+		} else {
+			sessions.Unregister(name)
+		}
+		trackSLA(slas, name, newAgent)
+		trackIdentity(identities, name, newAgent)
+		builder.Deps.Set(name, pol, newAgent.DependsOn)
+		if oldAgent, ok := old.Agents[name]; !ok || !reflect.DeepEqual(oldAgent.Ports, newAgent.Ports) {
+			if target, err := url.Parse(newAgent.Backend); err == nil {
+				if err := builder.OpenPorts(ctx, name, newAgent, target, pol); err != nil {
+					logger.Error("config reload: failed to open agent ports", "agent", name, "error", err)
+				}
+			}
+		}
+		if target, err := url.Parse(newAgent.Backend); err == nil {
+			p.SNI().Register(agents.SNITarget(name, newAgent, target, pol))
+		}
+		switch pol := pol.(type) {
 		case *policy.OnDemand:
-			p.Reconfigure(newAgent.Idle.Timeout, newAgent.Health.CheckInterval, newAgent.Health.MaxFailures, newAgent.Health.MaxRestartAttempts)
+			pol.Reconfigure(time.Duration(newAgent.Idle.Timeout), time.Duration(newAgent.Health.CheckInterval), time.Duration(newAgent.Idle.MaxUptime), newAgent.Health.MaxFailures, newAgent.Health.MaxRestartAttempts)
+			pol.SetWakeBudget(agents.WakeBudget(newAgent))
+			pol.SetSleepVeto(agents.SleepVeto(name, newAgent, logger))
+			pol.SetHealthURL(newAgent.Health.URL)
 		case *policy.AlwaysOn:
-			p.Reconfigure(newAgent.Health.CheckInterval, newAgent.Health.MaxFailures)
+			pol.Reconfigure(time.Duration(newAgent.Health.CheckInterval), newAgent.Health.MaxFailures)
+			pol.SetHealthURL(newAgent.Health.URL)
+			if newAgent.Health.RestartOnDegraded {
+				pol.EnableRestartOnDegraded(builder.Runtime, newAgent.Container.Name, newAgent.Health.MaxRestartAttempts, time.Duration(newAgent.Health.RestartCooldown))
+			} else {
+				pol.EnableRestartOnDegraded(nil, "", 0, 0)
+			}
+			pol.EnableMaxLifetime(serviceMgr, p.WSCounter(), agents.LifetimeConfig(newAgent, builder.Recycles))
 		}
 	}
 	logger.Info("config reload complete")
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"warren/internal/config"
+	"warren/internal/handoff"
+)
+
+// serveServiceAPI serves the service registration API on cfg.Listen until
+// ctx is done, over TLS when a certificate is configured. Like listen, the
+// address and certificate aren't reloadable; the tokens are, through the
+// handler.
+func serveServiceAPI(ctx context.Context, cfg config.ServiceAPIConfig, handler http.Handler, lns *handoff.Listeners, logger *slog.Logger) {
+	srv := &http.Server{
+		Addr:        cfg.Listen,
+		Handler:     handler,
+		ReadTimeout: 30 * time.Second,
+		IdleTimeout: 120 * time.Second,
+	}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			logger.Error("failed to load service api certificate", "error", err)
+			os.Exit(1)
+		}
+		srv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	}
+
+	ln, err := lns.Listen("tcp", cfg.Listen)
+	if err != nil {
+		logger.Error("failed to listen for service api", "addr", cfg.Listen, "error", err)
+		os.Exit(1)
+	}
+	if srv.TLSConfig != nil {
+		ln = tls.NewListener(ln, srv.TLSConfig)
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutCtx)
+	}()
+	go func() {
+		logger.Info("service api starting", "addr", cfg.Listen, "tls", srv.TLSConfig != nil)
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			logger.Error("service api failed", "error", err)
+		}
+	}()
+}
@@ -0,0 +1,20 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+var (
+	shutdownSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+	reloadSignals   = []os.Signal{syscall.SIGHUP}
+)
+
+func isReloadSignal(sig os.Signal) bool { return sig == syscall.SIGHUP }
+
+// upgradeSignals start a new process and hand the listeners over to it.
+var upgradeSignals = []os.Signal{syscall.SIGUSR2}
+
+func isUpgradeSignal(sig os.Signal) bool { return sig == syscall.SIGUSR2 }
@@ -0,0 +1,22 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// Windows only delivers Ctrl+C and console close; config reloads need a
+// restart there.
+var (
+	shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	reloadSignals   []os.Signal
+)
+
+func isReloadSignal(os.Signal) bool { return false }
+
+// Nor can listeners be handed to a new process, so there are no upgrades.
+var upgradeSignals []os.Signal
+
+func isUpgradeSignal(os.Signal) bool { return false }
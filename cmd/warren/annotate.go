@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+func agentAnnotateCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "annotate <name> key=value... [key-]...",
+		Short: "Set or remove notes on an agent",
+		Long: "Attach notes for operators to an agent, such as its owner or \"do not sleep during\n" +
+			"demos\". They're stored in the orchestrator's config and shown by agent inspect and\n" +
+			"agent list --wide; Warren itself ignores them. key=value sets a note, key- removes one.",
+		Example: "  warren agent annotate kai owner=team-x \"note=do not sleep during demos\"\n" +
+			"  warren agent annotate kai note-",
+		Args: cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			patch := make(map[string]*string, len(args)-1)
+			for _, arg := range args[1:] {
+				if key, value, ok := strings.Cut(arg, "="); ok {
+					patch[key] = &value
+					continue
+				}
+				if key, ok := strings.CutSuffix(arg, "-"); ok {
+					patch[key] = nil
+					continue
+				}
+				return fmt.Errorf("invalid annotation %q: use key=value to set or key- to remove", arg)
+			}
+			data, err := apiPatch("/admin/agents/"+args[0]+"/annotations", patch)
+			if err != nil {
+				return err
+			}
+			if format == "json" {
+				fmt.Println(string(data))
+				return nil
+			}
+			var annotations map[string]string
+			if err := json.Unmarshal(data, &annotations); err != nil {
+				return fmt.Errorf("parse annotations: %w", err)
+			}
+			if len(annotations) == 0 {
+				fmt.Printf("%s has no annotations\n", args[0])
+				return nil
+			}
+			fmt.Printf("Annotated %s: %s\n", args[0], formatAnnotations(annotations))
+			return nil
+		},
+	}
+}
+
+// formatAnnotations renders annotations as "key=value" pairs in key order.
+func formatAnnotations(annotations map[string]string) string {
+	if len(annotations) == 0 {
+		return "-"
+	}
+	pairs := make([]string, 0, len(annotations))
+	for _, k := range sortedNames(annotations) {
+		pairs = append(pairs, k+"="+annotations[k])
+	}
+	return strings.Join(pairs, ", ")
+}
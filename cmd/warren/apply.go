@@ -0,0 +1,444 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"warren/internal/human"
+)
+
+// applyFile is the desired state read by warren apply: every agent and
+// dynamic service the orchestrator should have, keyed by name and hostname.
+type applyFile struct {
+	Agents   map[string]applyAgent   `yaml:"agents"`
+	Services map[string]applyService `yaml:"services"`
+}
+
+// applyAgent mirrors the admin API's add agent request.
+type applyAgent struct {
+	Hostname      string `yaml:"hostname" json:"hostname"`
+	Backend       string `yaml:"backend" json:"backend"`
+	Policy        string `yaml:"policy" json:"policy"`
+	ContainerName string `yaml:"container_name,omitempty" json:"container_name,omitempty"`
+	HealthURL     string `yaml:"health_url,omitempty" json:"health_url,omitempty"`
+	IdleTimeout   string `yaml:"idle_timeout,omitempty" json:"idle_timeout,omitempty"`
+}
+
+// applyService holds the service settings the admin API reports back, so
+// they can be compared with what's running.
+type applyService struct {
+	Target   string         `yaml:"target" json:"target"`
+	Agent    string         `yaml:"agent,omitempty" json:"agent,omitempty"`
+	Replicas []string       `yaml:"replicas,omitempty" json:"replicas,omitempty"`
+	Balance  string         `yaml:"balance,omitempty" json:"balance,omitempty"`
+	Weights  []int          `yaml:"weights,omitempty" json:"weights,omitempty"`
+	Wake     bool           `yaml:"wake,omitempty" json:"wake,omitempty"`
+	Fallback *applyFallback `yaml:"fallback,omitempty" json:"fallback,omitempty"`
+}
+
+type applyFallback struct {
+	Retries int    `yaml:"retries,omitempty" json:"retries,omitempty"`
+	Wake    bool   `yaml:"wake,omitempty" json:"wake,omitempty"`
+	URL     string `yaml:"url,omitempty" json:"url,omitempty"`
+	Page    string `yaml:"page,omitempty" json:"page,omitempty"`
+}
+
+// applyChange is one step of a plan.
+type applyChange struct {
+	action  string // "create", "update" or "delete"
+	kind    string // "agent" or "service"
+	name    string
+	diff    []string // "field: old → new", for updates
+	agent   applyAgent
+	service applyService
+	// reregister replaces a service rather than patching it, for a change
+	// of owner, which resets options the file doesn't set.
+	reregister bool
+}
+
+func applyCmd() *cobra.Command {
+	var file string
+	var dryRun, yes, force bool
+	cmd := &cobra.Command{
+		Use:   "apply -f <file>",
+		Short: "Converge agents and services on a desired-state file",
+		Long: "Read a YAML file listing every agent and dynamic service the orchestrator should have,\n" +
+			"compare it with what's running and print a plan of what would be created, updated and\n" +
+			"deleted. After confirmation the plan is carried out through the admin API. Agents and\n" +
+			"services that aren't in the file are deleted; removed agents go to the trash.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if file == "" {
+				return fmt.Errorf("-f is required")
+			}
+			desired, err := readApplyFile(file)
+			if err != nil {
+				return err
+			}
+			agents, err := currentAgents()
+			if err != nil {
+				return err
+			}
+			services, err := currentServices()
+			if err != nil {
+				return err
+			}
+
+			plan := planApply(desired, agents, services)
+			if len(plan) == 0 {
+				fmt.Println("No changes: the orchestrator matches " + file + ".")
+				return nil
+			}
+			printPlan(plan)
+			if dryRun {
+				return nil
+			}
+			if !confirm("Apply these changes?", yes || force) {
+				fmt.Println("Cancelled.")
+				return nil
+			}
+			for _, c := range plan {
+				if err := c.apply(force); err != nil {
+					return fmt.Errorf("%s %s %s: %w", c.action, c.kind, c.name, err)
+				}
+				fmt.Printf("%sd %s %s\n", strings.TrimSuffix(c.action, "e"), c.kind, c.name)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&file, "filename", "f", "", "desired-state YAML file (- for stdin)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "print the plan without changing anything")
+	addDestructiveFlags(cmd, &yes, &force)
+	return cmd
+}
+
+// readApplyFile parses a desired-state file, rejecting unknown fields so a
+// typo doesn't silently drop a setting.
+func readApplyFile(path string) (applyFile, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return applyFile{}, err
+	}
+	var f applyFile
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&f); err != nil && !errors.Is(err, io.EOF) {
+		return applyFile{}, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for _, name := range sortedNames(f.Agents) {
+		a := f.Agents[name]
+		if a.Hostname == "" || a.Backend == "" || a.Policy == "" {
+			return applyFile{}, fmt.Errorf("agent %q: hostname, backend and policy are required", name)
+		}
+		if a.IdleTimeout != "" {
+			if _, err := human.ParseDuration(a.IdleTimeout); err != nil {
+				return applyFile{}, fmt.Errorf("agent %q: idle_timeout: %w", name, err)
+			}
+		}
+	}
+	for _, hostname := range sortedNames(f.Services) {
+		if f.Services[hostname].Target == "" {
+			return applyFile{}, fmt.Errorf("service %q: target is required", hostname)
+		}
+	}
+	return f, nil
+}
+
+// currentAgents returns the running container agents by name. Process
+// agents come and go on their own and are left out.
+func currentAgents() (map[string]applyAgent, error) {
+	data, err := apiGet("/admin/agents")
+	if err != nil {
+		return nil, err
+	}
+	var list []struct {
+		applyAgent
+		Name string `json:"name"`
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("parse agents: %w", err)
+	}
+	agents := make(map[string]applyAgent, len(list))
+	for _, a := range list {
+		if a.Type == "" || a.Type == "container" {
+			agents[a.Name] = a.applyAgent
+		}
+	}
+	return agents, nil
+}
+
+// currentServices returns the registered dynamic services by hostname.
+func currentServices() (map[string]applyService, error) {
+	data, err := apiGet("/api/services")
+	if err != nil {
+		return nil, err
+	}
+	var list []struct {
+		Hostname string         `json:"hostname"`
+		Target   string         `json:"target"`
+		Agent    string         `json:"agent"`
+		Targets  []string       `json:"targets"`
+		Balance  string         `json:"balance"`
+		Weights  []int          `json:"weights"`
+		Wake     bool           `json:"wake"`
+		Fallback *applyFallback `json:"fallback"`
+	}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("parse services: %w", err)
+	}
+	services := make(map[string]applyService, len(list))
+	for _, s := range list {
+		svc := applyService{Target: s.Target, Agent: s.Agent, Balance: s.Balance, Weights: s.Weights, Wake: s.Wake, Fallback: s.Fallback}
+		if len(s.Targets) > 1 {
+			svc.Replicas = s.Targets[1:]
+		}
+		services[s.Hostname] = svc
+	}
+	return services, nil
+}
+
+// planApply lists the changes that turn the current state into desired:
+// agents before the services that may belong to them, deletions last.
+func planApply(desired applyFile, agents map[string]applyAgent, services map[string]applyService) []applyChange {
+	var plan, deletes []applyChange
+	for _, name := range sortedNames(desired.Agents) {
+		want := desired.Agents[name]
+		have, ok := agents[name]
+		if !ok {
+			plan = append(plan, applyChange{action: "create", kind: "agent", name: name, agent: want})
+			continue
+		}
+		if want.IdleTimeout == "" {
+			// Unset keeps whatever the agent has.
+			want.IdleTimeout = have.IdleTimeout
+		}
+		if diff := agentDiff(have, want); len(diff) > 0 {
+			plan = append(plan, applyChange{action: "update", kind: "agent", name: name, diff: diff, agent: want})
+		}
+	}
+	for _, hostname := range sortedNames(desired.Services) {
+		want := desired.Services[hostname]
+		have, ok := services[hostname]
+		if !ok {
+			plan = append(plan, applyChange{action: "create", kind: "service", name: hostname, service: want})
+			continue
+		}
+		if diff := serviceDiff(have, want); len(diff) > 0 {
+			c := applyChange{action: "update", kind: "service", name: hostname, diff: diff, service: want, reregister: have.Agent != want.Agent}
+			if c.reregister {
+				c.diff = append(c.diff, "(new owner: re-registered, options not in the file are reset)")
+			}
+			plan = append(plan, c)
+		}
+	}
+	for _, hostname := range sortedNames(services) {
+		if _, ok := desired.Services[hostname]; !ok {
+			deletes = append(deletes, applyChange{action: "delete", kind: "service", name: hostname})
+		}
+	}
+	for _, name := range sortedNames(agents) {
+		if _, ok := desired.Agents[name]; !ok {
+			deletes = append(deletes, applyChange{action: "delete", kind: "agent", name: name})
+		}
+	}
+	return append(plan, deletes...)
+}
+
+func agentDiff(have, want applyAgent) []string {
+	var diff []string
+	field := func(name, old, new string) {
+		if old != new {
+			diff = append(diff, fmt.Sprintf("%s: %s → %s", name, orNone(old), orNone(new)))
+		}
+	}
+	field("hostname", have.Hostname, want.Hostname)
+	field("backend", have.Backend, want.Backend)
+	field("policy", have.Policy, want.Policy)
+	field("container_name", have.ContainerName, want.ContainerName)
+	field("health_url", have.HealthURL, want.HealthURL)
+	if !sameDuration(have.IdleTimeout, want.IdleTimeout) {
+		field("idle_timeout", have.IdleTimeout, want.IdleTimeout)
+	}
+	return diff
+}
+
+func serviceDiff(have, want applyService) []string {
+	var diff []string
+	field := func(name string, old, new any) {
+		// Compared as shown, so an empty list matches an unset one.
+		if o, n := planValue(old), planValue(new); o != n {
+			diff = append(diff, fmt.Sprintf("%s: %s → %s", name, o, n))
+		}
+	}
+	field("target", have.Target, want.Target)
+	field("agent", have.Agent, want.Agent)
+	field("replicas", have.Replicas, want.Replicas)
+	if len(want.Replicas) > 0 {
+		// The registry reports the strategy it picked for an unset balance.
+		balance := want.Balance
+		if balance == "" && len(want.Weights) > 0 {
+			balance = "weighted"
+		} else if balance == "" {
+			balance = "round-robin"
+		}
+		field("balance", have.Balance, balance)
+	}
+	field("weights", have.Weights, want.Weights)
+	field("wake", have.Wake, want.Wake)
+	field("fallback", have.Fallback, want.Fallback)
+	return diff
+}
+
+func sameDuration(a, b string) bool {
+	da, errA := human.ParseDuration(a)
+	db, errB := human.ParseDuration(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	return da == db
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
+
+func planValue(v any) string {
+	switch v := v.(type) {
+	case string:
+		return orNone(v)
+	case []string:
+		if len(v) == 0 {
+			return "(none)"
+		}
+		return strings.Join(v, ", ")
+	case []int:
+		if len(v) == 0 {
+			return "(none)"
+		}
+		return strings.Trim(fmt.Sprint(v), "[]")
+	case *applyFallback:
+		if v == nil {
+			return "(none)"
+		}
+		b, _ := json.Marshal(v)
+		return string(b)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func printPlan(plan []applyChange) {
+	create, update, del := printChanges(plan)
+	fmt.Printf("Plan: %d to create, %d to update, %d to delete.\n", create, update, del)
+}
+
+// printChanges prints each change with +, ~ or - and returns how many of
+// each there were.
+func printChanges(changes []applyChange) (create, update, del int) {
+	for _, c := range changes {
+		switch c.action {
+		case "create":
+			create++
+			fmt.Printf("+ %s %s\n", c.kind, c.name)
+		case "update":
+			update++
+			fmt.Printf("~ %s %s\n", c.kind, c.name)
+			for _, d := range c.diff {
+				fmt.Printf("    %s\n", d)
+			}
+		case "delete":
+			del++
+			fmt.Printf("- %s %s\n", c.kind, c.name)
+		}
+	}
+	return create, update, del
+}
+
+func (c applyChange) apply(force bool) error {
+	var err error
+	switch {
+	case c.kind == "agent" && c.action == "create":
+		body := map[string]any{"name": c.name}
+		mergeJSON(body, c.agent)
+		_, err = apiPost("/admin/agents", body)
+	case c.kind == "agent" && c.action == "update":
+		_, err = apiPut("/admin/agents/"+c.name, c.agent)
+	case c.kind == "service" && c.action == "update" && !c.reregister:
+		// Patched rather than registered again, so options the file
+		// doesn't cover, such as CORS or caching, are kept.
+		_, err = apiPatch("/api/services/"+c.name, c.service.patch())
+	case c.kind == "service" && c.action != "delete":
+		// Registering a hostname again replaces the service.
+		body := map[string]any{"hostname": c.name}
+		mergeJSON(body, c.service)
+		_, err = apiPost("/api/services", body)
+	case c.kind == "agent":
+		_, err = apiDelete(removePath("/admin/agents/"+c.name, force))
+	default:
+		_, err = apiDelete(removePath("/api/services/"+c.name, force))
+	}
+	return err
+}
+
+// patch returns the PATCH /api/services body that sets every field apply
+// manages to s's values.
+func (s applyService) patch() map[string]any {
+	body := map[string]any{"target": s.Target, "replicas": s.Replicas, "wake": s.Wake}
+	if s.Replicas == nil {
+		body["replicas"] = []string{}
+	}
+	if len(s.Weights) > 0 {
+		body["weights"] = s.Weights
+	}
+	if len(s.Replicas) > 0 {
+		// Unset means the registry's default, as serviceDiff compares.
+		switch {
+		case s.Balance != "":
+			body["balance"] = s.Balance
+		case len(s.Weights) > 0:
+			body["balance"] = "weighted"
+		default:
+			body["balance"] = "round-robin"
+		}
+	}
+	if s.Fallback != nil {
+		body["fallback"] = s.Fallback
+	} else {
+		body["fallback"] = applyFallback{} // removes it
+	}
+	return body
+}
+
+// mergeJSON adds v's JSON fields to body.
+func mergeJSON(body map[string]any, v any) {
+	data, _ := json.Marshal(v)
+	_ = json.Unmarshal(data, &body)
+}
+
+func sortedNames[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
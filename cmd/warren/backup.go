@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+func backupCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "backup [file]",
+		Short: "Save the orchestrator's runtime state to a file",
+		Long: "Save agents, dynamic services, manual holds and recent events to a single YAML archive,\n" +
+			"for disaster recovery or moving to another instance with warren restore. Without a file\n" +
+			"the archive is written to stdout. It contains secrets such as basic auth hashes.",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := apiGet("/admin/backup")
+			if err != nil {
+				return err
+			}
+			if len(args) == 0 {
+				_, err := os.Stdout.Write(data)
+				return err
+			}
+			if err := os.WriteFile(args[0], data, 0o600); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.ErrOrStderr(), "Backup written to %s\n", args[0])
+			return nil
+		},
+	}
+}
+
+func restoreCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "restore <file>",
+		Short: "Restore runtime state from a warren backup",
+		Long: "Restore agents, dynamic services, manual holds and events from an archive written by\n" +
+			"warren backup. Anything that already exists on the orchestrator is left as it is and\n" +
+			"reported as skipped. Use - to read the archive from stdin.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var in io.Reader = os.Stdin
+			if args[0] != "-" {
+				f, err := os.Open(args[0])
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				in = f
+			}
+			data, err := apiDo(http.MethodPost, "/admin/restore", in)
+			if err != nil {
+				return err
+			}
+			if format == "json" {
+				fmt.Println(string(data))
+				return nil
+			}
+			var summary struct {
+				Agents   []string `json:"agents"`
+				Services []string `json:"services"`
+				Holds    []string `json:"holds"`
+				Events   int      `json:"events"`
+				Skipped  []struct {
+					Kind   string `json:"kind"`
+					Name   string `json:"name"`
+					Reason string `json:"reason"`
+				} `json:"skipped"`
+			}
+			if err := json.Unmarshal(data, &summary); err != nil {
+				return fmt.Errorf("parse restore summary: %w", err)
+			}
+			fmt.Printf("Restored %d agents, %d services, %d holds and %d events\n",
+				len(summary.Agents), len(summary.Services), len(summary.Holds), summary.Events)
+			for _, s := range summary.Skipped {
+				fmt.Printf("  skipped %s %s: %s\n", s.Kind, s.Name, s.Reason)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"warren/internal/human"
+)
+
+func bansCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bans",
+		Short: "Manage client addresses banned after repeated failures",
+	}
+
+	cmd.AddCommand(
+		bansListCmd(),
+		bansRemoveCmd(),
+	)
+
+	return cmd
+}
+
+func bansListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List banned client addresses",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := apiGet("/admin/bans")
+			if err != nil {
+				return err
+			}
+			if format == "json" {
+				fmt.Println(string(data))
+				return nil
+			}
+			var bans []struct {
+				IP      string    `json:"ip"`
+				Reason  string    `json:"reason"`
+				Strikes int       `json:"strikes"`
+				Since   time.Time `json:"since"`
+				Until   time.Time `json:"until"`
+			}
+			if err := json.Unmarshal(data, &bans); err != nil {
+				return fmt.Errorf("parse bans: %w", err)
+			}
+			if quiet {
+				for _, b := range bans {
+					fmt.Println(b.IP)
+				}
+				return nil
+			}
+			if len(bans) == 0 {
+				fmt.Println("No banned addresses.")
+				return nil
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ADDRESS\tREASON\tSTRIKES\tBANNED\tEXPIRES IN")
+			for _, b := range bans {
+				fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", b.IP, b.Reason, b.Strikes, formatAgo(b.Since), human.Approx(time.Until(b.Until)))
+			}
+			return w.Flush()
+		},
+	}
+}
+
+func bansRemoveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "remove <ip>",
+		Short: "Lift a ban before it expires",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := apiDelete("/admin/bans/" + args[0]); err != nil {
+				return err
+			}
+			fmt.Printf("Unbanned %s\n", args[0])
+			return nil
+		},
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Bounds on the response cache, so watches don't rewrite it every refresh
+// and one entry per label selector doesn't grow it without limit.
+const (
+	cacheMaxEntries = 32
+	cacheMinAge     = time.Minute // an unchanged response younger than this isn't rewritten
+)
+
+// cacheEntry is the last successful response to a GET request, so read
+// commands can show the last-known state with --cached while the admin API
+// is unreachable. Only what --cached reads is saved, which holds no
+// secrets.
+type cacheEntry struct {
+	FetchedAt time.Time       `json:"fetched_at"`
+	Body      json.RawMessage `json:"body"`
+}
+
+// cachePath is the response cache file, next to the CLI's config file.
+func cachePath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".warren", "cache.json")
+}
+
+func readCache() map[string]cacheEntry {
+	entries := map[string]cacheEntry{}
+	data, err := os.ReadFile(cachePath())
+	if err == nil {
+		_ = json.Unmarshal(data, &entries)
+	}
+	return entries
+}
+
+// saveCache records body as the response to a GET of path from the current
+// admin API, for cachedGet. Failures are ignored: the cache is a convenience
+// and must never break a command that succeeded.
+func saveCache(path string, body []byte) {
+	if !json.Valid(body) {
+		return
+	}
+	endpoint := getAdminURL() + path
+	entries := readCache()
+	now := time.Now().UTC()
+	if e, ok := entries[endpoint]; ok && now.Sub(e.FetchedAt) < cacheMinAge && bytes.Equal(e.Body, body) {
+		return
+	}
+	entries[endpoint] = cacheEntry{FetchedAt: now, Body: body}
+	for len(entries) > cacheMaxEntries {
+		oldest := endpoint
+		for k, e := range entries {
+			if e.FetchedAt.Before(entries[oldest].FetchedAt) {
+				oldest = k
+			}
+		}
+		delete(entries, oldest)
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return
+	}
+	file := cachePath()
+	if os.MkdirAll(filepath.Dir(file), 0o700) != nil {
+		return
+	}
+	// Write then rename so concurrent commands never see a partial file.
+	// CreateTemp makes it readable only by the user.
+	tmp, err := os.CreateTemp(filepath.Dir(file), "cache-*.json")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil || os.Rename(tmp.Name(), file) != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+// cachedGet returns the last successful response to a GET of path from the
+// current admin API, and when it was fetched.
+func cachedGet(path string) ([]byte, time.Time, error) {
+	endpoint := getAdminURL() + path
+	e, ok := readCache()[endpoint]
+	if !ok {
+		return nil, time.Time{}, fmt.Errorf("no cached response for %s; run the command once without --cached while the admin API is reachable", endpoint)
+	}
+	return e.Body, e.FetchedAt, nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"warren/internal/human"
+)
+
+// exitCode is returned by commands run with --exit-code, which report their
+// result through the process exit status alone. main exits with it without
+// printing anything.
+type exitCode int
+
+// Exit codes for --exit-code health checks.
+const (
+	exitHealthy     exitCode = 0
+	exitDegraded    exitCode = 1 // some agent is degraded or crash-looping
+	exitUnreachable exitCode = 2 // the admin API could not be queried
+)
+
+func (c exitCode) Error() string { return fmt.Sprintf("exit status %d", int(c)) }
+
+// exitWith ends cmd with code, or nil for exitHealthy, keeping cobra from
+// printing the error and usage.
+func exitWith(cmd *cobra.Command, code exitCode) error {
+	if code == exitHealthy {
+		return nil
+	}
+	cmd.SilenceErrors = true
+	cmd.SilenceUsage = true
+	return code
+}
+
+// unhealthy reports whether an agent state needs attention. Sleeping and
+// starting agents are where they should be.
+func unhealthy(state string) bool {
+	return state == "degraded" || state == "crashloop"
+}
+
+// waitPoll is how often waitReady checks the agent's state.
+var waitPoll = time.Second
+
+// waitReady polls an agent until it's ready or unhealthy, returning that
+// state, or fails once timeout passes. Brief admin API errors, such as
+// during an orchestrator restart, are retried until then. An agent back to
+// sleeping after it was seen starting, or whose wake requested at or after
+// since ended other than ready, failed to wake: its state is returned then
+// too, with the wake's outcome when known. A sleeping agent is otherwise
+// taken to be yet to start.
+func waitReady(name string, since time.Time, timeout time.Duration) (string, error) {
+	deadline := time.Now().Add(timeout)
+	state := "unknown"
+	started := false
+	for {
+		data, err := apiGet("/admin/agents/" + name)
+		if err == nil {
+			var info struct {
+				State string `json:"state"`
+			}
+			if err := json.Unmarshal(data, &info); err != nil {
+				return "", fmt.Errorf("parse agent: %w", err)
+			}
+			state = info.State
+			if state == "ready" || unhealthy(state) {
+				return state, nil
+			}
+			switch state {
+			case "starting":
+				started = true
+			case "sleeping":
+				if outcome := wakeOutcome(name, since); outcome != "" && outcome != "ready" {
+					return state + " (wake " + outcome + ")", nil
+				}
+				if started {
+					return state, nil
+				}
+			}
+		}
+		if time.Now().Add(waitPoll).After(deadline) {
+			if err != nil {
+				return "", fmt.Errorf("timed out after %s waiting for %s: %w", human.FormatDuration(timeout), name, err)
+			}
+			return "", fmt.Errorf("timed out after %s waiting for %s to be ready (still %s)", human.FormatDuration(timeout), name, state)
+		}
+		time.Sleep(waitPoll)
+	}
+}
+
+// wakeOutcome returns the outcome of the agent's last wake, or "" if there is
+// none yet or it was requested before since, by the orchestrator's clock.
+func wakeOutcome(name string, since time.Time) string {
+	data, err := apiGet("/admin/agents/" + name + "/wake")
+	if err != nil {
+		return ""
+	}
+	var trace struct {
+		TriggeredAt time.Time `json:"triggered_at"`
+		Outcome     string    `json:"outcome"`
+	}
+	if json.Unmarshal(data, &trace) != nil || trace.TriggeredAt.Before(since) {
+		return ""
+	}
+	return trace.Outcome
+}
+
+// checkAgents returns the names of agents in an unhealthy state.
+func checkAgents() ([]string, error) {
+	data, err := apiGet("/admin/agents")
+	if err != nil {
+		return nil, err
+	}
+	var agents []struct {
+		Name  string `json:"name"`
+		State string `json:"state"`
+	}
+	if err := json.Unmarshal(data, &agents); err != nil {
+		return nil, fmt.Errorf("parse agents: %w", err)
+	}
+	var bad []string
+	for _, a := range agents {
+		if unhealthy(a.State) {
+			bad = append(bad, a.Name)
+		}
+	}
+	return bad, nil
+}
+
+func agentCheckCmd() *cobra.Command {
+	var useExitCode bool
+	cmd := &cobra.Command{
+		Use:   "check <name>",
+		Short: "Check whether an agent is healthy",
+		Long: "Check whether an agent is healthy. With --exit-code nothing is printed and the\n" +
+			"exit status says it all: 0 healthy (or sleeping), 1 degraded, 2 if the agent could\n" +
+			"not be queried (Warren unreachable or no such agent).",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := apiGet("/admin/agents/" + args[0])
+			if err != nil {
+				if useExitCode {
+					return exitWith(cmd, exitUnreachable)
+				}
+				return err
+			}
+			var info struct {
+				State string `json:"state"`
+			}
+			if err := json.Unmarshal(data, &info); err != nil {
+				return fmt.Errorf("parse agent: %w", err)
+			}
+			code := exitHealthy
+			if unhealthy(info.State) {
+				code = exitDegraded
+			}
+			if useExitCode {
+				return exitWith(cmd, code)
+			}
+			status := "ok"
+			if code != exitHealthy {
+				status = "unhealthy"
+			}
+			fmt.Printf("%s: %s (%s)\n", args[0], info.State, status)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&useExitCode, "exit-code", false, "print nothing; exit 0 if healthy, 1 if degraded, 2 if unreachable")
+	return cmd
+}
@@ -2,18 +2,25 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/spf13/cobra"
+
+	"warren/internal/config"
 )
 
 // mockAdminServer creates an httptest server with the given route handlers.
@@ -43,37 +50,66 @@ func executeCommand(t *testing.T, serverURL string, args ...string) (string, err
 	// Reset globals.
 	adminURL = serverURL
 	format = "table"
+	utc = false
+	quiet = false
+	output = ""
+	contextName = ""
 
 	root := &cobra.Command{
 		Use:   "warren",
 		Short: "Warren CLI",
 	}
 	root.PersistentFlags().StringVar(&adminURL, "admin", serverURL, "admin API URL")
+	root.PersistentFlags().StringVar(&contextName, "context", "", "context to use")
 	root.PersistentFlags().StringVar(&format, "format", "table", "output format")
+	root.PersistentFlags().BoolVar(&utc, "utc", false, "show timestamps in UTC")
+	root.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "print only names")
+	root.PersistentFlags().StringVarP(&output, "output", "o", "", "print only this field")
 
 	agentCmd := &cobra.Command{Use: "agent", Short: "Manage agents"}
 	agentCmd.AddCommand(
 		agentListCmd(),
 		agentAddCmd(),
 		agentRemoveCmd(),
+		agentRestoreCmd(),
+		agentHistoryCmd(),
+		agentRollbackCmd(),
 		agentInspectCmd(),
+		agentCheckCmd(),
 		agentWakeCmd(),
 		agentSleepCmd(),
+		agentExportCmd(),
+		agentAnnotateCmd(),
+		agentUpdateCmd(),
 	)
 
 	serviceCmd := &cobra.Command{Use: "service", Short: "Manage dynamic services"}
 	serviceCmd.AddCommand(
 		serviceListCmd(),
 		serviceAddCmd(),
+		serviceUpdateCmd(),
 		serviceRemoveCmd(),
+		serviceRestoreCmd(),
+		serviceHistoryCmd(),
 	)
 
 	root.AddCommand(
 		agentCmd,
 		serviceCmd,
+		openclawCmd(),
 		statusCmd(),
+		trashCmd(),
+		bansCmd(),
 		eventsCmd(),
-		configValidateCmd(),
+		backupCmd(),
+		exportCmd(),
+		restoreCmd(),
+		applyCmd(),
+		importCmd(),
+		configCmd(),
+		contextCmd(),
+		doctorCmd(),
+		topCmd(),
 		initCmd(),
 		scaffoldCmd(),
 	)
@@ -128,6 +164,99 @@ func TestAgentList_Table(t *testing.T) {
 	}
 }
 
+func TestAgentList_DNSMismatch(t *testing.T) {
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"GET /admin/agents": func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode([]map[string]any{
+				{"name": "agent1", "hostname": "a1.example.com", "policy": "on-demand", "state": "ready", "dns_mismatch": []string{"a1.example.com"}},
+			})
+		},
+	})
+	defer srv.Close()
+
+	out, err := executeCommand(t, srv.URL, "agent", "list")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out, "ready (dns mismatch)") {
+		t.Errorf("expected dns mismatch marker in output:\n%s", out)
+	}
+}
+
+func TestAgentList_Cached(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"GET /admin/agents": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`[{"name":"agent1","hostname":"a1.example.com","policy":"on-demand","state":"ready"}]`))
+		},
+		"GET /admin/export": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"admin_token":"secret"}`))
+		},
+	})
+	url := srv.URL
+
+	if _, err := executeCommand(t, url, "agent", "list", "--cached"); err == nil || !strings.Contains(err.Error(), "no cached response") {
+		t.Fatalf("expected an error before anything was cached, got %v", err)
+	}
+	if _, err := executeCommand(t, url, "agent", "list"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Only what --cached reads is saved, so exports and their secrets
+	// never reach the disk, and only the user can read it.
+	if _, err := apiGet("/admin/export"); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	fi, err := os.Stat(cachePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0o600 {
+		t.Errorf("cache mode = %v, want 0600", fi.Mode().Perm())
+	}
+	if entries := readCache(); len(entries) != 1 {
+		t.Errorf("cache has %d entries, want only the agent list", len(entries))
+	}
+
+	// The admin API is down; the last response is still shown.
+	srv.Close()
+	if _, err := executeCommand(t, url, "agent", "list"); err == nil {
+		t.Fatal("expected an error with the admin API down")
+	}
+	out, err := executeCommand(t, url, "agent", "list", "--cached")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out, "agent1") || !strings.Contains(out, "ready") {
+		t.Errorf("expected the cached agent in output:\n%s", out)
+	}
+	if !strings.Contains(out, "cached state from") {
+		t.Errorf("expected a note that the output is cached:\n%s", out)
+	}
+}
+
+func TestAgentList_Selector(t *testing.T) {
+	var query string
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"GET /admin/agents": func(w http.ResponseWriter, r *http.Request) {
+			query = r.URL.Query().Get("selector")
+			w.Write([]byte(`[{"name":"agent1","state":"ready","labels":{"env":"staging"}}]`))
+		},
+	})
+	defer srv.Close()
+
+	out, err := executeCommand(t, srv.URL, "agent", "list", "-l", "env=staging", "--wide")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if query != "env=staging" {
+		t.Errorf("selector = %q, want env=staging", query)
+	}
+	if !strings.Contains(out, "LABELS") || !strings.Contains(out, "env=staging") {
+		t.Errorf("expected labels in wide output:\n%s", out)
+	}
+}
+
 func TestAgentList_JSON(t *testing.T) {
 	srv := mockAdminServer(t, map[string]http.HandlerFunc{
 		"GET /admin/agents": func(w http.ResponseWriter, r *http.Request) {
@@ -233,6 +362,30 @@ func TestAgentAdd_Conflict(t *testing.T) {
 	}
 }
 
+func TestAgentAdd_FieldErrors(t *testing.T) {
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"POST /admin/agents": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(422)
+			w.Write([]byte(`{"error":"invalid request","fields":[{"field":"policy","message":"must be one of on-demand, always-on, unmanaged, got \"on-demnd\""},{"field":"idle_timeout","message":"invalid duration \"5 minutes\""}]}`))
+		},
+	})
+	defer srv.Close()
+
+	_, err := executeCommand(t, srv.URL, "agent", "add",
+		"--name", "x",
+		"--hostname", "x.example.com",
+		"--backend", "http://b:18790",
+		"--policy", "on-demnd",
+	)
+	if err == nil {
+		t.Fatal("expected error for invalid request, got nil")
+	}
+	want := "invalid request:\n  policy: must be one of on-demand, always-on, unmanaged, got \"on-demnd\"\n  idle_timeout: invalid duration \"5 minutes\""
+	if err.Error() != want {
+		t.Errorf("error =\n%s\nwant\n%s", err, want)
+	}
+}
+
 // --- Agent Remove Tests ---
 
 func TestAgentRemove_Success(t *testing.T) {
@@ -305,6 +458,147 @@ func TestAgentRemove_NotFound(t *testing.T) {
 	}
 }
 
+func TestAgentRemove_ForceSkipsPrompt(t *testing.T) {
+	var query string
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"DELETE /admin/agents/myagent": func(w http.ResponseWriter, r *http.Request) {
+			query = r.URL.RawQuery
+			w.Write([]byte(`{"status":"removed"}`))
+		},
+	})
+	defer srv.Close()
+
+	out, err := executeCommand(t, srv.URL, "agent", "remove", "myagent", "--force")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(out, "[y/N]") {
+		t.Errorf("expected no prompt with --force, got:\n%s", out)
+	}
+	if query != "force=true" {
+		t.Errorf("query = %q, want force=true", query)
+	}
+}
+
+func TestAgentRestore(t *testing.T) {
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"POST /admin/agents/myagent/restore": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"status":"ok","name":"myagent"}`))
+		},
+	})
+	defer srv.Close()
+
+	out, err := executeCommand(t, srv.URL, "agent", "restore", "myagent")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out, "myagent") {
+		t.Errorf("expected agent name in output, got:\n%s", out)
+	}
+}
+
+func TestAgentHistory(t *testing.T) {
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"GET /admin/agents/myagent/revisions": func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode([]map[string]any{
+				{"revision": 2, "action": "updated", "actor": "alice@ops", "at": time.Now(),
+					"changes": []map[string]string{{"field": "idle.timeout", "old": "30m0s", "new": "1h0m0s"}}},
+				{"revision": 1, "action": "loaded", "actor": "config", "at": time.Now()},
+			})
+		},
+	})
+	defer srv.Close()
+
+	out, err := executeCommand(t, srv.URL, "agent", "history", "myagent")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{"#2", "updated", "alice@ops", "idle.timeout: 30m0s -> 1h0m0s", "#1", "loaded"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestAgentRollback(t *testing.T) {
+	var body map[string]int
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"POST /admin/agents/myagent/rollback": func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&body)
+			w.Write([]byte(`{"status":"ok"}`))
+		},
+	})
+	defer srv.Close()
+
+	if _, err := executeCommand(t, srv.URL, "agent", "rollback", "myagent", "#3"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if body["revision"] != 3 {
+		t.Errorf("rollback body = %v, want revision 3", body)
+	}
+	if _, err := executeCommand(t, srv.URL, "agent", "rollback", "myagent", "latest"); err == nil {
+		t.Error("expected error for non-numeric revision")
+	}
+}
+
+func TestTrashList(t *testing.T) {
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"GET /admin/trash": func(w http.ResponseWriter, r *http.Request) {
+			now := time.Now()
+			json.NewEncoder(w).Encode(map[string]any{
+				"agents":   []map[string]any{{"name": "oops", "removed_at": now, "expires_at": now.Add(time.Hour)}},
+				"services": []map[string]any{{"hostname": "preview.example.com", "removed_at": now, "expires_at": now.Add(time.Hour)}},
+			})
+		},
+	})
+	defer srv.Close()
+
+	out, err := executeCommand(t, srv.URL, "trash")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{"agent", "oops", "service", "preview.example.com", "just now", "1h"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestBans(t *testing.T) {
+	var unbanned string
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"GET /admin/bans": func(w http.ResponseWriter, r *http.Request) {
+			now := time.Now()
+			json.NewEncoder(w).Encode([]map[string]any{
+				{"ip": "203.0.113.7", "reason": "admin auth", "strikes": 10, "since": now, "until": now.Add(time.Hour)},
+			})
+		},
+		"DELETE /admin/bans/203.0.113.7": func(w http.ResponseWriter, r *http.Request) {
+			unbanned = "203.0.113.7"
+			json.NewEncoder(w).Encode(map[string]string{"status": "unbanned", "ip": unbanned})
+		},
+	})
+	defer srv.Close()
+
+	out, err := executeCommand(t, srv.URL, "bans", "list")
+	if err != nil {
+		t.Fatalf("bans list: %v", err)
+	}
+	for _, want := range []string{"203.0.113.7", "admin auth", "10", "1h"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output, got:\n%s", want, out)
+		}
+	}
+
+	out, err = executeCommand(t, srv.URL, "bans", "remove", "203.0.113.7")
+	if err != nil {
+		t.Fatalf("bans remove: %v", err)
+	}
+	if unbanned != "203.0.113.7" || !strings.Contains(out, "Unbanned 203.0.113.7") {
+		t.Errorf("remove didn't lift the ban: %q", out)
+	}
+}
+
 // --- Agent Inspect Tests ---
 
 func TestAgentInspect_Success(t *testing.T) {
@@ -398,6 +692,112 @@ func TestAgentWake_NotFound(t *testing.T) {
 	}
 }
 
+func TestAgentWake_Wait(t *testing.T) {
+	old := waitPoll
+	waitPoll = time.Millisecond
+	defer func() { waitPoll = old }()
+
+	states := map[string][]string{
+		"kai":   {"sleeping", "starting", "ready"},
+		"flaky": {"starting", "crashloop"},
+		"slow":  {"starting"},
+		"dud":   {"sleeping"},
+		"flop":  {"sleeping", "starting", "sleeping"},
+	}
+	// dud's wake failed before it was ever seen starting; kai's last wake
+	// predates this one.
+	traces := map[string]string{
+		"dud": time.Now().Add(time.Minute).Format(time.RFC3339),
+		"kai": time.Now().Add(-time.Hour).Format(time.RFC3339),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.Split(strings.TrimPrefix(r.URL.Path, "/admin/agents/"), "/")[0]
+		if r.Method == http.MethodPost {
+			w.Write([]byte(`{"status":"waking"}`))
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/wake") {
+			at, ok := traces[name]
+			if !ok {
+				http.Error(w, `{"error":"no wake recorded yet"}`, http.StatusNotFound)
+				return
+			}
+			fmt.Fprintf(w, `{"triggered_at":%q,"outcome":"start_failed"}`, at)
+			return
+		}
+		seq := states[name]
+		state := seq[0]
+		if len(seq) > 1 {
+			states[name] = seq[1:]
+		}
+		fmt.Fprintf(w, `{"name":%q,"state":%q}`, name, state)
+	}))
+	defer srv.Close()
+
+	out, err := executeCommand(t, srv.URL, "agent", "wake", "kai", "--wait")
+	if err != nil || !strings.Contains(out, "kai is ready") {
+		t.Errorf("wake --wait kai: err = %v, output:\n%s", err, out)
+	}
+
+	out, err = executeCommand(t, srv.URL, "agent", "wake", "flaky", "--wait")
+	var code exitCode
+	if !errors.As(err, &code) || code != exitDegraded || !strings.Contains(out, "flaky is crashloop") {
+		t.Errorf("wake --wait flaky: err = %v, output:\n%s", err, out)
+	}
+
+	_, err = executeCommand(t, srv.URL, "agent", "wake", "slow", "--wait", "--timeout", "20ms")
+	if err == nil || !strings.Contains(err.Error(), "still starting") {
+		t.Errorf("wake --wait slow: err = %v", err)
+	}
+
+	// A failed wake fails --wait straight away instead of at the timeout.
+	out, err = executeCommand(t, srv.URL, "agent", "wake", "dud", "--wait")
+	if !errors.As(err, &code) || code != exitDegraded || !strings.Contains(out, "dud is sleeping (wake start_failed)") {
+		t.Errorf("wake --wait dud: err = %v, output:\n%s", err, out)
+	}
+	out, err = executeCommand(t, srv.URL, "agent", "wake", "flop", "--wait")
+	if !errors.As(err, &code) || code != exitDegraded || !strings.Contains(out, "flop is sleeping") {
+		t.Errorf("wake --wait flop: err = %v, output:\n%s", err, out)
+	}
+}
+
+func TestAgentWake_Selector(t *testing.T) {
+	var body map[string]any
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"POST /admin/wake": func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&body)
+			w.Write([]byte(`{"agents":[{"name":"a","status":"waking"},{"name":"b","status":"skipped","reason":"not on-demand"}]}`))
+		},
+		"POST /admin/sleep": func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&body)
+			w.Write([]byte(`{"agents":[]}`))
+		},
+	})
+	defer srv.Close()
+
+	out, err := executeCommand(t, srv.URL, "agent", "wake", "-l", "env=staging", "--keep-awake", "1h")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out, "Waking a") || !strings.Contains(out, "Skipped b: not on-demand") {
+		t.Errorf("output:\n%s", out)
+	}
+	if body["selector"] != "env=staging" || body["all"] != false || body["keep_awake"] != "1h" {
+		t.Errorf("body = %v", body)
+	}
+
+	out, err = executeCommand(t, srv.URL, "agent", "sleep", "--all")
+	if err != nil || !strings.Contains(out, "No agents match") || body["all"] != true {
+		t.Errorf("sleep --all: err = %v, body = %v, output:\n%s", err, body, out)
+	}
+
+	for _, args := range [][]string{{"wake"}, {"wake", "a", "--all"}, {"sleep", "--all", "-l", "env=staging"}} {
+		if _, err := executeCommand(t, srv.URL, append([]string{"agent"}, args...)...); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
+
 // --- Agent Sleep Tests ---
 
 func TestAgentSleep_Success(t *testing.T) {
@@ -432,383 +832,1733 @@ func TestAgentSleep_NotFound(t *testing.T) {
 	}
 }
 
-// --- Service List Tests ---
+// --- Agent Export Tests ---
 
-func TestServiceList_Table(t *testing.T) {
+func TestAgentExport_Compose(t *testing.T) {
+	var gotFormat string
 	srv := mockAdminServer(t, map[string]http.HandlerFunc{
-		"GET /admin/services": func(w http.ResponseWriter, r *http.Request) {
-			json.NewEncoder(w).Encode([]map[string]string{
-				{"hostname": "svc1.example.com", "target": "http://backend1:8080", "agent": "agent1"},
-				{"hostname": "svc2.example.com", "target": "http://backend2:8080", "agent": "agent2"},
-			})
+		"GET /admin/agents/myagent/export": func(w http.ResponseWriter, r *http.Request) {
+			gotFormat = r.URL.Query().Get("format")
+			w.Write([]byte("services:\n  openclaw_myagent:\n    image: openclaw:latest\n"))
 		},
 	})
 	defer srv.Close()
 
-	out, err := executeCommand(t, srv.URL, "service", "list")
+	out, err := executeCommand(t, srv.URL, "agent", "export", "myagent", "--format", "compose")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	for _, col := range []string{"HOSTNAME", "TARGET", "AGENT"} {
-		if !strings.Contains(out, col) {
-			t.Errorf("missing column %q in output:\n%s", col, out)
-		}
+	if gotFormat != "compose" {
+		t.Errorf("format query = %q, want compose", gotFormat)
 	}
-	if !strings.Contains(out, "svc1.example.com") {
-		t.Errorf("missing service in output:\n%s", out)
+	if !strings.Contains(out, "openclaw_myagent:") {
+		t.Errorf("expected compose service in output, got:\n%s", out)
 	}
 }
 
-func TestServiceList_Empty(t *testing.T) {
+func TestBackupAndRestore(t *testing.T) {
+	const archive = "version: 1\nagents:\n  kai:\n    hostname: kai.example.com\n"
+	var restored string
 	srv := mockAdminServer(t, map[string]http.HandlerFunc{
-		"GET /admin/services": func(w http.ResponseWriter, r *http.Request) {
-			w.Write([]byte(`[]`))
+		"GET /admin/backup": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(archive))
+		},
+		"POST /admin/restore": func(w http.ResponseWriter, r *http.Request) {
+			b, _ := io.ReadAll(r.Body)
+			restored = string(b)
+			w.Write([]byte(`{"agents":["kai"],"services":[],"holds":[],"events":0,"skipped":[{"kind":"service","name":"dash.example.com","reason":"already registered"}]}`))
 		},
 	})
 	defer srv.Close()
 
-	out, err := executeCommand(t, srv.URL, "service", "list")
+	path := filepath.Join(t.TempDir(), "backup.yaml")
+	if _, err := executeCommand(t, srv.URL, "backup", path); err != nil {
+		t.Fatalf("backup: %v", err)
+	}
+	info, err := os.Stat(path)
 	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+		t.Fatal(err)
 	}
-	if !strings.Contains(out, "HOSTNAME") {
-		t.Errorf("expected header:\n%s", out)
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("backup file mode = %v, want 0600", info.Mode().Perm())
 	}
-}
 
-// --- Service Add Tests ---
+	out, err := executeCommand(t, srv.URL, "restore", path)
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if restored != archive {
+		t.Errorf("restore sent %q, want the backup file", restored)
+	}
+	if !strings.Contains(out, "Restored 1 agents, 0 services") || !strings.Contains(out, "skipped service dash.example.com: already registered") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+}
 
-func TestServiceAdd_Success(t *testing.T) {
-	var receivedBody map[string]string
+func TestExport(t *testing.T) {
+	const exported = "listen: :8080\nagents:\n  kai:\n    hostname: kai.example.com\nservices:\n  dash.example.com:\n    target: http://localhost:3000\n"
 	srv := mockAdminServer(t, map[string]http.HandlerFunc{
-		"POST /api/services": func(w http.ResponseWriter, r *http.Request) {
-			json.NewDecoder(r.Body).Decode(&receivedBody)
-			w.Write([]byte(`{"status":"created"}`))
+		"GET /admin/export": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(exported))
 		},
 	})
 	defer srv.Close()
 
-	out, err := executeCommand(t, srv.URL, "service", "add",
-		"--hostname", "newsvc.example.com",
-		"--target", "http://backend:8080",
-		"--agent", "myagent",
-	)
+	out, err := executeCommand(t, srv.URL, "export")
 	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
-	}
-	if !strings.Contains(out, "created") {
-		t.Errorf("expected 'created', got:\n%s", out)
+		t.Fatalf("export: %v", err)
 	}
-	if receivedBody["hostname"] != "newsvc.example.com" {
-		t.Errorf("wrong hostname in body: %v", receivedBody)
+	if out != exported {
+		t.Errorf("stdout = %q, want the exported config", out)
 	}
-}
-
-func TestServiceAdd_MissingFlags(t *testing.T) {
-	srv := mockAdminServer(t, map[string]http.HandlerFunc{})
-	defer srv.Close()
 
-	_, err := executeCommand(t, srv.URL, "service", "add")
-	if err == nil {
-		t.Fatal("expected error for missing flags")
+	path := filepath.Join(t.TempDir(), "orchestrator.yaml")
+	if _, err := executeCommand(t, srv.URL, "export", path); err != nil {
+		t.Fatalf("export to file: %v", err)
 	}
-	if !strings.Contains(err.Error(), "--hostname and --target are required") {
-		t.Errorf("unexpected error: %v", err)
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != exported {
+		t.Errorf("file = %q, %v", data, err)
 	}
 }
 
-// --- Service Remove Tests ---
-
-func TestServiceRemove_Success(t *testing.T) {
+func TestExportK8s(t *testing.T) {
+	var query url.Values
 	srv := mockAdminServer(t, map[string]http.HandlerFunc{
-		"DELETE /api/services/svc.example.com": func(w http.ResponseWriter, r *http.Request) {
-			w.Write([]byte(`{"status":"removed"}`))
+		"GET /admin/export": func(w http.ResponseWriter, r *http.Request) {
+			query = r.URL.Query()
+			w.Write([]byte("apiVersion: apps/v1\nkind: Deployment\n"))
 		},
 	})
 	defer srv.Close()
 
-	out, err := executeCommand(t, srv.URL, "service", "remove", "svc.example.com")
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+	path := filepath.Join(t.TempDir(), "agents.yaml")
+	if _, err := executeCommand(t, srv.URL, "export", "k8s", "--namespace", "agents", "--ingress-class", "nginx", path); err != nil {
+		t.Fatalf("export k8s: %v", err)
 	}
-	if !strings.Contains(out, "removed") {
-		t.Errorf("expected 'removed', got:\n%s", out)
+	if query.Get("format") != "k8s" || query.Get("namespace") != "agents" || query.Get("ingress_class") != "nginx" {
+		t.Errorf("query = %v", query)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || !strings.Contains(string(data), "kind: Deployment") {
+		t.Errorf("file = %q, %v", data, err)
 	}
 }
 
-func TestServiceRemove_NotFound(t *testing.T) {
+func TestImportCompose(t *testing.T) {
+	dir := t.TempDir()
+	composeFile := filepath.Join(dir, "docker-compose.yml")
+	os.WriteFile(composeFile, []byte(`name: lab
+services:
+  dash:
+    image: grafana/grafana
+    ports: ["3000:3000"]
+    labels:
+      traefik.http.routers.dash.rule: Host(`+"`dash.example.com`"+`) || Host(`+"`grafana.example.com`"+`)
+    healthcheck:
+      test: ["CMD", "wget", "-qO-", "http://localhost:3000/api/health"]
+      interval: 30s
+      start_period: 1m
+      retries: 5
+  notes:
+    image: notes
+    expose: ["8080"]
+  db:
+    image: postgres
+    ports: ["5432:5432"]
+  kai:
+    image: kai
+    ports: ["8000:8000"]
+`), 0644)
+	cfgFile := filepath.Join(dir, "orchestrator.yaml")
+	os.WriteFile(cfgFile, []byte(`listen: ":8080"
+# Hand-written agents.
+agents:
+  kai:
+    hostname: kai.example.com
+    backend: "http://kai:18790"
+    policy: unmanaged
+`), 0644)
+
+	out, err := executeCommand(t, "", "import", "compose", composeFile, "--config", cfgFile, "--domain", "example.com")
+	if err != nil {
+		t.Fatalf("import compose: %v", err)
+	}
+	for _, want := range []string{
+		"Skipped db: no HTTP port",
+		`Skipped kai: agent "kai" is already in the config`,
+		"Added agent dash (dash.example.com → http://tasks.lab_dash:3000, on-demand)",
+		"Added agent notes (notes.example.com → http://tasks.lab_notes:8080, unmanaged)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output, got:\n%s", want, out)
+		}
+	}
+
+	data, _ := os.ReadFile(cfgFile)
+	if !strings.Contains(string(data), "# Hand-written agents.") {
+		t.Errorf("comment lost:\n%s", data)
+	}
+	cfg, err := config.Load(cfgFile)
+	if err != nil {
+		t.Fatalf("imported config doesn't load: %v", err)
+	}
+	dash := cfg.Agents["dash"]
+	if dash == nil || dash.Container.Name != "lab_dash" || dash.Health.URL != "http://tasks.lab_dash:3000/api/health" ||
+		time.Duration(dash.Health.CheckInterval) != 30*time.Second || time.Duration(dash.Health.StartupTimeout) != time.Minute || dash.Health.MaxFailures != 5 ||
+		len(dash.Hostnames) != 1 || dash.Hostnames[0] != "grafana.example.com" {
+		t.Errorf("dash = %+v", dash)
+	}
+	if cfg.Agents["kai"].Backend != "http://kai:18790" {
+		t.Error("existing agent changed")
+	}
+}
+
+func TestApply(t *testing.T) {
+	const desired = `
+agents:
+  kai:
+    hostname: kai.example.com
+    backend: http://localhost:18791
+    policy: unmanaged
+  new:
+    hostname: new.example.com
+    backend: http://localhost:18792
+    policy: unmanaged
+services:
+  dash.example.com:
+    target: http://localhost:3000
+    agent: kai
+  api.example.com:
+    target: http://localhost:5001
+    agent: kai
+`
+	path := filepath.Join(t.TempDir(), "warren.yaml")
+	os.WriteFile(path, []byte(desired), 0o644)
+
+	var mu sync.Mutex
+	var calls []string
+	record := func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		calls = append(calls, r.Method+" "+r.URL.Path+" "+string(b))
+		mu.Unlock()
+		w.Write([]byte(`{"status":"ok"}`))
+	}
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"GET /admin/agents": func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode([]map[string]any{
+				{"name": "kai", "type": "container", "hostname": "kai.example.com", "backend": "http://localhost:18790", "policy": "unmanaged", "idle_timeout": "30m"},
+				{"name": "old", "type": "container", "hostname": "old.example.com", "backend": "http://localhost:18793", "policy": "unmanaged"},
+				{"name": "cc-worker", "type": "process"},
+			})
+		},
+		"GET /api/services": func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode([]map[string]any{
+				{"hostname": "dash.example.com", "target": "http://localhost:3000", "agent": "kai"},
+				{"hostname": "api.example.com", "target": "http://localhost:5000", "agent": "kai", "wake": true},
+				{"hostname": "stale.example.com", "target": "http://localhost:4000"},
+			})
+		},
+		"POST /admin/agents":                     record,
+		"PUT /admin/agents/kai":                  record,
+		"DELETE /admin/agents/old":               record,
+		"DELETE /api/services/stale.example.com": record,
+		"PATCH /api/services/api.example.com":    record,
+	})
+	defer srv.Close()
+
+	out, err := executeCommand(t, srv.URL, "apply", "-f", path, "--dry-run")
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	for _, want := range []string{
+		"~ agent kai\n    backend: http://localhost:18790 → http://localhost:18791",
+		"+ agent new",
+		"- service stale.example.com",
+		"- agent old",
+		"~ service api.example.com\n    target: http://localhost:5000 → http://localhost:5001\n    wake: true → false",
+		"Plan: 1 to create, 2 to update, 2 to delete.",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("plan missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "dash.example.com") || strings.Contains(out, "cc-worker") {
+		t.Errorf("plan touches unchanged or process resources:\n%s", out)
+	}
+	if len(calls) != 0 {
+		t.Fatalf("dry run changed %v", calls)
+	}
+
+	if _, err := executeCommand(t, srv.URL, "apply", "-f", path, "--yes"); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	want := []string{
+		`PUT /admin/agents/kai {"hostname":"kai.example.com","backend":"http://localhost:18791","policy":"unmanaged","idle_timeout":"30m"}`,
+		`POST /admin/agents {"backend":"http://localhost:18792","hostname":"new.example.com","name":"new","policy":"unmanaged"}`,
+		`PATCH /api/services/api.example.com {"fallback":{},"replicas":[],"target":"http://localhost:5001","wake":false}`,
+		"DELETE /api/services/stale.example.com ",
+		"DELETE /admin/agents/old ",
+	}
+	if strings.Join(calls, "\n") != strings.Join(want, "\n") {
+		t.Errorf("calls:\n%s\nwant:\n%s", strings.Join(calls, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestApply_NoChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "warren.yaml")
+	os.WriteFile(path, []byte("agents: {}\n"), 0o644)
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"GET /admin/agents": func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(`[]`)) },
+		"GET /api/services": func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(`[]`)) },
+	})
+	defer srv.Close()
+
+	out, err := executeCommand(t, srv.URL, "apply", "-f", path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out, "No changes") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+
+	os.WriteFile(path, []byte("agents:\n  kai:\n    hostnme: kai.example.com\n"), 0o644)
+	if _, err := executeCommand(t, srv.URL, "apply", "-f", path); err == nil || !strings.Contains(err.Error(), "hostnme") {
+		t.Errorf("expected an error naming the unknown field, got %v", err)
+	}
+}
+
+// --- Service List Tests ---
+
+func TestServiceList_Table(t *testing.T) {
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"GET /admin/services": func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode([]map[string]string{
+				{"hostname": "svc1.example.com", "target": "http://backend1:8080", "agent": "agent1"},
+				{"hostname": "svc2.example.com", "target": "http://backend2:8080", "agent": "agent2"},
+			})
+		},
+	})
+	defer srv.Close()
+
+	out, err := executeCommand(t, srv.URL, "service", "list")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, col := range []string{"HOSTNAME", "TARGET", "AGENT"} {
+		if !strings.Contains(out, col) {
+			t.Errorf("missing column %q in output:\n%s", col, out)
+		}
+	}
+	if !strings.Contains(out, "svc1.example.com") {
+		t.Errorf("missing service in output:\n%s", out)
+	}
+}
+
+func TestServiceList_Empty(t *testing.T) {
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"GET /admin/services": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`[]`))
+		},
+	})
+	defer srv.Close()
+
+	out, err := executeCommand(t, srv.URL, "service", "list")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out, "HOSTNAME") {
+		t.Errorf("expected header:\n%s", out)
+	}
+}
+
+// --- Service Add Tests ---
+
+func TestServiceAdd_Success(t *testing.T) {
+	var receivedBody map[string]string
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"POST /api/services": func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&receivedBody)
+			w.Write([]byte(`{"status":"created"}`))
+		},
+	})
+	defer srv.Close()
+
+	out, err := executeCommand(t, srv.URL, "service", "add",
+		"--hostname", "newsvc.example.com",
+		"--target", "http://backend:8080",
+		"--agent", "myagent",
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out, "created") {
+		t.Errorf("expected 'created', got:\n%s", out)
+	}
+	if receivedBody["hostname"] != "newsvc.example.com" {
+		t.Errorf("wrong hostname in body: %v", receivedBody)
+	}
+}
+
+func TestServiceAdd_MissingFlags(t *testing.T) {
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{})
+	defer srv.Close()
+
+	_, err := executeCommand(t, srv.URL, "service", "add")
+	if err == nil {
+		t.Fatal("expected error for missing flags")
+	}
+	if !strings.Contains(err.Error(), "--hostname and --target are required") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestServiceAdd_Weights(t *testing.T) {
+	var receivedBody struct {
+		Replicas []string `json:"replicas"`
+		Weights  []int    `json:"weights"`
+	}
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"POST /api/services": func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&receivedBody)
+			w.Write([]byte(`{"status":"ok"}`))
+		},
+	})
+	defer srv.Close()
+
+	_, err := executeCommand(t, srv.URL, "service", "add",
+		"--hostname", "canary.example.com",
+		"--target", "http://v1:8080",
+		"--replica", "http://v2:8080",
+		"--weight", "90,10",
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(receivedBody.Weights) != 2 || receivedBody.Weights[0] != 90 || receivedBody.Weights[1] != 10 {
+		t.Errorf("weights in body = %v, want [90 10]", receivedBody.Weights)
+	}
+
+	_, err = executeCommand(t, srv.URL, "service", "add",
+		"--hostname", "canary.example.com",
+		"--target", "http://v1:8080",
+		"--weight", "90,10",
+	)
+	if err == nil || !strings.Contains(err.Error(), "one value per target") {
+		t.Errorf("expected weight count error, got %v", err)
+	}
+}
+
+func TestServiceAdd_Wake(t *testing.T) {
+	var receivedBody map[string]any
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"POST /api/services": func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&receivedBody)
+			w.Write([]byte(`{"status":"ok"}`))
+		},
+	})
+	defer srv.Close()
+
+	_, err := executeCommand(t, srv.URL, "service", "add",
+		"--hostname", "preview.example.com",
+		"--target", "http://dutybound:3000",
+		"--agent", "dutybound",
+		"--wake",
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if receivedBody["wake"] != true {
+		t.Errorf("wake in body = %v, want true", receivedBody["wake"])
+	}
+
+	_, err = executeCommand(t, srv.URL, "service", "add",
+		"--hostname", "preview.example.com",
+		"--target", "http://dutybound:3000",
+		"--wake",
+	)
+	if err == nil || !strings.Contains(err.Error(), "--wake needs --agent") {
+		t.Errorf("expected --agent error, got %v", err)
+	}
+}
+
+func TestServiceAdd_Fallback(t *testing.T) {
+	var receivedBody struct {
+		Fallback map[string]any `json:"fallback"`
+	}
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"POST /api/services": func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&receivedBody)
+			w.Write([]byte(`{"status":"ok"}`))
+		},
+	})
+	defer srv.Close()
+
+	page := filepath.Join(t.TempDir(), "down.html")
+	os.WriteFile(page, []byte("<h1>back soon</h1>"), 0o644)
+	_, err := executeCommand(t, srv.URL, "service", "add",
+		"--hostname", "preview.example.com",
+		"--target", "http://dutybound:3000",
+		"--fallback-retries", "3",
+		"--fallback-page", page,
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if receivedBody.Fallback["retries"] != float64(3) || receivedBody.Fallback["page"] != "<h1>back soon</h1>" {
+		t.Errorf("fallback in body = %v", receivedBody.Fallback)
+	}
+}
+
+func TestServiceAdd_Sticky(t *testing.T) {
+	var receivedBody map[string]any
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"POST /api/services": func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&receivedBody)
+			w.Write([]byte(`{"status":"ok"}`))
+		},
+	})
+	defer srv.Close()
+
+	_, err := executeCommand(t, srv.URL, "service", "add",
+		"--hostname", "ui.example.com",
+		"--target", "http://v1:8080",
+		"--replica", "http://v2:8080",
+		"--sticky-ttl", "8h",
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sticky, _ := receivedBody["sticky"].(map[string]any)
+	if sticky == nil || sticky["ttl"] != "8h" {
+		t.Errorf("sticky in body = %v, want ttl 8h", receivedBody["sticky"])
+	}
+}
+
+func TestServiceAdd_Timeouts(t *testing.T) {
+	var receivedBody map[string]any
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"POST /api/services": func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&receivedBody)
+			w.Write([]byte(`{"status":"ok"}`))
+		},
+	})
+	defer srv.Close()
+
+	_, err := executeCommand(t, srv.URL, "service", "add",
+		"--hostname", "llm.example.com",
+		"--target", "http://llm:8080",
+		"--response-header-timeout", "10m",
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	timeouts, _ := receivedBody["timeouts"].(map[string]any)
+	if timeouts == nil || timeouts["response_header"] != "10m" {
+		t.Errorf("timeouts in body = %v, want response_header 10m", receivedBody["timeouts"])
+	}
+}
+
+// --- Service Remove Tests ---
+
+func TestServiceUpdate(t *testing.T) {
+	var receivedBody map[string]any
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"PATCH /api/services/svc.example.com": func(w http.ResponseWriter, r *http.Request) {
+			receivedBody = nil
+			json.NewDecoder(r.Body).Decode(&receivedBody)
+			w.Write([]byte(`{"status":"ok"}`))
+		},
+	})
+	defer srv.Close()
+
+	if _, err := executeCommand(t, srv.URL, "service", "update", "svc.example.com", "--target", "http://v2:8080"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if receivedBody["target"] != "http://v2:8080" {
+		t.Errorf("wrong target in body: %v", receivedBody)
+	}
+	if _, ok := receivedBody["replicas"]; ok {
+		t.Errorf("replicas sent without --replica: %v", receivedBody)
+	}
+
+	if _, err := executeCommand(t, srv.URL, "service", "update", "svc.example.com", "--target", "http://v2:8080", "--no-replicas"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r, ok := receivedBody["replicas"].([]any); !ok || len(r) != 0 {
+		t.Errorf("--no-replicas should send an empty list: %v", receivedBody)
+	}
+
+	if _, err := executeCommand(t, srv.URL, "service", "update", "svc.example.com"); err == nil || !strings.Contains(err.Error(), "--target is required") {
+		t.Errorf("missing target error = %v", err)
+	}
+}
+
+func TestServiceRemove_Success(t *testing.T) {
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"DELETE /api/services/svc.example.com": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"status":"removed"}`))
+		},
+	})
+	defer srv.Close()
+
+	out, err := executeCommand(t, srv.URL, "service", "remove", "svc.example.com", "--yes")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out, "removed") {
+		t.Errorf("expected 'removed', got:\n%s", out)
+	}
+}
+
+func TestServiceRemove_NotFound(t *testing.T) {
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"DELETE /api/services/ghost.example.com": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(404)
+			w.Write([]byte(`{"error":"not found"}`))
+		},
+	})
+	defer srv.Close()
+
+	_, err := executeCommand(t, srv.URL, "service", "remove", "ghost.example.com", "-y")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestServiceRemove_ForceSkipsPrompt(t *testing.T) {
+	var query string
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"DELETE /api/services/svc.example.com": func(w http.ResponseWriter, r *http.Request) {
+			query = r.URL.RawQuery
+			w.Write([]byte(`{"status":"ok"}`))
+		},
+	})
+	defer srv.Close()
+
+	if _, err := executeCommand(t, srv.URL, "service", "remove", "svc.example.com", "--force"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if query != "force=true" {
+		t.Errorf("query = %q, want force=true", query)
+	}
+}
+
+func TestServiceRemove_PromptShowsConnections(t *testing.T) {
+	deleted := false
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"GET /api/services/svc.example.com": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"service":{"hostname":"svc.example.com"},"connections":3}`))
+		},
+		"DELETE /api/services/svc.example.com": func(w http.ResponseWriter, r *http.Request) {
+			deleted = true
+		},
+	})
+	defer srv.Close()
+
+	oldStdin := os.Stdin
+	r, w, _ := os.Pipe()
+	w.WriteString("n\n")
+	w.Close()
+	os.Stdin = r
+	defer func() { os.Stdin = oldStdin }()
+
+	out, err := executeCommand(t, srv.URL, "service", "remove", "svc.example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out, "3 active connection(s)") {
+		t.Errorf("expected connection count in prompt, got:\n%s", out)
+	}
+	if deleted {
+		t.Error("service deleted after declining")
+	}
+}
+
+// --- Status Tests ---
+
+func TestStatus_Table(t *testing.T) {
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"GET /admin/health": func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(map[string]any{
+				"uptime_seconds": 90061.0, // 1d 1h 1m
+				"agent_count":    3,
+				"ready_count":    2,
+				"sleeping_count": 1,
+				"ws_connections": 10,
+				"service_count":  5,
+			})
+		},
+	})
+	defer srv.Close()
+
+	out, err := executeCommand(t, srv.URL, "status")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out, "Warren Orchestrator") {
+		t.Errorf("missing header in output:\n%s", out)
+	}
+	if !strings.Contains(out, "Agents") || !strings.Contains(out, "3") {
+		t.Errorf("missing agent count:\n%s", out)
+	}
+	if !strings.Contains(out, "10") {
+		t.Errorf("missing ws connections:\n%s", out)
+	}
+	if !strings.Contains(out, "5 dynamic routes") {
+		t.Errorf("missing service count:\n%s", out)
+	}
+}
+
+func TestStatus_JSON(t *testing.T) {
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"GET /admin/health": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"uptime_seconds":100,"agent_count":1}`))
+		},
+	})
+	defer srv.Close()
+
+	out, err := executeCommand(t, srv.URL, "status", "--format", "json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out, "uptime_seconds") {
+		t.Errorf("expected JSON, got:\n%s", out)
+	}
+}
+
+func TestStatus_Verbose(t *testing.T) {
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"GET /admin/health": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"status":"degraded","uptime_seconds":100,"checks":[
+				{"name":"events","status":"ok","latency_ms":0.1,"detail":"0 dropped in total","last_error":"3 events dropped","last_error_at":"2026-01-01T00:00:00Z"},
+				{"name":"storage","status":"fail","latency_ms":2000,"error":"connection refused"}]}`))
+		},
+	})
+	defer srv.Close()
+
+	out, err := executeCommand(t, srv.URL, "status", "--verbose")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{"Status:      degraded", "✓ events", "last error", "3 events dropped", "✗ storage", "2000.0ms", "connection refused"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in output:\n%s", want, out)
+		}
+	}
+
+	out, _ = executeCommand(t, srv.URL, "status")
+	if strings.Contains(out, "storage") {
+		t.Errorf("checks listed without --verbose:\n%s", out)
+	}
+}
+
+// --- Config Validate Tests ---
+
+func TestConfigValidate_Valid(t *testing.T) {
+	dir := t.TempDir()
+	cfgFile := filepath.Join(dir, "test.yaml")
+	content := `listen: ":8080"
+agents:
+  test:
+    hostname: test.example.com
+    backend: "http://backend:18790"
+    policy: unmanaged
+`
+	os.WriteFile(cfgFile, []byte(content), 0644)
+
+	out, err := executeCommand(t, "", "config", "validate", cfgFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out, "OK") {
+		t.Errorf("expected OK, got:\n%s", out)
+	}
+
+	// The older "warren config <file>" form still validates.
+	out, err = executeCommand(t, "", "config", cfgFile)
+	if err != nil || !strings.Contains(out, "OK") {
+		t.Errorf("config <file>: %q, %v", out, err)
+	}
+}
+
+func TestConfigValidate_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	cfgFile := filepath.Join(dir, "bad.yaml")
+	// No agents defined - should fail validation.
+	os.WriteFile(cfgFile, []byte(`listen: ":8080"`), 0644)
+
+	_, err := executeCommand(t, "", "config", "validate", cfgFile)
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	if !strings.Contains(err.Error(), "validation failed") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestConfigValidate_BadYAML(t *testing.T) {
+	dir := t.TempDir()
+	cfgFile := filepath.Join(dir, "broken.yaml")
+	os.WriteFile(cfgFile, []byte(`{{{not yaml`), 0644)
+
+	_, err := executeCommand(t, "", "config", "validate", cfgFile)
+	if err == nil {
+		t.Fatal("expected error for bad YAML")
+	}
+}
+
+func TestConfigDiff(t *testing.T) {
+	const live = `listen: ":8080"
+webhooks:
+  - url: https://hooks.example.com/warren
+    headers:
+      Authorization: Bearer old-secret
+    events: [agent.degraded]
+agents:
+  kai:
+    hostname: kai.example.com
+    backend: "http://kai:18790"
+    policy: unmanaged
+    idle:
+      timeout: 30m
+  added:
+    hostname: added.example.com
+    backend: "http://added:18790"
+    policy: unmanaged
+`
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"GET /admin/export": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(live))
+		},
+	})
+	defer srv.Close()
+
+	cfgFile := filepath.Join(t.TempDir(), "orchestrator.yaml")
+	os.WriteFile(cfgFile, []byte(`listen: ":8080"
+webhooks:
+  - url: https://hooks.example.com/warren
+    headers:
+      Authorization: Bearer new-secret
+    events: [agent.degraded, security]
+agents:
+  kai:
+    hostname: kai.example.com
+    backend: "http://kai:18790"
+    policy: unmanaged
+    idle:
+      timeout: 1h
+  new:
+    hostname: new.example.com
+    backend: "http://new:18790"
+    policy: unmanaged
+`), 0644)
+
+	out, err := executeCommand(t, srv.URL, "config", "diff", cfgFile)
+	if err != nil {
+		t.Fatalf("config diff: %v", err)
+	}
+	for _, want := range []string{
+		"- agent added",
+		"~ agent kai",
+		"idle.timeout: 30m → 1h",
+		"+ agent new",
+		"~ webhook https://hooks.example.com/warren",
+		"events: agent.degraded → agent.degraded, security",
+		"headers.Authorization: (changed)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "secret") {
+		t.Errorf("webhook header value printed:\n%s", out)
+	}
+
+	if _, err := executeCommand(t, srv.URL, "config", "diff", "--exit-code", cfgFile); err == nil {
+		t.Error("--exit-code with differences returned no error")
+	}
+}
+
+// --- Events Tests ---
+
+// eventStream serves each SSE response in turn, then 404 so the
+// reconnecting events command gives up. It records each request's
+// Last-Event-ID.
+func eventStream(t *testing.T, responses ...string) (*httptest.Server, *[]string) {
+	t.Helper()
+	old := eventsRetry
+	eventsRetry = time.Millisecond
+	t.Cleanup(func() { eventsRetry = old })
+
+	var mu sync.Mutex
+	var lastIDs []string
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"GET /admin/events": func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			n := len(lastIDs)
+			lastIDs = append(lastIDs, r.Header.Get("Last-Event-ID"))
+			mu.Unlock()
+			if n >= len(responses) {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, responses[n])
+		},
+	})
+	t.Cleanup(srv.Close)
+	return srv, &lastIDs
+}
+
+func TestEvents_SSE(t *testing.T) {
+	srv, _ := eventStream(t, "data: event-0\n\ndata: event-1\n\ndata: event-2\n\n")
+
+	out, err := executeCommand(t, srv.URL, "events")
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("expected the 404 after reconnecting, got %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		expected := fmt.Sprintf("event-%d", i)
+		if !strings.Contains(out, expected) {
+			t.Errorf("missing %q in output:\n%s", expected, out)
+		}
+	}
+}
+
+func TestEvents_Human(t *testing.T) {
+	srv, _ := eventStream(t,
+		`data: {"type":"agent.wake","agent":"agent1","timestamp":"2026-01-02T12:03:01Z","fields":{"trigger":"predictive"}}`+"\n\n"+
+			`data: {"type":"agent.ready","agent":"agent1","timestamp":"2026-01-02T12:03:09Z"}`+"\n\n")
+
+	out, _ := executeCommand(t, srv.URL, "events", "--utc")
+	for _, want := range []string{"12:03:01 agent1 waking (trigger=predictive)", "12:03:09 agent1 ready"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in output:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "\033[") {
+		t.Errorf("expected no colour when stdout isn't a terminal:\n%s", out)
+	}
+
+	srv, _ = eventStream(t, `data: {"type":"agent.ready","agent":"agent1"}`+"\n\n")
+	out, _ = executeCommand(t, srv.URL, "events", "--raw")
+	if !strings.Contains(out, `{"type":"agent.ready","agent":"agent1"}`) {
+		t.Errorf("expected raw JSON with --raw:\n%s", out)
+	}
+}
+
+func TestEvents_ResumesAfterDrop(t *testing.T) {
+	srv, lastIDs := eventStream(t,
+		"id: 7\ndata: {\"type\":\"agent.wake\",\"agent\":\"a\"}\n\n",
+		"id: 8\ndata: {\"type\":\"agent.ready\",\"agent\":\"a\"}\n\n",
+	)
+
+	out, _ := executeCommand(t, srv.URL, "events")
+	if !strings.Contains(out, "a waking") || !strings.Contains(out, "a ready") {
+		t.Errorf("expected events from both connections:\n%s", out)
+	}
+	if !strings.Contains(out, "reconnecting") {
+		t.Errorf("expected a reconnect notice:\n%s", out)
+	}
+	if got := *lastIDs; len(got) != 3 || got[0] != "" || got[1] != "7" || got[2] != "8" {
+		t.Errorf("Last-Event-ID per request = %q, want none, 7, 8", got)
+	}
+}
+
+func TestEvents_Security(t *testing.T) {
+	old := eventsRetry
+	eventsRetry = time.Millisecond
+	t.Cleanup(func() { eventsRetry = old })
+
+	var query string
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"GET /admin/events": func(w http.ResponseWriter, r *http.Request) {
+			if query != "" {
+				http.NotFound(w, r)
+				return
+			}
+			query = r.URL.RawQuery
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, `data: {"type":"security.auth_failed","timestamp":"2026-01-02T12:03:01Z","fields":{"remote":"203.0.113.7"}}`+"\n\n")
+		},
+	})
+	defer srv.Close()
+
+	out, _ := executeCommand(t, srv.URL, "events", "--security", "--utc")
+	if query != "security=true" {
+		t.Errorf("query = %q, want security=true", query)
+	}
+	if !strings.Contains(out, "12:03:01 auth failed (remote=203.0.113.7)") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+}
+
+// --- Init Tests ---
+
+func TestInit(t *testing.T) {
+	dir := t.TempDir()
+	oldWd, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(oldWd)
+
+	out, err := executeCommand(t, "", "init")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out, "Created orchestrator.yaml") {
+		t.Errorf("expected creation message, got:\n%s", out)
+	}
+
+	orchData, err := os.ReadFile(filepath.Join(dir, "orchestrator.yaml"))
+	if err != nil {
+		t.Fatalf("orchestrator.yaml not created: %v", err)
+	}
+	if !strings.Contains(string(orchData), "admin_listen") {
+		t.Error("orchestrator.yaml missing expected content")
+	}
+
+	stackData, err := os.ReadFile(filepath.Join(dir, "stack.yaml"))
+	if err != nil {
+		t.Fatalf("stack.yaml not created: %v", err)
+	}
+	if !strings.Contains(string(stackData), "warren") {
+		t.Error("stack.yaml missing expected content")
+	}
+}
+
+// --- Scaffold Tests ---
+
+func TestScaffold(t *testing.T) {
+	dir := t.TempDir()
+	oldWd, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(oldWd)
+
+	out, err := executeCommand(t, "", "scaffold", "mybot")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out, "Scaffolded agent in ./mybot/") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+
+	// Check files exist.
+	for _, f := range []string{"Dockerfile", "openclaw.json", "supervisord.conf"} {
+		path := filepath.Join(dir, "mybot", f)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("%s not created: %v", f, err)
+		}
+		if f == "openclaw.json" && !strings.Contains(string(data), "mybot") {
+			t.Errorf("openclaw.json missing agent name 'mybot'")
+		}
+	}
+}
+
+// --- Edge Cases ---
+
+func TestAdminFlagOverride(t *testing.T) {
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"GET /admin/health": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"uptime_seconds":1}`))
+		},
+	})
+	defer srv.Close()
+
+	// Use --admin flag to point to our server.
+	out, err := executeCommand(t, "", "status", "--admin", srv.URL, "--format", "json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out, "uptime_seconds") {
+		t.Errorf("expected JSON output, got:\n%s", out)
+	}
+}
+
+func TestConnectionRefused(t *testing.T) {
+	// Point to a port nothing listens on.
+	_, err := executeCommand(t, "http://127.0.0.1:1", "agent", "list")
+	if err == nil {
+		t.Fatal("expected connection error")
+	}
+}
+
+func TestNonJSONResponse(t *testing.T) {
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"GET /admin/agents": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`this is not json`))
+		},
+	})
+	defer srv.Close()
+
+	// Should not crash - table mode will just show empty since unmarshal fails.
+	_, err := executeCommand(t, srv.URL, "agent", "list")
+	if err != nil {
+		t.Fatalf("should not error on non-JSON (just empty table): %v", err)
+	}
+}
+
+func TestEnvVarOverride(t *testing.T) {
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"GET /admin/health": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"uptime_seconds":42}`))
+		},
+	})
+	defer srv.Close()
+
+	os.Setenv("WARREN_ADMIN", srv.URL)
+	defer os.Unsetenv("WARREN_ADMIN")
+
+	// Set adminURL to empty to let env var take effect.
+	adminURL = ""
+	out, err := executeCommand(t, "", "status", "--format", "json")
+	// The executeCommand sets adminURL to "", so getAdminURL should fall through to env.
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out, "42") {
+		t.Errorf("expected env var to work, got:\n%s", out)
+	}
+}
+
+// --- OpenClaw Tests ---
+
+func TestOpenClawSessions_Table(t *testing.T) {
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"GET /admin/agents/myagent/sessions": func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(map[string]any{
+				"agent":     "myagent",
+				"total":     2,
+				"active":    1,
+				"polled_at": time.Now().Add(-5 * time.Second),
+				"sessions": []map[string]any{
+					{"key": "agent:main:main", "agentId": "main", "updatedAt": time.Now().UnixMilli()},
+					{"key": "agent:main:old", "agentId": "main"},
+				},
+			})
+		},
+	})
+	defer srv.Close()
+
+	out, err := executeCommand(t, srv.URL, "openclaw", "sessions", "myagent")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out, "2 total, 1 active") {
+		t.Errorf("expected summary line, got:\n%s", out)
+	}
+	if !strings.Contains(out, "agent:main:main") || !strings.Contains(out, "KEY") {
+		t.Errorf("expected session table, got:\n%s", out)
+	}
+}
+
+func TestOpenClawSessions_NotPolled(t *testing.T) {
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"GET /admin/agents/myagent/sessions": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"agent":"myagent","total":0,"active":0,"sessions":[],"polled_at":"0001-01-01T00:00:00Z"}`))
+		},
+	})
+	defer srv.Close()
+
+	out, err := executeCommand(t, srv.URL, "openclaw", "sessions", "myagent")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out, "not polled yet") {
+		t.Errorf("expected not-polled message, got:\n%s", out)
+	}
+}
+
+func TestAgentInspect_Jobs(t *testing.T) {
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"GET /admin/agents/myagent": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"name":"myagent","state":"ready","jobs":[{"id":"batch-1","description":"reindex","expires_at":"2026-02-11T20:00:00Z"}]}`))
+		},
+	})
+	defer srv.Close()
+
+	out, err := executeCommand(t, srv.URL, "agent", "inspect", "myagent")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out, "jobs:") || !strings.Contains(out, "batch-1") || !strings.Contains(out, "reindex") {
+		t.Errorf("expected jobs in output:\n%s", out)
+	}
+}
+
+func TestAgentInspect_LastWake(t *testing.T) {
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"GET /admin/agents/myagent/wake": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"triggered_at":"2026-02-11T19:00:00Z","queued_ms":2,"start_call_ms":350,"container_start_ms":4000,"first_healthy_ms":8000,"route_ready_ms":1,"total_ms":12353,"outcome":"ready"}`))
+		},
+	})
+	defer srv.Close()
+
+	out, err := executeCommand(t, srv.URL, "agent", "inspect", "myagent", "--last-wake")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{"container start", "4s", "first healthy", "8s", "12.353s", "ready"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output:\n%s", want, out)
+		}
+	}
+}
+
+func TestAgentInspect_Container(t *testing.T) {
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"GET /admin/agents/myagent": func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("container") != "true" {
+				t.Errorf("expected container=true query, got %q", r.URL.RawQuery)
+			}
+			w.Write([]byte(`{"name":"myagent","state":"ready","container":{"service":"myagent-svc","image":"agent:1.2","image_digest":"sha256:abc","state":"running","started_at":"2026-02-11T19:00:00Z","restart_count":3,"mounts":[{"type":"bind","source":"/srv/data","destination":"/data","read_only":true}]}}`))
+		},
+	})
+	defer srv.Close()
+
+	out, err := executeCommand(t, srv.URL, "agent", "inspect", "myagent", "--container", "--utc")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{"container:", "sha256:abc", "restart_count:", "3", "2026-02-11 19:00:00 UTC (", "/srv/data -> /data (ro)"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output:\n%s", want, out)
+		}
+	}
+}
+
+func TestAgentWake_KeepAwake(t *testing.T) {
+	var body map[string]string
 	srv := mockAdminServer(t, map[string]http.HandlerFunc{
-		"DELETE /api/services/ghost.example.com": func(w http.ResponseWriter, r *http.Request) {
-			w.WriteHeader(404)
-			w.Write([]byte(`{"error":"not found"}`))
+		"POST /admin/agents/myagent/wake": func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&body)
+			w.Write([]byte(`{"status":"waking","held_until":"2026-02-11T20:00:00Z"}`))
 		},
 	})
 	defer srv.Close()
 
-	_, err := executeCommand(t, srv.URL, "service", "remove", "ghost.example.com")
-	if err == nil {
-		t.Fatal("expected error")
+	if _, err := executeCommand(t, srv.URL, "agent", "wake", "myagent", "--keep-awake", "1h"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if body["keep_awake"] != "1h" {
+		t.Errorf("keep_awake = %q, want 1h", body["keep_awake"])
 	}
 }
 
-// --- Status Tests ---
-
-func TestStatus_Table(t *testing.T) {
+func TestAgentList_Held(t *testing.T) {
+	held := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
 	srv := mockAdminServer(t, map[string]http.HandlerFunc{
-		"GET /admin/health": func(w http.ResponseWriter, r *http.Request) {
-			json.NewEncoder(w).Encode(map[string]any{
-				"uptime_seconds": 90061.0, // 1d 1h 1m
-				"agent_count":    3,
-				"ready_count":    2,
-				"sleeping_count": 1,
-				"ws_connections": 10,
-				"service_count":  5,
-			})
+		"GET /admin/agents": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`[{"name":"agent1","policy":"on-demand","state":"ready","held_until":"` + held + `"}]`))
 		},
 	})
 	defer srv.Close()
 
-	out, err := executeCommand(t, srv.URL, "status")
+	out, err := executeCommand(t, srv.URL, "agent", "list")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if !strings.Contains(out, "Warren Orchestrator") {
-		t.Errorf("missing header in output:\n%s", out)
-	}
-	if !strings.Contains(out, "Agents") || !strings.Contains(out, "3") {
-		t.Errorf("missing agent count:\n%s", out)
-	}
-	if !strings.Contains(out, "10") {
-		t.Errorf("missing ws connections:\n%s", out)
-	}
-	if !strings.Contains(out, "5 dynamic routes") {
-		t.Errorf("missing service count:\n%s", out)
+	if !strings.Contains(out, "ready (held)") {
+		t.Errorf("expected held state in output:\n%s", out)
 	}
 }
 
-func TestStatus_JSON(t *testing.T) {
+func TestStatus_Uptime(t *testing.T) {
 	srv := mockAdminServer(t, map[string]http.HandlerFunc{
 		"GET /admin/health": func(w http.ResponseWriter, r *http.Request) {
-			w.Write([]byte(`{"uptime_seconds":100,"agent_count":1}`))
+			json.NewEncoder(w).Encode(map[string]any{"uptime_seconds": 5400.0})
 		},
 	})
 	defer srv.Close()
 
-	out, err := executeCommand(t, srv.URL, "status", "--format", "json")
+	out, err := executeCommand(t, srv.URL, "status")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if !strings.Contains(out, "uptime_seconds") {
-		t.Errorf("expected JSON, got:\n%s", out)
+	if !strings.Contains(out, "Uptime:      1h30m") {
+		t.Errorf("expected compact uptime in output:\n%s", out)
 	}
 }
 
-// --- Config Validate Tests ---
-
-func TestConfigValidate_Valid(t *testing.T) {
-	dir := t.TempDir()
-	cfgFile := filepath.Join(dir, "test.yaml")
-	content := `listen: ":8080"
-agents:
-  test:
-    hostname: test.example.com
-    backend: "http://backend:18790"
-    policy: unmanaged
-`
-	os.WriteFile(cfgFile, []byte(content), 0644)
+func TestAgentList_Quiet(t *testing.T) {
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"GET /admin/agents": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`[
+				{"name":"alpha","state":"ready"},
+				{"name":"beta","state":"degraded"},
+				{"name":"cc-1","state":"degraded","session_id":"sess-42"}
+			]`))
+		},
+	})
+	defer srv.Close()
 
-	// Note: cobra Use "config validate <file>" means command name is "config",
-	// so args are ["validate", cfgFile] but ExactArgs(1) only wants 1.
-	// This is a CLI bug — the Use string should just be "config <file>" or
-	// it should be a subcommand. We call it as "config <file>" to match actual behavior.
-	out, err := executeCommand(t, "", "config", cfgFile)
+	out, err := executeCommand(t, srv.URL, "agent", "list", "-q")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if !strings.Contains(out, "OK") {
-		t.Errorf("expected OK, got:\n%s", out)
+	if out != "alpha\nbeta\ncc-1\n" {
+		t.Errorf("-q output = %q", out)
 	}
-}
-
-func TestConfigValidate_Invalid(t *testing.T) {
-	dir := t.TempDir()
-	cfgFile := filepath.Join(dir, "bad.yaml")
-	// No agents defined - should fail validation.
-	os.WriteFile(cfgFile, []byte(`listen: ":8080"`), 0644)
 
-	_, err := executeCommand(t, "", "config", cfgFile)
-	if err == nil {
-		t.Fatal("expected validation error")
+	out, err = executeCommand(t, srv.URL, "agent", "list", "--state", "degraded", "-o", "id")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
 	}
-	if !strings.Contains(err.Error(), "validation failed") {
-		t.Errorf("unexpected error: %v", err)
+	if out != "beta\nsess-42\n" {
+		t.Errorf("--state degraded -o id output = %q", out)
 	}
-}
 
-func TestConfigValidate_BadYAML(t *testing.T) {
-	dir := t.TempDir()
-	cfgFile := filepath.Join(dir, "broken.yaml")
-	os.WriteFile(cfgFile, []byte(`{{{not yaml`), 0644)
+	out, err = executeCommand(t, srv.URL, "agent", "list", "--state", "ready", "--format", "json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out, "alpha") || strings.Contains(out, "beta") {
+		t.Errorf("--state ready json output = %q", out)
+	}
 
-	_, err := executeCommand(t, "", "config", cfgFile)
-	if err == nil {
-		t.Fatal("expected error for bad YAML")
+	if _, err := executeCommand(t, srv.URL, "agent", "list", "-o", "hostname"); err == nil || !strings.Contains(err.Error(), "use name or id") {
+		t.Errorf("expected invalid --output error, got %v", err)
 	}
 }
 
-// --- Events Tests ---
-
-func TestEvents_SSE(t *testing.T) {
+func TestServiceList_Quiet(t *testing.T) {
 	srv := mockAdminServer(t, map[string]http.HandlerFunc{
-		"GET /admin/events": func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Content-Type", "text/event-stream")
-			flusher, _ := w.(http.Flusher)
-			for i := 0; i < 3; i++ {
-				fmt.Fprintf(w, "data: event-%d\n\n", i)
-				if flusher != nil {
-					flusher.Flush()
-				}
-			}
+		"GET /admin/services": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`[{"hostname":"a.example.com","target":"http://a:80"},{"hostname":"b.example.com","target":"http://b:80"}]`))
 		},
 	})
 	defer srv.Close()
 
-	out, err := executeCommand(t, srv.URL, "events")
+	out, err := executeCommand(t, srv.URL, "service", "list", "--quiet")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	for i := 0; i < 3; i++ {
-		expected := fmt.Sprintf("event-%d", i)
-		if !strings.Contains(out, expected) {
-			t.Errorf("missing %q in output:\n%s", expected, out)
-		}
+	if out != "a.example.com\nb.example.com\n" {
+		t.Errorf("--quiet output = %q", out)
 	}
 }
 
-// --- Init Tests ---
+// --- Exit Code Tests ---
 
-func TestInit(t *testing.T) {
-	dir := t.TempDir()
-	oldWd, _ := os.Getwd()
-	os.Chdir(dir)
-	defer os.Chdir(oldWd)
+func TestStatus_ExitCode(t *testing.T) {
+	var agents string
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"GET /admin/agents": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(agents))
+		},
+	})
+	defer srv.Close()
 
-	out, err := executeCommand(t, "", "init")
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
-	}
-	if !strings.Contains(out, "Created orchestrator.yaml") {
-		t.Errorf("expected creation message, got:\n%s", out)
+	agents = `[{"name":"a","state":"ready"},{"name":"b","state":"sleeping"}]`
+	out, err := executeCommand(t, srv.URL, "status", "--exit-code")
+	if err != nil || out != "" {
+		t.Errorf("healthy: err = %v, output %q; want nil and no output", err, out)
 	}
 
-	orchData, err := os.ReadFile(filepath.Join(dir, "orchestrator.yaml"))
-	if err != nil {
-		t.Fatalf("orchestrator.yaml not created: %v", err)
+	agents = `[{"name":"a","state":"ready"},{"name":"b","state":"degraded"}]`
+	out, err = executeCommand(t, srv.URL, "status", "--exit-code")
+	if code, ok := err.(exitCode); !ok || code != exitDegraded || out != "" {
+		t.Errorf("degraded: err = %v, output %q; want exit 1 and no output", err, out)
 	}
-	if !strings.Contains(string(orchData), "admin_listen") {
-		t.Error("orchestrator.yaml missing expected content")
+
+	srv.Close()
+	_, err = executeCommand(t, srv.URL, "status", "--exit-code")
+	if code, ok := err.(exitCode); !ok || code != exitUnreachable {
+		t.Errorf("unreachable: err = %v, want exit 2", err)
 	}
+}
 
-	stackData, err := os.ReadFile(filepath.Join(dir, "stack.yaml"))
-	if err != nil {
-		t.Fatalf("stack.yaml not created: %v", err)
+func TestAgentCheck(t *testing.T) {
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"GET /admin/agents/good": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"name":"good","state":"sleeping"}`))
+		},
+		"GET /admin/agents/bad": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"name":"bad","state":"crashloop"}`))
+		},
+	})
+	defer srv.Close()
+
+	out, err := executeCommand(t, srv.URL, "agent", "check", "good")
+	if err != nil || !strings.Contains(out, "good: sleeping (ok)") {
+		t.Errorf("check good: err = %v, output %q", err, out)
 	}
-	if !strings.Contains(string(stackData), "warren") {
-		t.Error("stack.yaml missing expected content")
+	if _, err := executeCommand(t, srv.URL, "agent", "check", "good", "--exit-code"); err != nil {
+		t.Errorf("check good --exit-code: %v, want exit 0", err)
+	}
+	if _, err := executeCommand(t, srv.URL, "agent", "check", "bad", "--exit-code"); err != exitDegraded {
+		t.Errorf("check bad --exit-code: %v, want exit 1", err)
+	}
+	if _, err := executeCommand(t, srv.URL, "agent", "check", "missing", "--exit-code"); err != exitUnreachable {
+		t.Errorf("check missing --exit-code: %v, want exit 2", err)
 	}
 }
 
-// --- Scaffold Tests ---
+func TestContexts(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("WARREN_ADMIN", "")
+	t.Setenv("WARREN_CONTEXT", "")
+	t.Setenv("WARREN_TOKEN", "")
+	cfgPath := filepath.Join(home, ".warren", "config.yaml")
+	os.MkdirAll(filepath.Dir(cfgPath), 0o755)
+	os.WriteFile(cfgPath, []byte("# my settings\nhermes:\n  url: nats://hermes:4222\n"), 0o644)
+
+	var auth string
+	srv := mockAdminServer(t, map[string]http.HandlerFunc{
+		"GET /admin/bans": func(w http.ResponseWriter, r *http.Request) {
+			auth = r.Header.Get("Authorization")
+			w.Write([]byte(`[]`))
+		},
+	})
+	defer srv.Close()
 
-func TestScaffold(t *testing.T) {
-	dir := t.TempDir()
-	oldWd, _ := os.Getwd()
-	os.Chdir(dir)
-	defer os.Chdir(oldWd)
+	if _, err := executeCommand(t, "", "context", "add", "prod", "--admin", srv.URL, "--token", "s3cret", "--use"); err != nil {
+		t.Fatalf("context add: %v", err)
+	}
+	if _, err := executeCommand(t, "", "context", "add", "dev", "--admin", "http://dev:9090"); err != nil {
+		t.Fatalf("context add: %v", err)
+	}
+	data, _ := os.ReadFile(cfgPath)
+	if !strings.Contains(string(data), "# my settings") || !strings.Contains(string(data), "nats://hermes:4222") {
+		t.Errorf("existing settings lost:\n%s", data)
+	}
+	if info, err := os.Stat(cfgPath); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("config file mode = %v, %v, want 0600", info.Mode().Perm(), err)
+	}
 
-	out, err := executeCommand(t, "", "scaffold", "mybot")
+	out, err := executeCommand(t, "", "context", "list")
 	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+		t.Fatalf("context list: %v", err)
 	}
-	if !strings.Contains(out, "Scaffolded agent in ./mybot/") {
-		t.Errorf("unexpected output:\n%s", out)
+	if !strings.Contains(out, "*        prod") || !strings.Contains(out, "http://dev:9090") {
+		t.Errorf("context list:\n%s", out)
 	}
 
-	// Check files exist.
-	for _, f := range []string{"Dockerfile", "openclaw.json", "supervisord.conf"} {
-		path := filepath.Join(dir, "mybot", f)
-		data, err := os.ReadFile(path)
-		if err != nil {
-			t.Fatalf("%s not created: %v", f, err)
-		}
-		if f == "openclaw.json" && !strings.Contains(string(data), "mybot") {
-			t.Errorf("openclaw.json missing agent name 'mybot'")
-		}
+	// Commands go to the current context with its token.
+	if _, err := executeCommand(t, "", "bans", "list"); err != nil {
+		t.Fatalf("bans list: %v", err)
+	}
+	if auth != "Bearer s3cret" {
+		t.Errorf("Authorization = %q, want the context's token", auth)
 	}
-}
 
-// --- Edge Cases ---
+	// --admin overrides the URL, and the current context's token isn't
+	// sent along to it.
+	auth = ""
+	if _, err := executeCommand(t, srv.URL, "bans", "list"); err != nil {
+		t.Fatalf("bans list --admin: %v", err)
+	}
+	if auth != "" {
+		t.Errorf("Authorization = %q with --admin, want none", auth)
+	}
 
-func TestAdminFlagOverride(t *testing.T) {
+	if _, err := executeCommand(t, "", "context", "use", "dev"); err != nil {
+		t.Fatalf("context use: %v", err)
+	}
+	if got := getAdminURL(); got != "http://dev:9090" {
+		t.Errorf("admin URL after use = %q, want dev", got)
+	}
+	if _, err := executeCommand(t, "", "--context", "prod", "bans", "list"); err != nil || auth != "Bearer s3cret" {
+		t.Errorf("--context prod: err = %v, Authorization = %q", err, auth)
+	}
+	if _, err := executeCommand(t, "", "--context", "staging", "bans", "list"); err == nil || !strings.Contains(err.Error(), "staging") {
+		t.Errorf("unknown context: err = %v", err)
+	}
+	if _, err := executeCommand(t, "", "context", "use", "staging"); err == nil {
+		t.Error("context use of an unknown context succeeded")
+	}
+}
+
+func TestAgentAnnotate(t *testing.T) {
+	var patch map[string]*string
 	srv := mockAdminServer(t, map[string]http.HandlerFunc{
-		"GET /admin/health": func(w http.ResponseWriter, r *http.Request) {
-			w.Write([]byte(`{"uptime_seconds":1}`))
+		"PATCH /admin/agents/kai/annotations": func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&patch)
+			w.Write([]byte(`{"owner":"team-x"}`))
+		},
+		"GET /admin/agents": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`[{"name":"kai","hostname":"kai.example.com","policy":"on-demand","state":"ready","annotations":{"owner":"team-x","tier":"gold"}}]`))
 		},
 	})
 	defer srv.Close()
 
-	// Use --admin flag to point to our server.
-	out, err := executeCommand(t, "", "status", "--admin", srv.URL, "--format", "json")
+	out, err := executeCommand(t, srv.URL, "agent", "annotate", "kai", "owner=team-x", "note-")
 	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+		t.Fatalf("annotate: %v", err)
 	}
-	if !strings.Contains(out, "uptime_seconds") {
-		t.Errorf("expected JSON output, got:\n%s", out)
+	if patch["owner"] == nil || *patch["owner"] != "team-x" || patch["note"] != nil || len(patch) != 2 {
+		t.Errorf("patch = %v, want owner set and note removed", patch)
+	}
+	if !strings.Contains(out, "Annotated kai: owner=team-x") {
+		t.Errorf("output = %q", out)
 	}
-}
 
-func TestConnectionRefused(t *testing.T) {
-	// Point to a port nothing listens on.
-	_, err := executeCommand(t, "http://127.0.0.1:1", "agent", "list")
-	if err == nil {
-		t.Fatal("expected connection error")
+	if _, err := executeCommand(t, srv.URL, "agent", "annotate", "kai", "owner"); err == nil {
+		t.Error("annotation without = or - was accepted")
+	}
+
+	out, err = executeCommand(t, srv.URL, "agent", "list", "--wide")
+	if err != nil {
+		t.Fatalf("list --wide: %v", err)
+	}
+	if !strings.Contains(out, "ANNOTATIONS") || !strings.Contains(out, "owner=team-x, tier=gold") {
+		t.Errorf("list --wide:\n%s", out)
 	}
 }
 
-func TestNonJSONResponse(t *testing.T) {
+func TestAgentUpdate(t *testing.T) {
+	var patch map[string]any
 	srv := mockAdminServer(t, map[string]http.HandlerFunc{
-		"GET /admin/agents": func(w http.ResponseWriter, r *http.Request) {
-			w.Write([]byte(`this is not json`))
+		"PATCH /admin/agents/kai": func(w http.ResponseWriter, r *http.Request) {
+			patch = nil
+			json.NewDecoder(r.Body).Decode(&patch)
+			w.Write([]byte(`{"status":"ok","name":"kai","changed":["hostnames","idle_timeout"]}`))
 		},
 	})
 	defer srv.Close()
 
-	// Should not crash - table mode will just show empty since unmarshal fails.
-	_, err := executeCommand(t, srv.URL, "agent", "list")
+	out, err := executeCommand(t, srv.URL, "agent", "update", "kai", "--alias", "k.example.com", "--idle-timeout", "2h")
 	if err != nil {
-		t.Fatalf("should not error on non-JSON (just empty table): %v", err)
+		t.Fatalf("update: %v", err)
+	}
+	if patch["idle_timeout"] != "2h" || len(patch) != 2 {
+		t.Errorf("patch = %v, want hostnames and idle_timeout only", patch)
+	}
+	if aliases, ok := patch["hostnames"].([]any); !ok || len(aliases) != 1 || aliases[0] != "k.example.com" {
+		t.Errorf("hostnames = %v", patch["hostnames"])
+	}
+	if !strings.Contains(out, "Updated kai: hostnames, idle_timeout") {
+		t.Errorf("output = %q", out)
+	}
+
+	if _, err := executeCommand(t, srv.URL, "agent", "update", "kai", "--no-aliases", "--max-failures", "0"); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if aliases, ok := patch["hostnames"].([]any); !ok || len(aliases) != 0 || patch["max_failures"] != float64(0) {
+		t.Errorf("patch = %v, want no aliases and max_failures sent even when 0", patch)
+	}
+
+	if _, err := executeCommand(t, srv.URL, "agent", "update", "kai"); err == nil || !strings.Contains(err.Error(), "nothing to update") {
+		t.Errorf("update without flags: %v", err)
 	}
 }
 
-func TestEnvVarOverride(t *testing.T) {
+func TestDoctor(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedAddr := closed.Addr().String()
+	closed.Close()
+	held, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer held.Close()
+
+	cfgFile := filepath.Join(t.TempDir(), "orchestrator.yaml")
+	os.WriteFile(cfgFile, []byte(fmt.Sprintf(`listen: %q
+agents:
+  up:
+    hostname: localhost
+    backend: %q
+    policy: unmanaged
+  down:
+    hostname: down.localhost
+    backend: "http://%s"
+    policy: unmanaged
+  asleep:
+    hostname: asleep.localhost
+    backend: "http://%s"
+    policy: unmanaged
+`, held.Addr().String(), backend.URL, closedAddr, closedAddr)), 0o644)
+
 	srv := mockAdminServer(t, map[string]http.HandlerFunc{
 		"GET /admin/health": func(w http.ResponseWriter, r *http.Request) {
-			w.Write([]byte(`{"uptime_seconds":42}`))
+			w.Write([]byte(`{"status":"ok","checks":[]}`))
+		},
+		"GET /admin/agents": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`[{"name":"asleep","state":"sleeping"},{"name":"down","state":"degraded"},{"name":"up","state":"ready"}]`))
 		},
 	})
 	defer srv.Close()
 
-	os.Setenv("WARREN_ADMIN", srv.URL)
-	defer os.Unsetenv("WARREN_ADMIN")
+	out, err := executeCommand(t, srv.URL, "doctor", "--config", cfgFile, "--format", "json")
+	if err == nil {
+		t.Error("doctor succeeded with an unreachable backend")
+	}
+	var results []doctorResult
+	if err := json.Unmarshal([]byte(out), &results); err != nil {
+		t.Fatalf("parse %q: %v", out, err)
+	}
+	status := make(map[string]string)
+	for _, r := range results {
+		status[r.Check] = r.Status
+	}
+	want := map[string]string{
+		"admin":                                 "pass",
+		"config":                                "pass",
+		"port " + held.Addr().String() + "/tcp": "pass", // held by "the orchestrator"
+		"backend up":                            "pass",
+		"backend down":                          "fail",
+		"backend asleep":                        "pass",
+		"dns localhost":                         "pass",
+	}
+	for check, s := range want {
+		if status[check] != s {
+			t.Errorf("%s = %q, want %q (%v)", check, status[check], s, results)
+		}
+	}
 
-	// Set adminURL to empty to let env var take effect.
-	adminURL = ""
-	out, err := executeCommand(t, "", "status", "--format", "json")
-	// The executeCommand sets adminURL to "", so getAdminURL should fall through to env.
+	// With the orchestrator unreachable, a port in use is someone else's.
+	out, _ = executeCommand(t, "http://"+closedAddr, "doctor", "--config", cfgFile)
+	if !strings.Contains(out, "FAIL  port "+held.Addr().String()+"/tcp  listen: in use by another process") {
+		t.Errorf("doctor without admin:\n%s", out)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	old := watchSettle
+	watchSettle = time.Millisecond
+	defer func() { watchSettle = old }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changed := make(chan struct{}, 1)
+	var buf bytes.Buffer
+	renders := 0
+	err := watch(ctx, &buf, "warren agent list", time.Hour, changed, func() error {
+		renders++
+		switch renders {
+		case 1:
+			changed <- struct{}{} // an event re-renders without waiting for the interval
+		case 2:
+			cancel()
+			return errors.New("admin API unreachable")
+		}
+		return nil
+	})
 	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+		t.Fatalf("watch: %v", err)
 	}
-	if !strings.Contains(out, "42") {
-		t.Errorf("expected env var to work, got:\n%s", out)
+	if renders != 2 {
+		t.Errorf("rendered %d times, want 2", renders)
+	}
+	out := buf.String()
+	if strings.Count(out, "\033[H\033[2J") != 2 || !strings.Contains(out, "Every 1h and on events: warren agent list") {
+		t.Errorf("output = %q", out)
+	}
+	if !strings.Contains(out, "Error: admin API unreachable") {
+		t.Errorf("render error not shown: %q", out)
+	}
+
+	if _, err := executeCommand(t, "http://127.0.0.1:1", "status", "--watch", "--exit-code"); err == nil || !strings.Contains(err.Error(), "--exit-code") {
+		t.Errorf("status --watch --exit-code: err = %v", err)
+	}
+}
+
+func TestImportTraefik(t *testing.T) {
+	dir := t.TempDir()
+	dynamicFile := filepath.Join(dir, "dynamic.yml")
+	htpasswd := filepath.Join(dir, "htpasswd")
+	os.WriteFile(htpasswd, []byte("# wiki editors\neditor:$2y$05$abcdefghijklmnopqrstuu5sEyOBwTL2gIjDlIFTtuYsQdHJDfNq\n"), 0o600)
+	os.WriteFile(dynamicFile, []byte(`http:
+  routers:
+    jellyfin:
+      rule: "Host(`+"`jf.example.com`"+`)"
+      service: jellyfin
+      middlewares: [https@file, auth]
+    wiki:
+      rule: "Host(`+"`wiki.example.com`"+`) && PathPrefix(`+"`/docs`"+`)"
+      service: wiki@file
+      middlewares: [strip, editors]
+    grafana:
+      rule: "Host(`+"`grafana.example.com`"+`)"
+      service: wiki
+      middlewares: [nobody]
+    taken:
+      rule: "Host(`+"`kai.example.com`"+`)"
+      service: wiki
+    api:
+      rule: "PathPrefix(`+"`/api`"+`)"
+      service: wiki
+  services:
+    jellyfin:
+      loadBalancer:
+        servers:
+          - url: "http://192.168.1.10:8096"
+          - url: "http://192.168.1.11:8096"
+        healthCheck:
+          path: /health
+          interval: 30s
+    wiki:
+      loadBalancer:
+        servers:
+          - url: "http://192.168.1.20:3000"
+  middlewares:
+    https:
+      redirectScheme:
+        scheme: https
+    auth:
+      basicAuth:
+        users: ["admin:$2y$05$abcdefghijklmnopqrstuu5sEyOBwTL2gIjDlIFTtuYsQdHJDfNq"]
+    editors:
+      basicAuth:
+        usersFile: `+htpasswd+`
+        realm: Wiki
+    nobody:
+      basicAuth:
+        realm: Grafana
+    strip:
+      stripPrefix:
+        prefixes: [/docs]
+tcp:
+  routers:
+    ssh:
+      rule: "HostSNI(`+"`*`"+`)"
+`), 0o644)
+	cfgFile := filepath.Join(dir, "orchestrator.yaml")
+	os.WriteFile(cfgFile, []byte(`listen: ":8080"
+agents:
+  kai:
+    hostname: kai.example.com
+    backend: "http://kai:18790"
+    policy: unmanaged
+`), 0o644)
+
+	out, err := executeCommand(t, "", "import", "traefik", "-f", dynamicFile, "--config", cfgFile)
+	if err != nil {
+		t.Fatalf("import traefik: %v\n%s", err, out)
+	}
+	for _, want := range []string{
+		"Skipped tcp: TCP routers aren't imported",
+		"Skipped api: no Host rule",
+		`Skipped taken: kai.example.com is already routed to agent "kai"`,
+		"Warning: wiki: PathPrefix in the rule isn't supported; all of wiki.example.com is routed",
+		`Warning: wiki: middleware "strip" (stripPrefix) isn't supported; left out`,
+		`Warning: grafana: middleware "nobody" has no users; left out`,
+		"Added service grafana.example.com → http://192.168.1.20:3000",
+		"Added agent jellyfin (jf.example.com → http://192.168.1.10:8096, unmanaged)",
+		"Added service wiki.example.com → http://192.168.1.20:3000",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output, got:\n%s", want, out)
+		}
+	}
+
+	cfg, err := config.Load(cfgFile)
+	if err != nil {
+		t.Fatalf("imported config doesn't load: %v", err)
+	}
+	jf := cfg.Agents["jellyfin"]
+	if jf == nil || jf.Policy != "unmanaged" || !jf.ForceHTTPS || jf.BasicAuth == nil || len(jf.BasicAuth.Users) != 1 ||
+		len(jf.Replicas) != 1 || jf.Health.URL != "http://192.168.1.10:8096/health" || time.Duration(jf.Health.CheckInterval) != 30*time.Second {
+		t.Errorf("jellyfin = %+v", jf)
+	}
+	if svc := cfg.Services["wiki.example.com"]; svc == nil || svc.Target != "http://192.168.1.20:3000" ||
+		svc.BasicAuth == nil || svc.BasicAuth.UsersFile != htpasswd || svc.BasicAuth.Realm != "Wiki" {
+		t.Errorf("wiki service = %+v", svc)
+	}
+	if svc := cfg.Services["grafana.example.com"]; svc == nil || svc.BasicAuth != nil {
+		t.Errorf("grafana service = %+v", svc)
 	}
 }
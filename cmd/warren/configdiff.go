@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"warren/internal/config"
+	"warren/internal/human"
+)
+
+func configCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Validate a config file or compare it with the running orchestrator",
+		// "warren config <file>" validates, as it did before the subcommands.
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return validateConfigFile(args[0])
+		},
+	}
+
+	cmd.AddCommand(
+		configValidateCmd(),
+		configDiffCmd(),
+	)
+
+	return cmd
+}
+
+func configValidateCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "validate <file>",
+		Short: "Validate a config file",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return validateConfigFile(args[0])
+		},
+	}
+}
+
+func validateConfigFile(path string) error {
+	if _, err := config.Load(path); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+	fmt.Println("OK")
+	return nil
+}
+
+func configDiffCmd() *cobra.Command {
+	var useExitCode bool
+	cmd := &cobra.Command{
+		Use:   "diff <file>",
+		Short: "Show how a config file differs from the running orchestrator",
+		Long: "Validate a config file and compare its agents and webhooks with the orchestrator's\n" +
+			"live configuration, including agents added through the API, printing what a reload\n" +
+			"with the file would add (+), change (~) and remove (-). Webhook header values are\n" +
+			"not printed, since they usually hold credentials.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			local, err := config.Load(args[0])
+			if err != nil {
+				return fmt.Errorf("validation failed: %w", err)
+			}
+			data, err := apiGet("/admin/export")
+			if err != nil {
+				return err
+			}
+			// The export is the running config with defaults already
+			// applied, so it's decoded as is rather than loaded.
+			live, err := config.Decode(data, config.Limits{})
+			if err != nil {
+				return fmt.Errorf("parse live config: %w", err)
+			}
+
+			changes := diffConfigs(live, local)
+			if len(changes) == 0 {
+				fmt.Println("No differences: the orchestrator matches " + args[0] + ".")
+				return nil
+			}
+			printChanges(changes)
+			if useExitCode {
+				return exitWith(cmd, 1)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&useExitCode, "exit-code", false, "exit 1 when there are differences")
+	return cmd
+}
+
+// diffConfigs lists the agents and webhooks that differ between the live
+// config and local, as the changes loading local would make.
+func diffConfigs(live, local *config.Config) []applyChange {
+	var changes []applyChange
+	for _, name := range unionNames(live.Agents, local.Agents) {
+		have, inLive := live.Agents[name]
+		want, inLocal := local.Agents[name]
+		switch {
+		case !inLive:
+			changes = append(changes, applyChange{action: "create", kind: "agent", name: name})
+		case !inLocal:
+			changes = append(changes, applyChange{action: "delete", kind: "agent", name: name})
+		default:
+			if diff := fieldDiff(flatten(have), flatten(want), nil); len(diff) > 0 {
+				changes = append(changes, applyChange{action: "update", kind: "agent", name: name, diff: diff})
+			}
+		}
+	}
+
+	// Webhooks have no name; they're matched by URL.
+	liveHooks, localHooks := webhooksByURL(live.Webhooks), webhooksByURL(local.Webhooks)
+	secret := func(key string) bool { return strings.HasPrefix(key, "headers.") }
+	for _, url := range unionNames(liveHooks, localHooks) {
+		have, inLive := liveHooks[url]
+		want, inLocal := localHooks[url]
+		switch {
+		case !inLive:
+			changes = append(changes, applyChange{action: "create", kind: "webhook", name: url})
+		case !inLocal:
+			changes = append(changes, applyChange{action: "delete", kind: "webhook", name: url})
+		default:
+			if diff := fieldDiff(flatten(have), flatten(want), secret); len(diff) > 0 {
+				changes = append(changes, applyChange{action: "update", kind: "webhook", name: url, diff: diff})
+			}
+		}
+	}
+	return changes
+}
+
+func webhooksByURL(hooks []config.WebhookConfig) map[string]config.WebhookConfig {
+	m := make(map[string]config.WebhookConfig, len(hooks))
+	for _, h := range hooks {
+		m[h.URL] = h
+	}
+	return m
+}
+
+// fieldDiff returns "field: old → new" for each field that differs, with
+// the values of fields hidden reports true for left out.
+func fieldDiff(have, want map[string]string, hidden func(string) bool) []string {
+	var diff []string
+	for _, key := range unionNames(have, want) {
+		old, new := have[key], want[key]
+		if old == new {
+			continue
+		}
+		if hidden != nil && hidden(key) {
+			diff = append(diff, key+": (changed)")
+			continue
+		}
+		diff = append(diff, fmt.Sprintf("%s: %s → %s", key, orNone(old), orNone(new)))
+	}
+	return diff
+}
+
+// flatten renders v as YAML and returns its scalar fields keyed by dotted
+// path, e.g. "idle.timeout". Lists of scalars are joined with commas.
+func flatten(v any) map[string]string {
+	out := make(map[string]string)
+	var node yaml.Node
+	if err := node.Encode(v); err != nil {
+		return out
+	}
+	flattenNode(&node, "", out)
+	return out
+}
+
+func flattenNode(n *yaml.Node, prefix string, out map[string]string) {
+	join := func(key string) string {
+		if prefix == "" {
+			return key
+		}
+		return prefix + "." + key
+	}
+	switch n.Kind {
+	case yaml.DocumentNode:
+		for _, c := range n.Content {
+			flattenNode(c, prefix, out)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			flattenNode(n.Content[i+1], join(n.Content[i].Value), out)
+		}
+	case yaml.SequenceNode:
+		scalars := make([]string, 0, len(n.Content))
+		for i, c := range n.Content {
+			if c.Kind != yaml.ScalarNode {
+				flattenNode(c, fmt.Sprintf("%s[%d]", prefix, i), out)
+				continue
+			}
+			scalars = append(scalars, c.Value)
+		}
+		if len(scalars) > 0 {
+			out[prefix] = strings.Join(scalars, ", ")
+		}
+	case yaml.ScalarNode:
+		if n.Tag == "!!null" {
+			return
+		}
+		// Durations are encoded in Go's form; show them as written.
+		if d, err := time.ParseDuration(n.Value); err == nil && strings.Trim(n.Value, "0123456789") != "" {
+			out[prefix] = human.FormatDuration(d)
+			return
+		}
+		out[prefix] = n.Value
+	}
+}
+
+// unionNames returns the keys of a and b, sorted.
+func unionNames[V any](a, b map[string]V) []string {
+	names := sortedNames(a)
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
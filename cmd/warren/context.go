@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// contextName is the --context flag: which orchestrator in the CLI's config
+// file to talk to.
+var contextName string
+
+// cliConfig is the CLI's own config file, ~/.warren/config.yaml. Other
+// sections, such as hermes and alexandria, are read where they're used.
+type cliConfig struct {
+	Admin          string                 `yaml:"admin"` // used when no context is selected
+	CurrentContext string                 `yaml:"current_context"`
+	Contexts       map[string]*cliContext `yaml:"contexts"`
+}
+
+// cliContext is one orchestrator the CLI can talk to.
+type cliContext struct {
+	Admin string  `yaml:"admin"`
+	Token string  `yaml:"token,omitempty"` // admin_token, sent as a bearer token
+	TLS   *cliTLS `yaml:"tls,omitempty"`
+}
+
+// cliTLS configures HTTPS to an admin API behind a private CA or requiring
+// client certificates.
+type cliTLS struct {
+	CA                 string `yaml:"ca,omitempty"`   // PEM bundle trusted in addition to the system roots
+	Cert               string `yaml:"cert,omitempty"` // client certificate, with key
+	Key                string `yaml:"key,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"`
+}
+
+// cliConfigPath is the CLI's config file.
+func cliConfigPath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".warren", "config.yaml")
+}
+
+// readCLIConfig reads the CLI's config file. A missing or unreadable file
+// is an empty config.
+func readCLIConfig() cliConfig {
+	var cfg cliConfig
+	if data, err := os.ReadFile(cliConfigPath()); err == nil {
+		_ = yaml.Unmarshal(data, &cfg)
+	}
+	return cfg
+}
+
+// selectedContext returns the context chosen by --context, WARREN_CONTEXT
+// or current_context, in that order, or "" if there is none.
+func selectedContext(cfg cliConfig) (string, *cliContext, error) {
+	name := contextName
+	if name == "" {
+		name = os.Getenv("WARREN_CONTEXT")
+	}
+	if name == "" {
+		name = cfg.CurrentContext
+	}
+	if name == "" {
+		return "", nil, nil
+	}
+	ctx, ok := cfg.Contexts[name]
+	if !ok {
+		return name, nil, fmt.Errorf("context %q not found in %s", name, cliConfigPath())
+	}
+	return name, ctx, nil
+}
+
+// adminTarget resolves the orchestrator admin requests go to. The URL comes
+// from --admin or WARREN_ADMIN, then the selected context, then the config
+// file's admin key. A context's token and TLS settings are only used with
+// its own URL or when it's picked explicitly with --context, so an override
+// never sends one orchestrator's token to another. WARREN_TOKEN overrides
+// the token.
+func adminTarget() (*cliContext, error) {
+	cfg := readCLIConfig()
+	_, ctx, err := selectedContext(cfg)
+	if err != nil {
+		return nil, err
+	}
+	target := &cliContext{}
+	override := adminURL
+	if override == "" {
+		override = os.Getenv("WARREN_ADMIN")
+	}
+	switch {
+	case override != "":
+		target.Admin = override
+		if ctx != nil && contextName != "" {
+			target.Token, target.TLS = ctx.Token, ctx.TLS
+		}
+	case ctx != nil && ctx.Admin != "":
+		*target = *ctx
+	case cfg.Admin != "":
+		target.Admin = cfg.Admin
+	default:
+		target.Admin = "http://localhost:9090"
+	}
+	if v := os.Getenv("WARREN_TOKEN"); v != "" {
+		target.Token = v
+	}
+	return target, nil
+}
+
+// adminClient returns an HTTP client for target and sets its token on req.
+func adminClient(target *cliContext, req *http.Request) (*http.Client, error) {
+	if target.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+target.Token)
+	}
+	if target.TLS == nil {
+		return http.DefaultClient, nil
+	}
+	tlsCfg := &tls.Config{InsecureSkipVerify: target.TLS.InsecureSkipVerify}
+	if target.TLS.CA != "" {
+		pem, err := os.ReadFile(target.TLS.CA)
+		if err != nil {
+			return nil, fmt.Errorf("read CA: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", target.TLS.CA)
+		}
+		tlsCfg.RootCAs = pool
+	}
+	if target.TLS.Cert != "" || target.TLS.Key != "" {
+		cert, err := tls.LoadX509KeyPair(target.TLS.Cert, target.TLS.Key)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsCfg
+	return &http.Client{Transport: transport}, nil
+}
+
+func contextCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "context",
+		Short: "Manage the orchestrators the CLI talks to",
+		Long: "Contexts name orchestrators, each with its admin URL, token and TLS settings, in\n" +
+			"~/.warren/config.yaml. Commands use the current context, or the one given with\n" +
+			"--context or WARREN_CONTEXT.",
+	}
+
+	cmd.AddCommand(
+		contextListCmd(),
+		contextUseCmd(),
+		contextAddCmd(),
+	)
+
+	return cmd
+}
+
+func contextListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List contexts",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg := readCLIConfig()
+			current, _, _ := selectedContext(cfg)
+			names := make([]string, 0, len(cfg.Contexts))
+			for name := range cfg.Contexts {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			if format == "json" {
+				type entry struct {
+					Name    string `json:"name"`
+					Admin   string `json:"admin"`
+					Current bool   `json:"current"`
+				}
+				list := make([]entry, 0, len(names))
+				for _, name := range names {
+					list = append(list, entry{Name: name, Admin: cfg.Contexts[name].Admin, Current: name == current})
+				}
+				data, err := json.MarshalIndent(list, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(data))
+				return nil
+			}
+			if quiet {
+				for _, name := range names {
+					fmt.Println(name)
+				}
+				return nil
+			}
+			if len(names) == 0 {
+				fmt.Println("No contexts. Add one with: warren context add <name> --admin <url>")
+				return nil
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "CURRENT\tNAME\tADMIN\tAUTH")
+			for _, name := range names {
+				ctx := cfg.Contexts[name]
+				mark := ""
+				if name == current {
+					mark = "*"
+				}
+				var auth []string
+				if ctx.Token != "" {
+					auth = append(auth, "token")
+				}
+				if ctx.TLS != nil && ctx.TLS.Cert != "" {
+					auth = append(auth, "client cert")
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", mark, name, ctx.Admin, orNone(strings.Join(auth, ", ")))
+			}
+			return w.Flush()
+		},
+	}
+}
+
+func contextUseCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "use <name>",
+		Short: "Switch the current context",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, ok := readCLIConfig().Contexts[args[0]]; !ok {
+				return fmt.Errorf("context %q not found", args[0])
+			}
+			err := updateCLIConfig(func(root *yaml.Node) error {
+				return setMappingKey(root, "current_context", args[0])
+			})
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Switched to context %s\n", args[0])
+			return nil
+		},
+	}
+}
+
+func contextAddCmd() *cobra.Command {
+	var ctx cliContext
+	var tlsOpts cliTLS
+	var use bool
+	cmd := &cobra.Command{
+		Use:   "add <name>",
+		Short: "Add or replace a context",
+		Long: "Save an orchestrator's admin URL, token and TLS settings under a name. The config\n" +
+			"file is written with mode 0600 since it holds the token.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if ctx.Admin == "" {
+				return errors.New("--admin is required")
+			}
+			if (tlsOpts.Cert == "") != (tlsOpts.Key == "") {
+				return errors.New("--cert and --key go together")
+			}
+			if tlsOpts != (cliTLS{}) {
+				ctx.TLS = &tlsOpts
+			}
+			err := updateCLIConfig(func(root *yaml.Node) error {
+				contexts, err := mappingKey(root, "contexts")
+				if err != nil {
+					return err
+				}
+				if err := setMappingKey(contexts, args[0], ctx); err != nil {
+					return err
+				}
+				if use {
+					return setMappingKey(root, "current_context", args[0])
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Context %s saved\n", args[0])
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&ctx.Admin, "admin", "", "admin API URL (required)")
+	cmd.Flags().StringVar(&ctx.Token, "token", "", "admin token")
+	cmd.Flags().StringVar(&tlsOpts.CA, "ca", "", "PEM file of CA certificates to trust")
+	cmd.Flags().StringVar(&tlsOpts.Cert, "cert", "", "client certificate file")
+	cmd.Flags().StringVar(&tlsOpts.Key, "key", "", "client key file")
+	cmd.Flags().BoolVar(&tlsOpts.InsecureSkipVerify, "insecure-skip-verify", false, "don't verify the server's certificate")
+	cmd.Flags().BoolVar(&use, "use", false, "switch to the context")
+	return cmd
+}
+
+// updateCLIConfig edits the CLI's config file as a YAML tree, so comments
+// and sections the CLI doesn't know stay as they are.
+func updateCLIConfig(edit func(root *yaml.Node) error) error {
+	path := cliConfigPath()
+	doc := yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if len(bytes.TrimSpace(data)) > 0 {
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return fmt.Errorf("parse %s: %w", path, err)
+		}
+	}
+	if doc.Content[0].Kind != yaml.MappingNode {
+		return fmt.Errorf("%s is not a YAML mapping", path)
+	}
+	if err := edit(doc.Content[0]); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of an existing file.
+	return os.Chmod(path, 0o600)
+}
+
+// mappingKey returns the mapping under key in m, adding it if missing.
+func mappingKey(m *yaml.Node, key string) (*yaml.Node, error) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value != key {
+			continue
+		}
+		v := m.Content[i+1]
+		if v.Kind == yaml.ScalarNode && v.Tag == "!!null" {
+			*v = yaml.Node{Kind: yaml.MappingNode}
+		}
+		if v.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("%s is not a mapping", key)
+		}
+		return v, nil
+	}
+	v := &yaml.Node{Kind: yaml.MappingNode}
+	m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, v)
+	return v, nil
+}
+
+// setMappingKey sets key in m to value, replacing an existing entry in place.
+func setMappingKey(m *yaml.Node, key string, value any) error {
+	var v yaml.Node
+	if err := v.Encode(value); err != nil {
+		return err
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			m.Content[i+1] = &v
+			return nil
+		}
+	}
+	m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, &v)
+	return nil
+}
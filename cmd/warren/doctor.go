@@ -0,0 +1,372 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/spf13/cobra"
+
+	"warren/internal/config"
+	"warren/internal/dnscheck"
+)
+
+// doctorTimeout bounds each network probe made by warren doctor.
+const doctorTimeout = 3 * time.Second
+
+// Doctor check outcomes.
+const (
+	doctorPass = "pass"
+	doctorWarn = "warn"
+	doctorFail = "fail"
+)
+
+// doctorResult is one line of the warren doctor report.
+type doctorResult struct {
+	Check  string `json:"check"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+func doctorCmd() *cobra.Command {
+	var configPath string
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Diagnose common problems with the orchestrator and its host",
+		Long: "Check that the admin API answers, Docker can be reached, the config is valid, its\n" +
+			"listen ports are free (or held by the running orchestrator), agent hostnames resolve\n" +
+			"and agent backends accept connections, printing pass, warn or fail for each. Run it on\n" +
+			"the orchestrator's host. Without a readable config file the live configuration is\n" +
+			"checked instead. The exit status is 1 when any check fails.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			results := runDoctor(cmd.Context(), configPath)
+			if format == "json" {
+				data, _ := json.MarshalIndent(results, "", "  ")
+				fmt.Println(string(data))
+			} else {
+				printDoctor(results)
+			}
+			for _, r := range results {
+				if r.Status == doctorFail {
+					return exitWith(cmd, 1)
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&configPath, "config", "./orchestrator.yaml", "orchestrator config file to check")
+	return cmd
+}
+
+// runDoctor runs every check and returns the results in report order.
+func runDoctor(ctx context.Context, configPath string) []doctorResult {
+	var results []doctorResult
+	add := func(check, status, detail string) {
+		results = append(results, doctorResult{Check: check, Status: status, Detail: detail})
+	}
+
+	// Admin API.
+	adminUp := false
+	if data, err := apiGet("/admin/health"); err != nil {
+		add("admin", doctorFail, err.Error())
+	} else {
+		adminUp = true
+		var health struct {
+			Status string        `json:"status"`
+			Checks []healthCheck `json:"checks"`
+		}
+		_ = json.Unmarshal(data, &health)
+		var failing []string
+		for _, c := range health.Checks {
+			if c.Status != "ok" {
+				failing = append(failing, c.Name+": "+c.Error)
+			}
+		}
+		if len(failing) > 0 {
+			add("admin", doctorWarn, getAdminURL()+" reachable, degraded: "+strings.Join(failing, "; "))
+		} else {
+			add("admin", doctorPass, getAdminURL()+" reachable")
+		}
+	}
+
+	// Config. The local file is preferred; without one the live config
+	// still lets the remaining checks run.
+	cfg, err := config.Load(configPath)
+	switch {
+	case err == nil:
+		add("config", doctorPass, fmt.Sprintf("%s valid, %d agents", configPath, len(cfg.Agents)))
+	case errors.Is(err, os.ErrNotExist) && adminUp:
+		cfg = liveConfig()
+		if cfg == nil {
+			add("config", doctorFail, configPath+" not found and the live config could not be read")
+		} else {
+			add("config", doctorWarn, configPath+" not found; checking the live config")
+		}
+	default:
+		add("config", doctorFail, err.Error())
+	}
+	if cfg == nil {
+		return results
+	}
+
+	// Docker is only required when some agent runs from a container.
+	needsDocker := false
+	for _, agent := range cfg.Agents {
+		if agent.Container.Name != "" {
+			needsDocker = true
+		}
+	}
+	if detail, err := pingDocker(ctx, cfg.DockerHost); err != nil {
+		status := doctorWarn
+		if needsDocker {
+			status = doctorFail
+		}
+		add("docker", status, err.Error())
+	} else {
+		add("docker", doctorPass, detail)
+	}
+
+	bound := make(map[string]string) // listener → owner
+	for _, l := range doctorListeners(cfg) {
+		if owner, ok := bound[l.String()]; ok {
+			add("port "+l.String(), doctorFail, l.owner+": conflicts with "+owner)
+			continue
+		}
+		bound[l.String()] = l.owner
+		status, detail := checkListener(l, adminUp)
+		add("port "+l.String(), status, detail)
+	}
+
+	states := agentStates()
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		network []doctorResult
+	)
+	expected, _ := dnscheck.ParsePrefixes(cfg.DNSCheck.PublicIPs) // validated by config
+	for _, name := range sortedNames(cfg.Agents) {
+		agent := cfg.Agents[name]
+		for _, host := range append([]string{agent.Hostname}, agent.Hostnames...) {
+			if host == "" || strings.HasPrefix(host, "*.") {
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				status, detail := checkHostname(ctx, host, expected)
+				mu.Lock()
+				network = append(network, doctorResult{Check: "dns " + host, Status: status, Detail: detail})
+				mu.Unlock()
+			}()
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status, detail := checkBackend(ctx, agent.Backend, states[name])
+			mu.Lock()
+			network = append(network, doctorResult{Check: "backend " + name, Status: status, Detail: detail})
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	sort.Slice(network, func(i, j int) bool { return network[i].Check < network[j].Check })
+	return append(results, network...)
+}
+
+// liveConfig returns the running orchestrator's config, or nil.
+func liveConfig() *config.Config {
+	data, err := apiGet("/admin/export")
+	if err != nil {
+		return nil
+	}
+	cfg, err := config.Decode(data, config.Limits{})
+	if err != nil {
+		return nil
+	}
+	return cfg
+}
+
+// agentStates returns each agent's state from the admin API, or an empty
+// map when it can't be reached.
+func agentStates() map[string]string {
+	states := make(map[string]string)
+	data, err := apiGet("/admin/agents")
+	if err != nil {
+		return states
+	}
+	var agents []struct {
+		Name  string `json:"name"`
+		State string `json:"state"`
+	}
+	_ = json.Unmarshal(data, &agents)
+	for _, a := range agents {
+		states[a.Name] = a.State
+	}
+	return states
+}
+
+func pingDocker(ctx context.Context, host string) (string, error) {
+	opts := []client.Opt{client.FromEnv, client.WithAPIVersionNegotiation()}
+	if host != "" {
+		opts = append(opts, client.WithHost(host))
+	}
+	docker, err := client.NewClientWithOpts(opts...)
+	if err != nil {
+		return "", err
+	}
+	defer docker.Close()
+	ctx, cancel := context.WithTimeout(ctx, doctorTimeout)
+	defer cancel()
+	ping, err := docker.Ping(ctx)
+	if err != nil {
+		return "", err
+	}
+	return docker.DaemonHost() + ", API " + ping.APIVersion, nil
+}
+
+// doctorListener is an address the orchestrator binds.
+type doctorListener struct {
+	network string // "tcp" or "udp"
+	addr    string
+	owner   string // config key, e.g. "listen" or "agent foo ports"
+}
+
+func (l doctorListener) String() string { return l.addr + "/" + l.network }
+
+// doctorListeners returns the addresses cfg makes the orchestrator bind.
+func doctorListeners(cfg *config.Config) []doctorListener {
+	var out []doctorListener
+	add := func(network, addr, owner string) {
+		if addr != "" {
+			out = append(out, doctorListener{network: network, addr: addr, owner: owner})
+		}
+	}
+	add("tcp", cfg.Listen, "listen")
+	add("tcp", cfg.TLSListen, "tls_listen")
+	add("tcp", cfg.AdminListen, "admin_listen")
+	if cfg.HTTP3.Listen != cfg.TLSListen {
+		add("tcp", cfg.HTTP3.Listen, "http3.listen") // otherwise served through tls_listen
+	}
+	add("udp", cfg.HTTP3.Listen, "http3.listen")
+	for _, name := range sortedNames(cfg.Agents) {
+		for _, p := range cfg.Agents[name].Ports {
+			proto := p.Proto
+			if proto == "" {
+				proto = "tcp"
+			}
+			add(proto, fmt.Sprintf(":%d", p.Listen), "agent "+name+" ports")
+		}
+	}
+	return out
+}
+
+// checkListener tries to bind l. While the orchestrator runs its own
+// ports are taken, so a port in use only fails when it isn't reachable.
+func checkListener(l doctorListener, adminUp bool) (string, string) {
+	var err error
+	if l.network == "udp" {
+		var pc net.PacketConn
+		if pc, err = net.ListenPacket("udp", l.addr); err == nil {
+			pc.Close()
+		}
+	} else {
+		var ln net.Listener
+		if ln, err = net.Listen("tcp", l.addr); err == nil {
+			ln.Close()
+		}
+	}
+	switch {
+	case err == nil:
+		return doctorPass, l.owner + ": free"
+	case errors.Is(err, syscall.EADDRINUSE) && adminUp:
+		return doctorPass, l.owner + ": in use, presumably by the running orchestrator"
+	case errors.Is(err, syscall.EADDRINUSE):
+		return doctorFail, l.owner + ": in use by another process"
+	case errors.Is(err, syscall.EACCES):
+		return doctorWarn, l.owner + ": permission denied; binding it needs root or CAP_NET_BIND_SERVICE"
+	default:
+		return doctorFail, l.owner + ": " + err.Error()
+	}
+}
+
+// checkHostname resolves host and, with dns_check.public_ips set, checks
+// that it points at Warren.
+func checkHostname(ctx context.Context, host string, expected []netip.Prefix) (string, string) {
+	ctx, cancel := context.WithTimeout(ctx, doctorTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return doctorFail, "does not resolve"
+		}
+		return doctorWarn, err.Error()
+	}
+	resolved := make([]string, 0, len(addrs))
+	ours := len(expected) == 0
+	for _, a := range addrs {
+		a = a.Unmap()
+		resolved = append(resolved, a.String())
+		for _, p := range expected {
+			if p.Contains(a) {
+				ours = true
+			}
+		}
+	}
+	detail := strings.Join(resolved, ", ")
+	if !ours {
+		return doctorWarn, detail + ", not one of dns_check.public_ips"
+	}
+	return doctorPass, detail
+}
+
+// checkBackend opens a TCP connection to the backend. A sleeping agent's
+// backend is expected to be down.
+func checkBackend(ctx context.Context, backend, state string) (string, string) {
+	u, err := url.Parse(backend)
+	if err != nil || u.Host == "" {
+		return doctorFail, "invalid backend " + backend
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	addr := net.JoinHostPort(u.Hostname(), port)
+	d := net.Dialer{Timeout: doctorTimeout}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err == nil {
+		conn.Close()
+		return doctorPass, addr + " accepts connections"
+	}
+	if state == "sleeping" {
+		return doctorPass, addr + " down while the agent sleeps"
+	}
+	return doctorFail, err.Error()
+}
+
+func printDoctor(results []doctorResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	counts := make(map[string]int)
+	for _, r := range results {
+		counts[r.Status]++
+		fmt.Fprintf(w, "%s\t%s\t%s\n", strings.ToUpper(r.Status), r.Check, r.Detail)
+	}
+	w.Flush()
+	fmt.Printf("\n%d passed, %d warnings, %d failed\n", counts[doctorPass], counts[doctorWarn], counts[doctorFail])
+}
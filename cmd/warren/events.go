@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"warren/internal/events"
+)
+
+// eventsRetry is the first wait before reconnecting a dropped event stream.
+// It doubles up to eventsMaxRetry while the admin API stays unreachable.
+var (
+	eventsRetry    = time.Second
+	eventsMaxRetry = 30 * time.Second
+)
+
+// eventVerbs are the one-word summaries shown for known event types.
+var eventVerbs = map[string]string{
+	events.AgentReady:          "ready",
+	events.AgentDegraded:       "degraded",
+	events.AgentWake:           "waking",
+	events.AgentSleep:          "sleeping",
+	events.AgentStarting:       "starting",
+	events.AgentHealthFailed:   "health check failed",
+	events.RestartExhausted:    "restarts exhausted",
+	events.AgentAdded:          "added",
+	events.AgentRemoved:        "removed",
+	events.AgentRecycled:       "recycled",
+	events.AgentCrashLoop:      "crash-looping",
+	events.AgentRemediating:    "remediating",
+	events.AgentRecovered:      "recovered",
+	events.AgentWakeBudget:     "wake budget exceeded",
+	events.CircuitOpen:         "circuit open",
+	events.CircuitClosed:       "circuit closed",
+	events.HostnameDNSMismatch: "dns mismatch",
+
+	events.SecurityAuthFailed:    "auth failed",
+	events.SecurityRateLimited:   "rate limited",
+	events.SecurityTargetBlocked: "target blocked",
+	events.SecurityBanned:        "banned",
+}
+
+// ANSI colours for event summaries.
+const (
+	colorReset  = "\033[0m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+	colorDim    = "\033[2m"
+)
+
+// eventColor groups event types by how much attention they need.
+func eventColor(typ string) string {
+	if events.IsSecurity(typ) {
+		return colorRed
+	}
+	switch typ {
+	case events.AgentReady, events.AgentRecovered, events.CircuitClosed, events.AgentAdded:
+		return colorGreen
+	case events.AgentDegraded, events.AgentHealthFailed, events.RestartExhausted, events.AgentCrashLoop, events.CircuitOpen:
+		return colorRed
+	case events.AgentWake, events.AgentStarting, events.AgentRemediating, events.HostnameDNSMismatch:
+		return colorYellow
+	default:
+		return colorDim
+	}
+}
+
+// renderEvent summarises an event on one line, e.g.
+// "12:03:01 agent1 waking (trigger=predictive)".
+func renderEvent(ev events.Event, color bool) string {
+	ts := ev.Timestamp.Local()
+	if utc {
+		ts = ev.Timestamp.UTC()
+	}
+	verb, ok := eventVerbs[ev.Type]
+	if !ok {
+		verb = ev.Type
+	}
+	line := ts.Format("15:04:05") + " "
+	if ev.Agent != "" {
+		line += ev.Agent + " "
+	}
+	if color {
+		line += eventColor(ev.Type) + verb + colorReset
+	} else {
+		line += verb
+	}
+	if len(ev.Fields) > 0 {
+		keys := make([]string, 0, len(ev.Fields))
+		for k := range ev.Fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		details := make([]string, len(keys))
+		for i, k := range keys {
+			details[i] = k + "=" + ev.Fields[k]
+		}
+		line += " (" + strings.Join(details, ", ") + ")"
+	}
+	return line
+}
+
+// useColor reports whether stdout is a terminal and NO_COLOR isn't set.
+func useColor() bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	fi, err := os.Stdout.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+func eventsCmd() *cobra.Command {
+	var raw, security bool
+	cmd := &cobra.Command{
+		Use:   "events",
+		Short: "Stream events from the orchestrator (SSE)",
+		Long: "Stream events from the orchestrator as one-line summaries. If the connection drops,\n" +
+			"events reconnects and resumes after the last event it printed.\n\n" +
+			"With --security only security events are shown (admin auth failures, limit hits,\n" +
+			"blocked service targets), starting with the recent ones the orchestrator kept.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := "/admin/events"
+			if security {
+				path += "?security=true"
+			}
+			color := !raw && useColor()
+			show := func(data string) {
+				if raw {
+					fmt.Println(data)
+					return
+				}
+				var ev events.Event
+				if err := json.Unmarshal([]byte(data), &ev); err != nil {
+					fmt.Println(data)
+					return
+				}
+				fmt.Println(renderEvent(ev, color))
+			}
+
+			var lastID string
+			wait := eventsRetry
+			for {
+				got, dropped, err := streamEvents(path, lastID, func(id, data string) {
+					if id != "" {
+						lastID = id
+					}
+					show(data)
+				})
+				if err != nil {
+					return err
+				}
+				if got {
+					wait = eventsRetry
+				}
+				fmt.Fprintf(cmd.ErrOrStderr(), "%v; reconnecting in %s\n", dropped, wait)
+				time.Sleep(wait)
+				wait = min(wait*2, eventsMaxRetry)
+			}
+		},
+	}
+	cmd.Flags().BoolVar(&raw, "raw", false, "print each event's JSON as received")
+	cmd.Flags().BoolVar(&security, "security", false, "only show security events")
+	return cmd
+}
+
+// streamEvents reads the event stream at path, resuming after lastID if set, and
+// calls fn for each event until the connection drops. got reports whether
+// any event arrived and dropped why the stream ended. err is set instead for
+// responses that retrying won't fix, such as a rejected token.
+func streamEvents(path, lastID string, fn func(id, data string)) (got bool, dropped, err error) {
+	target, err := adminTarget()
+	if err != nil {
+		return false, nil, err
+	}
+	req, err := http.NewRequest(http.MethodGet, target.Admin+path, nil)
+	if err != nil {
+		return false, nil, err
+	}
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	client, err := adminClient(target, req)
+	if err != nil {
+		return false, nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("event stream unavailable: %w", err), nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		b, _ := io.ReadAll(resp.Body)
+		return false, nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(b))
+	}
+
+	var id string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			id = line[4:]
+		case strings.HasPrefix(line, "data: "):
+			fn(id, line[6:])
+			id = ""
+			got = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return got, fmt.Errorf("event stream dropped: %w", err), nil
+	}
+	return got, errors.New("event stream closed by the orchestrator"), nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+func exportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export [file]",
+		Short: "Write the live configuration as an orchestrator.yaml",
+		Long: "Write the orchestrator's live configuration, including agents added through the API\n" +
+			"and the dynamic services registered right now, as an orchestrator.yaml, so ad-hoc\n" +
+			"changes can be kept in the config. Without a file it is written to stdout. It contains\n" +
+			"secrets such as the admin token.",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := apiGet("/admin/export")
+			if err != nil {
+				return err
+			}
+			return writeExport(cmd, args, data, 0o600, "Config")
+		},
+	}
+
+	cmd.AddCommand(
+		exportK8sCmd(),
+	)
+
+	return cmd
+}
+
+func exportK8sCmd() *cobra.Command {
+	var namespace, ingressClass string
+	cmd := &cobra.Command{
+		Use:   "k8s [file]",
+		Short: "Write Kubernetes manifests for the agents",
+		Long: "Write a Deployment, Service and Ingress for each agent run from a container, with the\n" +
+			"image it runs now, its backend port, its hostnames and probes from its health check, to\n" +
+			"bootstrap the same topology in a cluster. Without a file they are written to stdout.\n" +
+			"Agents without a container are left out, and on-demand agents run all the time; a\n" +
+			"comment at the top lists both.",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			q := url.Values{"format": {"k8s"}}
+			if namespace != "" {
+				q.Set("namespace", namespace)
+			}
+			if ingressClass != "" {
+				q.Set("ingress_class", ingressClass)
+			}
+			data, err := apiGet("/admin/export?" + q.Encode())
+			if err != nil {
+				return err
+			}
+			return writeExport(cmd, args, data, 0o644, "Manifests")
+		},
+	}
+	cmd.Flags().StringVar(&namespace, "namespace", "", "namespace to put the objects in")
+	cmd.Flags().StringVar(&ingressClass, "ingress-class", "", "ingressClassName for the Ingresses")
+	return cmd
+}
+
+// writeExport writes data to the file in args, or to stdout without one.
+func writeExport(cmd *cobra.Command, args []string, data []byte, mode fs.FileMode, what string) error {
+	if len(args) == 0 {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(args[0], data, mode); err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.ErrOrStderr(), "%s written to %s\n", what, args[0])
+	return nil
+}
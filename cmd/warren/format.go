@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"warren/internal/human"
+)
+
+// timeLayout is used for absolute timestamps. The zone abbreviation makes
+// it clear whether --utc is in effect.
+const timeLayout = "2006-01-02 15:04:05 MST"
+
+// formatTime renders t in the local timezone, or UTC with --utc.
+func formatTime(t time.Time) string {
+	if utc {
+		return t.UTC().Format(timeLayout)
+	}
+	return t.Local().Format(timeLayout)
+}
+
+// formatAgo renders t relative to now ("5m ago", "in 2h"), for table
+// columns where the exact time matters less than how recent it is.
+func formatAgo(t time.Time) string {
+	return human.Relative(t, time.Now())
+}
+
+// formatWhen renders t absolutely with the relative time alongside.
+func formatWhen(t time.Time) string {
+	return formatTime(t) + " (" + formatAgo(t) + ")"
+}
+
+// formatValue renders a decoded JSON value for inspect output, showing
+// timestamps via formatWhen and everything else as is.
+func formatValue(v any) any {
+	if s, ok := v.(string); ok {
+		if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			return formatWhen(t)
+		}
+	}
+	return v
+}
+
+// listItem is one row of a list command, as printed by -q and -o.
+type listItem struct {
+	name string // what people call it: an agent name or service hostname
+	id   string // what the runtime calls it, falling back to name
+}
+
+// selector returns the field that -q or -o asks list commands to print
+// alone, one per line, or "" for normal output.
+func selector() (string, error) {
+	switch output {
+	case "":
+		if quiet {
+			return "name", nil
+		}
+		return "", nil
+	case "name", "id":
+		return output, nil
+	}
+	return "", fmt.Errorf("invalid --output %q: use name or id", output)
+}
+
+// printSelected prints the sel field of each item on its own line, for
+// piping into xargs.
+func printSelected(sel string, items []listItem) {
+	for _, it := range items {
+		v := it.name
+		if sel == "id" && it.id != "" {
+			v = it.id
+		}
+		fmt.Println(v)
+	}
+}
@@ -0,0 +1,491 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"warren/internal/config"
+	"warren/internal/human"
+)
+
+func importCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import",
+		Short: "Add agents to orchestrator.yaml from other tools' files",
+	}
+
+	cmd.AddCommand(
+		importComposeCmd(),
+		importTraefikCmd(),
+	)
+
+	return cmd
+}
+
+func importComposeCmd() *cobra.Command {
+	var configPath, stack, domain, policy string
+	var dryRun bool
+	cmd := &cobra.Command{
+		Use:   "compose <file>",
+		Short: "Add agents for a Compose file's web services to orchestrator.yaml",
+		Long: "Read a docker-compose.yml and add an agent to orchestrator.yaml for each service that\n" +
+			"exposes an HTTP port. Hostnames come from Traefik Host rules in the service's labels,\n" +
+			"or <service>.<domain> with --domain; health URLs and intervals come from healthchecks\n" +
+			"that probe a URL. Services are assumed to be deployed as a Swarm stack, so the\n" +
+			"container is <stack>_<service>, reached at tasks.<stack>_<service>. Agents already in\n" +
+			"the config are left alone. The config is created if it doesn't exist, and comments in\n" +
+			"an existing one are kept.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := os.ReadFile(args[0])
+			if err != nil {
+				return err
+			}
+			var compose composeImport
+			if err := yaml.Unmarshal(data, &compose); err != nil {
+				return fmt.Errorf("parse %s: %w", args[0], err)
+			}
+			if stack == "" {
+				stack = compose.Name
+			}
+			if stack == "" {
+				abs, _ := filepath.Abs(args[0])
+				stack = filepath.Base(filepath.Dir(abs))
+			}
+
+			doc, existing, err := readConfigDoc(configPath)
+			if err != nil {
+				return err
+			}
+			agents, skipped := composeAgents(compose, stack, domain, policy, existing)
+			for _, s := range skipped {
+				fmt.Fprintln(cmd.ErrOrStderr(), "Skipped "+s)
+			}
+			if len(agents) == 0 {
+				fmt.Println("No agents to import.")
+				return nil
+			}
+
+			out, err := mergeAgents(doc, agents)
+			if err != nil {
+				return err
+			}
+			if _, err := config.Parse(out, config.DefaultLimits); err != nil {
+				return fmt.Errorf("imported config is invalid: %w", err)
+			}
+			if dryRun {
+				_, err := os.Stdout.Write(out)
+				return err
+			}
+			if err := writeConfigFile(configPath, out); err != nil {
+				return err
+			}
+			for _, name := range sortedNames(agents) {
+				a := agents[name]
+				fmt.Printf("Added agent %s (%s → %s, %s)\n", name, a.Hostname, a.Backend, a.Policy)
+			}
+			fmt.Printf("Wrote %s\n", configPath)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&configPath, "config", "orchestrator.yaml", "config file to add the agents to")
+	cmd.Flags().StringVar(&stack, "stack", "", "Swarm stack name (default: the Compose project name or the file's directory)")
+	cmd.Flags().StringVar(&domain, "domain", "", "give services without a Host rule <service>.<domain>")
+	cmd.Flags().StringVar(&policy, "policy", "on-demand", "policy for services with a healthcheck URL; others are unmanaged")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "print the resulting config instead of writing it")
+	return cmd
+}
+
+// importedAgent is an agent as written by warren import: only the fields
+// that were inferred, so the defaults still apply to the rest.
+type importedAgent struct {
+	Hostname   string        `yaml:"hostname"`
+	Hostnames  []string      `yaml:"hostnames,omitempty"`
+	Backend    string        `yaml:"backend"`
+	Replicas   []string      `yaml:"replicas,omitempty"`
+	Policy     string        `yaml:"policy"`
+	ForceHTTPS bool          `yaml:"force_https,omitempty"`
+	BasicAuth  *importedAuth `yaml:"basic_auth,omitempty"`
+	Container  struct {
+		Name string `yaml:"name"`
+	} `yaml:"container,omitempty"`
+	Health *importedHealth `yaml:"health,omitempty"`
+}
+
+type importedAuth struct {
+	Realm             string   `yaml:"realm,omitempty"`
+	Users             []string `yaml:"users,omitempty"`
+	UsersFile         string   `yaml:"users_file,omitempty"`
+	ReplaceProxyToken bool     `yaml:"replace_proxy_token,omitempty"`
+}
+
+type importedHealth struct {
+	URL            string `yaml:"url"`
+	CheckInterval  string `yaml:"check_interval,omitempty"`
+	StartupTimeout string `yaml:"startup_timeout,omitempty"`
+	MaxFailures    int    `yaml:"max_failures,omitempty"`
+}
+
+// composeImport is the part of the Compose schema warren import reads.
+type composeImport struct {
+	Name     string                   `yaml:"name"`
+	Services map[string]composeSource `yaml:"services"`
+}
+
+type composeSource struct {
+	Ports       []composePort `yaml:"ports"`
+	Expose      []string      `yaml:"expose"`
+	Labels      composeLabels `yaml:"labels"`
+	Healthcheck *composeProbe `yaml:"healthcheck"`
+	Deploy      struct {
+		Labels composeLabels `yaml:"labels"` // where Swarm stacks put Traefik labels
+	} `yaml:"deploy"`
+}
+
+type composeProbe struct {
+	Test        composeCommand `yaml:"test"`
+	Interval    string         `yaml:"interval"`
+	StartPeriod string         `yaml:"start_period"`
+	Retries     int            `yaml:"retries"`
+	Disable     bool           `yaml:"disable"`
+}
+
+// composePort is a container port from either the short ("8080:80/tcp")
+// or the long (target/published/protocol) port syntax.
+type composePort struct {
+	Target   int
+	Protocol string
+}
+
+func (p *composePort) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.MappingNode {
+		var long struct {
+			Target   int    `yaml:"target"`
+			Protocol string `yaml:"protocol"`
+		}
+		if err := n.Decode(&long); err != nil {
+			return err
+		}
+		p.Target, p.Protocol = long.Target, long.Protocol
+		return nil
+	}
+	spec, proto, _ := strings.Cut(n.Value, "/")
+	// The container port comes last: "80", "8080:80", "127.0.0.1:8080:80".
+	spec = spec[strings.LastIndex(spec, ":")+1:]
+	// A range maps several ports; the first is taken.
+	spec, _, _ = strings.Cut(spec, "-")
+	port, err := strconv.Atoi(spec)
+	if err != nil {
+		return fmt.Errorf("port %q: %w", n.Value, err)
+	}
+	p.Target, p.Protocol = port, proto
+	return nil
+}
+
+// composeLabels accepts labels as a map or as a list of "key=value".
+type composeLabels map[string]string
+
+func (l *composeLabels) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.MappingNode {
+		m := map[string]string{}
+		if err := n.Decode(&m); err != nil {
+			return err
+		}
+		*l = m
+		return nil
+	}
+	var list []string
+	if err := n.Decode(&list); err != nil {
+		return err
+	}
+	*l = make(composeLabels, len(list))
+	for _, kv := range list {
+		k, v, _ := strings.Cut(kv, "=")
+		(*l)[k] = v
+	}
+	return nil
+}
+
+// composeCommand is a healthcheck test, either a string or an exec list;
+// only the words matter here.
+type composeCommand string
+
+func (c *composeCommand) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.SequenceNode {
+		var list []string
+		if err := n.Decode(&list); err != nil {
+			return err
+		}
+		*c = composeCommand(strings.Join(list, " "))
+		return nil
+	}
+	*c = composeCommand(n.Value)
+	return nil
+}
+
+// nonHTTPPorts are well-known ports of databases, queues and the like, which
+// are never taken for an agent's HTTP port.
+var nonHTTPPorts = map[int]bool{
+	22: true, 25: true, 53: true, 587: true, 1433: true, 1521: true, 2181: true,
+	3306: true, 4222: true, 5432: true, 5672: true, 6222: true, 6379: true,
+	9042: true, 9092: true, 11211: true, 27017: true,
+}
+
+var (
+	hostRule  = regexp.MustCompile(`Host\(([^)]*)\)`)
+	ruleValue = regexp.MustCompile("[`\"]([^`\"]+)[`\"]")
+	probeURL  = regexp.MustCompile(`https?://[^\s'"]+`)
+)
+
+// composeAgents maps compose's web services to agents, leaving out those
+// that clash with existing agents, and says why each other service was
+// skipped.
+func composeAgents(compose composeImport, stack, domain, policy string, existing *config.Config) (map[string]importedAgent, []string) {
+	routed := make(map[string]string) // hostname → agent
+	for name, a := range existing.Agents {
+		routed[a.Hostname] = name
+		for _, h := range a.Hostnames {
+			routed[h] = name
+		}
+	}
+
+	agents := make(map[string]importedAgent)
+	var skipped []string
+	for _, svcName := range sortedNames(compose.Services) {
+		svc := compose.Services[svcName]
+		labels := make(map[string]string)
+		for k, v := range svc.Labels {
+			labels[k] = v
+		}
+		for k, v := range svc.Deploy.Labels {
+			labels[k] = v
+		}
+
+		name := svcName
+		if l := labels["orchestrator.agent"]; l != "" {
+			name = l
+		}
+		if _, ok := existing.Agents[name]; ok {
+			skipped = append(skipped, fmt.Sprintf("%s: agent %q is already in the config", svcName, name))
+			continue
+		}
+		port := httpPort(svc, labels)
+		if port == 0 {
+			skipped = append(skipped, svcName+": no HTTP port")
+			continue
+		}
+		hostnames := ruleHostnames(labels)
+		if len(hostnames) == 0 && domain != "" {
+			hostnames = []string{svcName + "." + domain}
+		}
+		if len(hostnames) == 0 {
+			skipped = append(skipped, svcName+": no hostname; add a Traefik Host rule label or pass --domain")
+			continue
+		}
+		clash := ""
+		for _, h := range hostnames {
+			if owner, ok := routed[h]; ok {
+				clash = fmt.Sprintf("%s: %s is already routed to agent %q", svcName, h, owner)
+				break
+			}
+		}
+		if clash != "" {
+			skipped = append(skipped, clash)
+			continue
+		}
+
+		container := stack + "_" + svcName
+		a := importedAgent{
+			Hostname:  hostnames[0],
+			Hostnames: hostnames[1:],
+			Backend:   fmt.Sprintf("http://tasks.%s:%d", container, port),
+			Policy:    "unmanaged",
+		}
+		a.Container.Name = container
+		if h := composeHealth(svc.Healthcheck, container); h != nil {
+			a.Health = h
+			a.Policy = policy
+		}
+		for _, h := range hostnames {
+			routed[h] = name
+		}
+		agents[name] = a
+	}
+	return agents, skipped
+}
+
+// httpPort picks the service's HTTP port: the one Traefik is told to use,
+// else the first TCP port published or exposed that isn't a well-known
+// non-HTTP port.
+func httpPort(svc composeSource, labels map[string]string) int {
+	for _, k := range sortedNames(labels) {
+		if strings.HasPrefix(k, "traefik.http.services.") && strings.HasSuffix(k, ".loadbalancer.server.port") {
+			if port, err := strconv.Atoi(labels[k]); err == nil {
+				return port
+			}
+		}
+	}
+	ports := svc.Ports
+	for _, e := range svc.Expose {
+		var p composePort
+		if err := p.UnmarshalYAML(&yaml.Node{Kind: yaml.ScalarNode, Value: e}); err == nil {
+			ports = append(ports, p)
+		}
+	}
+	for _, p := range ports {
+		if (p.Protocol == "" || p.Protocol == "tcp") && !nonHTTPPorts[p.Target] {
+			return p.Target
+		}
+	}
+	return 0
+}
+
+// ruleHostnames returns the hostnames in Traefik router Host rules.
+func ruleHostnames(labels map[string]string) []string {
+	var hostnames []string
+	seen := make(map[string]bool)
+	for _, k := range sortedNames(labels) {
+		if !strings.HasPrefix(k, "traefik.http.routers.") || !strings.HasSuffix(k, ".rule") {
+			continue
+		}
+		for _, m := range hostRule.FindAllStringSubmatch(labels[k], -1) {
+			for _, v := range ruleValue.FindAllStringSubmatch(m[1], -1) {
+				if !seen[v[1]] {
+					seen[v[1]] = true
+					hostnames = append(hostnames, v[1])
+				}
+			}
+		}
+	}
+	return hostnames
+}
+
+// composeHealth turns a healthcheck that probes a URL into the agent's
+// health settings, pointed at the container from Warren's side.
+func composeHealth(probe *composeProbe, container string) *importedHealth {
+	if probe == nil || probe.Disable {
+		return nil
+	}
+	raw := probeURL.FindString(string(probe.Test))
+	if raw == "" {
+		return nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil
+	}
+	port := u.Port()
+	u.Host = "tasks." + container
+	if port != "" {
+		u.Host += ":" + port
+	}
+	h := &importedHealth{URL: u.String(), MaxFailures: probe.Retries}
+	if d, err := human.ParseDuration(probe.Interval); err == nil && d > 0 {
+		h.CheckInterval = human.FormatDuration(d)
+	}
+	if d, err := human.ParseDuration(probe.StartPeriod); err == nil && d > 0 {
+		h.StartupTimeout = human.FormatDuration(d)
+	}
+	return h
+}
+
+// readConfigDoc reads the config at path as a YAML tree, so agents can be
+// added without losing its comments, along with its decoded form. A
+// missing file is an empty config.
+func readConfigDoc(path string) (*yaml.Node, *config.Config, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}, &config.Config{}, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg, err := config.Decode(data, config.DefaultLimits)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	return &doc, cfg, nil
+}
+
+// mergeAgents adds agents to the config tree's agents section, in name
+// order, and renders the result.
+func mergeAgents(doc *yaml.Node, agents map[string]importedAgent) ([]byte, error) {
+	if err := addEntries(doc, "agents", agents); err != nil {
+		return nil, err
+	}
+	return renderDoc(doc)
+}
+
+// addEntries adds entries to the config tree's top-level section key, in
+// name order, creating the section if needed.
+func addEntries[V any](doc *yaml.Node, key string, entries map[string]V) error {
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("config is not a YAML mapping")
+	}
+	var section *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == key {
+			section = root.Content[i+1]
+		}
+	}
+	if section == nil || section.Kind != yaml.MappingNode {
+		if section == nil {
+			section = &yaml.Node{Kind: yaml.MappingNode}
+			root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, section)
+		} else {
+			// "agents:" with nothing under it.
+			*section = yaml.Node{Kind: yaml.MappingNode}
+		}
+	}
+	section.Style = 0 // "agents: {}" becomes a block
+	for _, name := range sortedNames(entries) {
+		var value yaml.Node
+		if err := value.Encode(entries[name]); err != nil {
+			return err
+		}
+		section.Content = append(section.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: name}, &value)
+	}
+	return nil
+}
+
+// renderDoc renders the config tree the way warren import writes it.
+func renderDoc(doc *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeConfigFile replaces the config at path, keeping its permissions.
+func writeConfigFile(path string, data []byte) error {
+	mode := fs.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	return os.WriteFile(path, data, mode)
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"warren/internal/auth"
+	"warren/internal/config"
+	"warren/internal/human"
+)
+
+func importTraefikCmd() *cobra.Command {
+	var file, configPath string
+	var dryRun bool
+	cmd := &cobra.Command{
+		Use:   "traefik -f <file>",
+		Short: "Add agents and services for a Traefik dynamic config's routers to orchestrator.yaml",
+		Long: "Read a Traefik file-provider dynamic config and add each HTTP router with a Host rule\n" +
+			"to orchestrator.yaml. Routers whose service has a health check become unmanaged agents,\n" +
+			"checked the way Traefik checked them; the rest become dynamic services. A load\n" +
+			"balancer's first server is the backend and the others replicas. The redirectScheme\n" +
+			"(to https) and basicAuth middlewares are carried over; other middlewares, rule matchers\n" +
+			"besides Host, and TCP and UDP routers are reported and left out. Routers clashing with\n" +
+			"agents or services already in the config are skipped. Comments in the config are kept.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if file == "" {
+				return fmt.Errorf("-f is required")
+			}
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			var dynamic traefikDynamic
+			if err := yaml.Unmarshal(data, &dynamic); err != nil {
+				return fmt.Errorf("parse %s: %w", file, err)
+			}
+
+			doc, existing, err := readConfigDoc(configPath)
+			if err != nil {
+				return err
+			}
+			imp := traefikImport(dynamic, existing)
+			for _, s := range imp.skipped {
+				fmt.Fprintln(cmd.ErrOrStderr(), "Skipped "+s)
+			}
+			for _, w := range imp.warnings {
+				fmt.Fprintln(cmd.ErrOrStderr(), "Warning: "+w)
+			}
+			if len(imp.agents) == 0 && len(imp.services) == 0 {
+				fmt.Println("Nothing to import.")
+				return nil
+			}
+
+			if err := addEntries(doc, "agents", imp.agents); err != nil {
+				return err
+			}
+			if err := addEntries(doc, "services", imp.services); err != nil {
+				return err
+			}
+			out, err := renderDoc(doc)
+			if err != nil {
+				return err
+			}
+			if _, err := config.Parse(out, config.DefaultLimits); err != nil {
+				return fmt.Errorf("imported config is invalid: %w", err)
+			}
+			if dryRun {
+				_, err := os.Stdout.Write(out)
+				return err
+			}
+			if err := writeConfigFile(configPath, out); err != nil {
+				return err
+			}
+			for _, name := range sortedNames(imp.agents) {
+				a := imp.agents[name]
+				fmt.Printf("Added agent %s (%s → %s, %s)\n", name, a.Hostname, a.Backend, a.Policy)
+			}
+			for _, hostname := range sortedNames(imp.services) {
+				fmt.Printf("Added service %s → %s\n", hostname, imp.services[hostname].Target)
+			}
+			fmt.Printf("Wrote %s\n", configPath)
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&file, "file", "f", "", "Traefik dynamic config file, e.g. dynamic.yml")
+	cmd.Flags().StringVar(&configPath, "config", "orchestrator.yaml", "config file to add the agents and services to")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "print the resulting config instead of writing it")
+	return cmd
+}
+
+// traefikDynamic is the part of Traefik's dynamic configuration warren
+// import reads.
+type traefikDynamic struct {
+	HTTP struct {
+		Routers     map[string]traefikRouter        `yaml:"routers"`
+		Services    map[string]traefikService       `yaml:"services"`
+		Middlewares map[string]map[string]yaml.Node `yaml:"middlewares"` // name → kind → settings
+	} `yaml:"http"`
+	TCP map[string]any `yaml:"tcp"`
+	UDP map[string]any `yaml:"udp"`
+}
+
+type traefikRouter struct {
+	Rule        string   `yaml:"rule"`
+	Service     string   `yaml:"service"`
+	Middlewares []string `yaml:"middlewares"`
+}
+
+type traefikService struct {
+	LoadBalancer *struct {
+		Servers []struct {
+			URL string `yaml:"url"`
+		} `yaml:"servers"`
+		HealthCheck *struct {
+			Path     string `yaml:"path"`
+			Port     int    `yaml:"port"`
+			Scheme   string `yaml:"scheme"`
+			Interval string `yaml:"interval"`
+		} `yaml:"healthCheck"`
+	} `yaml:"loadBalancer"`
+}
+
+// traefikBasicAuth is the part of Traefik's basicAuth middleware warren
+// import reads.
+type traefikBasicAuth struct {
+	Users     []string `yaml:"users"`
+	UsersFile string   `yaml:"usersFile"`
+	Realm     string   `yaml:"realm"`
+}
+
+// importedService is a dynamic service as written by warren import.
+type importedService struct {
+	Target    string        `yaml:"target"`
+	Replicas  []string      `yaml:"replicas,omitempty"`
+	BasicAuth *importedAuth `yaml:"basic_auth,omitempty"`
+}
+
+// traefikResult is what a Traefik config maps to, with what was skipped or
+// only partly carried over.
+type traefikResult struct {
+	agents   map[string]importedAgent
+	services map[string]importedService
+	skipped  []string
+	warnings []string
+}
+
+// otherMatcher finds rule matchers besides Host, such as PathPrefix.
+var otherMatcher = regexp.MustCompile(`\b([A-Z][A-Za-z]*)\(`)
+
+// traefikImport maps the routers in dynamic to agents and services,
+// leaving out those that clash with existing agents and services.
+func traefikImport(dynamic traefikDynamic, existing *config.Config) traefikResult {
+	res := traefikResult{agents: make(map[string]importedAgent), services: make(map[string]importedService)}
+	routed := make(map[string]string) // hostname → what routes it
+	for name, a := range existing.Agents {
+		for _, h := range append([]string{a.Hostname}, a.Hostnames...) {
+			routed[h] = fmt.Sprintf("agent %q", name)
+		}
+	}
+	for hostname := range existing.Services {
+		routed[hostname] = "a service"
+	}
+	if len(dynamic.TCP) > 0 {
+		res.skipped = append(res.skipped, "tcp: TCP routers aren't imported; see agent ports and tls_passthrough")
+	}
+	if len(dynamic.UDP) > 0 {
+		res.skipped = append(res.skipped, "udp: UDP routers aren't imported; see agent ports")
+	}
+
+	for _, routerName := range sortedNames(dynamic.HTTP.Routers) {
+		router := dynamic.HTTP.Routers[routerName]
+		name := stripProvider(routerName)
+		hostnames := ruleHostnames(map[string]string{"traefik.http.routers." + name + ".rule": router.Rule})
+		if len(hostnames) == 0 {
+			res.skipped = append(res.skipped, name+": no Host rule")
+			continue
+		}
+		for _, m := range otherMatcher.FindAllStringSubmatch(router.Rule, -1) {
+			if m[1] != "Host" {
+				res.warnings = append(res.warnings, fmt.Sprintf("%s: %s in the rule isn't supported; all of %s is routed", name, m[1], hostnames[0]))
+			}
+		}
+		if _, ok := existing.Agents[name]; ok {
+			res.skipped = append(res.skipped, fmt.Sprintf("%s: agent %q is already in the config", name, name))
+			continue
+		}
+		clash := ""
+		for _, h := range hostnames {
+			if owner, ok := routed[h]; ok {
+				clash = fmt.Sprintf("%s: %s is already routed to %s", name, h, owner)
+				break
+			}
+		}
+		if clash != "" {
+			res.skipped = append(res.skipped, clash)
+			continue
+		}
+
+		svcName := router.Service
+		if svcName == "" {
+			svcName = name
+		}
+		svc, ok := dynamic.HTTP.Services[svcName]
+		if !ok {
+			svc, ok = dynamic.HTTP.Services[stripProvider(svcName)]
+		}
+		if !ok || svc.LoadBalancer == nil || len(svc.LoadBalancer.Servers) == 0 {
+			res.skipped = append(res.skipped, fmt.Sprintf("%s: service %q isn't a load balancer with servers in the file", name, svcName))
+			continue
+		}
+		var targets []string
+		for _, s := range svc.LoadBalancer.Servers {
+			targets = append(targets, s.URL)
+		}
+
+		var forceHTTPS bool
+		var auth *importedAuth
+		for _, mw := range router.Middlewares {
+			kinds, ok := dynamic.HTTP.Middlewares[stripProvider(mw)]
+			if !ok {
+				res.warnings = append(res.warnings, fmt.Sprintf("%s: middleware %q isn't in the file; left out", name, mw))
+				continue
+			}
+			for _, kind := range sortedNames(kinds) {
+				settings := kinds[kind]
+				switch kind {
+				case "redirectScheme":
+					var rs struct {
+						Scheme string `yaml:"scheme"`
+					}
+					_ = settings.Decode(&rs)
+					if rs.Scheme == "https" {
+						forceHTTPS = true
+						continue
+					}
+				case "basicAuth":
+					var ba traefikBasicAuth
+					_ = settings.Decode(&ba)
+					if reason := basicAuthUnsupported(ba); reason != "" {
+						res.warnings = append(res.warnings, fmt.Sprintf("%s: middleware %q %s; left out", name, mw, reason))
+						continue
+					}
+					// Traefik's basic auth was the only gate, so it keeps that
+					// role under a proxy token.
+					auth = &importedAuth{Realm: ba.Realm, Users: ba.Users, UsersFile: ba.UsersFile, ReplaceProxyToken: existing.ProxyToken != ""}
+					continue
+				}
+				res.warnings = append(res.warnings, fmt.Sprintf("%s: middleware %q (%s) isn't supported; left out", name, mw, kind))
+			}
+		}
+
+		for _, h := range hostnames {
+			routed[h] = fmt.Sprintf("router %q", name)
+		}
+		hc := svc.LoadBalancer.HealthCheck
+		if hc == nil {
+			if forceHTTPS {
+				res.warnings = append(res.warnings, name+": services can't force HTTPS; redirectScheme left out")
+			}
+			// Services are routed by hostname, so each gets its own.
+			for _, h := range hostnames {
+				res.services[h] = importedService{Target: targets[0], Replicas: targets[1:], BasicAuth: auth}
+			}
+			continue
+		}
+
+		a := importedAgent{
+			Hostname:   hostnames[0],
+			Hostnames:  hostnames[1:],
+			Backend:    targets[0],
+			Replicas:   targets[1:],
+			Policy:     "unmanaged",
+			ForceHTTPS: forceHTTPS,
+			BasicAuth:  auth,
+		}
+		if u, err := url.Parse(targets[0]); err == nil {
+			if hc.Scheme != "" {
+				u.Scheme = hc.Scheme
+			}
+			if hc.Port != 0 {
+				u.Host = u.Hostname() + ":" + strconv.Itoa(hc.Port)
+			}
+			u.Path = hc.Path
+			a.Health = &importedHealth{URL: u.String()}
+			if d, err := human.ParseDuration(hc.Interval); err == nil && d > 0 {
+				a.Health.CheckInterval = human.FormatDuration(d)
+			}
+		}
+		res.agents[name] = a
+	}
+	return res
+}
+
+// stripProvider drops a Traefik provider suffix, e.g. "auth@file".
+func stripProvider(name string) string {
+	name, _, _ = strings.Cut(name, "@")
+	return name
+}
+
+// bcryptOnly reports whether every htpasswd entry has a bcrypt hash, the
+// only kind Warren's basic_auth checks.
+// basicAuthUnsupported says why Warren can't take over ba, or returns ""
+// if it can.
+func basicAuthUnsupported(ba traefikBasicAuth) string {
+	users := ba.Users
+	if ba.UsersFile != "" {
+		lines, err := auth.LoadHtpasswd(ba.UsersFile)
+		if err != nil {
+			return fmt.Sprintf("has a users file Warren can't read (%v)", err)
+		}
+		for _, l := range lines {
+			if l = strings.TrimSpace(l); l != "" && !strings.HasPrefix(l, "#") {
+				users = append(users, l)
+			}
+		}
+	}
+	if len(users) == 0 {
+		return "has no users"
+	}
+	if !bcryptOnly(users) {
+		return "has non-bcrypt passwords, which Warren can't check"
+	}
+	return ""
+}
+
+func bcryptOnly(users []string) bool {
+	for _, u := range users {
+		_, hash, _ := strings.Cut(u, ":")
+		if !strings.HasPrefix(hash, "$2a$") && !strings.HasPrefix(hash, "$2b$") && !strings.HasPrefix(hash, "$2y$") {
+			return false
+		}
+	}
+	return true
+}
@@ -3,24 +3,32 @@ package main
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"text/tabwriter"
 	"time"
 
 	"github.com/spf13/cobra"
-	"gopkg.in/yaml.v3"
 
-	"warren/internal/config"
+	"warren/internal/human"
+	"warren/internal/revisions"
+	"warren/internal/validate"
 )
 
 var (
 	adminURL string
 	format   string
+	utc      bool
+	quiet    bool
+	output   string
 )
 
 func main() {
@@ -30,7 +38,11 @@ func main() {
 	}
 
 	root.PersistentFlags().StringVar(&adminURL, "admin", "", "admin API URL (default http://localhost:9090)")
+	root.PersistentFlags().StringVar(&contextName, "context", "", "context from ~/.warren/config.yaml to use (default: current_context)")
 	root.PersistentFlags().StringVar(&format, "format", "table", "output format: table or json")
+	root.PersistentFlags().BoolVar(&utc, "utc", false, "show timestamps in UTC instead of the local timezone")
+	root.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "list commands print only names, one per line")
+	root.PersistentFlags().StringVarP(&output, "output", "o", "", "list commands print only this field, one per line: name or id")
 
 	// Agent commands
 	agentCmd := &cobra.Command{Use: "agent", Short: "Manage agents"}
@@ -39,10 +51,17 @@ func main() {
 		agentListCmd(),
 		agentAddCmd(),
 		agentRemoveCmd(),
+		agentRestoreCmd(),
+		agentHistoryCmd(),
+		agentRollbackCmd(),
 		agentInspectCmd(),
+		agentCheckCmd(),
 		agentWakeCmd(),
 		agentSleepCmd(),
 		agentLogsCmd(),
+		agentExportCmd(),
+		agentAnnotateCmd(),
+		agentUpdateCmd(),
 	)
 
 	// Service commands
@@ -50,17 +69,32 @@ func main() {
 	serviceCmd.AddCommand(
 		serviceListCmd(),
 		serviceAddCmd(),
+		serviceUpdateCmd(),
 		serviceRemoveCmd(),
+		serviceRestoreCmd(),
+		serviceHistoryCmd(),
 	)
 
 	root.AddCommand(
 		agentCmd,
 		serviceCmd,
 		swarmCmd(),
+		openclawCmd(),
 		statusCmd(),
+		trashCmd(),
+		bansCmd(),
 		reloadCmd(),
+		upgradeCmd(),
+		backupCmd(),
+		exportCmd(),
+		restoreCmd(),
+		applyCmd(),
+		importCmd(),
 		eventsCmd(),
-		configValidateCmd(),
+		configCmd(),
+		contextCmd(),
+		doctorCmd(),
+		topCmd(),
 		initCmd(),
 		scaffoldCmd(),
 		deployCmd(),
@@ -68,42 +102,25 @@ func main() {
 	)
 
 	if err := root.Execute(); err != nil {
+		var code exitCode
+		if errors.As(err, &code) {
+			os.Exit(int(code))
+		}
 		os.Exit(1)
 	}
 }
 
+// getAdminURL returns the admin API URL; see adminTarget.
 func getAdminURL() string {
-	if adminURL != "" {
-		return adminURL
-	}
-	if v := os.Getenv("WARREN_ADMIN"); v != "" {
-		return v
-	}
-	// Try config file.
-	home, _ := os.UserHomeDir()
-	data, err := os.ReadFile(home + "/.warren/config.yaml")
-	if err == nil {
-		var cfg struct {
-			Admin string `yaml:"admin"`
-		}
-		if yaml.Unmarshal(data, &cfg) == nil && cfg.Admin != "" {
-			return cfg.Admin
-		}
+	target, err := adminTarget()
+	if err != nil {
+		return "http://localhost:9090"
 	}
-	return "http://localhost:9090"
+	return target.Admin
 }
 
 func apiGet(path string) ([]byte, error) {
-	resp, err := http.Get(getAdminURL() + path)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
-	}
-	return body, nil
+	return apiDo(http.MethodGet, path, nil)
 }
 
 func apiPost(path string, payload any) ([]byte, error) {
@@ -112,65 +129,231 @@ func apiPost(path string, payload any) ([]byte, error) {
 		data, _ := json.Marshal(payload)
 		body = strings.NewReader(string(data))
 	}
-	resp, err := http.Post(getAdminURL()+path, "application/json", body)
+	return apiDo(http.MethodPost, path, body)
+}
+
+func apiPut(path string, payload any) ([]byte, error) {
+	data, _ := json.Marshal(payload)
+	return apiDo(http.MethodPut, path, strings.NewReader(string(data)))
+}
+
+func apiPatch(path string, payload any) ([]byte, error) {
+	data, _ := json.Marshal(payload)
+	return apiDo(http.MethodPatch, path, strings.NewReader(string(data)))
+}
+
+func apiDelete(path string) ([]byte, error) {
+	return apiDo(http.MethodDelete, path, nil)
+}
+
+// apiDo sends a request to the admin API, identifying the caller so changes
+// are attributed in the revision history.
+func apiDo(method, path string, body io.Reader) ([]byte, error) {
+	target, err := adminTarget()
+	if err != nil {
+		return nil, err
+	}
+	endpoint := target.Admin + path
+	req, err := http.NewRequest(method, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	client, err := adminClient(target, req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 	b, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusUnprocessableEntity {
+		if err := fieldErrors(b); err != nil {
+			return nil, err
+		}
+	}
 	if resp.StatusCode >= 400 {
 		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(b))
 	}
 	return b, nil
 }
 
-func apiDelete(path string) ([]byte, error) {
-	req, _ := http.NewRequest(http.MethodDelete, getAdminURL()+path, nil)
-	resp, err := http.DefaultClient.Do(req)
+// fieldErrors renders a 422 validation response as one line per field, or
+// returns nil if the body isn't one.
+func fieldErrors(body []byte) error {
+	var resp validate.Response
+	if json.Unmarshal(body, &resp) != nil || len(resp.Fields) == 0 {
+		return nil
+	}
+	var b strings.Builder
+	b.WriteString(resp.Error + ":")
+	for _, f := range resp.Fields {
+		if f.Field == "" {
+			fmt.Fprintf(&b, "\n  %s", f.Message)
+		} else {
+			fmt.Fprintf(&b, "\n  %s: %s", f.Field, f.Message)
+		}
+	}
+	return errors.New(b.String())
+}
+
+// addDestructiveFlags registers the flags shared by destructive commands:
+// --yes skips the confirmation prompt, --force also overrides the server's
+// refusal to remove something that still has active connections.
+func addDestructiveFlags(cmd *cobra.Command, yes, force *bool) {
+	cmd.Flags().BoolVarP(yes, "yes", "y", false, "skip the confirmation prompt")
+	cmd.Flags().BoolVar(force, "force", false, "remove even with active connections (implies --yes)")
+}
+
+// confirm asks a y/N question on stdin. It returns true without asking if
+// skip is set.
+func confirm(prompt string, skip bool) bool {
+	if skip {
+		return true
+	}
+	fmt.Printf("%s [y/N]: ", prompt)
+	reader := bufio.NewReader(os.Stdin)
+	answer, _ := reader.ReadString('\n')
+	return strings.TrimSpace(strings.ToLower(answer)) == "y"
+}
+
+// connectionsNote fetches the resource at path and, if it reports active
+// connections, returns a sentence to append to a confirmation prompt.
+func connectionsNote(path string) string {
+	data, err := apiGet(path)
 	if err != nil {
-		return nil, err
+		return ""
 	}
-	defer resp.Body.Close()
-	b, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(b))
+	var resp struct {
+		Connections int64 `json:"connections"`
 	}
-	return b, nil
+	if json.Unmarshal(data, &resp) != nil || resp.Connections == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" It has %d active connection(s), which will be dropped.", resp.Connections)
+}
+
+// removePath adds force=true to a DELETE path when forcing.
+func removePath(path string, force bool) string {
+	if force {
+		return path + "?force=true"
+	}
+	return path
 }
 
 func agentListCmd() *cobra.Command {
-	return &cobra.Command{
+	var stateFilter, labelSelector string
+	var cached, wide bool
+	cmd := &cobra.Command{
 		Use:   "list",
 		Short: "List all agents",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			data, err := apiGet("/admin/agents")
+			sel, err := selector()
 			if err != nil {
 				return err
 			}
-			if format == "json" {
+			path := "/admin/agents"
+			if labelSelector != "" {
+				path += "?selector=" + url.QueryEscape(labelSelector)
+			}
+			var data []byte
+			if cached {
+				var at time.Time
+				if data, at, err = cachedGet(path); err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.ErrOrStderr(), "Showing cached state from %s; the admin API was not contacted.\n", formatWhen(at))
+			} else if data, err = apiGet(path); err != nil {
+				return err
+			} else {
+				saveCache(path, data)
+			}
+			if stateFilter != "" {
+				if data, err = filterByState(data, stateFilter); err != nil {
+					return err
+				}
+			}
+			if format == "json" && sel == "" {
 				fmt.Println(string(data))
 				return nil
 			}
 			var agents []struct {
-				Name        string `json:"name"`
-				Hostname    string `json:"hostname"`
-				Policy      string `json:"policy"`
-				State       string `json:"state"`
-				Connections int64  `json:"connections"`
+				Name        string     `json:"name"`
+				Hostname    string     `json:"hostname"`
+				Policy      string     `json:"policy"`
+				State       string     `json:"state"`
+				Connections int64      `json:"connections"`
+				HeldUntil   *time.Time `json:"held_until"`
+				TaskID      string     `json:"task_id"`
+				SessionID   string     `json:"session_id"`
+				DNSMismatch []string   `json:"dns_mismatch"`
+				Annotations map[string]string `json:"annotations"`
+				Labels      map[string]string `json:"labels"`
 			}
 			_ = json.Unmarshal(data, &agents)
+			if sel != "" {
+				items := make([]listItem, len(agents))
+				for i, a := range agents {
+					items[i] = listItem{name: a.Name, id: a.SessionID}
+					if a.TaskID != "" {
+						items[i].id = a.TaskID
+					}
+				}
+				printSelected(sel, items)
+				return nil
+			}
 			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-			fmt.Fprintln(w, "NAME\tHOSTNAME\tPOLICY\tSTATE\tCONNECTIONS")
+			header := "NAME\tHOSTNAME\tPOLICY\tSTATE\tCONNECTIONS"
+			if wide {
+				header += "\tLABELS\tANNOTATIONS"
+			}
+			fmt.Fprintln(w, header)
 			for _, a := range agents {
-				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\n", a.Name, a.Hostname, a.Policy, a.State, a.Connections)
+				state := a.State
+				if a.HeldUntil != nil && time.Now().Before(*a.HeldUntil) {
+					state += " (held)"
+				}
+				if len(a.DNSMismatch) > 0 {
+					state += " (dns mismatch)"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d", a.Name, a.Hostname, a.Policy, state, a.Connections)
+				if wide {
+					fmt.Fprintf(w, "\t%s\t%s", formatAnnotations(a.Labels), formatAnnotations(a.Annotations))
+				}
+				fmt.Fprintln(w)
 			}
 			return w.Flush()
 		},
 	}
+	cmd.Flags().StringVar(&stateFilter, "state", "", "only list agents in this state, e.g. ready, sleeping or degraded")
+	cmd.Flags().BoolVar(&cached, "cached", false, "show the last successful response instead of contacting the admin API")
+	cmd.Flags().StringVarP(&labelSelector, "selector", "l", "", "only list agents whose labels match, e.g. env=staging,team!=infra")
+	cmd.Flags().BoolVar(&wide, "wide", false, "also show each agent's labels and annotations")
+	return watchable(cmd)
+}
+
+// filterByState keeps the entries of a JSON list whose "state" is state.
+func filterByState(data []byte, state string) ([]byte, error) {
+	var all []map[string]any
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, fmt.Errorf("parse agents: %w", err)
+	}
+	kept := make([]map[string]any, 0, len(all))
+	for _, a := range all {
+		if a["state"] == state {
+			kept = append(kept, a)
+		}
+	}
+	return json.Marshal(kept)
 }
 
 func agentAddCmd() *cobra.Command {
 	var name, hostname, backend, pol, containerName, healthURL, idleTimeout string
+	var agentLabels map[string]string
 
 	cmd := &cobra.Command{
 		Use:   "add",
@@ -229,7 +412,7 @@ func agentAddCmd() *cobra.Command {
 				}
 			}
 
-			payload := map[string]string{
+			payload := map[string]any{
 				"name":           name,
 				"hostname":       hostname,
 				"backend":        backend,
@@ -238,6 +421,9 @@ func agentAddCmd() *cobra.Command {
 				"health_url":     healthURL,
 				"idle_timeout":   idleTimeout,
 			}
+			if len(agentLabels) > 0 {
+				payload["labels"] = agentLabels
+			}
 
 			resp, err := apiPost("/admin/agents", payload)
 			if err != nil {
@@ -255,24 +441,27 @@ func agentAddCmd() *cobra.Command {
 	cmd.Flags().StringVar(&containerName, "container-name", "", "Docker service name")
 	cmd.Flags().StringVar(&healthURL, "health-url", "", "health check URL")
 	cmd.Flags().StringVar(&idleTimeout, "idle-timeout", "", "idle timeout (e.g. 30m)")
+	cmd.Flags().StringToStringVar(&agentLabels, "label", nil, "label for selectors, e.g. env=staging (repeatable)")
 
 	return cmd
 }
 
 func agentRemoveCmd() *cobra.Command {
-	return &cobra.Command{
+	var yes, force bool
+	cmd := &cobra.Command{
 		Use:   "remove <name>",
 		Short: "Remove an agent",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			fmt.Printf("Remove agent %q? [y/N]: ", args[0])
-			reader := bufio.NewReader(os.Stdin)
-			answer, _ := reader.ReadString('\n')
-			if strings.TrimSpace(strings.ToLower(answer)) != "y" {
+			prompt := fmt.Sprintf("Remove agent %q?", args[0])
+			if !yes && !force {
+				prompt += connectionsNote("/admin/agents/" + args[0])
+			}
+			if !confirm(prompt, yes || force) {
 				fmt.Println("Cancelled.")
 				return nil
 			}
-			resp, err := apiDelete("/admin/agents/" + args[0])
+			resp, err := apiDelete(removePath("/admin/agents/"+args[0], force))
 			if err != nil {
 				return err
 			}
@@ -280,15 +469,106 @@ func agentRemoveCmd() *cobra.Command {
 			return nil
 		},
 	}
+	addDestructiveFlags(cmd, &yes, &force)
+	return cmd
 }
 
-func agentInspectCmd() *cobra.Command {
+func agentRestoreCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "restore <name>",
+		Short: "Restore a removed agent from the trash",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			resp, err := apiPost("/admin/agents/"+args[0]+"/restore", nil)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(resp))
+			return nil
+		},
+	}
+}
+
+func agentHistoryCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "history <name>",
+		Short: "Show an agent's revision history",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := apiGet("/admin/agents/" + args[0] + "/revisions")
+			if err != nil {
+				return err
+			}
+			if format == "json" {
+				fmt.Println(string(data))
+				return nil
+			}
+			var revs []revisions.Revision
+			if err := json.Unmarshal(data, &revs); err != nil {
+				return fmt.Errorf("parse revisions: %w", err)
+			}
+			printRevisions(revs)
+			return nil
+		},
+	}
+}
+
+// printRevisions lists revisions newest first, with each changed field.
+func printRevisions(revs []revisions.Revision) {
+	for _, r := range revs {
+		line := fmt.Sprintf("#%-3d %s  %-11s by %s", r.Number, formatWhen(r.At), r.Action, r.Actor)
+		if r.Note != "" {
+			line += " (" + r.Note + ")"
+		}
+		fmt.Println(line)
+		for _, c := range r.Changes {
+			switch {
+			case c.Old == "":
+				fmt.Printf("     + %s: %s\n", c.Field, c.New)
+			case c.New == "":
+				fmt.Printf("     - %s: %s\n", c.Field, c.Old)
+			default:
+				fmt.Printf("     ~ %s: %s -> %s\n", c.Field, c.Old, c.New)
+			}
+		}
+	}
+}
+
+func agentRollbackCmd() *cobra.Command {
 	return &cobra.Command{
+		Use:   "rollback <name> <revision>",
+		Short: "Roll an agent back to a prior revision of its definition",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			n, err := strconv.Atoi(strings.TrimPrefix(args[1], "#"))
+			if err != nil || n <= 0 {
+				return fmt.Errorf("invalid revision %q", args[1])
+			}
+			resp, err := apiPost("/admin/agents/"+args[0]+"/rollback", map[string]int{"revision": n})
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(resp))
+			return nil
+		},
+	}
+}
+
+func agentInspectCmd() *cobra.Command {
+	var lastWake, withContainer bool
+	cmd := &cobra.Command{
 		Use:   "inspect <name>",
 		Short: "Show detailed agent info",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			data, err := apiGet("/admin/agents/" + args[0])
+			if lastWake {
+				return printLastWake(args[0])
+			}
+			path := "/admin/agents/" + args[0]
+			if withContainer {
+				path += "?container=true"
+			}
+			data, err := apiGet(path)
 			if err != nil {
 				return err
 			}
@@ -300,36 +580,230 @@ func agentInspectCmd() *cobra.Command {
 			if err := json.Unmarshal(data, &info); err != nil {
 				return fmt.Errorf("parse health info: %w", err)
 			}
+			jobs, _ := info["jobs"].([]any)
+			delete(info, "jobs")
+			ctr, _ := info["container"].(map[string]any)
+			delete(info, "container")
+			backends, _ := info["backends"].([]any)
+			delete(info, "backends")
+			circuit, _ := info["circuit"].(map[string]any)
+			delete(info, "circuit")
+			annotations, _ := info["annotations"].(map[string]any)
+			delete(info, "annotations")
+			agentLabels, _ := info["labels"].(map[string]any)
+			delete(info, "labels")
 			for k, v := range info {
-				fmt.Printf("%-16s %v\n", k+":", v)
+				fmt.Printf("%-16s %v\n", k+":", formatValue(v))
+			}
+			if circuit != nil {
+				line := fmt.Sprintf("%v (%v of %v requests failed)", circuit["state"], circuit["failures"], circuit["requests"])
+				if probe, ok := circuit["probe_at"]; ok {
+					line += fmt.Sprintf(", next probe %v", formatValue(probe))
+				}
+				fmt.Printf("%-16s %s\n", "circuit:", line)
+			}
+			if len(agentLabels) > 0 {
+				pairs := make(map[string]string, len(agentLabels))
+				for k, v := range agentLabels {
+					pairs[k] = fmt.Sprint(v)
+				}
+				fmt.Printf("%-16s %s\n", "labels:", formatAnnotations(pairs))
+			}
+			if len(backends) > 0 {
+				fmt.Println("backends:")
+				for _, b := range backends {
+					be, _ := b.(map[string]any)
+					health := "healthy"
+					if ok, _ := be["healthy"].(bool); !ok {
+						health = fmt.Sprintf("down until %v (%v)", formatValue(be["down_until"]), be["last_error"])
+					}
+					weight := ""
+					if w, ok := be["weight"]; ok {
+						weight = fmt.Sprintf("  weight=%v", w)
+					}
+					fmt.Printf("  %-36v active=%v%s  %s\n", be["target"], be["active"], weight, health)
+				}
+			}
+			if len(jobs) > 0 {
+				fmt.Println("jobs:")
+				for _, j := range jobs {
+					job, _ := j.(map[string]any)
+					desc, _ := job["description"].(string)
+					fmt.Printf("  %-36v expires %v  %s\n", job["id"], formatValue(job["expires_at"]), desc)
+				}
+			}
+			if len(annotations) > 0 {
+				fmt.Println("annotations:")
+				for _, k := range sortedNames(annotations) {
+					fmt.Printf("  %s: %v\n", k, annotations[k])
+				}
+			}
+			if ctr != nil {
+				printContainerDetails(ctr)
 			}
 			return nil
 		},
 	}
+	cmd.Flags().BoolVar(&lastWake, "last-wake", false, "show a phase breakdown of the agent's last wake")
+	cmd.Flags().BoolVar(&withContainer, "container", false, "include the runtime's container details (image digest, mounts, restarts)")
+	return cmd
+}
+
+func printContainerDetails(ctr map[string]any) {
+	fmt.Println("container:")
+	for _, k := range []string{"service", "image", "image_digest", "container_id", "node_id", "state", "started_at", "restart_count", "failed_tasks"} {
+		if v, ok := ctr[k]; ok {
+			fmt.Printf("  %-15s %v\n", k+":", formatValue(v))
+		}
+	}
+	mounts, _ := ctr["mounts"].([]any)
+	if len(mounts) == 0 {
+		return
+	}
+	fmt.Println("  mounts:")
+	for _, m := range mounts {
+		mt, _ := m.(map[string]any)
+		mode := "rw"
+		if ro, _ := mt["read_only"].(bool); ro {
+			mode = "ro"
+		}
+		fmt.Printf("    %-8v %v -> %v (%s)\n", mt["type"], mt["source"], mt["destination"], mode)
+	}
+}
+
+func printLastWake(name string) error {
+	data, err := apiGet("/admin/agents/" + name + "/wake")
+	if err != nil {
+		return err
+	}
+	if format == "json" {
+		fmt.Println(string(data))
+		return nil
+	}
+	var trace struct {
+		TriggeredAt      time.Time `json:"triggered_at"`
+		QueuedMs         int64     `json:"queued_ms"`
+		StartCallMs      int64     `json:"start_call_ms"`
+		ContainerStartMs int64     `json:"container_start_ms"`
+		FirstHealthyMs   int64     `json:"first_healthy_ms"`
+		RouteReadyMs     int64     `json:"route_ready_ms"`
+		TotalMs          int64     `json:"total_ms"`
+		Outcome          string    `json:"outcome"`
+	}
+	if err := json.Unmarshal(data, &trace); err != nil {
+		return fmt.Errorf("parse wake trace: %w", err)
+	}
+	fmt.Printf("Last wake of %s at %s (%s)\n", name, formatWhen(trace.TriggeredAt), trace.Outcome)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PHASE\tDURATION")
+	for _, ph := range []struct {
+		name string
+		ms   int64
+	}{
+		{"queued", trace.QueuedMs},
+		{"start call", trace.StartCallMs},
+		{"container start", trace.ContainerStartMs},
+		{"first healthy", trace.FirstHealthyMs},
+		{"route ready", trace.RouteReadyMs},
+		{"total", trace.TotalMs},
+	} {
+		fmt.Fprintf(w, "%s\t%s\n", ph.name, human.FormatDuration(time.Duration(ph.ms)*time.Millisecond))
+	}
+	return w.Flush()
 }
 
 func agentWakeCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "wake <name>",
-		Short: "Wake an on-demand agent",
-		Args:  cobra.ExactArgs(1),
+	var keepAwake human.Duration
+	var wait, all bool
+	var selector string
+	timeout := human.Duration(2 * time.Minute)
+	cmd := &cobra.Command{
+		Use:   "wake [<name> | --all | --selector <selector>]",
+		Short: "Wake an on-demand agent, or every agent matching a label selector",
+		Long: "Wake an on-demand agent, every on-demand agent with --all, or those whose labels match\n" +
+			"--selector, such as env=staging,team!=infra. The command returns once the wake is\n" +
+			"accepted; with --wait it returns once the agents are ready instead, exiting 1 if any\n" +
+			"ends up degraded or crash-looping and with an error if --timeout passes first.",
+		Args: cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			resp, err := apiPost("/admin/agents/"+args[0]+"/wake", nil)
-			if err != nil {
+			if err := bulkArgs(args, all, selector); err != nil {
 				return err
 			}
-			fmt.Println(string(resp))
+			payload := map[string]any{}
+			if keepAwake > 0 {
+				payload["keep_awake"] = keepAwake.String()
+			}
+			requested := time.Now()
+			var names []string
+			if len(args) == 1 {
+				var body any
+				if len(payload) > 0 {
+					body = payload
+				}
+				resp, err := apiPost("/admin/agents/"+args[0]+"/wake", body)
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(resp))
+				names = args
+			} else {
+				var err error
+				if names, err = bulkAction(cmd, "wake", selector, all, payload); err != nil {
+					return err
+				}
+			}
+			if !wait {
+				return nil
+			}
+			start := time.Now()
+			deadline := start.Add(time.Duration(timeout))
+			failed := false
+			for _, name := range names {
+				state, err := waitReady(name, requested, time.Until(deadline))
+				if err != nil {
+					if len(args) == 1 {
+						return err
+					}
+					fmt.Fprintln(cmd.ErrOrStderr(), "Error:", err)
+					failed = true
+					continue
+				}
+				if state != "ready" {
+					fmt.Fprintf(cmd.ErrOrStderr(), "%s is %s\n", name, state)
+					failed = true
+					continue
+				}
+				fmt.Printf("%s is ready (%s)\n", name, human.FormatDuration(time.Since(start).Round(time.Second)))
+			}
+			if failed {
+				return exitWith(cmd, exitDegraded)
+			}
 			return nil
 		},
 	}
+	cmd.Flags().Var(&keepAwake, "keep-awake", "hold the agents awake for this long, regardless of idle timeout (e.g. 1h or 2d)")
+	cmd.Flags().BoolVar(&wait, "wait", false, "return once the agents are ready; exit 1 if any fails to start")
+	cmd.Flags().Var(&timeout, "timeout", "how long --wait waits")
+	cmd.Flags().BoolVar(&all, "all", false, "wake every on-demand agent")
+	cmd.Flags().StringVarP(&selector, "selector", "l", "", "wake the agents whose labels match, e.g. env=staging")
+	return cmd
 }
 
 func agentSleepCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "sleep <name>",
-		Short: "Put an on-demand agent to sleep",
-		Args:  cobra.ExactArgs(1),
+	var all bool
+	var selector string
+	cmd := &cobra.Command{
+		Use:   "sleep [<name> | --all | --selector <selector>]",
+		Short: "Put an on-demand agent, or every agent matching a label selector, to sleep",
+		Args:  cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := bulkArgs(args, all, selector); err != nil {
+				return err
+			}
+			if len(args) == 0 {
+				_, err := bulkAction(cmd, "sleep", selector, all, map[string]any{})
+				return err
+			}
 			resp, err := apiPost("/admin/agents/"+args[0]+"/sleep", nil)
 			if err != nil {
 				return err
@@ -338,6 +812,61 @@ func agentSleepCmd() *cobra.Command {
 			return nil
 		},
 	}
+	cmd.Flags().BoolVar(&all, "all", false, "put every on-demand agent to sleep")
+	cmd.Flags().StringVarP(&selector, "selector", "l", "", "put the agents whose labels match to sleep, e.g. env=staging")
+	return cmd
+}
+
+// bulkArgs checks that exactly one of an agent name, --all and --selector
+// was given.
+func bulkArgs(args []string, all bool, selector string) error {
+	given := len(args)
+	if all {
+		given++
+	}
+	if selector != "" {
+		given++
+	}
+	if given != 1 {
+		return errors.New("give an agent name, --all or --selector")
+	}
+	return nil
+}
+
+// bulkAction wakes or sleeps every agent matching selector, or all of them,
+// printing what happened to each, and returns the agents acted on.
+func bulkAction(cmd *cobra.Command, action, selector string, all bool, payload map[string]any) ([]string, error) {
+	payload["selector"] = selector
+	payload["all"] = all
+	data, err := apiPost("/admin/"+action, payload)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Agents []struct {
+			Name   string `json:"name"`
+			Status string `json:"status"`
+			Reason string `json:"reason"`
+		} `json:"agents"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+	if len(resp.Agents) == 0 {
+		fmt.Println("No agents match.")
+		return nil, nil
+	}
+	verb := map[string]string{"wake": "Waking", "sleep": "Sleeping"}[action]
+	var names []string
+	for _, a := range resp.Agents {
+		if a.Status == "skipped" {
+			fmt.Fprintf(cmd.ErrOrStderr(), "Skipped %s: %s\n", a.Name, a.Reason)
+			continue
+		}
+		fmt.Printf("%s %s\n", verb, a.Name)
+		names = append(names, a.Name)
+	}
+	return names, nil
 }
 
 func agentLogsCmd() *cobra.Command {
@@ -368,16 +897,39 @@ func agentLogsCmd() *cobra.Command {
 	}
 }
 
+func agentExportCmd() *cobra.Command {
+	var exportFormat string
+	cmd := &cobra.Command{
+		Use:   "export <name>",
+		Short: "Export an agent's container settings (e.g. as a docker-compose service)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := apiGet("/admin/agents/" + args[0] + "/export?format=" + url.QueryEscape(exportFormat))
+			if err != nil {
+				return err
+			}
+			fmt.Print(string(data))
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&exportFormat, "format", "compose", "export format: compose")
+	return cmd
+}
+
 func serviceListCmd() *cobra.Command {
-	return &cobra.Command{
+	return watchable(&cobra.Command{
 		Use:   "list",
 		Short: "List dynamic services",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			sel, err := selector()
+			if err != nil {
+				return err
+			}
 			data, err := apiGet("/admin/services")
 			if err != nil {
 				return err
 			}
-			if format == "json" {
+			if format == "json" && sel == "" {
 				fmt.Println(string(data))
 				return nil
 			}
@@ -387,6 +939,14 @@ func serviceListCmd() *cobra.Command {
 				Agent    string `json:"agent"`
 			}
 			_ = json.Unmarshal(data, &services)
+			if sel != "" {
+				items := make([]listItem, len(services))
+				for i, s := range services {
+					items[i] = listItem{name: s.Hostname}
+				}
+				printSelected(sel, items)
+				return nil
+			}
 			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
 			fmt.Fprintln(w, "HOSTNAME\tTARGET\tAGENT")
 			for _, s := range services {
@@ -394,11 +954,21 @@ func serviceListCmd() *cobra.Command {
 			}
 			return w.Flush()
 		},
-	}
+	})
 }
 
 func serviceAddCmd() *cobra.Command {
-	var hostname, target, agent string
+	var hostname, target, agent, balance string
+	var replicas []string
+	var weights []int
+	var sticky bool
+	var stickyCookie, stickyTTL string
+	var dialTimeout, headerTimeout, idleConnTimeout string
+	var corsOrigins, corsMethods, corsHeaders []string
+	var corsCredentials, wake bool
+	var fallbackRetries int
+	var fallbackWake bool
+	var fallbackURL, fallbackPage string
 	cmd := &cobra.Command{
 		Use:   "add",
 		Short: "Add a dynamic service route",
@@ -406,11 +976,46 @@ func serviceAddCmd() *cobra.Command {
 			if hostname == "" || target == "" {
 				return fmt.Errorf("--hostname and --target are required")
 			}
-			resp, err := apiPost("/api/services", map[string]string{
+			if len(weights) > 0 && len(weights) != 1+len(replicas) {
+				return fmt.Errorf("--weight needs one value per target: got %d for %d targets", len(weights), 1+len(replicas))
+			}
+			body := map[string]any{
 				"hostname": hostname,
 				"target":   target,
 				"agent":    agent,
-			})
+				"replicas": replicas,
+				"balance":  balance,
+				"weights":  weights,
+			}
+			if wake {
+				if agent == "" {
+					return fmt.Errorf("--wake needs --agent")
+				}
+				body["wake"] = true
+			}
+			if fallbackRetries > 0 || fallbackWake || fallbackURL != "" || fallbackPage != "" {
+				fallback := map[string]any{"retries": fallbackRetries, "wake": fallbackWake, "url": fallbackURL}
+				if fallbackPage != "" {
+					page, err := os.ReadFile(fallbackPage)
+					if err != nil {
+						return fmt.Errorf("reading --fallback-page: %w", err)
+					}
+					fallback["page"] = string(page)
+				}
+				body["fallback"] = fallback
+			}
+			if sticky || stickyCookie != "" || stickyTTL != "" {
+				body["sticky"] = map[string]string{"cookie": stickyCookie, "ttl": stickyTTL}
+			}
+			if dialTimeout != "" || headerTimeout != "" || idleConnTimeout != "" {
+				body["timeouts"] = map[string]string{"dial": dialTimeout, "response_header": headerTimeout, "idle": idleConnTimeout}
+			}
+			if len(corsOrigins) > 0 {
+				body["cors"] = map[string]any{"origins": corsOrigins, "methods": corsMethods, "headers": corsHeaders, "credentials": corsCredentials}
+			} else if len(corsMethods) > 0 || len(corsHeaders) > 0 || corsCredentials {
+				return fmt.Errorf("--cors-method, --cors-header and --cors-credentials need --cors-origin")
+			}
+			resp, err := apiPost("/api/services", body)
 			if err != nil {
 				return err
 			}
@@ -421,16 +1026,88 @@ func serviceAddCmd() *cobra.Command {
 	cmd.Flags().StringVar(&hostname, "hostname", "", "service hostname")
 	cmd.Flags().StringVar(&target, "target", "", "target URL")
 	cmd.Flags().StringVar(&agent, "agent", "", "owning agent name")
+	cmd.Flags().StringSliceVar(&replicas, "replica", nil, "additional target URL to balance across (repeatable)")
+	cmd.Flags().StringVar(&balance, "balance", "", "balancing strategy: round-robin (default) or least-connections")
+	cmd.Flags().BoolVar(&sticky, "sticky", false, "pin each client to one target with a cookie")
+	cmd.Flags().StringVar(&stickyCookie, "sticky-cookie", "", "sticky session cookie name (default warren_backend; implies --sticky)")
+	cmd.Flags().StringVar(&stickyTTL, "sticky-ttl", "", "how long a client stays pinned, e.g. 8h (default 1h; implies --sticky)")
+	cmd.Flags().IntSliceVar(&weights, "weight", nil, "traffic weight per target, --target first then each --replica (e.g. 90,10 for a canary)")
+	cmd.Flags().StringVar(&dialTimeout, "dial-timeout", "", "how long to wait connecting to the target (default 30s)")
+	cmd.Flags().StringVar(&headerTimeout, "response-header-timeout", "", "how long to wait for response headers, e.g. 10m for slow streaming backends (default no limit)")
+	cmd.Flags().StringVar(&idleConnTimeout, "idle-conn-timeout", "", "how long an unused keep-alive connection is kept (default 90s)")
+	cmd.Flags().StringSliceVar(&corsOrigins, "cors-origin", nil, "browser origin allowed to call the service, e.g. https://app.example.com (repeatable)")
+	cmd.Flags().StringSliceVar(&corsMethods, "cors-method", nil, "method allowed cross-origin (repeatable; default GET, HEAD, POST)")
+	cmd.Flags().StringSliceVar(&corsHeaders, "cors-header", nil, "request header allowed cross-origin (repeatable; * for any)")
+	cmd.Flags().BoolVar(&corsCredentials, "cors-credentials", false, "allow cross-origin requests with cookies or Authorization")
+	cmd.Flags().BoolVar(&wake, "wake", false, "keep the route while the agent sleeps and wake it on requests")
+	cmd.Flags().IntVar(&fallbackRetries, "fallback-retries", 0, "retry GET and HEAD requests this many times when the target refuses connections")
+	cmd.Flags().BoolVar(&fallbackWake, "fallback-wake", false, "when the target is down, wake the owning agent, hold the request and try again")
+	cmd.Flags().StringVar(&fallbackURL, "fallback-url", "", "target tried when the main one is down")
+	cmd.Flags().StringVar(&fallbackPage, "fallback-page", "", "HTML file served with 502 when the target is down")
+	return cmd
+}
+
+func serviceUpdateCmd() *cobra.Command {
+	var target string
+	var replicas []string
+	var weights []int
+	var noReplicas bool
+	cmd := &cobra.Command{
+		Use:   "update <hostname>",
+		Short: "Point a dynamic service at a new target without interrupting it",
+		Long: `Point a dynamic service at a new target. The service keeps its agent and
+options, and requests switch to the new target at once: the hostname is never
+unrouted. Replicas and weights are kept unless --replica, --weight or
+--no-replicas is given.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if target == "" {
+				return fmt.Errorf("--target is required")
+			}
+			if noReplicas && (len(replicas) > 0 || len(weights) > 0) {
+				return fmt.Errorf("--no-replicas cannot be used with --replica or --weight")
+			}
+			body := map[string]any{"target": target}
+			switch {
+			case noReplicas:
+				body["replicas"] = []string{}
+			case cmd.Flags().Changed("replica"):
+				body["replicas"] = replicas
+			}
+			if cmd.Flags().Changed("weight") {
+				body["weights"] = weights
+			}
+			resp, err := apiPatch("/api/services/"+args[0], body)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(resp))
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&target, "target", "", "new target URL")
+	cmd.Flags().StringSliceVar(&replicas, "replica", nil, "additional target URL to balance across, replacing the current replicas (repeatable)")
+	cmd.Flags().IntSliceVar(&weights, "weight", nil, "traffic weight per target, --target first then each replica")
+	cmd.Flags().BoolVar(&noReplicas, "no-replicas", false, "drop the current replicas and serve from --target alone")
 	return cmd
 }
 
 func serviceRemoveCmd() *cobra.Command {
-	return &cobra.Command{
+	var yes, force bool
+	cmd := &cobra.Command{
 		Use:   "remove <hostname>",
 		Short: "Remove a dynamic service route",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			resp, err := apiDelete("/api/services/" + args[0])
+			prompt := fmt.Sprintf("Remove service %q?", args[0])
+			if !yes && !force {
+				prompt += connectionsNote("/api/services/" + args[0])
+			}
+			if !confirm(prompt, yes || force) {
+				fmt.Println("Cancelled.")
+				return nil
+			}
+			resp, err := apiDelete(removePath("/api/services/"+args[0], force))
 			if err != nil {
 				return err
 			}
@@ -438,13 +1115,122 @@ func serviceRemoveCmd() *cobra.Command {
 			return nil
 		},
 	}
+	addDestructiveFlags(cmd, &yes, &force)
+	return cmd
 }
 
-func statusCmd() *cobra.Command {
+func serviceRestoreCmd() *cobra.Command {
 	return &cobra.Command{
+		Use:   "restore <hostname>",
+		Short: "Restore a removed dynamic service route from the trash",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			resp, err := apiPost("/api/services/"+args[0]+"/restore", nil)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(resp))
+			return nil
+		},
+	}
+}
+
+func serviceHistoryCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "history <hostname>",
+		Short: "Show a dynamic service's revision history",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := apiGet("/api/services/" + args[0] + "/revisions")
+			if err != nil {
+				return err
+			}
+			if format == "json" {
+				fmt.Println(string(data))
+				return nil
+			}
+			var revs []revisions.Revision
+			if err := json.Unmarshal(data, &revs); err != nil {
+				return fmt.Errorf("parse revisions: %w", err)
+			}
+			printRevisions(revs)
+			return nil
+		},
+	}
+}
+
+func trashCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "trash",
+		Short: "List removed agents and services that can still be restored",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			sel, err := selector()
+			if err != nil {
+				return err
+			}
+			data, err := apiGet("/admin/trash")
+			if err != nil {
+				return err
+			}
+			if format == "json" && sel == "" {
+				fmt.Println(string(data))
+				return nil
+			}
+			var trash struct {
+				Agents []struct {
+					Name      string    `json:"name"`
+					RemovedAt time.Time `json:"removed_at"`
+					ExpiresAt time.Time `json:"expires_at"`
+				} `json:"agents"`
+				Services []struct {
+					Hostname  string    `json:"hostname"`
+					RemovedAt time.Time `json:"removed_at"`
+					ExpiresAt time.Time `json:"expires_at"`
+				} `json:"services"`
+			}
+			if err := json.Unmarshal(data, &trash); err != nil {
+				return fmt.Errorf("parse trash: %w", err)
+			}
+			if sel != "" {
+				var items []listItem
+				for _, a := range trash.Agents {
+					items = append(items, listItem{name: a.Name})
+				}
+				for _, s := range trash.Services {
+					items = append(items, listItem{name: s.Hostname})
+				}
+				printSelected(sel, items)
+				return nil
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "KIND\tNAME\tREMOVED\tEXPIRES IN")
+			for _, a := range trash.Agents {
+				fmt.Fprintf(w, "agent\t%s\t%s\t%s\n", a.Name, formatAgo(a.RemovedAt), human.Approx(time.Until(a.ExpiresAt)))
+			}
+			for _, s := range trash.Services {
+				fmt.Fprintf(w, "service\t%s\t%s\t%s\n", s.Hostname, formatAgo(s.RemovedAt), human.Approx(time.Until(s.ExpiresAt)))
+			}
+			return w.Flush()
+		},
+	}
+}
+
+func statusCmd() *cobra.Command {
+	var useExitCode, verbose bool
+	cmd := &cobra.Command{
 		Use:   "status",
 		Short: "Show orchestrator status",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if useExitCode {
+				bad, err := checkAgents()
+				switch {
+				case err != nil:
+					return exitWith(cmd, exitUnreachable)
+				case len(bad) > 0:
+					return exitWith(cmd, exitDegraded)
+				}
+				return nil
+			}
 			data, err := apiGet("/admin/health")
 			if err != nil {
 				return err
@@ -454,28 +1240,64 @@ func statusCmd() *cobra.Command {
 				return nil
 			}
 			var health struct {
-				UptimeSeconds float64 `json:"uptime_seconds"`
-				AgentCount    int     `json:"agent_count"`
-				ReadyCount    int     `json:"ready_count"`
-				SleepingCount int     `json:"sleeping_count"`
-				WSConnections int64   `json:"ws_connections"`
-				ServiceCount  int     `json:"service_count"`
+				Status        string        `json:"status"`
+				Checks        []healthCheck `json:"checks"`
+				UptimeSeconds float64       `json:"uptime_seconds"`
+				AgentCount    int           `json:"agent_count"`
+				ReadyCount    int           `json:"ready_count"`
+				SleepingCount int           `json:"sleeping_count"`
+				WSConnections int64         `json:"ws_connections"`
+				ServiceCount  int           `json:"service_count"`
 			}
 			_ = json.Unmarshal(data, &health)
 
-			uptime := time.Duration(health.UptimeSeconds) * time.Second
-			days := int(uptime.Hours()) / 24
-			hours := int(uptime.Hours()) % 24
-			mins := int(uptime.Minutes()) % 60
+			uptime := time.Duration(health.UptimeSeconds * float64(time.Second))
 
 			fmt.Println("Warren Orchestrator")
-			fmt.Printf("  Uptime:      %dd %dh %dm\n", days, hours, mins)
+			if health.Status != "" && health.Status != "ok" {
+				fmt.Printf("  Status:      %s\n", health.Status)
+			}
+			fmt.Printf("  Uptime:      %s\n", human.Approx(uptime))
 			fmt.Printf("  Agents:      %d (%d ready, %d sleeping)\n", health.AgentCount, health.ReadyCount, health.SleepingCount)
 			fmt.Printf("  Connections: %d active WebSocket\n", health.WSConnections)
 			fmt.Printf("  Services:    %d dynamic routes\n", health.ServiceCount)
+			if verbose {
+				printHealthChecks(health.Checks)
+			}
 			return nil
 		},
 	}
+	cmd.Flags().BoolVar(&useExitCode, "exit-code", false, "print nothing; exit 0 if all agents are healthy, 1 if any is degraded, 2 if Warren is unreachable")
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "list each subsystem check with its latency and last error")
+	return watchable(cmd)
+}
+
+// healthCheck is one subsystem check from /admin/health.
+type healthCheck struct {
+	Name        string     `json:"name"`
+	Status      string     `json:"status"`
+	LatencyMs   float64    `json:"latency_ms"`
+	Detail      string     `json:"detail"`
+	Error       string     `json:"error"`
+	LastError   string     `json:"last_error"`
+	LastErrorAt *time.Time `json:"last_error_at"`
+}
+
+// printHealthChecks renders subsystem checks as a checklist. Passing checks
+// that failed earlier still show when and why.
+func printHealthChecks(checks []healthCheck) {
+	fmt.Println("\nChecks")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, c := range checks {
+		mark, note := "✓", c.Detail
+		if c.Status != "ok" {
+			mark, note = "✗", c.Error
+		} else if c.LastErrorAt != nil {
+			note = strings.TrimSpace(fmt.Sprintf("%s (last error %s: %s)", note, human.Relative(*c.LastErrorAt, time.Now()), c.LastError))
+		}
+		fmt.Fprintf(w, "  %s %s\t%.1fms\t%s\n", mark, c.Name, c.LatencyMs, note)
+	}
+	w.Flush()
 }
 
 func reloadCmd() *cobra.Command {
@@ -483,60 +1305,26 @@ func reloadCmd() *cobra.Command {
 		Use:   "reload",
 		Short: "Send SIGHUP to the orchestrator to reload config",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			// Find orchestrator PID by process name.
-			out, err := exec.Command("pgrep", "-f", "warren-server").Output()
+			pid, err := signalReload()
 			if err != nil {
-				return fmt.Errorf("could not find orchestrator process: %w", err)
-			}
-			pids := strings.Fields(strings.TrimSpace(string(out)))
-			if len(pids) == 0 {
-				return fmt.Errorf("orchestrator process not found")
-			}
-			// Send SIGHUP to first PID found.
-			c := exec.Command("kill", "-HUP", pids[0])
-			if err := c.Run(); err != nil {
-				return fmt.Errorf("failed to send SIGHUP: %w", err)
+				return err
 			}
-			fmt.Printf("SIGHUP sent to PID %s\n", pids[0])
+			fmt.Printf("SIGHUP sent to PID %d\n", pid)
 			return nil
 		},
 	}
 }
 
-func eventsCmd() *cobra.Command {
+func upgradeCmd() *cobra.Command {
 	return &cobra.Command{
-		Use:   "events",
-		Short: "Stream events from the orchestrator (SSE)",
+		Use:   "upgrade",
+		Short: "Send SIGUSR2 to the orchestrator to hand over to a new binary",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			resp, err := http.Get(getAdminURL() + "/admin/events")
+			pid, err := signalUpgrade()
 			if err != nil {
 				return err
 			}
-			defer resp.Body.Close()
-
-			scanner := bufio.NewScanner(resp.Body)
-			for scanner.Scan() {
-				line := scanner.Text()
-				if strings.HasPrefix(line, "data: ") {
-					fmt.Println(line[6:])
-				}
-			}
-			return scanner.Err()
-		},
-	}
-}
-
-func configValidateCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "config validate <file>",
-		Short: "Validate a config file",
-		Args:  cobra.ExactArgs(1),
-		RunE: func(cmd *cobra.Command, args []string) error {
-			_, err := config.Load(args[0])
-			if err != nil {
-				return fmt.Errorf("validation failed: %w", err)
-			}
-			fmt.Println("OK")
+			fmt.Printf("SIGUSR2 sent to PID %d\n", pid)
 			return nil
 		},
 	}
@@ -660,13 +1448,20 @@ stderr_logfile=/dev/stderr
 stderr_logfile_maxbytes=0
 `
 
-			if err := os.WriteFile(dir+"/Dockerfile", []byte(dockerfile), 0644); err != nil {
+			// Keep LF endings on Windows checkouts; these files run inside a
+			// Linux image, where CRLF breaks supervisord and shell scripts.
+			gitattributes := "* text=auto eol=lf\n"
+
+			if err := os.WriteFile(filepath.Join(dir, ".gitattributes"), []byte(gitattributes), 0644); err != nil {
+				return err
+			}
+			if err := os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte(dockerfile), 0644); err != nil {
 				return err
 			}
-			if err := os.WriteFile(dir+"/openclaw.json", []byte(openclawJSON), 0644); err != nil {
+			if err := os.WriteFile(filepath.Join(dir, "openclaw.json"), []byte(openclawJSON), 0644); err != nil {
 				return err
 			}
-			if err := os.WriteFile(dir+"/supervisord.conf", []byte(supervisordConf), 0644); err != nil {
+			if err := os.WriteFile(filepath.Join(dir, "supervisord.conf"), []byte(supervisordConf), 0644); err != nil {
 				return err
 			}
 
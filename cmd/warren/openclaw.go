@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func openclawCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "openclaw",
+		Short: "Inspect OpenClaw gateways behind agents",
+	}
+
+	cmd.AddCommand(
+		openclawSessionsCmd(),
+	)
+
+	return cmd
+}
+
+func openclawSessionsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "sessions <agent>",
+		Short: "List OpenClaw sessions reported by an agent's gateway",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := apiGet("/admin/agents/" + args[0] + "/sessions")
+			if err != nil {
+				return err
+			}
+			if format == "json" {
+				fmt.Println(string(data))
+				return nil
+			}
+
+			var snap struct {
+				Total    int       `json:"total"`
+				Active   int       `json:"active"`
+				PolledAt time.Time `json:"polled_at"`
+				Error    string    `json:"last_error"`
+				Sessions []struct {
+					Key       string `json:"key"`
+					AgentID   string `json:"agentId"`
+					UpdatedAt int64  `json:"updatedAt"`
+				} `json:"sessions"`
+			}
+			if err := json.Unmarshal(data, &snap); err != nil {
+				return fmt.Errorf("parse sessions: %w", err)
+			}
+
+			if snap.PolledAt.IsZero() {
+				fmt.Println("Sessions not polled yet (agent must be ready).")
+				return nil
+			}
+			if snap.Error != "" {
+				fmt.Printf("Last poll failed: %s\n", snap.Error)
+				return nil
+			}
+
+			fmt.Printf("Sessions: %d total, %d active (polled %s)\n", snap.Total, snap.Active, formatAgo(snap.PolledAt))
+			if len(snap.Sessions) == 0 {
+				return nil
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "KEY\tAGENT\tUPDATED")
+			for _, s := range snap.Sessions {
+				updated := "-"
+				if s.UpdatedAt > 0 {
+					updated = formatAgo(time.UnixMilli(s.UpdatedAt))
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\n", s.Key, s.AgentID, updated)
+			}
+			return w.Flush()
+		},
+	}
+}
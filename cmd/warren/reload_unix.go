@@ -0,0 +1,56 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// signalReload sends SIGHUP to the running orchestrator and returns its PID.
+func signalReload() (int, error) {
+	return signalServer(syscall.SIGHUP)
+}
+
+// signalUpgrade sends SIGUSR2 to the running orchestrator and returns its
+// PID.
+func signalUpgrade() (int, error) {
+	return signalServer(syscall.SIGUSR2)
+}
+
+// signalServer sends sig to the running orchestrator and returns its PID.
+func signalServer(sig syscall.Signal) (int, error) {
+	// Find orchestrator PID by process name.
+	out, err := exec.Command("pgrep", "-f", "warren-server").Output()
+	if err != nil {
+		return 0, fmt.Errorf("could not find orchestrator process: %w", err)
+	}
+	pids := strings.Fields(strings.TrimSpace(string(out)))
+	if len(pids) == 0 {
+		return 0, fmt.Errorf("orchestrator process not found")
+	}
+	// Signal the first PID found.
+	pid, err := strconv.Atoi(pids[0])
+	if err != nil {
+		return 0, fmt.Errorf("unexpected pgrep output %q", pids[0])
+	}
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return 0, err
+	}
+	if err := proc.Signal(sig); err != nil {
+		return 0, fmt.Errorf("failed to send %s: %w", signalName(sig), err)
+	}
+	return pid, nil
+}
+
+func signalName(sig syscall.Signal) string {
+	if sig == syscall.SIGUSR2 {
+		return "SIGUSR2"
+	}
+	return "SIGHUP"
+}
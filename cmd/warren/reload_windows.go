@@ -0,0 +1,16 @@
+//go:build windows
+
+package main
+
+import "fmt"
+
+// signalReload fails on Windows, which has no SIGHUP.
+func signalReload() (int, error) {
+	return 0, fmt.Errorf("reload is not supported on Windows; restart warren-server to apply config changes")
+}
+
+// signalUpgrade fails on Windows, where listeners can't be handed to a new
+// process.
+func signalUpgrade() (int, error) {
+	return 0, fmt.Errorf("upgrade is not supported on Windows; restart warren-server instead")
+}
@@ -0,0 +1,488 @@
+//go:build !nodashboard
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+
+	"github.com/moby/term"
+	"github.com/spf13/cobra"
+
+	"warren/internal/events"
+	"warren/internal/human"
+)
+
+// topMaxEvents is how many recent events warren top keeps.
+const topMaxEvents = 200
+
+// topFlash is how long an agent's row stays highlighted after its state
+// changes on the event stream.
+const topFlash = 5 * time.Second
+
+// topStates maps events to the agent state they leave behind.
+var topStates = map[string]string{
+	events.AgentReady:     "ready",
+	events.AgentRecovered: "ready",
+	events.AgentWake:      "starting",
+	events.AgentStarting:  "starting",
+	events.AgentSleep:     "sleeping",
+	events.AgentDegraded:  "degraded",
+	events.AgentCrashLoop: "crashloop",
+}
+
+// topAgent is one row of the dashboard.
+type topAgent struct {
+	Name        string    `json:"name"`
+	Hostname    string    `json:"hostname"`
+	Policy      string    `json:"policy"`
+	State       string    `json:"state"`
+	Connections int64     `json:"connections"`
+	changed     time.Time // last state change seen on the event stream
+}
+
+// topModel is warren top's screen state. Only the loop in runTop touches
+// it, so it needs no locking.
+type topModel struct {
+	admin    string
+	agents   []*topAgent // by name
+	events   []events.Event
+	selected int
+	offset   int      // first agent row shown
+	stream   string   // event stream state, e.g. "live"
+	status   string   // result of the last action
+	inspect  []string // the inspect view's lines; nil shows the dashboard
+	color    bool
+	now      func() time.Time
+}
+
+// setAgents replaces the agent list, keeping the selection and the state
+// change times the stream has seen.
+func (m *topModel) setAgents(list []*topAgent) {
+	prev := make(map[string]*topAgent, len(m.agents))
+	for _, a := range m.agents {
+		prev[a.Name] = a
+	}
+	selected := m.selectedName()
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	m.selected = 0
+	for i, a := range list {
+		if p, ok := prev[a.Name]; ok {
+			a.changed = p.changed
+		}
+		if a.Name == selected {
+			m.selected = i
+		}
+	}
+	m.agents = list
+}
+
+// apply records an event and updates the state it changes. It reports
+// whether the agent list itself changed, needing a refresh.
+func (m *topModel) apply(ev events.Event) bool {
+	m.events = append(m.events, ev)
+	if len(m.events) > topMaxEvents {
+		m.events = m.events[len(m.events)-topMaxEvents:]
+	}
+	switch ev.Type {
+	case events.AgentAdded, events.AgentRemoved:
+		return true
+	}
+	state, ok := topStates[ev.Type]
+	if !ok {
+		return false
+	}
+	for _, a := range m.agents {
+		if a.Name == ev.Agent {
+			a.State = state
+			a.changed = m.now()
+			return false
+		}
+	}
+	return true
+}
+
+func (m *topModel) selectedName() string {
+	if m.selected < len(m.agents) {
+		return m.agents[m.selected].Name
+	}
+	return ""
+}
+
+func (m *topModel) move(delta int) {
+	m.selected = max(0, min(len(m.agents)-1, m.selected+delta))
+}
+
+// render draws the screen, fitting it into width×height. Lines are
+// separated by \r\n since the terminal is in raw mode, with none after
+// the last so the screen doesn't scroll.
+func (m *topModel) render(w io.Writer, width, height int) {
+	var lines []string
+	if m.inspect != nil {
+		lines = append(lines, m.bold("Agent "+m.selectedName()), "")
+		lines = append(lines, m.inspect...)
+		lines = fit(lines, height-1)
+		lines = append(lines, m.dim("press any key to go back"))
+	} else {
+		lines = m.dashboard(height)
+	}
+	for i := range lines {
+		lines[i] = truncate(lines[i], width)
+	}
+	fmt.Fprint(w, "\033[H"+strings.Join(lines, "\033[K\r\n")+"\033[K\033[J")
+}
+
+func (m *topModel) dashboard(height int) []string {
+	counts := make(map[string]int)
+	for _, a := range m.agents {
+		counts[a.State]++
+	}
+	header := fmt.Sprintf("Warren  %s  %d agents: %d ready, %d sleeping  events: %s",
+		m.admin, len(m.agents), counts["ready"], counts["sleeping"], m.stream)
+	lines := []string{m.bold(header), ""}
+
+	// Agents take what the column header, events pane and footer leave.
+	eventRows := max(3, height/3)
+	agentRows := max(1, height-len(lines)-1-2-eventRows-3)
+	if m.selected < m.offset {
+		m.offset = m.selected
+	}
+	if m.selected >= m.offset+agentRows {
+		m.offset = m.selected - agentRows + 1
+	}
+	m.offset = max(0, min(m.offset, len(m.agents)-agentRows))
+
+	var buf bytes.Buffer
+	tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tPOLICY\tSTATE\tCONNS\tCHANGED\tHOSTNAME")
+	now := m.now()
+	for _, a := range m.agents {
+		changed := "-"
+		if !a.changed.IsZero() {
+			changed = human.Relative(a.changed, now)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\n", a.Name, a.Policy, a.State, a.Connections, changed, a.Hostname)
+	}
+	tw.Flush()
+	rows := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	lines = append(lines, "  "+rows[0])
+	for i := m.offset; i < len(m.agents) && i < m.offset+agentRows; i++ {
+		a, row := m.agents[i], rows[i+1]
+		switch {
+		case i == m.selected:
+			lines = append(lines, m.paint("\033[7m", "> "+row))
+		case !a.changed.IsZero() && now.Sub(a.changed) < topFlash:
+			lines = append(lines, m.paint(colorYellow, "  "+row))
+		default:
+			lines = append(lines, "  "+row)
+		}
+	}
+	for i := len(m.agents) - m.offset; i < agentRows; i++ {
+		lines = append(lines, "")
+	}
+
+	lines = append(lines, "", m.bold("Recent events"))
+	recent := m.events[max(0, len(m.events)-eventRows):]
+	for _, ev := range recent {
+		lines = append(lines, m.paint(eventColor(ev.Type), renderEvent(ev, false)))
+	}
+	for i := len(recent); i < eventRows; i++ {
+		lines = append(lines, "")
+	}
+
+	lines = append(lines, "", m.dim(m.status))
+	lines = append(lines, m.dim("↑/↓ select  w wake  s sleep  i inspect  r refresh  q quit"))
+	return lines
+}
+
+func (m *topModel) paint(code, s string) string {
+	if !m.color || s == "" {
+		return s
+	}
+	return code + s + colorReset
+}
+
+func (m *topModel) bold(s string) string { return m.paint("\033[1m", s) }
+func (m *topModel) dim(s string) string  { return m.paint(colorDim, s) }
+
+// fit keeps the first n lines.
+func fit(lines []string, n int) []string {
+	if len(lines) > n {
+		return lines[:max(0, n)]
+	}
+	return lines
+}
+
+// truncate shortens s to width runes, not counting ANSI escapes, which are
+// only ever wrapped around a whole line here.
+func truncate(s string, width int) string {
+	plain, prefix, suffix := s, "", ""
+	if strings.HasPrefix(s, "\033[") && strings.HasSuffix(s, colorReset) {
+		i := strings.IndexByte(s, 'm') + 1
+		prefix, plain, suffix = s[:i], s[i:len(s)-len(colorReset)], colorReset
+	}
+	if utf8.RuneCountInString(plain) <= width {
+		return s
+	}
+	return prefix + string([]rune(plain)[:max(0, width)]) + suffix
+}
+
+// inspectLines renders an agent's inspect response as "key: value" lines.
+func inspectLines(data []byte) []string {
+	var info map[string]any
+	if err := json.Unmarshal(data, &info); err != nil {
+		return []string{string(data)}
+	}
+	var lines []string
+	for _, key := range sortedNames(info) {
+		v := formatValue(info[key])
+		if _, ok := v.(string); !ok {
+			b, _ := json.Marshal(v)
+			v = string(b)
+		}
+		lines = append(lines, fmt.Sprintf("%s: %v", key, v))
+	}
+	return lines
+}
+
+func fetchTopAgents() ([]*topAgent, error) {
+	data, err := apiGet("/admin/agents")
+	if err != nil {
+		return nil, err
+	}
+	var list []*topAgent
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("parse agents: %w", err)
+	}
+	return list, nil
+}
+
+func topCmd() *cobra.Command {
+	interval := human.Duration(5 * time.Second)
+	cmd := &cobra.Command{
+		Use:   "top",
+		Short: "Show a live dashboard of agents and events",
+		Long: "Show agents with their state and connections above the most recent events, updated\n" +
+			"live from the event stream. Rows flash when an agent wakes or sleeps. Connection\n" +
+			"counts, which have no events, are polled every --interval.\n\n" +
+			"Keys: ↑/↓ or j/k select an agent, w wakes it, s puts it to sleep, i inspects it,\n" +
+			"r refreshes and q quits.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runTop(time.Duration(interval))
+		},
+	}
+	cmd.Flags().Var(&interval, "interval", "how often connection counts are refreshed")
+	return cmd
+}
+
+// topKey is a key press, with the arrow keys as "up" and "down".
+type topKey string
+
+// readKeys sends key presses from in until it fails.
+func readKeys(in io.Reader, keys chan<- topKey) {
+	buf := make([]byte, 16)
+	for {
+		n, err := in.Read(buf)
+		if err != nil {
+			close(keys)
+			return
+		}
+		switch s := string(buf[:n]); s {
+		case "\033[A", "\033OA":
+			keys <- "up"
+		case "\033[B", "\033OB":
+			keys <- "down"
+		case "\x03":
+			keys <- "q"
+		default:
+			keys <- topKey(s)
+		}
+	}
+}
+
+func runTop(interval time.Duration) error {
+	list, err := fetchTopAgents()
+	if err != nil {
+		return err
+	}
+	fd, isTerminal := term.GetFdInfo(os.Stdin)
+	if !isTerminal {
+		return errors.New("warren top needs a terminal; use warren agent list or warren events instead")
+	}
+	saved, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	// Alternate screen with the cursor hidden, both undone on the way out.
+	fmt.Print("\033[?1049h\033[?25l")
+	defer func() {
+		fmt.Print("\033[?25h\033[?1049l")
+		_ = term.RestoreTerminal(fd, saved)
+	}()
+
+	m := &topModel{admin: getAdminURL(), stream: "live", color: os.Getenv("NO_COLOR") == "", now: time.Now}
+	m.setAgents(list)
+
+	type streamUpdate struct {
+		ev     *events.Event
+		status string
+	}
+	updates := make(chan streamUpdate, 64)
+	go func() {
+		var lastID string
+		wait := eventsRetry
+		for {
+			got, dropped, err := streamEvents("/admin/events", lastID, func(id, data string) {
+				if id != "" {
+					lastID = id
+				}
+				var ev events.Event
+				if json.Unmarshal([]byte(data), &ev) == nil {
+					updates <- streamUpdate{ev: &ev, status: "live"}
+				}
+			})
+			if err != nil {
+				updates <- streamUpdate{status: err.Error()}
+				return
+			}
+			if got {
+				wait = eventsRetry
+			}
+			updates <- streamUpdate{status: fmt.Sprintf("%v; reconnecting in %s", dropped, wait)}
+			time.Sleep(wait)
+			wait = min(wait*2, eventsMaxRetry)
+		}
+	}()
+
+	keys := make(chan topKey)
+	go readKeys(os.Stdin, keys)
+
+	type refresh struct {
+		list []*topAgent
+		err  error
+	}
+	refreshed := make(chan refresh, 1)
+	refreshing := false
+	startRefresh := func() {
+		if refreshing {
+			return
+		}
+		refreshing = true
+		go func() {
+			list, err := fetchTopAgents()
+			refreshed <- refresh{list, err}
+		}()
+	}
+
+	// Wake, sleep and inspect call the admin API off the loop too: a sleep
+	// lasts as long as the container takes to stop.
+	type actionResult struct {
+		status  string
+		inspect []string // set for inspect
+	}
+	results := make(chan actionResult, 4)
+	startAction := func(status string, run func() actionResult) {
+		m.status = status
+		go func() { results <- run() }()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	// A second tick keeps "changed" times and row flashes current.
+	clock := time.NewTicker(time.Second)
+	defer clock.Stop()
+
+	draw := func() {
+		width, height := 80, 24
+		if ws, err := term.GetWinsize(fd); err == nil && ws.Width > 0 {
+			width, height = int(ws.Width), int(ws.Height)
+		}
+		var buf bytes.Buffer
+		m.render(&buf, width, height)
+		os.Stdout.Write(buf.Bytes())
+	}
+
+	for {
+		draw()
+		select {
+		case u := <-updates:
+			if u.ev == nil {
+				m.stream = u.status
+				continue
+			}
+			m.stream = u.status
+			if m.apply(*u.ev) {
+				startRefresh()
+			}
+		case r := <-refreshed:
+			refreshing = false
+			if r.err != nil {
+				m.status = "refresh failed: " + r.err.Error()
+				continue
+			}
+			m.setAgents(r.list)
+		case res := <-results:
+			m.status = res.status
+			if res.inspect != nil {
+				m.inspect = res.inspect
+			}
+		case <-ticker.C:
+			startRefresh()
+		case <-clock.C:
+		case key, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			if m.inspect != nil {
+				m.inspect = nil
+				continue
+			}
+			name := m.selectedName()
+			switch key {
+			case "q":
+				return nil
+			case "up", "k":
+				m.move(-1)
+			case "down", "j":
+				m.move(1)
+			case "r":
+				startRefresh()
+			case "w", "s":
+				if name == "" {
+					continue
+				}
+				action, verb, done := "wake", "Waking", "Waking "+name
+				if key == "s" {
+					action, verb, done = "sleep", "Sleeping", name+" is asleep"
+				}
+				startAction(verb+" "+name+"...", func() actionResult {
+					if _, err := apiPost("/admin/agents/"+name+"/"+action, nil); err != nil {
+						return actionResult{status: fmt.Sprintf("%s %s failed: %v", action, name, err)}
+					}
+					return actionResult{status: done}
+				})
+			case "i":
+				if name == "" {
+					continue
+				}
+				startAction("Inspecting "+name+"...", func() actionResult {
+					data, err := apiGet("/admin/agents/" + name)
+					if err != nil {
+						return actionResult{status: fmt.Sprintf("inspect %s failed: %v", name, err)}
+					}
+					return actionResult{inspect: inspectLines(data)}
+				})
+			}
+		}
+	}
+}
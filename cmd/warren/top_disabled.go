@@ -0,0 +1,21 @@
+//go:build nodashboard
+
+package main
+
+import (
+	"errors"
+
+	"github.com/spf13/cobra"
+)
+
+// topCmd stands in for warren top, which this binary was built without.
+func topCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "top",
+		Short: "Show a live dashboard of agents and events (not compiled in)",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return errors.New("warren was built with the nodashboard tag, without warren top")
+		},
+	}
+}
@@ -0,0 +1,70 @@
+//go:build !nodashboard
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"warren/internal/events"
+)
+
+func TestTopModel(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	m := &topModel{admin: "http://warren:9090", stream: "live", now: func() time.Time { return now }}
+	m.setAgents([]*topAgent{
+		{Name: "scout", Policy: "on-demand", State: "sleeping"},
+		{Name: "kai", Policy: "always-on", State: "ready", Connections: 3},
+	})
+	m.move(1)
+	if m.selectedName() != "scout" {
+		t.Fatalf("selected %q, want scout", m.selectedName())
+	}
+
+	if m.apply(events.Event{Type: events.AgentWake, Agent: "scout", Timestamp: now}) {
+		t.Error("wake of a known agent asked for a refresh")
+	}
+	if m.agents[1].State != "starting" || !m.agents[1].changed.Equal(now) {
+		t.Errorf("scout = %+v, want starting, changed now", m.agents[1])
+	}
+	if !m.apply(events.Event{Type: events.AgentAdded, Agent: "new", Timestamp: now}) {
+		t.Error("agent.added didn't ask for a refresh")
+	}
+
+	// A refresh keeps the selection and the change time.
+	m.setAgents([]*topAgent{
+		{Name: "new", Policy: "on-demand", State: "sleeping"},
+		{Name: "scout", Policy: "on-demand", State: "starting"},
+		{Name: "kai", Policy: "always-on", State: "ready", Connections: 4},
+	})
+	if m.selectedName() != "scout" || !m.agents[2].changed.Equal(now) {
+		t.Errorf("after refresh: selected %q, scout changed %v", m.selectedName(), m.agents[2].changed)
+	}
+
+	var buf bytes.Buffer
+	m.render(&buf, 100, 24)
+	screen := buf.String()
+	for _, want := range []string{
+		"3 agents: 1 ready, 1 sleeping",
+		"> scout",
+		"  kai ",
+		"scout waking",
+		"w wake  s sleep  i inspect",
+	} {
+		if !strings.Contains(screen, want) {
+			t.Errorf("screen lacks %q:\n%s", want, screen)
+		}
+	}
+	if lines := strings.Count(screen, "\r\n") + 1; lines > 24 {
+		t.Errorf("rendered %d lines into 24", lines)
+	}
+
+	m.inspect = inspectLines([]byte(`{"name":"scout","state":"starting","connections":0}`))
+	buf.Reset()
+	m.render(&buf, 100, 24)
+	if !strings.Contains(buf.String(), "state: starting") {
+		t.Errorf("inspect view:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+func agentUpdateCmd() *cobra.Command {
+	var aliases []string
+	var noAliases bool
+	var healthURL, idleTimeout, maxUptime, checkInterval string
+	var maxFailures, maxRestartAttempts int
+	cmd := &cobra.Command{
+		Use:   "update <name>",
+		Short: "Change a running agent's settings without restarting it",
+		Long: "Change a running agent's hostname aliases, health check or idle settings in place.\n" +
+			"Unlike removing and re-adding the agent, its container keeps running and open\n" +
+			"connections are kept. Only the flags given change.",
+		Example: "  warren agent update kai --idle-timeout 2h --health-url http://kai:8080/ready\n" +
+			"  warren agent update kai --alias kai.example.org --alias k.example.com",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if noAliases && len(aliases) > 0 {
+				return fmt.Errorf("--no-aliases cannot be used with --alias")
+			}
+			patch := make(map[string]any)
+			switch {
+			case noAliases:
+				patch["hostnames"] = []string{}
+			case cmd.Flags().Changed("alias"):
+				patch["hostnames"] = aliases
+			}
+			for flag, value := range map[string]string{
+				"health-url":     healthURL,
+				"idle-timeout":   idleTimeout,
+				"max-uptime":     maxUptime,
+				"check-interval": checkInterval,
+			} {
+				if cmd.Flags().Changed(flag) {
+					patch[strings.ReplaceAll(flag, "-", "_")] = value
+				}
+			}
+			if cmd.Flags().Changed("max-failures") {
+				patch["max_failures"] = maxFailures
+			}
+			if cmd.Flags().Changed("max-restart-attempts") {
+				patch["max_restart_attempts"] = maxRestartAttempts
+			}
+			if len(patch) == 0 {
+				return fmt.Errorf("nothing to update: give at least one flag")
+			}
+
+			data, err := apiPatch("/admin/agents/"+args[0], patch)
+			if err != nil {
+				return err
+			}
+			if format == "json" {
+				fmt.Println(string(data))
+				return nil
+			}
+			var resp struct {
+				Changed []string `json:"changed"`
+			}
+			if err := json.Unmarshal(data, &resp); err != nil {
+				return fmt.Errorf("parse response: %w", err)
+			}
+			fmt.Printf("Updated %s: %s\n", args[0], strings.Join(resp.Changed, ", "))
+			return nil
+		},
+	}
+	cmd.Flags().StringSliceVar(&aliases, "alias", nil, "additional hostname, replacing the current aliases (repeatable)")
+	cmd.Flags().BoolVar(&noAliases, "no-aliases", false, "remove all hostname aliases")
+	cmd.Flags().StringVar(&healthURL, "health-url", "", "health check URL")
+	cmd.Flags().StringVar(&idleTimeout, "idle-timeout", "", "idle time before an on-demand agent sleeps, e.g. 30m")
+	cmd.Flags().StringVar(&maxUptime, "max-uptime", "", "recycle an on-demand agent after this long awake (empty turns it off)")
+	cmd.Flags().StringVar(&checkInterval, "check-interval", "", "time between health checks, e.g. 30s")
+	cmd.Flags().IntVar(&maxFailures, "max-failures", 0, "consecutive failed health checks before the agent is degraded")
+	cmd.Flags().IntVar(&maxRestartAttempts, "max-restart-attempts", 0, "restarts of a degraded on-demand agent before giving up")
+	return cmd
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"warren/internal/human"
+)
+
+// watchSettle is how long a watch waits after an event before re-rendering,
+// so a burst of events, such as a wake's starting and ready, redraws once.
+var watchSettle = 250 * time.Millisecond
+
+// watchable adds --watch and --interval to cmd, re-running it until
+// interrupted when --watch is set.
+func watchable(cmd *cobra.Command) *cobra.Command {
+	var enabled bool
+	interval := human.Duration(2 * time.Second)
+	run := cmd.RunE
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if !enabled {
+			return run(cmd, args)
+		}
+		for _, name := range []string{"exit-code", "cached"} {
+			if f := cmd.Flags().Lookup(name); f != nil && f.Changed {
+				return fmt.Errorf("--watch can't be combined with --%s", name)
+			}
+		}
+		if interval <= 0 {
+			return errors.New("--interval must be positive")
+		}
+		changed := make(chan struct{}, 1)
+		go watchEvents(changed)
+		return watch(cmd.Context(), os.Stdout, cmd.CommandPath(), time.Duration(interval), changed, func() error {
+			return run(cmd, args)
+		})
+	}
+	cmd.Flags().BoolVarP(&enabled, "watch", "w", false, "re-render every --interval and whenever an event arrives, until interrupted")
+	cmd.Flags().Var(&interval, "interval", "how often --watch re-renders without events")
+	return cmd
+}
+
+// watch clears the screen and calls render every interval, and shortly
+// after each signal on changed, until ctx is done. Errors from render are
+// shown in place of its output rather than ending the watch, so a restart
+// of the orchestrator doesn't stop it.
+func watch(ctx context.Context, w io.Writer, title string, interval time.Duration, changed <-chan struct{}, render func() error) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		fmt.Fprint(w, "\033[H\033[2J")
+		fmt.Fprintf(w, "Every %s and on events: %s    %s\n\n", human.FormatDuration(interval), title, formatTime(time.Now()))
+		if err := render(); err != nil {
+			fmt.Fprintln(w, "Error:", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-changed:
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(watchSettle):
+			}
+			// Events during the pause are covered by this render.
+			select {
+			case <-changed:
+			default:
+			}
+		}
+	}
+}
+
+// watchEvents signals changed for every event on the stream, reconnecting
+// like warren events. It gives up on errors retrying won't fix, leaving
+// the watch to its interval.
+func watchEvents(changed chan<- struct{}) {
+	var lastID string
+	wait := eventsRetry
+	for {
+		got, _, err := streamEvents("/admin/events", lastID, func(id, data string) {
+			if id != "" {
+				lastID = id
+			}
+			select {
+			case changed <- struct{}{}:
+			default:
+			}
+		})
+		if err != nil {
+			return
+		}
+		if got {
+			wait = eventsRetry
+		}
+		time.Sleep(wait)
+		wait = min(wait*2, eventsMaxRetry)
+	}
+}
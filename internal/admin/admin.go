@@ -12,18 +12,30 @@ import (
 	"log/slog"
 	"net/http"
 	"net/url"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"warren/internal/ban"
 	"warren/internal/config"
 	"warren/internal/container"
+	"warren/internal/dnscheck"
 	"warren/internal/events"
 	"warren/internal/hermes"
+	"warren/internal/human"
+	"warren/internal/labels"
+	"warren/internal/openclaw"
 	"warren/internal/policy"
 	"warren/internal/process"
 	"warren/internal/proxy"
+	"warren/internal/revisions"
+	"warren/internal/security"
 	"warren/internal/services"
+	"warren/internal/sla"
+	"warren/internal/validate"
 )
 
 // AgentInfo describes a configured agent.
@@ -39,13 +51,58 @@ type AgentInfo struct {
 
 // AddAgentRequest is the JSON body for POST /admin/agents.
 type AddAgentRequest struct {
-	Name          string `json:"name"`
-	Hostname      string `json:"hostname"`
-	Backend       string `json:"backend"`
-	Policy        string `json:"policy"`
-	ContainerName string `json:"container_name"`
-	HealthURL     string `json:"health_url"`
-	IdleTimeout   string `json:"idle_timeout"`
+	Name          string            `json:"name"`
+	Hostname      string            `json:"hostname"`
+	Backend       string            `json:"backend"`
+	Policy        string            `json:"policy"`
+	ContainerName string            `json:"container_name"`
+	HealthURL     string            `json:"health_url"`
+	IdleTimeout   string            `json:"idle_timeout"`
+	Labels        map[string]string `json:"labels,omitempty"` // e.g. {"env": "staging"}, for selectors
+}
+
+// validate checks every field of the request, returning the parsed backend
+// and idle timeout (30m if unset).
+func (req AddAgentRequest) validate() (*url.URL, time.Duration, validate.Errors) {
+	var errs validate.Errors
+	errs.Required("name", req.Name)
+	if strings.Contains(req.Name, "/") {
+		errs.Add("name", "must not contain '/'")
+	}
+	errs.Required("hostname", req.Hostname)
+	if req.Hostname != "" {
+		if err := security.ValidateHostname(req.Hostname); err != nil {
+			errs.Add("hostname", "%v", err)
+		}
+	}
+	errs.Required("backend", req.Backend)
+	target := errs.URL("backend", req.Backend)
+	errs.Required("policy", req.Policy)
+	errs.OneOf("policy", req.Policy, "on-demand", "always-on", "unmanaged")
+
+	if req.Policy == "on-demand" || req.Policy == "always-on" {
+		if req.ContainerName == "" {
+			errs.Add("container_name", "is required for the %s policy", req.Policy)
+		}
+		if req.HealthURL == "" {
+			errs.Add("health_url", "is required for the %s policy", req.Policy)
+		}
+	}
+	if req.HealthURL != "" {
+		if err := security.ValidateHealthURL(req.HealthURL); err != nil {
+			errs.Add("health_url", "%v", err)
+		}
+	}
+
+	if err := labels.Validate(req.Labels); err != nil {
+		errs.Add("labels", "%v", err)
+	}
+
+	idleTimeout := 30 * time.Minute
+	if d := errs.Duration("idle_timeout", req.IdleTimeout); d > 0 {
+		idleTimeout = d
+	}
+	return target, idleTimeout, errs
 }
 
 // AgentManager is the interface for dynamically adding/removing agents.
@@ -62,6 +119,7 @@ type Server struct {
 	cancels   map[string]context.CancelFunc
 	registry  *services.Registry
 	events    *events.Emitter
+	history   *events.History
 	manager   *container.Manager
 	prxy      *proxy.Proxy
 	cfg       *config.Config
@@ -72,6 +130,18 @@ type Server struct {
 	wsTotal   func() int64
 	hermes    *hermes.Client
 	procTracker *process.Tracker
+	sessions  *openclaw.SessionMonitor
+	identities *container.IdentityTracker
+	starter   AgentStarter
+	revisions *revisions.Log
+	checks    checks
+	dns       *dnscheck.Checker
+	slas      *sla.Tracker
+	deps      *policy.Dependencies
+	authFails *events.Throttle
+	jail      *ban.Jail
+	trash     map[string]*config.TrashedAgent // removed agents, restorable until they expire
+	trashFile string                          // where the trash is kept; empty keeps it in memory
 }
 
 // NewServer creates a new admin server.
@@ -94,12 +164,17 @@ func NewServer(
 	if cfg.AdminToken == "" {
 		l.Warn("admin API has no auth token configured — all requests will be allowed")
 	}
+	history := events.NewHistory(0)
+	if emitter != nil {
+		emitter.OnEvent(history.Add)
+	}
 	return &Server{
 		agents:      agents,
 		policies:    policies,
 		cancels:     cancels,
 		registry:    registry,
 		events:      emitter,
+		history:     history,
 		manager:     manager,
 		prxy:        prxy,
 		cfg:         cfg,
@@ -110,17 +185,75 @@ func NewServer(
 		procTracker: procTracker,
 		logger:      l,
 		startAt:     time.Now(),
+		authFails:   events.NewThrottle(time.Minute),
+		trash:       make(map[string]*config.TrashedAgent),
 	}
 }
 
+// SetSessionMonitor enables the OpenClaw sessions endpoint.
+func (s *Server) SetSessionMonitor(m *openclaw.SessionMonitor) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions = m
+}
+
+// SetDNSChecker flags agents whose hostnames don't resolve to Warren.
+func (s *Server) SetDNSChecker(c *dnscheck.Checker) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dns = c
+}
+
+// SetSLATracker shows agents' availability against their sla target in
+// inspect.
+func (s *Server) SetSLATracker(t *sla.Tracker) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.slas = t
+}
+
+// SetDependencies sleeps agents in bulk after the agents depending on them
+// and forgets removed agents' dependencies.
+func (s *Server) SetDependencies(d *policy.Dependencies) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deps = d
+}
+
+// SetJail counts failed admin auth against the client's address and serves
+// the bans endpoints.
+func (s *Server) SetJail(j *ban.Jail) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jail = j
+}
+
+// SetIdentityTracker adds the running container ID and image digest to
+// agent details.
+func (s *Server) SetIdentityTracker(t *container.IdentityTracker) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.identities = t
+}
+
 // Handler returns an http.Handler for the admin API.
 func (s *Server) Handler() http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/admin/agents", s.handleAgents)
 	mux.HandleFunc("/admin/agents/", s.handleAgent)
+	mux.HandleFunc("/admin/wake", s.handleBulk)
+	mux.HandleFunc("/admin/sleep", s.handleBulk)
 	mux.HandleFunc("/admin/services", s.handleServices)
+	mux.HandleFunc("/admin/ports", s.handlePorts)
+	mux.HandleFunc("/admin/trash", s.handleTrash)
 	mux.HandleFunc("/admin/health", s.handleHealth)
 	mux.HandleFunc("/admin/events", s.handleSSE)
+	mux.HandleFunc("/admin/route", s.handleRoute)
+	mux.HandleFunc("/admin/backup", s.handleBackup)
+	mux.HandleFunc("/admin/restore", s.handleRestore)
+	mux.HandleFunc("/admin/export", s.handleConfigExport)
+	mux.HandleFunc("/admin/bans", s.handleBans)
+	mux.HandleFunc("/admin/bans/", s.handleBan)
 	// SSH endpoints (only available if SSH is enabled)
 	if s.cfg.SSH.Enabled {
 		mux.HandleFunc("/admin/ssh/authorize", s.handleSSHAuthorize)
@@ -128,20 +261,52 @@ func (s *Server) Handler() http.Handler {
 	return s.authMiddleware(mux)
 }
 
-// authMiddleware checks for a valid Bearer token if one is configured.
+// authMiddleware checks for a valid Bearer token if one is configured, and
+// records the token as the request's actor for the revision history.
 func (s *Server) authMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if s.authToken != "" {
 			auth := r.Header.Get("Authorization")
 			if auth != "Bearer "+s.authToken {
+				s.authFailed(r, auth == "")
 				http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
 				return
 			}
+			r = r.WithContext(revisions.WithActor(r.Context(), revisions.TokenActor(s.authToken, r)))
 		}
 		next.ServeHTTP(w, r)
 	})
 }
 
+// authFailed counts a rejected admin request against the client and emits
+// a security event for it, at most once a minute per client address. As on
+// the proxy port, a request without a token isn't a strike.
+func (s *Server) authFailed(r *http.Request, missing bool) {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	s.mu.Lock()
+	jail := s.jail
+	s.mu.Unlock()
+	if jail != nil && !missing {
+		jail.Strike(remote, "admin auth")
+	}
+	ok, suppressed := s.authFails.Allow(remote)
+	if !ok || s.events == nil {
+		return
+	}
+	reason := "wrong token"
+	if missing {
+		reason = "missing token"
+	}
+	fields := map[string]string{"source": "admin", "remote": remote, "method": r.Method, "path": r.URL.Path, "reason": reason}
+	if suppressed > 0 {
+		fields["suppressed"] = strconv.Itoa(suppressed)
+	}
+	s.events.Emit(events.Event{Type: events.SecurityAuthFailed, Fields: fields})
+}
+
 func (s *Server) handleAgents(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
@@ -153,7 +318,9 @@ func (s *Server) handleAgents(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (s *Server) listAgents(w http.ResponseWriter, _ *http.Request) {
+// listAgents serves GET /admin/agents, optionally only the agents whose
+// labels match ?selector=, e.g. env=staging.
+func (s *Server) listAgents(w http.ResponseWriter, r *http.Request) {
 	type agentResp struct {
 		AgentInfo
 		Type        string `json:"type"`
@@ -162,6 +329,18 @@ func (s *Server) listAgents(w http.ResponseWriter, _ *http.Request) {
 		Runtime     string `json:"runtime,omitempty"`
 		TaskID      string `json:"task_id,omitempty"`
 		SessionID   string `json:"session_id,omitempty"`
+		HeldUntil   *time.Time `json:"held_until,omitempty"`
+		DNSMismatch []string   `json:"dns_mismatch,omitempty"`
+		Annotations map[string]string `json:"annotations,omitempty"`
+		Labels      map[string]string `json:"labels,omitempty"`
+	}
+
+	sel, err := labels.Parse(r.URL.Query().Get("selector"))
+	if err != nil {
+		var errs validate.Errors
+		errs.Add("selector", "%v", err)
+		validate.Write(w, errs)
+		return
 	}
 
 	s.mu.RLock()
@@ -172,18 +351,31 @@ func (s *Server) listAgents(w http.ResponseWriter, _ *http.Request) {
 	// Container-based agents.
 	for name, info := range s.agents {
 		state := "unknown"
+		var held *time.Time
 		if pol, ok := s.policies[name]; ok {
 			state = pol.State()
+			held = heldUntil(pol)
 		}
 		var conns int64
 		if s.prxy != nil {
 			conns = s.prxy.WSCounter().Count(info.Hostname)
 		}
-		result = append(result, agentResp{AgentInfo: info, Type: "container", State: state, Connections: conns})
+		var mismatch []string
+		if s.dns != nil {
+			mismatch = s.dns.Mismatches(name)
+		}
+		var annotations, agentLabels map[string]string
+		if agent := s.cfg.Agents[name]; agent != nil {
+			annotations, agentLabels = agent.Annotations, agent.Labels
+		}
+		if !sel.Matches(agentLabels) {
+			continue
+		}
+		result = append(result, agentResp{AgentInfo: info, Type: "container", State: state, Connections: conns, HeldUntil: held, DNSMismatch: mismatch, Annotations: annotations, Labels: agentLabels})
 	}
 
-	// Process-based agents (CC sessions).
-	if s.procTracker != nil {
+	// Process-based agents (CC sessions), which have no labels.
+	if s.procTracker != nil && sel.Matches(nil) {
 		for _, pa := range s.procTracker.List() {
 			result = append(result, agentResp{
 				AgentInfo: AgentInfo{Name: pa.Name},
@@ -201,38 +393,13 @@ func (s *Server) listAgents(w http.ResponseWriter, _ *http.Request) {
 }
 
 func (s *Server) addAgent(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxBody())
 	var req AddAgentRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
-		return
-	}
-
-	if req.Name == "" || req.Hostname == "" || req.Backend == "" || req.Policy == "" {
-		http.Error(w, `{"error":"name, hostname, backend, and policy are required"}`, http.StatusBadRequest)
-		return
-	}
-
-	switch req.Policy {
-	case "on-demand", "always-on", "unmanaged":
-	default:
-		http.Error(w, `{"error":"policy must be on-demand, always-on, or unmanaged"}`, http.StatusBadRequest)
+	if validate.Write(w, validate.Decode(r, &req)) {
 		return
 	}
-
-	if (req.Policy == "on-demand" || req.Policy == "always-on") && req.ContainerName == "" {
-		http.Error(w, `{"error":"container_name required for on-demand/always-on policy"}`, http.StatusBadRequest)
-		return
-	}
-
-	if (req.Policy == "on-demand" || req.Policy == "always-on") && req.HealthURL == "" {
-		http.Error(w, `{"error":"health_url required for on-demand/always-on policy"}`, http.StatusBadRequest)
-		return
-	}
-
-	target, err := url.Parse(req.Backend)
-	if err != nil {
-		http.Error(w, `{"error":"invalid backend URL"}`, http.StatusBadRequest)
+	target, idleTimeout, errs := req.validate()
+	if validate.Write(w, errs) {
 		return
 	}
 
@@ -244,44 +411,9 @@ func (s *Server) addAgent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Parse idle timeout.
-	idleTimeout := 30 * time.Minute
-	if req.IdleTimeout != "" {
-		idleTimeout, err = time.ParseDuration(req.IdleTimeout)
-		if err != nil {
-			http.Error(w, `{"error":"invalid idle_timeout"}`, http.StatusBadRequest)
-			return
-		}
-	}
-
 	// Create policy.
-	var pol policy.Policy
 	ctx, cancel := context.WithCancel(context.Background())
-
-	switch req.Policy {
-	case "always-on":
-		pol = policy.NewAlwaysOn(policy.AlwaysOnConfig{
-			Agent:         req.Name,
-			HealthURL:     req.HealthURL,
-			CheckInterval: 30 * time.Second,
-			MaxFailures:   3,
-		}, s.events, s.logger)
-	case "on-demand":
-		pol = policy.NewOnDemand(s.manager, policy.OnDemandConfig{
-			Agent:              req.Name,
-			ContainerName:      req.ContainerName,
-			HealthURL:          req.HealthURL,
-			Hostname:           req.Hostname,
-			CheckInterval:      30 * time.Second,
-			StartupTimeout:     60 * time.Second,
-			IdleTimeout:        idleTimeout,
-			WakeCooldown:       30 * time.Second,
-			MaxFailures:        3,
-			MaxRestartAttempts: 10,
-		}, s.prxy.Activity(), s.prxy.WSCounter(), s.events, s.logger)
-	case "unmanaged":
-		pol = policy.NewUnmanaged()
-	}
+	pol := s.newPolicy(req.Name, req.Policy, req.ContainerName, req.HealthURL, req.Hostname, idleTimeout)
 
 	// Register in proxy.
 	s.prxy.Register(req.Hostname, req.Name, target, pol)
@@ -289,6 +421,10 @@ func (s *Server) addAgent(w http.ResponseWriter, r *http.Request) {
 	// Start policy goroutine.
 	go pol.Start(ctx)
 
+	if req.IdleTimeout != "" {
+		req.IdleTimeout = human.FormatDuration(idleTimeout)
+	}
+
 	// Store in admin state.
 	s.agents[req.Name] = AgentInfo{
 		Name:          req.Name,
@@ -310,15 +446,16 @@ func (s *Server) addAgent(w http.ResponseWriter, r *http.Request) {
 		Container: config.Container{Name: req.ContainerName},
 		Health: config.Health{
 			URL:                req.HealthURL,
-			CheckInterval:      30 * time.Second,
-			StartupTimeout:     60 * time.Second,
+			CheckInterval:      human.Duration(30 * time.Second),
+			StartupTimeout:     human.Duration(60 * time.Second),
 			MaxFailures:        3,
 			MaxRestartAttempts: 10,
 		},
 		Idle: config.IdleConfig{
-			Timeout:      idleTimeout,
-			DrainTimeout: 30 * time.Second,
+			Timeout:      human.Duration(idleTimeout),
+			DrainTimeout: human.Duration(30 * time.Second),
 		},
+		Labels: req.Labels,
 	}
 	if s.cfg.Agents == nil {
 		s.cfg.Agents = make(map[string]*config.Agent)
@@ -328,6 +465,7 @@ func (s *Server) addAgent(w http.ResponseWriter, r *http.Request) {
 		s.logger.Error("failed to persist config after adding agent", "error", err)
 	}
 
+	s.recordAgent(req.Name, revisions.ActionCreated, revisions.Actor(r), agent)
 	s.events.Emit(events.Event{Type: events.AgentAdded, Agent: req.Name})
 	s.logger.Info("agent added via API", "name", req.Name, "hostname", req.Hostname)
 
@@ -336,6 +474,100 @@ func (s *Server) addAgent(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok", "name": req.Name})
 }
 
+// updateAgent serves PUT /admin/agents/{name}. The body is an
+// AddAgentRequest; its fields replace the agent's, the rest of its config
+// (aliases, container settings, and labels unless given) is kept, and the
+// agent is restarted.
+func (s *Server) updateAgent(w http.ResponseWriter, r *http.Request, name string) {
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxBody())
+	var req AddAgentRequest
+	if validate.Write(w, validate.Decode(r, &req)) {
+		return
+	}
+	if req.Name == "" {
+		req.Name = name
+	}
+	_, idleTimeout, errs := req.validate()
+	if req.Name != name {
+		errs.Add("name", "must match the agent being updated (%s)", name)
+	}
+	if validate.Write(w, errs) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.agents[name]; !exists {
+		http.Error(w, `{"error":"agent not found"}`, http.StatusNotFound)
+		return
+	}
+	if b, ok := s.prxy.Backend(req.Hostname); ok && b.AgentName != name {
+		http.Error(w, `{"error":"hostname is in use by another agent"}`, http.StatusConflict)
+		return
+	}
+
+	agent := &config.Agent{
+		Health: config.Health{CheckInterval: human.Duration(30 * time.Second), StartupTimeout: human.Duration(60 * time.Second), MaxFailures: 3, MaxRestartAttempts: 10},
+		Idle:   config.IdleConfig{DrainTimeout: human.Duration(30 * time.Second)},
+	}
+	if current := s.cfg.Agents[name]; current != nil {
+		copied := *current
+		agent = &copied
+	}
+	agent.Hostname = req.Hostname
+	agent.Backend = req.Backend
+	agent.Policy = req.Policy
+	agent.Container.Name = req.ContainerName
+	agent.Health.URL = req.HealthURL
+	agent.Idle.Timeout = human.Duration(idleTimeout)
+	if req.Labels != nil {
+		agent.Labels = req.Labels
+	}
+
+	if err := s.replaceAgent(name, agent); err != nil {
+		s.logger.Error("failed to start updated agent", "name", name, "error", err)
+		http.Error(w, `{"error":"failed to start updated agent"}`, http.StatusInternalServerError)
+		return
+	}
+	s.saveConfig("updating agent")
+
+	s.recordAgent(name, revisions.ActionUpdated, revisions.Actor(r), agent)
+	s.logger.Info("agent updated via API", "name", name, "hostname", agent.Hostname)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok", "name": name})
+}
+
+// newPolicy creates an agent's policy with the admin API's default health
+// and wake settings.
+func (s *Server) newPolicy(name, pol, containerName, healthURL, hostname string, idleTimeout time.Duration) policy.Policy {
+	switch pol {
+	case "always-on":
+		return policy.NewAlwaysOn(policy.AlwaysOnConfig{
+			Agent:         name,
+			HealthURL:     healthURL,
+			CheckInterval: 30 * time.Second,
+			MaxFailures:   3,
+		}, s.events, s.logger)
+	case "on-demand":
+		return policy.NewOnDemand(s.manager, policy.OnDemandConfig{
+			Agent:              name,
+			ContainerName:      containerName,
+			HealthURL:          healthURL,
+			Hostname:           hostname,
+			CheckInterval:      30 * time.Second,
+			StartupTimeout:     60 * time.Second,
+			IdleTimeout:        idleTimeout,
+			WakeCooldown:       30 * time.Second,
+			MaxFailures:        3,
+			MaxRestartAttempts: 10,
+		}, s.prxy.Activity(), s.prxy.WSCounter(), s.events, s.logger)
+	default:
+		return policy.NewUnmanaged()
+	}
+}
+
 func (s *Server) handleAgent(w http.ResponseWriter, r *http.Request) {
 	// Parse: /admin/agents/{name}[/action]
 	path := strings.TrimPrefix(r.URL.Path, "/admin/agents/")
@@ -353,13 +585,49 @@ func (s *Server) handleAgent(w http.ResponseWriter, r *http.Request) {
 
 	// DELETE /admin/agents/{name}
 	if r.Method == http.MethodDelete && action == "" {
-		s.removeAgent(w, name)
+		s.removeAgent(w, name, revisions.Actor(r), r.URL.Query().Get("force") == "true")
+		return
+	}
+
+	// PUT /admin/agents/{name}
+	if r.Method == http.MethodPut && action == "" {
+		s.updateAgent(w, r, name)
+		return
+	}
+
+	// PATCH /admin/agents/{name}
+	if r.Method == http.MethodPatch && action == "" {
+		s.patchAgent(w, r, name)
+		return
+	}
+
+	// POST /admin/agents/{name}/restore
+	if r.Method == http.MethodPost && action == "restore" {
+		s.restoreAgent(w, name, revisions.Actor(r))
+		return
+	}
+
+	// GET /admin/agents/{name}/revisions, POST /admin/agents/{name}/rollback
+	// work for removed agents too.
+	if r.Method == http.MethodGet && action == "revisions" {
+		s.listRevisions(w, name)
+		return
+	}
+	if r.Method == http.MethodPost && action == "rollback" {
+		s.rollbackAgent(w, r, name)
 		return
 	}
 
 	s.mu.RLock()
 	info, ok := s.agents[name]
 	pol := s.policies[name]
+	identities := s.identities
+	var annotations, agentLabels map[string]string
+	var dependsOn []string
+	if agent := s.cfg.Agents[name]; agent != nil {
+		annotations, agentLabels, dependsOn = agent.Annotations, agent.Labels, agent.DependsOn
+	}
+	dependents := s.dependents(name)
 	s.mu.RUnlock()
 
 	if !ok {
@@ -379,7 +647,7 @@ func (s *Server) handleAgent(w http.ResponseWriter, r *http.Request) {
 		if s.prxy != nil {
 			conns = s.prxy.WSCounter().Count(info.Hostname)
 		}
-		_ = json.NewEncoder(w).Encode(map[string]any{
+		resp := map[string]any{
 			"name":           info.Name,
 			"hostname":       info.Hostname,
 			"policy":         info.Policy,
@@ -389,7 +657,150 @@ func (s *Server) handleAgent(w http.ResponseWriter, r *http.Request) {
 			"idle_timeout":   info.IdleTimeout,
 			"state":          state,
 			"connections":    conns,
-		})
+		}
+		if s.dns != nil {
+			if m := s.dns.Mismatches(name); len(m) > 0 {
+				resp["dns_mismatch"] = m
+			}
+		}
+		if s.slas != nil {
+			if st, ok := s.slas.Status(name); ok {
+				resp["sla"] = st.String()
+			}
+		}
+		if s.prxy != nil {
+			if jobs := s.prxy.Jobs().List(name); len(jobs) > 0 {
+				resp["jobs"] = jobs
+			}
+			if b, ok := s.prxy.Backend(info.Hostname); ok {
+				opts := b.Options
+				if opts.Breaker != nil {
+					resp["circuit"] = opts.Breaker.Status()
+				}
+				if opts.Timeouts != nil {
+					resp["timeouts"] = opts.Timeouts.String()
+				}
+				if opts.Protocol != "" {
+					resp["backend_protocol"] = opts.Protocol
+				}
+				if opts.GRPC {
+					resp["grpc"] = true
+				}
+				if opts.MaxWebSockets > 0 {
+					resp["websockets"] = fmt.Sprintf("%d/%d", s.prxy.WebSockets(name), opts.MaxWebSockets)
+				}
+				if len(opts.AllowedPaths) > 0 {
+					resp["blocked_paths"] = s.prxy.BlockedPaths()[name]
+				}
+				if opts.CORS != nil {
+					resp["cors"] = opts.CORS.String()
+				}
+				if opts.Headers != nil {
+					resp["headers"] = opts.Headers.String()
+				}
+				if opts.Cache != nil {
+					resp["cache"] = opts.Cache.Stats()
+				}
+				if opts.Pool != nil {
+					resp["balance"] = opts.Pool.Strategy()
+					resp["backends"] = opts.Pool.Status()
+					if st := opts.Pool.Sticky(); st != nil {
+						resp["sticky"] = st.String()
+					}
+				}
+			}
+		}
+		if ports := s.registry.Ports(name); len(ports) > 0 {
+			resp["published_ports"] = ports
+		}
+		if s.prxy != nil {
+			if ports := s.prxy.Ports().Status(name); len(ports) > 0 {
+				resp["ports"] = ports
+			}
+		}
+		if len(annotations) > 0 {
+			resp["annotations"] = annotations
+		}
+		if len(agentLabels) > 0 {
+			resp["labels"] = agentLabels
+		}
+		if len(dependsOn) > 0 {
+			resp["depends_on"] = dependsOn
+		}
+		if len(dependents) > 0 {
+			resp["dependents"] = dependents
+		}
+		if held := heldUntil(pol); held != nil {
+			resp["held_until"] = held
+		}
+		if od, ok := pol.(*policy.OnDemand); ok && od.Paused() {
+			resp["paused"] = true
+		}
+		if od, ok := pol.(*policy.OnDemand); ok {
+			if used, max, action := od.WakeBudget(); max > 0 {
+				resp["wake_budget"] = fmt.Sprintf("%d/%d today (%s)", used, max, action)
+			}
+		}
+		if identities != nil {
+			if id, ok := identities.Get(name); ok {
+				resp["container_id"] = id.ContainerID
+				resp["image"] = id.Image
+				if id.ImageDigest != "" {
+					resp["image_digest"] = id.ImageDigest
+				}
+			}
+		}
+		if r.URL.Query().Get("container") == "true" {
+			if info.Policy == "unmanaged" || info.ContainerName == "" {
+				http.Error(w, `{"error":"agent has no managed container"}`, http.StatusBadRequest)
+				return
+			}
+			if s.manager == nil {
+				http.Error(w, `{"error":"container runtime not available"}`, http.StatusServiceUnavailable)
+				return
+			}
+			details, err := s.manager.Inspect(r.Context(), info.ContainerName)
+			if err != nil {
+				s.logger.Error("container inspect failed", "agent", name, "error", err)
+				http.Error(w, `{"error":"container inspect failed"}`, http.StatusBadGateway)
+				return
+			}
+			resp["container"] = details
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+
+	case r.Method == http.MethodGet && action == "export":
+		s.handleExport(w, r, name)
+
+	case r.Method == http.MethodPatch && action == "annotations":
+		s.patchAnnotations(w, r, name)
+
+	case r.Method == http.MethodGet && action == "wake":
+		od, ok := pol.(*policy.OnDemand)
+		if !ok {
+			http.Error(w, `{"error":"wake tracing is only available for on-demand agents"}`, http.StatusBadRequest)
+			return
+		}
+		trace, ok := od.LastWake()
+		if !ok {
+			http.Error(w, `{"error":"no wake recorded yet"}`, http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(trace)
+
+	case r.Method == http.MethodGet && action == "sessions":
+		s.mu.RLock()
+		monitor := s.sessions
+		s.mu.RUnlock()
+		if monitor == nil || !monitor.Registered(name) {
+			http.Error(w, `{"error":"openclaw session polling not configured for agent"}`, http.StatusNotFound)
+			return
+		}
+		snap, ok := monitor.Snapshot(name)
+		if !ok {
+			snap = openclaw.Snapshot{Agent: name, Sessions: []openclaw.Session{}}
+		}
+		_ = json.NewEncoder(w).Encode(snap)
 
 	case r.Method == http.MethodPost && action == "wake":
 		od, ok := pol.(*policy.OnDemand)
@@ -397,8 +808,23 @@ func (s *Server) handleAgent(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, `{"error":"agent is not on-demand"}`, http.StatusBadRequest)
 			return
 		}
+		// Optional body: {"keep_awake": "1h"} holds the agent awake after waking.
+		var req struct {
+			KeepAwake string `json:"keep_awake"`
+		}
+		errs := validate.Decode(r, &req)
+		keepAwake := errs.Duration("keep_awake", req.KeepAwake)
+		if validate.Write(w, errs) {
+			return
+		}
+		resp := map[string]string{"status": "waking"}
+		if keepAwake > 0 {
+			od.Hold(keepAwake)
+			until, _ := od.HeldUntil()
+			resp["held_until"] = until.Format(time.RFC3339)
+		}
 		od.Wake()
-		_ = json.NewEncoder(w).Encode(map[string]string{"status": "waking"})
+		_ = json.NewEncoder(w).Encode(resp)
 
 	case r.Method == http.MethodPost && action == "sleep":
 		od, ok := pol.(*policy.OnDemand)
@@ -406,6 +832,19 @@ func (s *Server) handleAgent(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, `{"error":"agent is not on-demand"}`, http.StatusBadRequest)
 			return
 		}
+		s.mu.RLock()
+		deps := s.deps
+		s.mu.RUnlock()
+		if deps != nil {
+			if awake := deps.AwakeDependents(name); len(awake) > 0 {
+				w.WriteHeader(http.StatusConflict)
+				_ = json.NewEncoder(w).Encode(map[string]any{
+					"error":      "agents depending on it are awake, put them to sleep first",
+					"dependents": awake,
+				})
+				return
+			}
+		}
 		od.Sleep(r.Context())
 		_ = json.NewEncoder(w).Encode(map[string]string{"status": "sleeping"})
 
@@ -414,7 +853,22 @@ func (s *Server) handleAgent(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (s *Server) removeAgent(w http.ResponseWriter, name string) {
+// heldUntil returns when an on-demand agent's manual hold expires, or nil.
+func heldUntil(pol policy.Policy) *time.Time {
+	od, ok := pol.(*policy.OnDemand)
+	if !ok {
+		return nil
+	}
+	until, ok := od.HeldUntil()
+	if !ok {
+		return nil
+	}
+	return &until
+}
+
+// removeAgent deletes an agent. Unless force is set, an agent with active
+// connections is refused with 409 and the connection count.
+func (s *Server) removeAgent(w http.ResponseWriter, name, actor string, force bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -424,6 +878,29 @@ func (s *Server) removeAgent(w http.ResponseWriter, name string) {
 		return
 	}
 
+	if !force && s.prxy != nil {
+		if conns := s.prxy.WSCounter().Count(info.Hostname); conns > 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"error":       "agent has active connections, use force=true to remove anyway",
+				"connections": conns,
+			})
+			return
+		}
+	}
+
+	// Agents depending on it couldn't wake, and the config wouldn't load.
+	if dependents := s.dependents(name); len(dependents) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"error":      "agent is in other agents' depends_on, remove it there first",
+			"dependents": dependents,
+		})
+		return
+	}
+
 	// Cancel policy goroutine.
 	if cancel, ok := s.cancels[name]; ok {
 		cancel()
@@ -436,18 +913,43 @@ func (s *Server) removeAgent(w http.ResponseWriter, name string) {
 	// Remove from admin state.
 	delete(s.agents, name)
 	delete(s.policies, name)
+	if s.deps != nil {
+		s.deps.Remove(name)
+	}
+	if s.identities != nil {
+		s.identities.Unregister(name)
+	}
 
-	// Remove from config and persist.
+	// Move to the trash, remove from config and persist.
+	restorable := s.trashAgent(name, info)
 	delete(s.cfg.Agents, name)
 	if err := config.Save(s.cfg, s.cfgPath); err != nil {
 		s.logger.Error("failed to persist config after removing agent", "error", err)
 	}
 
+	s.recordAgent(name, revisions.ActionRemoved, actor, nil)
 	s.events.Emit(events.Event{Type: events.AgentRemoved, Agent: name})
 	s.logger.Info("agent removed via API", "name", name)
 
+	resp := map[string]any{"status": "ok"}
+	if restorable != nil {
+		resp["restorable_until"] = restorable
+	}
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// dependents returns the agents whose depends_on lists name, sorted.
+// Caller must hold s.mu.
+func (s *Server) dependents(name string) []string {
+	var names []string
+	for other, agent := range s.cfg.Agents {
+		if slices.Contains(agent.DependsOn, name) {
+			names = append(names, other)
+		}
+	}
+	sort.Strings(names)
+	return names
 }
 
 func (s *Server) handleServices(w http.ResponseWriter, r *http.Request) {
@@ -459,6 +961,20 @@ func (s *Server) handleServices(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(s.registry.List())
 }
 
+// handlePorts lists the host ports Warren has published for agents.
+func (s *Server) handlePorts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+	ports := s.registry.AllPorts()
+	if ports == nil {
+		ports = []services.PortMapping{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(ports)
+}
+
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
@@ -483,9 +999,20 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 
 	serviceCount := len(s.registry.List())
 
+	// Any failing subsystem makes the whole orchestrator degraded, even
+	// while every agent is fine.
+	status := "ok"
+	checks := s.runChecks(r.Context())
+	for _, c := range checks {
+		if c.Status != "ok" {
+			status = "degraded"
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(map[string]any{
-		"status":          "ok",
+		"status":          status,
+		"checks":          checks,
 		"uptime_seconds":  time.Since(s.startAt).Seconds(),
 		"agent_count":     agentCount,
 		"ready_count":     readyCount,
@@ -495,7 +1022,13 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// handleSSE streams events as Server-Sent Events.
+// sseKeepalive is how often an idle event stream gets a comment, so proxies
+// in between don't drop it.
+var sseKeepalive = 15 * time.Second
+
+// handleSSE streams events as Server-Sent Events. Each carries its history
+// ID, so a client that reconnects with Last-Event-ID first gets the events
+// it missed, unless the orchestrator restarted in between.
 func (s *Server) handleSSE(w http.ResponseWriter, r *http.Request) {
 	flusher, ok := w.(http.Flusher)
 	if !ok {
@@ -508,23 +1041,52 @@ func (s *Server) handleSSE(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Connection", "keep-alive")
 	flusher.Flush()
 
-	ch := make(chan events.Event, 64)
-	id := s.events.OnEvent(func(ev events.Event) {
+	lastID := s.history.After(r.Header.Get("Last-Event-ID"))
+	// ?security=true narrows the stream to security events, starting with
+	// the kept ones so a fresh connection shows what happened recently.
+	securityOnly, _ := strconv.ParseBool(r.URL.Query().Get("security"))
+	ch := make(chan events.Entry, 64)
+	follow := func(e events.Entry) {
+		if securityOnly && !events.IsSecurity(e.Event.Type) {
+			return
+		}
 		select {
-		case ch <- ev:
+		case ch <- e:
 		default: // drop if client is slow
 		}
-	})
+	}
+	var backlog []events.Entry
+	var stop func()
+	if securityOnly && lastID == 0 {
+		backlog, stop = s.history.Replay(follow)
+	} else {
+		backlog, stop = s.history.Follow(lastID, follow)
+	}
+	defer stop()
 
-	defer s.events.RemoveHandler(id)
+	write := func(e events.Entry) {
+		data, _ := json.Marshal(e.Event)
+		fmt.Fprintf(w, "id: %s\ndata: %s\n\n", s.history.EventID(e), data)
+	}
+	for _, e := range backlog {
+		if securityOnly && !events.IsSecurity(e.Event.Type) {
+			continue
+		}
+		write(e)
+	}
+	flusher.Flush()
 
+	keepalive := time.NewTicker(sseKeepalive)
+	defer keepalive.Stop()
 	for {
 		select {
 		case <-r.Context().Done():
 			return
-		case ev := <-ch:
-			data, _ := json.Marshal(ev)
-			fmt.Fprintf(w, "data: %s\n\n", data)
+		case e := <-ch:
+			write(e)
+			flusher.Flush()
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
 			flusher.Flush()
 		}
 	}
@@ -551,6 +1113,24 @@ func (s *Server) RemoveAgentInternal(name string) {
 	delete(s.policies, name)
 }
 
+// WakeBudgets returns today's wakes and the budget of each on-demand agent
+// with a wake budget, for metrics.
+func (s *Server) WakeBudgets() (used, max map[string]int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	used, max = make(map[string]int), make(map[string]int)
+	for name, pol := range s.policies {
+		od, ok := pol.(*policy.OnDemand)
+		if !ok {
+			continue
+		}
+		if n, m, _ := od.WakeBudget(); m > 0 {
+			used[name], max[name] = n, m
+		}
+	}
+	return used, max
+}
+
 // ListenAndServe starts the admin server on the given address.
 func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
 	srv := &http.Server{
@@ -1,19 +1,26 @@
 package admin
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"context"
+	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"warren/internal/config"
 	"warren/internal/events"
 	"warren/internal/policy"
 	"warren/internal/proxy"
 	"warren/internal/services"
+	"warren/internal/validate"
 )
 
 func testServer(t *testing.T) (*Server, string) {
@@ -138,6 +145,45 @@ func TestAddAndRemoveAgent(t *testing.T) {
 	}
 }
 
+
+func TestRemoveAgentWithConnections(t *testing.T) {
+	srv, _ := testServer(t)
+	handler := srv.Handler()
+
+	body, _ := json.Marshal(AddAgentRequest{
+		Name:     "busy",
+		Hostname: "busy.example.com",
+		Backend:  "http://localhost:18790",
+		Policy:   "unmanaged",
+	})
+	req := httptest.NewRequest("POST", "/admin/agents", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != 201 {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	srv.prxy.WSCounter().Inc("busy.example.com")
+
+	req = httptest.NewRequest("DELETE", "/admin/agents/busy", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != 409 {
+		t.Fatalf("expected 409, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp map[string]any
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp["connections"] != float64(1) {
+		t.Errorf("connections = %v, want 1", resp["connections"])
+	}
+
+	req = httptest.NewRequest("DELETE", "/admin/agents/busy?force=true", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("expected 200 with force, got %d: %s", w.Code, w.Body.String())
+	}
+}
 func TestAddAgentDuplicate(t *testing.T) {
 	srv, _ := testServer(t)
 	handler := srv.Handler()
@@ -173,8 +219,138 @@ func TestAddAgentValidation(t *testing.T) {
 	req := httptest.NewRequest("POST", "/admin/agents", bytes.NewReader(body))
 	w := httptest.NewRecorder()
 	handler.ServeHTTP(w, req)
-	if w.Code != 400 {
-		t.Fatalf("expected 400, got %d", w.Code)
+	if w.Code != 422 {
+		t.Fatalf("expected 422, got %d", w.Code)
+	}
+	var resp validate.Response
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	fields := map[string]bool{}
+	for _, f := range resp.Fields {
+		fields[f.Field] = true
+	}
+	for _, want := range []string{"hostname", "backend", "policy"} {
+		if !fields[want] {
+			t.Errorf("missing error for %s in %s", want, w.Body.String())
+		}
+	}
+
+	// Typos and bad values are reported per field rather than ignored.
+	req = httptest.NewRequest("POST", "/admin/agents", strings.NewReader(
+		`{"name":"x","hostname":"x.example.com","backend":"localhost:80","policy":"on-demnd","idle_timout":"5m","idle_timeout":"5 minutes"}`))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != 422 || !strings.Contains(w.Body.String(), `"field":"idle_timout","message":"unknown field"`) {
+		t.Fatalf("unknown field: %d %s", w.Code, w.Body.String())
+	}
+	req = httptest.NewRequest("POST", "/admin/agents", strings.NewReader(
+		`{"name":"x","hostname":"x.example.com","backend":"localhost:80","policy":"on-demnd","idle_timeout":"5 minutes"}`))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	resp = validate.Response{}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	fields = map[string]bool{}
+	for _, f := range resp.Fields {
+		fields[f.Field] = true
+	}
+	for _, want := range []string{"backend", "policy", "idle_timeout"} {
+		if !fields[want] {
+			t.Errorf("missing error for %s in %s", want, w.Body.String())
+		}
+	}
+	if _, exists := srv.agents["x"]; exists {
+		t.Error("invalid agent should not have been added")
+	}
+}
+
+func TestUpdateAgent(t *testing.T) {
+	srv, _ := testServer(t)
+	handler := srv.Handler()
+
+	body, _ := json.Marshal(AddAgentRequest{
+		Name:     "kai",
+		Hostname: "kai.example.com",
+		Backend:  "http://localhost:18790",
+		Policy:   "unmanaged",
+	})
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/admin/agents", bytes.NewReader(body)))
+	if w.Code != 201 {
+		t.Fatalf("add: %d %s", w.Code, w.Body.String())
+	}
+	srv.cfg.Agents["kai"].Hostnames = []string{"alias.example.com"}
+
+	body, _ = json.Marshal(AddAgentRequest{
+		Hostname:    "kai2.example.com",
+		Backend:     "http://localhost:18791",
+		Policy:      "unmanaged",
+		IdleTimeout: "1h",
+	})
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("PUT", "/admin/agents/kai", bytes.NewReader(body)))
+	if w.Code != 200 {
+		t.Fatalf("update: %d %s", w.Code, w.Body.String())
+	}
+	backends := srv.prxy.Backends()
+	if _, ok := backends["kai.example.com"]; ok {
+		t.Error("old hostname still routed")
+	}
+	if b, ok := backends["kai2.example.com"]; !ok || b.Target.String() != "http://localhost:18791" {
+		t.Errorf("new hostname routed to %v", b)
+	}
+	agent := srv.cfg.Agents["kai"]
+	if time.Duration(agent.Idle.Timeout) != time.Hour || len(agent.Hostnames) != 1 {
+		t.Errorf("updated config = %+v, want the new idle timeout and the alias kept", agent)
+	}
+	if srv.agents["kai"].Backend != "http://localhost:18791" {
+		t.Errorf("admin state = %+v", srv.agents["kai"])
+	}
+
+	// The name is taken from the path and can't be changed.
+	body, _ = json.Marshal(AddAgentRequest{Name: "other", Hostname: "kai2.example.com", Backend: "http://localhost:18791", Policy: "unmanaged"})
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("PUT", "/admin/agents/kai", bytes.NewReader(body)))
+	if w.Code != 422 {
+		t.Errorf("rename: %d, want 422", w.Code)
+	}
+	body, _ = json.Marshal(AddAgentRequest{Hostname: "missing.example.com", Backend: "http://localhost:18791", Policy: "unmanaged"})
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("PUT", "/admin/agents/missing", bytes.NewReader(body)))
+	if w.Code != 404 {
+		t.Errorf("update missing agent: %d", w.Code)
+	}
+}
+
+func TestUpdateAgentRestoresOnFailedStart(t *testing.T) {
+	srv, _ := testServer(t)
+	handler := srv.Handler()
+
+	body, _ := json.Marshal(AddAgentRequest{Name: "kai", Hostname: "kai.example.com", Backend: "http://localhost:18790", Policy: "unmanaged"})
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/admin/agents", bytes.NewReader(body)))
+	if w.Code != 201 {
+		t.Fatalf("add: %d %s", w.Code, w.Body.String())
+	}
+	srv.SetAgentStarter(func(name string, agent *config.Agent) (policy.Policy, context.CancelFunc, error) {
+		if agent.Backend == "http://localhost:18799" {
+			return nil, nil, errors.New("no such backend")
+		}
+		target, _ := url.Parse(agent.Backend)
+		pol := policy.NewUnmanaged()
+		srv.prxy.Register(agent.Hostname, name, target, pol)
+		return pol, func() {}, nil
+	})
+
+	body, _ = json.Marshal(AddAgentRequest{Hostname: "kai2.example.com", Backend: "http://localhost:18799", Policy: "unmanaged"})
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("PUT", "/admin/agents/kai", bytes.NewReader(body)))
+	if w.Code != 500 {
+		t.Fatalf("update: %d, want 500", w.Code)
+	}
+	if b, ok := srv.prxy.Backend("kai.example.com"); !ok || b.Target.String() != "http://localhost:18790" {
+		t.Errorf("old hostname routed to %v, want the previous agent back", b)
+	}
+	if _, ok := srv.agents["kai"]; !ok || srv.cfg.Agents["kai"].Backend != "http://localhost:18790" {
+		t.Errorf("agent state after failed update = %+v", srv.cfg.Agents["kai"])
 	}
 }
 
@@ -215,3 +391,98 @@ func TestSSEEndpoint(t *testing.T) {
 	// with httptest.NewRecorder, but we verify it doesn't panic.
 	// In a real test we'd use a pipe-based approach.
 }
+
+func TestSSEResumesFromLastEventID(t *testing.T) {
+	srv, _ := testServer(t)
+	for _, typ := range []string{events.AgentWake, events.AgentStarting, events.AgentReady} {
+		srv.events.Emit(events.Event{Type: typ, Agent: "a"})
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", ts.URL+"/admin/events", nil)
+	req.Header.Set("Last-Event-ID", srv.history.EventID(events.Entry{ID: 1}))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// The events after 1 are replayed, then new ones follow.
+	go srv.events.Emit(events.Event{Type: events.AgentSleep, Agent: "a"})
+	var got []string
+	scanner := bufio.NewScanner(resp.Body)
+	for len(got) < 6 && scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			got = append(got, line)
+		}
+	}
+	id := func(n uint64) string { return "id: " + srv.history.EventID(events.Entry{ID: n}) }
+	want := []string{id(2), "agent.starting", id(3), "agent.ready", id(4), "agent.sleep"}
+	for i, w := range want {
+		if i >= len(got) || !strings.Contains(got[i], w) {
+			t.Fatalf("stream = %q, want lines containing %q", got, want)
+		}
+	}
+}
+
+func TestSSEKeepalive(t *testing.T) {
+	defer func(d time.Duration) { sseKeepalive = d }(sseKeepalive)
+	sseKeepalive = 10 * time.Millisecond
+	srv, _ := testServer(t)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", ts.URL+"/admin/events", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	if !scanner.Scan() || scanner.Text() != ": keepalive" {
+		t.Errorf("idle stream sent %q, want a keepalive comment", scanner.Text())
+	}
+}
+
+func TestSSESecurityOnly(t *testing.T) {
+	srv, _ := testServer(t)
+	srv.events.Emit(events.Event{Type: events.AgentWake, Agent: "a"})
+	srv.events.Emit(events.Event{Type: events.SecurityTargetBlocked, Agent: "a"})
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", ts.URL+"/admin/events?security=true", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	go func() {
+		srv.events.Emit(events.Event{Type: events.AgentSleep, Agent: "a"})
+		srv.events.Emit(events.Event{Type: events.SecurityAuthFailed})
+	}()
+	var got []string
+	scanner := bufio.NewScanner(resp.Body)
+	for len(got) < 4 && scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			got = append(got, line)
+		}
+	}
+	// Kept security events come first even without a Last-Event-ID.
+	id := func(n uint64) string { return "id: " + srv.history.EventID(events.Entry{ID: n}) }
+	want := []string{id(2), events.SecurityTargetBlocked, id(4), events.SecurityAuthFailed}
+	for i, w := range want {
+		if i >= len(got) || !strings.Contains(got[i], w) {
+			t.Fatalf("stream = %q, want lines containing %q", got, want)
+		}
+	}
+}
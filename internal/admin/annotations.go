@@ -0,0 +1,63 @@
+package admin
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"strings"
+
+	"warren/internal/revisions"
+	"warren/internal/validate"
+)
+
+// patchAnnotations serves PATCH /admin/agents/{name}/annotations. The body
+// maps keys to new values, with null removing a key, and the agent's
+// annotations after the change are returned. They're saved with the
+// config, so they survive restarts.
+func (s *Server) patchAnnotations(w http.ResponseWriter, r *http.Request, name string) {
+	var req map[string]*string
+	errs := validate.Decode(r, &req)
+	for key := range req {
+		if key == "" || strings.ContainsAny(key, "= \t\n") {
+			errs.Add(key, "annotation keys must be non-empty without spaces or '='")
+		}
+	}
+	if validate.Write(w, errs) {
+		return
+	}
+
+	s.mu.Lock()
+	current := s.cfg.Agents[name]
+	if current == nil {
+		s.mu.Unlock()
+		http.Error(w, `{"error":"agent not found"}`, http.StatusNotFound)
+		return
+	}
+	// Copied rather than changed in place: policies and the proxy may
+	// still hold the old agent.
+	agent := *current
+	agent.Annotations = maps.Clone(current.Annotations)
+	if agent.Annotations == nil {
+		agent.Annotations = make(map[string]string)
+	}
+	for key, value := range req {
+		if value == nil {
+			delete(agent.Annotations, key)
+		} else {
+			agent.Annotations[key] = *value
+		}
+	}
+	if len(agent.Annotations) == 0 {
+		agent.Annotations = nil
+	}
+	s.cfg.Agents[name] = &agent
+	s.saveConfig("annotating agent")
+	s.mu.Unlock()
+
+	s.recordAgentNote(name, revisions.ActionUpdated, revisions.Actor(r), "annotations changed", &agent)
+	annotations := agent.Annotations
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	_ = json.NewEncoder(w).Encode(annotations)
+}
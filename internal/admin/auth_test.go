@@ -2,11 +2,14 @@ package admin
 
 import (
 	"context"
+	"encoding/json"
 	"log/slog"
+	"net/http"
 	"net/http/httptest"
 	"os"
 	"testing"
 
+	"warren/internal/ban"
 	"warren/internal/config"
 	"warren/internal/events"
 	"warren/internal/policy"
@@ -125,3 +128,78 @@ func TestAuthMiddleware_MalformedAuthHeader(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthMiddleware_FailureEmitsThrottledSecurityEvent(t *testing.T) {
+	srv := testServerWithToken(t, "secret-token")
+	handler := srv.Handler()
+
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("GET", "/admin/agents", nil)
+		req.RemoteAddr = "203.0.113.7:4242"
+		req.Header.Set("Authorization", "Bearer guess")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	var failed []events.Event
+	for _, ev := range srv.history.Events() {
+		if ev.Type == events.SecurityAuthFailed {
+			failed = append(failed, ev)
+		}
+	}
+	if len(failed) != 1 {
+		t.Fatalf("got %d auth failure events, want 1 per address per minute", len(failed))
+	}
+	if f := failed[0].Fields; f["remote"] != "203.0.113.7" || f["path"] != "/admin/agents" || f["reason"] != "wrong token" {
+		t.Errorf("fields = %v", f)
+	}
+}
+
+func TestAuthFailuresBanAndBansEndpoints(t *testing.T) {
+	srv := testServerWithToken(t, "secret-token")
+	jail, err := ban.New(ban.Config{MaxStrikes: 3}, srv.logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.SetJail(jail)
+	handler := srv.Handler()
+
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("GET", "/admin/agents", nil)
+		req.RemoteAddr = "203.0.113.7:4242"
+		req.Header.Set("Authorization", "Bearer guess")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if !jail.Banned("203.0.113.7") {
+		t.Fatal("repeated admin auth failures didn't ban the address")
+	}
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("GET", "/admin/agents", nil)
+		req.RemoteAddr = "203.0.113.8:4242"
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if jail.Banned("203.0.113.8") {
+		t.Fatal("requests without a token banned the address")
+	}
+
+	req := httptest.NewRequest("GET", "/admin/bans", nil)
+	req.Header.Set("Authorization", "Bearer secret-token")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	var bans []ban.Ban
+	if err := json.NewDecoder(w.Body).Decode(&bans); err != nil || len(bans) != 1 || bans[0].IP != "203.0.113.7" || bans[0].Reason != "admin auth" {
+		t.Fatalf("GET /admin/bans = %d %+v, %v", w.Code, bans, err)
+	}
+
+	req = httptest.NewRequest("DELETE", "/admin/bans/203.0.113.7", nil)
+	req.Header.Set("Authorization", "Bearer secret-token")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || jail.Banned("203.0.113.7") {
+		t.Errorf("DELETE = %d, still banned: %v", w.Code, jail.Banned("203.0.113.7"))
+	}
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("DELETE of an address that isn't banned = %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,327 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"warren/internal/auth"
+	"warren/internal/balance"
+	"warren/internal/cache"
+	"warren/internal/config"
+	"warren/internal/cors"
+	"warren/internal/events"
+	"warren/internal/headers"
+	"warren/internal/policy"
+	"warren/internal/revisions"
+	"warren/internal/services"
+	"warren/internal/transport"
+	"warren/internal/validate"
+)
+
+// backupVersion is the archive format written by GET /admin/backup. Restore
+// rejects archives from other versions rather than half-reading them.
+const backupVersion = 1
+
+// maxBackupBody bounds the archive POST /admin/restore accepts. Archives
+// carry the event history, so they outgrow the usual request body limit.
+const maxBackupBody = 32 << 20
+
+// Backup is the runtime state that lives outside the config file's static
+// agents: agents added through the API, dynamic services, manual holds and
+// recent events. It is written as YAML, like the config, and contains
+// secrets such as basic auth hashes.
+type Backup struct {
+	Version   int                      `yaml:"version"`
+	CreatedAt time.Time                `yaml:"created_at"`
+	Agents    map[string]*config.Agent `yaml:"agents,omitempty"`
+	Services  []ServiceBackup          `yaml:"services,omitempty"`
+	Holds     map[string]time.Time     `yaml:"holds,omitempty"` // agent → when its manual hold lapses
+	Events    []events.Event           `yaml:"events,omitempty"`
+}
+
+// ServiceBackup is a dynamic service with the options it was registered
+// with.
+type ServiceBackup struct {
+	Hostname  string              `yaml:"hostname"`
+	Target    string              `yaml:"target"`
+	Agent     string              `yaml:"agent,omitempty"`
+	Replicas  []string            `yaml:"replicas,omitempty"`
+	Balance   string              `yaml:"balance,omitempty"`
+	Weights   []int               `yaml:"weights,omitempty"`
+	Sticky    *balance.Sticky     `yaml:"sticky,omitempty"`
+	Timeouts  *transport.Timeouts `yaml:"timeouts,omitempty"`
+	CORS      *cors.Config        `yaml:"cors,omitempty"`
+	Headers   *headers.Config     `yaml:"headers,omitempty"`
+	Cache     *cache.Config       `yaml:"cache,omitempty"`
+	BasicAuth *BasicAuthBackup    `yaml:"basic_auth,omitempty"`
+	Wake      bool                `yaml:"wake,omitempty"`
+	Fallback  *services.Fallback  `yaml:"fallback,omitempty"`
+	MaxBody   int64               `yaml:"max_body,omitempty"`
+}
+
+// BasicAuthBackup holds a service's realm and htpasswd entries.
+type BasicAuthBackup struct {
+	Realm string   `yaml:"realm,omitempty"`
+	Users []string `yaml:"users"`
+}
+
+// RestoreSummary reports what POST /admin/restore brought back.
+type RestoreSummary struct {
+	Agents   []string      `json:"agents"`
+	Services []string      `json:"services"`
+	Holds    []string      `json:"holds"`
+	Events   int           `json:"events"`
+	Skipped  []RestoreSkip `json:"skipped"`
+}
+
+// RestoreSkip is an entry of the archive that wasn't restored, and why.
+type RestoreSkip struct {
+	Kind   string `json:"kind"` // "agent", "service" or "hold"
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// handleBackup serves GET /admin/backup.
+func (s *Server) handleBackup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+	out, err := yaml.Marshal(s.backup())
+	if err != nil {
+		s.logger.Error("failed to write backup", "error", err)
+		http.Error(w, `{"error":"failed to write backup"}`, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Header().Set("Content-Disposition", `attachment; filename="warren-backup.yaml"`)
+	_, _ = w.Write(out)
+}
+
+func (s *Server) backup() Backup {
+	b := Backup{Version: backupVersion, CreatedAt: time.Now().UTC(), Agents: make(map[string]*config.Agent), Holds: make(map[string]time.Time)}
+
+	s.mu.RLock()
+	for name, agent := range s.cfg.Agents {
+		b.Agents[name] = agent
+	}
+	for name, pol := range s.policies {
+		if until := heldUntil(pol); until != nil {
+			b.Holds[name] = until.UTC()
+		}
+	}
+	s.mu.RUnlock()
+
+	for _, svc := range s.registry.List() {
+		b.Services = append(b.Services, serviceBackup(svc))
+	}
+	sort.Slice(b.Services, func(i, j int) bool { return b.Services[i].Hostname < b.Services[j].Hostname })
+	b.Events = s.history.Events()
+	return b
+}
+
+func serviceBackup(svc services.Service) ServiceBackup {
+	sb := ServiceBackup{
+		Hostname: svc.Hostname,
+		Target:   svc.Target,
+		Agent:    svc.Agent,
+		Balance:  svc.Balance,
+		Weights:  svc.Weights,
+		Sticky:   svc.Sticky,
+		Timeouts: svc.Timeouts,
+		Wake:     svc.Wake,
+		Fallback: svc.Fallback,
+		MaxBody:  svc.MaxBody,
+	}
+	if len(svc.Targets) > 1 {
+		sb.Replicas = svc.Targets[1:]
+	}
+	if svc.CORS != nil {
+		c := svc.CORS.Config()
+		sb.CORS = &c
+	}
+	if svc.Headers != nil {
+		h := svc.Headers.Config()
+		sb.Headers = &h
+	}
+	if svc.Cache != nil {
+		c := svc.Cache.Config()
+		sb.Cache = &c
+	}
+	if svc.BasicAuth != nil {
+		sb.BasicAuth = &BasicAuthBackup{Realm: svc.BasicAuth.Realm(), Users: svc.BasicAuth.Entries()}
+	}
+	return sb
+}
+
+// handleRestore serves POST /admin/restore. Entries that already exist here
+// are kept as they are and reported as skipped, so restoring onto a running
+// instance only fills in what's missing.
+func (s *Server) handleRestore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBackupBody))
+	if err != nil {
+		http.Error(w, `{"error":"backup too large"}`, http.StatusRequestEntityTooLarge)
+		return
+	}
+	var b Backup
+	var errs validate.Errors
+	if err := yaml.Unmarshal(data, &b); err != nil {
+		errs.Add("", "invalid backup: %v", err)
+	} else if b.Version != backupVersion {
+		errs.Add("version", "must be %d, got %d", backupVersion, b.Version)
+	}
+	if validate.Write(w, errs) {
+		return
+	}
+
+	summary := s.restore(b, revisions.Actor(r))
+	s.logger.Info("backup restored", "created_at", b.CreatedAt, "agents", len(summary.Agents), "services", len(summary.Services), "holds", len(summary.Holds), "events", summary.Events, "skipped", len(summary.Skipped))
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(summary)
+}
+
+func (s *Server) restore(b Backup, actor string) RestoreSummary {
+	summary := RestoreSummary{Agents: []string{}, Services: []string{}, Holds: []string{}, Skipped: []RestoreSkip{}}
+	skip := func(kind, name, format string, args ...any) {
+		summary.Skipped = append(summary.Skipped, RestoreSkip{Kind: kind, Name: name, Reason: fmt.Sprintf(format, args...)})
+	}
+
+	// Agents first: services and holds may belong to them.
+	s.mu.Lock()
+	for _, name := range sortedKeys(b.Agents) {
+		agent := b.Agents[name]
+		if reason := s.restorableAgent(name, agent); reason != "" {
+			skip("agent", name, "%s", reason)
+			continue
+		}
+		if err := s.startAgent(name, agent); err != nil {
+			s.logger.Error("failed to start agent from backup", "name", name, "error", err)
+			skip("agent", name, "failed to start: %v", err)
+			continue
+		}
+		s.recordAgentNote(name, revisions.ActionRestored, actor, "from backup", agent)
+		s.events.Emit(events.Event{Type: events.AgentAdded, Agent: name, Fields: map[string]string{"restored": "backup"}})
+		summary.Agents = append(summary.Agents, name)
+	}
+	if len(summary.Agents) > 0 {
+		s.saveConfig("restoring backup")
+	}
+	policies := make(map[string]policy.Policy, len(s.policies))
+	for name, pol := range s.policies {
+		policies[name] = pol
+	}
+	s.mu.Unlock()
+
+	for _, sb := range b.Services {
+		if _, exists := s.registry.Lookup(sb.Hostname); exists {
+			skip("service", sb.Hostname, "already registered")
+			continue
+		}
+		opts, err := sb.options()
+		if err == nil {
+			err = s.registry.RegisterWithOptions(sb.Hostname, sb.Target, sb.Agent, opts)
+		}
+		if err != nil {
+			skip("service", sb.Hostname, "%v", err)
+			continue
+		}
+		summary.Services = append(summary.Services, sb.Hostname)
+	}
+
+	now := time.Now()
+	for _, name := range sortedKeys(b.Holds) {
+		until := b.Holds[name]
+		od, ok := policies[name].(*policy.OnDemand)
+		switch {
+		case !until.After(now):
+			skip("hold", name, "expired")
+		case !ok:
+			skip("hold", name, "not an on-demand agent here")
+		default:
+			od.Hold(until.Sub(now))
+			summary.Holds = append(summary.Holds, name)
+		}
+	}
+
+	s.history.Import(b.Events)
+	summary.Events = len(b.Events)
+	return summary
+}
+
+// restorableAgent returns why agent can't be restored under name, or "".
+// Caller must hold s.mu.
+func (s *Server) restorableAgent(name string, agent *config.Agent) string {
+	if _, exists := s.agents[name]; exists {
+		return "already exists"
+	}
+	if agent == nil || agent.Hostname == "" {
+		return "has no hostname"
+	}
+	if _, err := url.Parse(agent.Backend); err != nil || agent.Backend == "" {
+		return "has no valid backend"
+	}
+	if _, taken := s.prxy.Backend(agent.Hostname); taken {
+		return "hostname is in use by another agent"
+	}
+	return ""
+}
+
+// options rebuilds the registration options the service was backed up with.
+func (sb ServiceBackup) options() (services.Options, error) {
+	opts := services.Options{
+		Replicas: sb.Replicas,
+		Balance:  sb.Balance,
+		Weights:  sb.Weights,
+		Sticky:   sb.Sticky,
+		Timeouts: sb.Timeouts,
+		Wake:     sb.Wake,
+		Fallback: sb.Fallback,
+		MaxBody:  sb.MaxBody,
+	}
+	if sb.BasicAuth != nil {
+		basic, err := auth.NewBasic(sb.BasicAuth.Realm, sb.BasicAuth.Users)
+		if err != nil {
+			return opts, fmt.Errorf("basic_auth: %w", err)
+		}
+		opts.BasicAuth = basic
+	}
+	if sb.CORS != nil {
+		policy, err := cors.New(*sb.CORS)
+		if err != nil {
+			return opts, fmt.Errorf("cors: %s", strings.TrimPrefix(err.Error(), "cors: "))
+		}
+		opts.CORS = policy
+	}
+	if sb.Headers != nil {
+		rw, err := headers.New(*sb.Headers)
+		if err != nil {
+			return opts, fmt.Errorf("headers: %s", strings.TrimPrefix(err.Error(), "headers: "))
+		}
+		opts.Headers = rw
+	}
+	if sb.Cache != nil {
+		opts.Cache = cache.New(*sb.Cache)
+	}
+	return opts, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
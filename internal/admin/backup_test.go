@@ -0,0 +1,141 @@
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"warren/internal/auth"
+	"warren/internal/cors"
+	"warren/internal/events"
+	"warren/internal/services"
+)
+
+func TestBackupRestoresOnFreshInstance(t *testing.T) {
+	src, _ := testServer(t)
+	handler := src.Handler()
+
+	body, _ := json.Marshal(AddAgentRequest{
+		Name:     "kai",
+		Hostname: "kai.example.com",
+		Backend:  "http://localhost:18790",
+		Policy:   "unmanaged",
+	})
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/admin/agents", bytes.NewReader(body)))
+	if w.Code != 201 {
+		t.Fatalf("add: %d %s", w.Code, w.Body.String())
+	}
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	basic, err := auth.NewBasic("bots", []string{"alice:" + string(hash)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := cors.New(cors.Config{Origins: []string{"https://app.example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := src.registry.RegisterWithOptions("dash.example.com", "http://localhost:3000", "kai", services.Options{BasicAuth: basic, CORS: policy}); err != nil {
+		t.Fatal(err)
+	}
+	src.history.Add(events.Event{Type: events.AgentWake, Agent: "kai", Timestamp: time.Now()})
+	src.history.Add(events.Event{Type: events.AgentReady, Agent: "kai", Timestamp: time.Now()})
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/admin/backup", nil))
+	if w.Code != 200 {
+		t.Fatalf("backup: %d %s", w.Code, w.Body.String())
+	}
+	archive := w.Body.Bytes()
+
+	dst, _ := testServer(t)
+	w = httptest.NewRecorder()
+	dst.Handler().ServeHTTP(w, httptest.NewRequest("POST", "/admin/restore", bytes.NewReader(archive)))
+	if w.Code != 200 {
+		t.Fatalf("restore: %d %s", w.Code, w.Body.String())
+	}
+	var summary RestoreSummary
+	json.Unmarshal(w.Body.Bytes(), &summary)
+	if len(summary.Agents) != 1 || len(summary.Services) != 1 || summary.Events != len(src.history.Events()) || len(summary.Skipped) != 0 {
+		t.Errorf("summary = %+v", summary)
+	}
+
+	if _, ok := dst.prxy.Backends()["kai.example.com"]; !ok {
+		t.Error("restored agent not routed")
+	}
+	if dst.cfg.Agents["kai"] == nil {
+		t.Error("restored agent not added to the config")
+	}
+	svc, ok := dst.registry.Lookup("dash.example.com")
+	if !ok {
+		t.Fatal("restored service not registered")
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.SetBasicAuth("alice", "s3cret")
+	if svc.BasicAuth == nil || svc.BasicAuth.Realm() != "bots" {
+		t.Fatal("restored service lost its basic auth")
+	}
+	if _, ok := svc.BasicAuth.Authenticate(req); !ok {
+		t.Error("restored basic auth rejects the original password")
+	}
+	if svc.CORS == nil || svc.CORS.Config().Origins[0] != "https://app.example.com" {
+		t.Errorf("restored CORS = %v", svc.CORS)
+	}
+	// Events from the backup keep their order. "added" events come from
+	// both instances, so they're left out.
+	var types []string
+	for _, ev := range dst.history.Events() {
+		if ev.Type != events.AgentAdded {
+			types = append(types, ev.Type)
+		}
+	}
+	if strings.Join(types, ",") != events.AgentWake+","+events.AgentReady {
+		t.Errorf("restored events = %v", types)
+	}
+
+	// Restoring again changes nothing.
+	w = httptest.NewRecorder()
+	dst.Handler().ServeHTTP(w, httptest.NewRequest("POST", "/admin/restore", bytes.NewReader(archive)))
+	summary = RestoreSummary{}
+	json.Unmarshal(w.Body.Bytes(), &summary)
+	if len(summary.Agents) != 0 || len(summary.Services) != 0 || len(summary.Skipped) != 2 {
+		t.Errorf("second restore summary = %+v, want both entries skipped", summary)
+	}
+}
+
+func TestRestoreSkipsHoldsForMissingAgents(t *testing.T) {
+	srv, _ := testServer(t)
+	archive := "version: 1\nholds:\n  kai: " + time.Now().Add(time.Hour).UTC().Format(time.RFC3339) +
+		"\n  old: " + time.Now().Add(-time.Hour).UTC().Format(time.RFC3339) + "\n"
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("POST", "/admin/restore", strings.NewReader(archive)))
+	if w.Code != 200 {
+		t.Fatalf("restore: %d %s", w.Code, w.Body.String())
+	}
+	var summary RestoreSummary
+	json.Unmarshal(w.Body.Bytes(), &summary)
+	reasons := map[string]string{}
+	for _, s := range summary.Skipped {
+		reasons[s.Name] = s.Reason
+	}
+	if reasons["kai"] != "not an on-demand agent here" || reasons["old"] != "expired" {
+		t.Errorf("skipped = %+v", summary.Skipped)
+	}
+}
+
+func TestRestoreRejectsUnknownVersion(t *testing.T) {
+	srv, _ := testServer(t)
+	for _, archive := range []string{"version: 2\n", "not: [valid"} {
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, httptest.NewRequest("POST", "/admin/restore", strings.NewReader(archive)))
+		if w.Code != 422 {
+			t.Errorf("restore %q: %d, want 422", archive, w.Code)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"warren/internal/ban"
+)
+
+// banJail returns the jail, answering 404 when bans aren't enabled.
+func (s *Server) banJail(w http.ResponseWriter) *ban.Jail {
+	s.mu.Lock()
+	j := s.jail
+	s.mu.Unlock()
+	if j == nil {
+		http.Error(w, `{"error":"bans not enabled"}`, http.StatusNotFound)
+	}
+	return j
+}
+
+// handleBans lists the banned client addresses: GET /admin/bans.
+func (s *Server) handleBans(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+	j := s.banJail(w)
+	if j == nil {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(j.Bans())
+}
+
+// handleBan lifts a ban early: DELETE /admin/bans/{ip}.
+func (s *Server) handleBan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+	ip := strings.TrimPrefix(r.URL.Path, "/admin/bans/")
+	if ip == "" {
+		http.Error(w, `{"error":"address required"}`, http.StatusBadRequest)
+		return
+	}
+	j := s.banJail(w)
+	if j == nil {
+		return
+	}
+	if !j.Unban(ip) {
+		http.Error(w, `{"error":"address not banned"}`, http.StatusNotFound)
+		return
+	}
+	s.logger.Info("ban lifted", "ip", ip)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "unbanned", "ip": ip})
+}
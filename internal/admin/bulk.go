@@ -0,0 +1,130 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"warren/internal/labels"
+	"warren/internal/policy"
+	"warren/internal/validate"
+)
+
+// bulkResult is one agent's outcome in a bulk wake or sleep.
+type bulkResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`           // "waking", "sleeping" or "skipped"
+	Reason string `json:"reason,omitempty"` // why it was skipped
+}
+
+// handleBulk serves POST /admin/wake and POST /admin/sleep, acting on every
+// agent matching {"selector": "env=staging"}, or all of them with
+// {"all": true}. Agents that aren't on-demand are skipped. Sleeps run
+// concurrently, so one slow container doesn't hold up the rest, except that
+// agents sleep only after the agents among them that depend on them. An
+// agent that others depending on it still need, because they weren't
+// selected or couldn't sleep, is skipped.
+func (s *Server) handleBulk(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+	wake := strings.HasSuffix(r.URL.Path, "/wake")
+
+	var req struct {
+		Selector  string `json:"selector"`
+		All       bool   `json:"all"`
+		KeepAwake string `json:"keep_awake"`
+	}
+	errs := validate.Decode(r, &req)
+	sel, err := labels.Parse(req.Selector)
+	if err != nil {
+		errs.Add("selector", "%v", err)
+	}
+	switch {
+	case req.All && len(sel) > 0:
+		errs.Add("all", "give either all or selector, not both")
+	case !req.All && len(sel) == 0:
+		errs.Add("selector", "required unless all is set")
+	}
+	var keepAwake time.Duration
+	if wake {
+		keepAwake = errs.Duration("keep_awake", req.KeepAwake)
+	} else if req.KeepAwake != "" {
+		errs.Add("keep_awake", "only applies to wake")
+	}
+	if validate.Write(w, errs) {
+		return
+	}
+
+	s.mu.RLock()
+	pols := make(map[string]policy.Policy)
+	for name, agent := range s.cfg.Agents {
+		if sel.Matches(agent.Labels) {
+			pols[name] = s.policies[name]
+		}
+	}
+	deps := s.deps
+	s.mu.RUnlock()
+
+	names := make([]string, 0, len(pols))
+	for name := range pols {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	results := make([]bulkResult, len(names))
+	sleepers := make(map[string]*policy.OnDemand)
+	for i, name := range names {
+		results[i] = bulkResult{Name: name, Status: "skipped", Reason: "not on-demand"}
+		od, ok := pols[name].(*policy.OnDemand)
+		if !ok {
+			continue
+		}
+		if wake {
+			if keepAwake > 0 {
+				od.Hold(keepAwake)
+			}
+			od.Wake()
+			results[i] = bulkResult{Name: name, Status: "waking"}
+			continue
+		}
+		results[i] = bulkResult{Name: name, Status: "sleeping"}
+		sleepers[name] = od
+	}
+
+	waves := [][]string{names}
+	if deps != nil {
+		waves = deps.SleepOrder(names)
+	}
+	index := make(map[string]int, len(names))
+	for i, name := range names {
+		index[name] = i
+	}
+	for _, wave := range waves {
+		var wg sync.WaitGroup
+		for _, name := range wave {
+			if od := sleepers[name]; od != nil {
+				if deps != nil {
+					// Earlier waves have put the selected dependents to sleep.
+					if awake := deps.AwakeDependents(name); len(awake) > 0 {
+						results[index[name]] = bulkResult{Name: name, Status: "skipped", Reason: "depended on by " + strings.Join(awake, ", ")}
+						continue
+					}
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					od.Sleep(r.Context())
+				}()
+			}
+		}
+		wg.Wait()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"agents": results})
+}
@@ -0,0 +1,258 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"warren/internal/config"
+	"warren/internal/hermes"
+	"warren/internal/human"
+	"warren/internal/services"
+)
+
+// composeFile is the subset of the docker-compose schema emitted by agent export.
+type composeFile struct {
+	Services map[string]composeService `yaml:"services"`
+}
+
+type composeService struct {
+	Image         string            `yaml:"image"`
+	ContainerName string            `yaml:"container_name"`
+	Labels        map[string]string `yaml:"labels,omitempty"`
+	Environment   map[string]string `yaml:"environment,omitempty"`
+	Ports         []string          `yaml:"ports,omitempty"`
+	Volumes       []string          `yaml:"volumes,omitempty"`
+	Healthcheck   *composeHealth    `yaml:"healthcheck,omitempty"`
+}
+
+type composeHealth struct {
+	Test        []string `yaml:"test"`
+	Interval    string   `yaml:"interval,omitempty"`
+	Timeout     string   `yaml:"timeout,omitempty"`
+	Retries     int      `yaml:"retries,omitempty"`
+	StartPeriod string   `yaml:"start_period,omitempty"`
+}
+
+// handleExport serves GET /admin/agents/{name}/export?format=compose.
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request, name string) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "compose"
+	}
+	if format != "compose" {
+		http.Error(w, `{"error":"unsupported export format"}`, http.StatusBadRequest)
+		return
+	}
+
+	s.mu.RLock()
+	agent, ok := s.cfg.Agents[name]
+	s.mu.RUnlock()
+	if !ok {
+		http.Error(w, `{"error":"agent has no config entry"}`, http.StatusNotFound)
+		return
+	}
+
+	image := ""
+	if s.manager != nil && agent.Container.Name != "" {
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+		img, err := s.manager.Image(ctx, agent.Container.Name)
+		if err != nil {
+			s.logger.Warn("export: failed to resolve image", "agent", name, "error", err)
+		}
+		image = img
+	}
+
+	out, err := renderCompose(name, agent, image, s.cfg.Hermes.URL)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/yaml")
+	_, _ = w.Write(out)
+}
+
+// renderCompose builds a docker-compose document with a single service that
+// mirrors how Warren runs the agent: labels, Hermes injection, published
+// backend port and a healthcheck derived from the agent's health settings.
+func renderCompose(name string, agent *config.Agent, image, natsURL string) ([]byte, error) {
+	svcName := agent.Container.Name
+	if svcName == "" {
+		svcName = name
+	}
+	if image == "" {
+		image = svcName + ":latest"
+	}
+
+	svc := composeService{
+		Image:         image,
+		ContainerName: svcName,
+		Labels:        map[string]string{"orchestrator.agent": name},
+	}
+	for k, v := range agent.Container.Labels {
+		svc.Labels[k] = v
+	}
+
+	backend, err := url.Parse(agent.Backend)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backend URL: %w", err)
+	}
+	port := backend.Port()
+	if port == "" {
+		port = "80"
+		if backend.Scheme == "https" {
+			port = "443"
+		}
+	}
+	svc.Ports = []string{port + ":" + port}
+
+	if agent.Hermes.Enabled {
+		svc.Environment = map[string]string{
+			"AGENT_ID":     name,
+			"NATS_URL":     natsURL,
+			"GATEWAY_PORT": "18790",
+		}
+		svc.Volumes = []string{"/usr/local/shared-bin:" + hermes.SharedBinMountPath + ":ro"}
+	}
+
+	if agent.Health.URL != "" {
+		health, err := url.Parse(agent.Health.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid health URL: %w", err)
+		}
+		// The compose healthcheck runs inside the container, so probe loopback.
+		if p := health.Port(); p != "" {
+			health.Host = net.JoinHostPort("localhost", p)
+		} else {
+			health.Host = "localhost"
+		}
+		svc.Healthcheck = &composeHealth{
+			Test:    []string{"CMD", "curl", "-fsS", health.String()},
+			Timeout: "5s",
+			Retries: agent.Health.MaxFailures,
+		}
+		if agent.Health.CheckInterval > 0 {
+			svc.Healthcheck.Interval = time.Duration(agent.Health.CheckInterval).String()
+		}
+		if agent.Health.StartupTimeout > 0 {
+			svc.Healthcheck.StartPeriod = time.Duration(agent.Health.StartupTimeout).String()
+		}
+	}
+
+	return yaml.Marshal(composeFile{Services: map[string]composeService{svcName: svc}})
+}
+
+// handleConfigExport serves GET /admin/export: the running config,
+// including agents added through the API, with the dynamic services
+// registered right now as its services section. The result can replace
+// orchestrator.yaml to keep ad-hoc changes. With ?format=k8s it serves
+// Kubernetes manifests for the agents instead.
+func (s *Server) handleConfigExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+	switch r.URL.Query().Get("format") {
+	case "", "yaml":
+	case "k8s":
+		s.handleK8sExport(w, r)
+		return
+	default:
+		http.Error(w, `{"error":"unsupported export format"}`, http.StatusBadRequest)
+		return
+	}
+
+	s.mu.RLock()
+	cfg := *s.cfg
+	cfg.Agents = make(map[string]*config.Agent, len(s.cfg.Agents))
+	for name, agent := range s.cfg.Agents {
+		cfg.Agents[name] = agent
+	}
+	s.mu.RUnlock()
+
+	cfg.Services = make(map[string]*config.Service)
+	for _, svc := range s.registry.List() {
+		cs := configService(svc)
+		if cs.BasicAuth != nil {
+			// It was accepted alongside the proxy token, so it opted in.
+			cs.BasicAuth.ReplaceProxyToken = cfg.ProxyToken != ""
+		}
+		cfg.Services[svc.Hostname] = cs
+	}
+	if len(cfg.Services) == 0 {
+		cfg.Services = nil
+	}
+	out, err := yaml.Marshal(&cfg)
+	if err != nil {
+		s.logger.Error("failed to export config", "error", err)
+		http.Error(w, `{"error":"failed to export config"}`, http.StatusInternalServerError)
+		return
+	}
+	header := "# Exported from the running orchestrator at " + time.Now().UTC().Format(time.RFC3339) + ".\n"
+	w.Header().Set("Content-Type", "application/yaml")
+	_, _ = w.Write([]byte(header))
+	_, _ = w.Write(out)
+}
+
+// configService converts a registered service to its config form.
+func configService(svc services.Service) *config.Service {
+	cs := &config.Service{
+		Target:  svc.Target,
+		Agent:   svc.Agent,
+		Balance: svc.Balance,
+		Weights: svc.Weights,
+		Wake:    svc.Wake,
+		MaxBody: human.Size(svc.MaxBody),
+	}
+	if len(svc.Targets) > 1 {
+		cs.Replicas = svc.Targets[1:]
+	}
+	if st := svc.Sticky; st != nil {
+		cs.Sticky = &config.Sticky{Cookie: st.Cookie, TTL: human.Duration(st.TTL)}
+	}
+	if to := svc.Timeouts; to != nil {
+		cs.Timeouts = &config.Timeouts{Dial: human.Duration(to.Dial), ResponseHeader: human.Duration(to.ResponseHeader), Idle: human.Duration(to.Idle)}
+	}
+	if svc.CORS != nil {
+		c := svc.CORS.Config()
+		cs.CORS = &config.CORS{
+			Origins:       c.Origins,
+			Methods:       c.Methods,
+			Headers:       c.Headers,
+			ExposeHeaders: c.ExposeHeaders,
+			Credentials:   c.Credentials,
+			MaxAge:        human.Duration(c.MaxAge),
+		}
+	}
+	if svc.Headers != nil {
+		h := svc.Headers.Config()
+		cs.Headers = &h
+	}
+	if svc.Cache != nil {
+		c := svc.Cache.Config()
+		cs.Cache = &config.Cache{
+			Paths:    c.Paths,
+			Methods:  c.Methods,
+			TTL:      human.Duration(c.TTL),
+			MaxSize:  human.Size(c.MaxSize),
+			MaxEntry: human.Size(c.MaxEntry),
+		}
+	}
+	if svc.BasicAuth != nil {
+		cs.BasicAuth = &config.BasicAuth{Realm: svc.BasicAuth.Realm(), Users: svc.BasicAuth.Entries()}
+	}
+	if fb := svc.Fallback; fb != nil {
+		cs.Fallback = &config.Fallback{Retries: fb.Retries, Wake: fb.Wake, URL: fb.URL, Page: fb.Page}
+	}
+	return cs
+}
@@ -0,0 +1,253 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"warren/internal/config"
+	"warren/internal/human"
+	"warren/internal/services"
+)
+
+func TestRenderCompose(t *testing.T) {
+	agent := &config.Agent{
+		Hostname:  "kai.example.com",
+		Backend:   "http://tasks.openclaw_kai:18790",
+		Policy:    "on-demand",
+		Hermes:    config.AgentHermes{Enabled: true},
+		Container: config.Container{Name: "openclaw_kai", Labels: map[string]string{"team": "core"}},
+		Health: config.Health{
+			URL:            "http://tasks.openclaw_kai:18790/health",
+			CheckInterval:  human.Duration(30 * time.Second),
+			StartupTimeout: human.Duration(60 * time.Second),
+			MaxFailures:    3,
+		},
+	}
+
+	out, err := renderCompose("kai", agent, "openclaw-agent:1.2", "nats://hermes:4222")
+	if err != nil {
+		t.Fatalf("renderCompose: %v", err)
+	}
+
+	var doc composeFile
+	if err := yaml.Unmarshal(out, &doc); err != nil {
+		t.Fatalf("output is not valid YAML: %v\n%s", err, out)
+	}
+	svc, ok := doc.Services["openclaw_kai"]
+	if !ok {
+		t.Fatalf("service openclaw_kai missing:\n%s", out)
+	}
+	if svc.Image != "openclaw-agent:1.2" {
+		t.Errorf("image = %q, want openclaw-agent:1.2", svc.Image)
+	}
+	if svc.Labels["orchestrator.agent"] != "kai" || svc.Labels["team"] != "core" {
+		t.Errorf("labels = %v", svc.Labels)
+	}
+	if svc.Environment["NATS_URL"] != "nats://hermes:4222" || svc.Environment["AGENT_ID"] != "kai" {
+		t.Errorf("environment = %v", svc.Environment)
+	}
+	if len(svc.Ports) != 1 || svc.Ports[0] != "18790:18790" {
+		t.Errorf("ports = %v", svc.Ports)
+	}
+	if svc.Healthcheck == nil {
+		t.Fatal("healthcheck missing")
+	}
+	if got := svc.Healthcheck.Test[len(svc.Healthcheck.Test)-1]; got != "http://localhost:18790/health" {
+		t.Errorf("healthcheck URL = %q, want loopback", got)
+	}
+	if svc.Healthcheck.StartPeriod != "1m0s" || svc.Healthcheck.Retries != 3 {
+		t.Errorf("healthcheck = %+v", svc.Healthcheck)
+	}
+}
+
+func TestRenderK8s(t *testing.T) {
+	agents := map[string]*config.Agent{
+		"Kai_Bot": {
+			Hostname:  "kai.example.com",
+			Hostnames: []string{"www.kai.example.com"},
+			Backend:   "http://tasks.openclaw_kai:18790",
+			Policy:    "on-demand",
+			Container: config.Container{Name: "openclaw_kai"},
+			Health: config.Health{
+				URL:            "http://tasks.openclaw_kai:18790/health",
+				CheckInterval:  human.Duration(30 * time.Second),
+				StartupTimeout: human.Duration(60 * time.Second),
+				MaxFailures:    3,
+			},
+		},
+		"external": {Hostname: "ext.example.com", Backend: "http://10.0.0.5:80", Policy: "unmanaged"},
+	}
+
+	out, err := renderK8s(agents, map[string]string{"Kai_Bot": "openclaw-agent:1.2"}, k8sOptions{Namespace: "agents", IngressClass: "nginx"})
+	if err != nil {
+		t.Fatalf("renderK8s: %v", err)
+	}
+	if !strings.Contains(string(out), "# agent external: no container, left out") || !strings.Contains(string(out), "# agent Kai_Bot: on-demand") {
+		t.Errorf("header comments missing:\n%s", out)
+	}
+
+	dec := yaml.NewDecoder(strings.NewReader(string(out)))
+	kinds := map[string]map[string]any{}
+	for {
+		var doc map[string]any
+		if err := dec.Decode(&doc); err != nil {
+			break
+		}
+		kinds[doc["kind"].(string)] = doc
+		if md := doc["metadata"].(map[string]any); md["name"] != "kai-bot" || md["namespace"] != "agents" {
+			t.Errorf("%s metadata = %v", doc["kind"], md)
+		}
+	}
+	if len(kinds) != 3 {
+		t.Fatalf("got kinds %v, want Deployment, Service and Ingress:\n%s", kinds, out)
+	}
+
+	var deploy struct {
+		Spec k8sDeploymentSpec `yaml:"spec"`
+	}
+	remarshal(t, kinds["Deployment"], &deploy)
+	c := deploy.Spec.Template.Spec.Containers[0]
+	if c.Image != "openclaw-agent:1.2" || c.Ports[0].ContainerPort != 18790 {
+		t.Errorf("container = %+v", c)
+	}
+	if c.ReadinessProbe == nil || c.ReadinessProbe.HTTPGet.Path != "/health" || c.ReadinessProbe.PeriodSeconds != 30 || c.ReadinessProbe.FailureThreshold != 3 {
+		t.Errorf("readiness probe = %+v", c.ReadinessProbe)
+	}
+	if c.StartupProbe == nil || c.StartupProbe.FailureThreshold != 12 {
+		t.Errorf("startup probe = %+v, want 12 tries 5s apart", c.StartupProbe)
+	}
+
+	var ingress struct {
+		Spec k8sIngressSpec `yaml:"spec"`
+	}
+	remarshal(t, kinds["Ingress"], &ingress)
+	if ingress.Spec.IngressClassName != "nginx" || len(ingress.Spec.Rules) != 2 || ingress.Spec.Rules[1].Host != "www.kai.example.com" ||
+		ingress.Spec.Rules[0].HTTP.Paths[0].Backend.Service.Port.Number != 18790 {
+		t.Errorf("ingress = %+v", ingress.Spec)
+	}
+}
+
+func remarshal(t *testing.T, in, out any) {
+	t.Helper()
+	data, err := yaml.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := yaml.Unmarshal(data, out); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRenderComposeUnmanaged(t *testing.T) {
+	agent := &config.Agent{
+		Hostname: "root.example.com",
+		Backend:  "https://root.internal",
+		Policy:   "unmanaged",
+	}
+
+	out, err := renderCompose("root", agent, "", "")
+	if err != nil {
+		t.Fatalf("renderCompose: %v", err)
+	}
+	s := string(out)
+	if !strings.Contains(s, "image: root:latest") {
+		t.Errorf("expected placeholder image:\n%s", s)
+	}
+	if !strings.Contains(s, "443:443") {
+		t.Errorf("expected https default port:\n%s", s)
+	}
+	if strings.Contains(s, "healthcheck") || strings.Contains(s, "environment") {
+		t.Errorf("unexpected healthcheck/environment for unmanaged agent:\n%s", s)
+	}
+}
+
+func TestExportEndpoint(t *testing.T) {
+	srv, _ := testServer(t)
+	srv.cfg.Agents["a"] = &config.Agent{
+		Hostname:  "a.example.com",
+		Backend:   "http://localhost:3000",
+		Policy:    "unmanaged",
+		Container: config.Container{Name: "openclaw_a"},
+	}
+	srv.agents["a"] = AgentInfo{Name: "a", Hostname: "a.example.com", Policy: "unmanaged"}
+	handler := srv.Handler()
+
+	req := httptest.NewRequest("GET", "/admin/agents/a/export?format=compose", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/yaml" {
+		t.Errorf("content-type = %q", ct)
+	}
+	if !strings.Contains(w.Body.String(), "openclaw_a:") {
+		t.Errorf("unexpected body:\n%s", w.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/admin/agents/a/export?format=helm", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != 400 {
+		t.Fatalf("unsupported format: expected 400, got %d", w.Code)
+	}
+
+	// Render errors quote the bad URL; the body must still be valid JSON.
+	srv.cfg.Agents["a"].Backend = "http://bad host"
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/admin/agents/a/export?format=compose", nil))
+	var body map[string]string
+	if w.Code != 400 || json.Unmarshal(w.Body.Bytes(), &body) != nil || !strings.Contains(body["error"], `"http://bad host"`) {
+		t.Errorf("render error: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestConfigExportRoundTrips(t *testing.T) {
+	srv, _ := testServer(t)
+	handler := srv.Handler()
+
+	body := `{"name":"kai","hostname":"kai.example.com","backend":"http://localhost:18790","policy":"unmanaged"}`
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/admin/agents", strings.NewReader(body)))
+	if w.Code != 201 {
+		t.Fatalf("add: %d %s", w.Code, w.Body.String())
+	}
+	if err := srv.registry.RegisterWithOptions("dash.example.com", "http://localhost:3000", "kai", services.Options{
+		Replicas: []string{"http://localhost:3001"},
+		Wake:     true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.registry.RegisterWithOptions("docs.example.com", "http://localhost:4000", "", services.Options{
+		Fallback: &services.Fallback{Retries: 2, Page: "<p>back soon</p>"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/admin/export", nil))
+	if w.Code != 200 {
+		t.Fatalf("export: %d %s", w.Code, w.Body.String())
+	}
+	cfg, err := config.Parse(w.Body.Bytes(), config.DefaultLimits)
+	if err != nil {
+		t.Fatalf("exported config doesn't load: %v\n%s", err, w.Body.String())
+	}
+	if a := cfg.Agents["kai"]; a == nil || a.Hostname != "kai.example.com" {
+		t.Errorf("agents = %v, want the runtime-added kai", cfg.Agents)
+	}
+	svc := cfg.Services["dash.example.com"]
+	if svc == nil || svc.Target != "http://localhost:3000" || svc.Agent != "kai" || !svc.Wake ||
+		len(svc.Replicas) != 1 || svc.Replicas[0] != "http://localhost:3001" {
+		t.Errorf("service = %+v", svc)
+	}
+	if docs := cfg.Services["docs.example.com"]; docs == nil || docs.Fallback == nil ||
+		docs.Fallback.Retries != 2 || docs.Fallback.Page != "<p>back soon</p>" {
+		t.Errorf("docs service = %+v, want its fallback exported", docs)
+	}
+}
@@ -0,0 +1,132 @@
+package admin
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"warren/internal/clock"
+)
+
+// CheckTimeout bounds each subsystem check run by /admin/health.
+const CheckTimeout = 2 * time.Second
+
+// CheckCacheTTL is how long /admin/health reuses its last results, so
+// several monitors polling don't each probe every dependency.
+const CheckCacheTTL = 5 * time.Second
+
+// Check probes one subsystem. It returns a short detail for the operator,
+// such as a count or version, or an error if the subsystem is failing.
+type Check func(ctx context.Context) (detail string, err error)
+
+// CheckResult is one subsystem's entry in /admin/health.
+type CheckResult struct {
+	Name        string     `json:"name"`
+	Status      string     `json:"status"` // "ok" or "fail"
+	LatencyMs   float64    `json:"latency_ms"`
+	Detail      string     `json:"detail,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	LastError   string     `json:"last_error,omitempty"` // most recent failure, kept after recovery
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+type lastError struct {
+	msg string
+	at  time.Time
+}
+
+// checks holds the registered subsystem checks, their last failures and
+// the latest results.
+type checks struct {
+	clock clock.Clock
+
+	mu      sync.Mutex
+	byName  map[string]Check
+	lastErr map[string]lastError
+
+	run      sync.Mutex // held while checks run, so callers share one run
+	cached   []CheckResult
+	cachedAt time.Time
+}
+
+// AddCheck registers a subsystem check reported by /admin/health. Adding a
+// check under an existing name replaces it.
+func (s *Server) AddCheck(name string, c Check) {
+	s.checks.mu.Lock()
+	defer s.checks.mu.Unlock()
+	if s.checks.byName == nil {
+		s.checks.byName = make(map[string]Check)
+		s.checks.lastErr = make(map[string]lastError)
+	}
+	s.checks.byName[name] = c
+	s.checks.cached = nil
+}
+
+// runChecks runs every check concurrently, each within CheckTimeout, and
+// returns the results sorted by name. Results less than CheckCacheTTL old
+// are reused.
+func (s *Server) runChecks(ctx context.Context) []CheckResult {
+	clk := clock.Or(s.checks.clock)
+	s.checks.run.Lock()
+	defer s.checks.run.Unlock()
+	s.checks.mu.Lock()
+	if s.checks.cached != nil && clk.Since(s.checks.cachedAt) < CheckCacheTTL {
+		results := append([]CheckResult(nil), s.checks.cached...)
+		s.checks.mu.Unlock()
+		return results
+	}
+	names := make([]string, 0, len(s.checks.byName))
+	fns := make([]Check, 0, len(s.checks.byName))
+	for name, c := range s.checks.byName {
+		names = append(names, name)
+		fns = append(fns, c)
+	}
+	s.checks.mu.Unlock()
+
+	results := make([]CheckResult, len(names))
+	var wg sync.WaitGroup
+	for i := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = runCheck(ctx, names[i], fns[i])
+		}()
+	}
+	wg.Wait()
+
+	s.checks.mu.Lock()
+	for i, r := range results {
+		if r.Error != "" {
+			s.checks.lastErr[r.Name] = lastError{msg: r.Error, at: clk.Now()}
+		}
+		if le, ok := s.checks.lastErr[r.Name]; ok {
+			at := le.at
+			results[i].LastError = le.msg
+			results[i].LastErrorAt = &at
+		}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+	s.checks.cached = append([]CheckResult(nil), results...)
+	s.checks.cachedAt = clk.Now()
+	s.checks.mu.Unlock()
+	return results
+}
+
+func runCheck(ctx context.Context, name string, c Check) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, CheckTimeout)
+	defer cancel()
+	start := time.Now()
+	detail, err := c(ctx)
+	r := CheckResult{
+		Name:      name,
+		Status:    "ok",
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+		Detail:    detail,
+	}
+	if err != nil {
+		r.Status = "fail"
+		r.Error = err.Error()
+	}
+	return r
+}
@@ -0,0 +1,89 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"warren/internal/clock"
+)
+
+func getHealth(t *testing.T, srv *Server) (status string, checks []CheckResult) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/admin/health", nil))
+	var body struct {
+		Status string        `json:"status"`
+		Checks []CheckResult `json:"checks"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v (%s)", err, w.Body.String())
+	}
+	return body.Status, body.Checks
+}
+
+func TestHealthChecks(t *testing.T) {
+	srv, _ := testServer(t)
+	clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	srv.checks.clock = clk
+	failing := true
+	probes := 0
+	srv.AddCheck("storage", func(context.Context) (string, error) {
+		probes++
+		if failing {
+			return "", errors.New("connection refused")
+		}
+		return "", nil
+	})
+	srv.AddCheck("registry", func(context.Context) (string, error) { return "2 services", nil })
+
+	status, checks := getHealth(t, srv)
+	if status != "degraded" {
+		t.Errorf("status = %q, want degraded", status)
+	}
+	if len(checks) != 2 || checks[0].Name != "registry" || checks[1].Name != "storage" {
+		t.Fatalf("checks = %+v, want registry then storage", checks)
+	}
+	if checks[0].Status != "ok" || checks[0].Detail != "2 services" {
+		t.Errorf("registry = %+v", checks[0])
+	}
+	if checks[1].Status != "fail" || checks[1].Error != "connection refused" {
+		t.Errorf("storage = %+v", checks[1])
+	}
+
+	// Polls in quick succession share the results.
+	failing = false
+	if status, _ := getHealth(t, srv); status != "degraded" || probes != 1 {
+		t.Errorf("status = %q after %d probes, want the cached degraded result", status, probes)
+	}
+
+	// Recovered checks keep their last error.
+	clk.Advance(CheckCacheTTL)
+	status, checks = getHealth(t, srv)
+	if status != "ok" {
+		t.Errorf("status = %q, want ok once storage recovers", status)
+	}
+	if c := checks[1]; c.Status != "ok" || c.Error != "" || c.LastError != "connection refused" || c.LastErrorAt == nil {
+		t.Errorf("recovered storage = %+v", c)
+	}
+}
+
+func TestHealthCheckTimeout(t *testing.T) {
+	srv, _ := testServer(t)
+	srv.AddCheck("runtime", func(ctx context.Context) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	})
+
+	start := time.Now()
+	_, checks := getHealth(t, srv)
+	if d := time.Since(start); d > CheckTimeout+time.Second {
+		t.Errorf("health took %s, want about %s", d, CheckTimeout)
+	}
+	if checks[0].Status != "fail" || checks[0].Error != context.DeadlineExceeded.Error() {
+		t.Errorf("runtime = %+v, want a deadline failure", checks[0])
+	}
+}
@@ -0,0 +1,402 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"warren/internal/config"
+	"warren/internal/container"
+	"warren/internal/policy"
+	"warren/internal/proxy"
+	"warren/internal/services"
+	"warren/internal/transport"
+)
+
+// inspectAgent fetches GET /admin/agents/{name}, decodes it into resp if
+// given and returns the raw body.
+func inspectAgent(t *testing.T, handler http.Handler, name string, resp any) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/admin/agents/"+name, nil))
+	if w.Code != 200 {
+		t.Fatalf("inspect %s: expected 200, got %d: %s", name, w.Code, w.Body.String())
+	}
+	if resp != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), resp); err != nil {
+			t.Fatalf("decode: %v (%s)", err, w.Body.String())
+		}
+	}
+	return w.Body.String()
+}
+
+func TestInspectIncludesJobs(t *testing.T) {
+	srv, _ := testServer(t)
+	srv.agents["a"] = AgentInfo{Name: "a", Hostname: "a.example.com", Policy: "on-demand"}
+	srv.prxy.Jobs().Add("a", "batch-1", "reindex", time.Hour)
+
+	var resp struct {
+		Jobs []struct {
+			ID          string `json:"id"`
+			Description string `json:"description"`
+		} `json:"jobs"`
+	}
+	inspectAgent(t, srv.Handler(), "a", &resp)
+	if len(resp.Jobs) != 1 || resp.Jobs[0].ID != "batch-1" {
+		t.Errorf("jobs = %+v", resp.Jobs)
+	}
+}
+
+func TestInspectIncludesRouteOptions(t *testing.T) {
+	srv, _ := testServer(t)
+	srv.agents["a"] = AgentInfo{Name: "a", Hostname: "a.example.com", Policy: "unmanaged"}
+	target, _ := url.Parse("http://localhost:18790")
+	srv.prxy.RegisterWithOptions("a.example.com", "a", target, policy.NewUnmanaged(), proxy.RouteOptions{
+		Timeouts:      &transport.Timeouts{ResponseHeader: 30 * time.Second},
+		Protocol:      transport.H2C,
+		GRPC:          true,
+		MaxWebSockets: 4,
+	})
+
+	var resp map[string]any
+	inspectAgent(t, srv.Handler(), "a", &resp)
+	for key, want := range map[string]any{
+		"timeouts":         "response_header 30s",
+		"backend_protocol": "h2c",
+		"grpc":             true,
+		"websockets":       "0/4",
+	} {
+		if resp[key] != want {
+			t.Errorf("%s = %v, want %v", key, resp[key], want)
+		}
+	}
+	if _, ok := resp["circuit"]; ok {
+		t.Errorf("circuit shown without a breaker: %v", resp["circuit"])
+	}
+}
+
+func TestWakeEndpointRequiresOnDemand(t *testing.T) {
+	srv, _ := testServer(t)
+	srv.agents["a"] = AgentInfo{Name: "a", Hostname: "a.example.com", Policy: "unmanaged"}
+	srv.policies["a"] = policy.NewUnmanaged()
+	handler := srv.Handler()
+
+	req := httptest.NewRequest("GET", "/admin/agents/a/wake", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != 400 {
+		t.Fatalf("expected 400 for unmanaged agent, got %d", w.Code)
+	}
+}
+
+func TestPortsEndpointAndInspect(t *testing.T) {
+	srv, _ := testServer(t)
+	srv.agents["a"] = AgentInfo{Name: "a", Hostname: "a.example.com", Policy: "on-demand"}
+	srv.registry.RecordPorts("a", []services.PortMapping{{Agent: "a", Target: 8080, Published: 30000, Protocol: "tcp"}})
+	handler := srv.Handler()
+
+	req := httptest.NewRequest("GET", "/admin/ports", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	var all []services.PortMapping
+	if err := json.Unmarshal(w.Body.Bytes(), &all); err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || all[0].Published != 30000 {
+		t.Errorf("ports = %+v", all)
+	}
+
+	var resp struct {
+		PublishedPorts []services.PortMapping `json:"published_ports"`
+	}
+	inspectAgent(t, handler, "a", &resp)
+	if len(resp.PublishedPorts) != 1 {
+		t.Errorf("published_ports = %+v", resp.PublishedPorts)
+	}
+}
+
+func TestInspectContainerUnavailable(t *testing.T) {
+	srv, _ := testServer(t)
+	srv.agents["a"] = AgentInfo{Name: "a", Hostname: "a.example.com", Policy: "on-demand", ContainerName: "a-svc"}
+	srv.agents["u"] = AgentInfo{Name: "u", Hostname: "u.example.com", Policy: "unmanaged"}
+	handler := srv.Handler()
+
+	for path, want := range map[string]int{
+		"/admin/agents/a?container=true": 503, // no container manager in tests
+		"/admin/agents/u?container=true": 400,
+		"/admin/agents/a":                200,
+	} {
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("GET %s: expected %d, got %d", path, want, w.Code)
+		}
+	}
+}
+
+type fakeInspector struct{}
+
+func (fakeInspector) Inspect(context.Context, string) (*container.Details, error) {
+	return &container.Details{ContainerID: "c1", Image: "agent:2", ImageDigest: "sha256:abc"}, nil
+}
+
+func TestInspectIncludesContainerIdentity(t *testing.T) {
+	srv, _ := testServer(t)
+	srv.agents["a"] = AgentInfo{Name: "a", Hostname: "a.example.com", Policy: "on-demand", ContainerName: "a-svc"}
+	tracker := container.NewIdentityTracker(fakeInspector{}, srv.logger)
+	tracker.Register("a", "a-svc")
+	if err := tracker.Refresh(context.Background(), "a"); err != nil {
+		t.Fatal(err)
+	}
+	srv.SetIdentityTracker(tracker)
+
+	var resp map[string]any
+	inspectAgent(t, srv.Handler(), "a", &resp)
+	if resp["container_id"] != "c1" || resp["image_digest"] != "sha256:abc" {
+		t.Errorf("resp = %v", resp)
+	}
+}
+
+func TestWakeKeepAwake(t *testing.T) {
+	srv, _ := testServer(t)
+	srv.agents["a"] = AgentInfo{Name: "a", Hostname: "a.example.com", Policy: "on-demand"}
+	srv.policies["a"] = policy.NewOnDemand(nil, policy.OnDemandConfig{Agent: "a", Hostname: "a.example.com"},
+		srv.prxy.Activity(), srv.prxy.WSCounter(), srv.events, srv.logger)
+	handler := srv.Handler()
+
+	req := httptest.NewRequest("POST", "/admin/agents/a/wake", strings.NewReader(`{"keep_awake":"soon"}`))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != 422 {
+		t.Fatalf("expected 422 for invalid keep_awake, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/admin/agents/a/wake", strings.NewReader(`{"keep_awake":"1h"}`))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/admin/agents", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	var agents []struct {
+		Name      string     `json:"name"`
+		HeldUntil *time.Time `json:"held_until"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &agents); err != nil {
+		t.Fatal(err)
+	}
+	if len(agents) != 1 || agents[0].HeldUntil == nil || time.Until(*agents[0].HeldUntil) < 59*time.Minute {
+		t.Errorf("agents = %+v", agents)
+	}
+}
+
+func TestPatchAnnotations(t *testing.T) {
+	srv, cfgPath := testServer(t)
+	srv.agents["a"] = AgentInfo{Name: "a", Hostname: "a.example.com", Policy: "on-demand"}
+	srv.cfg.Agents["a"] = &config.Agent{Hostname: "a.example.com", Backend: "http://a:8080", Policy: "unmanaged"}
+	handler := srv.Handler()
+
+	patch := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PATCH", "/admin/agents/a/annotations", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := patch(`{"owner": "team-x", "note": "do not sleep during demos"}`)
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+	w = patch(`{"note": null, "oncall": "#ops"}`)
+	var got map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got["owner"] != "team-x" || got["oncall"] != "#ops" {
+		t.Errorf("annotations = %v, want owner and oncall", got)
+	}
+
+	// Saved with the config and shown by inspect.
+	saved, err := config.Load(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Agents["a"].Annotations["owner"] != "team-x" {
+		t.Errorf("saved annotations = %v", saved.Agents["a"].Annotations)
+	}
+	if body := inspectAgent(t, handler, "a", nil); !strings.Contains(body, `"annotations":{"oncall":"#ops","owner":"team-x"}`) {
+		t.Errorf("inspect = %s", body)
+	}
+
+	if w := patch(`{"bad key": "x"}`); w.Code != 422 {
+		t.Errorf("invalid key: got %d, want 422", w.Code)
+	}
+}
+
+func TestBulkWakeBySelector(t *testing.T) {
+	srv, _ := testServer(t)
+	for name, env := range map[string]string{"a": "staging", "b": "staging", "c": "prod"} {
+		srv.cfg.Agents[name] = &config.Agent{Hostname: name + ".example.com", Labels: map[string]string{"env": env}}
+		srv.agents[name] = AgentInfo{Name: name, Hostname: name + ".example.com", Policy: "on-demand"}
+		srv.policies[name] = policy.NewOnDemand(nil, policy.OnDemandConfig{Agent: name, Hostname: name + ".example.com"},
+			srv.prxy.Activity(), srv.prxy.WSCounter(), srv.events, srv.logger)
+	}
+	srv.policies["b"] = policy.NewUnmanaged()
+	handler := srv.Handler()
+
+	for _, body := range []string{`{}`, `{"all":true,"selector":"env=staging"}`, `{"selector":"=staging"}`} {
+		req := httptest.NewRequest("POST", "/admin/wake", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != 422 {
+			t.Errorf("%s: expected 422, got %d", body, w.Code)
+		}
+	}
+	req := httptest.NewRequest("POST", "/admin/sleep", strings.NewReader(`{"all":true,"keep_awake":"1h"}`))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != 422 {
+		t.Errorf("expected 422 for keep_awake on sleep, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/admin/wake", strings.NewReader(`{"selector":"env=staging"}`))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Agents []bulkResult `json:"agents"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	want := []bulkResult{{Name: "a", Status: "waking"}, {Name: "b", Status: "skipped", Reason: "not on-demand"}}
+	if len(resp.Agents) != 2 || resp.Agents[0] != want[0] || resp.Agents[1] != want[1] {
+		t.Errorf("agents = %+v, want %+v", resp.Agents, want)
+	}
+}
+
+func TestSleepWithAwakeDependents(t *testing.T) {
+	srv, _ := testServer(t)
+	deps := policy.NewDependencies(srv.logger)
+	srv.SetDependencies(deps)
+	for name, needs := range map[string][]string{"db": nil, "bot": {"db"}} {
+		srv.cfg.Agents[name] = &config.Agent{Hostname: name + ".example.com", DependsOn: needs, Labels: map[string]string{"env": "staging"}}
+		srv.agents[name] = AgentInfo{Name: name, Hostname: name + ".example.com", Policy: "on-demand"}
+	}
+	srv.policies["db"] = policy.NewOnDemand(nil, policy.OnDemandConfig{Agent: "db", Hostname: "db.example.com"},
+		srv.prxy.Activity(), srv.prxy.WSCounter(), srv.events, srv.logger)
+	// bot stays up: it's unmanaged, so neither request can sleep it.
+	srv.policies["bot"] = policy.NewUnmanaged()
+	deps.Set("db", srv.policies["db"], nil)
+	deps.Set("bot", srv.policies["bot"], []string{"db"})
+	handler := srv.Handler()
+
+	req := httptest.NewRequest("POST", "/admin/agents/db/sleep", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), `"dependents":["bot"]`) {
+		t.Errorf("sleep: %d %s, want 409 listing bot", w.Code, w.Body)
+	}
+
+	req = httptest.NewRequest("POST", "/admin/sleep", strings.NewReader(`{"selector":"env=staging"}`))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	var resp struct {
+		Agents []bulkResult `json:"agents"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	want := []bulkResult{{Name: "bot", Status: "skipped", Reason: "not on-demand"}, {Name: "db", Status: "skipped", Reason: "depended on by bot"}}
+	if len(resp.Agents) != 2 || resp.Agents[0] != want[0] || resp.Agents[1] != want[1] {
+		t.Errorf("agents = %+v, want %+v", resp.Agents, want)
+	}
+}
+
+func TestListAgentsBySelector(t *testing.T) {
+	srv, _ := testServer(t)
+	for name, env := range map[string]string{"a": "staging", "b": "prod"} {
+		srv.cfg.Agents[name] = &config.Agent{Hostname: name + ".example.com", Labels: map[string]string{"env": env}}
+		srv.agents[name] = AgentInfo{Name: name, Hostname: name + ".example.com", Policy: "unmanaged"}
+	}
+	handler := srv.Handler()
+
+	req := httptest.NewRequest("GET", "/admin/agents?selector=env%3Dstaging", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var agents []struct {
+		Name   string            `json:"name"`
+		Labels map[string]string `json:"labels"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &agents); err != nil {
+		t.Fatal(err)
+	}
+	if len(agents) != 1 || agents[0].Name != "a" || agents[0].Labels["env"] != "staging" {
+		t.Errorf("agents = %+v, want only a with env=staging", agents)
+	}
+
+	req = httptest.NewRequest("GET", "/admin/agents?selector=%3Dstaging", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != 422 {
+		t.Errorf("expected 422 for an invalid selector, got %d", w.Code)
+	}
+
+	if body := inspectAgent(t, handler, "b", nil); !strings.Contains(body, `"labels":{"env":"prod"}`) {
+		t.Errorf("expected labels in inspect output, got %s", body)
+	}
+}
+
+func TestAddAgentInvalidLabels(t *testing.T) {
+	srv, _ := testServer(t)
+	body := `{"name":"x","hostname":"x.example.com","backend":"http://x:8080","policy":"unmanaged","labels":{"bad key":"v"}}`
+	req := httptest.NewRequest("POST", "/admin/agents", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+	if w.Code != 422 || !strings.Contains(w.Body.String(), "labels") {
+		t.Errorf("expected 422 naming labels, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestRemoveAgentWithDependents(t *testing.T) {
+	srv, _ := testServer(t)
+	handler := srv.Handler()
+	for _, name := range []string{"bot", "db"} {
+		body, _ := json.Marshal(AddAgentRequest{Name: name, Hostname: name + ".example.com", Backend: "http://localhost:18790", Policy: "unmanaged"})
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/admin/agents", strings.NewReader(string(body))))
+	}
+	srv.cfg.Agents["bot"].DependsOn = []string{"db"}
+
+	if body := inspectAgent(t, handler, "db", nil); !strings.Contains(body, `"dependents":["bot"]`) {
+		t.Errorf("expected dependents in inspect output, got %s", body)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("DELETE", "/admin/agents/db?force=true", nil))
+	if w.Code != 409 || !strings.Contains(w.Body.String(), `"dependents":["bot"]`) {
+		t.Fatalf("expected 409 naming bot, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Once bot is gone, db can go too.
+	for _, name := range []string{"bot", "db"} {
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("DELETE", "/admin/agents/"+name, nil))
+		if w.Code != 200 {
+			t.Errorf("remove %s: expected 200, got %d: %s", name, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"warren/internal/config"
+)
+
+// k8sObject is the common shape of the manifests written by the k8s export.
+type k8sObject struct {
+	APIVersion string      `yaml:"apiVersion"`
+	Kind       string      `yaml:"kind"`
+	Metadata   k8sMetadata `yaml:"metadata"`
+	Spec       any         `yaml:"spec"`
+}
+
+type k8sMetadata struct {
+	Name        string            `yaml:"name"`
+	Namespace   string            `yaml:"namespace,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+type k8sDeploymentSpec struct {
+	Replicas int `yaml:"replicas"`
+	Selector struct {
+		MatchLabels map[string]string `yaml:"matchLabels"`
+	} `yaml:"selector"`
+	Template struct {
+		Metadata k8sMetadata `yaml:"metadata"`
+		Spec     struct {
+			Containers []k8sContainer `yaml:"containers"`
+		} `yaml:"spec"`
+	} `yaml:"template"`
+}
+
+type k8sContainer struct {
+	Name           string    `yaml:"name"`
+	Image          string    `yaml:"image"`
+	Ports          []k8sPort `yaml:"ports"`
+	ReadinessProbe *k8sProbe `yaml:"readinessProbe,omitempty"`
+	LivenessProbe  *k8sProbe `yaml:"livenessProbe,omitempty"`
+	StartupProbe   *k8sProbe `yaml:"startupProbe,omitempty"`
+}
+
+type k8sPort struct {
+	Name          string `yaml:"name,omitempty"`
+	ContainerPort int    `yaml:"containerPort"`
+}
+
+type k8sProbe struct {
+	HTTPGet struct {
+		Path   string `yaml:"path"`
+		Port   int    `yaml:"port"`
+		Scheme string `yaml:"scheme,omitempty"`
+	} `yaml:"httpGet"`
+	PeriodSeconds    int `yaml:"periodSeconds,omitempty"`
+	FailureThreshold int `yaml:"failureThreshold,omitempty"`
+}
+
+type k8sServiceSpec struct {
+	Selector map[string]string `yaml:"selector"`
+	Ports    []k8sServicePort  `yaml:"ports"`
+}
+
+type k8sServicePort struct {
+	Name       string `yaml:"name"`
+	Port       int    `yaml:"port"`
+	TargetPort int    `yaml:"targetPort"`
+}
+
+type k8sIngressSpec struct {
+	IngressClassName string           `yaml:"ingressClassName,omitempty"`
+	Rules            []k8sIngressRule `yaml:"rules"`
+}
+
+type k8sIngressRule struct {
+	Host string `yaml:"host"`
+	HTTP struct {
+		Paths []k8sIngressPath `yaml:"paths"`
+	} `yaml:"http"`
+}
+
+type k8sIngressPath struct {
+	Path     string `yaml:"path"`
+	PathType string `yaml:"pathType"`
+	Backend  struct {
+		Service struct {
+			Name string `yaml:"name"`
+			Port struct {
+				Number int `yaml:"number"`
+			} `yaml:"port"`
+		} `yaml:"service"`
+	} `yaml:"backend"`
+}
+
+// k8sOptions are the cluster-specific settings of a k8s export.
+type k8sOptions struct {
+	Namespace    string
+	IngressClass string
+}
+
+// handleK8sExport serves GET /admin/export?format=k8s: a Deployment,
+// Service and Ingress for each agent run from a container.
+func (s *Server) handleK8sExport(w http.ResponseWriter, r *http.Request) {
+	opts := k8sOptions{Namespace: r.URL.Query().Get("namespace"), IngressClass: r.URL.Query().Get("ingress_class")}
+
+	s.mu.RLock()
+	agents := make(map[string]*config.Agent, len(s.cfg.Agents))
+	for name, agent := range s.cfg.Agents {
+		agents[name] = agent
+	}
+	s.mu.RUnlock()
+
+	images := make(map[string]string)
+	if s.manager != nil {
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+		for name, agent := range agents {
+			if agent.Container.Name == "" {
+				continue
+			}
+			img, err := s.manager.Image(ctx, agent.Container.Name)
+			if err != nil {
+				s.logger.Warn("k8s export: failed to resolve image", "agent", name, "error", err)
+				continue
+			}
+			images[name] = img
+		}
+	}
+
+	out, err := renderK8s(agents, images, opts)
+	if err != nil {
+		s.logger.Error("failed to export k8s manifests", "error", err)
+		http.Error(w, `{"error":"failed to export k8s manifests"}`, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	_, _ = w.Write(out)
+}
+
+// renderK8s builds the manifests for agents, in name order. Agents
+// without a container are left out, and a header comment says so and
+// points out what Kubernetes won't do the way Warren did.
+func renderK8s(agents map[string]*config.Agent, images map[string]string, opts k8sOptions) ([]byte, error) {
+	names := make([]string, 0, len(agents))
+	for name := range agents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	buf.WriteString("# Exported from the running orchestrator at " + time.Now().UTC().Format(time.RFC3339) + ".\n")
+	var objects []k8sObject
+	for _, name := range names {
+		agent := agents[name]
+		if agent.Container.Name == "" {
+			fmt.Fprintf(&buf, "# agent %s: no container, left out\n", name)
+			continue
+		}
+		if agent.Policy == "on-demand" {
+			fmt.Fprintf(&buf, "# agent %s: on-demand in Warren; it runs all the time here unless scaled to zero by something like KEDA\n", name)
+		}
+		image := images[name]
+		if image == "" {
+			image = agent.Container.Name + ":latest"
+			fmt.Fprintf(&buf, "# agent %s: image unknown, set it in the Deployment\n", name)
+		}
+		objs, err := k8sAgent(name, agent, image, opts)
+		if err != nil {
+			return nil, fmt.Errorf("agent %s: %w", name, err)
+		}
+		objects = append(objects, objs...)
+	}
+
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	for _, obj := range objects {
+		if err := enc.Encode(obj); err != nil {
+			return nil, err
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// k8sAgent returns the Deployment, Service and Ingress for one agent.
+func k8sAgent(name string, agent *config.Agent, image string, opts k8sOptions) ([]k8sObject, error) {
+	backend, err := url.Parse(agent.Backend)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backend URL: %w", err)
+	}
+	port := urlPort(backend)
+	objName := k8sName(name)
+	labels := map[string]string{"app.kubernetes.io/name": objName, "warren.agent": name}
+	meta := func() k8sMetadata {
+		return k8sMetadata{Name: objName, Namespace: opts.Namespace, Labels: labels}
+	}
+
+	var deploy k8sDeploymentSpec
+	deploy.Replicas = 1 + len(agent.Replicas)
+	deploy.Selector.MatchLabels = map[string]string{"app.kubernetes.io/name": objName}
+	deploy.Template.Metadata = k8sMetadata{Labels: labels}
+	c := k8sContainer{Name: objName, Image: image, Ports: []k8sPort{{Name: "http", ContainerPort: port}}}
+	if agent.Health.URL != "" {
+		health, err := url.Parse(agent.Health.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid health URL: %w", err)
+		}
+		probe := func() *k8sProbe {
+			p := &k8sProbe{PeriodSeconds: int(time.Duration(agent.Health.CheckInterval) / time.Second), FailureThreshold: agent.Health.MaxFailures}
+			p.HTTPGet.Path = health.RequestURI()
+			p.HTTPGet.Port = urlPort(health)
+			if health.Scheme == "https" {
+				p.HTTPGet.Scheme = "HTTPS"
+			}
+			return p
+		}
+		c.ReadinessProbe = probe()
+		c.LivenessProbe = probe()
+		if agent.Health.StartupTimeout > 0 {
+			// Allow the startup timeout before liveness takes over.
+			c.StartupProbe = probe()
+			c.StartupProbe.PeriodSeconds = 5
+			c.StartupProbe.FailureThreshold = max(1, int(time.Duration(agent.Health.StartupTimeout)/(5*time.Second)))
+		}
+	}
+	deploy.Template.Spec.Containers = []k8sContainer{c}
+	deployMeta := meta()
+	deployMeta.Annotations = map[string]string{"warren.policy": agent.Policy}
+
+	svc := k8sServiceSpec{
+		Selector: map[string]string{"app.kubernetes.io/name": objName},
+		Ports:    []k8sServicePort{{Name: "http", Port: port, TargetPort: port}},
+	}
+
+	ingress := k8sIngressSpec{IngressClassName: opts.IngressClass}
+	for _, host := range append([]string{agent.Hostname}, agent.Hostnames...) {
+		var path k8sIngressPath
+		path.Path = "/"
+		path.PathType = "Prefix"
+		path.Backend.Service.Name = objName
+		path.Backend.Service.Port.Number = port
+		rule := k8sIngressRule{Host: host}
+		rule.HTTP.Paths = []k8sIngressPath{path}
+		ingress.Rules = append(ingress.Rules, rule)
+	}
+
+	return []k8sObject{
+		{APIVersion: "apps/v1", Kind: "Deployment", Metadata: deployMeta, Spec: deploy},
+		{APIVersion: "v1", Kind: "Service", Metadata: meta(), Spec: svc},
+		{APIVersion: "networking.k8s.io/v1", Kind: "Ingress", Metadata: meta(), Spec: ingress},
+	}, nil
+}
+
+// urlPort returns u's port, or the scheme's default.
+func urlPort(u *url.URL) int {
+	if p, err := strconv.Atoi(u.Port()); err == nil {
+		return p
+	}
+	if u.Scheme == "https" {
+		return 443
+	}
+	return 80
+}
+
+var k8sNameInvalid = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// k8sName turns an agent name into a valid object name: lowercase
+// alphanumerics and dashes, at most 63 characters.
+func k8sName(name string) string {
+	n := k8sNameInvalid.ReplaceAllString(strings.ToLower(name), "-")
+	if len(n) > 63 {
+		n = n[:63]
+	}
+	return strings.Trim(n, "-")
+}
@@ -0,0 +1,208 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"warren/internal/agents"
+	"warren/internal/human"
+	"warren/internal/policy"
+	"warren/internal/revisions"
+	"warren/internal/security"
+	"warren/internal/validate"
+)
+
+// PatchAgentRequest is the JSON body for PATCH /admin/agents/{name}. Only
+// the fields given change; durations are strings such as "30m".
+type PatchAgentRequest struct {
+	Hostnames          []string `json:"hostnames"` // aliases; [] removes them all
+	HealthURL          *string  `json:"health_url"`
+	IdleTimeout        *string  `json:"idle_timeout"`
+	MaxUptime          *string  `json:"max_uptime"` // "" turns it off
+	CheckInterval      *string  `json:"check_interval"`
+	MaxFailures        *int     `json:"max_failures"`
+	MaxRestartAttempts *int     `json:"max_restart_attempts"`
+}
+
+// patchAgent serves PATCH /admin/agents/{name}. Unlike PUT, which restarts
+// the agent, it changes a running agent in place: its policy is
+// reconfigured and its hostname aliases are routed or dropped, so open
+// connections are kept. The changed fields are returned.
+func (s *Server) patchAgent(w http.ResponseWriter, r *http.Request, name string) {
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxBody())
+	var req PatchAgentRequest
+	errs := validate.Decode(r, &req)
+	if len(errs) == 0 {
+		for i, h := range req.Hostnames {
+			if err := security.ValidateHostname(h); err != nil {
+				errs.Add("hostnames", "%s: %v", h, err)
+			} else if containsFold(req.Hostnames[:i], h) {
+				errs.Add("hostnames", "%s is listed twice", h)
+			}
+		}
+		if req.HealthURL != nil && *req.HealthURL != "" {
+			if err := security.ValidateHealthURL(*req.HealthURL); err != nil {
+				errs.Add("health_url", "%v", err)
+			}
+		}
+		if req.IdleTimeout != nil {
+			errs.Required("idle_timeout", *req.IdleTimeout)
+		}
+		if req.CheckInterval != nil {
+			errs.Required("check_interval", *req.CheckInterval)
+		}
+		if req.MaxFailures != nil && *req.MaxFailures < 1 {
+			errs.Add("max_failures", "must be at least 1")
+		}
+		if req.MaxRestartAttempts != nil && *req.MaxRestartAttempts < 0 {
+			errs.Add("max_restart_attempts", "must not be negative")
+		}
+	}
+	var idleTimeout, maxUptime, checkInterval time.Duration
+	if req.IdleTimeout != nil {
+		idleTimeout = errs.Duration("idle_timeout", *req.IdleTimeout)
+	}
+	if req.MaxUptime != nil {
+		maxUptime = errs.Duration("max_uptime", *req.MaxUptime)
+	}
+	if req.CheckInterval != nil {
+		checkInterval = errs.Duration("check_interval", *req.CheckInterval)
+	}
+	if validate.Write(w, errs) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := s.cfg.Agents[name]
+	if current == nil {
+		http.Error(w, `{"error":"agent not found"}`, http.StatusNotFound)
+		return
+	}
+	if req.HealthURL != nil && *req.HealthURL == "" && current.Policy != "unmanaged" {
+		errs.Add("health_url", "is required for the %s policy", current.Policy)
+	}
+	if current.Policy != "on-demand" {
+		if req.IdleTimeout != nil {
+			errs.Add("idle_timeout", "needs the on-demand policy")
+		}
+		if req.MaxUptime != nil {
+			errs.Add("max_uptime", "needs the on-demand policy")
+		}
+	}
+	for _, h := range req.Hostnames {
+		if strings.EqualFold(h, current.Hostname) {
+			errs.Add("hostnames", "%s is the agent's primary hostname", h)
+		}
+	}
+	if validate.Write(w, errs) {
+		return
+	}
+	for _, h := range req.Hostnames {
+		if b, ok := s.prxy.Backend(h); ok && b.AgentName != name {
+			http.Error(w, `{"error":"hostname `+h+` is in use by another agent"}`, http.StatusConflict)
+			return
+		}
+		if _, ok := s.registry.Lookup(h); ok {
+			http.Error(w, `{"error":"hostname `+h+` is in use by a service"}`, http.StatusConflict)
+			return
+		}
+	}
+
+	// Copied rather than changed in place: policies and the proxy may
+	// still hold the old agent.
+	agent := *current
+	var changed []string
+	if req.Hostnames != nil {
+		agent.Hostnames = slices.Clone(req.Hostnames)
+		if len(agent.Hostnames) == 0 {
+			agent.Hostnames = nil
+		}
+		changed = append(changed, "hostnames")
+	}
+	if req.HealthURL != nil {
+		agent.Health.URL = *req.HealthURL
+		changed = append(changed, "health_url")
+	}
+	if req.IdleTimeout != nil {
+		agent.Idle.Timeout = human.Duration(idleTimeout)
+		changed = append(changed, "idle_timeout")
+	}
+	if req.MaxUptime != nil {
+		agent.Idle.MaxUptime = human.Duration(maxUptime)
+		changed = append(changed, "max_uptime")
+	}
+	if req.CheckInterval != nil {
+		agent.Health.CheckInterval = human.Duration(checkInterval)
+		changed = append(changed, "check_interval")
+	}
+	if req.MaxFailures != nil {
+		agent.Health.MaxFailures = *req.MaxFailures
+		changed = append(changed, "max_failures")
+	}
+	if req.MaxRestartAttempts != nil {
+		agent.Health.MaxRestartAttempts = *req.MaxRestartAttempts
+		changed = append(changed, "max_restart_attempts")
+	}
+
+	if len(changed) == 0 {
+		errs.Add("", "nothing to change")
+		validate.Write(w, errs)
+		return
+	}
+
+	pol := s.policies[name]
+	if req.Hostnames != nil {
+		for _, h := range current.Hostnames {
+			if !containsFold(agent.Hostnames, h) {
+				s.prxy.Deregister(h)
+			}
+		}
+		// New aliases share the primary hostname's backend and route
+		// options.
+		for _, h := range agent.Hostnames {
+			if containsFold(current.Hostnames, h) {
+				continue
+			}
+			if b, ok := s.prxy.Backend(agent.Hostname); ok {
+				s.prxy.RegisterWithOptions(h, name, b.Target, b.Policy, b.Options)
+			} else if target, err := url.Parse(agent.Backend); err == nil {
+				s.prxy.Register(h, name, target, pol)
+			}
+		}
+		// Passthrough routes the same hostnames by SNI.
+		if target, err := url.Parse(agent.Backend); err == nil {
+			s.prxy.SNI().Register(agents.SNITarget(name, &agent, target, pol))
+		}
+	}
+	switch pol := pol.(type) {
+	case *policy.OnDemand:
+		pol.Reconfigure(time.Duration(agent.Idle.Timeout), time.Duration(agent.Health.CheckInterval), time.Duration(agent.Idle.MaxUptime), agent.Health.MaxFailures, agent.Health.MaxRestartAttempts)
+		pol.SetHealthURL(agent.Health.URL)
+	case *policy.AlwaysOn:
+		pol.Reconfigure(time.Duration(agent.Health.CheckInterval), agent.Health.MaxFailures)
+		pol.SetHealthURL(agent.Health.URL)
+	}
+
+	s.cfg.Agents[name] = &agent
+	if _, ok := s.agents[name]; ok {
+		s.agents[name] = agentInfo(name, &agent)
+	}
+	s.saveConfig("patching agent")
+
+	s.recordAgentNote(name, revisions.ActionUpdated, revisions.Actor(r), "changed "+strings.Join(changed, ", "), &agent)
+	s.logger.Info("agent patched via API", "name", name, "changed", changed)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"status": "ok", "name": name, "changed": changed})
+}
+
+// containsFold reports whether hostnames contains h, ignoring case.
+func containsFold(hostnames []string, h string) bool {
+	return slices.ContainsFunc(hostnames, func(n string) bool { return strings.EqualFold(n, h) })
+}
@@ -0,0 +1,85 @@
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"warren/internal/config"
+)
+
+func TestPatchAgent(t *testing.T) {
+	srv, _ := testServer(t)
+	handler := srv.Handler()
+
+	for _, req := range []AddAgentRequest{
+		{Name: "kai", Hostname: "kai.example.com", Backend: "http://localhost:18790", Policy: "always-on", ContainerName: "kai", HealthURL: "http://localhost:18790/health"},
+		{Name: "other", Hostname: "other.example.com", Backend: "http://localhost:18791", Policy: "unmanaged"},
+	} {
+		body, _ := json.Marshal(req)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("POST", "/admin/agents", bytes.NewReader(body)))
+		if w.Code != 201 {
+			t.Fatalf("add %s: %d %s", req.Name, w.Code, w.Body.String())
+		}
+	}
+	srv.cfg.Agents["kai"].Hostnames = []string{"old.example.com"}
+	srv.cfg.Agents["kai"].TLSPassthrough = &config.TLSPassthrough{Port: 8443}
+	srv.prxy.Register("old.example.com", "kai", srv.prxy.Backends()["kai.example.com"].Target, srv.policies["kai"])
+	pol := srv.policies["kai"]
+	if err := srv.registry.Register("dash.example.com", "http://localhost:3000", "other"); err != nil {
+		t.Fatal(err)
+	}
+
+	patch := func(name, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("PATCH", "/admin/agents/"+name, strings.NewReader(body)))
+		return w
+	}
+
+	w := patch("kai", `{"hostnames":["new.example.com"],"health_url":"http://localhost:18790/ready","check_interval":"10s","max_failures":5}`)
+	if w.Code != 200 || !strings.Contains(w.Body.String(), `"changed":["hostnames","health_url","check_interval","max_failures"]`) {
+		t.Fatalf("patch: %d %s", w.Code, w.Body.String())
+	}
+	if srv.policies["kai"] != pol {
+		t.Error("patch replaced the agent's policy instead of reconfiguring it")
+	}
+	backends := srv.prxy.Backends()
+	for host, want := range map[string]bool{"kai.example.com": true, "new.example.com": true, "old.example.com": false} {
+		if _, ok := backends[host]; ok != want {
+			t.Errorf("%s routed = %v, want %v", host, ok, want)
+		}
+	}
+	if got := srv.prxy.SNI().Hostnames("kai"); !slices.Equal(got, []string{"kai.example.com", "new.example.com"}) {
+		t.Errorf("passthrough hostnames = %v, want the primary and new alias", got)
+	}
+	agent := srv.cfg.Agents["kai"]
+	if agent.Health.URL != "http://localhost:18790/ready" || time.Duration(agent.Health.CheckInterval) != 10*time.Second || agent.Health.MaxFailures != 5 {
+		t.Errorf("patched config = %+v", agent.Health)
+	}
+	if srv.agents["kai"].HealthURL != "http://localhost:18790/ready" {
+		t.Errorf("admin state = %+v", srv.agents["kai"])
+	}
+
+	for _, tc := range []struct {
+		name, agent, body string
+		code              int
+	}{
+		{"idle timeout needs on-demand", "kai", `{"idle_timeout":"1h"}`, 422},
+		{"bad duration", "kai", `{"check_interval":"soon"}`, 422},
+		{"primary as alias", "kai", `{"hostnames":["kai.example.com"]}`, 422},
+		{"alias listed twice", "kai", `{"hostnames":["a.example.com","A.example.com"]}`, 422},
+		{"nothing to change", "kai", `{}`, 422},
+		{"alias of another agent", "kai", `{"hostnames":["other.example.com"]}`, 409},
+		{"alias of a service", "kai", `{"hostnames":["DASH.example.com"]}`, 409},
+		{"missing agent", "missing", `{"max_failures":2}`, 404},
+	} {
+		if w := patch(tc.agent, tc.body); w.Code != tc.code {
+			t.Errorf("%s: %d %s, want %d", tc.name, w.Code, w.Body.String(), tc.code)
+		}
+	}
+}
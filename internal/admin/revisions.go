@@ -0,0 +1,154 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"gopkg.in/yaml.v3"
+
+	"warren/internal/config"
+	"warren/internal/revisions"
+	"warren/internal/validate"
+)
+
+// SetRevisionLog records agent changes made through the admin API and
+// serves their history.
+func (s *Server) SetRevisionLog(l *revisions.Log) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revisions = l
+}
+
+// recordAgent appends a revision for the agent, if history is enabled.
+func (s *Server) recordAgent(name, action, actor string, agent *config.Agent) {
+	s.recordAgentNote(name, action, actor, "", agent)
+}
+
+func (s *Server) recordAgentNote(name, action, actor, note string, agent *config.Agent) {
+	if s.revisions == nil {
+		return
+	}
+	var spec any
+	if agent != nil {
+		spec = agent
+	}
+	if _, err := s.revisions.Record(revisions.KindAgent, name, action, actor, note, spec); err != nil {
+		s.logger.Error("failed to record agent revision", "name", name, "error", err)
+	}
+}
+
+// listRevisions serves GET /admin/agents/{name}/revisions, newest first.
+func (s *Server) listRevisions(w http.ResponseWriter, name string) {
+	s.mu.RLock()
+	log := s.revisions
+	s.mu.RUnlock()
+	if log == nil {
+		http.Error(w, `{"error":"revision history not available"}`, http.StatusServiceUnavailable)
+		return
+	}
+	revs := log.List(revisions.KindAgent, name)
+	if len(revs) == 0 {
+		http.Error(w, `{"error":"no revisions for agent"}`, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(revs)
+}
+
+// rollbackAgent serves POST /admin/agents/{name}/rollback with body
+// {"revision": N}: the agent is rebuilt from revision N's definition,
+// recreating it if it has since been removed. If the revision fails to
+// start, the current definition is started again.
+func (s *Server) rollbackAgent(w http.ResponseWriter, r *http.Request, name string) {
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxBody())
+	var req struct {
+		Revision int `json:"revision"`
+	}
+	errs := validate.Decode(r, &req)
+	if len(errs) == 0 && req.Revision <= 0 {
+		errs.Add("revision", "must be a positive revision number")
+	}
+	if validate.Write(w, errs) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.revisions == nil {
+		http.Error(w, `{"error":"revision history not available"}`, http.StatusServiceUnavailable)
+		return
+	}
+	rev, ok := s.revisions.Get(revisions.KindAgent, name, req.Revision)
+	if !ok {
+		http.Error(w, `{"error":"revision not found"}`, http.StatusNotFound)
+		return
+	}
+	if rev.Spec == "" {
+		http.Error(w, `{"error":"revision has no definition to roll back to (agent was removed)"}`, http.StatusBadRequest)
+		return
+	}
+	agent := &config.Agent{}
+	if err := yaml.Unmarshal([]byte(rev.Spec), agent); err != nil {
+		s.logger.Error("failed to parse agent revision", "name", name, "revision", rev.Number, "error", err)
+		http.Error(w, `{"error":"stored revision is unreadable"}`, http.StatusInternalServerError)
+		return
+	}
+	if b, ok := s.prxy.Backend(agent.Hostname); ok && b.AgentName != name {
+		http.Error(w, `{"error":"hostname is in use by another agent"}`, http.StatusConflict)
+		return
+	}
+
+	if err := s.replaceAgent(name, agent); err != nil {
+		s.logger.Error("failed to start rolled-back agent", "name", name, "error", err)
+		http.Error(w, `{"error":"failed to start agent from revision"}`, http.StatusInternalServerError)
+		return
+	}
+	if _, ok := s.trash[name]; ok {
+		delete(s.trash, name)
+		s.saveTrash()
+	}
+	s.saveConfig("rolling back agent")
+
+	s.recordAgentNote(name, revisions.ActionRolledBack, revisions.Actor(r), fmt.Sprintf("to revision %d", rev.Number), agent)
+	s.logger.Info("agent rolled back via API", "name", name, "revision", rev.Number)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"status": "ok", "name": name, "revision": rev.Number})
+}
+
+// replaceAgent stops name and starts it again from agent. If the new
+// definition fails to start, the previous one is started again so a bad
+// update doesn't leave the agent down. Caller must hold s.mu.
+func (s *Server) replaceAgent(name string, agent *config.Agent) error {
+	previous := s.cfg.Agents[name]
+	s.stopAgent(name)
+	err := s.startAgent(name, agent)
+	if err == nil || previous == nil {
+		return err
+	}
+	if restoreErr := s.startAgent(name, previous); restoreErr != nil {
+		s.logger.Error("failed to restore agent after a failed start", "name", name, "error", restoreErr)
+	}
+	return err
+}
+
+// stopAgent cancels a running agent's policy and removes its routes and admin
+// state, leaving the config to the caller. Caller must hold s.mu.
+func (s *Server) stopAgent(name string) {
+	if cancel, ok := s.cancels[name]; ok {
+		cancel()
+		delete(s.cancels, name)
+	}
+	if agent := s.cfg.Agents[name]; agent != nil {
+		s.prxy.Deregister(agent.Hostname)
+		for _, h := range agent.Hostnames {
+			s.prxy.Deregister(h)
+		}
+	} else if info, ok := s.agents[name]; ok {
+		s.prxy.Deregister(info.Hostname)
+	}
+	delete(s.agents, name)
+	delete(s.policies, name)
+}
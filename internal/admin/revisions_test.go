@@ -0,0 +1,133 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"warren/internal/config"
+	"warren/internal/policy"
+	"warren/internal/revisions"
+)
+
+func TestAgentRevisionsAndRollback(t *testing.T) {
+	srv, _ := testServer(t)
+	srv.SetRevisionLog(revisions.NewLog(0))
+	handler := srv.Handler()
+
+	add := func(backend string) {
+		body, _ := json.Marshal(AddAgentRequest{Name: "a", Hostname: "a.example.com", Backend: backend, Policy: "unmanaged"})
+		req := httptest.NewRequest("POST", "/admin/agents", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != 201 {
+			t.Fatalf("add: %d %s", w.Code, w.Body.String())
+		}
+	}
+	add("http://localhost:1111")
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("DELETE", "/admin/agents/a", nil))
+	add("http://localhost:2222")
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/admin/agents/a/revisions", nil))
+	var revs []revisions.Revision
+	json.Unmarshal(w.Body.Bytes(), &revs)
+	if len(revs) != 3 || revs[0].Action != "created" || revs[1].Action != "removed" || revs[2].Actor != "192.0.2.1" {
+		t.Fatalf("revisions = %s", w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"field":"backend","old":"http://localhost:1111"`) && !strings.Contains(w.Body.String(), `"new":"http://localhost:2222"`) {
+		t.Errorf("expected backend change in %s", w.Body.String())
+	}
+
+	// Roll back to the first definition.
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/admin/agents/a/rollback", strings.NewReader(`{"revision":1}`)))
+	if w.Code != 200 {
+		t.Fatalf("rollback: %d %s", w.Code, w.Body.String())
+	}
+	if got := srv.cfg.Agents["a"].Backend; got != "http://localhost:1111" {
+		t.Errorf("backend after rollback = %q", got)
+	}
+	if got := srv.prxy.Backends()["a.example.com"].Target.String(); got != "http://localhost:1111" {
+		t.Errorf("routed target after rollback = %q", got)
+	}
+	latest := srv.revisions.List(revisions.KindAgent, "a")[0]
+	if latest.Action != revisions.ActionRolledBack || latest.Note != "to revision 1" {
+		t.Errorf("latest revision = %+v", latest)
+	}
+
+	// A removal has nothing to roll back to.
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/admin/agents/a/rollback", strings.NewReader(`{"revision":2}`)))
+	if w.Code != 400 {
+		t.Errorf("rollback to removal = %d, want 400", w.Code)
+	}
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/admin/agents/a/rollback", strings.NewReader(`{"revision":99}`)))
+	if w.Code != 404 {
+		t.Errorf("rollback to unknown revision = %d, want 404", w.Code)
+	}
+}
+
+func TestRollbackRestoresOnFailedStart(t *testing.T) {
+	srv, _ := testServer(t)
+	srv.SetRevisionLog(revisions.NewLog(0))
+	handler := srv.Handler()
+
+	for _, backend := range []string{"http://localhost:18799", "http://localhost:18790"} {
+		body, _ := json.Marshal(AddAgentRequest{Name: "kai", Hostname: "kai.example.com", Backend: backend, Policy: "unmanaged"})
+		method, path := "POST", "/admin/agents"
+		if backend == "http://localhost:18790" {
+			method, path = "PUT", "/admin/agents/kai"
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, path, bytes.NewReader(body)))
+		if w.Code >= 300 {
+			t.Fatalf("%s: %d %s", method, w.Code, w.Body.String())
+		}
+	}
+	srv.SetAgentStarter(func(name string, agent *config.Agent) (policy.Policy, context.CancelFunc, error) {
+		if agent.Backend == "http://localhost:18799" {
+			return nil, nil, errors.New("no such backend")
+		}
+		target, _ := url.Parse(agent.Backend)
+		pol := policy.NewUnmanaged()
+		srv.prxy.Register(agent.Hostname, name, target, pol)
+		return pol, func() {}, nil
+	})
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/admin/agents/kai/rollback", strings.NewReader(`{"revision":1}`)))
+	if w.Code != 500 {
+		t.Fatalf("rollback: %d, want 500", w.Code)
+	}
+	if b, ok := srv.prxy.Backend("kai.example.com"); !ok || b.Target.String() != "http://localhost:18790" {
+		t.Errorf("hostname routed to %v, want the current agent back", b)
+	}
+	if _, ok := srv.agents["kai"]; !ok || srv.cfg.Agents["kai"].Backend != "http://localhost:18790" {
+		t.Errorf("agent state after failed rollback = %+v", srv.cfg.Agents["kai"])
+	}
+}
+
+func TestRevisionActorFromToken(t *testing.T) {
+	srv := testServerWithToken(t, "admin-secret")
+	srv.SetRevisionLog(revisions.NewLog(0))
+
+	body, _ := json.Marshal(AddAgentRequest{Name: "a", Hostname: "a.example.com", Backend: "http://localhost:1111", Policy: "unmanaged"})
+	req := httptest.NewRequest("POST", "/admin/agents", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	req.Header.Set("X-Warren-Actor", "mallory")
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+	if w.Code != 201 {
+		t.Fatalf("add: %d %s", w.Code, w.Body.String())
+	}
+	if got := srv.revisions.List(revisions.KindAgent, "a")[0].Actor; got != revisions.TokenActor("admin-secret", req) {
+		t.Errorf("actor = %q, want the admin token's fingerprint", got)
+	}
+}
@@ -0,0 +1,55 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"warren/internal/validate"
+)
+
+// handleRoute answers GET /admin/route?host=...&path=... with how the proxy
+// would route that request: the agent, service or redirect, the target, the
+// middlewares that apply and whether it would wake the agent. Nothing is
+// sent. method (default GET) and repeated header=Name:value parameters
+// describe the request further, e.g. header=Upgrade:websocket.
+func (s *Server) handleRoute(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	var errs validate.Errors
+	errs.Required("host", q.Get("host"))
+	path := q.Get("path")
+	if path == "" {
+		path = "/"
+	} else if !strings.HasPrefix(path, "/") {
+		errs.Add("path", "must start with /")
+	}
+	method := strings.ToUpper(q.Get("method"))
+	if method == "" {
+		method = http.MethodGet
+	}
+	req, err := http.NewRequest(method, "http://"+q.Get("host")+path, nil)
+	if err != nil && len(errs) == 0 {
+		errs.Add("host", "%v", err)
+	}
+	for _, h := range q["header"] {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			errs.Add("header", "must be Name:value, got %q", h)
+			continue
+		}
+		if req != nil {
+			req.Header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+		}
+	}
+	if validate.Write(w, errs) {
+		return
+	}
+	req.RemoteAddr = r.RemoteAddr
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(s.prxy.Explain(req))
+}
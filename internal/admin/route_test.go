@@ -0,0 +1,44 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"warren/internal/policy"
+	"warren/internal/proxy"
+)
+
+func TestRouteExplainsRequest(t *testing.T) {
+	srv, _ := testServer(t)
+	target, _ := url.Parse("http://10.0.0.1:3000")
+	srv.prxy.Register("a.example.com", "a", target, policy.NewUnmanaged())
+
+	req := httptest.NewRequest("GET", "/admin/route?host=a.example.com&path=/socket&header=Upgrade:websocket&header=Connection:Upgrade", nil)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var route proxy.Route
+	if err := json.Unmarshal(w.Body.Bytes(), &route); err != nil {
+		t.Fatal(err)
+	}
+	if route.Kind != "agent" || route.Agent != "a" || route.Path != "/socket" || route.Handler != "websocket" {
+		t.Errorf("route = %+v, want a websocket to agent a", route)
+	}
+
+	w = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/admin/route?path=x&header=bad", nil))
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want 422", w.Code)
+	}
+	for _, field := range []string{`"host"`, `"path"`, `"header"`} {
+		if !strings.Contains(w.Body.String(), field) {
+			t.Errorf("expected a %s field error in %s", field, w.Body.String())
+		}
+	}
+}
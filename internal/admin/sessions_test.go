@@ -0,0 +1,50 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"warren/internal/openclaw"
+)
+
+type nopToucher struct{}
+
+func (nopToucher) Touch(string) {}
+
+func TestSessionsEndpoint(t *testing.T) {
+	srv, _ := testServer(t)
+	srv.agents["a"] = AgentInfo{Name: "a", Hostname: "a.example.com", Policy: "on-demand"}
+	handler := srv.Handler()
+
+	// No monitor configured.
+	req := httptest.NewRequest("GET", "/admin/agents/a/sessions", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != 404 {
+		t.Fatalf("expected 404 without monitor, got %d", w.Code)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	monitor := openclaw.NewSessionMonitor(nopToucher{}, slog.Default())
+	monitor.Register(ctx, openclaw.Target{Agent: "a", URL: "http://127.0.0.1:1/api/sessions", PollInterval: time.Hour})
+	srv.SetSessionMonitor(monitor)
+
+	req = httptest.NewRequest("GET", "/admin/agents/a/sessions", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var snap openclaw.Snapshot
+	if err := json.Unmarshal(w.Body.Bytes(), &snap); err != nil {
+		t.Fatal(err)
+	}
+	if snap.Agent != "a" || !snap.PolledAt.IsZero() {
+		t.Errorf("unexpected snapshot: %+v", snap)
+	}
+}
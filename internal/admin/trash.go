@@ -0,0 +1,288 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"warren/internal/config"
+	"warren/internal/events"
+	"warren/internal/human"
+	"warren/internal/policy"
+	"warren/internal/revisions"
+	"warren/internal/services"
+)
+
+// AgentStarter builds, registers and starts an agent from its full config
+// definition, returning its running policy. The orchestrator supplies one so
+// restored agents come back with every setting, not just the basics the
+// admin add endpoint understands.
+type AgentStarter func(name string, agent *config.Agent) (policy.Policy, context.CancelFunc, error)
+
+// SetAgentStarter sets how restored agents are started.
+func (s *Server) SetAgentStarter(f AgentStarter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.starter = f
+}
+
+// trashedAgentResp describes a restorable agent in GET /admin/trash.
+type trashedAgentResp struct {
+	Name      string    `json:"name"`
+	Hostname  string    `json:"hostname"`
+	Policy    string    `json:"policy"`
+	RemovedAt time.Time `json:"removed_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// SetTrashFile keeps the agent trash in file, apart from the config, so it
+// survives restarts, and loads the agents already in it. Their hostnames
+// stay reserved, so no service can claim one before the agent is restored.
+func (s *Server) SetTrashFile(file string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.trashFile = file
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var trash map[string]*config.TrashedAgent
+	if err := yaml.Unmarshal(data, &trash); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	for name, t := range trash {
+		if t == nil || t.Agent == nil {
+			continue
+		}
+		s.trash[name] = t
+		s.registry.ReserveHostname(t.Agent.Hostname)
+	}
+	return nil
+}
+
+// saveTrash writes the trash to its file, replacing it atomically, and logs
+// rather than fails on error. Caller must hold s.mu.
+func (s *Server) saveTrash() {
+	if s.trashFile == "" {
+		return
+	}
+	data, err := yaml.Marshal(s.trash)
+	if err != nil {
+		s.logger.Error("failed to encode trash", "error", err)
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.trashFile), ".warren-trash-*")
+	if err != nil {
+		s.logger.Error("failed to save trash", "file", s.trashFile, "error", err)
+		return
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.trashFile)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		s.logger.Error("failed to save trash", "file", s.trashFile, "error", err)
+	}
+}
+
+// trashAgent keeps a removed agent's definition in the trash so it can be
+// restored, returning when it expires (nil if the trash is disabled).
+// Caller must hold s.mu.
+func (s *Server) trashAgent(name string, info AgentInfo) *time.Time {
+	if s.cfg.TrashRetention <= 0 {
+		return nil
+	}
+	agent := s.cfg.Agents[name]
+	if agent == nil {
+		agent = &config.Agent{
+			Hostname:  info.Hostname,
+			Backend:   info.Backend,
+			Policy:    info.Policy,
+			Container: config.Container{Name: info.ContainerName},
+			Health:    config.Health{URL: info.HealthURL},
+		}
+		if d, err := human.ParseDuration(info.IdleTimeout); err == nil {
+			agent.Idle.Timeout = human.Duration(d)
+		}
+	}
+	now := time.Now()
+	expires := now.Add(time.Duration(s.cfg.TrashRetention))
+	s.trash[name] = &config.TrashedAgent{Agent: agent, RemovedAt: now, ExpiresAt: expires}
+	s.saveTrash()
+	return &expires
+}
+
+// purgeTrash drops expired agents from the trash and reports whether any
+// were dropped. Caller must hold s.mu.
+func (s *Server) purgeTrash() bool {
+	now := time.Now()
+	purged := false
+	for name, t := range s.trash {
+		if now.After(t.ExpiresAt) {
+			delete(s.trash, name)
+			purged = true
+		}
+	}
+	return purged
+}
+
+// handleTrash lists removed agents and services that can still be restored.
+func (s *Server) handleTrash(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mu.Lock()
+	if s.purgeTrash() {
+		s.saveTrash()
+	}
+	agents := make([]trashedAgentResp, 0, len(s.trash))
+	for name, t := range s.trash {
+		agents = append(agents, trashedAgentResp{
+			Name:      name,
+			Hostname:  t.Agent.Hostname,
+			Policy:    t.Agent.Policy,
+			RemovedAt: t.RemovedAt,
+			ExpiresAt: t.ExpiresAt,
+		})
+	}
+	s.mu.Unlock()
+	sort.Slice(agents, func(i, j int) bool { return agents[i].RemovedAt.After(agents[j].RemovedAt) })
+
+	svcs := s.registry.Trash()
+	if svcs == nil {
+		svcs = []services.Trashed{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"agents":   agents,
+		"services": svcs,
+	})
+}
+
+// restoreAgent brings a trashed agent back with its original definition.
+func (s *Server) restoreAgent(w http.ResponseWriter, name, actor string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	purged := s.purgeTrash()
+	t, ok := s.trash[name]
+	if !ok {
+		if purged {
+			s.saveTrash()
+		}
+		http.Error(w, `{"error":"agent not in trash"}`, http.StatusNotFound)
+		return
+	}
+	if _, exists := s.agents[name]; exists {
+		http.Error(w, `{"error":"agent already exists"}`, http.StatusConflict)
+		return
+	}
+	agent := t.Agent
+	if _, taken := s.prxy.Backend(agent.Hostname); taken {
+		http.Error(w, `{"error":"hostname is in use by another agent"}`, http.StatusConflict)
+		return
+	}
+	if _, taken := s.registry.Lookup(agent.Hostname); taken {
+		http.Error(w, `{"error":"hostname is in use by a service"}`, http.StatusConflict)
+		return
+	}
+
+	if err := s.startAgent(name, agent); err != nil {
+		s.logger.Error("failed to restore agent", "name", name, "error", err)
+		http.Error(w, `{"error":"failed to start restored agent"}`, http.StatusInternalServerError)
+		return
+	}
+	delete(s.trash, name)
+	s.saveTrash()
+	s.saveConfig("restoring agent")
+
+	s.recordAgent(name, revisions.ActionRestored, actor, agent)
+	s.events.Emit(events.Event{Type: events.AgentAdded, Agent: name, Fields: map[string]string{"restored": "true"}})
+	s.logger.Info("agent restored via API", "name", name, "hostname", agent.Hostname)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok", "name": name})
+}
+
+// startAgent builds, routes and starts an agent from its full definition and
+// adds it to the admin state and config. Caller must hold s.mu and persist
+// the config.
+func (s *Server) startAgent(name string, agent *config.Agent) error {
+	var pol policy.Policy
+	var cancel context.CancelFunc
+	if s.starter != nil {
+		var err error
+		if pol, cancel, err = s.starter(name, agent); err != nil {
+			return err
+		}
+	} else {
+		target, err := url.Parse(agent.Backend)
+		if err != nil {
+			return err
+		}
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		pol = s.newPolicy(name, agent.Policy, agent.Container.Name, agent.Health.URL, agent.Hostname, time.Duration(agent.Idle.Timeout))
+		s.prxy.Register(agent.Hostname, name, target, pol)
+		go pol.Start(ctx)
+	}
+
+	s.agents[name] = agentInfo(name, agent)
+	s.policies[name] = pol
+	s.cancels[name] = cancel
+	if s.cfg.Agents == nil {
+		s.cfg.Agents = make(map[string]*config.Agent)
+	}
+	s.cfg.Agents[name] = agent
+	return nil
+}
+
+// agentInfo describes a configured agent for the admin API.
+func agentInfo(name string, agent *config.Agent) AgentInfo {
+	info := AgentInfo{
+		Name:          name,
+		Hostname:      agent.Hostname,
+		Policy:        agent.Policy,
+		Backend:       agent.Backend,
+		ContainerName: agent.Container.Name,
+		HealthURL:     agent.Health.URL,
+	}
+	if agent.Idle.Timeout > 0 {
+		info.IdleTimeout = agent.Idle.Timeout.String()
+	}
+	return info
+}
+
+// maxBody is the largest request body the admin API accepts.
+func (s *Server) maxBody() int64 {
+	if s.cfg.MaxRequestBody > 0 {
+		return int64(s.cfg.MaxRequestBody)
+	}
+	return 1 << 20
+}
+
+// saveConfig persists the config, logging rather than failing on error.
+// Caller must hold s.mu.
+func (s *Server) saveConfig(reason string) {
+	if err := config.Save(s.cfg, s.cfgPath); err != nil {
+		s.logger.Error("failed to persist config", "reason", reason, "error", err)
+	}
+}
@@ -0,0 +1,125 @@
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"warren/internal/config"
+	"warren/internal/human"
+)
+
+func TestRemoveAndRestoreAgent(t *testing.T) {
+	srv, path := testServer(t)
+	srv.cfg.TrashRetention = human.Duration(time.Hour)
+	trashFile := filepath.Join(t.TempDir(), "warren-trash.yaml")
+	if err := srv.SetTrashFile(trashFile); err != nil {
+		t.Fatal(err)
+	}
+	handler := srv.Handler()
+
+	body, _ := json.Marshal(AddAgentRequest{
+		Name:     "oops",
+		Hostname: "oops.example.com",
+		Backend:  "http://localhost:18790",
+		Policy:   "unmanaged",
+	})
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/admin/agents", bytes.NewReader(body)))
+	if w.Code != 201 {
+		t.Fatalf("add: %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("DELETE", "/admin/agents/oops", nil))
+	if w.Code != 200 {
+		t.Fatalf("remove: %d %s", w.Code, w.Body.String())
+	}
+	var removed map[string]any
+	json.Unmarshal(w.Body.Bytes(), &removed)
+	if removed["restorable_until"] == nil {
+		t.Errorf("remove response = %v, want restorable_until", removed)
+	}
+
+	// The trash survives a restart in a file of its own, not in the config.
+	if data, _ := os.ReadFile(path); bytes.Contains(data, []byte("oops")) {
+		t.Errorf("removed agent left in the config:\n%s", data)
+	}
+	data, _ := os.ReadFile(trashFile)
+	var saved map[string]*config.TrashedAgent
+	if err := yaml.Unmarshal(data, &saved); err != nil {
+		t.Fatalf("parse saved trash: %v", err)
+	}
+	if saved["oops"] == nil || saved["oops"].Agent.Hostname != "oops.example.com" {
+		t.Errorf("saved trash = %s", data)
+	}
+	restarted, _ := testServer(t)
+	if err := restarted.SetTrashFile(trashFile); err != nil {
+		t.Fatal(err)
+	}
+	if restarted.trash["oops"] == nil {
+		t.Error("trash not loaded from its file")
+	}
+	// Its hostname stays reserved until it's restored.
+	if err := restarted.registry.Register("oops.example.com", "http://10.0.0.1:80", "other"); err == nil {
+		t.Error("a service claimed a trashed agent's hostname")
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/admin/trash", nil))
+	var trash struct {
+		Agents []trashedAgentResp `json:"agents"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &trash)
+	if len(trash.Agents) != 1 || trash.Agents[0].Name != "oops" {
+		t.Fatalf("trash = %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/admin/agents/oops/restore", nil))
+	if w.Code != 200 {
+		t.Fatalf("restore: %d %s", w.Code, w.Body.String())
+	}
+	if _, ok := srv.prxy.Backends()["oops.example.com"]; !ok {
+		t.Error("restored agent not routed")
+	}
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/admin/agents/oops", nil))
+	if w.Code != 200 {
+		t.Errorf("inspect restored agent: %d", w.Code)
+	}
+	if srv.cfg.Agents["oops"] == nil || len(srv.trash) != 0 {
+		t.Errorf("config agents/trash after restore = %v/%v", srv.cfg.Agents, srv.trash)
+	}
+	if data, _ := os.ReadFile(trashFile); bytes.Contains(data, []byte("oops")) {
+		t.Errorf("restored agent left in the trash file:\n%s", data)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/admin/agents/oops/restore", nil))
+	if w.Code != 404 {
+		t.Errorf("second restore = %d, want 404", w.Code)
+	}
+}
+
+func TestRemoveAgentTrashDisabled(t *testing.T) {
+	srv, _ := testServer(t)
+	srv.cfg.TrashRetention = -1
+	handler := srv.Handler()
+
+	body, _ := json.Marshal(AddAgentRequest{Name: "gone", Hostname: "gone.example.com", Backend: "http://localhost:18790", Policy: "unmanaged"})
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/admin/agents", bytes.NewReader(body)))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("DELETE", "/admin/agents/gone", nil))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/admin/agents/gone/restore", nil))
+	if w.Code != 404 {
+		t.Errorf("restore with trash disabled = %d, want 404", w.Code)
+	}
+}
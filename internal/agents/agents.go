@@ -0,0 +1,346 @@
+// Package agents turns configured agents into running policies and proxy
+// routes. The orchestrator builds every agent through it, at startup, on a
+// config reload and when the admin API restores one, and so does the test
+// harness, so end-to-end tests exercise the same wiring as production.
+package agents
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"slices"
+	"time"
+
+	"warren/internal/auth"
+	"warren/internal/balance"
+	"warren/internal/breaker"
+	"warren/internal/clock"
+	"warren/internal/config"
+	"warren/internal/container"
+	"warren/internal/events"
+	"warren/internal/headers"
+	"warren/internal/metrics"
+	"warren/internal/policy"
+	"warren/internal/proxy"
+	"warren/internal/transport"
+)
+
+// Builder holds what agents are built against. Wheel, Recycles, Budgets
+// and Clock may be nil; the rest are required.
+type Builder struct {
+	Runtime  container.Lifecycle
+	Proxy    *proxy.Proxy
+	Emitter  *events.Emitter
+	Wheel    *policy.TimerWheel // shared policy timers; nil gives each its own
+	Recycles *policy.RecycleGate
+	Deps     *policy.Dependencies
+	Budgets  *policy.BudgetStore // wake budget counts; nil keeps them in memory
+	Clock    clock.Clock         // policy time source; nil uses the system clock
+	Logger   *slog.Logger
+
+	// Discovered maps container names to the state they were found in at
+	// startup, so on-demand policies start out matching them.
+	Discovered map[string]string
+}
+
+// Policy creates the agent's lifecycle policy without starting it. The
+// cancel func stops the agent's background watchers when it is removed.
+func (b *Builder) Policy(name string, agent *config.Agent) (policy.Policy, context.CancelFunc) {
+	policyCtx, policyCancel := context.WithCancel(context.Background())
+	p := b.Proxy
+
+	var pol policy.Policy
+	switch agent.Policy {
+	case "always-on":
+		pol = policy.NewAlwaysOn(policy.AlwaysOnConfig{
+			Agent:         name,
+			HealthURL:     agent.Health.URL,
+			CheckInterval: time.Duration(agent.Health.CheckInterval),
+			MaxFailures:   agent.Health.MaxFailures,
+			Wheel:         b.Wheel,
+			Clock:         b.Clock,
+		}, b.Emitter, b.Logger)
+		if agent.Health.RestartOnDegraded {
+			pol.(*policy.AlwaysOn).EnableRestartOnDegraded(b.Runtime, agent.Container.Name, agent.Health.MaxRestartAttempts, time.Duration(agent.Health.RestartCooldown))
+		}
+		pol.(*policy.AlwaysOn).EnableMaxLifetime(b.Runtime, p.WSCounter(), LifetimeConfig(agent, b.Recycles))
+	case "on-demand":
+		pol = policy.NewOnDemand(b.Runtime, policy.OnDemandConfig{
+			Agent:              name,
+			ContainerName:      agent.Container.Name,
+			HealthURL:          agent.Health.URL,
+			Hostname:           agent.Hostname,
+			CheckInterval:      time.Duration(agent.Health.CheckInterval),
+			StartupTimeout:     time.Duration(agent.Health.StartupTimeout),
+			IdleTimeout:        time.Duration(agent.Idle.Timeout),
+			WakeCooldown:       time.Duration(agent.Idle.WakeCooldown),
+			MaxUptime:          time.Duration(agent.Idle.MaxUptime),
+			DrainTimeout:       time.Duration(agent.Idle.DrainTimeout),
+			MaxFailures:        agent.Health.MaxFailures,
+			MaxRestartAttempts: agent.Health.MaxRestartAttempts,
+			CrashWindow:        time.Duration(agent.Health.CrashWindow),
+			CrashLoopThreshold: agent.Health.CrashLoop(),
+			RestartBackoff:     time.Duration(agent.Health.RestartBackoff),
+			MaxRestartBackoff:  time.Duration(agent.Health.MaxRestartBackoff),
+			StartupProbe:       time.Duration(agent.Health.StartupProbe),
+			StartupProbeMax:    time.Duration(agent.Health.StartupProbeMax),
+			TCPPrecheck:        agent.Health.TCPPrecheck,
+			PredictiveWake:     agent.Idle.PredictiveWake,
+			PredictiveLead:     time.Duration(agent.Idle.PredictiveLead),
+			ActivityMode:       agent.Idle.Activity.Mode,
+			ActivitySources:    agent.Idle.Activity.Sources,
+			IdleMode:           agent.Idle.Mode,
+			Wheel:              b.Wheel,
+			Clock:              b.Clock,
+		}, p.Activity(), p.WSCounter(), b.Emitter, b.Logger)
+		od := pol.(*policy.OnDemand)
+		od.SetWakeBudget(WakeBudget(agent))
+		od.SetBudgetStore(b.Budgets)
+		od.SetDependencies(b.Deps)
+		od.AddSleepGuard(p.Jobs().SleepGuard(name))
+		od.SetSleepVeto(SleepVeto(name, agent, b.Logger))
+		if sampler, ok := b.Runtime.(container.CPUSampler); ok && agent.Idle.CPUThreshold > 0 {
+			// CPU counts as request activity unless it is listed as its own
+			// activity source, e.g. to require it in "all" mode.
+			var cpuActivity container.Toucher = p.Activity()
+			if slices.Contains(agent.Idle.Activity.Sources, "cpu") {
+				cpuLog := b.activityLog()
+				od.AddActivitySignal("cpu", cpuLog)
+				cpuActivity = cpuLog
+			}
+			// Stopped with the policy when the agent is removed.
+			go container.WatchCPU(policyCtx, sampler, cpuActivity, container.CPUWatch{
+				Agent:     name,
+				Hostname:  agent.Hostname,
+				Service:   agent.Container.Name,
+				Threshold: agent.Idle.CPUThreshold,
+				Interval:  time.Duration(agent.Idle.CPUSampleInterval),
+				State:     od.State,
+			}, b.Logger)
+		}
+		if prom := agent.Idle.Prometheus; prom != nil {
+			var promActivity metrics.Toucher = p.Activity()
+			if slices.Contains(agent.Idle.Activity.Sources, "prometheus") {
+				promLog := b.activityLog()
+				od.AddActivitySignal("prometheus", promLog)
+				promActivity = promLog
+			}
+			go metrics.WatchQuery(policyCtx, promActivity, metrics.QueryWatch{
+				Agent:    name,
+				Hostname: agent.Hostname,
+				URL:      prom.URL,
+				Query:    prom.Query,
+				Interval: time.Duration(prom.Interval),
+				State:    od.State,
+			}, b.Logger)
+		}
+
+		// Startup reconciliation: inform policy if container is already running.
+		if state, ok := b.Discovered[agent.Container.Name]; ok {
+			if state == "paused" {
+				od.SetInitialPaused()
+			} else {
+				od.SetInitialState(state == "running")
+			}
+		}
+	case "unmanaged":
+		pol = policy.NewUnmanaged()
+	}
+	b.Deps.Set(name, pol, agent.DependsOn)
+	return pol, policyCancel
+}
+
+func (b *Builder) activityLog() *policy.ActivityLog {
+	l := policy.NewActivityLog()
+	l.SetClock(b.Clock)
+	return l
+}
+
+// Route sends the agent's hostnames, and its TLS passthrough if it has
+// one, to target.
+func (b *Builder) Route(name string, agent *config.Agent, target *url.URL, pol policy.Policy, opts proxy.RouteOptions) {
+	b.Proxy.RegisterWithOptions(agent.Hostname, name, target, pol, opts)
+	for _, h := range agent.Hostnames {
+		b.Proxy.RegisterWithOptions(h, name, target, pol, opts)
+	}
+	b.Proxy.SNI().Register(SNITarget(name, agent, target, pol))
+}
+
+// OpenPorts opens the agent's raw TCP and UDP ports, closing any it no
+// longer lists.
+func (b *Builder) OpenPorts(ctx context.Context, name string, agent *config.Agent, target *url.URL, pol policy.Policy) error {
+	return b.Proxy.Ports().Register(ctx, PortTarget(name, agent, target, pol))
+}
+
+// RouteOptions builds the per-hostname proxy settings for an agent.
+func (b *Builder) RouteOptions(name string, agent *config.Agent) (proxy.RouteOptions, error) {
+	opts := proxy.RouteOptions{AgentToken: agent.AgentToken}
+	if cb := agent.CircuitBreaker; cb != nil {
+		br, err := breaker.New(breaker.Config{
+			Threshold:   cb.Threshold,
+			MinRequests: cb.MinRequests,
+			Window:      time.Duration(cb.Window),
+			OpenFor:     time.Duration(cb.OpenFor),
+		})
+		if err != nil {
+			return opts, err
+		}
+		br.OnChange(func(from, to string) {
+			switch {
+			case from == breaker.Closed && to == breaker.Open:
+				b.Emitter.Emit(events.Event{Type: events.CircuitOpen, Agent: name})
+			case to == breaker.Closed:
+				b.Emitter.Emit(events.Event{Type: events.CircuitClosed, Agent: name})
+			default:
+				b.Logger.Debug("circuit breaker state change", "agent", name, "from", from, "to", to)
+			}
+		})
+		opts.Breaker = br
+	}
+	if rt := agent.Retry; rt != nil {
+		opts.Retry = &proxy.Retry{Attempts: rt.Attempts, Delay: time.Duration(rt.Delay)}
+	}
+	opts.MaxBody = int64(agent.MaxBody)
+	opts.MaxWebSockets = agent.MaxWebSockets
+	opts.AllowedPaths = agent.AllowedPaths
+	opts.WakeHold = time.Duration(agent.WakeHold)
+	opts.WebSocketIdle = time.Duration(agent.Idle.WebSocketTimeout)
+	opts.Protocol = agent.BackendProtocol
+	if agent.GRPC && opts.Protocol == "" {
+		opts.Protocol = transport.GRPCProtocol(agent.Backend)
+	}
+	opts.GRPC = agent.GRPC
+	opts.Compress = agent.Compress
+	if to := agent.Timeouts; to != nil {
+		opts.Timeouts = &transport.Timeouts{Dial: time.Duration(to.Dial), ResponseHeader: time.Duration(to.ResponseHeader), Idle: time.Duration(to.Idle)}
+	}
+	if c := agent.Cache; c != nil {
+		opts.Cache = c.New()
+	}
+	if c := agent.CORS; c != nil {
+		policy, err := c.Policy()
+		if err != nil {
+			return opts, err
+		}
+		opts.CORS = policy
+	}
+	if h := agent.Headers; h != nil {
+		rw, err := headers.New(*h)
+		if err != nil {
+			return opts, err
+		}
+		opts.Headers = rw
+	}
+	if len(agent.Replicas) > 0 {
+		var targets []*url.URL
+		for _, raw := range append([]string{agent.Backend}, agent.Replicas...) {
+			u, err := url.Parse(raw)
+			if err != nil {
+				return opts, err
+			}
+			targets = append(targets, u)
+		}
+		pool, err := balance.New(targets, agent.Balance, b.Logger)
+		if err != nil {
+			return opts, err
+		}
+		if st := agent.Sticky; st != nil {
+			pool.SetSticky(balance.Sticky{Cookie: st.Cookie, TTL: time.Duration(st.TTL)})
+		}
+		opts.Pool = pool
+	}
+	if agent.BasicAuth != nil {
+		entries, err := agent.BasicAuth.Entries()
+		if err != nil {
+			return opts, err
+		}
+		basic, err := auth.NewBasic(agent.BasicAuth.Realm, entries)
+		if err != nil {
+			return opts, err
+		}
+		opts.BasicAuth = basic
+	}
+	if fa := agent.ForwardAuth; fa != nil {
+		forward, err := auth.NewForward(fa.Address, fa.AuthRequestHeaders, fa.AuthResponseHeaders, time.Duration(fa.Timeout))
+		if err != nil {
+			return opts, err
+		}
+		opts.ForwardAuth = forward
+	}
+	if agent.SplashTemplate != "" {
+		splash, err := proxy.NewSplash(agent.SplashTemplate)
+		if err != nil {
+			return opts, err
+		}
+		opts.Splash = splash
+	}
+	pages, err := proxy.NewErrorPages(agent.ErrorPages)
+	if err != nil {
+		return opts, err
+	}
+	opts.ErrorPages = pages
+	return opts, nil
+}
+
+// LifetimeConfig returns the forced recycling settings of an always-on
+// agent.
+func LifetimeConfig(agent *config.Agent, gate *policy.RecycleGate) policy.LifetimeConfig {
+	return policy.LifetimeConfig{
+		ContainerName: agent.Container.Name,
+		Hostname:      agent.Hostname,
+		MaxLifetime:   time.Duration(agent.Container.MaxLifetime),
+		DrainTimeout:  time.Duration(agent.Idle.DrainTimeout),
+		Gate:          gate,
+	}
+}
+
+// WakeBudget returns the agent's wake budget, or 0 when it has none.
+func WakeBudget(agent *config.Agent) (int, string) {
+	if agent.Wake == nil || agent.Wake.Budget == nil {
+		return 0, ""
+	}
+	return agent.Wake.Budget.MaxPerDay, agent.Wake.Budget.Action
+}
+
+// SleepVeto returns the agent's sleep veto hook, or nil when it has no
+// veto_url.
+func SleepVeto(name string, agent *config.Agent, logger *slog.Logger) policy.SleepGuard {
+	if agent.Sleep.VetoURL == "" {
+		return nil
+	}
+	return policy.SleepVeto(name, agent.Sleep.VetoURL, time.Duration(agent.Sleep.VetoDefer), logger)
+}
+
+// PortTarget describes the agent's raw ports for the port forwarder.
+func PortTarget(name string, agent *config.Agent, target *url.URL, pol policy.Policy) proxy.PortTarget {
+	t := proxy.PortTarget{
+		Agent:    name,
+		Hostname: agent.Hostname,
+		Host:     target.Hostname(),
+		Policy:   pol,
+	}
+	for _, port := range agent.Ports {
+		t.Ports = append(t.Ports, proxy.PortSpec{
+			Proto:       port.Proto,
+			Listen:      port.Listen,
+			Target:      port.Target,
+			WakeTimeout: time.Duration(port.WakeTimeout),
+		})
+	}
+	return t
+}
+
+// SNITarget describes the agent's TLS passthrough route for the SNI router.
+// Agents without tls_passthrough get an empty target, which removes any
+// route they had.
+func SNITarget(name string, agent *config.Agent, target *url.URL, pol policy.Policy) proxy.SNITarget {
+	t := proxy.SNITarget{Agent: name}
+	if tp := agent.TLSPassthrough; tp != nil {
+		t.Hostnames = append([]string{agent.Hostname}, agent.Hostnames...)
+		t.Host = target.Hostname()
+		t.Port = tp.Port
+		t.Policy = pol
+		t.WakeTimeout = time.Duration(tp.WakeTimeout)
+	}
+	return t
+}
@@ -0,0 +1,140 @@
+package alerts
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"warren/internal/events"
+)
+
+// DefaultHeartbeatInterval is how often the heartbeat URL is pinged unless
+// configured otherwise.
+const DefaultHeartbeatInterval = time.Minute
+
+// Heartbeat pings a dead-man's-switch URL (healthchecks.io, Cronitor, Uptime
+// Kuma push monitors) on an interval while every agent is healthy. When
+// Warren's host dies, or an agent stays degraded, the pings stop and the
+// monitoring service raises the alarm.
+type Heartbeat struct {
+	client  *http.Client
+	logger  *slog.Logger
+	changed chan struct{} // buffered(1), signals SetTarget to Run
+
+	mu        sync.Mutex
+	url       string // empty pauses the pings
+	interval  time.Duration
+	unhealthy map[string]bool // agents currently degraded or crash-looping
+}
+
+// NewHeartbeat creates a heartbeat for url. A zero interval uses the default.
+func NewHeartbeat(url string, interval time.Duration, logger *slog.Logger) *Heartbeat {
+	if interval <= 0 {
+		interval = DefaultHeartbeatInterval
+	}
+	return &Heartbeat{
+		url:       url,
+		interval:  interval,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		logger:    logger.With("component", "heartbeat"),
+		changed:   make(chan struct{}, 1),
+		unhealthy: make(map[string]bool),
+	}
+}
+
+// SetTarget changes the URL pinged and the interval, for config reload.
+// The next ping goes out straight away. An empty url stops the pings until
+// one is set again.
+func (h *Heartbeat) SetTarget(url string, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultHeartbeatInterval
+	}
+	h.mu.Lock()
+	if url == h.url && interval == h.interval {
+		h.mu.Unlock()
+		return
+	}
+	h.url, h.interval = url, interval
+	h.mu.Unlock()
+	select {
+	case h.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (h *Heartbeat) target() (string, time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.url, h.interval
+}
+
+// RegisterEventHandler tracks agent health from lifecycle events.
+func (h *Heartbeat) RegisterEventHandler(emitter *events.Emitter) {
+	emitter.OnEvent(func(ev events.Event) {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		switch ev.Type {
+		case events.AgentDegraded, events.AgentCrashLoop, events.RestartExhausted:
+			h.unhealthy[ev.Agent] = true
+		case events.AgentReady, events.AgentRecovered, events.AgentSleep, events.AgentRemoved:
+			delete(h.unhealthy, ev.Agent)
+		}
+	})
+}
+
+// Unhealthy lists the agents holding back the heartbeat, sorted by name.
+func (h *Heartbeat) Unhealthy() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	names := make([]string, 0, len(h.unhealthy))
+	for name := range h.unhealthy {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Run pings immediately and then every interval until ctx is cancelled,
+// skipping pings while any agent is unhealthy or no URL is set.
+func (h *Heartbeat) Run(ctx context.Context) {
+	url, interval := h.target()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if bad := h.Unhealthy(); len(bad) > 0 {
+			h.logger.Warn("heartbeat withheld: agents unhealthy", "agents", bad)
+		} else if url != "" {
+			h.ping(ctx, url)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-h.changed:
+			url, interval = h.target()
+			ticker.Reset(interval)
+		}
+	}
+}
+
+func (h *Heartbeat) ping(ctx context.Context, url string) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		h.logger.Error("heartbeat: failed to create request", "error", err)
+		return
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		if ctx.Err() == nil {
+			h.logger.Warn("heartbeat: request failed", "error", err)
+		}
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		h.logger.Warn("heartbeat: non-success status", "status", resp.StatusCode)
+	}
+}
@@ -0,0 +1,83 @@
+package alerts
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"warren/internal/events"
+)
+
+func TestHeartbeatPingsWhileHealthy(t *testing.T) {
+	var pings atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pings.Add(1)
+	}))
+	defer srv.Close()
+
+	emitter := events.NewEmitter(quietLogger())
+	hb := NewHeartbeat(srv.URL, 10*time.Millisecond, quietLogger())
+	hb.RegisterEventHandler(emitter)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hb.Run(ctx)
+
+	time.Sleep(35 * time.Millisecond)
+	if n := pings.Load(); n < 2 {
+		t.Fatalf("pings while healthy = %d, want at least 2", n)
+	}
+
+	// A degraded agent withholds the heartbeat until it recovers.
+	emitter.Emit(events.Event{Type: events.AgentDegraded, Agent: "a"})
+	if got := hb.Unhealthy(); len(got) != 1 || got[0] != "a" {
+		t.Errorf("Unhealthy() = %v, want [a]", got)
+	}
+	time.Sleep(15 * time.Millisecond) // let an in-flight ping land
+	before := pings.Load()
+	time.Sleep(35 * time.Millisecond)
+	if n := pings.Load(); n != before {
+		t.Errorf("pings while degraded went from %d to %d, want none", before, n)
+	}
+
+	emitter.Emit(events.Event{Type: events.AgentReady, Agent: "a"})
+	time.Sleep(35 * time.Millisecond)
+	if n := pings.Load(); n == before {
+		t.Error("pings did not resume after the agent recovered")
+	}
+}
+
+func TestHeartbeatSetTarget(t *testing.T) {
+	var first, second atomic.Int32
+	srvA := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { first.Add(1) }))
+	defer srvA.Close()
+	srvB := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { second.Add(1) }))
+	defer srvB.Close()
+
+	hb := NewHeartbeat("", time.Hour, quietLogger())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hb.Run(ctx)
+
+	// Without a URL nothing is pinged; setting one starts the pings
+	// straight away at the new interval.
+	hb.SetTarget(srvA.URL, 10*time.Millisecond)
+	time.Sleep(35 * time.Millisecond)
+	if n := first.Load(); n < 2 {
+		t.Fatalf("pings after SetTarget = %d, want at least 2", n)
+	}
+
+	hb.SetTarget(srvB.URL, 10*time.Millisecond)
+	time.Sleep(15 * time.Millisecond) // let an in-flight ping land
+	before := first.Load()
+	time.Sleep(35 * time.Millisecond)
+	if n := first.Load(); n != before {
+		t.Errorf("old URL pinged %d more times after the change", n-before)
+	}
+	if second.Load() == 0 {
+		t.Error("new URL was not pinged")
+	}
+}
@@ -6,12 +6,17 @@ import (
 	"encoding/json"
 	"log/slog"
 	"net/http"
+	"sync/atomic"
 	"time"
 
 	"warren/internal/config"
 	"warren/internal/events"
 )
 
+// SecurityEvents in a webhook's events list matches every security event
+// type, including ones added after the config was written.
+const SecurityEvents = "security"
+
 type webhookJob struct {
 	cfg config.WebhookConfig
 	ev  events.Event
@@ -23,6 +28,8 @@ type WebhookAlerter struct {
 	client  *http.Client
 	logger  *slog.Logger
 	jobs    chan webhookJob
+	workers int
+	dropped atomic.Uint64
 }
 
 // NewWebhookAlerter creates a new webhook alerter.
@@ -32,15 +39,23 @@ func NewWebhookAlerter(configs []config.WebhookConfig, logger *slog.Logger) *Web
 		client: &http.Client{
 			Timeout: 10 * time.Second,
 		},
-		logger: logger.With("component", "webhook-alerter"),
-		jobs:   make(chan webhookJob, 100),
+		logger:  logger.With("component", "webhook-alerter"),
+		jobs:    make(chan webhookJob, 100),
+		workers: 5,
+	}
+}
+
+// SetWorkers sets how many webhooks are delivered concurrently. Call it
+// before Start.
+func (w *WebhookAlerter) SetWorkers(n int) {
+	if n > 0 {
+		w.workers = n
 	}
 }
 
 // Start launches the worker pool. Call this before registering event handlers.
 func (w *WebhookAlerter) Start(ctx context.Context) {
-	const numWorkers = 5
-	for i := 0; i < numWorkers; i++ {
+	for i := 0; i < w.workers; i++ {
 		go func() {
 			for {
 				select {
@@ -54,6 +69,18 @@ func (w *WebhookAlerter) Start(ctx context.Context) {
 	}
 }
 
+// Pending returns how many deliveries are queued and the queue's capacity.
+// Events are dropped while it is full.
+func (w *WebhookAlerter) Pending() (n, capacity int) {
+	return len(w.jobs), cap(w.jobs)
+}
+
+// Dropped returns how many deliveries were dropped because the queue was
+// full.
+func (w *WebhookAlerter) Dropped() uint64 {
+	return w.dropped.Load()
+}
+
 // RegisterEventHandler registers the alerter as an event handler on the emitter.
 func (w *WebhookAlerter) RegisterEventHandler(emitter *events.Emitter) {
 	emitter.OnEvent(func(ev events.Event) {
@@ -62,6 +89,7 @@ func (w *WebhookAlerter) RegisterEventHandler(emitter *events.Emitter) {
 				select {
 				case w.jobs <- webhookJob{cfg: cfg, ev: ev}:
 				default:
+					w.dropped.Add(1)
 					w.logger.Warn("webhook job queue full, dropping event", "event", ev.Type, "url", cfg.URL)
 				}
 			}
@@ -74,7 +102,7 @@ func (w *WebhookAlerter) matches(cfg config.WebhookConfig, eventType string) boo
 		return true // no filter = all events
 	}
 	for _, e := range cfg.Events {
-		if e == eventType {
+		if e == eventType || (e == SecurityEvents && events.IsSecurity(eventType)) {
 			return true
 		}
 	}
@@ -62,6 +62,9 @@ func TestWebhookWorkerPool_DropsWhenFull(t *testing.T) {
 	if len(alerter.jobs) > 100 {
 		t.Errorf("job queue length %d exceeds capacity 100", len(alerter.jobs))
 	}
+	if n := alerter.Dropped(); n != 1 {
+		t.Errorf("Dropped() = %d, want 1", n)
+	}
 
 	_ = ctx
 }
@@ -71,6 +71,44 @@ func TestWebhookDoesNotFireOnNonMatchingEvent(t *testing.T) {
 	}
 }
 
+func TestWebhookSecurityGroup(t *testing.T) {
+	got := make(chan string, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev events.Event
+		json.NewDecoder(r.Body).Decode(&ev)
+		got <- ev.Type
+		w.WriteHeader(200)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	emitter := events.NewEmitter(quietLogger())
+	alerter := NewWebhookAlerter([]config.WebhookConfig{
+		{URL: srv.URL, Events: []string{SecurityEvents}},
+	}, quietLogger())
+	alerter.Start(ctx)
+	alerter.RegisterEventHandler(emitter)
+
+	emitter.Emit(events.Event{Type: events.AgentReady, Agent: "test"})
+	emitter.Emit(events.Event{Type: events.SecurityAuthFailed, Fields: map[string]string{"remote": "203.0.113.7"}})
+
+	select {
+	case typ := <-got:
+		if typ != events.SecurityAuthFailed {
+			t.Errorf("webhook got %q, want %q", typ, events.SecurityAuthFailed)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("security event not delivered")
+	}
+	select {
+	case typ := <-got:
+		t.Errorf("unexpected delivery of %q", typ)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
 func TestWebhookSendsCorrectJSON(t *testing.T) {
 	gotEvent := make(chan events.Event, 1)
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
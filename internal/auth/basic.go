@@ -0,0 +1,150 @@
+// Package auth provides per-route access gates applied by the proxy.
+package auth
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// maxCachedCredentials bounds the verified-credential cache. bcrypt is
+// deliberately slow, so re-verifying on every proxied request is avoided.
+const maxCachedCredentials = 1024
+
+// dummyHash is compared against for unknown users so that lookups for
+// missing and existing users take roughly the same time.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("warren"), bcrypt.MinCost)
+
+// Basic implements HTTP basic authentication against bcrypt password hashes.
+type Basic struct {
+	realm string
+	users map[string][]byte // username → bcrypt hash
+
+	mu       sync.Mutex
+	verified map[[sha256.Size]byte]string // sha256(user:pass) → username
+}
+
+// NewBasic builds a Basic authenticator from htpasswd-style "user:hash"
+// entries. Only bcrypt hashes ($2a$, $2b$, $2y$) are accepted.
+func NewBasic(realm string, entries []string) (*Basic, error) {
+	users, err := ParseHtpasswd(entries)
+	if err != nil {
+		return nil, err
+	}
+	if realm == "" {
+		realm = "warren"
+	}
+	return &Basic{
+		realm:    realm,
+		users:    users,
+		verified: make(map[[sha256.Size]byte]string),
+	}, nil
+}
+
+// ParseHtpasswd validates htpasswd-style entries and returns username → hash.
+// Blank lines and lines starting with # are ignored.
+func ParseHtpasswd(entries []string) (map[string][]byte, error) {
+	users := make(map[string][]byte)
+	for i, line := range entries {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok || user == "" || hash == "" {
+			return nil, fmt.Errorf("basic auth entry %d: expected user:hash", i)
+		}
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, fmt.Errorf("basic auth entry %d (%s): not a bcrypt hash", i, user)
+		}
+		if _, dup := users[user]; dup {
+			return nil, fmt.Errorf("basic auth entry %d: duplicate user %s", i, user)
+		}
+		users[user] = []byte(hash)
+	}
+	if len(users) == 0 {
+		return nil, fmt.Errorf("basic auth: no users defined")
+	}
+	return users, nil
+}
+
+// LoadHtpasswd reads htpasswd entries from a file, one per line.
+func LoadHtpasswd(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open htpasswd file: %w", err)
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read htpasswd file: %w", err)
+	}
+	return lines, nil
+}
+
+// Authenticate checks the request's basic auth credentials and returns the
+// authenticated username.
+func (b *Basic) Authenticate(r *http.Request) (string, bool) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		return "", false
+	}
+
+	key := sha256.Sum256([]byte(user + ":" + pass))
+	b.mu.Lock()
+	cached, hit := b.verified[key]
+	b.mu.Unlock()
+	if hit && subtle.ConstantTimeCompare([]byte(cached), []byte(user)) == 1 {
+		return user, true
+	}
+
+	hash, known := b.users[user]
+	if !known {
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(pass))
+		return "", false
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(pass)) != nil {
+		return "", false
+	}
+
+	b.mu.Lock()
+	if len(b.verified) >= maxCachedCredentials {
+		b.verified = make(map[[sha256.Size]byte]string)
+	}
+	b.verified[key] = user
+	b.mu.Unlock()
+	return user, true
+}
+
+// Realm returns the realm sent in challenges.
+func (b *Basic) Realm() string { return b.realm }
+
+// Entries returns the htpasswd-style "user:hash" entries b was built from,
+// sorted by username, so it can be rebuilt with NewBasic.
+func (b *Basic) Entries() []string {
+	entries := make([]string, 0, len(b.users))
+	for user, hash := range b.users {
+		entries = append(entries, user+":"+string(hash))
+	}
+	sort.Strings(entries)
+	return entries
+}
+
+// Challenge writes a 401 response asking the client for credentials.
+func (b *Basic) Challenge(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", b.realm))
+	http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+}
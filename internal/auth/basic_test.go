@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func htpasswdEntry(t *testing.T, user, pass string) string {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(pass), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user + ":" + string(hash)
+}
+
+func TestBasicAuthenticate(t *testing.T) {
+	b, err := NewBasic("bots", []string{htpasswdEntry(t, "alice", "s3cret")})
+	if err != nil {
+		t.Fatalf("NewBasic: %v", err)
+	}
+
+	cases := []struct {
+		name       string
+		user, pass string
+		set        bool
+		want       bool
+	}{
+		{"valid", "alice", "s3cret", true, true},
+		{"valid cached", "alice", "s3cret", true, true},
+		{"wrong password", "alice", "nope", true, false},
+		{"unknown user", "bob", "s3cret", true, false},
+		{"no credentials", "", "", false, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if tc.set {
+				req.SetBasicAuth(tc.user, tc.pass)
+			}
+			user, ok := b.Authenticate(req)
+			if ok != tc.want {
+				t.Fatalf("Authenticate = %v, want %v", ok, tc.want)
+			}
+			if ok && user != tc.user {
+				t.Errorf("user = %q, want %q", user, tc.user)
+			}
+		})
+	}
+}
+
+func TestBasicChallenge(t *testing.T) {
+	b, _ := NewBasic("", []string{htpasswdEntry(t, "alice", "pw")})
+	w := httptest.NewRecorder()
+	b.Challenge(w)
+	if w.Code != 401 {
+		t.Errorf("status = %d, want 401", w.Code)
+	}
+	if got := w.Header().Get("WWW-Authenticate"); got != `Basic realm="warren", charset="UTF-8"` {
+		t.Errorf("WWW-Authenticate = %q", got)
+	}
+}
+
+func TestParseHtpasswdRejects(t *testing.T) {
+	cases := map[string][]string{
+		"empty":         {},
+		"no colon":      {"alice"},
+		"plain hash":    {"alice:password"},
+		"md5 apr1":      {"alice:$apr1$abc$def"},
+		"only comments": {"# comment", ""},
+	}
+	for name, entries := range cases {
+		if _, err := ParseHtpasswd(entries); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+
+	dup := htpasswdEntry(t, "alice", "pw")
+	if _, err := ParseHtpasswd([]string{dup, dup}); err == nil {
+		t.Error("duplicate user: expected error")
+	}
+}
+
+func TestLoadHtpasswd(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	content := "# team\n" + htpasswdEntry(t, "alice", "pw") + "\n\n" + htpasswdEntry(t, "bob", "pw") + "\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	lines, err := LoadHtpasswd(path)
+	if err != nil {
+		t.Fatalf("LoadHtpasswd: %v", err)
+	}
+	users, err := ParseHtpasswd(lines)
+	if err != nil {
+		t.Fatalf("ParseHtpasswd: %v", err)
+	}
+	if len(users) != 2 {
+		t.Errorf("users = %d, want 2", len(users))
+	}
+}
@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"warren/internal/realip"
+)
+
+// maxForwardAuthBody bounds how much of a denying auth response is relayed
+// back to the client (login pages, error JSON).
+const maxForwardAuthBody = 1 << 20
+
+// hopHeaders are connection-specific and never copied between requests.
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+	"Content-Length",
+}
+
+// Forward delegates authentication to an external service, in the style of
+// Traefik's forwardAuth. Each request is mirrored as a GET to the auth
+// address; a 2xx reply lets the request through, anything else is relayed
+// to the client as-is (e.g. an OIDC login redirect from oauth2-proxy).
+type Forward struct {
+	address         string
+	requestHeaders  []string // empty means copy all request headers
+	responseHeaders []string // copied from the auth reply to the backend request
+	client          *http.Client
+}
+
+// NewForward builds a Forward authenticator. A zero timeout defaults to 5s.
+func NewForward(address string, requestHeaders, responseHeaders []string, timeout time.Duration) (*Forward, error) {
+	u, err := url.Parse(address)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("forward_auth: address must be an http(s) URL")
+	}
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	return &Forward{
+		address:         address,
+		requestHeaders:  canonical(requestHeaders),
+		responseHeaders: canonical(responseHeaders),
+		client: &http.Client{
+			Timeout: timeout,
+			// Redirects are the auth service's answer to the client, not to us.
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}, nil
+}
+
+// Check asks the auth service about r. On success it copies the configured
+// identity headers onto r and returns true. Otherwise it writes the auth
+// service's response (or a 502 if it is unreachable) to w and returns false.
+func (f *Forward) Check(w http.ResponseWriter, r *http.Request) bool {
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, f.address, nil)
+	if err != nil {
+		http.Error(w, "auth service unavailable", http.StatusBadGateway)
+		return false
+	}
+	f.copyRequestHeaders(req.Header, r)
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		http.Error(w, "auth service unavailable", http.StatusBadGateway)
+		return false
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		// Drop client-supplied copies so identity headers can't be spoofed.
+		for _, h := range f.responseHeaders {
+			r.Header.Del(h)
+			if v := resp.Header.Values(h); len(v) > 0 {
+				r.Header[h] = v
+			}
+		}
+		return true
+	}
+
+	for k, v := range resp.Header {
+		w.Header()[k] = v
+	}
+	for _, h := range hopHeaders {
+		w.Header().Del(h)
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, io.LimitReader(resp.Body, maxForwardAuthBody))
+	return false
+}
+
+func (f *Forward) copyRequestHeaders(dst http.Header, r *http.Request) {
+	if len(f.requestHeaders) == 0 {
+		for k, v := range r.Header {
+			dst[k] = v
+		}
+		for _, h := range hopHeaders {
+			dst.Del(h)
+		}
+	} else {
+		for _, h := range f.requestHeaders {
+			if v := r.Header.Values(h); len(v) > 0 {
+				dst[h] = v
+			}
+		}
+	}
+
+	proto := r.Header.Get("X-Forwarded-Proto")
+	if proto == "" {
+		proto = "http"
+		if r.TLS != nil {
+			proto = "https"
+		}
+	}
+	dst.Set("X-Forwarded-Method", r.Method)
+	dst.Set("X-Forwarded-Proto", proto)
+	dst.Set("X-Forwarded-Host", r.Host)
+	dst.Set("X-Forwarded-Uri", r.URL.RequestURI())
+	dst.Set("X-Forwarded-For", realip.From(r))
+}
+
+func canonical(headers []string) []string {
+	out := make([]string, 0, len(headers))
+	for _, h := range headers {
+		out = append(out, http.CanonicalHeaderKey(h))
+	}
+	return out
+}
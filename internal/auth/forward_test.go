@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewForwardRejectsBadAddress(t *testing.T) {
+	for _, addr := range []string{"", "ftp://auth", "auth:4180", "http://"} {
+		if _, err := NewForward(addr, nil, nil, 0); err == nil {
+			t.Errorf("NewForward(%q): expected error", addr)
+		}
+	}
+}
+
+func TestForwardAllow(t *testing.T) {
+	var got http.Header
+	authSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.Header().Set("X-Auth-User", "alice")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer authSrv.Close()
+
+	f, err := NewForward(authSrv.URL, nil, []string{"x-auth-user", "X-Auth-Email"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("POST", "/chat?x=1", nil)
+	r.Host = "a.example.com"
+	r.Header.Set("Cookie", "session=abc")
+	r.Header.Set("X-Auth-Email", "spoofed@example.com")
+	w := httptest.NewRecorder()
+	if !f.Check(w, r) {
+		t.Fatalf("expected request to be allowed, got %d", w.Code)
+	}
+
+	if got.Get("Cookie") != "session=abc" {
+		t.Errorf("cookie not forwarded: %q", got.Get("Cookie"))
+	}
+	if got.Get("X-Forwarded-Method") != "POST" || got.Get("X-Forwarded-Host") != "a.example.com" || got.Get("X-Forwarded-Uri") != "/chat?x=1" {
+		t.Errorf("unexpected forwarded headers: %v", got)
+	}
+	if r.Header.Get("X-Auth-User") != "alice" {
+		t.Errorf("identity header not copied: %q", r.Header.Get("X-Auth-User"))
+	}
+	if r.Header.Get("X-Auth-Email") != "" {
+		t.Error("client-supplied identity header should be stripped")
+	}
+}
+
+func TestForwardRequestHeadersAllowlist(t *testing.T) {
+	var got http.Header
+	authSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer authSrv.Close()
+
+	f, _ := NewForward(authSrv.URL, []string{"Cookie"}, nil, 0)
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Cookie", "session=abc")
+	r.Header.Set("X-Other", "secret")
+	f.Check(httptest.NewRecorder(), r)
+
+	if got.Get("Cookie") != "session=abc" || got.Get("X-Other") != "" {
+		t.Errorf("unexpected auth request headers: %v", got)
+	}
+}
+
+func TestForwardDenyRelaysResponse(t *testing.T) {
+	authSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://idp.example.com/login", http.StatusFound)
+	}))
+	defer authSrv.Close()
+
+	f, _ := NewForward(authSrv.URL, nil, nil, 0)
+	r := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	if f.Check(w, r) {
+		t.Fatal("expected request to be denied")
+	}
+	if w.Code != http.StatusFound {
+		t.Errorf("status = %d, want 302", w.Code)
+	}
+	if w.Header().Get("Location") != "https://idp.example.com/login" {
+		t.Errorf("Location = %q", w.Header().Get("Location"))
+	}
+}
+
+func TestForwardUnreachable(t *testing.T) {
+	f, _ := NewForward("http://127.0.0.1:1/auth", nil, nil, 0)
+	w := httptest.NewRecorder()
+	if f.Check(w, httptest.NewRequest("GET", "/", nil)) {
+		t.Fatal("expected request to be denied")
+	}
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("status = %d, want 502", w.Code)
+	}
+}
@@ -0,0 +1,423 @@
+// Package balance spreads a hostname's traffic across several backend
+// replicas, skipping replicas that recently failed.
+package balance
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Balancing strategies.
+const (
+	RoundRobin       = "round-robin"       // rotate through healthy backends (default)
+	LeastConnections = "least-connections" // pick the healthy backend with the fewest in-flight requests
+	Weighted         = "weighted"          // split traffic by per-backend weight, e.g. 90/10 for a canary
+)
+
+// Cooldown is how long a backend is skipped after a failed request.
+const Cooldown = 10 * time.Second
+
+// Sticky session defaults.
+const (
+	DefaultStickyCookie = "warren_backend"
+	DefaultStickyTTL    = time.Hour
+)
+
+// Sticky pins each client to one backend with a cookie, so stateful UIs
+// keep hitting the same replica. A pinned backend that fails is replaced.
+type Sticky struct {
+	Cookie string        // default: DefaultStickyCookie
+	TTL    time.Duration // default: DefaultStickyTTL
+}
+
+// Upstream is one backend replica in a pool.
+type Upstream struct {
+	Target *url.URL
+	id     string // sticky cookie value; opaque so backend addresses aren't exposed
+	proxy  *httputil.ReverseProxy
+	active atomic.Int64
+	weight int
+	// current is the smooth weighted round-robin counter, guarded by the
+	// pool's mu.
+	current int
+
+	mu        sync.Mutex
+	failures  int // consecutive failed requests
+	downUntil time.Time
+	lastError string
+}
+
+// Status is a snapshot of an upstream's health, for inspection.
+type Status struct {
+	Target    string     `json:"target"`
+	Healthy   bool       `json:"healthy"`
+	Active    int64      `json:"active"`
+	Weight    int        `json:"weight,omitempty"`
+	Failures  int        `json:"failures"`
+	DownUntil *time.Time `json:"down_until,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+}
+
+// Acquire counts a long-lived connection (e.g. a WebSocket) against the
+// upstream for least-connections balancing. Call the returned func when done.
+func (u *Upstream) Acquire() func() {
+	u.active.Add(1)
+	return func() { u.active.Add(-1) }
+}
+
+// due returns when the upstream leaves cooldown; zero if it never failed.
+func (u *Upstream) due() time.Time {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.downUntil
+}
+
+func (u *Upstream) markDown(err error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.failures++
+	u.downUntil = time.Now().Add(Cooldown)
+	u.lastError = err.Error()
+}
+
+func (u *Upstream) markUp() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.failures = 0
+	u.downUntil = time.Time{}
+}
+
+// Pool balances requests across upstreams. Health is tracked passively: a
+// transport error takes a backend out of rotation for Cooldown, and its next
+// successful response puts it back.
+type Pool struct {
+	strategy  string
+	upstreams []*Upstream
+	next      atomic.Uint64
+	mu        sync.Mutex // guards weighted picks
+	sticky    *Sticky
+	onError   func(http.ResponseWriter, *http.Request, error) // writes the 502 or 504 when an upstream fails
+	logger    *slog.Logger
+}
+
+// New creates a pool over targets. An empty strategy means round-robin.
+func New(targets []*url.URL, strategy string, logger *slog.Logger) (*Pool, error) {
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("balance: no targets")
+	}
+	switch strategy {
+	case "":
+		strategy = RoundRobin
+	case RoundRobin, LeastConnections:
+	case Weighted:
+		return nil, fmt.Errorf("balance: weighted strategy needs weights")
+	default:
+		return nil, fmt.Errorf("balance: unknown strategy %q", strategy)
+	}
+	return newPool(targets, strategy, logger), nil
+}
+
+// NewWeighted creates a pool that splits traffic across targets in
+// proportion to weights, one per target. A zero weight takes a target out of
+// rotation unless every other target is failing.
+func NewWeighted(targets []*url.URL, weights []int, logger *slog.Logger) (*Pool, error) {
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("balance: no targets")
+	}
+	if len(weights) != len(targets) {
+		return nil, fmt.Errorf("balance: got %d weights for %d targets", len(weights), len(targets))
+	}
+	total := 0
+	for _, w := range weights {
+		if w < 0 {
+			return nil, fmt.Errorf("balance: weight %d is negative", w)
+		}
+		total += w
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("balance: weights must not all be zero")
+	}
+
+	p := newPool(targets, Weighted, logger)
+	for i, u := range p.upstreams {
+		u.weight = weights[i]
+	}
+	return p, nil
+}
+
+func newPool(targets []*url.URL, strategy string, logger *slog.Logger) *Pool {
+	p := &Pool{strategy: strategy, logger: logger.With("component", "balance")}
+	for _, target := range targets {
+		sum := sha256.Sum256([]byte(target.String()))
+		u := &Upstream{Target: target, id: hex.EncodeToString(sum[:6])}
+		rp := httputil.NewSingleHostReverseProxy(target)
+		rp.FlushInterval = -1 // streaming/SSE support
+		rp.ModifyResponse = func(*http.Response) error {
+			u.markUp()
+			return nil
+		}
+		rp.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			// A request body cut off for size is the client's fault, not
+			// the upstream's.
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			u.markDown(err)
+			p.logger.Error("backend failed, skipping it", "target", target, "cooldown", Cooldown, "error", err)
+			if p.onError != nil {
+				p.onError(w, r, err)
+				return
+			}
+			if errors.Is(err, context.DeadlineExceeded) {
+				http.Error(w, "gateway timeout", http.StatusGatewayTimeout)
+				return
+			}
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+		}
+		u.proxy = rp
+		p.upstreams = append(p.upstreams, u)
+	}
+	return p
+}
+
+// Strategy returns the pool's balancing strategy.
+func (p *Pool) Strategy() string { return p.strategy }
+
+// SetSticky enables cookie-based session affinity. Call it before the pool
+// serves requests.
+func (p *Pool) SetSticky(s Sticky) {
+	if s.Cookie == "" {
+		s.Cookie = DefaultStickyCookie
+	}
+	if s.TTL <= 0 {
+		s.TTL = DefaultStickyTTL
+	}
+	p.sticky = &s
+}
+
+// ValidCookieName reports whether name can be used as the sticky cookie,
+// by the same rule http.Cookie applies before writing Set-Cookie.
+func ValidCookieName(name string) bool {
+	return name != "" && (&http.Cookie{Name: name}).Valid() == nil
+}
+
+// String describes the settings for inspection output.
+func (s Sticky) String() string {
+	return fmt.Sprintf("cookie %s, ttl %s", s.Cookie, s.TTL)
+}
+
+// Sticky returns the pool's session affinity settings, or nil if disabled.
+func (p *Pool) Sticky() *Sticky { return p.sticky }
+
+// Weights returns the per-target weights in order, or nil unless the pool
+// is weighted.
+func (p *Pool) Weights() []int {
+	if p.strategy != Weighted {
+		return nil
+	}
+	out := make([]int, len(p.upstreams))
+	for i, u := range p.upstreams {
+		out[i] = u.weight
+	}
+	return out
+}
+
+// Targets returns the pool's backend URLs in order.
+func (p *Pool) Targets() []string {
+	out := make([]string, len(p.upstreams))
+	for i, u := range p.upstreams {
+		out[i] = u.Target.String()
+	}
+	return out
+}
+
+// Pick chooses the upstream for the next request. If every backend is in
+// cooldown, the one due back soonest is tried rather than failing outright.
+func (p *Pool) Pick() *Upstream {
+	now := time.Now()
+	n := len(p.upstreams)
+	start := int(p.next.Add(1)-1) % n
+
+	if p.strategy == Weighted {
+		if u := p.pickWeighted(now); u != nil {
+			return u
+		}
+		return p.soonestDue(start)
+	}
+
+	var best *Upstream
+	for i := 0; i < n; i++ {
+		u := p.upstreams[(start+i)%n]
+		if now.Before(u.due()) {
+			continue
+		}
+		if p.strategy == RoundRobin {
+			return u
+		}
+		if best == nil || u.active.Load() < best.active.Load() {
+			best = u
+		}
+	}
+	if best != nil {
+		return best
+	}
+	return p.soonestDue(start)
+}
+
+// PickFor chooses the upstream for r, honouring its sticky cookie if the
+// pinned backend is still in rotation.
+func (p *Pool) PickFor(r *http.Request) *Upstream {
+	if u := p.pinned(r); u != nil {
+		return u
+	}
+	return p.Pick()
+}
+
+// pinned returns the healthy upstream named by r's sticky cookie, if any.
+func (p *Pool) pinned(r *http.Request) *Upstream {
+	if p.sticky == nil {
+		return nil
+	}
+	c, err := r.Cookie(p.sticky.Cookie)
+	if err != nil {
+		return nil
+	}
+	now := time.Now()
+	for _, u := range p.upstreams {
+		if u.id != c.Value {
+			continue
+		}
+		if now.Before(u.due()) || (p.strategy == Weighted && u.weight == 0) {
+			return nil
+		}
+		return u
+	}
+	return nil
+}
+
+// pickWeighted uses smooth weighted round-robin over the healthy upstreams,
+// so a 90/10 split interleaves the canary's requests rather than sending
+// them in a burst. It returns nil if no weighted upstream is healthy.
+func (p *Pool) pickWeighted(now time.Time) *Upstream {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var best *Upstream
+	total := 0
+	for _, u := range p.upstreams {
+		if u.weight == 0 || now.Before(u.due()) {
+			continue
+		}
+		u.current += u.weight
+		total += u.weight
+		if best == nil || u.current > best.current {
+			best = u
+		}
+	}
+	if best != nil {
+		best.current -= total
+	}
+	return best
+}
+
+// soonestDue returns the upstream leaving cooldown first, for when none is
+// healthy.
+func (p *Pool) soonestDue(start int) *Upstream {
+	best := p.upstreams[start]
+	for _, u := range p.upstreams {
+		if u.due().Before(best.due()) {
+			best = u
+		}
+	}
+	return best
+}
+
+// ServeHTTP proxies the request to the picked upstream, pinning the client
+// to it when sticky sessions are enabled.
+func (p *Pool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u := p.pinned(r)
+	if u == nil {
+		u = p.Pick()
+		if p.sticky != nil {
+			http.SetCookie(w, &http.Cookie{
+				Name:     p.sticky.Cookie,
+				Value:    u.id,
+				Path:     "/",
+				MaxAge:   int(p.sticky.TTL.Seconds()),
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+	}
+	release := u.Acquire()
+	defer release()
+	u.proxy.ServeHTTP(w, r)
+}
+
+// SetTransport sets the transport every upstream proxies through. Call it
+// before the pool serves requests.
+func (p *Pool) SetTransport(rt http.RoundTripper) {
+	for _, u := range p.upstreams {
+		u.proxy.Transport = rt
+	}
+}
+
+// SetErrorHandler replaces the plain-text 502, or 504 for a timeout, written
+// when an upstream fails. Call it before the pool serves requests.
+func (p *Pool) SetErrorHandler(fn func(http.ResponseWriter, *http.Request, error)) {
+	p.onError = fn
+}
+
+// Status reports each upstream's health in pool order.
+func (p *Pool) Status() []Status {
+	now := time.Now()
+	out := make([]Status, len(p.upstreams))
+	for i, u := range p.upstreams {
+		u.mu.Lock()
+		s := Status{
+			Target:    u.Target.String(),
+			Healthy:   !now.Before(u.downUntil),
+			Active:    u.active.Load(),
+			Weight:    u.weight,
+			Failures:  u.failures,
+			LastError: u.lastError,
+		}
+		if !s.Healthy {
+			until := u.downUntil
+			s.DownUntil = &until
+		}
+		u.mu.Unlock()
+		out[i] = s
+	}
+	return out
+}
+
+// SameTargets reports whether other balances the same targets the same way
+// (including weights and stickiness),
+// so a config reload can keep the existing pool and its health state.
+func (p *Pool) SameTargets(other *Pool) bool {
+	if other == nil || p.strategy != other.strategy || len(p.upstreams) != len(other.upstreams) {
+		return false
+	}
+	if (p.sticky == nil) != (other.sticky == nil) || (p.sticky != nil && *p.sticky != *other.sticky) {
+		return false
+	}
+	for i, u := range p.upstreams {
+		if u.Target.String() != other.upstreams[i].Target.String() || u.weight != other.upstreams[i].weight {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,299 @@
+package balance
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func quietLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func namedBackend(t *testing.T, name string) *url.URL {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(name))
+	}))
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse(srv.URL)
+	return u
+}
+
+func get(t *testing.T, p *Pool) (int, string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	return w.Code, w.Body.String()
+}
+
+func TestRoundRobin(t *testing.T) {
+	p, err := New([]*url.URL{namedBackend(t, "a"), namedBackend(t, "b")}, "", quietLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Strategy() != RoundRobin {
+		t.Errorf("strategy = %q, want round-robin", p.Strategy())
+	}
+
+	var got []string
+	for i := 0; i < 4; i++ {
+		_, body := get(t, p)
+		got = append(got, body)
+	}
+	if got[0] == got[1] || got[0] != got[2] || got[1] != got[3] {
+		t.Errorf("responses = %v, want alternating", got)
+	}
+}
+
+func TestLeastConnections(t *testing.T) {
+	a, b := namedBackend(t, "a"), namedBackend(t, "b")
+	p, err := New([]*url.URL{a, b}, LeastConnections, quietLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Hold a connection open on a; every pick should go to b.
+	release := p.upstreams[0].Acquire()
+	defer release()
+	for i := 0; i < 3; i++ {
+		if u := p.Pick(); u.Target != b {
+			t.Fatalf("pick %d = %s, want %s", i, u.Target, b)
+		}
+	}
+}
+
+func TestFailedBackendSkipped(t *testing.T) {
+	dead, _ := url.Parse("http://127.0.0.1:1")
+	p, err := New([]*url.URL{dead, namedBackend(t, "ok")}, RoundRobin, quietLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first request may hit the dead backend; after that it is in
+	// cooldown and all traffic goes to the healthy one.
+	get(t, p)
+	for i := 0; i < 4; i++ {
+		if code, body := get(t, p); code != 200 || body != "ok" {
+			t.Fatalf("request %d = %d %q, want 200 ok", i, code, body)
+		}
+	}
+
+	st := p.Status()
+	if st[0].Healthy || st[0].Failures != 1 || st[0].DownUntil == nil || st[0].LastError == "" {
+		t.Errorf("dead backend status = %+v", st[0])
+	}
+	if !st[1].Healthy {
+		t.Errorf("live backend status = %+v", st[1])
+	}
+}
+
+func TestAllBackendsDownStillTried(t *testing.T) {
+	dead, _ := url.Parse("http://127.0.0.1:1")
+	p, err := New([]*url.URL{dead}, RoundRobin, quietLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if code, _ := get(t, p); code != http.StatusBadGateway {
+			t.Errorf("request %d = %d, want 502", i, code)
+		}
+	}
+	if f := p.Status()[0].Failures; f != 2 {
+		t.Errorf("failures = %d, want 2", f)
+	}
+}
+
+func TestNewRejectsUnknownStrategy(t *testing.T) {
+	u, _ := url.Parse("http://a")
+	if _, err := New([]*url.URL{u}, "random", quietLogger()); err == nil {
+		t.Error("expected error for unknown strategy")
+	}
+	if _, err := New(nil, "", quietLogger()); err == nil {
+		t.Error("expected error for no targets")
+	}
+}
+
+func TestSameTargets(t *testing.T) {
+	a, _ := url.Parse("http://a")
+	b, _ := url.Parse("http://b")
+	p1, _ := New([]*url.URL{a, b}, "", quietLogger())
+	p2, _ := New([]*url.URL{a, b}, RoundRobin, quietLogger())
+	p3, _ := New([]*url.URL{a, b}, LeastConnections, quietLogger())
+	p4, _ := New([]*url.URL{b, a}, "", quietLogger())
+
+	if !p1.SameTargets(p2) {
+		t.Error("identical pools should match")
+	}
+	if p1.SameTargets(p3) || p1.SameTargets(p4) || p1.SameTargets(nil) {
+		t.Error("differing pools should not match")
+	}
+}
+
+func TestWeightedSplit(t *testing.T) {
+	stable, canary := namedBackend(t, "stable"), namedBackend(t, "canary")
+	p, err := NewWeighted([]*url.URL{stable, canary}, []int{90, 10}, quietLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Strategy() != Weighted {
+		t.Errorf("strategy = %q, want weighted", p.Strategy())
+	}
+
+	counts := map[string]int{}
+	for i := 0; i < 100; i++ {
+		counts[p.Pick().Target.String()]++
+	}
+	if counts[stable.String()] != 90 || counts[canary.String()] != 10 {
+		t.Errorf("split = %v, want 90/10", counts)
+	}
+	if st := p.Status(); st[0].Weight != 90 || st[1].Weight != 10 {
+		t.Errorf("status weights = %d/%d", st[0].Weight, st[1].Weight)
+	}
+}
+
+func TestWeightedSkipsFailedAndZeroWeight(t *testing.T) {
+	dead, _ := url.Parse("http://127.0.0.1:1")
+	off := namedBackend(t, "off")
+	p, err := NewWeighted([]*url.URL{dead, namedBackend(t, "ok"), off}, []int{50, 50, 0}, quietLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	get(t, p)
+	for i := 0; i < 4; i++ {
+		if code, body := get(t, p); code != 200 || body != "ok" {
+			t.Fatalf("request %d = %d %q, want 200 ok", i, code, body)
+		}
+	}
+}
+
+func TestNewWeightedRejectsBadWeights(t *testing.T) {
+	a, _ := url.Parse("http://a")
+	b, _ := url.Parse("http://b")
+	for _, weights := range [][]int{{100}, {-1, 2}, {0, 0}} {
+		if _, err := NewWeighted([]*url.URL{a, b}, weights, quietLogger()); err == nil {
+			t.Errorf("weights %v: expected error", weights)
+		}
+	}
+	if _, err := New([]*url.URL{a, b}, Weighted, quietLogger()); err == nil {
+		t.Error("expected weighted strategy without weights to be rejected")
+	}
+
+	p1, _ := NewWeighted([]*url.URL{a, b}, []int{90, 10}, quietLogger())
+	p2, _ := NewWeighted([]*url.URL{a, b}, []int{50, 50}, quietLogger())
+	if p1.SameTargets(p2) {
+		t.Error("pools with different weights should not match")
+	}
+}
+
+func TestStickySessions(t *testing.T) {
+	p, err := New([]*url.URL{namedBackend(t, "a"), namedBackend(t, "b")}, RoundRobin, quietLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.SetSticky(Sticky{Cookie: "pin", TTL: 2 * time.Hour})
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	first := w.Body.String()
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "pin" || cookies[0].MaxAge != 7200 {
+		t.Fatalf("cookies = %+v, want pin with a 2h max age", cookies)
+	}
+	if strings.Contains(cookies[0].Value, "127.0.0.1") {
+		t.Errorf("cookie %q exposes the backend address", cookies[0].Value)
+	}
+
+	// Round-robin would alternate; the cookie keeps the client on one backend.
+	for i := 0; i < 4; i++ {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.AddCookie(cookies[0])
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+		if w.Body.String() != first {
+			t.Fatalf("request %d went to %q, want pinned %q", i, w.Body.String(), first)
+		}
+		if len(w.Result().Cookies()) != 0 {
+			t.Errorf("request %d re-set the cookie of a pinned client", i)
+		}
+	}
+
+	// An unknown pin is replaced.
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: "pin", Value: "stale"})
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	if len(w.Result().Cookies()) != 1 {
+		t.Error("expected a fresh cookie for an unknown pin")
+	}
+}
+
+func TestStickyFailover(t *testing.T) {
+	dead, _ := url.Parse("http://127.0.0.1:1")
+	p, err := New([]*url.URL{dead, namedBackend(t, "ok")}, RoundRobin, quietLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.SetSticky(Sticky{})
+	if s := p.Sticky(); s.Cookie != DefaultStickyCookie || s.TTL != DefaultStickyTTL {
+		t.Errorf("sticky defaults = %+v", s)
+	}
+
+	// Pin to the dead backend; once it fails the client is moved.
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: DefaultStickyCookie, Value: p.upstreams[0].id})
+	get(t, p)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	if w.Body.String() != "ok" {
+		t.Fatalf("pinned to failed backend: %d %q", w.Code, w.Body.String())
+	}
+	if c := w.Result().Cookies(); len(c) != 1 || c[0].Value != p.upstreams[1].id {
+		t.Errorf("cookies = %+v, want re-pin to the healthy backend", c)
+	}
+
+	plain, _ := New([]*url.URL{dead, p.upstreams[1].Target}, RoundRobin, quietLogger())
+	if p.SameTargets(plain) {
+		t.Error("sticky and non-sticky pools should not match")
+	}
+}
+
+func TestOversizedBodyDoesNotMarkDown(t *testing.T) {
+	p, err := New([]*url.URL{namedBackend(t, "a")}, "", quietLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/", io.MultiReader(strings.NewReader("0123456789"), strings.NewReader("abcdef")))
+	r.Body = http.MaxBytesReader(w, r.Body, 10)
+	p.ServeHTTP(w, r)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want 413", w.Code)
+	}
+	if st := p.Status()[0]; !st.Healthy {
+		t.Errorf("upstream marked down after a client's oversized body: %+v", st)
+	}
+}
+
+func TestValidCookieName(t *testing.T) {
+	for name, want := range map[string]bool{
+		"warren_backend": true,
+		"ui-pin.v2":      true,
+		"":               false,
+		"my pin":         false,
+		"pin;x":          false,
+		"pin=x":          false,
+		"pïn":            false,
+	} {
+		if got := ValidCookieName(name); got != want {
+			t.Errorf("ValidCookieName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
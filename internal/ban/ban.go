@@ -0,0 +1,293 @@
+// Package ban temporarily blocks client IPs that keep failing
+// authentication or hitting limits, in the manner of fail2ban. Bans are
+// written to a file so a restart doesn't let an attacker straight back in.
+package ban
+
+import (
+	"container/list"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"warren/internal/clock"
+	"warren/internal/realip"
+)
+
+// Defaults for unset Config fields.
+const (
+	DefaultMaxStrikes = 10
+	DefaultWindow     = 10 * time.Minute
+	DefaultDuration   = time.Hour
+)
+
+// maxTracked bounds how many addresses with strikes but no ban are
+// remembered; past it, the address struck least recently is forgotten to
+// make room, so rotating addresses can't grow the jail without limit.
+const maxTracked = 8192
+
+// Config sets when an address is banned and for how long.
+type Config struct {
+	MaxStrikes int            // strikes within Window that ban an address
+	Window     time.Duration  // how far back strikes count
+	Duration   time.Duration  // how long a ban lasts
+	Ignore     []netip.Prefix // addresses never banned
+	File       string         // where bans are kept across restarts; empty = memory only
+	Clock      clock.Clock    // time source; nil uses the system clock
+}
+
+// Ban is a blocked address.
+type Ban struct {
+	IP      string    `json:"ip"`
+	Reason  string    `json:"reason"` // what the strike that tipped it over was for
+	Strikes int       `json:"strikes"`
+	Since   time.Time `json:"since"`
+	Until   time.Time `json:"until"`
+}
+
+// Jail counts strikes against client addresses and bans those that reach
+// the limit.
+type Jail struct {
+	cfg    Config
+	clock  clock.Clock
+	logger *slog.Logger
+
+	mu      sync.Mutex
+	strikes map[string]*list.Element // address → its entry in order
+	order   *list.List               // *tracked, least recently struck first
+	bans    map[string]Ban
+	onBan   func(Ban)
+}
+
+// tracked is an address's recent strikes, oldest first.
+type tracked struct {
+	ip      string
+	strikes []time.Time
+}
+
+// New returns a jail with the bans from cfg.File that haven't expired.
+func New(cfg Config, logger *slog.Logger) (*Jail, error) {
+	if cfg.MaxStrikes <= 0 {
+		cfg.MaxStrikes = DefaultMaxStrikes
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultWindow
+	}
+	if cfg.Duration <= 0 {
+		cfg.Duration = DefaultDuration
+	}
+	j := &Jail{
+		cfg:     cfg,
+		clock:   clock.Or(cfg.Clock),
+		logger:  logger.With("component", "ban"),
+		strikes: make(map[string]*list.Element),
+		order:   list.New(),
+		bans:    make(map[string]Ban),
+	}
+	if cfg.File == "" {
+		return j, nil
+	}
+	data, err := os.ReadFile(cfg.File)
+	if errors.Is(err, os.ErrNotExist) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var saved []Ban
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, err
+	}
+	now := j.clock.Now()
+	for _, b := range saved {
+		if b.Until.After(now) {
+			j.bans[b.IP] = b
+		}
+	}
+	if len(j.bans) > 0 {
+		j.logger.Info("bans loaded", "count", len(j.bans), "file", cfg.File)
+	}
+	return j, nil
+}
+
+// OnBan calls fn, outside the jail's lock, each time an address is banned.
+func (j *Jail) OnBan(fn func(Ban)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.onBan = fn
+}
+
+// Strike records a failure by ip and bans it once it has MaxStrikes within
+// Window. It reports whether this strike banned it.
+func (j *Jail) Strike(ip, reason string) bool {
+	if ip == "" || j.ignored(ip) {
+		return false
+	}
+	now := j.clock.Now()
+	j.mu.Lock()
+	if b, ok := j.bans[ip]; ok && b.Until.After(now) {
+		j.mu.Unlock()
+		return false
+	}
+	el, ok := j.strikes[ip]
+	var recent []time.Time
+	if ok {
+		recent = j.recent(el.Value.(*tracked).strikes, now)
+	}
+	recent = append(recent, now)
+	if len(recent) < j.cfg.MaxStrikes {
+		switch {
+		case ok:
+			el.Value.(*tracked).strikes = recent
+			j.order.MoveToBack(el)
+		default:
+			if len(j.strikes) >= maxTracked {
+				j.forgetLocked(j.order.Front().Value.(*tracked).ip)
+			}
+			j.strikes[ip] = j.order.PushBack(&tracked{ip: ip, strikes: recent})
+		}
+		j.mu.Unlock()
+		return false
+	}
+	j.forgetLocked(ip)
+	b := Ban{IP: ip, Reason: reason, Strikes: len(recent), Since: now, Until: now.Add(j.cfg.Duration)}
+	j.bans[ip] = b
+	j.saveLocked()
+	onBan := j.onBan
+	j.mu.Unlock()
+
+	j.logger.Warn("address banned", "ip", ip, "reason", reason, "strikes", b.Strikes, "until", b.Until)
+	if onBan != nil {
+		onBan(b)
+	}
+	return true
+}
+
+// Banned reports whether ip is banned right now.
+func (j *Jail) Banned(ip string) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	b, ok := j.bans[ip]
+	return ok && b.Until.After(j.clock.Now())
+}
+
+// Bans returns the current bans, soonest to expire first.
+func (j *Jail) Bans() []Ban {
+	now := j.clock.Now()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	out := make([]Ban, 0, len(j.bans))
+	for ip, b := range j.bans {
+		if !b.Until.After(now) {
+			delete(j.bans, ip)
+			continue
+		}
+		out = append(out, b)
+	}
+	sort.Slice(out, func(i, k int) bool { return out[i].Until.Before(out[k].Until) })
+	return out
+}
+
+// Unban lifts ip's ban and forgets its strikes. It reports whether ip was
+// banned.
+func (j *Jail) Unban(ip string) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.forgetLocked(ip)
+	b, ok := j.bans[ip]
+	if !ok {
+		return false
+	}
+	delete(j.bans, ip)
+	j.saveLocked()
+	j.logger.Info("address unbanned", "ip", ip)
+	return b.Until.After(j.clock.Now())
+}
+
+// Guard answers requests from banned addresses with 403 instead of passing
+// them to next.
+func (j *Jail) Guard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if j.Banned(realip.From(r)) {
+			http.Error(w, `{"error":"forbidden"}`, http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (j *Jail) ignored(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	// Tunnels and reverse proxies on the same host connect from loopback;
+	// banning it would lock out every client behind them at once.
+	if addr.IsLoopback() {
+		return true
+	}
+	for _, p := range j.cfg.Ignore {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// recent returns the strikes still inside the window.
+func (j *Jail) recent(strikes []time.Time, now time.Time) []time.Time {
+	cutoff := now.Add(-j.cfg.Window)
+	for len(strikes) > 0 && !strikes[0].After(cutoff) {
+		strikes = strikes[1:]
+	}
+	return strikes
+}
+
+// forgetLocked drops ip's strikes. Caller holds j.mu.
+func (j *Jail) forgetLocked(ip string) {
+	if el, ok := j.strikes[ip]; ok {
+		j.order.Remove(el)
+		delete(j.strikes, ip)
+	}
+}
+
+// saveLocked writes the bans to cfg.File, replacing it atomically. Caller
+// holds j.mu.
+func (j *Jail) saveLocked() {
+	if j.cfg.File == "" {
+		return
+	}
+	out := make([]Ban, 0, len(j.bans))
+	for _, b := range j.bans {
+		out = append(out, b)
+	}
+	sort.Slice(out, func(i, k int) bool { return out[i].IP < out[k].IP })
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		j.logger.Error("failed to encode bans", "error", err)
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(j.cfg.File), ".warren-bans-*")
+	if err != nil {
+		j.logger.Error("failed to save bans", "file", j.cfg.File, "error", err)
+		return
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), j.cfg.File)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		j.logger.Error("failed to save bans", "file", j.cfg.File, "error", err)
+	}
+}
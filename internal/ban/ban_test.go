@@ -0,0 +1,141 @@
+package ban
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"warren/internal/clock"
+)
+
+func quietLogger() *slog.Logger {
+	return slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+}
+
+var epoch = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestStrikesBanWithinWindow(t *testing.T) {
+	clk := clock.NewFake(epoch)
+	j, err := New(Config{MaxStrikes: 3, Window: time.Minute, Duration: time.Hour, Clock: clk}, quietLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var banned []Ban
+	j.OnBan(func(b Ban) { banned = append(banned, b) })
+
+	j.Strike("203.0.113.7", "admin auth")
+	j.Strike("203.0.113.7", "admin auth")
+	clk.Advance(2 * time.Minute) // both strikes age out
+	j.Strike("203.0.113.7", "admin auth")
+	j.Strike("203.0.113.7", "admin auth")
+	if j.Banned("203.0.113.7") {
+		t.Fatal("banned with strikes spread over more than the window")
+	}
+	if !j.Strike("203.0.113.7", "basic auth") {
+		t.Fatal("third strike within the window didn't ban")
+	}
+	if !j.Banned("203.0.113.7") || j.Banned("203.0.113.8") {
+		t.Error("Banned reports the wrong addresses")
+	}
+	if len(banned) != 1 || banned[0].Reason != "basic auth" || banned[0].Strikes != 3 || !banned[0].Until.Equal(epoch.Add(2*time.Minute+time.Hour)) {
+		t.Errorf("OnBan got %+v", banned)
+	}
+
+	clk.Advance(time.Hour)
+	if j.Banned("203.0.113.7") || len(j.Bans()) != 0 {
+		t.Error("ban outlived its duration")
+	}
+}
+
+func TestIgnoreAndUnban(t *testing.T) {
+	j, _ := New(Config{MaxStrikes: 1, Ignore: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}}, quietLogger())
+	if j.Strike("10.1.2.3", "admin auth") || j.Banned("10.1.2.3") {
+		t.Error("ignored address banned")
+	}
+	if j.Strike("127.0.0.1", "admin auth") || j.Strike("::1", "admin auth") || j.Banned("127.0.0.1") {
+		t.Error("loopback address banned")
+	}
+	j.Strike("198.51.100.1", "admin auth")
+	if !j.Unban("198.51.100.1") || j.Banned("198.51.100.1") {
+		t.Error("Unban didn't lift the ban")
+	}
+	if j.Unban("198.51.100.1") {
+		t.Error("Unban of an address that isn't banned reported true")
+	}
+}
+
+func TestBansPersist(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "bans.json")
+	clk := clock.NewFake(epoch)
+	j, _ := New(Config{MaxStrikes: 1, File: file, Clock: clk}, quietLogger())
+	j.Strike("203.0.113.7", "admin auth")
+
+	restarted, err := New(Config{File: file, Clock: clk}, quietLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !restarted.Banned("203.0.113.7") {
+		t.Fatal("ban lost across restart")
+	}
+	restarted.Unban("203.0.113.7")
+	again, _ := New(Config{File: file, Clock: clk}, quietLogger())
+	if again.Banned("203.0.113.7") {
+		t.Error("unban not saved")
+	}
+}
+
+func TestGuard(t *testing.T) {
+	j, _ := New(Config{MaxStrikes: 1}, quietLogger())
+	j.Strike("192.0.2.1", "admin auth")
+	h := j.Guard(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.0.2.1:5000"
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("banned address: %d, want 403", w.Code)
+	}
+	req.RemoteAddr = "192.0.2.2:5000"
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("other address: %d, want 200", w.Code)
+	}
+}
+
+func TestStrikesTrackedBounded(t *testing.T) {
+	clk := clock.NewFake(epoch)
+	j, err := New(Config{MaxStrikes: 2, Window: time.Hour, Clock: clk}, quietLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := func(i int) string { return netip.AddrFrom4([4]byte{10, byte(i >> 16), byte(i >> 8), byte(i)}).String() }
+
+	// Rotating addresses, all striking inside the window.
+	j.Strike(addr(0), "admin auth")
+	for i := 1; i < maxTracked+100; i++ {
+		clk.Advance(time.Millisecond)
+		j.Strike(addr(i), "admin auth")
+		if i == maxTracked/2 {
+			j.Strike(addr(0), "admin auth") // bans it: no longer tracked
+		}
+	}
+	if n := len(j.strikes); n != maxTracked || j.order.Len() != maxTracked {
+		t.Fatalf("tracking %d addresses (%d in order), want %d", n, j.order.Len(), maxTracked)
+	}
+	if !j.Banned(addr(0)) {
+		t.Error("address struck twice wasn't banned")
+	}
+	if _, ok := j.strikes[addr(1)]; ok {
+		t.Error("least recently struck address wasn't evicted")
+	}
+	if !j.Strike(addr(maxTracked+99), "admin auth") {
+		t.Error("recently struck address lost its strike")
+	}
+}
@@ -0,0 +1,201 @@
+// Package breaker implements a per-backend circuit breaker: once a backend's
+// error rate crosses a threshold, requests fail fast instead of piling
+// timeouts onto a dying container, and a single probe is let through
+// periodically to see whether it has recovered.
+package breaker
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Circuit states.
+const (
+	Closed   = "closed"    // requests flow normally
+	Open     = "open"      // requests are rejected
+	HalfOpen = "half-open" // one probe request is allowed through
+)
+
+// Defaults for unset Config fields.
+const (
+	DefaultMinRequests = 10
+	DefaultWindow      = 30 * time.Second
+	DefaultOpenFor     = 15 * time.Second
+)
+
+// Config sets when the circuit opens and for how long.
+type Config struct {
+	// Threshold is the error rate (0 < Threshold <= 1) over Window that
+	// opens the circuit.
+	Threshold float64
+	// MinRequests is how many requests Window must hold before the error
+	// rate is trusted.
+	MinRequests int
+	Window      time.Duration
+	// OpenFor is how long to fail fast before letting a probe through.
+	OpenFor time.Duration
+}
+
+// Status is a snapshot of a breaker for inspection.
+type Status struct {
+	State    string     `json:"state"`
+	Requests int        `json:"requests"` // in the current window
+	Failures int        `json:"failures"` // in the current window
+	OpenedAt *time.Time `json:"opened_at,omitempty"`
+	ProbeAt  *time.Time `json:"probe_at,omitempty"` // when the next probe is let through
+}
+
+// Breaker tracks one backend's recent outcomes.
+type Breaker struct {
+	cfg      Config
+	onChange func(from, to string)
+
+	mu          sync.Mutex
+	state       string
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probing     bool
+}
+
+// New creates a closed breaker, filling unset Config fields with defaults.
+func New(cfg Config) (*Breaker, error) {
+	if cfg.Threshold <= 0 || cfg.Threshold > 1 {
+		return nil, fmt.Errorf("breaker: threshold must be in (0, 1], got %v", cfg.Threshold)
+	}
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = DefaultMinRequests
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultWindow
+	}
+	if cfg.OpenFor <= 0 {
+		cfg.OpenFor = DefaultOpenFor
+	}
+	return &Breaker{cfg: cfg, state: Closed, windowStart: time.Now()}, nil
+}
+
+// OnChange registers a callback for state transitions, e.g. to emit events.
+// Call it before the breaker is used. The callback runs without the
+// breaker's lock held.
+func (b *Breaker) OnChange(fn func(from, to string)) {
+	b.onChange = fn
+}
+
+// Config returns the breaker's effective settings.
+func (b *Breaker) Config() Config { return b.cfg }
+
+// Allow reports whether a request may go to the backend. If it may, the
+// caller must report the outcome with the returned func.
+func (b *Breaker) Allow() (done func(ok bool), allowed bool) {
+	b.mu.Lock()
+	now := time.Now()
+	from := b.state
+	switch b.state {
+	case Open:
+		if now.Sub(b.openedAt) < b.cfg.OpenFor {
+			b.mu.Unlock()
+			return nil, false
+		}
+		b.state = HalfOpen
+		b.probing = true
+	case HalfOpen:
+		if b.probing {
+			b.mu.Unlock()
+			return nil, false
+		}
+		b.probing = true
+	}
+	to := b.state
+	b.mu.Unlock()
+
+	b.notify(from, to)
+	probe := to == HalfOpen
+	return func(ok bool) { b.record(ok, probe) }, true
+}
+
+// RetryAfter is how long until the next probe may be let through.
+func (b *Breaker) RetryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != Open {
+		return 0
+	}
+	if d := b.cfg.OpenFor - time.Since(b.openedAt); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// State returns the current state.
+func (b *Breaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Status returns a snapshot for inspection.
+func (b *Breaker) Status() Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := Status{State: b.state, Requests: b.requests, Failures: b.failures}
+	if b.state != Closed {
+		opened := b.openedAt
+		probe := opened.Add(b.cfg.OpenFor)
+		s.OpenedAt, s.ProbeAt = &opened, &probe
+	}
+	return s
+}
+
+// Same reports whether other has the same settings, so a config reload can
+// keep the live breaker and its state.
+func (b *Breaker) Same(other *Breaker) bool {
+	return other != nil && b.cfg == other.cfg
+}
+
+func (b *Breaker) record(ok, probe bool) {
+	b.mu.Lock()
+	from := b.state
+	now := time.Now()
+
+	if probe {
+		b.probing = false
+		if ok {
+			b.state = Closed
+			b.resetWindow(now)
+		} else {
+			b.state = Open
+			b.openedAt = now
+		}
+	} else if b.state == Closed {
+		if now.Sub(b.windowStart) >= b.cfg.Window {
+			b.resetWindow(now)
+		}
+		b.requests++
+		if !ok {
+			b.failures++
+		}
+		if b.requests >= b.cfg.MinRequests && float64(b.failures)/float64(b.requests) >= b.cfg.Threshold {
+			b.state = Open
+			b.openedAt = now
+		}
+	}
+	to := b.state
+	b.mu.Unlock()
+
+	b.notify(from, to)
+}
+
+func (b *Breaker) resetWindow(now time.Time) {
+	b.windowStart = now
+	b.requests = 0
+	b.failures = 0
+}
+
+func (b *Breaker) notify(from, to string) {
+	if from != to && b.onChange != nil {
+		b.onChange(from, to)
+	}
+}
@@ -0,0 +1,99 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+)
+
+func call(t *testing.T, b *Breaker, ok bool) bool {
+	t.Helper()
+	done, allowed := b.Allow()
+	if allowed {
+		done(ok)
+	}
+	return allowed
+}
+
+func TestOpensAtThreshold(t *testing.T) {
+	b, err := New(Config{Threshold: 0.5, MinRequests: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var changes []string
+	b.OnChange(func(from, to string) { changes = append(changes, from+"->"+to) })
+
+	// Two failures in three requests is over 50%, but not enough requests yet.
+	call(t, b, true)
+	call(t, b, false)
+	call(t, b, false)
+	if b.State() != Closed {
+		t.Fatalf("state = %s before min requests", b.State())
+	}
+	call(t, b, true)
+	if b.State() != Open {
+		t.Fatalf("state = %s, want open at 2/4 failures", b.State())
+	}
+	if call(t, b, true) {
+		t.Error("open circuit let a request through")
+	}
+	if d := b.RetryAfter(); d <= 0 || d > DefaultOpenFor {
+		t.Errorf("retry after = %v", d)
+	}
+	if len(changes) != 1 || changes[0] != "closed->open" {
+		t.Errorf("changes = %v", changes)
+	}
+}
+
+func TestHalfOpenProbe(t *testing.T) {
+	b, _ := New(Config{Threshold: 1, MinRequests: 1, OpenFor: 10 * time.Millisecond})
+	call(t, b, false)
+	if b.State() != Open {
+		t.Fatalf("state = %s, want open", b.State())
+	}
+
+	time.Sleep(15 * time.Millisecond)
+	done, ok := b.Allow()
+	if !ok || b.State() != HalfOpen {
+		t.Fatalf("probe allowed = %v, state = %s", ok, b.State())
+	}
+	if _, ok := b.Allow(); ok {
+		t.Error("second request allowed while the probe is in flight")
+	}
+	done(false)
+	if b.State() != Open {
+		t.Fatalf("failed probe: state = %s, want open", b.State())
+	}
+
+	time.Sleep(15 * time.Millisecond)
+	if !call(t, b, true) || b.State() != Closed {
+		t.Fatalf("successful probe: state = %s, want closed", b.State())
+	}
+	if st := b.Status(); st.Requests != 0 || st.Failures != 0 || st.OpenedAt != nil {
+		t.Errorf("status after closing = %+v, want a fresh window", st)
+	}
+}
+
+func TestWindowResets(t *testing.T) {
+	b, _ := New(Config{Threshold: 0.5, MinRequests: 2, Window: 10 * time.Millisecond})
+	call(t, b, false)
+	time.Sleep(15 * time.Millisecond)
+	call(t, b, true)
+	call(t, b, true)
+	if b.State() != Closed {
+		t.Errorf("state = %s; the old failure should have aged out", b.State())
+	}
+}
+
+func TestConfig(t *testing.T) {
+	for _, th := range []float64{0, -0.1, 1.5} {
+		if _, err := New(Config{Threshold: th}); err == nil {
+			t.Errorf("threshold %v: expected error", th)
+		}
+	}
+	a, _ := New(Config{Threshold: 0.5})
+	b, _ := New(Config{Threshold: 0.5, Window: DefaultWindow})
+	c, _ := New(Config{Threshold: 0.6})
+	if !a.Same(b) || a.Same(c) || a.Same(nil) {
+		t.Error("Same should compare effective settings")
+	}
+}
@@ -0,0 +1,550 @@
+// Package brotli is a small Brotli (RFC 7932) encoder for compressing proxied
+// responses. It trades ratio for simplicity: greedy LZ77 matching within each
+// meta-block, one prefix code per alphabet and no static dictionary. Any
+// conforming decoder reads its output.
+package brotli
+
+import (
+	"io"
+	"sort"
+)
+
+const (
+	// maxDistance is how far back matches reach, well inside the 64KiB
+	// window the stream header declares.
+	maxDistance = 1 << 15
+	// blockSize is how much input is buffered before a meta-block is
+	// emitted.
+	blockSize = 1 << 16
+
+	minMatch  = 4
+	maxMatch  = 1 << 12
+	hashBits  = 15
+	maxCodeLn = 15
+
+	literalAlphabet  = 256
+	commandAlphabet  = 704
+	distanceAlphabet = 64 // 16 + NDIRECT (0) + 48 << NPOSTFIX (0)
+)
+
+// Writer compresses data written to it and writes the Brotli stream to an
+// underlying writer. Call Close to finish the stream.
+type Writer struct {
+	w       io.Writer
+	bw      bitWriter
+	buf     []byte
+	started bool
+	err     error
+	table   [1 << hashBits]int32
+}
+
+// NewWriter returns a Writer compressing to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w, buf: make([]byte, 0, blockSize)}
+}
+
+// Reset discards the Writer's state and makes it write to w, so a Writer can
+// be reused.
+func (z *Writer) Reset(w io.Writer) {
+	z.w = w
+	z.bw.reset()
+	z.buf = z.buf[:0]
+	z.started = false
+	z.err = nil
+}
+
+// Write buffers p, compressing it a meta-block at a time.
+func (z *Writer) Write(p []byte) (int, error) {
+	if z.err != nil {
+		return 0, z.err
+	}
+	n := len(p)
+	for len(p) > 0 {
+		take := min(blockSize-len(z.buf), len(p))
+		z.buf = append(z.buf, p[:take]...)
+		p = p[take:]
+		if len(z.buf) == blockSize {
+			z.writeBlock()
+			if err := z.drain(); err != nil {
+				return n - len(p), err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Flush compresses everything written so far and pads the stream to a byte
+// boundary, so a decoder can produce all of it without waiting for more.
+func (z *Writer) Flush() error {
+	if z.err != nil {
+		return z.err
+	}
+	z.header()
+	z.writeBlock()
+	// An empty metadata block ends on a byte boundary.
+	z.bw.writeBits(1, 0) // ISLAST
+	z.bw.writeBits(2, 3) // MNIBBLES: metadata
+	z.bw.writeBits(1, 0) // reserved
+	z.bw.writeBits(2, 0) // MSKIPBYTES
+	z.bw.align()
+	return z.drain()
+}
+
+// Close compresses any buffered data and ends the stream. It does not close
+// the underlying writer.
+func (z *Writer) Close() error {
+	if z.err != nil {
+		return z.err
+	}
+	z.writeBlock()
+	z.header()
+	z.bw.writeBits(1, 1) // ISLAST
+	z.bw.writeBits(1, 1) // ISLASTEMPTY
+	z.bw.align()
+	return z.drain()
+}
+
+// drain writes the completed bytes of the stream to the underlying writer.
+func (z *Writer) drain() error {
+	if len(z.bw.out) == 0 {
+		return nil
+	}
+	if _, err := z.w.Write(z.bw.out); err != nil {
+		z.err = err
+		return err
+	}
+	z.bw.out = z.bw.out[:0]
+	return nil
+}
+
+// header writes the stream header the first time it's needed.
+func (z *Writer) header() {
+	if z.started {
+		return
+	}
+	z.started = true
+	z.bw.writeBits(1, 0) // WBITS 16
+}
+
+// command is an insert of literals followed by a backward copy. A zero
+// copyLen ends the meta-block after the literals.
+type command struct {
+	insLen, copyLen, dist int
+}
+
+// writeBlock compresses the buffered input as one meta-block.
+func (z *Writer) writeBlock() {
+	data := z.buf
+	if len(data) == 0 {
+		return
+	}
+	z.header()
+	cmds := z.match(data)
+
+	var litFreq [literalAlphabet]uint32
+	var cmdFreq [commandAlphabet]uint32
+	var distFreq [distanceAlphabet]uint32
+	pos := 0
+	for _, c := range cmds {
+		for _, b := range data[pos : pos+c.insLen] {
+			litFreq[b]++
+		}
+		cmdFreq[commandCode(c)]++
+		if c.copyLen > 0 {
+			sym, _, _ := distanceCode(c.dist)
+			distFreq[sym]++
+		}
+		pos += c.insLen + c.copyLen
+	}
+
+	bw := &z.bw
+	mlen := uint64(len(data) - 1)
+	nibbles := uint(4)
+	for nibbles < 6 && mlen >= 1<<(4*nibbles) {
+		nibbles++
+	}
+	bw.writeBits(1, 0)                 // ISLAST
+	bw.writeBits(2, uint64(nibbles-4)) // MNIBBLES
+	bw.writeBits(4*nibbles, mlen)      // MLEN-1
+	bw.writeBits(1, 0)                 // ISUNCOMPRESSED
+	bw.writeBits(1, 0)                 // NBLTYPESL = 1
+	bw.writeBits(1, 0)                 // NBLTYPESI = 1
+	bw.writeBits(1, 0)                 // NBLTYPESD = 1
+	bw.writeBits(2, 0)                 // NPOSTFIX
+	bw.writeBits(4, 0)                 // NDIRECT
+	bw.writeBits(2, 0)                 // context mode of the literal block type
+	bw.writeBits(1, 0)                 // NTREESL = 1
+	bw.writeBits(1, 0)                 // NTREESD = 1
+	lit := writePrefixCode(bw, litFreq[:], 8)
+	cmd := writePrefixCode(bw, cmdFreq[:], 10)
+	dist := writePrefixCode(bw, distFreq[:], 6)
+
+	pos = 0
+	for _, c := range cmds {
+		code := commandCode(c)
+		bw.writeBits(uint(cmd.depth[code]), uint64(cmd.bits[code]))
+		ic, cc := insertCode(c.insLen), copyCode(c.copyLen)
+		bw.writeBits(uint(insertExtra[ic]), uint64(c.insLen)-uint64(insertBase[ic]))
+		if c.copyLen > 0 {
+			bw.writeBits(uint(copyExtra[cc]), uint64(c.copyLen)-uint64(copyBase[cc]))
+		}
+		for _, b := range data[pos : pos+c.insLen] {
+			bw.writeBits(uint(lit.depth[b]), uint64(lit.bits[b]))
+		}
+		if c.copyLen > 0 {
+			sym, nbits, extra := distanceCode(c.dist)
+			bw.writeBits(uint(dist.depth[sym]), uint64(dist.bits[sym]))
+			bw.writeBits(nbits, extra)
+		}
+		pos += c.insLen + c.copyLen
+	}
+	z.buf = z.buf[:0]
+}
+
+// match splits data into commands with greedy LZ77, remembering the last
+// position each 4-byte hash was seen.
+func (z *Writer) match(data []byte) []command {
+	for i := range z.table {
+		z.table[i] = -1
+	}
+	var cmds []command
+	lit := 0
+	for i := 0; i+minMatch <= len(data); {
+		h := hash4(data[i:])
+		cand := int(z.table[h])
+		z.table[h] = int32(i)
+		if cand < 0 || i-cand > maxDistance || !equal4(data[cand:], data[i:]) {
+			i++
+			continue
+		}
+		n := minMatch
+		for i+n < len(data) && n < maxMatch && data[cand+n] == data[i+n] {
+			n++
+		}
+		cmds = append(cmds, command{insLen: i - lit, copyLen: n, dist: i - cand})
+		for j := i + 1; j < i+n && j+minMatch <= len(data); j++ {
+			z.table[hash4(data[j:])] = int32(j)
+		}
+		i += n
+		lit = i
+	}
+	if lit < len(data) {
+		cmds = append(cmds, command{insLen: len(data) - lit})
+	}
+	return cmds
+}
+
+func hash4(b []byte) uint32 {
+	v := uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+	return (v * 0x1e35a7bd) >> (32 - hashBits)
+}
+
+func equal4(a, b []byte) bool {
+	return a[0] == b[0] && a[1] == b[1] && a[2] == b[2] && a[3] == b[3]
+}
+
+// Insert and copy length codes (RFC 7932 section 5).
+var (
+	insertBase  = [24]uint32{0, 1, 2, 3, 4, 5, 6, 8, 10, 14, 18, 26, 34, 50, 66, 98, 130, 194, 322, 578, 1090, 2114, 6210, 22594}
+	insertExtra = [24]uint8{0, 0, 0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 7, 8, 9, 10, 12, 14, 24}
+	copyBase    = [24]uint32{2, 3, 4, 5, 6, 7, 8, 9, 10, 12, 14, 18, 22, 30, 38, 54, 70, 102, 134, 198, 326, 582, 1094, 2118}
+	copyExtra   = [24]uint8{0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 7, 8, 9, 10, 24}
+)
+
+func insertCode(n int) int {
+	c := 23
+	for insertBase[c] > uint32(n) {
+		c--
+	}
+	return c
+}
+
+// copyCode returns the copy length code for n; a literal-only command uses
+// code 0, whose copy the decoder never performs.
+func copyCode(n int) int {
+	c := 23
+	for c > 0 && copyBase[c] > uint32(n) {
+		c--
+	}
+	return c
+}
+
+// commandCode combines the insert and copy length codes into an
+// insert-and-copy symbol that is followed by an explicit distance.
+func commandCode(c command) int {
+	ic, cc := insertCode(c.insLen), copyCode(c.copyLen)
+	var base int
+	switch {
+	case ic < 8 && cc < 8:
+		base = 128
+	case ic < 8 && cc < 16:
+		base = 192
+	case ic < 16 && cc < 8:
+		base = 256
+	case ic < 16 && cc < 16:
+		base = 320
+	case ic < 8:
+		base = 384
+	case cc < 8:
+		base = 448
+	case ic < 16:
+		base = 512
+	case cc < 16:
+		base = 576
+	default:
+		base = 640
+	}
+	return base + (ic&7)<<3 + cc&7
+}
+
+// distanceCode returns the distance symbol and extra bits for a backward
+// distance, with no postfix bits and no direct codes.
+func distanceCode(d int) (sym int, nbits uint, extra uint64) {
+	v := uint64(d) + 3
+	top := uint(63)
+	for v>>top == 0 {
+		top--
+	}
+	nbits = top - 1
+	sym = 16 + 2*int(nbits-1) + int(v>>nbits&1)
+	return sym, nbits, v & (1<<nbits - 1)
+}
+
+// prefixCode holds the length and bit-reversed canonical code of each
+// symbol, ready to write.
+type prefixCode struct {
+	depth []uint8
+	bits  []uint16
+}
+
+// codeLengthOrder is the order code length code lengths are written in.
+var codeLengthOrder = [18]int{1, 2, 3, 4, 0, 5, 17, 6, 16, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// writePrefixCode writes a prefix code for the symbol frequencies and
+// returns it. alphabetBits is the width of a symbol in a simple code.
+func writePrefixCode(bw *bitWriter, freq []uint32, alphabetBits uint) prefixCode {
+	used := 0
+	last := 0
+	for s, f := range freq {
+		if f > 0 {
+			used++
+			last = s
+		}
+	}
+	code := prefixCode{depth: make([]uint8, len(freq)), bits: make([]uint16, len(freq))}
+	if used <= 1 {
+		// A simple code with one symbol, which takes no bits to write.
+		bw.writeBits(2, 1)
+		bw.writeBits(2, 0)
+		bw.writeBits(alphabetBits, uint64(last))
+		return code
+	}
+	code.depth = huffmanDepths(freq, maxCodeLn)
+	code.bits = canonicalCodes(code.depth)
+
+	// The code lengths, with runs of three or more zeros as repeat codes.
+	type clSym struct{ sym, extra int }
+	var seq []clSym
+	var clFreq [18]uint32
+	for i := 0; i <= last; {
+		if code.depth[i] != 0 {
+			seq = append(seq, clSym{sym: int(code.depth[i])})
+			clFreq[code.depth[i]]++
+			i++
+			continue
+		}
+		run := 0
+		for i+run <= last && code.depth[i+run] == 0 && run < 10 {
+			run++
+		}
+		if run >= 3 {
+			seq = append(seq, clSym{sym: 17, extra: run - 3})
+			clFreq[17]++
+		} else {
+			for range run {
+				seq = append(seq, clSym{sym: 0})
+			}
+			clFreq[0] += uint32(run)
+		}
+		i += run
+		// A zero run longer than ten is broken with a literal zero, since
+		// consecutive repeat codes would multiply.
+		if run == 10 && i <= last && code.depth[i] == 0 {
+			seq = append(seq, clSym{sym: 0})
+			clFreq[0]++
+			i++
+		}
+	}
+
+	clUsed := 0
+	for _, f := range clFreq {
+		if f > 0 {
+			clUsed++
+		}
+	}
+	var cl prefixCode
+	if clUsed == 1 {
+		// A lone code length symbol is decoded without reading any bits.
+		cl = prefixCode{depth: make([]uint8, 18), bits: make([]uint16, 18)}
+	} else {
+		cl.depth = huffmanDepths(clFreq[:], 5)
+		cl.bits = canonicalCodes(cl.depth)
+	}
+
+	bw.writeBits(2, 0) // HSKIP: a complex code
+	space := 32
+	for _, s := range codeLengthOrder {
+		d := cl.depth[s]
+		if clUsed == 1 && clFreq[s] > 0 {
+			d = 1
+		}
+		writeCodeLengthDepth(bw, d)
+		if d != 0 && clUsed > 1 {
+			space -= 32 >> d
+			if space == 0 {
+				break
+			}
+		}
+	}
+	for _, c := range seq {
+		bw.writeBits(uint(cl.depth[c.sym]), uint64(cl.bits[c.sym]))
+		if c.sym == 17 {
+			bw.writeBits(3, uint64(c.extra))
+		}
+	}
+	return code
+}
+
+// writeCodeLengthDepth writes a code length code length with the fixed
+// variable-length code of RFC 7932 section 3.5.
+func writeCodeLengthDepth(bw *bitWriter, d uint8) {
+	switch d {
+	case 0:
+		bw.writeBits(2, 0)
+	case 1:
+		bw.writeBits(4, 7)
+	case 2:
+		bw.writeBits(3, 3)
+	case 3:
+		bw.writeBits(2, 2)
+	case 4:
+		bw.writeBits(2, 1)
+	case 5:
+		bw.writeBits(4, 15)
+	}
+}
+
+// huffmanDepths returns Huffman code lengths for freq, no longer than
+// maxDepth. If the optimal code is too deep, rare symbols are counted as
+// more frequent until it fits.
+func huffmanDepths(freq []uint32, maxDepth int) []uint8 {
+	type node struct {
+		count       uint32
+		sym         int
+		left, right int // children; -1 for a leaf
+	}
+	depth := make([]uint8, len(freq))
+	for floor := uint32(1); ; floor *= 2 {
+		var nodes []node
+		for s, f := range freq {
+			if f > 0 {
+				nodes = append(nodes, node{count: max(f, floor), sym: s, left: -1, right: -1})
+			}
+		}
+		sort.SliceStable(nodes, func(a, b int) bool { return nodes[a].count < nodes[b].count })
+
+		// Two-queue construction: leaves in count order, then internal
+		// nodes in the order they're made, which is also count order.
+		leaves, merged := 0, len(nodes)
+		nleaves := len(nodes)
+		next := func() int {
+			if leaves < nleaves && (merged == len(nodes) || nodes[leaves].count <= nodes[merged].count) {
+				leaves++
+				return leaves - 1
+			}
+			merged++
+			return merged - 1
+		}
+		for nleaves-leaves+len(nodes)-merged > 1 {
+			a, b := next(), next()
+			nodes = append(nodes, node{count: nodes[a].count + nodes[b].count, left: a, right: b})
+		}
+
+		deepest := 0
+		var walk func(n, d int)
+		walk = func(n, d int) {
+			if nodes[n].left < 0 {
+				depth[nodes[n].sym] = uint8(d)
+				deepest = max(deepest, d)
+				return
+			}
+			walk(nodes[n].left, d+1)
+			walk(nodes[n].right, d+1)
+		}
+		walk(len(nodes)-1, 0)
+		if deepest <= maxDepth {
+			return depth
+		}
+	}
+}
+
+// canonicalCodes assigns canonical prefix codes to the lengths, bit-reversed
+// so they can be written least significant bit first.
+func canonicalCodes(depth []uint8) []uint16 {
+	var count [maxCodeLn + 1]uint16
+	for _, d := range depth {
+		if d > 0 {
+			count[d]++
+		}
+	}
+	var next [maxCodeLn + 2]uint16
+	code := uint16(0)
+	for d := 1; d <= maxCodeLn; d++ {
+		code = (code + count[d-1]) << 1
+		next[d] = code
+	}
+	bits := make([]uint16, len(depth))
+	for s, d := range depth {
+		if d == 0 {
+			continue
+		}
+		c := next[d]
+		next[d]++
+		var rev uint16
+		for range d {
+			rev = rev<<1 | c&1
+			c >>= 1
+		}
+		bits[s] = rev
+	}
+	return bits
+}
+
+// bitWriter packs bits least significant first.
+type bitWriter struct {
+	out  []byte
+	acc  uint64
+	nacc uint
+}
+
+func (b *bitWriter) reset() {
+	b.out = b.out[:0]
+	b.acc, b.nacc = 0, 0
+}
+
+func (b *bitWriter) writeBits(n uint, v uint64) {
+	b.acc |= v << b.nacc
+	b.nacc += n
+	for b.nacc >= 8 {
+		b.out = append(b.out, byte(b.acc))
+		b.acc >>= 8
+		b.nacc -= 8
+	}
+}
+
+// align pads with zero bits to the next byte boundary.
+func (b *bitWriter) align() {
+	if b.nacc > 0 {
+		b.writeBits(8-b.nacc, 0)
+	}
+}
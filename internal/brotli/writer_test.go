@@ -0,0 +1,84 @@
+package brotli
+
+import (
+	"bytes"
+	"math/rand"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestEmptyStream(t *testing.T) {
+	var out bytes.Buffer
+	z := NewWriter(&out)
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// The canonical empty stream: a 64KiB window and an empty last block.
+	if !bytes.Equal(out.Bytes(), []byte{0x06}) {
+		t.Errorf("empty stream = %x, want 06", out.Bytes())
+	}
+}
+
+func TestCompresses(t *testing.T) {
+	data := []byte(strings.Repeat(`{"name":"kai","status":"ready"},`, 1000))
+	var out bytes.Buffer
+	z := NewWriter(&out)
+	z.Write(data)
+	z.Close()
+	if out.Len() > len(data)/10 {
+		t.Errorf("compressed %d bytes to %d", len(data), out.Len())
+	}
+}
+
+// TestRoundTrip checks the output against the reference decoder Node.js
+// ships, when it's installed.
+func TestRoundTrip(t *testing.T) {
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("node not installed")
+	}
+	r := rand.New(rand.NewSource(1))
+	random := make([]byte, 100000)
+	r.Read(random)
+	text := make([]byte, 200000)
+	for i := range text {
+		text[i] = "abcdefgh ij\n"[r.Intn(12)]
+	}
+	inputs := map[string][]byte{
+		"one byte": []byte("a"),
+		"json":     []byte(strings.Repeat(`{"name":"kai","hostname":"kai.example.com","count":12345},`, 3000)),
+		"random":   random,
+		"text":     text,
+		"zeros":    make([]byte, 150000),
+	}
+	for name, data := range inputs {
+		for _, flushEvery := range []int{0, 1000} {
+			var out bytes.Buffer
+			z := NewWriter(&out)
+			for i := 0; i < len(data); {
+				n := len(data) - i
+				if flushEvery > 0 {
+					n = min(n, flushEvery)
+				}
+				z.Write(data[i : i+n])
+				if flushEvery > 0 {
+					z.Flush()
+				}
+				i += n
+			}
+			z.Close()
+
+			cmd := exec.Command(node, "-e", `process.stdout.write(require('zlib').brotliDecompressSync(require('fs').readFileSync(0)))`)
+			cmd.Stdin = &out
+			got, err := cmd.Output()
+			if err != nil {
+				t.Errorf("%s (flush every %d): decode: %v", name, flushEvery, err)
+				continue
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("%s (flush every %d): round trip differs", name, flushEvery)
+			}
+		}
+	}
+}
@@ -0,0 +1,317 @@
+// Package cache keeps a route's static responses in memory, so assets can
+// be served without waking a sleeping agent or hitting a slow backend.
+// Only responses that are the same for every client are stored: requests
+// carrying credentials bypass the cache, and responses that set cookies,
+// are marked private or vary by origin are never kept.
+package cache
+
+import (
+	"bytes"
+	"container/list"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults for unset Config fields.
+const (
+	DefaultTTL      = 5 * time.Minute
+	DefaultMaxSize  = 10 << 20
+	DefaultMaxEntry = 1 << 20
+)
+
+// Config selects which of a route's responses are cached and for how long.
+type Config struct {
+	// Paths to cache, in MatchPath syntax.
+	Paths []string `yaml:"paths"`
+	// Methods to cache; default GET and HEAD. A HEAD is answered from a
+	// cached GET.
+	Methods  []string      `yaml:"methods,omitempty"`
+	TTL      time.Duration `yaml:"ttl,omitempty"`       // default 5m
+	MaxSize  int64         `yaml:"max_size,omitempty"`  // total bytes held; default 10MiB
+	MaxEntry int64         `yaml:"max_entry,omitempty"` // largest body cached; default 1MiB
+}
+
+// Cache holds a route's cached responses.
+type Cache struct {
+	cfg Config
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List // front = most recently used
+	size    int64
+	hits    int64
+	misses  int64
+}
+
+type entry struct {
+	key     string
+	header  http.Header
+	body    []byte
+	stored  time.Time
+	expires time.Time
+}
+
+// Stats summarises a cache for inspection.
+type Stats struct {
+	Entries int   `json:"entries"`
+	Bytes   int64 `json:"bytes"`
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+}
+
+// New creates an empty cache, filling in defaults.
+func New(cfg Config) *Cache {
+	methods := []string{http.MethodGet, http.MethodHead}
+	if len(cfg.Methods) > 0 {
+		methods = nil
+		for _, m := range cfg.Methods {
+			methods = append(methods, strings.ToUpper(m))
+		}
+	}
+	cfg.Methods = methods
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultTTL
+	}
+	if cfg.MaxSize <= 0 {
+		cfg.MaxSize = DefaultMaxSize
+	}
+	if cfg.MaxEntry <= 0 {
+		cfg.MaxEntry = DefaultMaxEntry
+	}
+	return &Cache{cfg: cfg, entries: make(map[string]*list.Element), lru: list.New()}
+}
+
+// Same reports whether other has the same settings, so a config reload can
+// keep the cached responses.
+func (c *Cache) Same(other *Cache) bool {
+	if other == nil {
+		return false
+	}
+	a, b := c.cfg, other.cfg
+	return slices.Equal(a.Paths, b.Paths) && slices.Equal(a.Methods, b.Methods) &&
+		a.TTL == b.TTL && a.MaxSize == b.MaxSize && a.MaxEntry == b.MaxEntry
+}
+
+// Config returns the cache's settings, with defaults filled in.
+func (c *Cache) Config() Config {
+	return c.cfg
+}
+
+// Stats returns the cache's current size and hit counts.
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Stats{Entries: len(c.entries), Bytes: c.size, Hits: c.hits, Misses: c.misses}
+}
+
+// MatchPath reports whether p matches any of patterns. A pattern ending in
+// "/" matches everything under it, one without a "/" matches the last path
+// element (e.g. "*.css"), and anything else is a path.Match glob against
+// the whole path.
+func MatchPath(patterns []string, p string) bool {
+	for _, pattern := range patterns {
+		switch {
+		case strings.HasSuffix(pattern, "/"):
+			if strings.HasPrefix(p, pattern) {
+				return true
+			}
+		case !strings.Contains(pattern, "/"):
+			if ok, _ := path.Match(pattern, path.Base(p)); ok {
+				return true
+			}
+		default:
+			if ok, _ := path.Match(pattern, p); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matches reports whether a request is one the cache handles. Requests
+// with credentials may get a response meant only for their user, so they
+// always go to the backend.
+func (c *Cache) matches(r *http.Request) bool {
+	if !slices.Contains(c.cfg.Methods, r.Method) || r.Header.Get("Range") != "" || r.Header.Get("Upgrade") != "" {
+		return false
+	}
+	if r.Header.Get("Authorization") != "" || r.Header.Get("Cookie") != "" {
+		return false
+	}
+	return MatchPath(c.cfg.Paths, r.URL.Path)
+}
+
+// key identifies a response. HEAD shares GET's entry.
+func key(r *http.Request) string {
+	method := r.Method
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+	return method + " " + r.Host + r.URL.RequestURI()
+}
+
+// Has reports whether Serve would answer r, without counting a hit or miss.
+func (c *Cache) Has(r *http.Request) bool {
+	if !c.matches(r) {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key(r)]
+	return ok && !time.Now().After(el.Value.(*entry).expires)
+}
+
+// Serve answers r from the cache, reporting whether it could.
+func (c *Cache) Serve(w http.ResponseWriter, r *http.Request) bool {
+	if !c.matches(r) {
+		return false
+	}
+	k := key(r)
+	now := time.Now()
+	c.mu.Lock()
+	el, ok := c.entries[k]
+	if ok && now.After(el.Value.(*entry).expires) {
+		c.removeLocked(el)
+		ok = false
+	}
+	if !ok {
+		c.misses++
+		c.mu.Unlock()
+		return false
+	}
+	c.hits++
+	c.lru.MoveToFront(el)
+	e := el.Value.(*entry)
+	c.mu.Unlock()
+
+	h := w.Header()
+	for k, v := range e.header {
+		h[k] = v
+	}
+	h.Set("Age", strconv.Itoa(int(now.Sub(e.stored)/time.Second)))
+	h.Set("X-Cache", "HIT")
+	h.Set("Content-Length", strconv.Itoa(len(e.body)))
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(e.body)
+	}
+	return true
+}
+
+// Record returns a writer that passes the response through and, if it is
+// cacheable, stores it. Call the returned func once the response is done.
+func (c *Cache) Record(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, func()) {
+	if !c.matches(r) || r.Method == http.MethodHead {
+		return w, func() {}
+	}
+	w.Header().Set("X-Cache", "MISS")
+	rec := &recorder{ResponseWriter: w, limit: c.cfg.MaxEntry}
+	return rec, func() {
+		if rec.cacheable() {
+			c.store(key(r), rec.header, rec.buf.Bytes())
+		}
+	}
+}
+
+func (c *Cache) store(key string, header http.Header, body []byte) {
+	size := int64(len(body))
+	if size > c.cfg.MaxSize {
+		return
+	}
+	now := time.Now()
+	e := &entry{key: key, header: header, body: body, stored: now, expires: now.Add(c.cfg.TTL)}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if old, ok := c.entries[key]; ok {
+		c.removeLocked(old)
+	}
+	c.entries[key] = c.lru.PushFront(e)
+	c.size += size
+	for c.size > c.cfg.MaxSize {
+		c.removeLocked(c.lru.Back())
+	}
+}
+
+func (c *Cache) removeLocked(el *list.Element) {
+	e := c.lru.Remove(el).(*entry)
+	delete(c.entries, e.key)
+	c.size -= int64(len(e.body))
+}
+
+// recorder copies a response as it is written, giving up once the body
+// outgrows the entry limit.
+type recorder struct {
+	http.ResponseWriter
+	limit    int64
+	code     int
+	header   http.Header // snapshot when the headers were written
+	buf      bytes.Buffer
+	tooLarge bool
+}
+
+func (c *recorder) WriteHeader(code int) {
+	if c.code == 0 && code >= http.StatusOK {
+		c.code = code
+		c.header = c.Header().Clone()
+		c.header.Del("X-Cache")
+	}
+	c.ResponseWriter.WriteHeader(code)
+}
+
+func (c *recorder) Write(b []byte) (int, error) {
+	if c.code == 0 {
+		c.WriteHeader(http.StatusOK)
+	}
+	if !c.tooLarge {
+		if int64(c.buf.Len()+len(b)) > c.limit {
+			c.tooLarge = true
+			c.buf = bytes.Buffer{}
+		} else {
+			c.buf.Write(b)
+		}
+	}
+	return c.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (c *recorder) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// cacheable reports whether the recorded response may be stored and
+// shared between clients.
+func (c *recorder) cacheable() bool {
+	if c.code != http.StatusOK || c.tooLarge || c.header == nil {
+		return false
+	}
+	if c.header.Get("Set-Cookie") != "" || c.header.Get("Content-Encoding") != "" {
+		return false
+	}
+	// CORS headers naming one origin would be replayed to every other.
+	if o := c.header.Get("Access-Control-Allow-Origin"); o != "" && o != "*" {
+		return false
+	}
+	if n, err := strconv.Atoi(c.header.Get("Content-Length")); err == nil && n != c.buf.Len() {
+		return false // cut short
+	}
+	for _, v := range c.header.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" && !strings.EqualFold(name, "Accept-Encoding") {
+				return false
+			}
+		}
+	}
+	cc := strings.ToLower(strings.Join(c.header.Values("Cache-Control"), ","))
+	for _, directive := range []string{"no-store", "no-cache", "private"} {
+		if strings.Contains(cc, directive) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCacheMatches(t *testing.T) {
+	c := New(Config{Paths: []string{"/static/", "*.css", "/img/*.png"}})
+	for p, want := range map[string]bool{
+		"/static/app.js":     true,
+		"/a/b/site.css":      true,
+		"/img/logo.png":      true,
+		"/img/deep/logo.png": false,
+		"/api/chat":          false,
+	} {
+		if got := c.matches(httptest.NewRequest("GET", p, nil)); got != want {
+			t.Errorf("matches(%s) = %v, want %v", p, got, want)
+		}
+	}
+	if c.matches(httptest.NewRequest("POST", "/static/app.js", nil)) {
+		t.Error("POST should not be cached")
+	}
+	for _, h := range []string{"Authorization", "Cookie"} {
+		r := httptest.NewRequest("GET", "/static/app.js", nil)
+		r.Header.Set(h, "x")
+		if c.matches(r) {
+			t.Errorf("request with %s should bypass the cache", h)
+		}
+	}
+}
+
+func TestCacheEvictsAndExpires(t *testing.T) {
+	c := New(Config{Paths: []string{"/"}, MaxSize: 10, TTL: time.Minute})
+	c.store("a", http.Header{}, []byte("123456"))
+	c.store("b", http.Header{}, []byte("123456"))
+	if st := c.Stats(); st.Entries != 1 || st.Bytes != 6 {
+		t.Errorf("after overflow: %+v, want only the newest entry", st)
+	}
+
+	c = New(Config{Paths: []string{"/"}, TTL: time.Millisecond})
+	r := httptest.NewRequest("GET", "http://a.com/x", nil)
+	c.store(key(r), http.Header{}, []byte("x"))
+	time.Sleep(5 * time.Millisecond)
+	if c.Serve(httptest.NewRecorder(), r) {
+		t.Error("expired entry was served")
+	}
+}
+
+func TestCacheSkipsOversizedBodies(t *testing.T) {
+	c := New(Config{Paths: []string{"/"}, MaxEntry: 4})
+	r := httptest.NewRequest("GET", "http://a.com/big", nil)
+	w, store := c.Record(httptest.NewRecorder(), r)
+	w.Write([]byte(strings.Repeat("x", 10)))
+	store()
+	if c.Stats().Entries != 0 {
+		t.Error("body over max_entry was cached")
+	}
+}
+
+func TestCacheSkipsPerClientResponses(t *testing.T) {
+	for name, header := range map[string]http.Header{
+		"set-cookie":     {"Set-Cookie": {"session=1"}},
+		"private":        {"Cache-Control": {"private, max-age=60"}},
+		"no-store":       {"Cache-Control": {"no-store"}},
+		"one origin":     {"Access-Control-Allow-Origin": {"https://app.example.com"}},
+		"vary on origin": {"Vary": {"Origin"}},
+	} {
+		c := New(Config{Paths: []string{"/"}})
+		w, store := c.Record(httptest.NewRecorder(), httptest.NewRequest("GET", "http://a.com/x", nil))
+		for k, v := range header {
+			w.Header()[k] = v
+		}
+		w.Write([]byte("x"))
+		store()
+		if c.Stats().Entries != 0 {
+			t.Errorf("%s: response was cached", name)
+		}
+	}
+
+	c := New(Config{Paths: []string{"/"}})
+	w, store := c.Record(httptest.NewRecorder(), httptest.NewRequest("GET", "http://a.com/x", nil))
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Write([]byte("x"))
+	store()
+	if c.Stats().Entries != 1 {
+		t.Error("response open to any origin was not cached")
+	}
+}
@@ -0,0 +1,198 @@
+// Package clock lets code that waits on time be driven by a virtual clock.
+// Production code uses Real; tests and simulations use a Fake and advance it
+// instead of sleeping.
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock tells the time and makes timers.
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	Until(t time.Time) time.Duration
+	// After returns a channel that receives the time once d has passed.
+	After(d time.Duration) <-chan time.Time
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer is a one-shot timer, like time.Timer.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// Ticker fires periodically, like time.Ticker.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Real is the system clock.
+var Real Clock = realClock{}
+
+// Or returns c, or Real if c is nil.
+func Or(c Clock) Clock {
+	if c == nil {
+		return Real
+	}
+	return c
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) Since(t time.Time) time.Duration        { return time.Since(t) }
+func (realClock) Until(t time.Time) time.Duration        { return time.Until(t) }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) NewTimer(d time.Duration) Timer         { return realTimer{time.NewTimer(d)} }
+func (realClock) NewTicker(d time.Duration) Ticker       { return realTicker{time.NewTicker(d)} }
+
+type realTimer struct{ t *time.Timer }
+
+func (t realTimer) C() <-chan time.Time        { return t.t.C }
+func (t realTimer) Stop() bool                 { return t.t.Stop() }
+func (t realTimer) Reset(d time.Duration) bool { return t.t.Reset(d) }
+
+type realTicker struct{ t *time.Ticker }
+
+func (t realTicker) C() <-chan time.Time { return t.t.C }
+func (t realTicker) Stop()               { t.t.Stop() }
+
+// Fake is a clock that only moves when told to. Timers and tickers fire
+// during Advance, in order of their deadlines.
+type Fake struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters map[*fakeTimer]struct{}
+}
+
+// NewFake creates a fake clock reading start.
+func NewFake(start time.Time) *Fake {
+	f := &Fake{now: start, waiters: make(map[*fakeTimer]struct{})}
+	f.cond = sync.NewCond(&f.mu)
+	return f
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *Fake) Since(t time.Time) time.Duration { return f.Now().Sub(t) }
+func (f *Fake) Until(t time.Time) time.Duration { return t.Sub(f.Now()) }
+
+func (f *Fake) After(d time.Duration) <-chan time.Time { return f.NewTimer(d).C() }
+
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	t := &fakeTimer{f: f, c: make(chan time.Time, 1)}
+	t.Reset(d)
+	return t
+}
+
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	t := &fakeTimer{f: f, c: make(chan time.Time, 1), period: d}
+	t.Reset(d)
+	return fakeTicker{t}
+}
+
+// Advance moves the clock forward by d, firing every timer that comes due
+// on the way.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	end := f.now.Add(d)
+	for {
+		var due []*fakeTimer
+		for t := range f.waiters {
+			if !t.when.After(end) {
+				due = append(due, t)
+			}
+		}
+		if len(due) == 0 {
+			break
+		}
+		sort.Slice(due, func(i, j int) bool { return due[i].when.Before(due[j].when) })
+		t := due[0]
+		if t.when.After(f.now) {
+			f.now = t.when
+		}
+		select {
+		case t.c <- f.now:
+		default: // like the runtime, a ticker drops ticks nobody reads
+		}
+		if t.period > 0 {
+			t.when = t.when.Add(t.period)
+		} else {
+			delete(f.waiters, t)
+		}
+	}
+	f.now = end
+}
+
+// BlockUntil waits until at least n timers or tickers are pending, so a
+// test knows the code under test is waiting before it advances the clock.
+func (f *Fake) BlockUntil(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for len(f.waiters) < n {
+		f.cond.Wait()
+	}
+}
+
+// Pending returns the number of timers and tickers waiting to fire.
+func (f *Fake) Pending() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.waiters)
+}
+
+type fakeTimer struct {
+	f      *Fake
+	c      chan time.Time
+	when   time.Time
+	period time.Duration // tickers only
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.c }
+
+func (t *fakeTimer) Stop() bool {
+	t.f.mu.Lock()
+	defer t.f.mu.Unlock()
+	_, active := t.f.waiters[t]
+	delete(t.f.waiters, t)
+	return active
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.f.mu.Lock()
+	defer t.f.mu.Unlock()
+	_, active := t.f.waiters[t]
+	if d <= 0 && t.period == 0 {
+		delete(t.f.waiters, t)
+		select {
+		case t.c <- t.f.now:
+		default:
+		}
+		return active
+	}
+	t.when = t.f.now.Add(d)
+	t.f.waiters[t] = struct{}{}
+	t.f.cond.Broadcast()
+	return active
+}
+
+type fakeTicker struct{ t *fakeTimer }
+
+func (t fakeTicker) C() <-chan time.Time { return t.t.c }
+func (t fakeTicker) Stop()               { t.t.Stop() }
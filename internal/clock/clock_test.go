@@ -0,0 +1,125 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func fired(c <-chan time.Time) (time.Time, bool) {
+	select {
+	case t := <-c:
+		return t, true
+	default:
+		return time.Time{}, false
+	}
+}
+
+func TestFakeTimersFireInOrder(t *testing.T) {
+	clk := NewFake(epoch)
+	late := clk.NewTimer(2 * time.Minute)
+	early := clk.NewTimer(time.Minute)
+
+	clk.Advance(30 * time.Second)
+	if _, ok := fired(early.C()); ok {
+		t.Fatal("timer fired early")
+	}
+
+	clk.Advance(5 * time.Minute)
+	at, ok := fired(early.C())
+	if !ok || !at.Equal(epoch.Add(time.Minute)) {
+		t.Errorf("early fired at %v (%v), want %v", at, ok, epoch.Add(time.Minute))
+	}
+	at, ok = fired(late.C())
+	if !ok || !at.Equal(epoch.Add(2*time.Minute)) {
+		t.Errorf("late fired at %v (%v), want %v", at, ok, epoch.Add(2*time.Minute))
+	}
+	if got := clk.Now(); !got.Equal(epoch.Add(5*time.Minute + 30*time.Second)) {
+		t.Errorf("Now() = %v", got)
+	}
+	if clk.Pending() != 0 {
+		t.Errorf("Pending() = %d, want 0", clk.Pending())
+	}
+}
+
+func TestFakeTimerStopAndReset(t *testing.T) {
+	clk := NewFake(epoch)
+	tm := clk.NewTimer(time.Minute)
+	if !tm.Stop() {
+		t.Error("Stop() on a pending timer = false")
+	}
+	clk.Advance(time.Hour)
+	if _, ok := fired(tm.C()); ok {
+		t.Error("stopped timer fired")
+	}
+
+	if tm.Reset(time.Minute) {
+		t.Error("Reset() on a stopped timer = true")
+	}
+	clk.Advance(time.Minute)
+	if _, ok := fired(tm.C()); !ok {
+		t.Error("reset timer didn't fire")
+	}
+
+	tm.Reset(0)
+	if _, ok := fired(tm.C()); !ok {
+		t.Error("Reset(0) didn't fire immediately")
+	}
+}
+
+func TestFakeTickerRearms(t *testing.T) {
+	clk := NewFake(epoch)
+	tk := clk.NewTicker(time.Second)
+	for i := 1; i <= 3; i++ {
+		clk.Advance(time.Second)
+		at, ok := fired(tk.C())
+		if !ok || !at.Equal(epoch.Add(time.Duration(i)*time.Second)) {
+			t.Fatalf("tick %d at %v (%v)", i, at, ok)
+		}
+	}
+
+	// Unread ticks are dropped rather than queued.
+	clk.Advance(10 * time.Second)
+	if _, ok := fired(tk.C()); !ok {
+		t.Error("no tick after advancing 10s")
+	}
+	if _, ok := fired(tk.C()); ok {
+		t.Error("ticker queued more than one tick")
+	}
+
+	tk.Stop()
+	clk.Advance(time.Minute)
+	if _, ok := fired(tk.C()); ok {
+		t.Error("stopped ticker ticked")
+	}
+}
+
+func TestFakeBlockUntil(t *testing.T) {
+	clk := NewFake(epoch)
+	done := make(chan time.Time)
+	go func() {
+		done <- <-clk.After(time.Hour)
+	}()
+
+	clk.BlockUntil(1)
+	clk.Advance(time.Hour)
+	select {
+	case at := <-done:
+		if !at.Equal(epoch.Add(time.Hour)) {
+			t.Errorf("After fired at %v", at)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("After didn't fire")
+	}
+}
+
+func TestOr(t *testing.T) {
+	if Or(nil) != Real {
+		t.Error("Or(nil) isn't Real")
+	}
+	clk := NewFake(epoch)
+	if Or(clk) != Clock(clk) {
+		t.Error("Or(clk) isn't clk")
+	}
+}
@@ -1,47 +1,202 @@
 package config
 
 import (
+	"fmt"
+	"io"
+	"net"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
 	"time"
 
 	"gopkg.in/yaml.v3"
+
+	"warren/internal/auth"
+	"warren/internal/cache"
+	"warren/internal/cors"
+	"warren/internal/headers"
+	"warren/internal/human"
+	"warren/internal/openclaw"
+	"warren/internal/redirect"
 )
 
 type Config struct {
-	Listen         string            `yaml:"listen"`
-	AdminListen    string            `yaml:"admin_listen"` // e.g. ":9090", empty = disabled
-	AdminToken     string            `yaml:"admin_token"`  // bearer token for admin API auth
-	ProxyToken     string            `yaml:"proxy_token"`  // bearer token for proxy port auth
-	DatabaseURL    string            `yaml:"database_url"`
-	Defaults       Defaults          `yaml:"defaults"`
-	Agents         map[string]*Agent `yaml:"agents"`
-	Webhooks       []WebhookConfig   `yaml:"webhooks"`
-	MaxReadyAgents int               `yaml:"max_ready_agents"` // 0 = unlimited
-	Hermes         HermesConfig      `yaml:"hermes"`
-	Alexandria     AlexandriaConfig  `yaml:"alexandria"`
-	SSH            SSHConfig         `yaml:"ssh"`
-Usage          UsageConfig       `yaml:"usage"`
-	PicoClaw       PicoClawConfig    `yaml:"picoclaw"`
+	Listen              string              `yaml:"listen"`
+	TLSListen           string              `yaml:"tls_listen"`       // e.g. ":443"; routes TLS by SNI to agents with tls_passthrough, empty = disabled
+	AdminListen         string              `yaml:"admin_listen"`     // e.g. ":9090", empty = disabled
+	ServiceAPI          ServiceAPIConfig    `yaml:"service_api"`      // listener for agents registering services, apart from the admin API
+	HTTP3               HTTP3Config         `yaml:"http3"`            // HTTPS and HTTP/3 listener for clients reaching Warren directly
+	AdminToken          string              `yaml:"admin_token"`      // bearer token for admin API auth
+	ProxyToken          string              `yaml:"proxy_token"`      // bearer token for proxy port auth
+	TrustedProxies      []string            `yaml:"trusted_proxies"`  // CIDRs or IPs whose forwarding headers are believed, e.g. Cloudflare's ranges
+	ClientIPHeader      string              `yaml:"client_ip_header"` // header trusted proxies put the client IP in; default X-Forwarded-For
+	DatabaseURL         string              `yaml:"database_url"`
+	DockerHost          string              `yaml:"docker_host"` // Docker endpoint, e.g. "npipe:////./pipe/docker_engine"; empty = DOCKER_HOST or the platform default
+	Defaults            Defaults            `yaml:"defaults"`
+	Agents              map[string]*Agent   `yaml:"agents"`
+	Services            map[string]*Service `yaml:"services,omitempty"` // hostname → dynamic service registered at startup, as POST /api/services would
+	Webhooks            []WebhookConfig     `yaml:"webhooks"`
+	Metrics             MetricsConfig       `yaml:"metrics"`
+	HeartbeatURL        string              `yaml:"heartbeat_url"`      // pinged while all agents are healthy, for dead-man's-switch monitors
+	HeartbeatInterval   human.Duration      `yaml:"heartbeat_interval"` // default: 1m
+	DNSCheck            DNSCheckConfig      `yaml:"dns_check"`          // warn when agent hostnames don't resolve to Warren
+	DNS                 DNSConfig           `yaml:"dns"`                // create and remove DNS records for routed hostnames
+	Bans                BansConfig          `yaml:"bans"`               // temporarily block client IPs after repeated auth failures or limit hits
+	MaxReadyAgents      int                 `yaml:"max_ready_agents"`   // 0 = unlimited
+	SplashTemplate      string              `yaml:"splash_template"`    // HTML template shown while agents wake; empty = built-in
+	ErrorPages          map[int]string      `yaml:"error_pages"`        // status (502, 503, 504) → HTML template shown to browsers instead of plain text
+	Redirects           []Redirect          `yaml:"redirects"`          // hostname aliases and moved paths, answered before routing
+	PortRange           string              `yaml:"port_range"`         // host ports for container.publish, e.g. "30000-30999"
+	Hermes              HermesConfig        `yaml:"hermes"`
+	Alexandria          AlexandriaConfig    `yaml:"alexandria"`
+	SSH                 SSHConfig           `yaml:"ssh"`
+	Usage               UsageConfig         `yaml:"usage"`
+	PicoClaw            PicoClawConfig      `yaml:"picoclaw"`
+	TrashRetention      human.Duration      `yaml:"trash_retention"`       // how long removed agents/services can be restored; default 24h, negative disables
+	UpgradeDrainTimeout human.Duration      `yaml:"upgrade_drain_timeout"` // how long the old process keeps serving its WebSockets after SIGUSR2; default 1h
+	MaxRequestBody      human.Size          `yaml:"max_request_body"`      // cap on admin and agent API request bodies, e.g. "1MiB"; default 1MiB
+	MaxProxyBody        human.Size          `yaml:"max_proxy_body"`        // cap on request bodies proxied to agents and services; 0 = no limit
+	ReplayBuffer        ReplayBufferConfig  `yaml:"replay_buffer"`         // where bodies of requests held by wake_hold are kept
+	Compress            bool                `yaml:"compress"`              // Brotli or gzip compressible responses for agents that don't set compress themselves
+	LowPower            bool                `yaml:"low_power"`             // smaller default workers, queues and buffers for Raspberry Pi class hosts
+	WebhookWorkers      int                 `yaml:"webhook_workers"`       // concurrent webhook deliveries; default: 5, or 1 with low_power
+	EventQueueSize      int                 `yaml:"event_queue_size"`      // events buffered for async dispatch; default: 4096, or 512 with low_power
+}
+
+// Service is a dynamic service kept in the config rather than registered by
+// an agent at runtime, e.g. one captured with warren export. It is
+// registered at startup, and again on reload when its settings change.
+type Service struct {
+	Target    string          `yaml:"target"`
+	Agent     string          `yaml:"agent,omitempty"`    // owning agent; the service is removed while it sleeps unless wake is set
+	Replicas  []string        `yaml:"replicas,omitempty"` // additional targets balanced with target
+	Balance   string          `yaml:"balance,omitempty"`
+	Weights   []int           `yaml:"weights,omitempty"` // per target, target first
+	Sticky    *Sticky         `yaml:"sticky,omitempty"`
+	Timeouts  *Timeouts       `yaml:"timeouts,omitempty"`
+	CORS      *CORS           `yaml:"cors,omitempty"`
+	Headers   *headers.Config `yaml:"headers,omitempty"`
+	BasicAuth *BasicAuth      `yaml:"basic_auth,omitempty"`
+	Cache     *Cache          `yaml:"cache,omitempty"`
+	Wake      bool            `yaml:"wake,omitempty"`     // keep the service while its agent sleeps, waking it on requests
+	MaxBody   human.Size      `yaml:"max_body,omitempty"` // overrides max_proxy_body for the service
+	Fallback  *Fallback       `yaml:"fallback,omitempty"`
+}
+
+// TrashedAgent is an agent removed through the admin API, kept with its full
+// definition so it can be restored until ExpiresAt. The admin server keeps
+// them in a file of their own, not in the config.
+type TrashedAgent struct {
+	Agent     *Agent    `yaml:"agent"`
+	RemovedAt time.Time `yaml:"removed_at"`
+	ExpiresAt time.Time `yaml:"expires_at"`
+}
+
+// DNSCheckConfig periodically resolves agent hostnames and flags those that
+// don't point at Warren.
+type DNSCheckConfig struct {
+	PublicIPs []string       `yaml:"public_ips"` // addresses or CIDRs hostnames should resolve into, e.g. Cloudflare's ranges behind a tunnel; empty = disabled
+	Interval  human.Duration `yaml:"interval"`   // default: 10m
+}
+
+// DNSConfig points DNS records for agent and dynamic service hostnames at
+// Warren through a DNS provider's API.
+type DNSConfig struct {
+	Provider     string         `yaml:"provider"`      // "cloudflare" or "route53"; empty = disabled
+	ManagedZones []string       `yaml:"managed_zones"` // zones Warren may change, e.g. "example.com"; hostnames elsewhere are left alone
+	Target       string         `yaml:"target"`        // address (A/AAAA records) or hostname (CNAME) records point at
+	TTL          human.Duration `yaml:"ttl"`           // default: 5m
+	DryRun       bool           `yaml:"dry_run"`       // log and emit the changes without making them
+	Cloudflare   CloudflareDNS  `yaml:"cloudflare"`
+	Route53      Route53DNS     `yaml:"route53"`
+}
+
+// CloudflareDNS holds the Cloudflare provider's settings.
+type CloudflareDNS struct {
+	APIToken string `yaml:"api_token"` // needs Zone.DNS edit; default: CLOUDFLARE_API_TOKEN
+	Proxied  bool   `yaml:"proxied"`   // proxy records through Cloudflare
+}
+
+// Route53DNS holds the Route 53 provider's credentials.
+type Route53DNS struct {
+	AccessKeyID     string `yaml:"access_key_id"`     // default: AWS_ACCESS_KEY_ID
+	SecretAccessKey string `yaml:"secret_access_key"` // default: AWS_SECRET_ACCESS_KEY
+	SessionToken    string `yaml:"session_token"`     // default: AWS_SESSION_TOKEN
+}
+
+// BansConfig bans client IPs that keep failing authentication or hitting
+// limits, fail2ban-style, for a while.
+type BansConfig struct {
+	Enabled    bool           `yaml:"enabled"`
+	MaxStrikes int            `yaml:"max_strikes"` // auth failures and limit hits within window that ban an address; default: 10
+	Window     human.Duration `yaml:"window"`      // default: 10m
+	Duration   human.Duration `yaml:"duration"`    // how long a ban lasts; default: 1h
+	Ignore     []string       `yaml:"ignore"`      // addresses or CIDRs never banned, e.g. your own network
+	File       string         `yaml:"file"`        // where bans survive restarts; default: warren-bans.json next to the config
+}
+
+// HTTP3Config serves the proxy over TLS on TCP (HTTP/1.1 and HTTP/2) and
+// QUIC on UDP (HTTP/3) at the same address. TCP responses carry Alt-Svc so
+// browsers switch to HTTP/3 on their next request.
+type HTTP3Config struct {
+	Listen   string `yaml:"listen"` // e.g. ":443"; empty = disabled
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+// ServiceAPIConfig serves the service registration API (/api/services) on a
+// listener of its own, so agent containers can register services without
+// being able to reach the admin port.
+type ServiceAPIConfig struct {
+	Listen   string   `yaml:"listen"`    // e.g. ":9443"; empty = disabled
+	CertFile string   `yaml:"cert_file"` // with key_file, serve HTTPS; empty = plain HTTP
+	KeyFile  string   `yaml:"key_file"`
+	Tokens   []string `yaml:"tokens"` // bearer tokens accepted; several let a token be rotated without downtime
+}
+
+// ReplayBufferConfig bounds the memory used by request bodies held while
+// agents wake. Past the limit, bodies spill to temp files in Dir, up to
+// Disk; requests that would go over it are refused.
+type ReplayBufferConfig struct {
+	Memory human.Size `yaml:"memory"` // default: 32MiB across all held requests
+	Disk   human.Size `yaml:"disk"`   // default: 1GiB across all held requests
+	Dir    string     `yaml:"dir"`    // default: the system temp directory
+}
+
+// MetricsConfig controls per-request metrics and access logging.
+type MetricsConfig struct {
+	Sampling  *float64 `yaml:"sampling,omitempty"` // fraction of requests in the latency histogram and access log, e.g. 0.1; default: 1 (all), or 0.1 with low_power
+	AccessLog bool     `yaml:"access_log"`         // log each (sampled) proxied request
+}
+
+// SampleRate returns the sampling fraction. 0, like unset, records every
+// request.
+func (m MetricsConfig) SampleRate() float64 {
+	if m.Sampling == nil {
+		return 0
+	}
+	return *m.Sampling
 }
 
 type UsageConfig struct {
-	Enabled       bool          `yaml:"enabled"`
-	JSONLPath     string        `yaml:"jsonl_path"`
-	FlushInterval time.Duration `yaml:"flush_interval"`
-	PollInterval  time.Duration `yaml:"poll_interval"`
+	Enabled       bool           `yaml:"enabled"`
+	JSONLPath     string         `yaml:"jsonl_path"`
+	FlushInterval human.Duration `yaml:"flush_interval"`
+	PollInterval  human.Duration `yaml:"poll_interval"`
 }
 
 type PicoClawConfig struct {
-	Binary         string        `yaml:"binary"`           // default: "picoclaw"
-	MissionBaseDir string        `yaml:"mission_base_dir"` // default: "/tmp/picoclaw-missions"
-	DefaultTimeout time.Duration `yaml:"default_timeout"`  // default: 5m
-	MaxConcurrent  int           `yaml:"max_concurrent"`   // default: 20
+	Binary         string         `yaml:"binary"`           // default: "picoclaw"
+	MissionBaseDir string         `yaml:"mission_base_dir"` // default: "picoclaw-missions" in the system temp directory
+	DefaultTimeout human.Duration `yaml:"default_timeout"`  // default: 5m
+	MaxConcurrent  int            `yaml:"max_concurrent"`   // default: 20
 }
 
 type AlexandriaConfig struct {
-	Enabled bool          `yaml:"enabled"`
-	URL     string        `yaml:"url"`
-	Timeout time.Duration `yaml:"timeout"`
+	Enabled bool           `yaml:"enabled"`
+	URL     string         `yaml:"url"`
+	Timeout human.Duration `yaml:"timeout"`
 }
 
 type SSHConfig struct {
@@ -51,12 +206,12 @@ type SSHConfig struct {
 }
 
 type HermesConfig struct {
-	Enabled        bool          `yaml:"enabled"`
-	URL            string        `yaml:"url"`
-	Token          string        `yaml:"token"`
-	ConnectTimeout time.Duration `yaml:"connect_timeout"`
-	ReconnectWait  time.Duration `yaml:"reconnect_wait"`
-	MaxReconnects  int           `yaml:"max_reconnects"`
+	Enabled        bool           `yaml:"enabled"`
+	URL            string         `yaml:"url"`
+	Token          string         `yaml:"token"`
+	ConnectTimeout human.Duration `yaml:"connect_timeout"`
+	ReconnectWait  human.Duration `yaml:"reconnect_wait"`
+	MaxReconnects  int            `yaml:"max_reconnects"`
 }
 
 type WebhookConfig struct {
@@ -66,7 +221,7 @@ type WebhookConfig struct {
 }
 
 type Defaults struct {
-	HealthCheckInterval time.Duration `yaml:"health_check_interval"`
+	HealthCheckInterval human.Duration `yaml:"health_check_interval"`
 }
 
 type AgentHermes struct {
@@ -74,33 +229,307 @@ type AgentHermes struct {
 }
 
 type Agent struct {
-	Hermes    AgentHermes `yaml:"hermes"`
-	Hostname  string   `yaml:"hostname"`
-	Hostnames []string `yaml:"hostnames"` // additional hostnames
-	Backend   string   `yaml:"backend"`
-	Policy    string    `yaml:"policy"`
-	Container Container `yaml:"container"`
-	Health    Health    `yaml:"health"`
-	Idle      IdleConfig `yaml:"idle"`
+	Hermes          AgentHermes       `yaml:"hermes"`
+	Annotations     map[string]string `yaml:"annotations,omitempty"` // operator notes such as owner or on-call context; shown by the CLI, not used by Warren
+	Labels          map[string]string `yaml:"labels,omitempty"`      // e.g. env: staging; selects groups of agents for bulk wake and sleep. Not the container's Docker labels
+	Hostname        string            `yaml:"hostname"`
+	Hostnames       []string          `yaml:"hostnames"` // additional hostnames
+	Backend         string            `yaml:"backend"`
+	Replicas        []string          `yaml:"replicas,omitempty"`         // additional backend URLs balanced with backend
+	Balance         string            `yaml:"balance,omitempty"`          // "round-robin" (default) or "least-connections"
+	Sticky          *Sticky           `yaml:"sticky,omitempty"`           // cookie-based session affinity across replicas
+	CircuitBreaker  *CircuitBreaker   `yaml:"circuit_breaker,omitempty"`  // fail fast while the backend is erroring
+	SLA             *SLA              `yaml:"sla,omitempty"`              // emit agent.sla_breach when availability over a window falls below a target
+	Retry           *Retry            `yaml:"retry,omitempty"`            // re-send GET/HEAD requests that hit a connection error
+	Timeouts        *Timeouts         `yaml:"timeouts,omitempty"`         // proxy transport timeouts; unset fields keep Go's defaults
+	BackendProtocol string            `yaml:"backend_protocol,omitempty"` // "http1", "http2" or "h2c"; default: HTTP/2 when an https backend offers it
+	GRPC            bool              `yaml:"grpc,omitempty"`             // backend serves gRPC: spoken to over HTTP/2 (h2c for http backends), with calls kept open counted as connections
+	MaxBody         human.Size        `yaml:"max_body,omitempty"`         // overrides max_proxy_body for this agent's hostnames
+	MaxWebSockets   int               `yaml:"max_websockets,omitempty"`   // concurrent WebSocket connections across the agent's hostnames; 0 = unlimited
+	CORS            *CORS             `yaml:"cors,omitempty"`             // answer cross-origin browser requests at the proxy
+	Headers         *headers.Config   `yaml:"headers,omitempty"`          // set or remove request headers toward the backend and response headers toward clients
+	Compress        *bool             `yaml:"compress,omitempty"`         // Brotli or gzip compressible responses; default: top-level compress
+	Cache           *Cache            `yaml:"cache,omitempty"`            // serve matching responses from memory without waking the agent
+	AllowedPaths    []string          `yaml:"allowed_paths,omitempty"`    // only these paths reach the agent, in cache.paths syntax; others get 404 without waking it
+	ForceHTTPS      bool              `yaml:"force_https,omitempty"`      // redirect plain-HTTP requests for the agent's hostnames to HTTPS
+	WakeHold        human.Duration    `yaml:"wake_hold,omitempty"`        // hold non-browser requests while the agent wakes, up to this long, instead of a 503
+	Wake            *Wake             `yaml:"wake,omitempty"`             // on-demand only; limits on how often the agent is woken
+	DependsOn       []string          `yaml:"depends_on,omitempty"`       // on-demand only; agents woken, and waited for, before this one starts and kept awake while it is
+	Policy          string            `yaml:"policy"`
+	Container       Container         `yaml:"container"`
+	Health          Health            `yaml:"health"`
+	Idle            IdleConfig        `yaml:"idle"`
+	Sleep           SleepConfig       `yaml:"sleep"`
+	BasicAuth       *BasicAuth        `yaml:"basic_auth,omitempty"`
+	ForwardAuth     *ForwardAuth      `yaml:"forward_auth,omitempty"`
+	AgentToken      string            `yaml:"agent_token,omitempty"`     // bearer token for the agent-side /api/agents/{name} API
+	SplashTemplate  string            `yaml:"splash_template,omitempty"` // overrides the top-level splash_template
+	ErrorPages      map[int]string    `yaml:"error_pages,omitempty"`     // overrides the top-level error_pages, status by status
+	OpenClaw        *AgentOpenClaw    `yaml:"openclaw,omitempty"`
+	Ports           []Port            `yaml:"ports,omitempty"`           // raw ports forwarded to the backend host
+	TLSPassthrough  *TLSPassthrough   `yaml:"tls_passthrough,omitempty"` // route TLS for the agent's hostnames on tls_listen to the backend host untouched
+}
+
+// Wake limits how often an on-demand agent is woken.
+type Wake struct {
+	Budget *WakeBudget `yaml:"budget,omitempty"`
+}
+
+// WakeBudget caps an agent's cold starts per day, so a misbehaving client
+// or crawler can't run up the bill on metered infrastructure.
+type WakeBudget struct {
+	MaxPerDay int    `yaml:"max_per_day"`
+	Action    string `yaml:"action"` // "block" (default): refuse further wakes that day; "alert": emit an event and wake anyway
+}
+
+// TLSPassthrough sends TLS connections for an agent's hostnames, arriving on
+// tls_listen, to the backend host without terminating them, for agents that
+// manage their own certificates.
+type TLSPassthrough struct {
+	Port        int            `yaml:"port"`         // backend port; default: 443
+	WakeTimeout human.Duration `yaml:"wake_timeout"` // default: health.startup_timeout
+}
+
+// Port forwards a raw port to the agent's backend host. Connections wake the
+// agent and are held until it is ready.
+type Port struct {
+	Proto       string         `yaml:"proto"`        // "tcp" (default) or "udp"
+	Listen      int            `yaml:"listen"`       // port Warren listens on
+	Target      int            `yaml:"target"`       // backend port; default: listen
+	WakeTimeout human.Duration `yaml:"wake_timeout"` // default: health.startup_timeout
+}
+
+// AgentOpenClaw configures the OpenClaw integration for an agent.
+type AgentOpenClaw struct {
+	Config       string         `yaml:"config"`        // path to openclaw.json; derives backend/health.url when unset
+	SessionsURL  string         `yaml:"sessions_url"`  // default: gateway /api/sessions
+	Token        string         `yaml:"token"`         // gateway bearer token for the sessions endpoint
+	PollInterval human.Duration `yaml:"poll_interval"` // default: 30s
+	ActiveWindow human.Duration `yaml:"active_window"` // default: 5m
+}
+
+// BasicAuth gates an agent's hostnames behind HTTP basic auth. Both use the
+// Authorization header, so it takes the place of proxy_token there; with a
+// proxy_token set, ReplaceProxyToken must say so explicitly.
+type BasicAuth struct {
+	Realm             string   `yaml:"realm"`
+	Users             []string `yaml:"users"`                         // htpasswd-style "user:bcrypt-hash" entries
+	UsersFile         string   `yaml:"users_file"`                    // path to an htpasswd file (bcrypt only)
+	ReplaceProxyToken bool     `yaml:"replace_proxy_token,omitempty"` // confirms these hostnames skip proxy_token
+}
+
+// Entries returns the inline users followed by any read from UsersFile.
+func (b *BasicAuth) Entries() ([]string, error) {
+	entries := append([]string{}, b.Users...)
+	if b.UsersFile != "" {
+		lines, err := auth.LoadHtpasswd(b.UsersFile)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, lines...)
+	}
+	return entries, nil
+}
+
+// Sticky pins each client to one of an agent's replicas with a cookie.
+type Sticky struct {
+	Cookie string         `yaml:"cookie"` // default: warren_backend
+	TTL    human.Duration `yaml:"ttl"`    // default: 1h
+}
+
+// Fallback says how a service answers when its target can't be reached:
+// retries, then waking its agent, then URL, then Page.
+type Fallback struct {
+	Retries int    `yaml:"retries,omitempty"` // retries of GET and HEAD requests after a connection error; up to 10
+	Wake    bool   `yaml:"wake,omitempty"`    // wake the owning agent, hold the request until it's ready and try again
+	URL     string `yaml:"url,omitempty"`     // alternative target
+	Page    string `yaml:"page,omitempty"`    // HTML served with 502 when nothing else worked
+}
+
+// CircuitBreaker opens an agent's circuit, failing requests fast with 503,
+// once its backend's error rate reaches Threshold, and lets a probe through
+// every OpenFor to test recovery.
+type CircuitBreaker struct {
+	Threshold   float64        `yaml:"threshold"`    // error rate that opens the circuit, e.g. 0.5
+	MinRequests int            `yaml:"min_requests"` // default: 10
+	Window      human.Duration `yaml:"window"`       // default: 30s
+	OpenFor     human.Duration `yaml:"open_for"`     // default: 15s
+}
+
+// SLA is an agent's availability target: the share of Window it must not
+// spend degraded or crash-looping.
+type SLA struct {
+	Target float64        `yaml:"target"` // percent, e.g. 99.5
+	Window human.Duration `yaml:"window"` // rolling; default: 24h
+}
+
+// Retry re-sends GET and HEAD requests that fail to connect to the backend,
+// as happens briefly after a wake, before the client sees a 502.
+type Retry struct {
+	Attempts int            `yaml:"attempts"` // retries after the first try; default: 2
+	Delay    human.Duration `yaml:"delay"`    // pause between tries; default: 250ms
+}
+
+// Timeouts overrides the proxy's transport timeouts for an agent's backend.
+// Streaming LLM agents may take minutes to send response headers.
+type Timeouts struct {
+	Dial           human.Duration `yaml:"dial"`            // connecting to the backend; default: 30s
+	ResponseHeader human.Duration `yaml:"response_header"` // waiting for response headers; default: no limit
+	Idle           human.Duration `yaml:"idle"`            // keep-alive connection reuse; default: 90s
+}
+
+// Cache keeps an agent's or service's static responses in memory, so
+// they're served without waking it or waiting on a slow backend.
+type Cache struct {
+	Paths    []string       `yaml:"paths"`     // e.g. /static/, *.css, /favicon.ico
+	Methods  []string       `yaml:"methods"`   // GET and/or HEAD; default both
+	TTL      human.Duration `yaml:"ttl"`       // default: 5m
+	MaxSize  human.Size     `yaml:"max_size"`  // total cached bytes; default: 10MiB
+	MaxEntry human.Size     `yaml:"max_entry"` // largest response cached; default: 1MiB
+}
+
+// New creates an empty cache with these settings.
+func (c *Cache) New() *cache.Cache {
+	return cache.New(cache.Config{
+		Paths:    c.Paths,
+		Methods:  c.Methods,
+		TTL:      time.Duration(c.TTL),
+		MaxSize:  int64(c.MaxSize),
+		MaxEntry: int64(c.MaxEntry),
+	})
+}
+
+// Redirect sends requests for a hostname, or a path on it, elsewhere.
+type Redirect struct {
+	From string `yaml:"from"` // "www.example.com", "example.com/old" or "example.com/docs/*"
+	To   string `yaml:"to"`   // a hostname, a path on the same host or an http(s) URL
+	Code int    `yaml:"code"` // 301 (default), 302, 307 or 308
+}
+
+// RedirectTable builds the proxy's redirect rules from the top-level
+// redirects and the hostnames of agents with force_https.
+func (c *Config) RedirectTable() (*redirect.Table, error) {
+	rules := make([]redirect.Rule, len(c.Redirects))
+	for i, r := range c.Redirects {
+		rules[i] = redirect.Rule{From: r.From, To: r.To, Code: r.Code}
+	}
+	var https []string
+	for _, agent := range c.Agents {
+		if agent.ForceHTTPS {
+			https = append(https, agent.Hostname)
+			https = append(https, agent.Hostnames...)
+		}
+	}
+	return redirect.New(rules, https)
+}
+
+// CORS lets browser frontends on other origins call an agent's hostnames.
+// Warren answers preflights itself and sets the response headers, replacing
+// any the backend sends.
+type CORS struct {
+	Origins       []string       `yaml:"origins"`        // e.g. https://app.example.com, https://*.example.com or *
+	Methods       []string       `yaml:"methods"`        // default: GET, HEAD, POST
+	Headers       []string       `yaml:"headers"`        // request headers allowed; * for any
+	ExposeHeaders []string       `yaml:"expose_headers"` // response headers scripts may read
+	Credentials   bool           `yaml:"credentials"`    // allow cookies and Authorization; not with origin *
+	MaxAge        human.Duration `yaml:"max_age"`        // how long browsers cache preflights
+}
+
+// Policy builds the proxy's CORS policy from the config.
+func (c *CORS) Policy() (*cors.Policy, error) {
+	return cors.New(cors.Config{
+		Origins:       c.Origins,
+		Methods:       c.Methods,
+		Headers:       c.Headers,
+		ExposeHeaders: c.ExposeHeaders,
+		Credentials:   c.Credentials,
+		MaxAge:        time.Duration(c.MaxAge),
+	})
+}
+
+// ForwardAuth delegates authentication of an agent's hostnames to an
+// external service such as oauth2-proxy. A 2xx reply admits the request.
+type ForwardAuth struct {
+	Address             string         `yaml:"address"`
+	AuthRequestHeaders  []string       `yaml:"auth_request_headers"`  // default: all request headers
+	AuthResponseHeaders []string       `yaml:"auth_response_headers"` // identity headers passed to the backend
+	Timeout             human.Duration `yaml:"timeout"`               // default: 5s
 }
 
 type IdleConfig struct {
-	Timeout      time.Duration `yaml:"timeout"`
-	DrainTimeout time.Duration `yaml:"drain_timeout"`
-	WakeCooldown time.Duration `yaml:"wake_cooldown"`
+	Mode              string         `yaml:"mode"` // on-demand only; "stop" (default) or "pause"
+	Timeout           human.Duration `yaml:"timeout"`
+	DrainTimeout      human.Duration `yaml:"drain_timeout"`
+	WakeCooldown      human.Duration `yaml:"wake_cooldown"`
+	MaxUptime         human.Duration `yaml:"max_uptime"`           // on-demand only; 0 = never force a recycle
+	PredictiveWake    bool           `yaml:"predictive_wake"`      // on-demand only; wake ahead of usual busy hours
+	PredictiveLead    human.Duration `yaml:"predictive_lead"`      // default: 5m
+	CPUThreshold      float64        `yaml:"cpu_threshold"`        // on-demand only; percent of one core that counts as activity, 0 = off
+	CPUSampleInterval human.Duration `yaml:"cpu_sample_interval"`  // default: 30s
+	WebSocketTimeout  human.Duration `yaml:"websocket_timeout"`    // on-demand only; WebSockets without data frames this long stop counting, 0 = any open one counts
+	Activity          ActivityConfig `yaml:"activity"`             // on-demand only
+	Prometheus        *PromActivity  `yaml:"prometheus,omitempty"` // on-demand only; PromQL query that counts as activity
+}
+
+// PromActivity is a PromQL query evaluated while the agent is ready. A
+// non-zero result counts as activity.
+type PromActivity struct {
+	URL      string         `yaml:"url"` // Prometheus base URL
+	Query    string         `yaml:"query"`
+	Interval human.Duration `yaml:"interval"` // default: 30s
+}
+
+// ActivityConfig selects which activity sources keep an on-demand agent awake
+// and how they combine.
+type ActivityConfig struct {
+	Mode    string   `yaml:"mode"`    // "any" (default) or "all"
+	Sources []string `yaml:"sources"` // requests, connections, cpu; default: requests, connections
+}
+
+// SleepConfig controls how an on-demand agent is put to sleep.
+type SleepConfig struct {
+	VetoURL   string         `yaml:"veto_url"`   // POSTed before idle sleep; non-200 defers sleep
+	VetoDefer human.Duration `yaml:"veto_defer"` // default: 5m
 }
 
 type Container struct {
-	Name   string            `yaml:"name"`
-	Labels map[string]string `yaml:"labels"`
+	Name        string            `yaml:"name"`
+	Labels      map[string]string `yaml:"labels"`
+	Publish     []Publish         `yaml:"publish,omitempty"`      // host ports Warren publishes on wake
+	MaxLifetime human.Duration    `yaml:"max_lifetime,omitempty"` // always-on only: gracefully restart once ready this long, one agent at a time; 0 = never
+}
+
+// Publish is a container port Warren publishes on the host when it starts the
+// service. A zero published port is allocated from the top-level port_range.
+type Publish struct {
+	Target    int    `yaml:"target"`
+	Published int    `yaml:"published"`
+	Protocol  string `yaml:"protocol"` // "tcp" (default) or "udp"
 }
 
 type Health struct {
-	URL                string        `yaml:"url"`
-	CheckInterval      time.Duration `yaml:"check_interval"`
-	StartupTimeout     time.Duration `yaml:"startup_timeout"`
-	MaxFailures        int           `yaml:"max_failures"`
-	MaxRestartAttempts int           `yaml:"max_restart_attempts"`
+	URL                string         `yaml:"url"`
+	CheckInterval      human.Duration `yaml:"check_interval"`
+	StartupTimeout     human.Duration `yaml:"startup_timeout"`
+	MaxFailures        int            `yaml:"max_failures"`
+	MaxRestartAttempts int            `yaml:"max_restart_attempts"`
+	CrashWindow        human.Duration `yaml:"crash_window"`
+	CrashLoopThreshold *int           `yaml:"crash_loop_threshold,omitempty"` // default: 3; 0 disables crash loop detection
+	RestartBackoff     human.Duration `yaml:"restart_backoff"`
+	MaxRestartBackoff  human.Duration `yaml:"max_restart_backoff"`
+	StartupProbe       human.Duration `yaml:"startup_probe"`
+	StartupProbeMax    human.Duration `yaml:"startup_probe_max"`
+	TCPPrecheck        bool           `yaml:"tcp_precheck"`
+	RestartOnDegraded  bool           `yaml:"restart_on_degraded"`
+	RestartCooldown    human.Duration `yaml:"restart_cooldown"`
+}
+
+// CrashLoop returns the crash loop threshold, 0 when detection is off.
+func (h Health) CrashLoop() int {
+	if h.CrashLoopThreshold == nil {
+		return 0
+	}
+	return *h.CrashLoopThreshold
 }
 
 // Save writes the config back to the given file path.
@@ -112,14 +541,31 @@ func Save(cfg *Config, path string) error {
 	return os.WriteFile(path, data, 0644)
 }
 
+// Load reads, decodes and validates the config file at path, within
+// DefaultLimits.
 func Load(path string) (*Config, error) {
-	data, err := os.ReadFile(path)
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, DefaultLimits.MaxBytes+1))
 	if err != nil {
 		return nil, err
 	}
+	return Parse(data, DefaultLimits)
+}
 
-	cfg := &Config{}
-	if err := yaml.Unmarshal(data, cfg); err != nil {
+// Parse decodes a config from data and validates it, as Load does for a
+// file. Agents' openclaw.json files and other paths the config names are
+// read from disk.
+func Parse(data []byte, limits Limits) (*Config, error) {
+	cfg, err := Decode(data, limits)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := applyOpenClaw(cfg); err != nil {
 		return nil, err
 	}
 
@@ -132,12 +578,86 @@ func Load(path string) (*Config, error) {
 	return cfg, nil
 }
 
+// Decode turns data into a Config without applying defaults, validating
+// or touching the filesystem. It enforces limits before decoding anything,
+// so it's safe to call on untrusted input.
+func Decode(data []byte, limits Limits) (*Config, error) {
+	if limits.MaxBytes > 0 && int64(len(data)) > limits.MaxBytes {
+		return nil, fmt.Errorf("config: larger than %d bytes", limits.MaxBytes)
+	}
+
+	// Decode via a node tree so the limits are checked before anything is
+	// built from it.
+	cfg := &Config{}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if err := limits.checkTree(&doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) > 0 {
+		if err := doc.Decode(cfg); err != nil {
+			return nil, err
+		}
+	}
+	if limits.MaxAgents > 0 && len(cfg.Agents) > limits.MaxAgents {
+		return nil, fmt.Errorf("config: %d agents, more than the limit of %d", len(cfg.Agents), limits.MaxAgents)
+	}
+	return cfg, nil
+}
+
+// applyPowerDefaults sizes worker pools, queues and buffers. With low_power
+// they shrink to suit a Raspberry Pi: one webhook sender, a smaller event
+// queue and replay buffer, and a sampled latency histogram. Explicit
+// settings always win.
+func applyPowerDefaults(cfg *Config) {
+	if !cfg.LowPower {
+		if cfg.WebhookWorkers == 0 {
+			cfg.WebhookWorkers = 5
+		}
+		if cfg.EventQueueSize == 0 {
+			cfg.EventQueueSize = 4096
+		}
+		return
+	}
+	if cfg.WebhookWorkers == 0 {
+		cfg.WebhookWorkers = 1
+	}
+	if cfg.EventQueueSize == 0 {
+		cfg.EventQueueSize = 512
+	}
+	if cfg.ReplayBuffer.Memory == 0 {
+		cfg.ReplayBuffer.Memory = 8 << 20
+	}
+	if cfg.Metrics.Sampling == nil {
+		sampling := 0.1
+		cfg.Metrics.Sampling = &sampling
+	}
+}
+
 func applyDefaults(cfg *Config) {
 	if cfg.Listen == "" {
 		cfg.Listen = ":8080"
 	}
 	if cfg.Defaults.HealthCheckInterval == 0 {
-		cfg.Defaults.HealthCheckInterval = 30 * time.Second
+		cfg.Defaults.HealthCheckInterval = human.Duration(30 * time.Second)
+	}
+	if cfg.PortRange == "" {
+		cfg.PortRange = "30000-30999"
+	}
+	applyPowerDefaults(cfg)
+	if cfg.HeartbeatURL != "" && cfg.HeartbeatInterval == 0 {
+		cfg.HeartbeatInterval = human.Duration(time.Minute)
+	}
+	if cfg.MaxRequestBody == 0 {
+		cfg.MaxRequestBody = 1 << 20
+	}
+	if cfg.TrashRetention == 0 {
+		cfg.TrashRetention = human.Duration(24 * time.Hour)
+	}
+	if cfg.UpgradeDrainTimeout == 0 {
+		cfg.UpgradeDrainTimeout = human.Duration(time.Hour)
 	}
 
 	// Database URL: env override takes precedence.
@@ -145,26 +665,48 @@ func applyDefaults(cfg *Config) {
 		cfg.DatabaseURL = envDB
 	}
 
+	// Service API token: env fallback, so it needn't sit in the config file.
+	if len(cfg.ServiceAPI.Tokens) == 0 {
+		if token := os.Getenv("WARREN_SERVICE_API_TOKEN"); token != "" {
+			cfg.ServiceAPI.Tokens = []string{token}
+		}
+	}
+
+	// DNS provider credentials: fall back to the providers' usual env vars.
+	switch cfg.DNS.Provider {
+	case "cloudflare":
+		if cfg.DNS.Cloudflare.APIToken == "" {
+			cfg.DNS.Cloudflare.APIToken = os.Getenv("CLOUDFLARE_API_TOKEN")
+		}
+	case "route53":
+		r := &cfg.DNS.Route53
+		if r.AccessKeyID == "" && r.SecretAccessKey == "" {
+			r.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+			r.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+			r.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+		}
+	}
+
 	// Usage tracking defaults.
 	if cfg.Usage.JSONLPath == "" {
 		home, _ := os.UserHomeDir()
 		cfg.Usage.JSONLPath = home + "/.openclaw/logs/anthropic-payload.jsonl"
 	}
 	if cfg.Usage.FlushInterval == 0 {
-		cfg.Usage.FlushInterval = 30 * time.Second
+		cfg.Usage.FlushInterval = human.Duration(30 * time.Second)
 	}
 	if cfg.Usage.PollInterval == 0 {
-		cfg.Usage.PollInterval = 5 * time.Second
+		cfg.Usage.PollInterval = human.Duration(5 * time.Second)
 	}
 
 	if cfg.Hermes.URL == "" {
 		cfg.Hermes.URL = "nats://localhost:4222"
 	}
 	if cfg.Hermes.ConnectTimeout == 0 {
-		cfg.Hermes.ConnectTimeout = 5 * time.Second
+		cfg.Hermes.ConnectTimeout = human.Duration(5 * time.Second)
 	}
 	if cfg.Hermes.ReconnectWait == 0 {
-		cfg.Hermes.ReconnectWait = 2 * time.Second
+		cfg.Hermes.ReconnectWait = human.Duration(2 * time.Second)
 	}
 	if cfg.Hermes.MaxReconnects == 0 {
 		cfg.Hermes.MaxReconnects = -1
@@ -174,7 +716,7 @@ func applyDefaults(cfg *Config) {
 		cfg.Alexandria.URL = "http://warren_alexandria:8500"
 	}
 	if cfg.Alexandria.Timeout == 0 {
-		cfg.Alexandria.Timeout = 5 * time.Second
+		cfg.Alexandria.Timeout = human.Duration(5 * time.Second)
 	}
 	// Default enabled=true. Plain bool can't distinguish unset from false,
 	// so to disable Alexandria, set enabled: false explicitly in config.
@@ -195,10 +737,10 @@ func applyDefaults(cfg *Config) {
 		cfg.PicoClaw.Binary = "picoclaw"
 	}
 	if cfg.PicoClaw.MissionBaseDir == "" {
-		cfg.PicoClaw.MissionBaseDir = "/tmp/picoclaw-missions"
+		cfg.PicoClaw.MissionBaseDir = filepath.Join(os.TempDir(), "picoclaw-missions")
 	}
 	if cfg.PicoClaw.DefaultTimeout == 0 {
-		cfg.PicoClaw.DefaultTimeout = 5 * time.Minute
+		cfg.PicoClaw.DefaultTimeout = human.Duration(5 * time.Minute)
 	}
 	if cfg.PicoClaw.MaxConcurrent == 0 {
 		cfg.PicoClaw.MaxConcurrent = 20
@@ -213,7 +755,7 @@ func applyDefaults(cfg *Config) {
 			agent.Health.CheckInterval = cfg.Defaults.HealthCheckInterval
 		}
 		if agent.Health.StartupTimeout == 0 {
-			agent.Health.StartupTimeout = 60 * time.Second
+			agent.Health.StartupTimeout = human.Duration(60 * time.Second)
 		}
 		if agent.Health.MaxFailures == 0 {
 			agent.Health.MaxFailures = 3
@@ -221,14 +763,132 @@ func applyDefaults(cfg *Config) {
 		if agent.Health.MaxRestartAttempts == 0 {
 			agent.Health.MaxRestartAttempts = 10
 		}
+		if agent.Health.CrashWindow == 0 {
+			agent.Health.CrashWindow = human.Duration(2 * time.Minute)
+		}
+		if agent.Health.CrashLoopThreshold == nil {
+			threshold := 3
+			agent.Health.CrashLoopThreshold = &threshold
+		}
+		if agent.Health.RestartBackoff == 0 {
+			agent.Health.RestartBackoff = human.Duration(10 * time.Second)
+		}
+		if agent.Health.MaxRestartBackoff == 0 {
+			agent.Health.MaxRestartBackoff = human.Duration(5 * time.Minute)
+		}
+		for i := range agent.Container.Publish {
+			if agent.Container.Publish[i].Protocol == "" {
+				agent.Container.Publish[i].Protocol = "tcp"
+			}
+		}
+		for i := range agent.Ports {
+			port := &agent.Ports[i]
+			if port.Proto == "" {
+				port.Proto = "tcp"
+			}
+			if port.Target == 0 {
+				port.Target = port.Listen
+			}
+			if port.WakeTimeout == 0 {
+				port.WakeTimeout = agent.Health.StartupTimeout
+			}
+		}
+		if tp := agent.TLSPassthrough; tp != nil {
+			if tp.Port == 0 {
+				tp.Port = 443
+			}
+			if tp.WakeTimeout == 0 {
+				tp.WakeTimeout = agent.Health.StartupTimeout
+			}
+		}
+		if agent.Health.RestartOnDegraded && agent.Health.RestartCooldown == 0 {
+			agent.Health.RestartCooldown = human.Duration(time.Minute)
+		}
+		if agent.Health.StartupProbe == 0 {
+			agent.Health.StartupProbe = human.Duration(250 * time.Millisecond)
+		}
+		if agent.Health.StartupProbeMax == 0 {
+			agent.Health.StartupProbeMax = human.Duration(2 * time.Second)
+		}
 		if agent.Policy == "on-demand" && agent.Idle.Timeout == 0 {
-			agent.Idle.Timeout = 30 * time.Minute
+			agent.Idle.Timeout = human.Duration(30 * time.Minute)
 		}
 		if agent.Idle.DrainTimeout == 0 {
-			agent.Idle.DrainTimeout = 30 * time.Second
+			agent.Idle.DrainTimeout = human.Duration(30 * time.Second)
+		}
+		if agent.Policy == "on-demand" && agent.Idle.Mode == "" {
+			agent.Idle.Mode = "stop"
 		}
 		if agent.Policy == "on-demand" && agent.Idle.WakeCooldown == 0 {
-			agent.Idle.WakeCooldown = 30 * time.Second
+			agent.Idle.WakeCooldown = human.Duration(30 * time.Second)
+		}
+		if agent.Wake != nil && agent.Wake.Budget != nil && agent.Wake.Budget.Action == "" {
+			agent.Wake.Budget.Action = "block"
+		}
+		if agent.Idle.PredictiveWake && agent.Idle.PredictiveLead == 0 {
+			agent.Idle.PredictiveLead = human.Duration(5 * time.Minute)
 		}
+		if agent.Idle.CPUThreshold > 0 && agent.Idle.CPUSampleInterval == 0 {
+			agent.Idle.CPUSampleInterval = human.Duration(30 * time.Second)
+		}
+		if agent.Idle.Prometheus != nil && agent.Idle.Prometheus.Interval == 0 {
+			agent.Idle.Prometheus.Interval = human.Duration(30 * time.Second)
+		}
+		if agent.Sleep.VetoURL != "" && agent.Sleep.VetoDefer == 0 {
+			agent.Sleep.VetoDefer = human.Duration(5 * time.Minute)
+		}
+		if agent.OpenClaw != nil {
+			if agent.OpenClaw.PollInterval == 0 {
+				agent.OpenClaw.PollInterval = human.Duration(30 * time.Second)
+			}
+			if agent.OpenClaw.ActiveWindow == 0 {
+				agent.OpenClaw.ActiveWindow = human.Duration(5 * time.Minute)
+			}
+		}
+	}
+}
+
+// applyOpenClaw reads each agent's openclaw.json and fills in backend,
+// health.url and openclaw.sessions_url from the gateway port when unset.
+func applyOpenClaw(cfg *Config) error {
+	for name, agent := range cfg.Agents {
+		if agent.OpenClaw == nil || agent.OpenClaw.Config == "" {
+			continue
+		}
+		oc, err := openclaw.Load(agent.OpenClaw.Config)
+		if err != nil {
+			return fmt.Errorf("config: agent %q: %w", name, err)
+		}
+		port := oc.Port()
+
+		if agent.Backend == "" && agent.Container.Name != "" {
+			agent.Backend = fmt.Sprintf("http://tasks.%s:%d", agent.Container.Name, port)
+		}
+		if agent.Backend == "" {
+			continue
+		}
+		backend, err := url.Parse(agent.Backend)
+		if err != nil {
+			continue // reported by validate
+		}
+		gateway := fmt.Sprintf("%s://%s", backend.Scheme, net.JoinHostPort(backend.Hostname(), strconv.Itoa(port)))
+		if agent.Health.URL == "" {
+			agent.Health.URL = gateway + oc.HealthPath()
+		}
+		if agent.OpenClaw.SessionsURL == "" {
+			agent.OpenClaw.SessionsURL = gateway + openclaw.DefaultSessionsPath
+		}
+	}
+	return nil
+}
+
+// PortRangeBounds parses port_range ("min-max").
+func (c *Config) PortRangeBounds() (min, max int, err error) {
+	if _, err := fmt.Sscanf(c.PortRange, "%d-%d", &min, &max); err != nil {
+		return 0, 0, fmt.Errorf("config: port_range %q must be \"min-max\"", c.PortRange)
+	}
+	if min < 1 || max > 65535 || min > max {
+		return 0, 0, fmt.Errorf("config: port_range %q must be within 1-65535 with min <= max", c.PortRange)
 	}
+	return min, max, nil
 }
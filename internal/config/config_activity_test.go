@@ -0,0 +1,160 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestActivityConfig(t *testing.T) {
+	path := writeTemp(t, `
+agents:
+  kai:
+    hostname: kai.example.com
+    backend: http://kai:8080
+    policy: on-demand
+    container:
+      name: kai
+    health:
+      url: http://kai:8080/health
+    idle:
+      cpu_threshold: 10
+      activity:
+        mode: all
+        sources: [requests, cpu]
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	act := cfg.Agents["kai"].Idle.Activity
+	if act.Mode != "all" || len(act.Sources) != 2 || act.Sources[1] != "cpu" {
+		t.Errorf("unexpected activity config: %+v", act)
+	}
+}
+
+func TestActivityConfigInvalid(t *testing.T) {
+	base := `
+agents:
+  a:
+    hostname: a.example.com
+    backend: http://localhost:3000
+    policy: on-demand
+    container:
+      name: a-svc
+    health:
+      url: http://localhost:3000/health
+    idle:
+`
+	tests := map[string]string{
+		`mode must be "any" or "all"`:    "      activity:\n        mode: some\n",
+		`unknown idle.activity source`:   "      activity:\n        sources: [requests, disk]\n",
+		`duplicate idle.activity source`: "      activity:\n        sources: [requests, requests]\n",
+		`requires idle.cpu_threshold`:    "      activity:\n        sources: [cpu]\n",
+	}
+	for want, idle := range tests {
+		_, err := Load(writeTemp(t, base+idle))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error containing %q, got %v", want, err)
+		}
+	}
+
+	_, err := Load(writeTemp(t, `
+agents:
+  a:
+    hostname: a.example.com
+    backend: http://localhost:3000
+    policy: unmanaged
+    idle:
+      activity:
+        mode: all
+`))
+	if err == nil || !strings.Contains(err.Error(), "idle.activity requires on-demand") {
+		t.Errorf("expected on-demand error, got %v", err)
+	}
+}
+
+func TestPrometheusActivity(t *testing.T) {
+	cfg, err := Load(writeTemp(t, `
+agents:
+  kai:
+    hostname: kai.example.com
+    backend: http://kai:8080
+    policy: on-demand
+    container:
+      name: kai
+    health:
+      url: http://kai:8080/health
+    idle:
+      prometheus:
+        url: http://prometheus:9090
+        query: sum(kai_queue_depth)
+      activity:
+        sources: [requests, connections, prometheus]
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	prom := cfg.Agents["kai"].Idle.Prometheus
+	if prom == nil || prom.Query != "sum(kai_queue_depth)" || time.Duration(prom.Interval) != 30*time.Second {
+		t.Errorf("unexpected prometheus config: %+v", prom)
+	}
+
+	base := `
+agents:
+  a:
+    hostname: a.example.com
+    backend: http://localhost:3000
+    policy: on-demand
+    container:
+      name: a-svc
+    health:
+      url: http://localhost:3000/health
+    idle:
+`
+	tests := map[string]string{
+		"invalid idle.prometheus.url":           "      prometheus:\n        url: ftp://prom\n        query: up\n",
+		"idle.prometheus.query is required":     "      prometheus:\n        url: http://prom:9090\n",
+		`"prometheus" requires idle.prometheus`: "      activity:\n        sources: [prometheus]\n",
+	}
+	for want, idle := range tests {
+		_, err := Load(writeTemp(t, base+idle))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error containing %q, got %v", want, err)
+		}
+	}
+}
+
+func TestWebSocketTimeout(t *testing.T) {
+	base := `
+agents:
+  a:
+    hostname: a.example.com
+    backend: http://localhost:3000
+    policy: %s
+    container:
+      name: a-svc
+    health:
+      url: http://localhost:3000/health
+    idle:
+      websocket_timeout: %s
+`
+	cfg, err := Load(writeTemp(t, fmt.Sprintf(base, "on-demand", "20m")))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cfg.Agents["a"].Idle.WebSocketTimeout; time.Duration(got) != 20*time.Minute {
+		t.Errorf("websocket_timeout = %s, want 20m", got)
+	}
+
+	for want, args := range map[string][2]string{
+		"must not be negative":      {"on-demand", "-1m"},
+		"requires on-demand policy": {"always-on", "20m"},
+	} {
+		_, err := Load(writeTemp(t, fmt.Sprintf(base, args[0], args[1])))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error containing %q, got %v", want, err)
+		}
+	}
+}
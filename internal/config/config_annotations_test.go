@@ -0,0 +1,31 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAnnotations(t *testing.T) {
+	path := writeTemp(t, `
+agents:
+  kai:
+    hostname: kai.example.com
+    backend: http://kai:8080
+    policy: unmanaged
+    annotations:
+      owner: team-x
+      note: do not sleep during demos
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cfg.Agents["kai"].Annotations["owner"]; got != "team-x" {
+		t.Errorf("owner = %q, want team-x", got)
+	}
+
+	_, err = Load(writeTemp(t, "agents:\n  kai:\n    hostname: kai.example.com\n    backend: http://kai:8080\n    policy: unmanaged\n    annotations:\n      \"on call\": ops\n"))
+	if err == nil || !strings.Contains(err.Error(), "annotation key") {
+		t.Errorf("error = %v, want annotation key error", err)
+	}
+}
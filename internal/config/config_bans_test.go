@@ -0,0 +1,29 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBans(t *testing.T) {
+	cfg, err := Load(writeTemp(t, "bans:\n  enabled: true\n  max_strikes: 5\n  window: 2m\n  duration: 24h\n  ignore: [\"10.0.0.0/8\", \"203.0.113.7\"]\n"+minimalAgent))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b := cfg.Bans
+	if !b.Enabled || b.MaxStrikes != 5 || time.Duration(b.Window) != 2*time.Minute || time.Duration(b.Duration) != 24*time.Hour || len(b.Ignore) != 2 {
+		t.Errorf("bans = %+v", b)
+	}
+
+	for name, yaml := range map[string]string{
+		"bad ignore":        "bans:\n  enabled: true\n  ignore: [\"10.0.0/8\"]\n",
+		"negative strikes":  "bans:\n  enabled: true\n  max_strikes: -1\n",
+		"negative duration": "bans:\n  enabled: true\n  duration: -1h\n",
+	} {
+		_, err := Load(writeTemp(t, yaml+minimalAgent))
+		if err == nil || !strings.Contains(err.Error(), "bans") {
+			t.Errorf("%s: error = %v, want bans error", name, err)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestBasicAuthConfig(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("pw"), bcrypt.MinCost)
+	file := filepath.Join(t.TempDir(), "htpasswd")
+	os.WriteFile(file, []byte("bob:"+string(hash)+"\n"), 0600)
+
+	yaml := `
+agents:
+  a:
+    hostname: a.example.com
+    backend: http://localhost:3000
+    policy: unmanaged
+    basic_auth:
+      realm: private
+      users:
+        - "alice:` + string(hash) + `"
+      users_file: ` + file + `
+`
+	cfg, err := Load(writeTemp(t, yaml))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ba := cfg.Agents["a"].BasicAuth
+	if ba == nil || ba.Realm != "private" {
+		t.Fatalf("basic_auth = %+v", ba)
+	}
+	entries, err := ba.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("entries = %d, want 2", len(entries))
+	}
+}
+
+func TestBasicAuthConfigInvalid(t *testing.T) {
+	yaml := `
+agents:
+  a:
+    hostname: a.example.com
+    backend: http://localhost:3000
+    policy: unmanaged
+    basic_auth:
+      users:
+        - "alice:plaintext"
+`
+	_, err := Load(writeTemp(t, yaml))
+	if err == nil || !strings.Contains(err.Error(), "bcrypt") {
+		t.Fatalf("expected bcrypt error, got %v", err)
+	}
+
+	yaml = `
+agents:
+  a:
+    hostname: a.example.com
+    backend: http://localhost:3000
+    policy: unmanaged
+    basic_auth:
+      users_file: /nonexistent/htpasswd
+`
+	if _, err := Load(writeTemp(t, yaml)); err == nil {
+		t.Fatal("expected error for missing users_file")
+	}
+}
+
+func TestBasicAuthWithProxyToken(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("pw"), bcrypt.MinCost)
+	agent := `
+proxy_token: secret
+agents:
+  a:
+    hostname: a.example.com
+    backend: http://localhost:3000
+    policy: unmanaged
+    basic_auth:
+      users:
+        - "alice:` + string(hash) + `"
+`
+	// Basic auth stands in for the proxy token, so that must be explicit.
+	if _, err := Load(writeTemp(t, agent)); err == nil || !strings.Contains(err.Error(), "replace_proxy_token") {
+		t.Fatalf("expected replace_proxy_token error, got %v", err)
+	}
+	if _, err := Load(writeTemp(t, agent+"      replace_proxy_token: true\n")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	service := `
+proxy_token: secret
+services:
+  s.example.com:
+    target: http://localhost:4000
+    basic_auth:
+      users:
+        - "alice:` + string(hash) + `"
+` + minimalAgent
+	if _, err := Load(writeTemp(t, service)); err == nil || !strings.Contains(err.Error(), "replace_proxy_token") {
+		t.Fatalf("expected replace_proxy_token error for the service, got %v", err)
+	}
+}
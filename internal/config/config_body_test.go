@@ -0,0 +1,31 @@
+package config
+
+import "testing"
+
+func TestMaxProxyBody(t *testing.T) {
+	cfg, err := Load(writeTemp(t, `
+max_proxy_body: 10MB
+agents:
+  a:
+    hostname: a.example.com
+    backend: http://10.0.0.1:3000
+    policy: unmanaged
+    max_body: 1GiB
+  b:
+    hostname: b.example.com
+    backend: http://10.0.0.2:3000
+    policy: unmanaged
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.MaxProxyBody != 10_000_000 {
+		t.Errorf("max_proxy_body = %d, want 10000000", cfg.MaxProxyBody)
+	}
+	if got := cfg.Agents["a"].MaxBody; got != 1<<30 {
+		t.Errorf("agent a max_body = %d, want 1GiB", got)
+	}
+	if got := cfg.Agents["b"].MaxBody; got != 0 {
+		t.Errorf("agent b max_body = %d, want 0 (inherit)", got)
+	}
+}
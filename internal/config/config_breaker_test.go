@@ -0,0 +1,36 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAgentCircuitBreaker(t *testing.T) {
+	base := `
+agents:
+  a:
+    hostname: a.example.com
+    backend: http://10.0.0.1:3000
+    policy: unmanaged
+    circuit_breaker:
+`
+	cfg, err := Load(writeTemp(t, base+"      threshold: 0.5\n      open_for: 1m\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cb := cfg.Agents["a"].CircuitBreaker; cb == nil || cb.Threshold != 0.5 || time.Duration(cb.OpenFor) != time.Minute {
+		t.Errorf("circuit_breaker = %+v", cb)
+	}
+
+	for _, bad := range []string{"      threshold: 0\n", "      threshold: 1.5\n"} {
+		_, err = Load(writeTemp(t, base+bad))
+		if err == nil || !strings.Contains(err.Error(), "circuit_breaker.threshold") {
+			t.Errorf("%q: expected threshold error, got %v", bad, err)
+		}
+	}
+	_, err = Load(writeTemp(t, base+"      threshold: 0.5\n      window: -1s\n"))
+	if err == nil || !strings.Contains(err.Error(), "must not be negative") {
+		t.Errorf("expected negative window error, got %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAgentCache(t *testing.T) {
+	yaml := minimalAgent + `    cache:
+      paths: ["/static/", "*.css"]
+      ttl: 10m
+      max_size: 50MiB
+`
+	cfg, err := Load(writeTemp(t, yaml))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c := cfg.Agents["a"].Cache
+	if c == nil || len(c.Paths) != 2 || time.Duration(c.TTL) != 10*time.Minute || c.MaxSize != 50<<20 {
+		t.Errorf("cache = %+v", c)
+	}
+}
+
+func TestAgentCacheValidation(t *testing.T) {
+	for _, tc := range []struct {
+		name, cache, want string
+	}{
+		{"no paths", "    cache:\n      ttl: 1m\n", "cache.paths must list at least one path"},
+		{"bad pattern", "    cache:\n      paths: [\"/a/[\"]\n", "cache.paths: invalid pattern"},
+		{"post", "    cache:\n      paths: [\"/\"]\n      methods: [POST]\n", "cache.methods"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Load(writeTemp(t, minimalAgent+tc.cache))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("expected %q error, got %v", tc.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestAgentCompressLeftUnset(t *testing.T) {
+	cfg, err := Load(writeTemp(t, `
+compress: true
+agents:
+  a:
+    hostname: a.example.com
+    backend: http://10.0.0.1:3000
+    policy: unmanaged
+  b:
+    hostname: b.example.com
+    backend: http://10.0.0.2:3000
+    policy: unmanaged
+    compress: false
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.Compress {
+		t.Error("top-level compress = false, want true")
+	}
+	// Agent a follows the top-level setting at runtime; filling it in
+	// here would write it into the config on every save.
+	if c := cfg.Agents["a"].Compress; c != nil {
+		t.Errorf("agent a compress = %v, want unset", *c)
+	}
+	if c := cfg.Agents["b"].Compress; c == nil || *c {
+		t.Errorf("agent b compress = %v, want false", c)
+	}
+	out, err := yaml.Marshal(cfg.Agents["a"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(out), "compress") {
+		t.Errorf("saved agent a sets compress:\n%s", out)
+	}
+}
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAgentCORS(t *testing.T) {
+	base := `
+agents:
+  a:
+    hostname: a.example.com
+    backend: http://10.0.0.1:3000
+    policy: unmanaged
+    cors:
+`
+	cfg, err := Load(writeTemp(t, base+"      origins: [https://app.example.com]\n      credentials: true\n      max_age: 10m\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c := cfg.Agents["a"].CORS
+	if c == nil || len(c.Origins) != 1 || !c.Credentials || time.Duration(c.MaxAge) != 10*time.Minute {
+		t.Fatalf("cors = %+v", c)
+	}
+	if _, err := c.Policy(); err != nil {
+		t.Errorf("Policy: %v", err)
+	}
+
+	_, err = Load(writeTemp(t, base+"      origins: [\"*\"]\n      credentials: true\n"))
+	if err == nil || !strings.Contains(err.Error(), `agent "a" cors: credentials`) {
+		t.Errorf("expected wildcard credentials error, got %v", err)
+	}
+}
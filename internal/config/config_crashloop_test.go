@@ -0,0 +1,71 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCrashLoopDefaults(t *testing.T) {
+	path := writeTemp(t, `
+agents:
+  kai:
+    hostname: kai.example.com
+    backend: http://kai:8080
+    policy: on-demand
+    container:
+      name: kai
+    health:
+      url: http://kai:8080/health
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	h := cfg.Agents["kai"].Health
+	if time.Duration(h.CrashWindow) != 2*time.Minute || h.CrashLoop() != 3 || time.Duration(h.RestartBackoff) != 10*time.Second || time.Duration(h.MaxRestartBackoff) != 5*time.Minute {
+		t.Errorf("unexpected crash loop defaults: %+v", h)
+	}
+}
+
+func TestCrashLoopBackoffOrder(t *testing.T) {
+	path := writeTemp(t, `
+agents:
+  kai:
+    hostname: kai.example.com
+    backend: http://kai:8080
+    policy: on-demand
+    container:
+      name: kai
+    health:
+      url: http://kai:8080/health
+      restart_backoff: 10m
+      max_restart_backoff: 1m
+`)
+	_, err := Load(path)
+	if err == nil || !strings.Contains(err.Error(), "max_restart_backoff") {
+		t.Fatalf("expected max_restart_backoff error, got %v", err)
+	}
+}
+
+func TestCrashLoopThresholdZeroDisables(t *testing.T) {
+	path := writeTemp(t, `
+agents:
+  kai:
+    hostname: kai.example.com
+    backend: http://kai:8080
+    policy: on-demand
+    container:
+      name: kai
+    health:
+      url: http://kai:8080/health
+      crash_loop_threshold: 0
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cfg.Agents["kai"].Health.CrashLoop(); got != 0 {
+		t.Errorf("crash_loop_threshold = %d, want 0", got)
+	}
+}
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDependsOn(t *testing.T) {
+	agent := func(name, policy, dependsOn string) string {
+		s := "  " + name + ":\n    hostname: " + name + ".example.com\n    backend: http://" + name + ":8080\n    policy: " + policy + "\n"
+		if policy == "on-demand" {
+			s += "    container:\n      name: " + name + "\n    health:\n      url: http://" + name + ":8080/health\n"
+		}
+		if dependsOn != "" {
+			s += "    depends_on: [" + dependsOn + "]\n"
+		}
+		return s
+	}
+
+	cfg, err := Load(writeTemp(t, "agents:\n"+agent("bot", "on-demand", "db")+agent("db", "on-demand", "")))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if deps := cfg.Agents["bot"].DependsOn; len(deps) != 1 || deps[0] != "db" {
+		t.Errorf("depends_on = %v, want [db]", deps)
+	}
+
+	for _, tc := range []struct{ yaml, want string }{
+		{agent("bot", "on-demand", "bot"), "cannot depend on itself"},
+		{agent("bot", "on-demand", "missing"), "not a configured agent"},
+		{agent("bot", "unmanaged", "db") + agent("db", "on-demand", ""), "requires on-demand"},
+		{agent("a", "on-demand", "b") + agent("b", "on-demand", "c") + agent("c", "on-demand", "a"), "depends_on cycle: a -> b -> c -> a"},
+	} {
+		_, err := Load(writeTemp(t, "agents:\n"+tc.yaml))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("expected error containing %q, got %v", tc.want, err)
+		}
+	}
+}
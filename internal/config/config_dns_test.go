@@ -0,0 +1,34 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDNS(t *testing.T) {
+	t.Setenv("CLOUDFLARE_API_TOKEN", "cf-token")
+	cfg, err := Load(writeTemp(t, "dns:\n  provider: cloudflare\n  managed_zones: [example.com]\n  target: 203.0.113.7\n"+minimalAgent))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.DNS.Cloudflare.APIToken != "cf-token" {
+		t.Errorf("api_token = %q, want it from CLOUDFLARE_API_TOKEN", cfg.DNS.Cloudflare.APIToken)
+	}
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	for name, yaml := range map[string]string{
+		"unknown provider": "dns:\n  provider: bind\n  managed_zones: [example.com]\n  target: 203.0.113.7\n",
+		"no credentials":   "dns:\n  provider: route53\n  managed_zones: [example.com]\n  target: 203.0.113.7\n",
+		"no zones":         "dns:\n  provider: cloudflare\n  target: 203.0.113.7\n",
+		"bad zone":         "dns:\n  provider: cloudflare\n  managed_zones: [\"exa mple.com\"]\n  target: 203.0.113.7\n",
+		"no target":        "dns:\n  provider: cloudflare\n  managed_zones: [example.com]\n",
+		"bad target":       "dns:\n  provider: cloudflare\n  managed_zones: [example.com]\n  target: \"warren host\"\n",
+		"negative ttl":     "dns:\n  provider: cloudflare\n  managed_zones: [example.com]\n  target: warren.example.net\n  ttl: -1m\n",
+	} {
+		_, err := Load(writeTemp(t, yaml+minimalAgent))
+		if err == nil || !strings.Contains(err.Error(), "dns") {
+			t.Errorf("%s: error = %v, want dns error", name, err)
+		}
+	}
+}
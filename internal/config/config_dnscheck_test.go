@@ -0,0 +1,28 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDNSCheck(t *testing.T) {
+	cfg, err := Load(writeTemp(t, "dns_check:\n  public_ips: [\"203.0.113.7\", \"104.16.0.0/13\"]\n  interval: 5m\n"+minimalAgent))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.DNSCheck.PublicIPs) != 2 || time.Duration(cfg.DNSCheck.Interval) != 5*time.Minute {
+		t.Errorf("dns_check = %+v", cfg.DNSCheck)
+	}
+
+	for name, yaml := range map[string]string{
+		"bad address":       "dns_check:\n  public_ips: [\"203.0.113\"]\n",
+		"bad cidr":          "dns_check:\n  public_ips: [\"104.16.0.0/40\"]\n",
+		"negative interval": "dns_check:\n  public_ips: [\"203.0.113.7\"]\n  interval: -1m\n",
+	} {
+		_, err := Load(writeTemp(t, yaml+minimalAgent))
+		if err == nil || !strings.Contains(err.Error(), "dns_check") {
+			t.Errorf("%s: error = %v, want dns_check error", name, err)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDockerHost(t *testing.T) {
+	for _, host := range []string{
+		"unix:///var/run/docker.sock",
+		"npipe:////./pipe/docker_engine",
+		"tcp://127.0.0.1:2375",
+	} {
+		cfg, err := Load(writeTemp(t, "docker_host: \""+host+"\"\n"+minimalAgent))
+		if err != nil {
+			t.Fatalf("docker_host %q: unexpected error: %v", host, err)
+		}
+		if cfg.DockerHost != host {
+			t.Errorf("docker_host = %q, want %q", cfg.DockerHost, host)
+		}
+	}
+
+	for _, tc := range []struct {
+		host string
+		want string
+	}{
+		{"ssh://me@host", "docker_host must use unix://, npipe:// or tcp://"},
+		{"/var/run/docker.sock", "docker_host must use unix://, npipe:// or tcp://"},
+		{"npipe://", "missing a socket or pipe path"},
+		{"tcp://", "missing host:port"},
+	} {
+		if _, err := Load(writeTemp(t, "docker_host: \""+tc.host+"\"\n"+minimalAgent)); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("docker_host %q: err = %v, want %q", tc.host, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestErrorPages(t *testing.T) {
+	page := filepath.Join(t.TempDir(), "502.html")
+	os.WriteFile(page, []byte(`<p>{{.Agent}} is unavailable</p>`), 0644)
+
+	cfg, err := Load(writeTemp(t, minimalAgent+"    error_pages:\n      503: "+page+"\nerror_pages:\n  502: "+page+"\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.ErrorPages[502] != page || cfg.Agents["a"].ErrorPages[503] != page {
+		t.Errorf("error pages = %v, agent %v", cfg.ErrorPages, cfg.Agents["a"].ErrorPages)
+	}
+
+	_, err = Load(writeTemp(t, minimalAgent+"error_pages:\n  500: "+page+"\n"))
+	if err == nil || !strings.Contains(err.Error(), "status 500 can't have a page") {
+		t.Errorf("expected status error, got %v", err)
+	}
+	_, err = Load(writeTemp(t, minimalAgent+"    error_pages:\n      502: /nonexistent.html\n"))
+	if err == nil || !strings.Contains(err.Error(), `agent "a" error_pages: invalid template for 502`) {
+		t.Errorf("expected template error, got %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestForwardAuthConfig(t *testing.T) {
+	yaml := `
+agents:
+  a:
+    hostname: a.example.com
+    backend: http://localhost:3000
+    policy: unmanaged
+    forward_auth:
+      address: http://oauth2-proxy:4180/oauth2/auth
+      auth_response_headers:
+        - X-Auth-Request-User
+        - X-Auth-Request-Email
+      timeout: 3s
+`
+	cfg, err := Load(writeTemp(t, yaml))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	fa := cfg.Agents["a"].ForwardAuth
+	if fa == nil || fa.Address != "http://oauth2-proxy:4180/oauth2/auth" {
+		t.Fatalf("forward_auth = %+v", fa)
+	}
+	if len(fa.AuthResponseHeaders) != 2 || time.Duration(fa.Timeout) != 3*time.Second {
+		t.Errorf("forward_auth = %+v", fa)
+	}
+}
+
+func TestForwardAuthConfigInvalid(t *testing.T) {
+	tests := map[string]string{
+		"address": `
+    forward_auth:
+      address: oauth2-proxy:4180
+`,
+		"both basic_auth and forward_auth": `
+    basic_auth:
+      users: ["alice:$2y$05$abcdefghijklmnopqrstuuJ6P1e2p8Q0h3b9m5FhVv3fH1YyC0jKq"]
+    forward_auth:
+      address: http://oauth2-proxy:4180/oauth2/auth
+`,
+	}
+	for want, block := range tests {
+		yaml := `
+agents:
+  a:
+    hostname: a.example.com
+    backend: http://localhost:3000
+    policy: unmanaged
+` + block
+		_, err := Load(writeTemp(t, yaml))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error containing %q, got %v", want, err)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAgentHeaders(t *testing.T) {
+	yaml := minimalAgent + `    headers:
+      request:
+        set:
+          X-Api-Key: secret
+        remove: [Cookie]
+      response:
+        remove: [Server, X-Powered-By]
+`
+	cfg, err := Load(writeTemp(t, yaml))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	h := cfg.Agents["a"].Headers
+	if h == nil || h.Request.Set["X-Api-Key"] != "secret" || len(h.Request.Remove) != 1 || len(h.Response.Remove) != 2 {
+		t.Fatalf("headers = %+v", h)
+	}
+
+	_, err = Load(writeTemp(t, minimalAgent+"    headers:\n      request:\n        set:\n          Transfer-Encoding: chunked\n"))
+	if err == nil || !strings.Contains(err.Error(), `agent "a" headers: request.set: Transfer-Encoding can't be rewritten`) {
+		t.Errorf("expected reserved header error, got %v", err)
+	}
+}
@@ -0,0 +1,22 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHeartbeat(t *testing.T) {
+	cfg, err := Load(writeTemp(t, "heartbeat_url: https://hc-ping.com/abc\n"+minimalAgent))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.HeartbeatURL != "https://hc-ping.com/abc" || time.Duration(cfg.HeartbeatInterval) != time.Minute {
+		t.Errorf("heartbeat = %q every %v, want default 1m", cfg.HeartbeatURL, cfg.HeartbeatInterval)
+	}
+
+	_, err = Load(writeTemp(t, "heartbeat_url: hc-ping.com/abc\n"+minimalAgent))
+	if err == nil || !strings.Contains(err.Error(), "heartbeat_url") {
+		t.Errorf("expected heartbeat_url error, got %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeKeyPair writes a self-signed certificate and its key to a temp dir.
+func writeKeyPair(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{"a.example.com"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestHTTP3(t *testing.T) {
+	cert, key := writeKeyPair(t)
+	h3 := "http3:\n  listen: \":443\"\n  cert_file: " + cert + "\n  key_file: " + key + "\n"
+	cfg, err := Load(writeTemp(t, h3+minimalAgent))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.HTTP3.Listen != ":443" || cfg.HTTP3.CertFile != cert {
+		t.Errorf("http3 = %+v", cfg.HTTP3)
+	}
+
+	for _, tc := range []struct {
+		yaml string
+		want string
+	}{
+		{"http3:\n  listen: \":443\"\n", "http3 requires cert_file and key_file"},
+		{"http3:\n  listen: \":443\"\n  cert_file: " + key + "\n  key_file: " + key + "\n", "http3:"},
+		{"admin_listen: \":443\"\n" + h3, `http3.listen ":443" is already used`},
+	} {
+		if _, err := Load(writeTemp(t, tc.yaml+minimalAgent)); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("err = %v, want %q", err, tc.want)
+		}
+	}
+
+	// TLS passthrough can share the port.
+	if _, err := Load(writeTemp(t, "tls_listen: \":443\"\n"+h3+minimalAgent)); err != nil {
+		t.Errorf("sharing tls_listen: %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHumanDurationsAndSizes(t *testing.T) {
+	cfg, err := Load(writeTemp(t, `
+trash_retention: 7d
+max_request_body: 10MB
+agents:
+  a:
+    hostname: a.example.com
+    backend: http://10.0.0.1:3000
+    policy: on-demand
+    container:
+      name: a
+    health:
+      url: http://10.0.0.1:3000/health
+    idle:
+      timeout: "1h 30m"
+    labels:
+      retention: 7d
+    annotations:
+      rota: "2d"
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if time.Duration(cfg.TrashRetention) != 7*24*time.Hour {
+		t.Errorf("trash_retention = %v, want 168h", cfg.TrashRetention)
+	}
+	if cfg.MaxRequestBody != 10_000_000 {
+		t.Errorf("max_request_body = %d, want 10000000", cfg.MaxRequestBody)
+	}
+	if got := cfg.Agents["a"].Idle.Timeout; time.Duration(got) != 90*time.Minute {
+		t.Errorf("idle.timeout = %v, want 1h30m", got)
+	}
+	// Strings outside duration fields are kept as written.
+	if a := cfg.Agents["a"]; a.Labels["retention"] != "7d" || a.Annotations["rota"] != "2d" {
+		t.Errorf("labels = %v, annotations = %v", a.Labels, a.Annotations)
+	}
+}
+
+const minimalAgent = `
+agents:
+  a:
+    hostname: a.example.com
+    backend: http://10.0.0.1:3000
+    policy: unmanaged
+`
+
+func TestMaxRequestBodyDefault(t *testing.T) {
+	cfg, err := Load(writeTemp(t, minimalAgent))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.MaxRequestBody != 1<<20 {
+		t.Errorf("max_request_body = %d, want 1MiB", cfg.MaxRequestBody)
+	}
+
+	_, err = Load(writeTemp(t, "max_request_body: lots\n"+minimalAgent))
+	if err == nil || !strings.Contains(err.Error(), "invalid size") {
+		t.Errorf("expected size error, got %v", err)
+	}
+}
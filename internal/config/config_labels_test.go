@@ -0,0 +1,31 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLabels(t *testing.T) {
+	path := writeTemp(t, `
+agents:
+  kai:
+    hostname: kai.example.com
+    backend: http://kai:8080
+    policy: unmanaged
+    labels:
+      env: staging
+      team: infra
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cfg.Agents["kai"].Labels["env"]; got != "staging" {
+		t.Errorf("env = %q, want staging", got)
+	}
+
+	_, err = Load(writeTemp(t, "agents:\n  kai:\n    hostname: kai.example.com\n    backend: http://kai:8080\n    policy: unmanaged\n    labels:\n      env: \"a,b\"\n"))
+	if err == nil || !strings.Contains(err.Error(), `agent "kai" label "env"`) {
+		t.Errorf("error = %v, want label value error", err)
+	}
+}
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaxLifetime(t *testing.T) {
+	path := writeTemp(t, `
+agents:
+  friend:
+    hostname: friend.example.com
+    backend: http://friend:8080
+    policy: always-on
+    container:
+      name: friend
+      max_lifetime: 3d
+    health:
+      url: http://friend:8080/health
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cfg.Agents["friend"].Container.MaxLifetime; time.Duration(got) != 72*time.Hour {
+		t.Errorf("max_lifetime = %v, want 72h", got)
+	}
+
+	for name, policy := range map[string]string{
+		"on-demand": "policy: on-demand\n    container:\n      name: kai\n      max_lifetime: 72h\n    health:\n      url: http://kai:8080/health",
+		"negative":  "policy: always-on\n    container:\n      name: kai\n      max_lifetime: -1h\n    health:\n      url: http://kai:8080/health",
+	} {
+		_, err := Load(writeTemp(t, "agents:\n  kai:\n    hostname: kai.example.com\n    backend: http://kai:8080\n    "+policy+"\n"))
+		if err == nil || !strings.Contains(err.Error(), "max_lifetime") {
+			t.Errorf("%s: error = %v, want max_lifetime error", name, err)
+		}
+	}
+}
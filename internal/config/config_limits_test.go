@@ -0,0 +1,72 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecodeLimits(t *testing.T) {
+	// A "billion laughs" document: each level doubles the size of the one
+	// before it once aliases are expanded.
+	var bomb strings.Builder
+	bomb.WriteString("a0: &a0 [x, x]\n")
+	for i := 1; i < 40; i++ {
+		fmt.Fprintf(&bomb, "a%d: &a%d [*a%d, *a%d]\n", i, i, i-1, i-1)
+	}
+
+	deep := strings.Repeat("[", 50) + strings.Repeat("]", 50)
+
+	var agents strings.Builder
+	agents.WriteString("agents:\n")
+	for i := 0; i < 3; i++ {
+		fmt.Fprintf(&agents, "  a%d:\n    hostname: a%d.example.com\n", i, i)
+	}
+
+	lim := Limits{MaxBytes: 1 << 20, MaxAgents: 2, MaxDepth: 32, MaxNodes: 10_000}
+	for _, tc := range []struct {
+		name string
+		data string
+		want string
+	}{
+		{"alias bomb", bomb.String(), "more than 10000 YAML nodes"},
+		{"deep nesting", "x: " + deep, "nested more than 32 levels"},
+		{"too many agents", agents.String(), "3 agents, more than the limit of 2"},
+		{"too large", strings.Repeat("#", 1<<20+1), "larger than 1048576 bytes"},
+	} {
+		if _, err := Decode([]byte(tc.data), lim); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: err = %v, want %q", tc.name, err, tc.want)
+		}
+	}
+
+	// Aliases within the limits still work.
+	cfg, err := Decode([]byte("defaults: &idle {timeout: 2d}\nagents:\n  a:\n    hostname: a.example.com\n    idle: *idle\n"), lim)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := time.Duration(cfg.Agents["a"].Idle.Timeout).Hours(); got != 48 {
+		t.Errorf("idle.timeout = %vh, want 48h", got)
+	}
+}
+
+func TestLoadRejectsOversizedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "orchestrator.yaml")
+	if err := os.WriteFile(path, []byte(strings.Repeat("#", int(DefaultLimits.MaxBytes)+1)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "larger than") {
+		t.Errorf("err = %v, want size limit error", err)
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+	f.Add([]byte(minimalAgent))
+	f.Add([]byte("listen: :8080\nagents:\n  a:\n    idle: {timeout: 1h 30m}\n"))
+	f.Add([]byte("a: &a [x]\nb: [*a, *a]\n"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, _ = Decode(data, Limits{MaxBytes: 64 << 10, MaxAgents: 100, MaxDepth: 16, MaxNodes: 5000})
+	})
+}
@@ -0,0 +1,21 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMetricsSampling(t *testing.T) {
+	cfg, err := Load(writeTemp(t, minimalAgent+"metrics:\n  sampling: 0.1\n  access_log: true\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Metrics.SampleRate() != 0.1 || !cfg.Metrics.AccessLog {
+		t.Errorf("metrics = %+v", cfg.Metrics)
+	}
+
+	_, err = Load(writeTemp(t, minimalAgent+"metrics:\n  sampling: 1.5\n"))
+	if err == nil || !strings.Contains(err.Error(), "metrics.sampling must be between 0 and 1") {
+		t.Errorf("expected sampling range error, got %v", err)
+	}
+}
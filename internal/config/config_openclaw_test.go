@@ -0,0 +1,101 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeOpenClaw(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "openclaw.json")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestOpenClawDerivesEndpoints(t *testing.T) {
+	oc := writeOpenClaw(t, `{"gateway":{"port":18800,"bind":"lan"}}`)
+	yaml := `
+agents:
+  a:
+    hostname: a.example.com
+    policy: on-demand
+    container:
+      name: openclaw_a
+    openclaw:
+      config: ` + oc + `
+`
+	cfg, err := Load(writeTemp(t, yaml))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	a := cfg.Agents["a"]
+	if a.Backend != "http://tasks.openclaw_a:18800" {
+		t.Errorf("backend = %q", a.Backend)
+	}
+	if a.Health.URL != "http://tasks.openclaw_a:18800/health" {
+		t.Errorf("health.url = %q", a.Health.URL)
+	}
+	if a.OpenClaw.SessionsURL != "http://tasks.openclaw_a:18800/api/sessions" {
+		t.Errorf("sessions_url = %q", a.OpenClaw.SessionsURL)
+	}
+	if time.Duration(a.OpenClaw.PollInterval) != 30*time.Second || time.Duration(a.OpenClaw.ActiveWindow) != 5*time.Minute {
+		t.Errorf("defaults = %v/%v", a.OpenClaw.PollInterval, a.OpenClaw.ActiveWindow)
+	}
+}
+
+func TestOpenClawKeepsExplicitValues(t *testing.T) {
+	oc := writeOpenClaw(t, `{"port":9000,"health_endpoint":"/healthz"}`)
+	yaml := `
+agents:
+  a:
+    hostname: a.example.com
+    backend: http://agent-a:8080
+    policy: on-demand
+    container:
+      name: openclaw_a
+    health:
+      url: http://agent-a:8080/ready
+    openclaw:
+      config: ` + oc + `
+      poll_interval: 10s
+`
+	cfg, err := Load(writeTemp(t, yaml))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	a := cfg.Agents["a"]
+	if a.Backend != "http://agent-a:8080" {
+		t.Errorf("backend = %q", a.Backend)
+	}
+	if a.Health.URL != "http://agent-a:8080/ready" {
+		t.Errorf("health.url = %q", a.Health.URL)
+	}
+	if a.OpenClaw.SessionsURL != "http://agent-a:9000/api/sessions" {
+		t.Errorf("sessions_url = %q", a.OpenClaw.SessionsURL)
+	}
+	if time.Duration(a.OpenClaw.PollInterval) != 10*time.Second {
+		t.Errorf("poll_interval = %v", a.OpenClaw.PollInterval)
+	}
+}
+
+func TestOpenClawMissingConfigFile(t *testing.T) {
+	yaml := `
+agents:
+  a:
+    hostname: a.example.com
+    policy: on-demand
+    container:
+      name: openclaw_a
+    openclaw:
+      config: /nonexistent/openclaw.json
+`
+	_, err := Load(writeTemp(t, yaml))
+	if err == nil || !strings.Contains(err.Error(), "openclaw") {
+		t.Fatalf("expected openclaw error, got %v", err)
+	}
+}
@@ -0,0 +1,25 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAllowedPaths(t *testing.T) {
+	cfg, err := Load(writeTemp(t, minimalAgent+"    allowed_paths: [/api/, /ws, \"*.js\"]\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cfg.Agents["a"].AllowedPaths; len(got) != 3 || got[0] != "/api/" {
+		t.Errorf("allowed_paths = %v", got)
+	}
+
+	_, err = Load(writeTemp(t, minimalAgent+"    allowed_paths: [\"/[\"]\n"))
+	if err == nil || !strings.Contains(err.Error(), `agent "a" allowed_paths: invalid pattern "/["`) {
+		t.Errorf("expected pattern error, got %v", err)
+	}
+	_, err = Load(writeTemp(t, minimalAgent+"    allowed_paths: [\"\"]\n"))
+	if err == nil || !strings.Contains(err.Error(), "allowed_paths must not contain an empty pattern") {
+		t.Errorf("expected empty pattern error, got %v", err)
+	}
+}
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -22,10 +24,10 @@ agents:
 	if cfg.PicoClaw.Binary != "picoclaw" {
 		t.Errorf("picoclaw.binary = %q, want picoclaw", cfg.PicoClaw.Binary)
 	}
-	if cfg.PicoClaw.MissionBaseDir != "/tmp/picoclaw-missions" {
-		t.Errorf("picoclaw.mission_base_dir = %q, want /tmp/picoclaw-missions", cfg.PicoClaw.MissionBaseDir)
+	if want := filepath.Join(os.TempDir(), "picoclaw-missions"); cfg.PicoClaw.MissionBaseDir != want {
+		t.Errorf("picoclaw.mission_base_dir = %q, want %s", cfg.PicoClaw.MissionBaseDir, want)
 	}
-	if cfg.PicoClaw.DefaultTimeout != 5*time.Minute {
+	if time.Duration(cfg.PicoClaw.DefaultTimeout) != 5*time.Minute {
 		t.Errorf("picoclaw.default_timeout = %v, want 5m", cfg.PicoClaw.DefaultTimeout)
 	}
 	if cfg.PicoClaw.MaxConcurrent != 20 {
@@ -58,7 +60,7 @@ agents:
 	if cfg.PicoClaw.MissionBaseDir != "/data/missions" {
 		t.Errorf("picoclaw.mission_base_dir = %q", cfg.PicoClaw.MissionBaseDir)
 	}
-	if cfg.PicoClaw.DefaultTimeout != 10*time.Minute {
+	if time.Duration(cfg.PicoClaw.DefaultTimeout) != 10*time.Minute {
 		t.Errorf("picoclaw.default_timeout = %v, want 10m", cfg.PicoClaw.DefaultTimeout)
 	}
 	if cfg.PicoClaw.MaxConcurrent != 5 {
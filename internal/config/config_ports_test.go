@@ -0,0 +1,172 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPortsDefaults(t *testing.T) {
+	path := writeTemp(t, `
+agents:
+  db:
+    hostname: db.example.com
+    backend: http://db:8080
+    policy: on-demand
+    container:
+      name: db
+    health:
+      url: http://db:8080/health
+      startup_timeout: 90s
+    ports:
+      - listen: 5432
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ports := cfg.Agents["db"].Ports
+	if len(ports) != 1 {
+		t.Fatalf("expected 1 port, got %d", len(ports))
+	}
+	p := ports[0]
+	if p.Proto != "tcp" || p.Target != 5432 || time.Duration(p.WakeTimeout) != 90*time.Second {
+		t.Errorf("unexpected port defaults: %+v", p)
+	}
+}
+
+func TestPortsDuplicateListen(t *testing.T) {
+	path := writeTemp(t, `
+agents:
+  a:
+    hostname: a.example.com
+    backend: http://a:8080
+    policy: unmanaged
+    ports:
+      - listen: 5432
+  b:
+    hostname: b.example.com
+    backend: http://b:8080
+    policy: unmanaged
+    ports:
+      - listen: 5432
+        target: 5433
+`)
+	_, err := Load(path)
+	if err == nil || !strings.Contains(err.Error(), "duplicate port tcp/5432") {
+		t.Fatalf("expected duplicate port error, got %v", err)
+	}
+}
+
+func TestPortsInvalid(t *testing.T) {
+	path := writeTemp(t, `
+agents:
+  a:
+    hostname: a.example.com
+    backend: http://a:8080
+    policy: unmanaged
+    ports:
+      - listen: 70000
+`)
+	_, err := Load(path)
+	if err == nil || !strings.Contains(err.Error(), "between 1 and 65535") {
+		t.Fatalf("expected port range error, got %v", err)
+	}
+}
+
+func TestPortsUDPSharesNumberWithTCP(t *testing.T) {
+	path := writeTemp(t, `
+agents:
+  dns:
+    hostname: dns.example.com
+    backend: http://dns:8080
+    policy: unmanaged
+    ports:
+      - listen: 5353
+      - proto: udp
+        listen: 5353
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cfg.Agents["dns"].Ports[1].Proto; got != "udp" {
+		t.Errorf("proto = %q, want udp", got)
+	}
+}
+
+func TestPortsUnknownProto(t *testing.T) {
+	path := writeTemp(t, `
+agents:
+  a:
+    hostname: a.example.com
+    backend: http://a:8080
+    policy: unmanaged
+    ports:
+      - proto: sctp
+        listen: 9000
+`)
+	_, err := Load(path)
+	if err == nil || !strings.Contains(err.Error(), "unsupported proto") {
+		t.Fatalf("expected proto error, got %v", err)
+	}
+}
+
+func TestPublishDefaultsAndRange(t *testing.T) {
+	path := writeTemp(t, `
+agents:
+  kai:
+    hostname: kai.example.com
+    backend: http://kai:8080
+    policy: on-demand
+    container:
+      name: kai
+      publish:
+        - target: 8080
+    health:
+      url: http://kai:8080/health
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cfg.Agents["kai"].Container.Publish[0].Protocol; got != "tcp" {
+		t.Errorf("protocol = %q, want tcp", got)
+	}
+	min, max, err := cfg.PortRangeBounds()
+	if err != nil || min != 30000 || max != 30999 {
+		t.Errorf("default port range = %d-%d (%v)", min, max, err)
+	}
+}
+
+func TestPortRangeInvalid(t *testing.T) {
+	path := writeTemp(t, `
+port_range: "40000-30000"
+agents:
+  a:
+    hostname: a.example.com
+    backend: http://a:8080
+    policy: unmanaged
+`)
+	_, err := Load(path)
+	if err == nil || !strings.Contains(err.Error(), "port_range") {
+		t.Fatalf("expected port_range error, got %v", err)
+	}
+}
+
+func TestPublishRequiresManagedPolicy(t *testing.T) {
+	path := writeTemp(t, `
+agents:
+  a:
+    hostname: a.example.com
+    backend: http://a:8080
+    policy: unmanaged
+    container:
+      publish:
+        - target: 8080
+`)
+	_, err := Load(path)
+	if err == nil || !strings.Contains(err.Error(), "container.publish") {
+		t.Fatalf("expected container.publish error, got %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package config
+
+import "testing"
+
+func TestPowerDefaults(t *testing.T) {
+	cfg, err := Load(writeTemp(t, minimalAgent))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.WebhookWorkers != 5 || cfg.EventQueueSize != 4096 {
+		t.Errorf("workers, queue = %d, %d, want 5, 4096", cfg.WebhookWorkers, cfg.EventQueueSize)
+	}
+	if cfg.ReplayBuffer.Memory != 0 || cfg.Metrics.Sampling != nil {
+		t.Errorf("replay memory, sampling = %d, %v, want unset", cfg.ReplayBuffer.Memory, cfg.Metrics.SampleRate())
+	}
+
+	cfg, err = Load(writeTemp(t, "low_power: true\n"+minimalAgent))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.WebhookWorkers != 1 || cfg.EventQueueSize != 512 {
+		t.Errorf("low_power workers, queue = %d, %d, want 1, 512", cfg.WebhookWorkers, cfg.EventQueueSize)
+	}
+	if cfg.ReplayBuffer.Memory != 8<<20 || cfg.Metrics.SampleRate() != 0.1 {
+		t.Errorf("low_power replay memory, sampling = %d, %v, want 8MiB, 0.1", cfg.ReplayBuffer.Memory, cfg.Metrics.SampleRate())
+	}
+
+	// Explicit settings win over the profile.
+	cfg, err = Load(writeTemp(t, "low_power: true\nwebhook_workers: 3\nmetrics:\n  sampling: 1\n"+minimalAgent))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.WebhookWorkers != 3 || cfg.Metrics.SampleRate() != 1 {
+		t.Errorf("workers, sampling = %d, %v, want 3, 1", cfg.WebhookWorkers, cfg.Metrics.SampleRate())
+	}
+	cfg, err = Load(writeTemp(t, "low_power: true\nmetrics:\n  sampling: 0\n"+minimalAgent))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Metrics.Sampling == nil || cfg.Metrics.SampleRate() != 0 {
+		t.Errorf("explicit sampling: 0 became %v under low_power, want 0", cfg.Metrics.SampleRate())
+	}
+
+	if _, err := Load(writeTemp(t, "event_queue_size: -1\n"+minimalAgent)); err == nil {
+		t.Error("expected error for negative event_queue_size")
+	}
+}
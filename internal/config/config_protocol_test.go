@@ -0,0 +1,43 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBackendProtocol(t *testing.T) {
+	cfg, err := Load(writeTemp(t, minimalAgent+"    backend_protocol: h2c\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cfg.Agents["a"].BackendProtocol; got != "h2c" {
+		t.Errorf("backend_protocol = %q, want h2c", got)
+	}
+
+	for _, tc := range []struct {
+		yaml string
+		want string
+	}{
+		{minimalAgent + "    backend_protocol: http3\n", `backend_protocol must be "http1", "http2" or "h2c", got "http3"`},
+		{minimalAgent + "    backend_protocol: http2\n", "backend_protocol http2 needs https backends, got http://10.0.0.1:3000"},
+		{minimalAgent + "    backend_protocol: h2c\n    replicas: [https://10.0.0.2:3000]\n", "backend_protocol h2c needs http backends"},
+	} {
+		if _, err := Load(writeTemp(t, tc.yaml)); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("err = %v, want %q", err, tc.want)
+		}
+	}
+}
+
+func TestGRPC(t *testing.T) {
+	cfg, err := Load(writeTemp(t, minimalAgent+"    grpc: true\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.Agents["a"].GRPC {
+		t.Error("grpc not set")
+	}
+	want := "grpc needs HTTP/2, but backend_protocol is http1"
+	if _, err := Load(writeTemp(t, minimalAgent+"    grpc: true\n    backend_protocol: http1\n")); err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("err = %v, want %q", err, want)
+	}
+}
@@ -0,0 +1,21 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTrustedProxies(t *testing.T) {
+	cfg, err := Load(writeTemp(t, "trusted_proxies: [173.245.48.0/20, 10.0.0.1]\nclient_ip_header: CF-Connecting-IP\n"+minimalAgent))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.TrustedProxies) != 2 || cfg.ClientIPHeader != "CF-Connecting-IP" {
+		t.Errorf("trusted_proxies = %v, client_ip_header = %q", cfg.TrustedProxies, cfg.ClientIPHeader)
+	}
+
+	_, err = Load(writeTemp(t, "trusted_proxies: [10.0.0.0/40]\n"+minimalAgent))
+	if err == nil || !strings.Contains(err.Error(), "trusted_proxies") {
+		t.Errorf("expected trusted_proxies error, got %v", err)
+	}
+}
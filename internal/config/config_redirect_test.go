@@ -0,0 +1,52 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRedirects(t *testing.T) {
+	yaml := `
+agents:
+  a:
+    hostname: a.example.com
+    hostnames: [api.example.com]
+    backend: http://10.0.0.1:3000
+    policy: unmanaged
+    force_https: true
+redirects:
+  - from: www.a.example.com
+    to: a.example.com
+  - from: a.example.com/old
+    to: /new
+    code: 302
+`
+	cfg, err := Load(writeTemp(t, yaml))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	table, err := cfg.RedirectTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for host, want := range map[string]string{
+		"api.example.com":   "https://api.example.com/",
+		"www.a.example.com": "http://a.example.com/",
+	} {
+		w := httptest.NewRecorder()
+		if !table.Handle(w, httptest.NewRequest("GET", "http://"+host+"/", nil), host) || w.Header().Get("Location") != want {
+			t.Errorf("%s redirected to %q, want %q", host, w.Header().Get("Location"), want)
+		}
+	}
+	if w := httptest.NewRecorder(); !table.Handle(w, httptest.NewRequest("GET", "http://a.example.com/old", nil), "a.example.com") || w.Code != http.StatusMovedPermanently {
+		// force_https comes first, then the path rule on the HTTPS request.
+		t.Errorf("plain-HTTP /old: %d", w.Code)
+	}
+
+	_, err = Load(writeTemp(t, minimalAgent+"redirects:\n  - from: a.example.com\n    to: a.example.com\n"))
+	if err == nil || !strings.Contains(err.Error(), "redirects to itself") {
+		t.Errorf("expected self-redirect error, got %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRestartOnDegraded(t *testing.T) {
+	path := writeTemp(t, `
+agents:
+  friend:
+    hostname: friend.example.com
+    backend: http://friend:8080
+    policy: always-on
+    container:
+      name: friend
+    health:
+      url: http://friend:8080/health
+      restart_on_degraded: true
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	h := cfg.Agents["friend"].Health
+	if !h.RestartOnDegraded || time.Duration(h.RestartCooldown) != time.Minute {
+		t.Errorf("unexpected remediation config: %+v", h)
+	}
+}
+
+func TestRestartOnDegradedRequiresAlwaysOn(t *testing.T) {
+	path := writeTemp(t, `
+agents:
+  kai:
+    hostname: kai.example.com
+    backend: http://kai:8080
+    policy: on-demand
+    container:
+      name: kai
+    health:
+      url: http://kai:8080/health
+      restart_on_degraded: true
+`)
+	_, err := Load(path)
+	if err == nil || !strings.Contains(err.Error(), "restart_on_degraded") {
+		t.Fatalf("expected restart_on_degraded error, got %v", err)
+	}
+}
@@ -0,0 +1,30 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReplayBuffer(t *testing.T) {
+	dir := t.TempDir()
+	cfg, err := Load(writeTemp(t, minimalAgent+"    wake_hold: 30s\nreplay_buffer:\n  memory: 64MiB\n  disk: 2GiB\n  dir: "+dir+"\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.ReplayBuffer.Memory != 64<<20 || cfg.ReplayBuffer.Disk != 2<<30 || cfg.ReplayBuffer.Dir != dir {
+		t.Errorf("replay_buffer = %+v", cfg.ReplayBuffer)
+	}
+	if time.Duration(cfg.Agents["a"].WakeHold) != 30*time.Second {
+		t.Errorf("wake_hold = %s, want 30s", cfg.Agents["a"].WakeHold)
+	}
+
+	_, err = Load(writeTemp(t, minimalAgent+"replay_buffer:\n  dir: /nonexistent/warren\n"))
+	if err == nil || !strings.Contains(err.Error(), "replay_buffer.dir") {
+		t.Errorf("expected dir error, got %v", err)
+	}
+	_, err = Load(writeTemp(t, minimalAgent+"    wake_hold: -1s\n"))
+	if err == nil || !strings.Contains(err.Error(), "wake_hold must not be negative") {
+		t.Errorf("expected wake_hold error, got %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAgentReplicas(t *testing.T) {
+	base := `
+agents:
+  a:
+    hostname: a.example.com
+    backend: http://10.0.0.1:3000
+    policy: unmanaged
+`
+	cfg, err := Load(writeTemp(t, base+"    replicas: [http://10.0.0.2:3000]\n    balance: least-connections\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	a := cfg.Agents["a"]
+	if len(a.Replicas) != 1 || a.Balance != "least-connections" {
+		t.Errorf("replicas/balance = %v/%q", a.Replicas, a.Balance)
+	}
+
+	_, err = Load(writeTemp(t, base+"    replicas: [not-a-url]\n"))
+	if err == nil || !strings.Contains(err.Error(), "invalid replica URL") {
+		t.Errorf("expected replica URL error, got %v", err)
+	}
+
+	_, err = Load(writeTemp(t, base+"    balance: random\n"))
+	if err == nil || !strings.Contains(err.Error(), "balance must be") {
+		t.Errorf("expected balance error, got %v", err)
+	}
+}
+
+func TestAgentSticky(t *testing.T) {
+	base := `
+agents:
+  a:
+    hostname: a.example.com
+    backend: http://10.0.0.1:3000
+    policy: unmanaged
+`
+	cfg, err := Load(writeTemp(t, base+"    replicas: [http://10.0.0.2:3000]\n    sticky:\n      cookie: ui_pin\n      ttl: 8h\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if st := cfg.Agents["a"].Sticky; st == nil || st.Cookie != "ui_pin" || time.Duration(st.TTL).Hours() != 8 {
+		t.Errorf("sticky = %+v", st)
+	}
+
+	_, err = Load(writeTemp(t, base+"    sticky: {}\n"))
+	if err == nil || !strings.Contains(err.Error(), "sticky requires replicas") {
+		t.Errorf("expected replicas error, got %v", err)
+	}
+
+	_, err = Load(writeTemp(t, base+"    replicas: [http://10.0.0.2:3000]\n    sticky:\n      cookie: \"bad cookie\"\n"))
+	if err == nil || !strings.Contains(err.Error(), "not a valid cookie name") {
+		t.Errorf("expected cookie name error, got %v", err)
+	}
+}
@@ -0,0 +1,30 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAgentRetry(t *testing.T) {
+	base := `
+agents:
+  a:
+    hostname: a.example.com
+    backend: http://10.0.0.1:3000
+    policy: unmanaged
+    retry:
+`
+	cfg, err := Load(writeTemp(t, base+"      attempts: 5\n      delay: 100ms\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rt := cfg.Agents["a"].Retry; rt == nil || rt.Attempts != 5 || time.Duration(rt.Delay) != 100*time.Millisecond {
+		t.Errorf("retry = %+v", rt)
+	}
+
+	_, err = Load(writeTemp(t, base+"      attempts: -1\n"))
+	if err == nil || !strings.Contains(err.Error(), "retry settings must not be negative") {
+		t.Errorf("expected negative attempts error, got %v", err)
+	}
+}
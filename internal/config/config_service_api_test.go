@@ -0,0 +1,43 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestServiceAPI(t *testing.T) {
+	cert, key := writeKeyPair(t)
+	sa := "service_api:\n  listen: \":9443\"\n  cert_file: " + cert + "\n  key_file: " + key + "\n  tokens: [first-token, second-token]\n"
+	cfg, err := Load(writeTemp(t, sa+minimalAgent))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cfg.ServiceAPI; got.Listen != ":9443" || got.CertFile != cert || len(got.Tokens) != 2 {
+		t.Errorf("service_api = %+v", got)
+	}
+
+	t.Setenv("WARREN_SERVICE_API_TOKEN", "env-token")
+	cfg, err = Load(writeTemp(t, "service_api:\n  listen: \":9443\"\n"+minimalAgent))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cfg.ServiceAPI.Tokens; len(got) != 1 || got[0] != "env-token" {
+		t.Errorf("tokens = %v, want the env token", got)
+	}
+	t.Setenv("WARREN_SERVICE_API_TOKEN", "")
+
+	for _, tc := range []struct {
+		yaml string
+		want string
+	}{
+		{"service_api:\n  listen: \":9443\"\n", "service_api requires tokens"},
+		{"service_api:\n  listen: \":9443\"\n  tokens: [\"\"]\n", "tokens[0] must not be empty"},
+		{"service_api:\n  listen: \":9443\"\n  cert_file: " + cert + "\n  tokens: [t]\n", "both cert_file and key_file"},
+		{"service_api:\n  listen: \":9443\"\n  cert_file: " + key + "\n  key_file: " + key + "\n  tokens: [t]\n", "service_api:"},
+		{"admin_listen: \":9443\"\nservice_api:\n  listen: \":9443\"\n  tokens: [t]\n", `service_api.listen ":9443" is already used`},
+	} {
+		if _, err := Load(writeTemp(t, tc.yaml+minimalAgent)); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("err = %v, want %q", err, tc.want)
+		}
+	}
+}
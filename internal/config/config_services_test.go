@@ -0,0 +1,38 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestServices(t *testing.T) {
+	cfg, err := Load(writeTemp(t, minimalAgent+`services:
+  dash.example.com:
+    target: http://10.0.0.2:3000
+    agent: a
+    replicas: [http://10.0.0.3:3000]
+    wake: true
+    max_body: 2GiB
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	svc := cfg.Services["dash.example.com"]
+	if svc == nil || svc.Target != "http://10.0.0.2:3000" || svc.Agent != "a" || !svc.Wake || len(svc.Replicas) != 1 || svc.MaxBody != 2<<30 {
+		t.Errorf("service = %+v", svc)
+	}
+
+	for _, tc := range []struct{ yaml, want string }{
+		{"services:\n  a.example.com:\n    target: http://10.0.0.2:3000\n", `service "a.example.com" hostname is already routed to agent "a"`},
+		{"services:\n  dash.example.com:\n    target: ftp://10.0.0.2\n", `service "dash.example.com" target "ftp://10.0.0.2" must be an http(s) URL`},
+		{"services:\n  dash.example.com: {}\n", `service "dash.example.com" target "" must be an http(s) URL`},
+		{"services:\n  dash.example.com:\n    target: http://10.0.0.2:3000\n    weights: [90, 10]\n", `service "dash.example.com" needs one weight per target`},
+		{"services:\n  dash.example.com:\n    target: http://10.0.0.2:3000\n    replicas: [http://10.0.0.3:3000]\n    sticky:\n      cookie: \"pin;x\"\n", `service "dash.example.com" sticky.cookie "pin;x" is not a valid cookie name`},
+		{"services:\n  \"-bad\":\n    target: http://10.0.0.2:3000\n", `service "-bad" invalid hostname`},
+	} {
+		_, err := Load(writeTemp(t, minimalAgent+tc.yaml))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%q: expected %q, got %v", tc.yaml, tc.want, err)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAgentSLA(t *testing.T) {
+	base := `
+agents:
+  a:
+    hostname: a.example.com
+    backend: http://10.0.0.1:3000
+    policy: unmanaged
+    sla:
+`
+	cfg, err := Load(writeTemp(t, base+"      target: 99.5\n      window: 7d\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sla := cfg.Agents["a"].SLA; sla == nil || sla.Target != 99.5 || time.Duration(sla.Window) != 7*24*time.Hour {
+		t.Errorf("sla = %+v", sla)
+	}
+
+	for _, bad := range []string{"      target: 0\n", "      target: 100\n", "      target: 0.995\n      window: 30s\n"} {
+		_, err = Load(writeTemp(t, base+bad))
+		if err == nil || !strings.Contains(err.Error(), "sla.") {
+			t.Errorf("%q: expected sla error, got %v", bad, err)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSleepVetoConfig(t *testing.T) {
+	yaml := `
+agents:
+  a:
+    hostname: a.example.com
+    backend: http://localhost:3000
+    policy: on-demand
+    container:
+      name: a-svc
+    health:
+      url: http://localhost:3000/health
+    sleep:
+      veto_url: http://localhost:3000/can-sleep
+`
+	cfg, err := Load(writeTemp(t, yaml))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s := cfg.Agents["a"].Sleep
+	if s.VetoURL != "http://localhost:3000/can-sleep" || time.Duration(s.VetoDefer) != 5*time.Minute {
+		t.Errorf("sleep = %+v", s)
+	}
+}
+
+func TestSleepVetoConfigInvalid(t *testing.T) {
+	tests := map[string]string{
+		"requires on-demand": `
+agents:
+  a:
+    hostname: a.example.com
+    backend: http://localhost:3000
+    policy: unmanaged
+    sleep:
+      veto_url: http://localhost:3000/can-sleep
+`,
+		"invalid sleep.veto_url": `
+agents:
+  a:
+    hostname: a.example.com
+    backend: http://localhost:3000
+    policy: on-demand
+    container:
+      name: a-svc
+    health:
+      url: http://localhost:3000/health
+    sleep:
+      veto_url: file:///etc/passwd
+`,
+	}
+	for want, yaml := range tests {
+		_, err := Load(writeTemp(t, yaml))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error containing %q, got %v", want, err)
+		}
+	}
+}
+
+func TestPredictiveWake(t *testing.T) {
+	path := writeTemp(t, `
+agents:
+  kai:
+    hostname: kai.example.com
+    backend: http://kai:8080
+    policy: on-demand
+    container:
+      name: kai
+    health:
+      url: http://kai:8080/health
+    idle:
+      predictive_wake: true
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if idle := cfg.Agents["kai"].Idle; !idle.PredictiveWake || time.Duration(idle.PredictiveLead) != 5*time.Minute {
+		t.Errorf("unexpected idle config: %+v", idle)
+	}
+}
+
+func TestCPUActivity(t *testing.T) {
+	path := writeTemp(t, `
+agents:
+  kai:
+    hostname: kai.example.com
+    backend: http://kai:8080
+    policy: on-demand
+    container:
+      name: kai
+    health:
+      url: http://kai:8080/health
+    idle:
+      cpu_threshold: 15
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if idle := cfg.Agents["kai"].Idle; idle.CPUThreshold != 15 || time.Duration(idle.CPUSampleInterval) != 30*time.Second {
+		t.Errorf("unexpected idle config: %+v", idle)
+	}
+
+	_, err = Load(writeTemp(t, `
+agents:
+  a:
+    hostname: a.example.com
+    backend: http://localhost:3000
+    policy: unmanaged
+    idle:
+      cpu_threshold: 15
+`))
+	if err == nil || !strings.Contains(err.Error(), "cpu_threshold requires on-demand") {
+		t.Errorf("expected on-demand error, got %v", err)
+	}
+}
+
+func TestIdleMode(t *testing.T) {
+	base := `
+agents:
+  kai:
+    hostname: kai.example.com
+    backend: http://kai:8080
+    policy: on-demand
+    container:
+      name: kai
+    health:
+      url: http://kai:8080/health
+`
+	cfg, err := Load(writeTemp(t, base))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if mode := cfg.Agents["kai"].Idle.Mode; mode != "stop" {
+		t.Errorf("default idle.mode = %q, want stop", mode)
+	}
+
+	cfg, err = Load(writeTemp(t, base+"    idle:\n      mode: pause\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if mode := cfg.Agents["kai"].Idle.Mode; mode != "pause" {
+		t.Errorf("idle.mode = %q, want pause", mode)
+	}
+
+	_, err = Load(writeTemp(t, base+"    idle:\n      mode: freeze\n"))
+	if err == nil || !strings.Contains(err.Error(), `idle.mode must be "stop" or "pause"`) {
+		t.Errorf("expected idle.mode error, got %v", err)
+	}
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSplashTemplateConfig(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "splash.html")
+	os.WriteFile(good, []byte(`<p>Waking {{.Agent}}</p>`), 0644)
+	bad := filepath.Join(dir, "bad.html")
+	os.WriteFile(bad, []byte(`<p>{{.Agent</p>`), 0644)
+
+	base := `
+agents:
+  a:
+    hostname: a.example.com
+    backend: http://localhost:3000
+    policy: unmanaged
+`
+	cfg, err := Load(writeTemp(t, "splash_template: "+good+"\n"+base+"    splash_template: "+good+"\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.SplashTemplate != good || cfg.Agents["a"].SplashTemplate != good {
+		t.Errorf("splash templates not loaded: %q / %q", cfg.SplashTemplate, cfg.Agents["a"].SplashTemplate)
+	}
+
+	_, err = Load(writeTemp(t, "splash_template: "+bad+"\n"+base))
+	if err == nil || !strings.Contains(err.Error(), "splash_template") {
+		t.Errorf("expected top-level splash_template error, got %v", err)
+	}
+
+	_, err = Load(writeTemp(t, base+"    splash_template: "+bad+"\n"))
+	if err == nil || !strings.Contains(err.Error(), `agent "a" invalid splash_template`) {
+		t.Errorf("expected agent splash_template error, got %v", err)
+	}
+}
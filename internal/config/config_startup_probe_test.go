@@ -0,0 +1,29 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStartupProbeDefaults(t *testing.T) {
+	path := writeTemp(t, `
+agents:
+  kai:
+    hostname: kai.example.com
+    backend: http://kai:8080
+    policy: on-demand
+    container:
+      name: kai
+    health:
+      url: http://kai:8080/health
+      tcp_precheck: true
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	h := cfg.Agents["kai"].Health
+	if time.Duration(h.StartupProbe) != 250*time.Millisecond || time.Duration(h.StartupProbeMax) != 2*time.Second || !h.TCPPrecheck {
+		t.Errorf("unexpected startup probe config: %+v", h)
+	}
+}
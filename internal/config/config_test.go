@@ -49,20 +49,23 @@ agents:
 	if cfg.Listen != ":8080" {
 		t.Errorf("default listen = %q, want %q", cfg.Listen, ":8080")
 	}
-	if cfg.Defaults.HealthCheckInterval != 30*time.Second {
+	if time.Duration(cfg.Defaults.HealthCheckInterval) != 30*time.Second {
 		t.Errorf("default health_check_interval = %v, want 30s", cfg.Defaults.HealthCheckInterval)
 	}
+	if time.Duration(cfg.TrashRetention) != 24*time.Hour {
+		t.Errorf("default trash_retention = %v, want 24h", cfg.TrashRetention)
+	}
 	a := cfg.Agents["a"]
-	if a.Health.CheckInterval != 30*time.Second {
+	if time.Duration(a.Health.CheckInterval) != 30*time.Second {
 		t.Errorf("agent health check_interval = %v, want 30s", a.Health.CheckInterval)
 	}
-	if a.Health.StartupTimeout != 60*time.Second {
+	if time.Duration(a.Health.StartupTimeout) != 60*time.Second {
 		t.Errorf("agent startup_timeout = %v, want 60s", a.Health.StartupTimeout)
 	}
 	if a.Health.MaxFailures != 3 {
 		t.Errorf("agent max_failures = %d, want 3", a.Health.MaxFailures)
 	}
-	if a.Idle.DrainTimeout != 30*time.Second {
+	if time.Duration(a.Idle.DrainTimeout) != 30*time.Second {
 		t.Errorf("agent drain_timeout = %v, want 30s", a.Idle.DrainTimeout)
 	}
 }
@@ -85,7 +88,7 @@ agents:
 		t.Fatalf("unexpected error: %v", err)
 	}
 	a := cfg.Agents["a"]
-	if a.Idle.Timeout != 30*time.Minute {
+	if time.Duration(a.Idle.Timeout) != 30*time.Minute {
 		t.Errorf("on-demand default idle timeout = %v, want 30m", a.Idle.Timeout)
 	}
 }
@@ -0,0 +1,31 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAgentTimeouts(t *testing.T) {
+	base := `
+agents:
+  a:
+    hostname: a.example.com
+    backend: http://10.0.0.1:3000
+    policy: unmanaged
+    timeouts:
+`
+	cfg, err := Load(writeTemp(t, base+"      dial: 5s\n      response_header: 15m\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	to := cfg.Agents["a"].Timeouts
+	if to == nil || time.Duration(to.Dial) != 5*time.Second || time.Duration(to.ResponseHeader) != 15*time.Minute || to.Idle != 0 {
+		t.Errorf("timeouts = %+v", to)
+	}
+
+	_, err = Load(writeTemp(t, base+"      idle: -1s\n"))
+	if err == nil || !strings.Contains(err.Error(), "timeouts must not be negative") {
+		t.Errorf("expected negative timeout error, got %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTLSPassthrough(t *testing.T) {
+	yaml := "tls_listen: \":443\"\n" + minimalAgent + `    health:
+      startup_timeout: 45s
+    tls_passthrough: {}
+`
+	cfg, err := Load(writeTemp(t, yaml))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tp := cfg.Agents["a"].TLSPassthrough
+	if tp == nil || tp.Port != 443 || time.Duration(tp.WakeTimeout) != 45*time.Second {
+		t.Fatalf("tls_passthrough = %+v, want port 443 and wake_timeout 45s", tp)
+	}
+
+	for _, tc := range []struct {
+		yaml string
+		want string
+	}{
+		{minimalAgent + "    tls_passthrough:\n      port: 8443\n", "tls_passthrough requires tls_listen"},
+		{"tls_listen: \":443\"\n" + minimalAgent + "    tls_passthrough:\n      port: 70000\n", "tls_passthrough.port must be between 1 and 65535"},
+		{"tls_listen: \":443\"\n" + minimalAgent + "    tls_passthrough:\n      wake_timeout: -1s\n", "wake_timeout must not be negative"},
+		{"listen: \":443\"\ntls_listen: \":443\"\n" + minimalAgent, `tls_listen ":443" is already used`},
+		{"admin_listen: \":443\"\ntls_listen: \":443\"\n" + minimalAgent, `tls_listen ":443" is already used`},
+	} {
+		if _, err := Load(writeTemp(t, tc.yaml)); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("err = %v, want %q", err, tc.want)
+		}
+	}
+}
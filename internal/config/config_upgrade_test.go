@@ -0,0 +1,30 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUpgradeDrainTimeout(t *testing.T) {
+	cfg, err := Load(writeTemp(t, minimalAgent))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if time.Duration(cfg.UpgradeDrainTimeout) != time.Hour {
+		t.Errorf("upgrade_drain_timeout = %v, want default 1h", cfg.UpgradeDrainTimeout)
+	}
+
+	cfg, err = Load(writeTemp(t, "upgrade_drain_timeout: 10m\n"+minimalAgent))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if time.Duration(cfg.UpgradeDrainTimeout) != 10*time.Minute {
+		t.Errorf("upgrade_drain_timeout = %v, want 10m", cfg.UpgradeDrainTimeout)
+	}
+
+	_, err = Load(writeTemp(t, "upgrade_drain_timeout: -1m\n"+minimalAgent))
+	if err == nil || !strings.Contains(err.Error(), "upgrade_drain_timeout") {
+		t.Errorf("expected upgrade_drain_timeout error, got %v", err)
+	}
+}
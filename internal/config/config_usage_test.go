@@ -20,10 +20,10 @@ agents:
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	if cfg.Usage.FlushInterval != 30*time.Second {
+	if time.Duration(cfg.Usage.FlushInterval) != 30*time.Second {
 		t.Errorf("usage flush_interval = %v, want 30s", cfg.Usage.FlushInterval)
 	}
-	if cfg.Usage.PollInterval != 5*time.Second {
+	if time.Duration(cfg.Usage.PollInterval) != 5*time.Second {
 		t.Errorf("usage poll_interval = %v, want 5s", cfg.Usage.PollInterval)
 	}
 	if cfg.Usage.JSONLPath == "" {
@@ -60,10 +60,10 @@ agents:
 	if cfg.Usage.JSONLPath != "/custom/path.jsonl" {
 		t.Errorf("usage.jsonl_path = %q", cfg.Usage.JSONLPath)
 	}
-	if cfg.Usage.FlushInterval != 60*time.Second {
+	if time.Duration(cfg.Usage.FlushInterval) != 60*time.Second {
 		t.Errorf("usage.flush_interval = %v, want 60s", cfg.Usage.FlushInterval)
 	}
-	if cfg.Usage.PollInterval != 10*time.Second {
+	if time.Duration(cfg.Usage.PollInterval) != 10*time.Second {
 		t.Errorf("usage.poll_interval = %v, want 10s", cfg.Usage.PollInterval)
 	}
 }
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWakeBudget(t *testing.T) {
+	path := writeTemp(t, `
+agents:
+  kai:
+    hostname: kai.example.com
+    backend: http://kai:8080
+    policy: on-demand
+    container:
+      name: kai
+    health:
+      url: http://kai:8080/health
+    wake:
+      budget:
+        max_per_day: 50
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b := cfg.Agents["kai"].Wake.Budget
+	if b.MaxPerDay != 50 || b.Action != "block" {
+		t.Errorf("budget = %+v, want 50 a day with action block", b)
+	}
+
+	for name, tc := range map[string]struct{ policy, budget, want string }{
+		"always-on":  {"always-on", "{max_per_day: 5}", "requires on-demand"},
+		"zero":       {"on-demand", "{max_per_day: 0}", "max_per_day"},
+		"bad action": {"on-demand", "{max_per_day: 5, action: sleep}", "action"},
+	} {
+		_, err := Load(writeTemp(t, "agents:\n  kai:\n    hostname: kai.example.com\n    backend: http://kai:8080\n    policy: "+tc.policy+
+			"\n    container:\n      name: kai\n    health:\n      url: http://kai:8080/health\n    wake:\n      budget: "+tc.budget+"\n"))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: error = %v, want %q", name, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMaxWebSockets(t *testing.T) {
+	cfg, err := Load(writeTemp(t, minimalAgent+"    max_websockets: 50\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, agent := range cfg.Agents {
+		if agent.MaxWebSockets != 50 {
+			t.Errorf("max_websockets = %d, want 50", agent.MaxWebSockets)
+		}
+	}
+
+	_, err = Load(writeTemp(t, minimalAgent+"    max_websockets: -1\n"))
+	if err == nil || !strings.Contains(err.Error(), "max_websockets must not be negative") {
+		t.Errorf("expected negative error, got %v", err)
+	}
+}
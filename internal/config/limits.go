@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Limits bounds what a config may contain, so a hostile or broken file
+// can't exhaust memory while it's parsed. Zero fields are unlimited.
+type Limits struct {
+	MaxBytes  int64 // size of the file
+	MaxAgents int
+	MaxDepth  int // nesting of mappings and lists
+	MaxNodes  int // YAML nodes, counting each alias as a copy of its anchor
+}
+
+// DefaultLimits are applied by Load. They're far above any real
+// deployment's needs.
+var DefaultLimits = Limits{
+	MaxBytes:  4 << 20,
+	MaxAgents: 1000,
+	MaxDepth:  32,
+	MaxNodes:  200_000,
+}
+
+// checkTree walks the document as it will be decoded, following aliases,
+// and fails as soon as it's deeper or larger than the limits allow. A
+// "billion laughs" document is stopped after MaxNodes steps instead of
+// being expanded.
+func (l Limits) checkTree(doc *yaml.Node) error {
+	nodes := 0
+	var walk func(n *yaml.Node, depth int) error
+	walk = func(n *yaml.Node, depth int) error {
+		nodes++
+		if l.MaxNodes > 0 && nodes > l.MaxNodes {
+			return fmt.Errorf("config: more than %d YAML nodes once aliases are expanded", l.MaxNodes)
+		}
+		if n.Kind == yaml.MappingNode || n.Kind == yaml.SequenceNode {
+			depth++
+			if l.MaxDepth > 0 && depth > l.MaxDepth {
+				return fmt.Errorf("config: line %d: nested more than %d levels deep", n.Line, l.MaxDepth)
+			}
+		}
+		if n.Kind == yaml.AliasNode && n.Alias != nil {
+			return walk(n.Alias, depth)
+		}
+		for _, c := range n.Content {
+			if err := walk(c, depth); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(doc, 0)
+}
@@ -1,10 +1,26 @@
 package config
 
 import (
+	"crypto/tls"
 	"fmt"
+	"html/template"
+	"net/netip"
 	"net/url"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"time"
 
+	"warren/internal/auth"
+	"warren/internal/balance"
+	"warren/internal/dnscheck"
+	"warren/internal/headers"
+	"warren/internal/labels"
+	"warren/internal/realip"
 	"warren/internal/security"
+	"warren/internal/transport"
 )
 
 func validate(cfg *Config) error {
@@ -12,7 +28,135 @@ func validate(cfg *Config) error {
 		return fmt.Errorf("config: no agents defined")
 	}
 
+	if cfg.SplashTemplate != "" {
+		if _, err := template.ParseFiles(cfg.SplashTemplate); err != nil {
+			return fmt.Errorf("config: invalid splash_template: %w", err)
+		}
+	}
+
+	if _, err := cfg.RedirectTable(); err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+
+	if err := validateErrorPages(cfg.ErrorPages); err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+
+	if cfg.ReplayBuffer.Memory < 0 {
+		return fmt.Errorf("config: replay_buffer.memory must not be negative")
+	}
+	if cfg.ReplayBuffer.Disk < 0 {
+		return fmt.Errorf("config: replay_buffer.disk must not be negative")
+	}
+	if dir := cfg.ReplayBuffer.Dir; dir != "" {
+		if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+			return fmt.Errorf("config: replay_buffer.dir %q is not a directory", dir)
+		}
+	}
+
+	if cfg.WebhookWorkers < 0 {
+		return fmt.Errorf("config: webhook_workers must not be negative")
+	}
+	if cfg.EventQueueSize < 0 {
+		return fmt.Errorf("config: event_queue_size must not be negative")
+	}
+
+	if s := cfg.Metrics.SampleRate(); s < 0 || s > 1 {
+		return fmt.Errorf("config: metrics.sampling must be between 0 and 1, got %v", s)
+	}
+	if _, err := realip.New(cfg.TrustedProxies, cfg.ClientIPHeader); err != nil {
+		return fmt.Errorf("config: trusted_proxies: %w", err)
+	}
+
+	if cfg.HeartbeatURL != "" {
+		if u, err := url.Parse(cfg.HeartbeatURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("config: heartbeat_url must be an http or https URL, got %q", cfg.HeartbeatURL)
+		}
+		if cfg.HeartbeatInterval < 0 {
+			return fmt.Errorf("config: heartbeat_interval must not be negative")
+		}
+	}
+
+	if cfg.UpgradeDrainTimeout < 0 {
+		return fmt.Errorf("config: upgrade_drain_timeout must not be negative")
+	}
+
+	if cfg.TLSListen != "" && (cfg.TLSListen == cfg.Listen || cfg.TLSListen == cfg.AdminListen) {
+		return fmt.Errorf("config: tls_listen %q is already used by another listener", cfg.TLSListen)
+	}
+
+	if h3 := cfg.HTTP3; h3.Listen != "" {
+		if h3.CertFile == "" || h3.KeyFile == "" {
+			return fmt.Errorf("config: http3 requires cert_file and key_file")
+		}
+		if _, err := tls.LoadX509KeyPair(h3.CertFile, h3.KeyFile); err != nil {
+			return fmt.Errorf("config: http3: %w", err)
+		}
+		// It may share tls_listen, which hands it the TLS connections
+		// passthrough doesn't route.
+		if h3.Listen == cfg.Listen || h3.Listen == cfg.AdminListen {
+			return fmt.Errorf("config: http3.listen %q is already used by another listener", h3.Listen)
+		}
+	}
+
+	if sa := cfg.ServiceAPI; sa.Listen != "" {
+		if sa.Listen == cfg.Listen || sa.Listen == cfg.TLSListen || sa.Listen == cfg.AdminListen || sa.Listen == cfg.HTTP3.Listen {
+			return fmt.Errorf("config: service_api.listen %q is already used by another listener", sa.Listen)
+		}
+		if (sa.CertFile == "") != (sa.KeyFile == "") {
+			return fmt.Errorf("config: service_api needs both cert_file and key_file, or neither")
+		}
+		if sa.CertFile != "" {
+			if _, err := tls.LoadX509KeyPair(sa.CertFile, sa.KeyFile); err != nil {
+				return fmt.Errorf("config: service_api: %w", err)
+			}
+		}
+		if len(sa.Tokens) == 0 {
+			return fmt.Errorf("config: service_api requires tokens (or WARREN_SERVICE_API_TOKEN)")
+		}
+		for i, token := range sa.Tokens {
+			if token == "" {
+				return fmt.Errorf("config: service_api.tokens[%d] must not be empty", i)
+			}
+		}
+	}
+
+	if cfg.DockerHost != "" {
+		if err := validateDockerHost(cfg.DockerHost); err != nil {
+			return fmt.Errorf("config: %w", err)
+		}
+	}
+
+	if b := cfg.Bans; b.Enabled {
+		if b.MaxStrikes < 0 || b.Window < 0 || b.Duration < 0 {
+			return fmt.Errorf("config: bans max_strikes, window and duration must not be negative")
+		}
+		if _, err := dnscheck.ParsePrefixes(b.Ignore); err != nil {
+			return fmt.Errorf("config: bans.ignore: %w", err)
+		}
+	}
+
+	if len(cfg.DNSCheck.PublicIPs) > 0 {
+		if _, err := dnscheck.ParsePrefixes(cfg.DNSCheck.PublicIPs); err != nil {
+			return fmt.Errorf("config: dns_check.public_ips: %w", err)
+		}
+		if cfg.DNSCheck.Interval < 0 {
+			return fmt.Errorf("config: dns_check.interval must not be negative")
+		}
+	}
+
+	if err := validateDNS(cfg.DNS); err != nil {
+		return err
+	}
+
+	if cfg.PortRange != "" {
+		if _, _, err := cfg.PortRangeBounds(); err != nil {
+			return err
+		}
+	}
+
 	hostnames := make(map[string]string) // hostname → agent name
+	ports := make(map[string]string)     // "proto/listen" → agent name
 	for name, agent := range cfg.Agents {
 		if agent.Hostname == "" {
 			return fmt.Errorf("config: agent %q missing hostname", name)
@@ -23,6 +167,77 @@ func validate(cfg *Config) error {
 		if _, err := url.Parse(agent.Backend); err != nil {
 			return fmt.Errorf("config: agent %q invalid backend URL: %w", name, err)
 		}
+		for _, replica := range agent.Replicas {
+			if u, err := url.Parse(replica); err != nil || u.Scheme == "" || u.Host == "" {
+				return fmt.Errorf("config: agent %q invalid replica URL %q", name, replica)
+			}
+		}
+		switch agent.Balance {
+		case "", "round-robin", "least-connections":
+			// valid
+		default:
+			return fmt.Errorf("config: agent %q balance must be \"round-robin\" or \"least-connections\", got %q", name, agent.Balance)
+		}
+		if err := validateBackendProtocol(agent); err != nil {
+			return fmt.Errorf("config: agent %q %v", name, err)
+		}
+		if cb := agent.CircuitBreaker; cb != nil {
+			if cb.Threshold <= 0 || cb.Threshold > 1 {
+				return fmt.Errorf("config: agent %q circuit_breaker.threshold must be between 0 and 1, got %v", name, cb.Threshold)
+			}
+			if cb.MinRequests < 0 || cb.Window < 0 || cb.OpenFor < 0 {
+				return fmt.Errorf("config: agent %q circuit_breaker settings must not be negative", name)
+			}
+		}
+		if sla := agent.SLA; sla != nil {
+			if sla.Target <= 0 || sla.Target >= 100 {
+				return fmt.Errorf("config: agent %q sla.target must be a percentage between 0 and 100, got %v", name, sla.Target)
+			}
+			if sla.Window < 0 || (sla.Window > 0 && time.Duration(sla.Window) < time.Minute) {
+				return fmt.Errorf("config: agent %q sla.window must be at least 1m", name)
+			}
+		}
+		if rt := agent.Retry; rt != nil && (rt.Attempts < 0 || rt.Delay < 0) {
+			return fmt.Errorf("config: agent %q retry settings must not be negative", name)
+		}
+		if to := agent.Timeouts; to != nil && (to.Dial < 0 || to.ResponseHeader < 0 || to.Idle < 0) {
+			return fmt.Errorf("config: agent %q timeouts must not be negative", name)
+		}
+		for _, p := range agent.AllowedPaths {
+			if p == "" {
+				return fmt.Errorf("config: agent %q allowed_paths must not contain an empty pattern", name)
+			}
+			if _, err := path.Match(p, ""); err != nil {
+				return fmt.Errorf("config: agent %q allowed_paths: invalid pattern %q", name, p)
+			}
+		}
+
+		if c := agent.Cache; c != nil {
+			if err := c.validate(); err != nil {
+				return fmt.Errorf("config: agent %q %v", name, err)
+			}
+		}
+		if c := agent.CORS; c != nil {
+			if _, err := c.Policy(); err != nil {
+				return fmt.Errorf("config: agent %q %v", name, err)
+			}
+		}
+		if h := agent.Headers; h != nil {
+			if _, err := headers.New(*h); err != nil {
+				return fmt.Errorf("config: agent %q %v", name, err)
+			}
+		}
+		if st := agent.Sticky; st != nil {
+			if len(agent.Replicas) == 0 {
+				return fmt.Errorf("config: agent %q sticky requires replicas", name)
+			}
+			if st.TTL < 0 {
+				return fmt.Errorf("config: agent %q sticky.ttl must not be negative", name)
+			}
+			if st.Cookie != "" && !balance.ValidCookieName(st.Cookie) {
+				return fmt.Errorf("config: agent %q sticky.cookie %q is not a valid cookie name", name, st.Cookie)
+			}
+		}
 
 		switch agent.Policy {
 		case "always-on", "unmanaged", "on-demand":
@@ -69,6 +284,207 @@ func validate(cfg *Config) error {
 			hostnames[h] = name
 		}
 
+		for _, pub := range agent.Container.Publish {
+			if agent.Policy == "unmanaged" {
+				return fmt.Errorf("config: agent %q container.publish requires a managed policy", name)
+			}
+			if pub.Protocol != "tcp" && pub.Protocol != "udp" {
+				return fmt.Errorf("config: agent %q container.publish: unsupported protocol %q", name, pub.Protocol)
+			}
+			if pub.Target < 1 || pub.Target > 65535 || pub.Published < 0 || pub.Published > 65535 {
+				return fmt.Errorf("config: agent %q container.publish: target and published must be valid ports", name)
+			}
+			if pub.Published > 0 {
+				key := fmt.Sprintf("host %s/%d", pub.Protocol, pub.Published)
+				if prev, ok := ports[key]; ok {
+					return fmt.Errorf("config: duplicate published port %d (agents %q and %q)", pub.Published, prev, name)
+				}
+				ports[key] = name
+			}
+		}
+
+		for _, port := range agent.Ports {
+			if port.Proto != "tcp" && port.Proto != "udp" {
+				return fmt.Errorf("config: agent %q ports: unsupported proto %q", name, port.Proto)
+			}
+			if port.Listen < 1 || port.Listen > 65535 || port.Target < 1 || port.Target > 65535 {
+				return fmt.Errorf("config: agent %q ports: listen and target must be between 1 and 65535", name)
+			}
+			if port.WakeTimeout < 0 {
+				return fmt.Errorf("config: agent %q ports: wake_timeout must not be negative", name)
+			}
+			key := fmt.Sprintf("%s/%d", port.Proto, port.Listen)
+			if prev, ok := ports[key]; ok {
+				return fmt.Errorf("config: duplicate port %s (agents %q and %q)", key, prev, name)
+			}
+			ports[key] = name
+		}
+
+		if tp := agent.TLSPassthrough; tp != nil {
+			if cfg.TLSListen == "" {
+				return fmt.Errorf("config: agent %q tls_passthrough requires tls_listen", name)
+			}
+			if tp.Port < 1 || tp.Port > 65535 {
+				return fmt.Errorf("config: agent %q tls_passthrough.port must be between 1 and 65535", name)
+			}
+			if tp.WakeTimeout < 0 {
+				return fmt.Errorf("config: agent %q tls_passthrough.wake_timeout must not be negative", name)
+			}
+		}
+
+		if agent.BasicAuth != nil {
+			entries, err := agent.BasicAuth.Entries()
+			if err != nil {
+				return fmt.Errorf("config: agent %q basic_auth: %w", name, err)
+			}
+			if _, err := auth.ParseHtpasswd(entries); err != nil {
+				return fmt.Errorf("config: agent %q %w", name, err)
+			}
+			if cfg.ProxyToken != "" && !agent.BasicAuth.ReplaceProxyToken {
+				return fmt.Errorf("config: agent %q basic_auth would replace proxy_token for its hostnames; set basic_auth.replace_proxy_token to confirm", name)
+			}
+		}
+
+		if agent.SplashTemplate != "" {
+			if _, err := template.ParseFiles(agent.SplashTemplate); err != nil {
+				return fmt.Errorf("config: agent %q invalid splash_template: %w", name, err)
+			}
+		}
+
+		for key := range agent.Annotations {
+			if key == "" || strings.ContainsAny(key, "= \t\n") {
+				return fmt.Errorf("config: agent %q annotation key %q must be non-empty without spaces or '='", name, key)
+			}
+		}
+		if err := labels.Validate(agent.Labels); err != nil {
+			return fmt.Errorf("config: agent %q %w", name, err)
+		}
+		if agent.WakeHold < 0 {
+			return fmt.Errorf("config: agent %q wake_hold must not be negative", name)
+		}
+
+		if err := validateErrorPages(agent.ErrorPages); err != nil {
+			return fmt.Errorf("config: agent %q %w", name, err)
+		}
+
+		if agent.ForwardAuth != nil {
+			if agent.BasicAuth != nil {
+				return fmt.Errorf("config: agent %q cannot use both basic_auth and forward_auth", name)
+			}
+			u, err := url.Parse(agent.ForwardAuth.Address)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("config: agent %q forward_auth.address must be an http(s) URL", name)
+			}
+		}
+
+		if agent.Health.CrashWindow < 0 || agent.Health.RestartBackoff < 0 || agent.Health.MaxRestartBackoff < 0 {
+			return fmt.Errorf("config: agent %q health crash_window and restart backoffs must not be negative", name)
+		}
+		if agent.Health.CrashLoop() < 0 {
+			return fmt.Errorf("config: agent %q health.crash_loop_threshold must not be negative", name)
+		}
+		if agent.Health.MaxRestartBackoff < agent.Health.RestartBackoff {
+			return fmt.Errorf("config: agent %q health.max_restart_backoff must be at least restart_backoff", name)
+		}
+
+		if agent.Health.RestartOnDegraded && agent.Policy != "always-on" {
+			return fmt.Errorf("config: agent %q health.restart_on_degraded requires always-on policy", name)
+		}
+		if agent.Health.RestartCooldown < 0 {
+			return fmt.Errorf("config: agent %q health.restart_cooldown must not be negative", name)
+		}
+
+		if agent.Health.StartupProbe < 0 {
+			return fmt.Errorf("config: agent %q health.startup_probe must not be negative", name)
+		}
+		if agent.Health.StartupProbeMax < agent.Health.StartupProbe {
+			return fmt.Errorf("config: agent %q health.startup_probe_max must be at least startup_probe", name)
+		}
+
+		switch agent.Idle.Mode {
+		case "", "stop":
+		case "pause":
+			if agent.Policy != "on-demand" {
+				return fmt.Errorf("config: agent %q idle.mode pause requires on-demand policy", name)
+			}
+		default:
+			return fmt.Errorf("config: agent %q idle.mode must be \"stop\" or \"pause\", got %q", name, agent.Idle.Mode)
+		}
+		if agent.Wake != nil && agent.Wake.Budget != nil {
+			b := agent.Wake.Budget
+			if agent.Policy != "on-demand" {
+				return fmt.Errorf("config: agent %q wake.budget requires on-demand policy", name)
+			}
+			if b.MaxPerDay <= 0 {
+				return fmt.Errorf("config: agent %q wake.budget.max_per_day must be positive", name)
+			}
+			if b.Action != "block" && b.Action != "alert" {
+				return fmt.Errorf("config: agent %q wake.budget.action must be \"block\" or \"alert\", got %q", name, b.Action)
+			}
+		}
+		if len(agent.DependsOn) > 0 && agent.Policy != "on-demand" {
+			return fmt.Errorf("config: agent %q depends_on requires on-demand policy", name)
+		}
+		for _, dep := range agent.DependsOn {
+			if dep == name {
+				return fmt.Errorf("config: agent %q cannot depend on itself", name)
+			}
+			if _, ok := cfg.Agents[dep]; !ok {
+				return fmt.Errorf("config: agent %q depends_on %q, which is not a configured agent", name, dep)
+			}
+		}
+		if agent.Container.MaxLifetime < 0 {
+			return fmt.Errorf("config: agent %q container.max_lifetime must not be negative", name)
+		}
+		if agent.Container.MaxLifetime > 0 && agent.Policy != "always-on" {
+			return fmt.Errorf("config: agent %q container.max_lifetime requires always-on policy", name)
+		}
+		if agent.Idle.MaxUptime < 0 {
+			return fmt.Errorf("config: agent %q idle.max_uptime must not be negative", name)
+		}
+		if agent.Idle.MaxUptime > 0 && agent.Policy != "on-demand" {
+			return fmt.Errorf("config: agent %q idle.max_uptime requires on-demand policy", name)
+		}
+		if agent.Idle.PredictiveWake && agent.Policy != "on-demand" {
+			return fmt.Errorf("config: agent %q idle.predictive_wake requires on-demand policy", name)
+		}
+		if agent.Idle.PredictiveLead < 0 || time.Duration(agent.Idle.PredictiveLead) > time.Hour {
+			return fmt.Errorf("config: agent %q idle.predictive_lead must be between 0 and 1h", name)
+		}
+		if agent.Idle.CPUThreshold < 0 || agent.Idle.CPUSampleInterval < 0 {
+			return fmt.Errorf("config: agent %q idle.cpu_threshold and idle.cpu_sample_interval must not be negative", name)
+		}
+		if agent.Idle.CPUThreshold > 0 && agent.Policy != "on-demand" {
+			return fmt.Errorf("config: agent %q idle.cpu_threshold requires on-demand policy", name)
+		}
+		if agent.MaxWebSockets < 0 {
+			return fmt.Errorf("config: agent %q max_websockets must not be negative", name)
+		}
+		if agent.Idle.WebSocketTimeout < 0 {
+			return fmt.Errorf("config: agent %q idle.websocket_timeout must not be negative", name)
+		}
+		if agent.Idle.WebSocketTimeout > 0 && agent.Policy != "on-demand" {
+			return fmt.Errorf("config: agent %q idle.websocket_timeout requires on-demand policy", name)
+		}
+		if err := validateActivity(name, agent); err != nil {
+			return err
+		}
+
+		if agent.Sleep.VetoURL != "" {
+			if agent.Policy != "on-demand" {
+				return fmt.Errorf("config: agent %q sleep.veto_url requires on-demand policy", name)
+			}
+			if err := security.ValidateHealthURL(agent.Sleep.VetoURL); err != nil {
+				return fmt.Errorf("config: agent %q invalid sleep.veto_url: %w", name, err)
+			}
+		}
+
+		if agent.OpenClaw != nil && agent.OpenClaw.SessionsURL != "" {
+			if err := security.ValidateHealthURL(agent.OpenClaw.SessionsURL); err != nil {
+				return fmt.Errorf("config: agent %q invalid openclaw.sessions_url: %w", name, err)
+			}
+		}
+
 		// Validate health check URLs (M3: scheme validation, private IPs allowed).
 		if agent.Health.URL != "" {
 			if err := security.ValidateHealthURL(agent.Health.URL); err != nil {
@@ -77,6 +493,10 @@ func validate(cfg *Config) error {
 		}
 	}
 
+	if err := validateDependencies(cfg.Agents); err != nil {
+		return err
+	}
+
 	// Validate webhook URLs (M2: SSRF protection).
 	for i, wh := range cfg.Webhooks {
 		if err := security.ValidateWebhookURL(wh.URL); err != nil {
@@ -84,5 +504,280 @@ func validate(cfg *Config) error {
 		}
 	}
 
+	return validateServices(cfg)
+}
+
+// validateDependencies rejects depends_on cycles, which would leave every
+// agent in them waiting for the others to wake.
+func validateDependencies(agents map[string]*Agent) error {
+	const (
+		visiting = iota + 1
+		done
+	)
+	state := make(map[string]int)
+	var path []string
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			i := slices.Index(path, name)
+			return fmt.Errorf("config: depends_on cycle: %s -> %s", strings.Join(path[i:], " -> "), name)
+		case done:
+			return nil
+		}
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range agents[name].DependsOn {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = done
+		return nil
+	}
+	names := make([]string, 0, len(agents))
+	for name := range agents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateServices checks the services section. The registry validates
+// targets again when they're registered, refusing the ones it never
+// proxies to, such as cloud metadata addresses.
+func validateServices(cfg *Config) error {
+	routed := make(map[string]string) // hostname → agent
+	for name, agent := range cfg.Agents {
+		routed[strings.ToLower(agent.Hostname)] = name
+		for _, h := range agent.Hostnames {
+			routed[strings.ToLower(h)] = name
+		}
+	}
+	for hostname, svc := range cfg.Services {
+		if svc == nil {
+			return fmt.Errorf("config: service %q has no settings", hostname)
+		}
+		if err := security.ValidateHostname(strings.ToLower(hostname)); err != nil {
+			return fmt.Errorf("config: service %q invalid hostname: %w", hostname, err)
+		}
+		if agent, ok := routed[strings.ToLower(hostname)]; ok {
+			return fmt.Errorf("config: service %q hostname is already routed to agent %q", hostname, agent)
+		}
+		for _, target := range append([]string{svc.Target}, svc.Replicas...) {
+			u, err := url.Parse(target)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("config: service %q target %q must be an http(s) URL", hostname, target)
+			}
+		}
+		if len(svc.Weights) > 0 && len(svc.Weights) != len(svc.Replicas)+1 {
+			return fmt.Errorf("config: service %q needs one weight per target", hostname)
+		}
+		if st := svc.Sticky; st != nil && st.Cookie != "" && !balance.ValidCookieName(st.Cookie) {
+			return fmt.Errorf("config: service %q sticky.cookie %q is not a valid cookie name", hostname, st.Cookie)
+		}
+		if c := svc.CORS; c != nil {
+			if _, err := c.Policy(); err != nil {
+				return fmt.Errorf("config: service %q %v", hostname, err)
+			}
+		}
+		if h := svc.Headers; h != nil {
+			if _, err := headers.New(*h); err != nil {
+				return fmt.Errorf("config: service %q %v", hostname, err)
+			}
+		}
+		if c := svc.Cache; c != nil {
+			if err := c.validate(); err != nil {
+				return fmt.Errorf("config: service %q %v", hostname, err)
+			}
+		}
+		if svc.BasicAuth != nil {
+			entries, err := svc.BasicAuth.Entries()
+			if err != nil {
+				return fmt.Errorf("config: service %q basic_auth: %w", hostname, err)
+			}
+			if _, err := auth.ParseHtpasswd(entries); err != nil {
+				return fmt.Errorf("config: service %q %w", hostname, err)
+			}
+			if cfg.ProxyToken != "" && !svc.BasicAuth.ReplaceProxyToken {
+				return fmt.Errorf("config: service %q basic_auth would replace proxy_token for it; set basic_auth.replace_proxy_token to confirm", hostname)
+			}
+		}
+	}
+	return nil
+}
+
+// activitySources are the idle activity sources an agent can list.
+var activitySources = map[string]bool{"requests": true, "connections": true, "cpu": true, "prometheus": true}
+
+func validateActivity(name string, agent *Agent) error {
+	if prom := agent.Idle.Prometheus; prom != nil {
+		if agent.Policy != "on-demand" {
+			return fmt.Errorf("config: agent %q idle.prometheus requires on-demand policy", name)
+		}
+		if err := security.ValidateHealthURL(prom.URL); err != nil {
+			return fmt.Errorf("config: agent %q invalid idle.prometheus.url: %w", name, err)
+		}
+		if strings.TrimSpace(prom.Query) == "" {
+			return fmt.Errorf("config: agent %q idle.prometheus.query is required", name)
+		}
+		if prom.Interval < 0 {
+			return fmt.Errorf("config: agent %q idle.prometheus.interval must not be negative", name)
+		}
+	}
+
+	act := agent.Idle.Activity
+	if act.Mode == "" && len(act.Sources) == 0 {
+		return nil
+	}
+	if agent.Policy != "on-demand" {
+		return fmt.Errorf("config: agent %q idle.activity requires on-demand policy", name)
+	}
+	if act.Mode != "" && act.Mode != "any" && act.Mode != "all" {
+		return fmt.Errorf("config: agent %q idle.activity.mode must be \"any\" or \"all\", got %q", name, act.Mode)
+	}
+	seen := make(map[string]bool)
+	for _, src := range act.Sources {
+		if !activitySources[src] {
+			return fmt.Errorf("config: agent %q unknown idle.activity source %q", name, src)
+		}
+		if seen[src] {
+			return fmt.Errorf("config: agent %q duplicate idle.activity source %q", name, src)
+		}
+		seen[src] = true
+	}
+	if seen["cpu"] && agent.Idle.CPUThreshold <= 0 {
+		return fmt.Errorf("config: agent %q idle.activity source \"cpu\" requires idle.cpu_threshold", name)
+	}
+	if seen["prometheus"] && agent.Idle.Prometheus == nil {
+		return fmt.Errorf("config: agent %q idle.activity source \"prometheus\" requires idle.prometheus", name)
+	}
+	return nil
+}
+
+// validateBackendProtocol checks backend_protocol against the scheme of
+// every backend URL: HTTP/2 over TLS needs https, h2c needs plain http.
+func validateBackendProtocol(agent *Agent) error {
+	if agent.GRPC && agent.BackendProtocol == transport.HTTP1 {
+		return fmt.Errorf("grpc needs HTTP/2, but backend_protocol is %s", transport.HTTP1)
+	}
+	var scheme string
+	switch agent.BackendProtocol {
+	case "", transport.HTTP1:
+		return nil
+	case transport.HTTP2:
+		scheme = "https"
+	case transport.H2C:
+		scheme = "http"
+	default:
+		return fmt.Errorf("backend_protocol must be %q, %q or %q, got %q", transport.HTTP1, transport.HTTP2, transport.H2C, agent.BackendProtocol)
+	}
+	for _, raw := range append([]string{agent.Backend}, agent.Replicas...) {
+		if u, err := url.Parse(raw); err == nil && u.Scheme != scheme {
+			return fmt.Errorf("backend_protocol %s needs %s backends, got %s", agent.BackendProtocol, scheme, raw)
+		}
+	}
+	return nil
+}
+
+// validateErrorPages checks error_pages only names statuses the proxy
+// generates and that each template parses.
+func validateErrorPages(pages map[int]string) error {
+	for code, path := range pages {
+		if code != 404 && code != 502 && code != 503 && code != 504 {
+			return fmt.Errorf("error_pages: status %d can't have a page, only 404, 502, 503 and 504", code)
+		}
+		if _, err := template.ParseFiles(path); err != nil {
+			return fmt.Errorf("error_pages: invalid template for %d: %w", code, err)
+		}
+	}
+	return nil
+}
+
+// validateDockerHost checks docker_host is an endpoint the Docker client can
+// dial: a unix socket on Linux and macOS, a named pipe on Windows, or TCP.
+func validateDockerHost(host string) error {
+	u, err := url.Parse(host)
+	if err != nil {
+		return fmt.Errorf("docker_host %q: %w", host, err)
+	}
+	switch u.Scheme {
+	case "unix", "npipe":
+		if u.Path == "" {
+			return fmt.Errorf("docker_host %q is missing a socket or pipe path", host)
+		}
+	case "tcp":
+		if u.Host == "" {
+			return fmt.Errorf("docker_host %q is missing host:port", host)
+		}
+	default:
+		return fmt.Errorf("docker_host must use unix://, npipe:// or tcp://, got %q", host)
+	}
+	return nil
+}
+
+// validateDNS checks dns: a known provider with credentials, zones to
+// manage and a target records can point at.
+func validateDNS(d DNSConfig) error {
+	switch d.Provider {
+	case "":
+		return nil
+	case "cloudflare":
+		if d.Cloudflare.APIToken == "" {
+			return fmt.Errorf("config: dns.cloudflare.api_token (or CLOUDFLARE_API_TOKEN) is required")
+		}
+	case "route53":
+		if d.Route53.AccessKeyID == "" || d.Route53.SecretAccessKey == "" {
+			return fmt.Errorf("config: dns.route53 access_key_id and secret_access_key (or AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY) are required")
+		}
+	default:
+		return fmt.Errorf("config: dns.provider must be cloudflare or route53, got %q", d.Provider)
+	}
+	if len(d.ManagedZones) == 0 {
+		return fmt.Errorf("config: dns.managed_zones is required, so Warren only changes zones you list")
+	}
+	for _, z := range d.ManagedZones {
+		if err := security.ValidateHostname(strings.TrimSuffix(z, ".")); err != nil {
+			return fmt.Errorf("config: dns.managed_zones %q: %w", z, err)
+		}
+	}
+	if d.Target == "" {
+		return fmt.Errorf("config: dns.target is required")
+	}
+	if _, err := netip.ParseAddr(d.Target); err != nil {
+		if err := security.ValidateHostname(strings.TrimSuffix(d.Target, ".")); err != nil {
+			return fmt.Errorf("config: dns.target %q must be an IP address or hostname: %w", d.Target, err)
+		}
+	}
+	if d.TTL < 0 || (d.TTL > 0 && time.Duration(d.TTL) < time.Second) {
+		return fmt.Errorf("config: dns.ttl must be at least 1s")
+	}
+	return nil
+}
+
+// validate checks an agent's or service's cache settings.
+func (c *Cache) validate() error {
+	if len(c.Paths) == 0 {
+		return fmt.Errorf("cache.paths must list at least one path")
+	}
+	for _, p := range c.Paths {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("cache.paths: invalid pattern %q", p)
+		}
+	}
+	for _, m := range c.Methods {
+		if !strings.EqualFold(m, "GET") && !strings.EqualFold(m, "HEAD") {
+			return fmt.Errorf("cache.methods: only GET and HEAD can be cached, got %q", m)
+		}
+	}
+	if c.TTL < 0 || c.MaxSize < 0 || c.MaxEntry < 0 {
+		return fmt.Errorf("cache settings must not be negative")
+	}
 	return nil
 }
@@ -4,6 +4,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"warren/internal/human"
 )
 
 func TestValidate_InvalidHostnameRejected(t *testing.T) {
@@ -83,12 +85,12 @@ func TestValidate_WakeCooldownDefault(t *testing.T) {
 			Policy:    "on-demand",
 			Container: Container{Name: "svc"},
 			Health:    Health{URL: "http://x/h"},
-			Idle:      IdleConfig{Timeout: time.Minute},
+			Idle:      IdleConfig{Timeout: human.Duration(time.Minute)},
 		},
 	}}
 	applyDefaults(cfg)
 	agent := cfg.Agents["a"]
-	if agent.Idle.WakeCooldown != 30*time.Second {
+	if time.Duration(agent.Idle.WakeCooldown) != 30*time.Second {
 		t.Errorf("WakeCooldown = %v, want 30s default", agent.Idle.WakeCooldown)
 	}
 }
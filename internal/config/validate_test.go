@@ -4,6 +4,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"warren/internal/human"
 )
 
 func TestValidateErrors(t *testing.T) {
@@ -49,7 +51,7 @@ func TestValidateErrors(t *testing.T) {
 			name: "on-demand missing container name",
 			cfg: &Config{Agents: map[string]*Agent{
 				"a": {Hostname: "a.com", Backend: "http://x", Policy: "on-demand",
-					Health: Health{URL: "http://x/h"}, Idle: IdleConfig{Timeout: time.Minute}},
+					Health: Health{URL: "http://x/h"}, Idle: IdleConfig{Timeout: human.Duration(time.Minute)}},
 			}},
 			wantErr: "requires container.name",
 		},
@@ -57,7 +59,7 @@ func TestValidateErrors(t *testing.T) {
 			name: "on-demand missing health url",
 			cfg: &Config{Agents: map[string]*Agent{
 				"a": {Hostname: "a.com", Backend: "http://x", Policy: "on-demand",
-					Container: Container{Name: "svc"}, Idle: IdleConfig{Timeout: time.Minute}},
+					Container: Container{Name: "svc"}, Idle: IdleConfig{Timeout: human.Duration(time.Minute)}},
 			}},
 			wantErr: "requires health.url",
 		},
@@ -3,7 +3,9 @@ package container
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
 	"time"
 )
 
@@ -29,3 +31,30 @@ func CheckHealth(ctx context.Context, url string) error {
 
 	return nil
 }
+
+// CheckTCP dials the host and port of a health URL. It is a cheap probe for
+// whether the app has bound its port yet, before trying the HTTP check.
+func CheckTCP(ctx context.Context, healthURL string) error {
+	u, err := url.Parse(healthURL)
+	if err != nil {
+		return fmt.Errorf("parse health url: %w", err)
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("tcp check failed: %w", err)
+	}
+	conn.Close()
+	return nil
+}
@@ -32,3 +32,15 @@ func TestCheckHealthUnreachable(t *testing.T) {
 		t.Error("expected error for unreachable server")
 	}
 }
+
+func TestCheckTCP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := srv.URL + "/health"
+	if err := CheckTCP(context.Background(), url); err != nil {
+		t.Errorf("expected open port, got %v", err)
+	}
+	srv.Close()
+	if err := CheckTCP(context.Background(), url); err == nil {
+		t.Error("expected error for closed port")
+	}
+}
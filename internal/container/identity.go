@@ -0,0 +1,155 @@
+package container
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"warren/internal/events"
+)
+
+// Inspector returns a service's runtime details. Satisfied by Manager.
+type Inspector interface {
+	Inspect(ctx context.Context, name string) (*Details, error)
+}
+
+// Identity is the container an agent was last seen running, and its image.
+type Identity struct {
+	ContainerID string    `json:"container_id"`
+	Image       string    `json:"image"`
+	ImageDigest string    `json:"image_digest,omitempty"`
+	SeenAt      time.Time `json:"seen_at"`
+}
+
+// IdentityTracker remembers which container and image each agent is running
+// and stamps them onto the agent's events, so an alert for a crash after an
+// image update shows which version was running. The identity is captured
+// when the agent becomes ready and dropped when it sleeps or is removed.
+// Only agents registered with their Swarm service are tracked.
+type IdentityTracker struct {
+	inspector Inspector
+	logger    *slog.Logger
+
+	mu       sync.RWMutex
+	services map[string]string // agent → service name
+	current  map[string]Identity
+}
+
+// NewIdentityTracker creates a tracker.
+func NewIdentityTracker(inspector Inspector, logger *slog.Logger) *IdentityTracker {
+	return &IdentityTracker{
+		inspector: inspector,
+		logger:    logger.With("component", "container-identity"),
+		services:  make(map[string]string),
+		current:   make(map[string]Identity),
+	}
+}
+
+// Register tracks the agent as running in the given Swarm service,
+// replacing any earlier registration.
+func (t *IdentityTracker) Register(agent, service string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if old, ok := t.services[agent]; ok && old != service {
+		delete(t.current, agent)
+	}
+	t.services[agent] = service
+}
+
+// Unregister stops tracking the agent and forgets its identity.
+func (t *IdentityTracker) Unregister(agent string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.services, agent)
+	delete(t.current, agent)
+}
+
+// Get returns the agent's current identity.
+func (t *IdentityTracker) Get(agent string) (Identity, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	id, ok := t.current[agent]
+	return id, ok
+}
+
+// Refresh inspects the agent's service and records the running container.
+// If nothing is running the identity is cleared.
+func (t *IdentityTracker) Refresh(ctx context.Context, agent string) error {
+	t.mu.RLock()
+	svc := t.services[agent]
+	t.mu.RUnlock()
+	if svc == "" {
+		return nil
+	}
+	d, err := t.inspector.Inspect(ctx, svc)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.services[agent] != svc {
+		return nil // unregistered or moved while inspecting
+	}
+	if d.ContainerID == "" {
+		delete(t.current, agent)
+		return nil
+	}
+	t.current[agent] = Identity{
+		ContainerID: d.ContainerID,
+		Image:       d.Image,
+		ImageDigest: d.ImageDigest,
+		SeenAt:      time.Now(),
+	}
+	return nil
+}
+
+// Enrich adds container_id and image_digest (or image, if the digest is
+// unknown) to events for agents with a known identity.
+func (t *IdentityTracker) Enrich(ev *events.Event) {
+	id, ok := t.Get(ev.Agent)
+	if !ok {
+		return
+	}
+	if ev.Fields == nil {
+		ev.Fields = make(map[string]string)
+	}
+	setDefault(ev.Fields, "container_id", id.ContainerID)
+	if id.ImageDigest != "" {
+		setDefault(ev.Fields, "image_digest", id.ImageDigest)
+	} else {
+		setDefault(ev.Fields, "image", id.Image)
+	}
+}
+
+// HandleEvent keeps identities current: it refreshes when an agent becomes
+// ready or recovers, and forgets the identity once the container is gone.
+func (t *IdentityTracker) HandleEvent(ev events.Event) {
+	switch ev.Type {
+	case events.AgentReady, events.AgentRecovered:
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := t.Refresh(ctx, ev.Agent); err != nil {
+				t.logger.Warn("failed to record container identity", "agent", ev.Agent, "error", err)
+			}
+		}()
+	case events.AgentSleep, events.AgentRemoved:
+		t.mu.Lock()
+		delete(t.current, ev.Agent)
+		t.mu.Unlock()
+	}
+}
+
+// RegisterEventHandler wires the tracker into the emitter.
+func (t *IdentityTracker) RegisterEventHandler(emitter *events.Emitter) {
+	emitter.AddEnricher(t.Enrich)
+	emitter.OnEvent(t.HandleEvent)
+}
+
+func setDefault(fields map[string]string, key, value string) {
+	if _, ok := fields[key]; !ok && value != "" {
+		fields[key] = value
+	}
+}
@@ -0,0 +1,122 @@
+package container
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"warren/internal/events"
+)
+
+type fakeInspector struct{ details *Details }
+
+func (f *fakeInspector) Inspect(context.Context, string) (*Details, error) {
+	return f.details, nil
+}
+
+func TestIdentityTrackerEnrichesEvents(t *testing.T) {
+	insp := &fakeInspector{details: &Details{ContainerID: "c1", Image: "agent:2@sha256:new", ImageDigest: "sha256:new"}}
+	tracker := NewIdentityTracker(insp, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	tracker.Register("a", "a-svc")
+
+	emitter := events.NewEmitter(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	tracker.RegisterEventHandler(emitter)
+	got := make(chan events.Event, 10)
+	emitter.OnEvent(func(ev events.Event) { got <- ev })
+
+	emitter.Emit(events.Event{Type: events.AgentReady, Agent: "a"})
+	<-got
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, ok := tracker.Get("a"); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("identity not recorded after ready")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	emitter.Emit(events.Event{Type: events.AgentCrashLoop, Agent: "a", Fields: map[string]string{"crashes": "3"}})
+	ev := <-got
+	if ev.Fields["container_id"] != "c1" || ev.Fields["image_digest"] != "sha256:new" || ev.Fields["crashes"] != "3" {
+		t.Errorf("fields = %v", ev.Fields)
+	}
+
+	emitter.Emit(events.Event{Type: events.AgentSleep, Agent: "a"})
+	if ev := <-got; ev.Fields["container_id"] != "c1" {
+		t.Errorf("sleep event should carry the stopped container, got %v", ev.Fields)
+	}
+	emitter.Emit(events.Event{Type: events.AgentWake, Agent: "a"})
+	if ev := <-got; ev.Fields["container_id"] != "" {
+		t.Errorf("identity should be cleared after sleep, got %v", ev.Fields)
+	}
+}
+
+func TestIdentityTrackerRefreshNotRunning(t *testing.T) {
+	insp := &fakeInspector{details: &Details{ContainerID: "c1", Image: "agent:1"}}
+	tracker := NewIdentityTracker(insp, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	tracker.Register("a", "a")
+
+	if err := tracker.Refresh(context.Background(), "a"); err != nil {
+		t.Fatal(err)
+	}
+	ev := events.Event{Agent: "a"}
+	tracker.Enrich(&ev)
+	if ev.Fields["image"] != "agent:1" || ev.Fields["image_digest"] != "" {
+		t.Errorf("fields = %v", ev.Fields)
+	}
+
+	insp.details = &Details{Image: "agent:1"}
+	if err := tracker.Refresh(context.Background(), "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tracker.Get("a"); ok {
+		t.Error("identity should be cleared when no container is running")
+	}
+}
+
+func TestIdentityTrackerRegistration(t *testing.T) {
+	insp := &fakeInspector{details: &Details{ContainerID: "c1", Image: "agent:1"}}
+	tracker := NewIdentityTracker(insp, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	// Agents not registered, such as unmanaged ones, aren't inspected.
+	if err := tracker.Refresh(context.Background(), "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tracker.Get("a"); ok {
+		t.Error("unregistered agent should have no identity")
+	}
+
+	// Agents added after startup are tracked once registered.
+	tracker.Register("a", "a-svc")
+	if err := tracker.Refresh(context.Background(), "a"); err != nil {
+		t.Fatal(err)
+	}
+	if id, ok := tracker.Get("a"); !ok || id.ContainerID != "c1" {
+		t.Errorf("Get() = %+v, %v", id, ok)
+	}
+
+	// Moving the agent to another service drops the old identity.
+	tracker.Register("a", "other-svc")
+	if _, ok := tracker.Get("a"); ok {
+		t.Error("identity should be cleared when the service changes")
+	}
+
+	tracker.Register("a", "other-svc")
+	if err := tracker.Refresh(context.Background(), "a"); err != nil {
+		t.Fatal(err)
+	}
+	tracker.Unregister("a")
+	if _, ok := tracker.Get("a"); ok {
+		t.Error("identity should be cleared when the agent is unregistered")
+	}
+	if err := tracker.Refresh(context.Background(), "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tracker.Get("a"); ok {
+		t.Error("unregistered agent should not be tracked again")
+	}
+}
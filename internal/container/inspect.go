@@ -0,0 +1,147 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// Details is the runtime view of an agent's container, merged from the Swarm
+// service, its tasks and (when the task runs on this node) the container.
+type Details struct {
+	Service      string        `json:"service"`
+	Image        string        `json:"image"`
+	ImageDigest  string        `json:"image_digest,omitempty"`
+	ContainerID  string        `json:"container_id,omitempty"`
+	NodeID       string        `json:"node_id,omitempty"`
+	State        string        `json:"state"`
+	StartedAt    *time.Time    `json:"started_at,omitempty"`
+	RestartCount *int          `json:"restart_count,omitempty"` // in-place restarts of the container; nil unless it runs on this node
+	FailedTasks  int           `json:"failed_tasks"`            // tasks Swarm replaced after a failure, as far as its task history goes back
+	Mounts       []MountDetail `json:"mounts,omitempty"`
+}
+
+// MountDetail is a single mount on the container.
+type MountDetail struct {
+	Type        string `json:"type"`
+	Source      string `json:"source,omitempty"`
+	Destination string `json:"destination"`
+	ReadOnly    bool   `json:"read_only,omitempty"`
+}
+
+// Inspect returns the runtime details of a service's container. Container-level
+// fields (mounts as mounted, started-at, in-place restarts) are only filled in
+// from the container when its task runs on this node; otherwise they come
+// from the service spec and task status, and the restart count is left out.
+func (m *Manager) Inspect(ctx context.Context, name string) (*Details, error) {
+	svc, _, err := m.docker.ServiceInspectWithRaw(ctx, name, types.ServiceInspectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("inspect service %q: %w", name, err)
+	}
+	tasks, err := m.docker.TaskList(ctx, types.TaskListOptions{
+		Filters: filters.NewArgs(filters.Arg("service", name)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list tasks for service %q: %w", name, err)
+	}
+
+	d := detailsFromService(svc, tasks)
+	if d.ContainerID == "" {
+		return d, nil
+	}
+	ctr, err := m.docker.ContainerInspect(ctx, d.ContainerID)
+	if err != nil {
+		// The task is running on another node.
+		m.logger.Debug("container not inspectable on this node", "service", name, "container", d.ContainerID, "error", err)
+		return d, nil
+	}
+	mergeContainer(d, ctr)
+	return d, nil
+}
+
+// detailsFromService builds details from the service spec and its task
+// history. Swarm replaces a crashed container with a new task rather than
+// restarting it in place, so failed tasks are counted separately from the
+// container's restarts; Swarm prunes old tasks, so the count is a lower
+// bound.
+func detailsFromService(svc swarm.Service, tasks []swarm.Task) *Details {
+	d := &Details{Service: svc.Spec.Name, State: "exited"}
+	if cs := svc.Spec.TaskTemplate.ContainerSpec; cs != nil {
+		d.Image = cs.Image
+		if i := strings.Index(cs.Image, "@"); i >= 0 {
+			d.ImageDigest = cs.Image[i+1:]
+		}
+		for _, mt := range cs.Mounts {
+			d.Mounts = append(d.Mounts, MountDetail{
+				Type:        string(mt.Type),
+				Source:      mt.Source,
+				Destination: mt.Target,
+				ReadOnly:    mt.ReadOnly,
+			})
+		}
+	}
+
+	var current *swarm.Task
+	for i := range tasks {
+		t := &tasks[i]
+		switch t.Status.State {
+		case swarm.TaskStateFailed, swarm.TaskStateRejected:
+			d.FailedTasks++
+		}
+		if t.DesiredState != swarm.TaskStateRunning {
+			continue
+		}
+		if current == nil || t.Status.Timestamp.After(current.Status.Timestamp) {
+			current = t
+		}
+	}
+	if current == nil {
+		return d
+	}
+
+	d.State = string(current.Status.State)
+	d.NodeID = current.NodeID
+	if cs := current.Status.ContainerStatus; cs != nil {
+		d.ContainerID = cs.ContainerID
+	}
+	if current.Status.State == swarm.TaskStateRunning {
+		ts := current.Status.Timestamp
+		d.StartedAt = &ts
+	}
+	return d
+}
+
+// mergeContainer overlays the fields only the container itself knows.
+func mergeContainer(d *Details, ctr types.ContainerJSON) {
+	if ctr.ContainerJSONBase != nil {
+		restarts := ctr.RestartCount
+		d.RestartCount = &restarts
+		if d.ImageDigest == "" {
+			d.ImageDigest = ctr.Image
+		}
+		if st := ctr.State; st != nil {
+			if st.Status != "" {
+				d.State = st.Status
+			}
+			if t, err := time.Parse(time.RFC3339Nano, st.StartedAt); err == nil && !t.IsZero() {
+				d.StartedAt = &t
+			}
+		}
+	}
+	if len(ctr.Mounts) > 0 {
+		d.Mounts = d.Mounts[:0]
+		for _, mp := range ctr.Mounts {
+			d.Mounts = append(d.Mounts, MountDetail{
+				Type:        string(mp.Type),
+				Source:      mp.Source,
+				Destination: mp.Destination,
+				ReadOnly:    !mp.RW,
+			})
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package container
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/swarm"
+)
+
+func testService() swarm.Service {
+	return swarm.Service{Spec: swarm.ServiceSpec{
+		Annotations: swarm.Annotations{Name: "agent-svc"},
+		TaskTemplate: swarm.TaskSpec{ContainerSpec: &swarm.ContainerSpec{
+			Image: "ghcr.io/acme/agent:1.2@sha256:abc",
+			Mounts: []mount.Mount{
+				{Type: mount.TypeBind, Source: "/srv/data", Target: "/data", ReadOnly: true},
+			},
+		}},
+	}}
+}
+
+func TestDetailsFromServiceTasks(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	tasks := []swarm.Task{
+		{DesiredState: swarm.TaskStateShutdown, Status: swarm.TaskStatus{State: swarm.TaskStateFailed, Timestamp: now.Add(-time.Hour)}},
+		{DesiredState: swarm.TaskStateShutdown, Status: swarm.TaskStatus{State: swarm.TaskStateShutdown, Timestamp: now.Add(-30 * time.Minute)}},
+		{DesiredState: swarm.TaskStateRunning, NodeID: "node1", Status: swarm.TaskStatus{
+			State:           swarm.TaskStateRunning,
+			Timestamp:       now,
+			ContainerStatus: &swarm.ContainerStatus{ContainerID: "c123"},
+		}},
+	}
+
+	d := detailsFromService(testService(), tasks)
+	if d.Service != "agent-svc" || d.ImageDigest != "sha256:abc" {
+		t.Errorf("service/digest = %q/%q", d.Service, d.ImageDigest)
+	}
+	if d.State != "running" || d.ContainerID != "c123" || d.NodeID != "node1" {
+		t.Errorf("state/container/node = %q/%q/%q", d.State, d.ContainerID, d.NodeID)
+	}
+	if d.FailedTasks != 1 || d.RestartCount != nil {
+		t.Errorf("failed_tasks/restart_count = %d/%v, want 1 and unknown until the container is inspected", d.FailedTasks, d.RestartCount)
+	}
+	if d.StartedAt == nil || !d.StartedAt.Equal(now) {
+		t.Errorf("started_at = %v, want %v", d.StartedAt, now)
+	}
+	if len(d.Mounts) != 1 || d.Mounts[0].Destination != "/data" || !d.Mounts[0].ReadOnly {
+		t.Errorf("mounts = %+v", d.Mounts)
+	}
+}
+
+func TestDetailsFromServiceScaledDown(t *testing.T) {
+	d := detailsFromService(testService(), nil)
+	if d.State != "exited" || d.ContainerID != "" || d.StartedAt != nil {
+		t.Errorf("details = %+v", d)
+	}
+}
+
+func TestMergeContainer(t *testing.T) {
+	svc := testService()
+	svc.Spec.TaskTemplate.ContainerSpec.Image = "agent:latest"
+	d := detailsFromService(svc, nil)
+
+	mergeContainer(d, types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			Image:        "sha256:def",
+			RestartCount: 2,
+			State:        &types.ContainerState{Status: "running", StartedAt: "2026-01-02T03:04:05.5Z"},
+		},
+		Mounts: []types.MountPoint{
+			{Type: mount.TypeVolume, Source: "/var/lib/docker/volumes/x", Destination: "/state", RW: true},
+		},
+	})
+
+	if d.ImageDigest != "sha256:def" || d.RestartCount == nil || *d.RestartCount != 2 || d.State != "running" {
+		t.Errorf("details = %+v", d)
+	}
+	if d.StartedAt == nil || d.StartedAt.Format(time.RFC3339) != "2026-01-02T03:04:05Z" {
+		t.Errorf("started_at = %v", d.StartedAt)
+	}
+	if len(d.Mounts) != 1 || d.Mounts[0].Destination != "/state" || d.Mounts[0].ReadOnly {
+		t.Errorf("mounts = %+v", d.Mounts)
+	}
+}
@@ -13,3 +13,10 @@ type Lifecycle interface {
 	Restart(ctx context.Context, name string, gracePeriod time.Duration) error
 	Status(ctx context.Context, name string) (string, error)
 }
+
+// Pauser freezes and resumes a service's running container in place. Used by
+// the pause idle mode, which keeps memory allocated for near-instant wakes.
+type Pauser interface {
+	Pause(ctx context.Context, name string) error
+	Unpause(ctx context.Context, name string) error
+}
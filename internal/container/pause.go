@@ -0,0 +1,33 @@
+package container
+
+import (
+	"context"
+	"fmt"
+)
+
+// Pause freezes the processes of the service's running container. The
+// service stays scaled to 1 and the container keeps its memory.
+func (m *Manager) Pause(ctx context.Context, name string) error {
+	id, err := m.runningContainer(ctx, name)
+	if err != nil {
+		return fmt.Errorf("pause service %q: %w", name, err)
+	}
+	m.logger.Info("pausing container", "service", name, "container", id)
+	if err := m.docker.ContainerPause(ctx, id); err != nil {
+		return fmt.Errorf("pause container %q: %w", id, err)
+	}
+	return nil
+}
+
+// Unpause resumes a container frozen by Pause.
+func (m *Manager) Unpause(ctx context.Context, name string) error {
+	id, err := m.runningContainer(ctx, name)
+	if err != nil {
+		return fmt.Errorf("unpause service %q: %w", name, err)
+	}
+	m.logger.Info("unpausing container", "service", name, "container", id)
+	if err := m.docker.ContainerUnpause(ctx, id); err != nil {
+		return fmt.Errorf("unpause container %q: %w", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package container
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// PublishSpec is a container port Warren should publish on the host.
+type PublishSpec struct {
+	Target    int
+	Published int    // 0 = allocate from the port range
+	Protocol  string // "tcp" or "udp"
+}
+
+// PublishedPort is a host port mapping Warren applied to a service.
+type PublishedPort struct {
+	Target    int    `json:"target"`
+	Published int    `json:"published"`
+	Protocol  string `json:"protocol"`
+}
+
+// PortAllocator hands out host ports from a fixed range and remembers which
+// agent holds each one, so mappings stay stable across sleep/wake cycles.
+type PortAllocator struct {
+	min, max int
+
+	mu      sync.Mutex
+	byAgent map[string][]PublishedPort
+	used    map[string]string // "proto/port" → agent
+
+	// OnAssign is called after an agent's mappings change. Used to record
+	// them in the service registry.
+	OnAssign func(agent string, ports []PublishedPort)
+}
+
+// NewPortAllocator creates an allocator for host ports min..max inclusive.
+func NewPortAllocator(min, max int) *PortAllocator {
+	return &PortAllocator{
+		min:     min,
+		max:     max,
+		byAgent: make(map[string][]PublishedPort),
+		used:    make(map[string]string),
+	}
+}
+
+// Assign resolves host ports for an agent. Fixed ports are taken as given;
+// the rest keep the agent's previous allocation, or reuse a port already
+// published on the service (existing) if it is free, or take the lowest free
+// port in the range.
+func (a *PortAllocator) Assign(agent string, want []PublishSpec, existing []swarm.PortConfig) ([]PublishedPort, error) {
+	a.mu.Lock()
+	prev := a.byAgent[agent]
+	a.releaseLocked(agent)
+
+	var out []PublishedPort
+	for _, w := range want {
+		proto := w.Protocol
+		if proto == "" {
+			proto = "tcp"
+		}
+		port := w.Published
+		if port == 0 {
+			port = a.pickLocked(agent, w.Target, proto, prev, existing)
+		}
+		if port == 0 {
+			a.releaseLocked(agent)
+			a.mu.Unlock()
+			return nil, fmt.Errorf("no free host port in range %d-%d for agent %q", a.min, a.max, agent)
+		}
+		key := portKey(proto, port)
+		if holder, ok := a.used[key]; ok && holder != agent {
+			a.releaseLocked(agent)
+			a.mu.Unlock()
+			return nil, fmt.Errorf("host port %s is already published for agent %q", key, holder)
+		}
+		a.used[key] = agent
+		out = append(out, PublishedPort{Target: w.Target, Published: port, Protocol: proto})
+	}
+	a.byAgent[agent] = out
+	onAssign := a.OnAssign
+	a.mu.Unlock()
+
+	if onAssign != nil {
+		onAssign(agent, out)
+	}
+	return out, nil
+}
+
+// Release frees an agent's host ports, e.g. when it is removed.
+func (a *PortAllocator) Release(agent string) {
+	a.mu.Lock()
+	a.releaseLocked(agent)
+	onAssign := a.OnAssign
+	a.mu.Unlock()
+	if onAssign != nil {
+		onAssign(agent, nil)
+	}
+}
+
+// Assigned returns an agent's current mappings.
+func (a *PortAllocator) Assigned(agent string) []PublishedPort {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]PublishedPort(nil), a.byAgent[agent]...)
+}
+
+func (a *PortAllocator) releaseLocked(agent string) {
+	for _, p := range a.byAgent[agent] {
+		delete(a.used, portKey(p.Protocol, p.Published))
+	}
+	delete(a.byAgent, agent)
+}
+
+func (a *PortAllocator) pickLocked(agent string, target int, proto string, prev []PublishedPort, existing []swarm.PortConfig) int {
+	free := func(port int) bool {
+		if port < a.min || port > a.max {
+			return false
+		}
+		holder, ok := a.used[portKey(proto, port)]
+		return !ok || holder == agent
+	}
+	for _, p := range prev {
+		if p.Target == target && p.Protocol == proto && free(p.Published) {
+			return p.Published
+		}
+	}
+	for _, pc := range existing {
+		if int(pc.TargetPort) == target && string(pc.Protocol) == proto && free(int(pc.PublishedPort)) {
+			return int(pc.PublishedPort)
+		}
+	}
+	for port := a.min; port <= a.max; port++ {
+		if free(port) {
+			return port
+		}
+	}
+	return 0
+}
+
+func portKey(proto string, port int) string {
+	return fmt.Sprintf("%s/%d", proto, port)
+}
+
+// applyPublishedPorts replaces the spec's mappings for the given targets,
+// keeping any other published ports.
+func applyPublishedPorts(spec *swarm.ServiceSpec, ports []PublishedPort) {
+	if spec.EndpointSpec == nil {
+		spec.EndpointSpec = &swarm.EndpointSpec{}
+	}
+	managed := make(map[string]bool)
+	for _, p := range ports {
+		managed[portKey(p.Protocol, p.Target)] = true
+	}
+	var kept []swarm.PortConfig
+	for _, pc := range spec.EndpointSpec.Ports {
+		if !managed[portKey(string(pc.Protocol), int(pc.TargetPort))] {
+			kept = append(kept, pc)
+		}
+	}
+	for _, p := range ports {
+		kept = append(kept, swarm.PortConfig{
+			Protocol:      swarm.PortConfigProtocol(p.Protocol),
+			TargetPort:    uint32(p.Target),
+			PublishedPort: uint32(p.Published),
+			PublishMode:   swarm.PortConfigPublishModeIngress,
+		})
+	}
+	sort.Slice(kept, func(i, j int) bool { return kept[i].TargetPort < kept[j].TargetPort })
+	spec.EndpointSpec.Ports = kept
+}
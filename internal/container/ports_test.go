@@ -0,0 +1,124 @@
+package container
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/swarm"
+)
+
+func TestPortAllocatorAssignsFromRange(t *testing.T) {
+	a := NewPortAllocator(30000, 30002)
+	var recorded []PublishedPort
+	a.OnAssign = func(agent string, ports []PublishedPort) { recorded = ports }
+
+	ports, err := a.Assign("kai", []PublishSpec{{Target: 8080}, {Target: 53, Protocol: "udp"}}, nil)
+	if err != nil {
+		t.Fatalf("assign: %v", err)
+	}
+	if ports[0].Published != 30000 || ports[0].Protocol != "tcp" {
+		t.Errorf("first port = %+v, want tcp/30000", ports[0])
+	}
+	// UDP has its own port space.
+	if ports[1].Published != 30000 || ports[1].Protocol != "udp" {
+		t.Errorf("second port = %+v, want udp/30000", ports[1])
+	}
+	if len(recorded) != 2 {
+		t.Errorf("OnAssign got %d ports, want 2", len(recorded))
+	}
+
+	other, err := a.Assign("mc", []PublishSpec{{Target: 8080}}, nil)
+	if err != nil {
+		t.Fatalf("assign: %v", err)
+	}
+	if other[0].Published != 30001 {
+		t.Errorf("second agent got %d, want 30001", other[0].Published)
+	}
+}
+
+func TestPortAllocatorStableAcrossWakes(t *testing.T) {
+	a := NewPortAllocator(30000, 30010)
+	first, _ := a.Assign("kai", []PublishSpec{{Target: 8080}}, nil)
+	a.Assign("mc", []PublishSpec{{Target: 8080}}, nil)
+	again, err := a.Assign("kai", []PublishSpec{{Target: 8080}}, nil)
+	if err != nil {
+		t.Fatalf("assign: %v", err)
+	}
+	if again[0].Published != first[0].Published {
+		t.Errorf("reassigned %d, want stable %d", again[0].Published, first[0].Published)
+	}
+}
+
+func TestPortAllocatorReusesExistingSpec(t *testing.T) {
+	a := NewPortAllocator(30000, 30010)
+	existing := []swarm.PortConfig{{Protocol: "tcp", TargetPort: 8080, PublishedPort: 30007}}
+	ports, err := a.Assign("kai", []PublishSpec{{Target: 8080, Protocol: "tcp"}}, existing)
+	if err != nil {
+		t.Fatalf("assign: %v", err)
+	}
+	if ports[0].Published != 30007 {
+		t.Errorf("published = %d, want existing 30007", ports[0].Published)
+	}
+}
+
+func TestPortAllocatorExhaustedAndConflicts(t *testing.T) {
+	a := NewPortAllocator(30000, 30000)
+	if _, err := a.Assign("kai", []PublishSpec{{Target: 8080}}, nil); err != nil {
+		t.Fatalf("assign: %v", err)
+	}
+	if _, err := a.Assign("mc", []PublishSpec{{Target: 8080}}, nil); err == nil || !strings.Contains(err.Error(), "no free host port") {
+		t.Errorf("expected exhaustion error, got %v", err)
+	}
+	if _, err := a.Assign("mc", []PublishSpec{{Target: 8080, Published: 30000}}, nil); err == nil || !strings.Contains(err.Error(), "already published") {
+		t.Errorf("expected conflict error, got %v", err)
+	}
+
+	a.Release("kai")
+	if _, err := a.Assign("mc", []PublishSpec{{Target: 8080}}, nil); err != nil {
+		t.Errorf("expected released port to be reusable, got %v", err)
+	}
+}
+
+func TestApplyPublishedPortsKeepsUnmanaged(t *testing.T) {
+	spec := &swarm.ServiceSpec{EndpointSpec: &swarm.EndpointSpec{Ports: []swarm.PortConfig{
+		{Protocol: "tcp", TargetPort: 9090, PublishedPort: 9090},
+		{Protocol: "tcp", TargetPort: 8080, PublishedPort: 1234},
+	}}}
+	applyPublishedPorts(spec, []PublishedPort{{Target: 8080, Published: 30000, Protocol: "tcp"}})
+
+	if len(spec.EndpointSpec.Ports) != 2 {
+		t.Fatalf("ports = %+v", spec.EndpointSpec.Ports)
+	}
+	for _, pc := range spec.EndpointSpec.Ports {
+		if pc.TargetPort == 8080 && pc.PublishedPort != 30000 {
+			t.Errorf("8080 published on %d, want 30000", pc.PublishedPort)
+		}
+		if pc.TargetPort == 9090 && pc.PublishedPort != 9090 {
+			t.Error("unmanaged mapping should be kept")
+		}
+	}
+}
+
+func TestManagerPublishPorts(t *testing.T) {
+	m := NewManager(nil, slog.Default())
+	m.SetPortAllocator(NewPortAllocator(30000, 30010))
+
+	ports, err := m.PublishPorts(context.Background(), "kai", "openclaw_kai", []PublishSpec{{Target: 8080, Protocol: "tcp"}})
+	if err != nil || len(ports) != 1 || ports[0].Published != 30000 {
+		t.Fatalf("publish = %+v, %v, want tcp/30000", ports, err)
+	}
+	// The mapping is known before the service starts, and applied when it does.
+	if agent, got := m.publishedFor("openclaw_kai"); agent != "kai" || len(got) != 1 || got[0].Published != 30000 {
+		t.Errorf("published for service = %s %+v", agent, got)
+	}
+
+	// Dropping container.publish frees the ports.
+	if _, err := m.PublishPorts(context.Background(), "kai", "openclaw_kai", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, got := m.publishedFor("openclaw_kai"); len(got) != 0 {
+		t.Errorf("ports still published after removal: %+v", got)
+	}
+}
@@ -0,0 +1,128 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// errNotRunning is returned when a service has no running container to sample.
+var errNotRunning = errors.New("no running container")
+
+// CPUSampler reports a service's current CPU usage as a percentage of one
+// core (200 means two cores fully busy). Satisfied by Manager.
+type CPUSampler interface {
+	CPUPercent(ctx context.Context, name string) (float64, error)
+}
+
+// Toucher records activity for a hostname. Satisfied by proxy.ActivityTracker.
+type Toucher interface {
+	Touch(hostname string)
+}
+
+// CPUWatch describes how to sample one agent's CPU usage.
+type CPUWatch struct {
+	Agent     string
+	Hostname  string
+	Service   string
+	Threshold float64 // percent of one core
+	Interval  time.Duration
+	// State reports the agent's policy state; CPU is only sampled while ready.
+	State func() string
+}
+
+// WatchCPU samples the agent's CPU usage every interval until ctx is done,
+// touching activity while usage is at or above the threshold. This keeps an
+// on-demand agent doing background work awake without any HTTP traffic.
+// Failed samples are logged and count as idle.
+func WatchCPU(ctx context.Context, sampler CPUSampler, activity Toucher, w CPUWatch, logger *slog.Logger) {
+	logger = logger.With("component", "cpu-activity", "agent", w.Agent)
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if w.State != nil && w.State() != "ready" {
+				continue
+			}
+			pct, err := sampler.CPUPercent(ctx, w.Service)
+			if err != nil {
+				if ctx.Err() == nil && !errors.Is(err, errNotRunning) {
+					logger.Warn("cpu sample failed", "error", err)
+				}
+				continue
+			}
+			if pct >= w.Threshold {
+				logger.Debug("agent busy on cpu, touching activity", "cpu_percent", pct, "threshold", w.Threshold)
+				activity.Touch(w.Hostname)
+			}
+		}
+	}
+}
+
+// CPUPercent samples the CPU usage of the service's running container. The
+// stats call blocks for about a second so the engine can take two readings.
+func (m *Manager) CPUPercent(ctx context.Context, name string) (float64, error) {
+	id, err := m.runningContainer(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := m.docker.ContainerStats(ctx, id, false)
+	if err != nil {
+		return 0, fmt.Errorf("stats for container %q: %w", id, err)
+	}
+	defer resp.Body.Close()
+
+	var stats container.StatsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return 0, fmt.Errorf("decode stats for container %q: %w", id, err)
+	}
+	return cpuPercent(stats.CPUStats, stats.PreCPUStats), nil
+}
+
+// runningContainer returns the container ID of the service's running task.
+func (m *Manager) runningContainer(ctx context.Context, name string) (string, error) {
+	tasks, err := m.docker.TaskList(ctx, types.TaskListOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("service", name),
+			filters.Arg("desired-state", "running"),
+		),
+	})
+	if err != nil {
+		return "", fmt.Errorf("list tasks for service %q: %w", name, err)
+	}
+	for _, t := range tasks {
+		if t.Status.State == swarm.TaskStateRunning && t.Status.ContainerStatus != nil && t.Status.ContainerStatus.ContainerID != "" {
+			return t.Status.ContainerStatus.ContainerID, nil
+		}
+	}
+	return "", errNotRunning
+}
+
+// cpuPercent computes usage between two readings the way `docker stats` does.
+func cpuPercent(cur, pre container.CPUStats) float64 {
+	if cur.CPUUsage.TotalUsage <= pre.CPUUsage.TotalUsage || cur.SystemUsage <= pre.SystemUsage {
+		return 0
+	}
+	cpuDelta := float64(cur.CPUUsage.TotalUsage - pre.CPUUsage.TotalUsage)
+	sysDelta := float64(cur.SystemUsage - pre.SystemUsage)
+	cpus := float64(cur.OnlineCPUs)
+	if cpus == 0 {
+		cpus = float64(len(cur.CPUUsage.PercpuUsage))
+	}
+	if cpus == 0 {
+		cpus = 1
+	}
+	return cpuDelta / sysDelta * cpus * 100
+}
@@ -0,0 +1,85 @@
+package container
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestCPUPercent(t *testing.T) {
+	pre := container.CPUStats{CPUUsage: container.CPUUsage{TotalUsage: 1000}, SystemUsage: 10000, OnlineCPUs: 4}
+	cur := container.CPUStats{CPUUsage: container.CPUUsage{TotalUsage: 1500}, SystemUsage: 20000, OnlineCPUs: 4}
+	if got := cpuPercent(cur, pre); got != 20 {
+		t.Errorf("cpuPercent = %v, want 20", got)
+	}
+	if got := cpuPercent(pre, pre); got != 0 {
+		t.Errorf("cpuPercent with no delta = %v, want 0", got)
+	}
+}
+
+type fakeSampler struct{ pct atomic.Value }
+
+func (f *fakeSampler) CPUPercent(context.Context, string) (float64, error) {
+	return f.pct.Load().(float64), nil
+}
+
+type countingToucher struct {
+	mu    sync.Mutex
+	count map[string]int
+}
+
+func (c *countingToucher) Touch(hostname string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.count[hostname]++
+}
+
+func (c *countingToucher) get(hostname string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.count[hostname]
+}
+
+func TestWatchCPUTouchesWhileBusy(t *testing.T) {
+	sampler := &fakeSampler{}
+	sampler.pct.Store(5.0)
+	toucher := &countingToucher{count: make(map[string]int)}
+	var state atomic.Value
+	state.Store("ready")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go WatchCPU(ctx, sampler, toucher, CPUWatch{
+		Agent:     "a",
+		Hostname:  "a.example.com",
+		Service:   "a-svc",
+		Threshold: 10,
+		Interval:  10 * time.Millisecond,
+		State:     func() string { return state.Load().(string) },
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	time.Sleep(50 * time.Millisecond)
+	if n := toucher.get("a.example.com"); n != 0 {
+		t.Fatalf("touched %d times below threshold", n)
+	}
+
+	sampler.pct.Store(50.0)
+	time.Sleep(50 * time.Millisecond)
+	if toucher.get("a.example.com") == 0 {
+		t.Fatal("expected activity while busy")
+	}
+
+	state.Store("sleeping")
+	time.Sleep(20 * time.Millisecond)
+	n := toucher.get("a.example.com")
+	time.Sleep(50 * time.Millisecond)
+	if got := toucher.get("a.example.com"); got != n {
+		t.Errorf("touched while not ready: %d → %d", n, got)
+	}
+}
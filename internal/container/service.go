@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log/slog"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/docker/docker/api/types"
@@ -23,6 +24,10 @@ type Manager struct {
 	logger        *slog.Logger
 	cfg           *config.Config
 	sharedBinPath string
+	ports         *PortAllocator
+
+	mu         sync.Mutex
+	publishing map[string]string // service name → agent whose ports it publishes
 }
 
 func NewManager(docker *client.Client, logger *slog.Logger) *Manager {
@@ -52,6 +57,71 @@ func NewManagerWithConfig(docker *client.Client, logger *slog.Logger, cfg *confi
 	return m
 }
 
+// SetPortAllocator enables publishing the host ports agents list under
+// container.publish, allocated from the allocator's range.
+func (m *Manager) SetPortAllocator(a *PortAllocator) {
+	m.ports = a
+}
+
+// PublishPorts allocates the host ports an agent's service publishes,
+// reusing ones already on the service where they are free, and has them
+// written into the service spec whenever it is started. Called when an
+// agent is started or reconfigured, so its mappings are known before the
+// service first wakes. An empty want stops publishing for the agent.
+func (m *Manager) PublishPorts(ctx context.Context, agent, serviceName string, want []PublishSpec) ([]PublishedPort, error) {
+	if len(want) == 0 || m.ports == nil {
+		m.ReleasePorts(agent)
+		return nil, nil
+	}
+	var existing []swarm.PortConfig
+	if m.docker != nil {
+		if svc, _, err := m.docker.ServiceInspectWithRaw(ctx, serviceName, types.ServiceInspectOptions{}); err == nil && svc.Spec.EndpointSpec != nil {
+			existing = svc.Spec.EndpointSpec.Ports
+		}
+	}
+	ports, err := m.ports.Assign(agent, want, existing)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.publishing == nil {
+		m.publishing = make(map[string]string)
+	}
+	m.forgetLocked(agent)
+	m.publishing[serviceName] = agent
+	return ports, nil
+}
+
+// ReleasePorts frees an agent's allocated host ports, e.g. when it is removed.
+func (m *Manager) ReleasePorts(agent string) {
+	if m.ports != nil {
+		m.ports.Release(agent)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.forgetLocked(agent)
+}
+
+func (m *Manager) forgetLocked(agent string) {
+	for service, a := range m.publishing {
+		if a == agent {
+			delete(m.publishing, service)
+		}
+	}
+}
+
+// publishedFor returns the host ports to write into a service's spec.
+func (m *Manager) publishedFor(serviceName string) (string, []PublishedPort) {
+	m.mu.Lock()
+	agent, ok := m.publishing[serviceName]
+	m.mu.Unlock()
+	if !ok || m.ports == nil {
+		return "", nil
+	}
+	return agent, m.ports.Assigned(agent)
+}
+
 func (m *Manager) Start(ctx context.Context, name string) error {
 	m.logger.Info("scaling service to 1", "service", name)
 	return m.scale(ctx, name, 1)
@@ -100,6 +170,12 @@ func (m *Manager) Status(ctx context.Context, name string) (string, error) {
 
 	for _, task := range tasks {
 		if task.Status.State == "running" {
+			// The task stays running while its container is frozen.
+			if cs := task.Status.ContainerStatus; cs != nil && cs.ContainerID != "" {
+				if c, err := m.docker.ContainerInspect(ctx, cs.ContainerID); err == nil && c.State != nil && c.State.Paused {
+					return "paused", nil
+				}
+			}
 			return "running", nil
 		}
 	}
@@ -107,6 +183,18 @@ func (m *Manager) Status(ctx context.Context, name string) (string, error) {
 	return "starting", nil
 }
 
+// Image returns the container image configured on the service spec.
+func (m *Manager) Image(ctx context.Context, name string) (string, error) {
+	svc, _, err := m.docker.ServiceInspectWithRaw(ctx, name, types.ServiceInspectOptions{})
+	if err != nil {
+		return "", fmt.Errorf("inspect service %q: %w", name, err)
+	}
+	if svc.Spec.TaskTemplate.ContainerSpec == nil {
+		return "", fmt.Errorf("service %q has no container spec", name)
+	}
+	return svc.Spec.TaskTemplate.ContainerSpec.Image, nil
+}
+
 // findAgentForService finds the agent config that corresponds to a service name.
 // It looks for an agent whose container name matches the service name.
 func (m *Manager) findAgentForService(serviceName string) (*config.Agent, string) {
@@ -217,6 +305,12 @@ func (m *Manager) scale(ctx context.Context, name string, replicas uint64) error
 			}
 		}
 	}
+	if originalReplicas == 0 && replicas > 0 {
+		if agentID, ports := m.publishedFor(name); len(ports) > 0 {
+			applyPublishedPorts(&svc.Spec, ports)
+			m.logger.Info("published host ports", "agent", agentID, "ports", ports)
+		}
+	}
 
 	_, err = m.docker.ServiceUpdate(ctx, svc.ID, svc.Version, svc.Spec, types.ServiceUpdateOptions{})
 	if err != nil {
@@ -0,0 +1,275 @@
+// Package cors answers cross-origin requests on a route's behalf, so
+// browser frontends can call agent APIs without every backend implementing
+// CORS itself.
+package cors
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config declares who may call a route from a browser.
+type Config struct {
+	// Origins allowed to make requests, e.g. "https://app.example.com".
+	// "*" allows any origin; "https://*.example.com" allows its subdomains.
+	Origins []string `yaml:"origins"`
+	// Methods allowed on preflighted requests. Default GET, HEAD, POST.
+	Methods []string `yaml:"methods,omitempty"`
+	// Headers the browser may send. "*" allows any.
+	Headers []string `yaml:"headers,omitempty"`
+	// ExposeHeaders are response headers scripts may read.
+	ExposeHeaders []string `yaml:"expose_headers,omitempty"`
+	// Credentials allows cookies and Authorization headers. It can't be
+	// combined with the "*" origin.
+	Credentials bool `yaml:"credentials,omitempty"`
+	// MaxAge is how long browsers may cache a preflight response.
+	MaxAge time.Duration `yaml:"max_age,omitempty"`
+}
+
+var defaultMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+
+// Policy applies a Config to requests.
+type Policy struct {
+	config   Config
+	anyOrig  bool
+	origins  map[string]bool
+	suffixes []suffix // from wildcard origins such as https://*.example.com
+	methods  map[string]bool
+	anyHdr   bool
+	headers  map[string]bool
+}
+
+// suffix matches the subdomains of a wildcard origin.
+type suffix struct {
+	scheme string // "https://"
+	domain string // ".example.com"
+}
+
+// New validates c and builds a policy from it.
+func New(c Config) (*Policy, error) {
+	if len(c.Origins) == 0 {
+		return nil, fmt.Errorf("cors: at least one origin is required")
+	}
+	if c.MaxAge < 0 {
+		return nil, fmt.Errorf("cors: max_age must not be negative")
+	}
+	p := &Policy{
+		config:  c,
+		origins: make(map[string]bool),
+		methods: make(map[string]bool),
+		headers: make(map[string]bool),
+	}
+	for _, o := range c.Origins {
+		switch {
+		case o == "*":
+			p.anyOrig = true
+		case strings.Contains(o, "://*."):
+			scheme, domain, _ := strings.Cut(strings.ToLower(o), "*")
+			if err := checkOrigin(scheme + "x" + domain); err != nil {
+				return nil, fmt.Errorf("cors: invalid origin %q: %w", o, err)
+			}
+			p.suffixes = append(p.suffixes, suffix{scheme: scheme, domain: domain})
+		default:
+			if err := checkOrigin(o); err != nil {
+				return nil, fmt.Errorf("cors: invalid origin %q: %w", o, err)
+			}
+			p.origins[strings.ToLower(o)] = true
+		}
+	}
+	if p.anyOrig && c.Credentials {
+		return nil, fmt.Errorf(`cors: credentials cannot be allowed for origin "*"`)
+	}
+	methods := c.Methods
+	if len(methods) == 0 {
+		methods = defaultMethods
+	}
+	for _, m := range methods {
+		p.methods[strings.ToUpper(m)] = true
+	}
+	for _, h := range c.Headers {
+		if h == "*" {
+			p.anyHdr = true
+			continue
+		}
+		p.headers[http.CanonicalHeaderKey(h)] = true
+	}
+	return p, nil
+}
+
+// checkOrigin requires an origin to be a bare scheme://host[:port].
+func checkOrigin(o string) error {
+	u, err := url.Parse(o)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("scheme must be http or https")
+	}
+	if u.Host == "" || u.User != nil || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("must be scheme://host[:port]")
+	}
+	return nil
+}
+
+// Config returns the configuration the policy was built from.
+func (p *Policy) Config() Config {
+	return p.config
+}
+
+// AllowsOrigin reports whether requests from origin are allowed.
+func (p *Policy) AllowsOrigin(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	if p.anyOrig {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if p.origins[origin] {
+		return true
+	}
+	for _, s := range p.suffixes {
+		if host, ok := strings.CutPrefix(origin, s.scheme); ok && len(host) > len(s.domain) && strings.HasSuffix(host, s.domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handle applies the policy to a request. Preflight requests are answered
+// here, before they reach authentication or the backend, and Handle
+// returns ok=false. Otherwise it returns the writer to respond through,
+// which adds the CORS headers and replaces any the backend sets itself.
+func (p *Policy) Handle(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, bool) {
+	origin := r.Header.Get("Origin")
+	if origin != "" && r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+		p.preflight(w, r, origin)
+		return w, false
+	}
+	if r.Header.Get("Upgrade") != "" {
+		// Browsers don't apply CORS to WebSockets.
+		return w, true
+	}
+	// Whether the response carries CORS headers depends on the Origin,
+	// including when there is none, so shared caches must key on it.
+	w.Header().Add("Vary", "Origin")
+	if !p.AllowsOrigin(origin) {
+		// A disallowed origin simply gets no CORS headers, so its script
+		// can't read the reply.
+		return w, true
+	}
+	return &writer{ResponseWriter: w, policy: p, origin: origin}, true
+}
+
+// preflight answers an OPTIONS preflight request.
+func (p *Policy) preflight(w http.ResponseWriter, r *http.Request, origin string) {
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+	if !p.AllowsOrigin(origin) {
+		http.Error(w, "cors: origin not allowed", http.StatusForbidden)
+		return
+	}
+	method := strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+	if !p.methods[method] {
+		http.Error(w, "cors: method not allowed", http.StatusForbidden)
+		return
+	}
+	var requested []string
+	for _, v := range r.Header.Values("Access-Control-Request-Headers") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				requested = append(requested, name)
+			}
+		}
+	}
+	if !p.anyHdr {
+		for _, name := range requested {
+			if !p.headers[http.CanonicalHeaderKey(name)] {
+				http.Error(w, "cors: header "+name+" not allowed", http.StatusForbidden)
+				return
+			}
+		}
+	}
+
+	p.setOrigin(h, origin)
+	methods := make([]string, 0, len(p.methods))
+	for m := range p.methods {
+		methods = append(methods, m)
+	}
+	slices.Sort(methods)
+	h.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+	if len(requested) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(requested, ", "))
+	}
+	if p.config.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(p.config.MaxAge/time.Second)))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setOrigin sets the headers shared by preflight and actual responses.
+func (p *Policy) setOrigin(h http.Header, origin string) {
+	if p.anyOrig {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+	if p.config.Credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// String summarises the policy, e.g. "https://app.example.com (credentials)".
+func (p *Policy) String() string {
+	s := strings.Join(p.config.Origins, ", ")
+	if p.config.Credentials {
+		s += " (credentials)"
+	}
+	return s
+}
+
+// writer sets the policy's headers on the response, dropping any CORS
+// headers the backend set so the browser never sees conflicting values.
+type writer struct {
+	http.ResponseWriter
+	policy *Policy
+	origin string
+	wrote  bool
+}
+
+func (w *writer) WriteHeader(code int) {
+	if !w.wrote && code >= http.StatusOK {
+		w.wrote = true
+		h := w.Header()
+		for name := range h {
+			if strings.HasPrefix(name, "Access-Control-") {
+				delete(h, name)
+			}
+		}
+		w.policy.setOrigin(h, w.origin)
+		if len(w.policy.config.ExposeHeaders) > 0 {
+			h.Set("Access-Control-Expose-Headers", strings.Join(w.policy.config.ExposeHeaders, ", "))
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *writer) Write(b []byte) (int, error) {
+	if !w.wrote {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, so
+// streaming responses can still be flushed.
+func (w *writer) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
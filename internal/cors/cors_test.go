@@ -0,0 +1,135 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewValidation(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		c    Config
+		want string
+	}{
+		{"no origins", Config{}, "at least one origin"},
+		{"wildcard with credentials", Config{Origins: []string{"*"}, Credentials: true}, "credentials"},
+		{"path in origin", Config{Origins: []string{"https://a.com/app"}}, "scheme://host"},
+		{"bad scheme", Config{Origins: []string{"ftp://a.com"}}, "http or https"},
+		{"negative max_age", Config{Origins: []string{"*"}, MaxAge: -time.Second}, "max_age"},
+	} {
+		if _, err := New(tc.c); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: err = %v, want %q", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestAllowsOrigin(t *testing.T) {
+	p, err := New(Config{Origins: []string{"https://app.example.com", "https://*.preview.dev"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for origin, want := range map[string]bool{
+		"https://app.example.com":  true,
+		"https://APP.example.com":  true,
+		"http://app.example.com":   false,
+		"https://evil.com":         false,
+		"https://pr-1.preview.dev": true,
+		"https://preview.dev":      false,
+		"https://xpreview.dev":     false,
+		"":                         false,
+	} {
+		if got := p.AllowsOrigin(origin); got != want {
+			t.Errorf("AllowsOrigin(%q) = %v, want %v", origin, got, want)
+		}
+	}
+}
+
+func preflight(origin, method, headers string) *http.Request {
+	r := httptest.NewRequest(http.MethodOptions, "/", nil)
+	r.Header.Set("Origin", origin)
+	r.Header.Set("Access-Control-Request-Method", method)
+	if headers != "" {
+		r.Header.Set("Access-Control-Request-Headers", headers)
+	}
+	return r
+}
+
+func TestPreflight(t *testing.T) {
+	p, _ := New(Config{
+		Origins:     []string{"https://app.example.com"},
+		Methods:     []string{"GET", "PUT"},
+		Headers:     []string{"Content-Type", "Authorization"},
+		Credentials: true,
+		MaxAge:      10 * time.Minute,
+	})
+
+	w := httptest.NewRecorder()
+	if _, ok := p.Handle(w, preflight("https://app.example.com", "PUT", "content-type, authorization")); ok {
+		t.Fatal("preflight should be answered by Handle")
+	}
+	h := w.Header()
+	if w.Code != http.StatusNoContent ||
+		h.Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		h.Get("Access-Control-Allow-Methods") != "GET, PUT" ||
+		h.Get("Access-Control-Allow-Headers") != "content-type, authorization" ||
+		h.Get("Access-Control-Allow-Credentials") != "true" ||
+		h.Get("Access-Control-Max-Age") != "600" {
+		t.Errorf("allowed preflight: %d %v", w.Code, h)
+	}
+
+	for _, r := range []*http.Request{
+		preflight("https://evil.com", "GET", ""),
+		preflight("https://app.example.com", "DELETE", ""),
+		preflight("https://app.example.com", "GET", "X-Secret"),
+	} {
+		w := httptest.NewRecorder()
+		p.Handle(w, r)
+		if w.Code != http.StatusForbidden || w.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("%s %s %s: %d %v", r.Header.Get("Origin"), r.Header.Get("Access-Control-Request-Method"),
+				r.Header.Get("Access-Control-Request-Headers"), w.Code, w.Header())
+		}
+	}
+}
+
+func TestActualRequestReplacesBackendHeaders(t *testing.T) {
+	p, _ := New(Config{Origins: []string{"*"}, ExposeHeaders: []string{"X-Request-Id"}})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Origin", "https://anywhere.com")
+	rec := httptest.NewRecorder()
+	w, ok := p.Handle(rec, r)
+	if !ok {
+		t.Fatal("actual request should be passed on")
+	}
+	w.Header().Set("Access-Control-Allow-Origin", "https://backend-default.com")
+	w.Write([]byte("hi"))
+
+	h := rec.Header()
+	if got := h.Values("Access-Control-Allow-Origin"); len(got) != 1 || got[0] != "*" {
+		t.Errorf("Allow-Origin = %v, want [*]", got)
+	}
+	if h.Get("Access-Control-Expose-Headers") != "X-Request-Id" || h.Get("Vary") != "Origin" {
+		t.Errorf("headers = %v", h)
+	}
+
+	// Requests without an Origin, and from disallowed origins, pass
+	// through unwrapped, but still vary on Origin so a shared cache
+	// doesn't serve their reply to an allowed origin.
+	rec = httptest.NewRecorder()
+	if w, _ := p.Handle(rec, httptest.NewRequest(http.MethodGet, "/", nil)); w != http.ResponseWriter(rec) {
+		t.Error("same-origin request should not be wrapped")
+	}
+	if got := rec.Header().Values("Vary"); len(got) != 1 || got[0] != "Origin" {
+		t.Errorf("same-origin Vary = %v, want [Origin]", got)
+	}
+	strict, _ := New(Config{Origins: []string{"https://app.example.com"}})
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Origin", "https://evil.example.com")
+	rec = httptest.NewRecorder()
+	if w, _ := strict.Handle(rec, r); w != http.ResponseWriter(rec) || rec.Header().Get("Vary") != "Origin" {
+		t.Errorf("disallowed origin: Vary = %v", rec.Header().Values("Vary"))
+	}
+}
@@ -0,0 +1,172 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cloudflare manages records through Cloudflare's API with an API token
+// allowed to edit the zones' DNS.
+type Cloudflare struct {
+	token   string
+	proxied bool
+	baseURL string
+	client  *http.Client
+
+	mu    sync.Mutex
+	zones map[string]string // zone name → ID
+}
+
+// NewCloudflare creates a Cloudflare provider. With proxied set, records
+// are proxied through Cloudflare (the orange cloud) and their TTL is left
+// to Cloudflare.
+func NewCloudflare(token string, proxied bool) *Cloudflare {
+	return &Cloudflare{
+		token:   token,
+		proxied: proxied,
+		baseURL: "https://api.cloudflare.com/client/v4",
+		client:  &http.Client{Timeout: 30 * time.Second},
+		zones:   make(map[string]string),
+	}
+}
+
+type cloudflareRecord struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	TTL     int    `json:"ttl"`
+	Proxied bool   `json:"proxied"`
+}
+
+// Records returns the A, AAAA, CNAME and TXT records at name.
+func (c *Cloudflare) Records(ctx context.Context, zone, name string) ([]Record, error) {
+	id, err := c.zoneID(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	var found []cloudflareRecord
+	if err := c.do(ctx, http.MethodGet, "/zones/"+id+"/dns_records?name="+url.QueryEscape(name), nil, &found); err != nil {
+		return nil, err
+	}
+	var records []Record
+	for _, r := range found {
+		if r.Type == "A" || r.Type == "AAAA" || r.Type == "CNAME" || r.Type == "TXT" {
+			records = append(records, Record{ID: r.ID, Name: r.Name, Type: r.Type, Content: r.Content, TTL: r.TTL})
+		}
+	}
+	return records, nil
+}
+
+// Create adds r.
+func (c *Cloudflare) Create(ctx context.Context, zone string, r Record) error {
+	id, err := c.zoneID(ctx, zone)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, http.MethodPost, "/zones/"+id+"/dns_records", c.record(r), nil)
+}
+
+// Update overwrites old with r.
+func (c *Cloudflare) Update(ctx context.Context, zone string, old, r Record) error {
+	id, err := c.zoneID(ctx, zone)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, http.MethodPut, "/zones/"+id+"/dns_records/"+old.ID, c.record(r), nil)
+}
+
+// Delete removes r.
+func (c *Cloudflare) Delete(ctx context.Context, zone string, r Record) error {
+	id, err := c.zoneID(ctx, zone)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, http.MethodDelete, "/zones/"+id+"/dns_records/"+r.ID, nil, nil)
+}
+
+func (c *Cloudflare) record(r Record) cloudflareRecord {
+	// TXT records, such as ownership records, can't be proxied.
+	proxied := c.proxied && r.Type != "TXT"
+	rec := cloudflareRecord{Type: r.Type, Name: r.Name, Content: r.Content, TTL: r.TTL, Proxied: proxied}
+	if proxied {
+		rec.TTL = 1 // automatic, the only TTL proxied records take
+	}
+	return rec
+}
+
+// zoneID looks up a zone's ID by name, once.
+func (c *Cloudflare) zoneID(ctx context.Context, zone string) (string, error) {
+	c.mu.Lock()
+	id, ok := c.zones[zone]
+	c.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+	var found []struct {
+		ID string `json:"id"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/zones?name="+url.QueryEscape(zone), nil, &found); err != nil {
+		return "", err
+	}
+	if len(found) == 0 {
+		return "", fmt.Errorf("cloudflare: zone %s not found, or the token can't see it", zone)
+	}
+	c.mu.Lock()
+	c.zones[zone] = found[0].ID
+	c.mu.Unlock()
+	return found[0].ID, nil
+}
+
+// do calls the API and decodes the result into out, turning Cloudflare's
+// error envelope into an error.
+func (c *Cloudflare) do(ctx context.Context, method, path string, body, out any) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("cloudflare: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var envelope struct {
+		Success bool            `json:"success"`
+		Result  json.RawMessage `json:"result"`
+		Errors  []struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return fmt.Errorf("cloudflare: %s %s: HTTP %d", method, path, resp.StatusCode)
+	}
+	if !envelope.Success {
+		var msgs []string
+		for _, e := range envelope.Errors {
+			msgs = append(msgs, fmt.Sprintf("%s (%d)", e.Message, e.Code))
+		}
+		return fmt.Errorf("cloudflare: %s %s: %s", method, path, strings.Join(msgs, "; "))
+	}
+	if out != nil {
+		return json.Unmarshal(envelope.Result, out)
+	}
+	return nil
+}
@@ -0,0 +1,449 @@
+// Package dns keeps DNS records for routed hostnames pointing at Warren:
+// records are created when an agent or dynamic service is added and removed
+// when it's deleted, so adding an agent no longer means a trip to the DNS
+// provider's dashboard. Only zones listed in dns.managed_zones are touched.
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"warren/internal/events"
+)
+
+// DefaultInterval is how often routed hostnames are compared against the
+// records in place. Only differences reach the provider.
+const DefaultInterval = 30 * time.Second
+
+// DefaultTTL is the TTL of records Warren creates unless configured
+// otherwise.
+const DefaultTTL = 5 * time.Minute
+
+// OwnerPrefix is prepended to a hostname to name the TXT record marking
+// its address record as Warren's, e.g. "_warren.kai.example.com". Records
+// Warren finds without one are left alone unless they already point at the
+// target. Add the TXT record by hand to let Warren take one over.
+const OwnerPrefix = "_warren."
+
+// OwnerContent is the content of ownership TXT records.
+const OwnerContent = "heritage=warren"
+
+// Record is an A, AAAA, CNAME or TXT record.
+type Record struct {
+	ID      string // provider's record ID, where it has one
+	Name    string
+	Type    string
+	Content string
+	TTL     int // seconds
+}
+
+// Provider reads and changes records in a DNS zone.
+type Provider interface {
+	// Records returns the A, AAAA, CNAME and TXT records at name.
+	Records(ctx context.Context, zone, name string) ([]Record, error)
+	Create(ctx context.Context, zone string, r Record) error
+	// Update replaces old, as returned by Records, with r.
+	Update(ctx context.Context, zone string, old, r Record) error
+	Delete(ctx context.Context, zone string, r Record) error
+}
+
+// Batcher is a Provider that can make several changes to a zone at once,
+// all or none of them, so a hostname isn't left without a record halfway
+// through replacing one.
+type Batcher interface {
+	Apply(ctx context.Context, zone string, changes []Change) error
+}
+
+// Change is one record change: Action is "create", "update" or "delete".
+// Old is the record updated or deleted, as returned by Records; New the
+// record created or updated to.
+type Change struct {
+	Action string
+	Old    Record
+	New    Record
+}
+
+// errNotOwned and errApexCNAME are why a hostname's record is left alone.
+var (
+	errNotOwned  = errors.New("record exists and isn't Warren's")
+	errApexCNAME = errors.New("a CNAME can't be at the zone apex")
+)
+
+// Route is what a routed hostname belongs to.
+type Route struct {
+	Agent   string // owning agent, if any
+	Service bool   // a dynamic service, which drops out of routing while its agent sleeps
+}
+
+// Options configures a Syncer.
+type Options struct {
+	Zones  []string      // zones records may be changed in, e.g. "example.com"
+	Target string        // address (A or AAAA record) or hostname (CNAME) records point at
+	TTL    time.Duration // default: DefaultTTL
+	DryRun bool          // log and emit changes without making them
+}
+
+// Syncer creates and removes records as hostnames come and go.
+type Syncer struct {
+	provider Provider
+	opts     Options
+	want     Record // Name filled in per hostname
+	routes   func() map[string]Route
+	emitter  *events.Emitter
+	logger   *slog.Logger
+	trigger  chan struct{}
+
+	mu      sync.Mutex
+	synced  map[string]Route  // hostnames whose records are in place
+	outside map[string]bool   // hostnames outside the managed zones, logged once
+	skipped map[string]string // hostnames whose records are left alone, and why; logged once
+}
+
+// New creates a syncer. routes is called on every sync and returns the
+// hostnames currently routed.
+func New(provider Provider, opts Options, routes func() map[string]Route, emitter *events.Emitter, logger *slog.Logger) *Syncer {
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultTTL
+	}
+	for i, z := range opts.Zones {
+		opts.Zones[i] = normalize(z)
+	}
+	return &Syncer{
+		provider: provider,
+		opts:     opts,
+		want:     Record{Type: RecordType(opts.Target), Content: normalize(opts.Target), TTL: int(opts.TTL / time.Second)},
+		routes:   routes,
+		emitter:  emitter,
+		logger:   logger.With("component", "dns"),
+		trigger:  make(chan struct{}, 1),
+		synced:   make(map[string]Route),
+		outside:  make(map[string]bool),
+		skipped:  make(map[string]string),
+	}
+}
+
+// RecordType is the type of record pointing at target: A or AAAA for an
+// address and CNAME for a hostname.
+func RecordType(target string) string {
+	a, err := netip.ParseAddr(target)
+	switch {
+	case err != nil:
+		return "CNAME"
+	case a.Is4():
+		return "A"
+	default:
+		return "AAAA"
+	}
+}
+
+// Run syncs immediately, then every interval and whenever Trigger is
+// called, until ctx is cancelled.
+func (s *Syncer) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.Sync(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.trigger:
+		}
+	}
+}
+
+// Trigger asks Run to sync now, e.g. after an agent was added.
+func (s *Syncer) Trigger() {
+	select {
+	case s.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Sync makes sure every routed hostname in a managed zone has a record
+// pointing at the target and removes the records of hostnames no longer
+// routed. A service's record is kept while its agent exists, since the
+// service drops out while the agent sleeps. Records are removed only while
+// they still point at the target, so one repointed by hand is left alone.
+// A hostname with a record Warren didn't create, pointing elsewhere, is
+// skipped with a warning. Failures are logged and retried on the next
+// sync. Records of hostnames removed while Warren wasn't running aren't
+// known, so they stay.
+func (s *Syncer) Sync(ctx context.Context) {
+	routes := make(map[string]Route)
+	agents := make(map[string]bool)
+	for hostname, r := range s.routes() {
+		routes[normalize(hostname)] = r
+		if r.Agent != "" && !r.Service {
+			agents[r.Agent] = true
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, hostname := range sortedKeys(routes) {
+		if _, ok := s.synced[hostname]; ok {
+			s.synced[hostname] = routes[hostname]
+			continue
+		}
+		zone := s.zone(hostname)
+		if zone == "" {
+			if !s.outside[hostname] {
+				s.outside[hostname] = true
+				s.logger.Info("hostname is outside dns.managed_zones; its record is left alone", "hostname", hostname)
+			}
+			continue
+		}
+		err := s.ensure(ctx, zone, hostname, routes[hostname].Agent)
+		switch {
+		case errors.Is(err, errNotOwned) || errors.Is(err, errApexCNAME):
+			// Checked again each sync, e.g. for an ownership record added
+			// by hand, but only logged once.
+			if s.skipped[hostname] != err.Error() {
+				s.skipped[hostname] = err.Error()
+				s.logger.Warn("dns record left alone", "hostname", hostname, "reason", err)
+			}
+			continue
+		case err != nil:
+			s.logger.Warn("dns record update failed", "hostname", hostname, "error", err)
+			continue
+		}
+		delete(s.skipped, hostname)
+		s.synced[hostname] = routes[hostname]
+	}
+
+	for _, hostname := range sortedKeys(s.synced) {
+		r := s.synced[hostname]
+		if _, ok := routes[hostname]; ok || (r.Service && agents[r.Agent]) {
+			continue
+		}
+		if err := s.remove(ctx, s.zone(hostname), hostname, r.Agent); err != nil {
+			s.logger.Warn("dns record removal failed", "hostname", hostname, "error", err)
+			continue
+		}
+		delete(s.synced, hostname)
+	}
+	for hostname := range s.outside {
+		if _, ok := routes[hostname]; !ok {
+			delete(s.outside, hostname)
+		}
+	}
+	for hostname := range s.skipped {
+		if _, ok := routes[hostname]; !ok {
+			delete(s.skipped, hostname)
+		}
+	}
+}
+
+// ensure points hostname at the target, replacing a record of the same
+// type and removing any that can't coexist with it, if Warren owns them.
+// A new record gets an ownership TXT record beside it.
+func (s *Syncer) ensure(ctx context.Context, zone, hostname, agent string) error {
+	want := s.want
+	want.Name = hostname
+	if want.Type == "CNAME" && hostname == zone {
+		return errApexCNAME
+	}
+	existing, err := s.addressRecords(ctx, zone, hostname)
+	if err != nil {
+		return err
+	}
+	for _, r := range existing {
+		if r.Type == want.Type && normalize(r.Content) == want.Content {
+			return nil
+		}
+	}
+	owner, err := s.owner(ctx, zone, hostname)
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 && owner == nil {
+		return errNotOwned
+	}
+
+	var changes []Change
+	var update *Record
+	for _, r := range existing {
+		switch {
+		case r.Type == want.Type && update == nil:
+			update = &r
+		case r.Type == "CNAME" || want.Type == "CNAME":
+			// A CNAME can't share its name with other records.
+			changes = append(changes, Change{Action: "delete", Old: r})
+		}
+	}
+	if update != nil {
+		changes = append(changes, Change{Action: "update", Old: *update, New: want})
+	} else {
+		changes = append(changes, Change{Action: "create", New: want})
+	}
+	if owner == nil {
+		changes = append(changes, Change{Action: "create", New: Record{Name: OwnerPrefix + hostname, Type: "TXT", Content: OwnerContent, TTL: want.TTL}})
+	}
+	return s.apply(ctx, zone, changes, agent)
+}
+
+// remove deletes hostname's records that still point at the target, and
+// its ownership record.
+func (s *Syncer) remove(ctx context.Context, zone, hostname, agent string) error {
+	existing, err := s.addressRecords(ctx, zone, hostname)
+	if err != nil {
+		return err
+	}
+	var changes []Change
+	for _, r := range existing {
+		if r.Type == s.want.Type && normalize(r.Content) == s.want.Content {
+			changes = append(changes, Change{Action: "delete", Old: r})
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	owner, err := s.owner(ctx, zone, hostname)
+	if err != nil {
+		return err
+	}
+	if owner != nil {
+		changes = append(changes, Change{Action: "delete", Old: *owner})
+	}
+	return s.apply(ctx, zone, changes, agent)
+}
+
+// addressRecords returns the A, AAAA and CNAME records at hostname.
+func (s *Syncer) addressRecords(ctx context.Context, zone, hostname string) ([]Record, error) {
+	records, err := s.provider.Records(ctx, zone, hostname)
+	if err != nil {
+		return nil, err
+	}
+	var out []Record
+	for _, r := range records {
+		if r.Type != "TXT" {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+// owner returns the TXT record marking hostname's record as Warren's, or
+// nil if there is none.
+func (s *Syncer) owner(ctx context.Context, zone, hostname string) (*Record, error) {
+	records, err := s.provider.Records(ctx, zone, OwnerPrefix+hostname)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range records {
+		if r.Type == "TXT" && strings.Trim(r.Content, `"`) == OwnerContent {
+			return &r, nil
+		}
+	}
+	return nil, nil
+}
+
+// apply makes changes, in one batch where the provider supports it, or
+// with DryRun only reports them, and emits dns.record_changed for each
+// address record changed.
+func (s *Syncer) apply(ctx context.Context, zone string, changes []Change, agent string) error {
+	if !s.opts.DryRun {
+		if b, ok := s.provider.(Batcher); ok {
+			if err := b.Apply(ctx, zone, changes); err != nil {
+				return fmt.Errorf("change records: %w", err)
+			}
+		} else {
+			for i, c := range changes {
+				if err := s.change(ctx, zone, c); err != nil {
+					// Report what was done before the failure.
+					s.emit(zone, changes[:i], agent)
+					return err
+				}
+			}
+		}
+	}
+	s.emit(zone, changes, agent)
+	return nil
+}
+
+// change makes one change through the provider.
+func (s *Syncer) change(ctx context.Context, zone string, c Change) error {
+	var err error
+	switch c.Action {
+	case "create":
+		err = s.provider.Create(ctx, zone, c.New)
+	case "update":
+		err = s.provider.Update(ctx, zone, c.Old, c.New)
+	case "delete":
+		err = s.provider.Delete(ctx, zone, c.Old)
+	}
+	if err != nil {
+		return fmt.Errorf("%s %s record: %w", c.Action, c.shown().Type, err)
+	}
+	return nil
+}
+
+// emit emits dns.record_changed for the address records among changes.
+func (s *Syncer) emit(zone string, changes []Change, agent string) {
+	if s.emitter == nil {
+		return
+	}
+	for _, c := range changes {
+		shown := c.shown()
+		if shown.Type == "TXT" {
+			continue
+		}
+		fields := map[string]string{
+			"hostname": shown.Name,
+			"action":   c.Action,
+			"type":     shown.Type,
+			"content":  shown.Content,
+			"zone":     zone,
+		}
+		if s.opts.DryRun {
+			fields["dry_run"] = "true"
+		}
+		s.emitter.Emit(events.Event{Type: events.DNSRecordChanged, Agent: agent, Fields: fields})
+	}
+}
+
+// shown is the record a change is about: the one deleted, or the one
+// created or updated to.
+func (c Change) shown() Record {
+	if c.Action == "delete" {
+		return c.Old
+	}
+	return c.New
+}
+
+// zone returns the most specific managed zone containing hostname, or ""
+// if none does.
+func (s *Syncer) zone(hostname string) string {
+	best := ""
+	for _, z := range s.opts.Zones {
+		if (hostname == z || strings.HasSuffix(hostname, "."+z)) && len(z) > len(best) {
+			best = z
+		}
+	}
+	return best
+}
+
+// normalize lowercases a DNS name and drops its trailing dot.
+func normalize(name string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,371 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"warren/internal/events"
+)
+
+// fakeProvider keeps records in memory, keyed by name.
+type fakeProvider struct {
+	mu      sync.Mutex
+	records map[string][]Record
+	nextID  int
+	changes []string
+}
+
+func (f *fakeProvider) Records(_ context.Context, _, name string) ([]Record, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Record(nil), f.records[name]...), nil
+}
+
+func (f *fakeProvider) Create(_ context.Context, zone string, r Record) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextID++
+	r.ID = fmt.Sprint(f.nextID)
+	f.records[r.Name] = append(f.records[r.Name], r)
+	f.changes = append(f.changes, fmt.Sprintf("create %s %s %s in %s", r.Name, r.Type, r.Content, zone))
+	return nil
+}
+
+func (f *fakeProvider) Update(_ context.Context, _ string, old, r Record) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, rec := range f.records[old.Name] {
+		if rec.ID == old.ID {
+			r.ID = old.ID
+			f.records[old.Name][i] = r
+		}
+	}
+	f.changes = append(f.changes, fmt.Sprintf("update %s %s %s", r.Name, r.Type, r.Content))
+	return nil
+}
+
+func (f *fakeProvider) Delete(_ context.Context, _ string, r Record) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var kept []Record
+	for _, rec := range f.records[r.Name] {
+		if rec.ID != r.ID {
+			kept = append(kept, rec)
+		}
+	}
+	f.records[r.Name] = kept
+	f.changes = append(f.changes, fmt.Sprintf("delete %s %s %s", r.Name, r.Type, r.Content))
+	return nil
+}
+
+func (f *fakeProvider) take() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	changes := f.changes
+	f.changes = nil
+	return changes
+}
+
+func newSyncer(t *testing.T, opts Options, routes *map[string]Route) (*Syncer, *fakeProvider, *[]events.Event) {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	emitter := events.NewEmitter(logger)
+	var got []events.Event
+	emitter.OnEvent(func(ev events.Event) { got = append(got, ev) })
+	provider := &fakeProvider{records: map[string][]Record{
+		"api.example.com":         {{ID: "old", Name: "api.example.com", Type: "CNAME", Content: "old-host.example.net"}},
+		"_warren.api.example.com": {{ID: "owner", Name: "_warren.api.example.com", Type: "TXT", Content: `"heritage=warren"`}},
+		"docs.example.com":        {{ID: "docs", Name: "docs.example.com", Type: "A", Content: "203.0.113.7"}},
+	}}
+	s := New(provider, opts, func() map[string]Route { return *routes }, emitter, logger)
+	return s, provider, &got
+}
+
+func wantChanges(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("changes:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestSync(t *testing.T) {
+	routes := map[string]Route{
+		"Kai.example.com":  {Agent: "kai"},
+		"api.example.com":  {Agent: "kai", Service: true},
+		"docs.example.com": {},
+		"kai.example.org":  {Agent: "kai"},
+	}
+	s, provider, got := newSyncer(t, Options{Zones: []string{"example.com."}, Target: "203.0.113.7"}, &routes)
+	ctx := context.Background()
+
+	// api's record is Warren's, so it's replaced; kai gets an ownership
+	// record beside its new one.
+	s.Sync(ctx)
+	wantChanges(t, provider.take(),
+		"delete api.example.com CNAME old-host.example.net",
+		"create api.example.com A 203.0.113.7 in example.com",
+		"create kai.example.com A 203.0.113.7 in example.com",
+		"create _warren.kai.example.com TXT heritage=warren in example.com",
+	)
+	if len(*got) != 3 || (*got)[0].Type != events.DNSRecordChanged || (*got)[0].Fields["action"] != "delete" || (*got)[1].Agent != "kai" {
+		t.Errorf("events = %+v", *got)
+	}
+
+	// Nothing changed, so nothing reaches the provider.
+	s.Sync(ctx)
+	wantChanges(t, provider.take())
+
+	// The agent sleeps: its service drops out, but the record stays.
+	delete(routes, "api.example.com")
+	s.Sync(ctx)
+	wantChanges(t, provider.take())
+
+	// Repointed by hand, docs' record is left alone when docs goes.
+	provider.records["docs.example.com"][0].Content = "198.51.100.1"
+	routes = map[string]Route{}
+	s.Sync(ctx)
+	wantChanges(t, provider.take(),
+		"delete api.example.com A 203.0.113.7",
+		`delete _warren.api.example.com TXT "heritage=warren"`,
+		"delete kai.example.com A 203.0.113.7",
+		"delete _warren.kai.example.com TXT heritage=warren",
+	)
+	if len(provider.records["docs.example.com"]) != 1 {
+		t.Errorf("docs.example.com records = %+v", provider.records["docs.example.com"])
+	}
+}
+
+func TestSyncDryRun(t *testing.T) {
+	routes := map[string]Route{"api.example.com": {Agent: "kai"}}
+	s, provider, got := newSyncer(t, Options{Zones: []string{"example.com"}, Target: "warren.example.net", DryRun: true}, &routes)
+
+	s.Sync(context.Background())
+	wantChanges(t, provider.take())
+	if len(*got) != 1 || (*got)[0].Fields["dry_run"] != "true" || (*got)[0].Fields["action"] != "update" || (*got)[0].Fields["type"] != "CNAME" {
+		t.Errorf("events = %+v", *got)
+	}
+}
+
+func TestSyncLeavesOthersRecordsAlone(t *testing.T) {
+	routes := map[string]Route{
+		"www.example.com": {Agent: "kai"},
+		"example.com":     {Agent: "kai"},
+	}
+	s, provider, got := newSyncer(t, Options{Zones: []string{"example.com"}, Target: "warren.example.net"}, &routes)
+	provider.records["www.example.com"] = []Record{{ID: "www", Name: "www.example.com", Type: "A", Content: "198.51.100.1"}}
+	ctx := context.Background()
+
+	// www's record isn't Warren's, and the apex can't take a CNAME.
+	s.Sync(ctx)
+	wantChanges(t, provider.take())
+	if len(*got) != 0 {
+		t.Errorf("events = %+v", *got)
+	}
+	if s.skipped["www.example.com"] == "" || s.skipped["example.com"] == "" {
+		t.Errorf("skipped = %v", s.skipped)
+	}
+
+	// Marked as Warren's by hand, it's taken over on the next sync.
+	provider.records["_warren.www.example.com"] = []Record{{ID: "o", Name: "_warren.www.example.com", Type: "TXT", Content: "heritage=warren"}}
+	s.Sync(ctx)
+	wantChanges(t, provider.take(),
+		"delete www.example.com A 198.51.100.1",
+		"create www.example.com CNAME warren.example.net in example.com",
+	)
+	if _, ok := s.skipped["www.example.com"]; ok {
+		t.Error("www.example.com still skipped")
+	}
+}
+
+// batchingProvider records the batches it's given.
+type batchingProvider struct {
+	fakeProvider
+	batches [][]Change
+}
+
+func (b *batchingProvider) Apply(_ context.Context, _ string, changes []Change) error {
+	b.batches = append(b.batches, changes)
+	return nil
+}
+
+func TestSyncBatchesChanges(t *testing.T) {
+	provider := &batchingProvider{fakeProvider: fakeProvider{records: map[string][]Record{
+		"api.example.com":         {{Name: "api.example.com", Type: "CNAME", Content: "old-host.example.net"}},
+		"_warren.api.example.com": {{Name: "_warren.api.example.com", Type: "TXT", Content: "heritage=warren"}},
+	}}}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := New(provider, Options{Zones: []string{"example.com"}, Target: "203.0.113.7"}, func() map[string]Route {
+		return map[string]Route{"api.example.com": {}}
+	}, nil, logger)
+
+	s.Sync(context.Background())
+	if len(provider.batches) != 1 || len(provider.batches[0]) != 2 || provider.batches[0][0].Action != "delete" || provider.batches[0][1].Action != "create" {
+		t.Errorf("batches = %+v, want one deleting the CNAME and creating the A record", provider.batches)
+	}
+	wantChanges(t, provider.take())
+}
+
+func TestRecordType(t *testing.T) {
+	for target, want := range map[string]string{"203.0.113.7": "A", "2001:db8::1": "AAAA", "warren.example.net": "CNAME"} {
+		if got := RecordType(target); got != want {
+			t.Errorf("RecordType(%q) = %s, want %s", target, got, want)
+		}
+	}
+}
+
+func TestCloudflare(t *testing.T) {
+	var calls []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer cf-token" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"success":false,"errors":[{"code":10000,"message":"Authentication error"}]}`))
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		calls = append(calls, strings.TrimSpace(r.Method+" "+r.URL.RequestURI()+" "+string(body)))
+		switch {
+		case r.URL.Path == "/zones":
+			w.Write([]byte(`{"success":true,"result":[{"id":"z1"}]}`))
+		case r.Method == http.MethodGet:
+			w.Write([]byte(`{"success":true,"result":[{"id":"r1","type":"A","name":"kai.example.com","content":"198.51.100.1","ttl":300},{"id":"r2","type":"TXT","name":"kai.example.com","content":"x"}]}`))
+		default:
+			w.Write([]byte(`{"success":true,"result":{}}`))
+		}
+	}))
+	defer srv.Close()
+
+	cf := NewCloudflare("cf-token", true)
+	cf.baseURL = srv.URL
+	ctx := context.Background()
+	records, err := cf.Records(ctx, "example.com", "kai.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].ID != "r1" || records[0].Content != "198.51.100.1" || records[1].Type != "TXT" {
+		t.Fatalf("records = %+v", records)
+	}
+	if err := cf.Update(ctx, "example.com", records[0], Record{Name: "kai.example.com", Type: "A", Content: "203.0.113.7", TTL: 300}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cf.Delete(ctx, "example.com", records[0]); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"GET /zones?name=example.com",
+		"GET /zones/z1/dns_records?name=kai.example.com",
+		`PUT /zones/z1/dns_records/r1 {"type":"A","name":"kai.example.com","content":"203.0.113.7","ttl":1,"proxied":true}`,
+		"DELETE /zones/z1/dns_records/r1",
+	}
+	if strings.Join(calls, "\n") != strings.Join(want, "\n") {
+		t.Errorf("calls:\n%s\nwant:\n%s", strings.Join(calls, "\n"), strings.Join(want, "\n"))
+	}
+
+	cf.token = "wrong"
+	if err := cf.Create(ctx, "example.com", Record{}); err == nil || !strings.Contains(err.Error(), "Authentication error") {
+		t.Errorf("err = %v, want the API's error", err)
+	}
+}
+
+func TestRoute53(t *testing.T) {
+	var changes []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/20260211/us-east-1/route53/aws4_request, SignedHeaders=host;x-amz-date, Signature=") {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`<ErrorResponse><Error><Code>SignatureDoesNotMatch</Code><Message>bad</Message></Error></ErrorResponse>`))
+			return
+		}
+		switch {
+		case r.URL.Path == "/2013-04-01/hostedzonesbyname":
+			w.Write([]byte(`<ListHostedZonesByNameResponse><HostedZones>
+				<HostedZone><Id>/hostedzone/ZPRIV</Id><Name>example.com.</Name><Config><PrivateZone>true</PrivateZone></Config></HostedZone>
+				<HostedZone><Id>/hostedzone/Z1</Id><Name>example.com.</Name><Config><PrivateZone>false</PrivateZone></Config></HostedZone>
+			</HostedZones></ListHostedZonesByNameResponse>`))
+		case r.Method == http.MethodGet:
+			if r.URL.Query().Get("name") != "kai.example.com." {
+				t.Errorf("rrset name = %q", r.URL.Query().Get("name"))
+			}
+			w.Write([]byte(`<ListResourceRecordSetsResponse><ResourceRecordSets>
+				<ResourceRecordSet><Name>kai.example.com.</Name><Type>A</Type><TTL>60</TTL><ResourceRecords><ResourceRecord><Value>203.0.113.7</Value></ResourceRecord></ResourceRecords></ResourceRecordSet>
+				<ResourceRecordSet><Name>kai.example.com.</Name><Type>MX</Type><TTL>60</TTL><ResourceRecords><ResourceRecord><Value>10 mail</Value></ResourceRecord></ResourceRecords></ResourceRecordSet>
+				<ResourceRecordSet><Name>mail.example.com.</Name><Type>A</Type><TTL>60</TTL><ResourceRecords><ResourceRecord><Value>203.0.113.9</Value></ResourceRecord></ResourceRecords></ResourceRecordSet>
+			</ResourceRecordSets></ListResourceRecordSetsResponse>`))
+		default:
+			body, _ := io.ReadAll(r.Body)
+			changes = append(changes, r.URL.Path+" "+string(body))
+			w.Write([]byte(`<ChangeResourceRecordSetsResponse/>`))
+		}
+	}))
+	defer srv.Close()
+
+	r53 := NewRoute53("AKID", "secret", "")
+	r53.baseURL = srv.URL
+	r53.now = func() time.Time { return time.Date(2026, 2, 11, 19, 0, 0, 0, time.UTC) }
+	ctx := context.Background()
+	records, err := r53.Records(ctx, "example.com", "kai.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Content != "203.0.113.7" || records[0].TTL != 60 {
+		t.Fatalf("records = %+v", records)
+	}
+	if err := r53.Delete(ctx, "example.com", records[0]); err != nil {
+		t.Fatal(err)
+	}
+	want := `/2013-04-01/hostedzone/Z1/rrset <ChangeResourceRecordSetsRequest xmlns="https://route53.amazonaws.com/doc/2013-04-01/"><ChangeBatch><Changes><Change><Action>DELETE</Action><ResourceRecordSet><Name>kai.example.com.</Name><Type>A</Type><TTL>60</TTL><ResourceRecords><ResourceRecord><Value>203.0.113.7</Value></ResourceRecord></ResourceRecords></ResourceRecordSet></Change></Changes></ChangeBatch></ChangeResourceRecordSetsRequest>`
+	if len(changes) != 1 || changes[0] != want {
+		t.Errorf("changes = %q", changes)
+	}
+
+	// A batch goes in one request, TXT values quoted.
+	changes = nil
+	err = r53.Apply(ctx, "example.com", []Change{
+		{Action: "delete", Old: Record{Name: "api.example.com", Type: "CNAME", Content: "old-host.example.net", TTL: 300}},
+		{Action: "create", New: Record{Name: "api.example.com", Type: "A", Content: "203.0.113.7", TTL: 300}},
+		{Action: "create", New: Record{Name: "_warren.api.example.com", Type: "TXT", Content: "heritage=warren", TTL: 300}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || strings.Count(changes[0], "<Change>") != 3 || !strings.Contains(changes[0], "<Action>DELETE</Action>") ||
+		!strings.Contains(changes[0], "<Value>&#34;heritage=warren&#34;</Value>") {
+		t.Errorf("changes = %q", changes)
+	}
+
+	r53.accessKey = "WRONG"
+	r53.zones = map[string]string{}
+	if _, err := r53.Records(ctx, "example.com", "kai.example.com"); err == nil || !strings.Contains(err.Error(), "SignatureDoesNotMatch") {
+		t.Errorf("err = %v, want the API's error", err)
+	}
+}
+
+// TestSignV4 checks the signer against vectors from AWS's Signature
+// Version 4 test suite.
+func TestSignV4(t *testing.T) {
+	for name, tc := range map[string]struct{ url, signature string }{
+		"get-vanilla": {
+			"https://example.amazonaws.com/",
+			"5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		"get-vanilla-query-order-key-case": {
+			"https://example.amazonaws.com/?Param2=value2&Param1=value1",
+			"b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+	} {
+		req := httptest.NewRequest(http.MethodGet, tc.url, nil)
+		signV4(req, nil, "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "", "us-east-1", "service",
+			time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+		want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=" + tc.signature
+		if got := req.Header.Get("Authorization"); got != want {
+			t.Errorf("%s: Authorization = %s\nwant %s", name, got, want)
+		}
+	}
+}
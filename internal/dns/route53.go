@@ -0,0 +1,298 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// route53Namespace is the XML namespace of Route 53 API requests.
+const route53Namespace = "https://route53.amazonaws.com/doc/2013-04-01/"
+
+// Route53 manages records in AWS Route 53 hosted zones. Requests are
+// signed with Signature Version 4, so no AWS SDK is needed.
+type Route53 struct {
+	accessKey, secretKey, sessionToken string
+	baseURL                            string
+	client                             *http.Client
+	now                                func() time.Time
+
+	mu    sync.Mutex
+	zones map[string]string // zone name → hosted zone ID
+}
+
+// NewRoute53 creates a Route 53 provider. sessionToken is only needed with
+// temporary credentials.
+func NewRoute53(accessKey, secretKey, sessionToken string) *Route53 {
+	return &Route53{
+		accessKey:    accessKey,
+		secretKey:    secretKey,
+		sessionToken: sessionToken,
+		baseURL:      "https://route53.amazonaws.com",
+		client:       &http.Client{Timeout: 30 * time.Second},
+		now:          time.Now,
+		zones:        make(map[string]string),
+	}
+}
+
+type route53RecordSet struct {
+	Name    string   `xml:"Name"`
+	Type    string   `xml:"Type"`
+	TTL     int      `xml:"TTL,omitempty"`
+	Records []string `xml:"ResourceRecords>ResourceRecord>Value"`
+}
+
+type route53Change struct {
+	Action    string           `xml:"Action"`
+	RecordSet route53RecordSet `xml:"ResourceRecordSet"`
+}
+
+type route53ChangeRequest struct {
+	XMLName xml.Name        `xml:"ChangeResourceRecordSetsRequest"`
+	Xmlns   string          `xml:"xmlns,attr"`
+	Changes []route53Change `xml:"ChangeBatch>Changes>Change"`
+}
+
+// Records returns the A, AAAA, CNAME and TXT record sets at name. A set
+// with several values comes back as one record with the values joined by
+// commas, which never matches a single target. TXT values keep Route 53's
+// quotes.
+func (r *Route53) Records(ctx context.Context, zone, name string) ([]Record, error) {
+	id, err := r.zoneID(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		RecordSets []route53RecordSet `xml:"ResourceRecordSets>ResourceRecordSet"`
+	}
+	query := url.Values{"name": {name + "."}, "maxitems": {"10"}}
+	if err := r.do(ctx, http.MethodGet, "/2013-04-01/hostedzone/"+id+"/rrset", query, nil, &resp); err != nil {
+		return nil, err
+	}
+	var records []Record
+	for _, set := range resp.RecordSets {
+		// Listing starts at name, so later sets are other names.
+		if normalize(unescapeRoute53(set.Name)) != normalize(name) {
+			break
+		}
+		switch set.Type {
+		case "A", "AAAA", "CNAME", "TXT":
+			records = append(records, Record{Name: name, Type: set.Type, Content: strings.Join(set.Records, ","), TTL: set.TTL})
+		}
+	}
+	return records, nil
+}
+
+// Create adds rec.
+func (r *Route53) Create(ctx context.Context, zone string, rec Record) error {
+	return r.Apply(ctx, zone, []Change{{Action: "create", New: rec}})
+}
+
+// Update overwrites old, which has the same name and type, with rec.
+func (r *Route53) Update(ctx context.Context, zone string, old, rec Record) error {
+	return r.Apply(ctx, zone, []Change{{Action: "update", Old: old, New: rec}})
+}
+
+// Delete removes rec, which must match the record set exactly.
+func (r *Route53) Delete(ctx context.Context, zone string, rec Record) error {
+	return r.Apply(ctx, zone, []Change{{Action: "delete", Old: rec}})
+}
+
+// Apply sends changes as one ChangeBatch, which Route 53 applies all or
+// none of.
+func (r *Route53) Apply(ctx context.Context, zone string, changes []Change) error {
+	id, err := r.zoneID(ctx, zone)
+	if err != nil {
+		return err
+	}
+	body := route53ChangeRequest{Xmlns: route53Namespace}
+	for _, c := range changes {
+		action, rec := "UPSERT", c.New
+		switch c.Action {
+		case "create":
+			action = "CREATE"
+		case "delete":
+			action, rec = "DELETE", c.Old
+		}
+		values := strings.Split(rec.Content, ",")
+		if rec.Type == "TXT" {
+			for i, v := range values {
+				if !strings.HasPrefix(v, `"`) {
+					values[i] = strconv.Quote(v)
+				}
+			}
+		}
+		body.Changes = append(body.Changes, route53Change{
+			Action: action,
+			RecordSet: route53RecordSet{
+				Name:    rec.Name + ".",
+				Type:    rec.Type,
+				TTL:     rec.TTL,
+				Records: values,
+			},
+		})
+	}
+	return r.do(ctx, http.MethodPost, "/2013-04-01/hostedzone/"+id+"/rrset", nil, body, nil)
+}
+
+// zoneID looks up a public hosted zone's ID by name, once.
+func (r *Route53) zoneID(ctx context.Context, zone string) (string, error) {
+	r.mu.Lock()
+	id, ok := r.zones[zone]
+	r.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+	var resp struct {
+		Zones []struct {
+			ID      string `xml:"Id"`
+			Name    string `xml:"Name"`
+			Private bool   `xml:"Config>PrivateZone"`
+		} `xml:"HostedZones>HostedZone"`
+	}
+	query := url.Values{"dnsname": {zone}, "maxitems": {"10"}}
+	if err := r.do(ctx, http.MethodGet, "/2013-04-01/hostedzonesbyname", query, nil, &resp); err != nil {
+		return "", err
+	}
+	for _, z := range resp.Zones {
+		if normalize(z.Name) == zone && !z.Private {
+			id = strings.TrimPrefix(z.ID, "/hostedzone/")
+			r.mu.Lock()
+			r.zones[zone] = id
+			r.mu.Unlock()
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("route53: public hosted zone %s not found", zone)
+}
+
+// do calls the API, signing the request, and decodes the XML response into
+// out.
+func (r *Route53) do(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = xml.Marshal(body); err != nil {
+			return err
+		}
+	}
+	u := r.baseURL + path
+	if len(query) > 0 {
+		u += "?" + canonicalQuery(query)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/xml")
+	}
+	r.sign(req, data)
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("route53: %w", err)
+	}
+	defer resp.Body.Close()
+	respData, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("route53: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Code    string `xml:"Error>Code"`
+			Message string `xml:"Error>Message"`
+		}
+		if xml.Unmarshal(respData, &apiErr) == nil && apiErr.Code != "" {
+			return fmt.Errorf("route53: %s %s: %s: %s", method, path, apiErr.Code, apiErr.Message)
+		}
+		return fmt.Errorf("route53: %s %s: HTTP %d", method, path, resp.StatusCode)
+	}
+	if out != nil {
+		return xml.Unmarshal(respData, out)
+	}
+	return nil
+}
+
+// sign adds a Signature Version 4 Authorization header for Route 53, which
+// is global and signed for us-east-1.
+func (r *Route53) sign(req *http.Request, body []byte) {
+	signV4(req, body, r.accessKey, r.secretKey, r.sessionToken, "us-east-1", "route53", r.now())
+}
+
+// signV4 signs req with AWS Signature Version 4, covering the host and
+// X-Amz-Date headers, and the session token if there is one.
+func signV4(req *http.Request, body []byte, accessKey, secretKey, sessionToken, region, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host, "x-amz-date": amzDate}
+	if sessionToken != "" {
+		headers["x-amz-security-token"] = sessionToken
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	bodyHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	for _, part := range []string{region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// canonicalQuery encodes a query the way SigV4 expects: sorted, with
+// spaces as %20 rather than +.
+func canonicalQuery(query url.Values) string {
+	return strings.ReplaceAll(query.Encode(), "+", "%20")
+}
+
+// unescapeRoute53 undoes Route 53's octal escaping of names, such as
+// "\052" for the "*" of a wildcard.
+func unescapeRoute53(name string) string {
+	return strings.ReplaceAll(name, `\052`, "*")
+}
@@ -0,0 +1,215 @@
+// Package dnscheck warns when agent hostnames don't resolve to Warren: the
+// classic "added an agent, forgot the DNS record" mistake, which otherwise
+// only shows up as users reporting the agent unreachable.
+package dnscheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"warren/internal/events"
+)
+
+// DefaultInterval is how often hostnames are resolved unless configured
+// otherwise.
+const DefaultInterval = 10 * time.Minute
+
+// Resolver looks up a hostname's addresses. *net.Resolver satisfies it.
+type Resolver interface {
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
+// Mismatch is a hostname that doesn't resolve to Warren.
+type Mismatch struct {
+	Hostname string   `json:"hostname"`
+	Agent    string   `json:"agent"`
+	Resolved []string `json:"resolved,omitempty"` // empty when the name doesn't resolve at all
+}
+
+// Checker periodically resolves every routed hostname and compares the
+// answers against Warren's public addresses.
+type Checker struct {
+	expected  []netip.Prefix
+	hostnames func() map[string]string // hostname → agent, read every round
+	resolver  Resolver
+	emitter   *events.Emitter
+	logger    *slog.Logger
+
+	mu         sync.Mutex
+	mismatched map[string]Mismatch // by hostname
+}
+
+// New creates a checker expecting hostnames to resolve into expected.
+// hostnames is called at the start of each round, so agents added or
+// removed since are picked up.
+func New(expected []netip.Prefix, hostnames func() map[string]string, emitter *events.Emitter, logger *slog.Logger) *Checker {
+	return &Checker{
+		expected:   expected,
+		hostnames:  hostnames,
+		resolver:   net.DefaultResolver,
+		emitter:    emitter,
+		logger:     logger.With("component", "dnscheck"),
+		mismatched: make(map[string]Mismatch),
+	}
+}
+
+// SetResolver replaces the system resolver, e.g. with a fake in tests.
+func (c *Checker) SetResolver(r Resolver) {
+	c.resolver = r
+}
+
+// ParsePrefixes parses addresses and CIDRs, e.g. "203.0.113.7" or
+// Cloudflare's "104.16.0.0/13". A bare address is a single-host prefix.
+func ParsePrefixes(list []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(list))
+	for _, s := range list {
+		if strings.Contains(s, "/") {
+			p, err := netip.ParsePrefix(s)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, p.Masked())
+			continue
+		}
+		a, err := netip.ParseAddr(s)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(a, a.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// Run checks immediately and then every interval until ctx is cancelled.
+func (c *Checker) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		c.Check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check resolves every hostname once. A hostname that newly fails to
+// resolve to Warren emits hostname.dns_mismatch; one that's fixed is
+// logged and cleared. Lookups that fail for reasons other than the name
+// not existing, such as timeouts, leave the hostname's state unchanged.
+func (c *Checker) Check(ctx context.Context) {
+	hostnames := c.hostnames()
+	for hostname, agent := range hostnames {
+		addrs, err := c.resolver.LookupNetIP(ctx, "ip", hostname)
+		var dnsErr *net.DNSError
+		if err != nil && !(errors.As(err, &dnsErr) && dnsErr.IsNotFound) {
+			c.logger.Debug("dns lookup failed", "hostname", hostname, "error", err)
+			continue
+		}
+		if c.matches(addrs) {
+			c.clear(hostname)
+			continue
+		}
+		m := Mismatch{Hostname: hostname, Agent: agent}
+		for _, a := range addrs {
+			m.Resolved = append(m.Resolved, a.Unmap().String())
+		}
+		c.flag(m)
+	}
+
+	// Forget hostnames no longer routed.
+	c.mu.Lock()
+	for hostname := range c.mismatched {
+		if _, ok := hostnames[hostname]; !ok {
+			delete(c.mismatched, hostname)
+		}
+	}
+	c.mu.Unlock()
+}
+
+// matches reports whether any resolved address is one of Warren's. Any one
+// is enough: round-robin records may mix in other hosts.
+func (c *Checker) matches(addrs []netip.Addr) bool {
+	for _, a := range addrs {
+		a = a.Unmap()
+		for _, p := range c.expected {
+			if p.Contains(a) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *Checker) flag(m Mismatch) {
+	c.mu.Lock()
+	_, known := c.mismatched[m.Hostname]
+	c.mismatched[m.Hostname] = m
+	c.mu.Unlock()
+	if known {
+		return
+	}
+	resolved := strings.Join(m.Resolved, ",")
+	if resolved == "" {
+		resolved = "none"
+	}
+	c.logger.Warn("hostname does not resolve to warren", "hostname", m.Hostname, "agent", m.Agent, "resolved", resolved)
+	c.emitter.Emit(events.Event{
+		Type:  events.HostnameDNSMismatch,
+		Agent: m.Agent,
+		Fields: map[string]string{
+			"hostname": m.Hostname,
+			"resolved": resolved,
+			"reason":   fmt.Sprintf("%s resolves to %s, not to Warren", m.Hostname, resolved),
+		},
+	})
+}
+
+func (c *Checker) clear(hostname string) {
+	c.mu.Lock()
+	_, was := c.mismatched[hostname]
+	delete(c.mismatched, hostname)
+	c.mu.Unlock()
+	if was {
+		c.logger.Info("hostname now resolves to warren", "hostname", hostname)
+	}
+}
+
+// Mismatches returns the agent's hostnames that don't resolve to Warren,
+// sorted.
+func (c *Checker) Mismatches(agent string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var names []string
+	for hostname, m := range c.mismatched {
+		if m.Agent == agent {
+			names = append(names, hostname)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// All returns every current mismatch, sorted by hostname.
+func (c *Checker) All() []Mismatch {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	all := make([]Mismatch, 0, len(c.mismatched))
+	for _, m := range c.mismatched {
+		all = append(all, m)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Hostname < all[j].Hostname })
+	return all
+}
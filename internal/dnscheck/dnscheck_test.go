@@ -0,0 +1,157 @@
+package dnscheck
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/netip"
+	"sync"
+	"testing"
+
+	"warren/internal/events"
+)
+
+type fakeResolver struct {
+	mu      sync.Mutex
+	answers map[string][]netip.Addr
+	errs    map[string]error
+}
+
+func (f *fakeResolver) LookupNetIP(_ context.Context, _, host string) ([]netip.Addr, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.errs[host]; err != nil {
+		return nil, err
+	}
+	return f.answers[host], nil
+}
+
+func (f *fakeResolver) set(host string, addrs ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.errs, host)
+	f.answers[host] = nil
+	for _, a := range addrs {
+		f.answers[host] = append(f.answers[host], netip.MustParseAddr(a))
+	}
+}
+
+func (f *fakeResolver) fail(host string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.errs[host] = err
+}
+
+func newChecker(t *testing.T, public []string, hostnames map[string]string) (*Checker, *fakeResolver, *[]events.Event) {
+	t.Helper()
+	prefixes, err := ParsePrefixes(public)
+	if err != nil {
+		t.Fatalf("ParsePrefixes: %v", err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	emitter := events.NewEmitter(logger)
+	var got []events.Event
+	emitter.OnEvent(func(ev events.Event) { got = append(got, ev) })
+
+	c := New(prefixes, func() map[string]string { return hostnames }, emitter, logger)
+	r := &fakeResolver{answers: map[string][]netip.Addr{}, errs: map[string]error{}}
+	c.SetResolver(r)
+	return c, r, &got
+}
+
+func TestCheck_MatchesAddressAndCIDR(t *testing.T) {
+	c, r, got := newChecker(t, []string{"203.0.113.7", "104.16.0.0/13"}, map[string]string{
+		"a.example.com": "a",
+		"b.example.com": "b",
+	})
+	r.set("a.example.com", "203.0.113.7")
+	r.set("b.example.com", "198.51.100.1", "104.17.2.3") // any one match is enough
+
+	c.Check(context.Background())
+	if all := c.All(); len(all) != 0 {
+		t.Errorf("All() = %v, want none", all)
+	}
+	if len(*got) != 0 {
+		t.Errorf("emitted %d events, want none", len(*got))
+	}
+}
+
+func TestCheck_FlagsOnceAndClears(t *testing.T) {
+	c, r, got := newChecker(t, []string{"203.0.113.7"}, map[string]string{"a.example.com": "a"})
+	r.set("a.example.com", "198.51.100.1")
+
+	c.Check(context.Background())
+	c.Check(context.Background())
+	if len(*got) != 1 {
+		t.Fatalf("emitted %d events, want 1", len(*got))
+	}
+	ev := (*got)[0]
+	if ev.Type != events.HostnameDNSMismatch || ev.Agent != "a" {
+		t.Errorf("event = %s/%s, want %s/a", ev.Type, ev.Agent, events.HostnameDNSMismatch)
+	}
+	if ev.Fields["hostname"] != "a.example.com" || ev.Fields["resolved"] != "198.51.100.1" {
+		t.Errorf("fields = %v", ev.Fields)
+	}
+	if m := c.Mismatches("a"); len(m) != 1 || m[0] != "a.example.com" {
+		t.Errorf("Mismatches(a) = %v, want [a.example.com]", m)
+	}
+
+	r.set("a.example.com", "203.0.113.7")
+	c.Check(context.Background())
+	if m := c.Mismatches("a"); len(m) != 0 {
+		t.Errorf("Mismatches(a) after fix = %v, want none", m)
+	}
+}
+
+func TestCheck_NXDOMAIN(t *testing.T) {
+	c, r, got := newChecker(t, []string{"203.0.113.7"}, map[string]string{"a.example.com": "a"})
+	r.fail("a.example.com", &net.DNSError{Err: "no such host", Name: "a.example.com", IsNotFound: true})
+
+	c.Check(context.Background())
+	if len(*got) != 1 || (*got)[0].Fields["resolved"] != "none" {
+		t.Fatalf("events = %v, want one with resolved=none", *got)
+	}
+}
+
+func TestCheck_IgnoresTransientErrors(t *testing.T) {
+	c, r, got := newChecker(t, []string{"203.0.113.7"}, map[string]string{"a.example.com": "a"})
+	r.fail("a.example.com", &net.DNSError{Err: "i/o timeout", IsTimeout: true})
+	c.Check(context.Background())
+	r.fail("a.example.com", errors.New("network unreachable"))
+	c.Check(context.Background())
+
+	if len(*got) != 0 || len(c.All()) != 0 {
+		t.Errorf("transient errors flagged a mismatch: events=%v all=%v", *got, c.All())
+	}
+}
+
+func TestCheck_ForgetsRemovedHostnames(t *testing.T) {
+	hostnames := map[string]string{"a.example.com": "a"}
+	c, r, _ := newChecker(t, []string{"203.0.113.7"}, hostnames)
+	r.set("a.example.com", "198.51.100.1")
+	c.Check(context.Background())
+
+	delete(hostnames, "a.example.com")
+	c.Check(context.Background())
+	if all := c.All(); len(all) != 0 {
+		t.Errorf("All() = %v, want none after the hostname was removed", all)
+	}
+}
+
+func TestParsePrefixes(t *testing.T) {
+	got, err := ParsePrefixes([]string{"203.0.113.7", "104.16.1.0/13", "2001:db8::1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"203.0.113.7/32", "104.16.0.0/13", "2001:db8::1/128"}
+	for i, p := range got {
+		if p.String() != want[i] {
+			t.Errorf("prefix %d = %s, want %s", i, p, want[i])
+		}
+	}
+	if _, err := ParsePrefixes([]string{"not-an-ip"}); err == nil {
+		t.Error("expected error for invalid address")
+	}
+}
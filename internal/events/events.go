@@ -1,8 +1,12 @@
 package events
 
 import (
+	"context"
 	"log/slog"
+	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -17,8 +21,33 @@ const (
 	RestartExhausted  = "restart.exhausted"
 	AgentAdded        = "agent.added"
 	AgentRemoved      = "agent.removed"
+	AgentRecycled     = "agent.recycled"
+	AgentCrashLoop    = "agent.crashloop"
+	AgentRemediating  = "agent.remediating"
+	AgentRecovered    = "agent.recovered"
+	AgentWakeBudget   = "agent.wake_budget_exceeded" // an on-demand agent used up wake.budget.max_per_day
+	AgentSLABreach    = "agent.sla_breach"           // availability over sla.window fell below sla.target
+	CircuitOpen       = "circuit.open"               // backend error rate crossed its threshold
+	CircuitClosed     = "circuit.closed"             // a half-open probe succeeded
+
+	HostnameDNSMismatch = "hostname.dns_mismatch" // a routed hostname doesn't resolve to Warren's public IPs
+	DNSRecordChanged    = "dns.record_changed"    // Warren created, updated or deleted a DNS record, or would have with dns.dry_run
+)
+
+// Security event types. They share the "security." prefix so webhooks and
+// the event stream can select them as a group; see IsSecurity.
+const (
+	SecurityAuthFailed    = "security.auth_failed"    // a request to the admin API had a missing or wrong token
+	SecurityRateLimited   = "security.rate_limited"   // a client hit a request or connection limit
+	SecurityTargetBlocked = "security.target_blocked" // a service registration pointed at a forbidden target (SSRF)
+	SecurityBanned        = "security.ip_banned"      // a client address was banned after repeated failures
 )
 
+// IsSecurity reports whether typ is one of the security event types.
+func IsSecurity(typ string) bool {
+	return strings.HasPrefix(typ, "security.")
+}
+
 // Event represents a lifecycle event for an agent.
 type Event struct {
 	Type      string            `json:"type"`
@@ -27,11 +56,29 @@ type Event struct {
 	Fields    map[string]string `json:"fields,omitempty"`
 }
 
+// QueueSize is how many events can wait for dispatch once Start has been
+// called. Events emitted while the queue is full are dropped and counted.
+const QueueSize = 4096
+
 // Emitter logs events and dispatches them to registered handlers.
 type Emitter struct {
-	logger   *slog.Logger
-	mu       sync.RWMutex
-	handlers []func(Event)
+	logger    *slog.Logger
+	mu        sync.RWMutex
+	handlers  []func(Event)
+	enrichers []func(*Event)
+
+	// Set by Start: Emit queues to the ring and a dispatch goroutine does
+	// the enriching, logging and fan-out, so callers on the request path
+	// never wait on a handler.
+	queue      *ring
+	queueSize  int
+	async      atomic.Bool
+	pushing    atomic.Int64 // Emits between checking async and pushing
+	wake       chan struct{}
+	queued     atomic.Uint64
+	dispatched atomic.Uint64
+	dropped    atomic.Uint64
+	lastDrop   atomic.Int64 // unix nanoseconds of the latest drop
 }
 
 // NewEmitter creates a new event emitter.
@@ -41,11 +88,133 @@ func NewEmitter(logger *slog.Logger) *Emitter {
 	}
 }
 
-// Emit logs the event and calls all registered handlers.
+// SetQueueSize sets how many events Start's queue holds before Emit starts
+// dropping them; 0 means QueueSize. Call it before Start.
+func (e *Emitter) SetQueueSize(n int) {
+	e.queueSize = n
+}
+
+// Start moves dispatch onto a dedicated goroutine until ctx is cancelled:
+// Emit then only queues the event and returns. Before Start, and again after
+// ctx is cancelled, Emit dispatches synchronously.
+func (e *Emitter) Start(ctx context.Context) {
+	size := e.queueSize
+	if size <= 0 {
+		size = QueueSize
+	}
+	e.queue = newRing(size)
+	e.wake = make(chan struct{}, 1)
+	e.async.Store(true)
+	go e.run(ctx)
+}
+
+// Emit logs the event and calls all registered handlers, or queues it for
+// the dispatch goroutine once Start has been called.
 func (e *Emitter) Emit(ev Event) {
 	if ev.Timestamp.IsZero() {
 		ev.Timestamp = time.Now()
 	}
+	e.pushing.Add(1)
+	if !e.async.Load() {
+		e.pushing.Add(-1)
+		e.dispatch(ev)
+		return
+	}
+	ok := e.queue.push(ev)
+	e.pushing.Add(-1)
+	if !ok {
+		e.dropped.Add(1)
+		e.lastDrop.Store(time.Now().UnixNano())
+		return
+	}
+	e.queued.Add(1)
+	select {
+	case e.wake <- struct{}{}:
+	default: // the dispatcher already has a wake-up pending
+	}
+}
+
+// Dropped returns how many events were discarded because the queue was full.
+func (e *Emitter) Dropped() uint64 {
+	return e.dropped.Load()
+}
+
+// LastDropped returns when an event was last discarded, or the zero time if
+// none has been.
+func (e *Emitter) LastDropped() time.Time {
+	ns := e.lastDrop.Load()
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
+
+// Flush waits until every event queued so far has been dispatched, or ctx
+// is done. It returns immediately for a synchronous emitter. Called after
+// Start's ctx is cancelled, it waits for the queue to be drained.
+func (e *Emitter) Flush(ctx context.Context) error {
+	target := e.queued.Load()
+	for e.dispatched.Load() < target {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Millisecond):
+		}
+	}
+	return nil
+}
+
+func (e *Emitter) run(ctx context.Context) {
+	var reported uint64
+	for {
+		e.drain()
+		if d := e.dropped.Load(); d != reported {
+			e.logger.Warn("event queue full, events dropped", "dropped", d-reported)
+			reported = d
+		}
+		select {
+		case <-e.wake:
+		case <-ctx.Done():
+			// Events emitted during shutdown are dispatched inline again.
+			// Wait out Emits that saw the queue still open, then deliver
+			// everything that made it in.
+			e.async.Store(false)
+			for e.pushing.Load() > 0 {
+				runtime.Gosched()
+			}
+			e.drain()
+			return
+		}
+	}
+}
+
+func (e *Emitter) drain() {
+	for {
+		ev, ok := e.queue.pop()
+		if !ok {
+			return
+		}
+		e.dispatch(ev)
+		e.dispatched.Add(1)
+	}
+}
+
+// dispatch enriches, logs and fans out one event.
+func (e *Emitter) dispatch(ev Event) {
+	e.mu.RLock()
+	enrichers := e.enrichers
+	e.mu.RUnlock()
+	if len(enrichers) > 0 {
+		// Copy so enrichers don't write into the caller's map.
+		fields := make(map[string]string, len(ev.Fields))
+		for k, v := range ev.Fields {
+			fields[k] = v
+		}
+		ev.Fields = fields
+		for _, fn := range enrichers {
+			fn(&ev)
+		}
+	}
 
 	attrs := []any{
 		"event", ev.Type,
@@ -54,7 +223,11 @@ func (e *Emitter) Emit(ev Event) {
 	for k, v := range ev.Fields {
 		attrs = append(attrs, k, v)
 	}
-	e.logger.Info("event emitted", attrs...)
+	if IsSecurity(ev.Type) {
+		e.logger.Warn("security event", attrs...)
+	} else {
+		e.logger.Info("event emitted", attrs...)
+	}
 
 	e.mu.RLock()
 	handlers := e.handlers
@@ -76,6 +249,15 @@ func (e *Emitter) OnEvent(fn func(Event)) int {
 	return len(e.handlers) - 1
 }
 
+// AddEnricher registers a function that can add fields to every event
+// before it is logged and dispatched. Enrichers should not overwrite fields
+// the emitter of the event already set.
+func (e *Emitter) AddEnricher(fn func(*Event)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.enrichers = append(e.enrichers, fn)
+}
+
 // RemoveHandler removes a handler by its ID.
 func (e *Emitter) RemoveHandler(id int) {
 	e.mu.Lock()
@@ -1,9 +1,13 @@
 package events
 
 import (
+	"context"
 	"log/slog"
 	"os"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func testEmitter() *Emitter {
@@ -41,3 +45,295 @@ func TestEmitNoHandlersNoPanic(t *testing.T) {
 	e := testEmitter()
 	e.Emit(Event{Type: "test"}) // should not panic
 }
+
+func TestEnricherAddsFields(t *testing.T) {
+	e := testEmitter()
+	e.AddEnricher(func(ev *Event) {
+		if ev.Agent == "myagent" {
+			ev.Fields["container_id"] = "abc"
+		}
+	})
+	var got Event
+	e.OnEvent(func(ev Event) { got = ev })
+
+	orig := map[string]string{"k": "v"}
+	e.Emit(Event{Type: AgentReady, Agent: "myagent", Fields: orig})
+	if got.Fields["k"] != "v" || got.Fields["container_id"] != "abc" {
+		t.Errorf("fields = %v", got.Fields)
+	}
+	if _, ok := orig["container_id"]; ok {
+		t.Error("enricher modified the caller's fields map")
+	}
+
+	e.Emit(Event{Type: AgentReady, Agent: "other"})
+	if _, ok := got.Fields["container_id"]; ok {
+		t.Errorf("unexpected container_id for other agent: %v", got.Fields)
+	}
+}
+
+func TestStartDispatchesAsyncInOrder(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	e := testEmitter()
+	var mu sync.Mutex
+	var got []string
+	e.OnEvent(func(ev Event) {
+		mu.Lock()
+		got = append(got, ev.Agent)
+		mu.Unlock()
+	})
+	e.Start(ctx)
+
+	want := []string{"a", "b", "c", "d"}
+	for _, name := range want {
+		e.Emit(Event{Type: AgentReady, Agent: name})
+	}
+	flushCtx, done := context.WithTimeout(ctx, 2*time.Second)
+	defer done()
+	if err := e.Flush(flushCtx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestEmitDoesNotWaitForHandlers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	e := testEmitter()
+	release := make(chan struct{})
+	e.OnEvent(func(Event) { <-release })
+	e.Start(ctx)
+	defer close(release)
+
+	returned := make(chan struct{})
+	go func() {
+		e.Emit(Event{Type: AgentReady, Agent: "a"})
+		e.Emit(Event{Type: AgentReady, Agent: "b"})
+		close(returned)
+	}()
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("Emit blocked on a slow handler")
+	}
+}
+
+func TestEmitDropsWhenQueueFull(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	e := testEmitter()
+	release := make(chan struct{})
+	e.OnEvent(func(Event) { <-release })
+	e.Start(ctx)
+
+	// One event is held by the blocked handler, QueueSize more fill the ring.
+	for i := 0; i < QueueSize+10; i++ {
+		e.Emit(Event{Type: AgentReady})
+	}
+	close(release)
+	if e.Dropped() == 0 {
+		t.Fatal("expected events to be dropped once the queue was full")
+	}
+	if time.Since(e.LastDropped()) > time.Minute {
+		t.Errorf("LastDropped() = %v, want just now", e.LastDropped())
+	}
+}
+
+func TestLastDroppedBeforeAnyDrop(t *testing.T) {
+	if at := testEmitter().LastDropped(); !at.IsZero() {
+		t.Errorf("LastDropped() = %v, want zero", at)
+	}
+}
+
+func TestSetQueueSize(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	e := testEmitter()
+	e.SetQueueSize(8)
+	release := make(chan struct{})
+	e.OnEvent(func(Event) { <-release })
+	e.Start(ctx)
+
+	for i := 0; i < 20; i++ {
+		e.Emit(Event{Type: AgentReady})
+	}
+	close(release)
+	// At most 8 queued and 1 held by the handler.
+	if got := e.Dropped(); got < 11 {
+		t.Fatalf("dropped = %d, want at least 11 with a queue of 8", got)
+	}
+}
+
+func TestEmitAfterCancelIsSynchronous(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	e := testEmitter()
+	var calls int
+	e.OnEvent(func(Event) { calls++ })
+	e.Start(ctx)
+	cancel()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for e.async.Load() {
+		if time.Now().After(deadline) {
+			t.Fatal("dispatcher did not stop")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	e.Emit(Event{Type: AgentReady})
+	if calls != 1 {
+		t.Fatalf("calls = %d, want 1", calls)
+	}
+}
+
+func TestRingWrapsAround(t *testing.T) {
+	r := newRing(4)
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 4; i++ {
+			if !r.push(Event{Agent: string(rune('a' + i))}) {
+				t.Fatalf("round %d: push %d failed", round, i)
+			}
+		}
+		if r.push(Event{}) {
+			t.Fatal("push into a full ring succeeded")
+		}
+		for i := 0; i < 4; i++ {
+			ev, ok := r.pop()
+			if !ok || ev.Agent != string(rune('a'+i)) {
+				t.Fatalf("round %d: pop %d = %q, %v", round, i, ev.Agent, ok)
+			}
+		}
+		if _, ok := r.pop(); ok {
+			t.Fatal("pop from an empty ring succeeded")
+		}
+	}
+}
+
+// slowHandler stands in for a webhook or Hermes publish.
+func slowHandler(Event) { time.Sleep(10 * time.Microsecond) }
+
+func BenchmarkEmitSync(b *testing.B) {
+	e := testEmitter()
+	e.OnEvent(slowHandler)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			e.Emit(Event{Type: AgentReady, Agent: "bench"})
+		}
+	})
+}
+
+// BenchmarkEmit measures Emit with a consumer attached and keeping up: the
+// queue is flushed, off the clock, before it can fill, so every event is
+// queued and dispatched rather than taking the drop path.
+func BenchmarkEmit(b *testing.B) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	e := testEmitter()
+	var consumed atomic.Int64
+	e.OnEvent(func(Event) { consumed.Add(1) })
+	e.Start(ctx)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if i%(QueueSize/2) == 0 {
+			b.StopTimer()
+			_ = e.Flush(ctx)
+			b.StartTimer()
+		}
+		e.Emit(Event{Type: AgentReady, Agent: "bench"})
+	}
+	b.StopTimer()
+	_ = e.Flush(ctx)
+	if e.Dropped() > 0 || consumed.Load() != int64(b.N) {
+		b.Fatalf("consumed %d of %d, dropped %d", consumed.Load(), b.N, e.Dropped())
+	}
+}
+
+// BenchmarkEmitSlowConsumer is BenchmarkEmit with a handler slower than
+// the producers, where most events take the drop path.
+func BenchmarkEmitSlowConsumer(b *testing.B) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	e := testEmitter()
+	e.OnEvent(slowHandler)
+	e.Start(ctx)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			e.Emit(Event{Type: AgentReady, Agent: "bench"})
+		}
+	})
+	b.ReportMetric(float64(e.Dropped())/float64(b.N), "dropped/op")
+}
+
+func TestShutdownDeliversQueuedEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	e := testEmitter()
+	var delivered atomic.Int64
+	release := make(chan struct{})
+	e.OnEvent(func(Event) {
+		<-release
+		delivered.Add(1)
+	})
+	e.Start(ctx)
+
+	// Emit from many goroutines while the dispatcher shuts down.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				e.Emit(Event{Type: AgentReady})
+			}
+		}()
+	}
+	cancel()
+	close(release)
+	wg.Wait()
+
+	flushCtx, flushCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer flushCancel()
+	if err := e.Flush(flushCtx); err != nil {
+		t.Fatalf("flush after shutdown: %v", err)
+	}
+	if got := delivered.Load() + int64(e.Dropped()); got != 800 {
+		t.Fatalf("delivered %d + dropped %d, want all 800 accounted for", delivered.Load(), e.Dropped())
+	}
+}
+
+func TestThrottleCountsSuppressed(t *testing.T) {
+	th := NewThrottle(50 * time.Millisecond)
+	if ok, _ := th.Allow("1.2.3.4"); !ok {
+		t.Fatal("first event throttled")
+	}
+	for i := 0; i < 3; i++ {
+		if ok, _ := th.Allow("1.2.3.4"); ok {
+			t.Fatal("repeat within the window let through")
+		}
+	}
+	if ok, _ := th.Allow("5.6.7.8"); !ok {
+		t.Error("other key throttled")
+	}
+	time.Sleep(60 * time.Millisecond)
+	ok, suppressed := th.Allow("1.2.3.4")
+	if !ok || suppressed != 3 {
+		t.Errorf("after window: ok=%v suppressed=%d, want true 3", ok, suppressed)
+	}
+}
+
+func TestIsSecurity(t *testing.T) {
+	if !IsSecurity(SecurityAuthFailed) || IsSecurity(AgentReady) {
+		t.Error("IsSecurity misclassifies event types")
+	}
+}
@@ -0,0 +1,138 @@
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// HistorySize is how many recent events a History keeps for clients that
+// reconnect.
+const HistorySize = 1024
+
+// Entry is an event with its position in a History. IDs start at 1 and
+// increase by one per event; EventID qualifies them for clients.
+type Entry struct {
+	ID    uint64
+	Event Event
+}
+
+// History keeps the most recent events with sequence numbers, so a client
+// whose event stream drops can resume from the last ID it saw instead of
+// missing what happened while it reconnected.
+type History struct {
+	mu       sync.Mutex
+	boot     string // distinguishes this History's IDs from a previous run's
+	max      int
+	entries  []Entry
+	next     uint64
+	watchers map[int]func(Entry)
+	nextW    int
+}
+
+// NewHistory returns a History keeping the last max events; 0 means
+// HistorySize.
+func NewHistory(max int) *History {
+	if max <= 0 {
+		max = HistorySize
+	}
+	b := make([]byte, 4)
+	rand.Read(b)
+	return &History{boot: hex.EncodeToString(b), max: max, next: 1, watchers: make(map[int]func(Entry))}
+}
+
+// EventID returns e's ID as clients see it, prefixed with the History's
+// boot ID so one from before a restart can't pass for a current one.
+func (h *History) EventID(e Entry) string {
+	return h.boot + "-" + strconv.FormatUint(e.ID, 10)
+}
+
+// After returns the entry ID in id, an EventID, or 0 if this History didn't
+// issue it.
+func (h *History) After(id string) uint64 {
+	boot, seq, ok := strings.Cut(id, "-")
+	if !ok || boot != h.boot {
+		return 0
+	}
+	n, _ := strconv.ParseUint(seq, 10, 64)
+	return n
+}
+
+// Add records ev and passes it on to followers. Register it with
+// Emitter.OnEvent.
+func (h *History) Add(ev Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	e := Entry{ID: h.next, Event: ev}
+	h.next++
+	h.entries = append(h.entries, e)
+	if len(h.entries) > h.max {
+		h.entries = h.entries[len(h.entries)-h.max:]
+	}
+	for _, fn := range h.watchers {
+		fn(e)
+	}
+}
+
+// Follow returns the kept events after the one with ID after and calls fn
+// for every later event until stop is called, with nothing missed or
+// repeated in between. fn must not block. An after of 0, or one this
+// History never issued, returns no backlog.
+func (h *History) Follow(after uint64, fn func(Entry)) (backlog []Entry, stop func()) {
+	return h.follow(after, false, fn)
+}
+
+// Replay is Follow with every kept event as the backlog.
+func (h *History) Replay(fn func(Entry)) (backlog []Entry, stop func()) {
+	return h.follow(0, true, fn)
+}
+
+func (h *History) follow(after uint64, all bool, fn func(Entry)) (backlog []Entry, stop func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if all {
+		backlog = append(backlog, h.entries...)
+	} else if after > 0 && after < h.next {
+		for _, e := range h.entries {
+			if e.ID > after {
+				backlog = append(backlog, e)
+			}
+		}
+	}
+	id := h.nextW
+	h.nextW++
+	h.watchers[id] = fn
+	return backlog, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.watchers, id)
+	}
+}
+
+// Events returns the kept events, oldest first.
+func (h *History) Events() []Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	evs := make([]Event, len(h.entries))
+	for i, e := range h.entries {
+		evs[i] = e.Event
+	}
+	return evs
+}
+
+// Import adds events from a backup, oldest first, without passing them to
+// followers: they already happened elsewhere. They take the next IDs, so
+// they follow whatever this History already holds.
+func (h *History) Import(evs []Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, ev := range evs {
+		h.entries = append(h.entries, Entry{ID: h.next, Event: ev})
+		h.next++
+	}
+	if len(h.entries) > h.max {
+		h.entries = h.entries[len(h.entries)-h.max:]
+	}
+}
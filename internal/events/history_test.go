@@ -0,0 +1,100 @@
+package events
+
+import "testing"
+
+func TestHistoryFollowResumes(t *testing.T) {
+	h := NewHistory(3)
+	for _, agent := range []string{"a", "b", "c", "d"} {
+		h.Add(Event{Type: AgentWake, Agent: agent})
+	}
+
+	// Only the last three are kept; resuming from 2 replays 3 and 4.
+	backlog, stop := h.Follow(2, func(Entry) {})
+	stop()
+	if len(backlog) != 2 || backlog[0].ID != 3 || backlog[1].Event.Agent != "d" {
+		t.Errorf("backlog = %+v, want events 3 and 4", backlog)
+	}
+
+	backlog, stop = h.Follow(0, func(Entry) {})
+	stop()
+	if len(backlog) != 0 {
+		t.Errorf("expected no backlog for a new client, got %+v", backlog)
+	}
+	backlog, stop = h.Follow(99, func(Entry) {})
+	stop()
+	if len(backlog) != 0 {
+		t.Errorf("expected no backlog for an ID from a previous run, got %+v", backlog)
+	}
+}
+
+func TestHistoryFollowSeesLaterEvents(t *testing.T) {
+	h := NewHistory(0)
+	h.Add(Event{Type: AgentWake, Agent: "a"})
+
+	var got []Entry
+	_, stop := h.Follow(1, func(e Entry) { got = append(got, e) })
+	h.Add(Event{Type: AgentReady, Agent: "a"})
+	stop()
+	h.Add(Event{Type: AgentSleep, Agent: "a"})
+
+	if len(got) != 1 || got[0].ID != 2 || got[0].Event.Type != AgentReady {
+		t.Errorf("followed %+v, want only the event before stop", got)
+	}
+}
+
+func TestHistoryImport(t *testing.T) {
+	h := NewHistory(3)
+	h.Add(Event{Type: AgentWake, Agent: "local"})
+
+	var followed int
+	_, stop := h.Follow(0, func(Entry) { followed++ })
+	h.Import([]Event{{Type: AgentSleep, Agent: "a"}, {Type: AgentWake, Agent: "b"}, {Type: AgentReady, Agent: "c"}})
+	stop()
+	if followed != 0 {
+		t.Errorf("followers saw %d imported events, want none", followed)
+	}
+
+	evs := h.Events()
+	if len(evs) != 3 || evs[0].Agent != "a" || evs[2].Agent != "c" {
+		t.Errorf("Events() = %+v, want the last three, oldest first", evs)
+	}
+	h.Add(Event{Type: AgentSleep, Agent: "d"})
+	backlog, stop := h.Follow(4, func(Entry) {})
+	stop()
+	if len(backlog) != 1 || backlog[0].ID != 5 {
+		t.Errorf("backlog = %+v, want the event added after the import", backlog)
+	}
+}
+
+func TestHistoryReplay(t *testing.T) {
+	h := NewHistory(2)
+	for _, typ := range []string{AgentWake, AgentStarting, AgentReady} {
+		h.Add(Event{Type: typ})
+	}
+	backlog, stop := h.Replay(func(Entry) {})
+	defer stop()
+	if len(backlog) != 2 || backlog[0].ID != 2 || backlog[1].Event.Type != AgentReady {
+		t.Errorf("backlog = %+v, want the two kept events", backlog)
+	}
+}
+
+func TestHistoryEventIDs(t *testing.T) {
+	h := NewHistory(0)
+	h.Add(Event{Type: AgentWake})
+	h.Add(Event{Type: AgentReady})
+
+	id := h.EventID(Entry{ID: 1})
+	if got := h.After(id); got != 1 {
+		t.Errorf("After(%q) = %d, want 1", id, got)
+	}
+	// An ID from before a restart resumes nothing, even if its number is
+	// one this History has issued since.
+	if got := NewHistory(0).After(id); got != 0 {
+		t.Errorf("another History's ID resumed after %d, want 0", got)
+	}
+	for _, bad := range []string{"", "1", "x-1"} {
+		if got := h.After(bad); got != 0 {
+			t.Errorf("After(%q) = %d, want 0", bad, got)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package events
+
+import "sync/atomic"
+
+// ring is a bounded, lock-free, multi-producer single-consumer queue
+// (Vyukov's design). Each slot's sequence number says whose turn it is:
+// a producer may fill slot i at position pos when seq == pos, and the
+// consumer may take it when seq == pos+1.
+type ring struct {
+	mask  uint64
+	slots []slot
+	head  atomic.Uint64 // next position to write, shared by producers
+	tail  uint64        // next position to read, owned by the consumer
+}
+
+type slot struct {
+	seq atomic.Uint64
+	ev  Event
+}
+
+// newRing creates a ring holding size events, rounded up to a power of two.
+func newRing(size int) *ring {
+	n := 1
+	for n < size {
+		n <<= 1
+	}
+	r := &ring{mask: uint64(n - 1), slots: make([]slot, n)}
+	for i := range r.slots {
+		r.slots[i].seq.Store(uint64(i))
+	}
+	return r
+}
+
+// push adds ev, reporting false without blocking if the ring is full.
+func (r *ring) push(ev Event) bool {
+	for {
+		pos := r.head.Load()
+		s := &r.slots[pos&r.mask]
+		seq := s.seq.Load()
+		switch {
+		case seq == pos:
+			if r.head.CompareAndSwap(pos, pos+1) {
+				s.ev = ev
+				s.seq.Store(pos + 1)
+				return true
+			}
+		case seq < pos:
+			return false // the consumer hasn't freed this slot yet: full
+		}
+		// Another producer claimed pos first; try the next one.
+	}
+}
+
+// pop removes the oldest event. Only the consumer may call it.
+func (r *ring) pop() (Event, bool) {
+	s := &r.slots[r.tail&r.mask]
+	if s.seq.Load() != r.tail+1 {
+		return Event{}, false
+	}
+	ev := s.ev
+	s.ev = Event{}
+	s.seq.Store(r.tail + r.mask + 1)
+	r.tail++
+	return ev, true
+}
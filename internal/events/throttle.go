@@ -0,0 +1,56 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// throttleMaxKeys bounds how many keys a Throttle remembers; past it, keys
+// whose window has ended are forgotten.
+const throttleMaxKeys = 4096
+
+// Throttle limits how often an event is emitted per key, so a client
+// hammering a wrong password becomes one event per window carrying a count
+// rather than a flood of alerts.
+type Throttle struct {
+	window time.Duration
+	mu     sync.Mutex
+	keys   map[string]*throttled
+}
+
+type throttled struct {
+	last       time.Time
+	suppressed int
+}
+
+// NewThrottle returns a throttle that lets one event per key through each
+// window.
+func NewThrottle(window time.Duration) *Throttle {
+	return &Throttle{window: window, keys: make(map[string]*throttled)}
+}
+
+// Allow reports whether an event for key should be emitted now. When it
+// should, suppressed is how many were held back since the last one.
+func (t *Throttle) Allow(key string) (ok bool, suppressed int) {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if k, seen := t.keys[key]; seen {
+		if now.Sub(k.last) < t.window {
+			k.suppressed++
+			return false, 0
+		}
+		suppressed = k.suppressed
+		k.last, k.suppressed = now, 0
+		return true, suppressed
+	}
+	if len(t.keys) >= throttleMaxKeys {
+		for k, v := range t.keys {
+			if now.Sub(v.last) >= t.window {
+				delete(t.keys, k)
+			}
+		}
+	}
+	t.keys[key] = &throttled{last: now}
+	return true, 0
+}
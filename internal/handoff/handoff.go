@@ -0,0 +1,201 @@
+// Package handoff passes Warren's listening sockets to a new warren-server
+// process, so the binary can be upgraded without refusing connections. The
+// old process stops accepting once the new one is ready and keeps serving
+// the connections it already has, so long-lived WebSockets close on their
+// own schedule instead of all reconnecting at once.
+package handoff
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// envFDs lists the keys of the inherited sockets, in file descriptor
+	// order from 3.
+	envFDs = "WARREN_LISTEN_FDS"
+	// envReady is the descriptor the new process writes to once it's
+	// serving.
+	envReady = "WARREN_READY_FD"
+	// envPredecessor is a descriptor that reaches EOF when the old process
+	// exits, since it holds the only write end.
+	envPredecessor = "WARREN_PREDECESSOR_FD"
+)
+
+// filer is a socket that can be duplicated for a new process.
+// *net.TCPListener and *net.UDPConn satisfy it.
+type filer interface {
+	File() (*os.File, error)
+}
+
+// Listeners opens sockets, reusing the ones inherited from the process that
+// started this one. Sockets are keyed by network and address as configured,
+// so both processes must be started with the same config for a socket to
+// carry over; any other address is opened fresh.
+type Listeners struct {
+	mu        sync.Mutex
+	inherited map[string]*os.File
+	open      map[string]filer
+	ready     *os.File
+
+	// predecessorDone is closed once the process that started this one has
+	// exited.
+	predecessorDone chan struct{}
+	// successor is the write end of the new process's predecessor pipe,
+	// held until this process exits.
+	successor *os.File
+}
+
+// New returns Listeners holding the sockets inherited from an upgrading
+// process, if any.
+func New() (*Listeners, error) {
+	l := &Listeners{
+		inherited:       make(map[string]*os.File),
+		open:            make(map[string]filer),
+		predecessorDone: make(chan struct{}),
+	}
+	fds, readyFD, predecessorFD := os.Getenv(envFDs), os.Getenv(envReady), os.Getenv(envPredecessor)
+	// Don't pass the descriptors on to commands this process runs.
+	os.Unsetenv(envFDs)
+	os.Unsetenv(envReady)
+	os.Unsetenv(envPredecessor)
+
+	if fds != "" {
+		for i, key := range strings.Split(fds, ",") {
+			l.inherited[key] = os.NewFile(uintptr(3+i), key)
+		}
+	}
+	if readyFD != "" {
+		fd, err := strconv.Atoi(readyFD)
+		if err != nil {
+			return nil, fmt.Errorf("handoff: invalid %s %q", envReady, readyFD)
+		}
+		l.ready = os.NewFile(uintptr(fd), "ready")
+	}
+	if predecessorFD == "" {
+		close(l.predecessorDone)
+		return l, nil
+	}
+	fd, err := strconv.Atoi(predecessorFD)
+	if err != nil {
+		return nil, fmt.Errorf("handoff: invalid %s %q", envPredecessor, predecessorFD)
+	}
+	f := os.NewFile(uintptr(fd), "predecessor")
+	go func() {
+		io.Copy(io.Discard, f) //nolint:errcheck // returns at EOF, when the old process exits
+		f.Close()
+		close(l.predecessorDone)
+	}()
+	return l, nil
+}
+
+// PredecessorDone returns a channel that is closed once the process this
+// one took over from has exited, after draining its connections. It is
+// closed from the start in a process that wasn't started by an upgrade.
+func (l *Listeners) PredecessorDone() <-chan struct{} {
+	return l.predecessorDone
+}
+
+// Inherited reports whether this process was started by an upgrade.
+func (l *Listeners) Inherited() bool {
+	return l.ready != nil
+}
+
+func key(network, addr string) string {
+	return network + ":" + addr
+}
+
+// Listen is net.Listen, reusing an inherited listener for the address.
+func (l *Listeners) Listen(network, addr string) (net.Listener, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	k := key(network, addr)
+	if f, ok := l.inherited[k]; ok {
+		delete(l.inherited, k)
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("handoff: inherited %s: %w", k, err)
+		}
+		l.track(k, ln)
+		return ln, nil
+	}
+	ln, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	l.track(k, ln)
+	return ln, nil
+}
+
+// ListenPacket is net.ListenPacket, reusing an inherited socket for the
+// address.
+func (l *Listeners) ListenPacket(network, addr string) (net.PacketConn, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	k := key(network, addr)
+	if f, ok := l.inherited[k]; ok {
+		delete(l.inherited, k)
+		pc, err := net.FilePacketConn(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("handoff: inherited %s: %w", k, err)
+		}
+		l.track(k, pc)
+		return pc, nil
+	}
+	pc, err := net.ListenPacket(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	l.track(k, pc)
+	return pc, nil
+}
+
+func (l *Listeners) track(k string, s any) {
+	if f, ok := s.(filer); ok {
+		l.open[k] = f
+	}
+}
+
+// Ready tells the process that started this one that it is serving, so the
+// old process stops accepting. Inherited sockets that weren't reused, such
+// as ports removed from the config, are closed. Ready does nothing in a
+// process that wasn't started by an upgrade.
+func (l *Listeners) Ready() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for k, f := range l.inherited {
+		f.Close()
+		delete(l.inherited, k)
+	}
+	if l.ready == nil {
+		return nil
+	}
+	_, err := l.ready.Write([]byte{1})
+	l.ready.Close()
+	l.ready = nil
+	return err
+}
+
+// files duplicates the open sockets for a new process, skipping ones that
+// have since been closed. The caller closes the files.
+func (l *Listeners) files() (keys []string, files []*os.File) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for k, s := range l.open {
+		f, err := s.File()
+		if err != nil {
+			delete(l.open, k) // closed, e.g. an agent's ports after a reload
+			continue
+		}
+		keys = append(keys, k)
+		files = append(files, f)
+	}
+	return keys, files
+}
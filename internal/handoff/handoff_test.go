@@ -0,0 +1,138 @@
+//go:build !windows
+
+package handoff
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestMain doubles as the upgraded process: Upgrade re-executes the test
+// binary, which then serves "child" on the inherited listener.
+func TestMain(m *testing.M) {
+	if addr := os.Getenv("HANDOFF_TEST_ADDR"); addr != "" {
+		os.Exit(runChild(addr))
+	}
+	os.Exit(m.Run())
+}
+
+func runChild(addr string) int {
+	l, err := New()
+	if err != nil || !l.Inherited() {
+		return 1
+	}
+	ln, err := l.Listen("tcp", addr)
+	if err != nil {
+		return 1
+	}
+	if err := l.Ready(); err != nil {
+		return 1
+	}
+	conn, err := ln.Accept()
+	if err != nil {
+		return 1
+	}
+	// The test process that started this one is still running.
+	select {
+	case <-l.PredecessorDone():
+		conn.Write([]byte("predecessor gone\n")) //nolint:errcheck
+	default:
+		conn.Write([]byte("child\n")) //nolint:errcheck
+	}
+	conn.Close()
+	return 0
+}
+
+func TestUpgradePassesListener(t *testing.T) {
+	const addr = "127.0.0.1:0"
+	l, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Inherited() {
+		t.Fatal("expected a fresh process")
+	}
+	ln, err := l.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bound := ln.Addr().String()
+
+	t.Setenv("HANDOFF_TEST_ADDR", addr)
+	if _, err := l.Upgrade(10 * time.Second); err != nil {
+		t.Fatalf("upgrade: %v", err)
+	}
+
+	// Once this process stops accepting, the new one answers on the same
+	// port.
+	ln.Close()
+	conn, err := net.DialTimeout("tcp", bound, 5*time.Second)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if line != "child\n" {
+		t.Errorf("got %q, want the new process to answer", line)
+	}
+}
+
+func TestUpgradeFailsWhenChildExits(t *testing.T) {
+	l, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The new process can't listen on an invalid address, so it exits
+	// without calling Ready.
+	t.Setenv("HANDOFF_TEST_ADDR", "not-an-address")
+	if _, err := l.Upgrade(10 * time.Second); err == nil {
+		t.Fatal("expected an error when the new process exits early")
+	}
+}
+
+func TestReadyWithoutUpgrade(t *testing.T) {
+	l, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Ready(); err != nil {
+		t.Errorf("Ready() = %v, want nil outside an upgrade", err)
+	}
+	select {
+	case <-l.PredecessorDone():
+	default:
+		t.Error("PredecessorDone() open in a process that wasn't upgraded")
+	}
+}
+
+func TestListenSkipsClosedSockets(t *testing.T) {
+	l, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := l.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	pc, err := l.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc.Close()
+
+	keys, files := l.files()
+	for _, f := range files {
+		f.Close()
+	}
+	if len(keys) != 1 || keys[0] != "tcp:127.0.0.1:0" {
+		t.Errorf("files() keys = %v, want only the open tcp listener", keys)
+	}
+}
@@ -0,0 +1,80 @@
+//go:build !windows
+
+package handoff
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Upgrade starts the current executable again with the same arguments,
+// passing it the open sockets, and waits up to timeout for it to call
+// Ready. It returns the new process's PID. On error the new process has
+// been killed and this one should carry on serving.
+func (l *Listeners) Upgrade(timeout time.Duration) (int, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, fmt.Errorf("handoff: %w", err)
+	}
+	keys, files := l.files()
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return 0, fmt.Errorf("handoff: %w", err)
+	}
+	defer r.Close()
+	// The new process reads the other end of this pipe to learn when this
+	// one exits, so this end stays open for the rest of the process's life.
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		w.Close()
+		return 0, fmt.Errorf("handoff: %w", err)
+	}
+	defer pr.Close()
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = append(files, w, pr)
+	cmd.Env = append(os.Environ(),
+		envFDs+"="+strings.Join(keys, ","),
+		envReady+"="+strconv.Itoa(3+len(files)),
+		envPredecessor+"="+strconv.Itoa(4+len(files)),
+	)
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		pw.Close()
+		return 0, fmt.Errorf("handoff: start %s: %w", exe, err)
+	}
+	go cmd.Wait() //nolint:errcheck // reaps the process if it exits early
+
+	_ = r.SetReadDeadline(time.Now().Add(timeout))
+	if _, err := r.Read(make([]byte, 1)); err != nil {
+		cmd.Process.Kill() //nolint:errcheck
+		pw.Close()
+		if errors.Is(err, io.EOF) {
+			return 0, errors.New("handoff: new process exited before it was ready")
+		}
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return 0, fmt.Errorf("handoff: new process not ready after %s", timeout)
+		}
+		return 0, fmt.Errorf("handoff: %w", err)
+	}
+	// Keep a reference so the finalizer doesn't close it early.
+	l.mu.Lock()
+	l.successor = pw
+	l.mu.Unlock()
+	return cmd.Process.Pid, nil
+}
@@ -0,0 +1,14 @@
+//go:build windows
+
+package handoff
+
+import (
+	"errors"
+	"time"
+)
+
+// Upgrade fails on Windows, where sockets can't be passed to a new process
+// as files.
+func (l *Listeners) Upgrade(time.Duration) (int, error) {
+	return 0, errors.New("handoff: upgrades are not supported on Windows")
+}
@@ -0,0 +1,205 @@
+// Package headers rewrites request headers on their way to a backend and
+// response headers on their way back, so operators can inject credentials a
+// backend expects or hide what it reveals about itself without changing it.
+package headers
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Config declares the rewrites for a route.
+type Config struct {
+	// Request rewrites the headers sent to the backend.
+	Request Rules `yaml:"request,omitempty"`
+	// Response rewrites the headers sent back to the client.
+	Response Rules `yaml:"response,omitempty"`
+}
+
+// Rules sets and removes headers. Set replaces any values already present.
+type Rules struct {
+	Set    map[string]string `yaml:"set,omitempty"`
+	Remove []string          `yaml:"remove,omitempty"`
+}
+
+// Headers that describe the connection or the message framing. Rewriting
+// them would break the request rather than change what the backend sees.
+var reserved = map[string]bool{
+	"Connection":        true,
+	"Content-Length":    true,
+	"Host":              true,
+	"Keep-Alive":        true,
+	"Proxy-Connection":  true,
+	"Te":                true,
+	"Trailer":           true,
+	"Transfer-Encoding": true,
+	"Upgrade":           true,
+}
+
+// Rewriter applies a Config.
+type Rewriter struct {
+	config   Config
+	request  rules
+	response rules
+}
+
+type rules struct {
+	set    map[string]string // canonical name → value
+	remove []string          // canonical names
+}
+
+// New validates c and builds a rewriter from it. It returns nil when c
+// rewrites nothing.
+func New(c Config) (*Rewriter, error) {
+	req, err := compile("request", c.Request)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := compile("response", c.Response)
+	if err != nil {
+		return nil, err
+	}
+	if req.empty() && resp.empty() {
+		return nil, nil
+	}
+	return &Rewriter{config: c, request: req, response: resp}, nil
+}
+
+func compile(side string, r Rules) (rules, error) {
+	out := rules{set: make(map[string]string, len(r.Set))}
+	for name, value := range r.Set {
+		key, err := checkName(name)
+		if err != nil {
+			return rules{}, fmt.Errorf("headers: %s.set: %w", side, err)
+		}
+		if strings.ContainsAny(value, "\r\n\x00") {
+			return rules{}, fmt.Errorf("headers: %s.set: value of %s must not contain line breaks", side, name)
+		}
+		if _, dup := out.set[key]; dup {
+			return rules{}, fmt.Errorf("headers: %s.set: %s is set twice", side, key)
+		}
+		out.set[key] = value
+	}
+	for _, name := range r.Remove {
+		key, err := checkName(name)
+		if err != nil {
+			return rules{}, fmt.Errorf("headers: %s.remove: %w", side, err)
+		}
+		if _, ok := out.set[key]; ok {
+			return rules{}, fmt.Errorf("headers: %s: %s is both set and removed", side, key)
+		}
+		if !slices.Contains(out.remove, key) {
+			out.remove = append(out.remove, key)
+		}
+	}
+	return out, nil
+}
+
+func checkName(name string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("empty header name")
+	}
+	for _, c := range name {
+		if c <= ' ' || c >= 0x7f || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, c) {
+			return "", fmt.Errorf("invalid header name %q", name)
+		}
+	}
+	key := http.CanonicalHeaderKey(name)
+	if reserved[key] {
+		return "", fmt.Errorf("%s can't be rewritten", key)
+	}
+	return key, nil
+}
+
+func (r rules) empty() bool {
+	return len(r.set) == 0 && len(r.remove) == 0
+}
+
+func (r rules) apply(h http.Header) {
+	for _, name := range r.remove {
+		h.Del(name)
+	}
+	for name, value := range r.set {
+		h.Set(name, value)
+	}
+}
+
+// Request rewrites r's headers before it's forwarded.
+func (rw *Rewriter) Request(r *http.Request) {
+	if rw == nil {
+		return
+	}
+	rw.request.apply(r.Header)
+}
+
+// Response returns the writer to respond to r through, which rewrites the
+// response headers as they're written. WebSocket upgrades are left alone.
+func (rw *Rewriter) Response(w http.ResponseWriter, r *http.Request) http.ResponseWriter {
+	if rw == nil || rw.response.empty() || r.Header.Get("Upgrade") != "" {
+		return w
+	}
+	return &writer{ResponseWriter: w, rules: rw.response}
+}
+
+// Config returns the config the rewriter was built from.
+func (rw *Rewriter) Config() Config {
+	return rw.config
+}
+
+// String summarises the rewrites, e.g. "request: set X-Api-Key; response:
+// remove Server".
+func (rw *Rewriter) String() string {
+	var parts []string
+	for _, side := range []struct {
+		name  string
+		rules rules
+	}{{"request", rw.request}, {"response", rw.response}} {
+		if side.rules.empty() {
+			continue
+		}
+		var ops []string
+		if len(side.rules.set) > 0 {
+			names := make([]string, 0, len(side.rules.set))
+			for name := range side.rules.set {
+				names = append(names, name)
+			}
+			slices.Sort(names)
+			ops = append(ops, "set "+strings.Join(names, ", "))
+		}
+		if len(side.rules.remove) > 0 {
+			ops = append(ops, "remove "+strings.Join(side.rules.remove, ", "))
+		}
+		parts = append(parts, side.name+": "+strings.Join(ops, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// writer rewrites the response headers just before they're sent.
+type writer struct {
+	http.ResponseWriter
+	rules rules
+	wrote bool
+}
+
+func (w *writer) WriteHeader(code int) {
+	if !w.wrote && code >= http.StatusOK {
+		w.wrote = true
+		w.rules.apply(w.Header())
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *writer) Write(b []byte) (int, error) {
+	if !w.wrote {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, so
+// streaming responses can still be flushed.
+func (w *writer) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
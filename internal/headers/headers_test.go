@@ -0,0 +1,117 @@
+package headers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewValidation(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		c    Config
+		want string
+	}{
+		{"bad name", Config{Request: Rules{Set: map[string]string{"X Bad": "1"}}}, "invalid header name"},
+		{"empty name", Config{Response: Rules{Remove: []string{""}}}, "empty header name"},
+		{"line break", Config{Request: Rules{Set: map[string]string{"X-Token": "a\r\nEvil: 1"}}}, "line breaks"},
+		{"framing", Config{Request: Rules{Set: map[string]string{"content-length": "0"}}}, "Content-Length can't be rewritten"},
+		{"host", Config{Request: Rules{Remove: []string{"Host"}}}, "Host can't be rewritten"},
+		{"set twice", Config{Request: Rules{Set: map[string]string{"x-token": "a", "X-Token": "b"}}}, "set twice"},
+		{"set and removed", Config{Response: Rules{Set: map[string]string{"Server": "warren"}, Remove: []string{"server"}}}, "both set and removed"},
+	} {
+		if _, err := New(tc.c); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: err = %v, want %q", tc.name, err, tc.want)
+		}
+	}
+
+	rw, err := New(Config{})
+	if rw != nil || err != nil {
+		t.Errorf("New(empty) = %v, %v; want nil, nil", rw, err)
+	}
+}
+
+func TestRequest(t *testing.T) {
+	rw, err := New(Config{Request: Rules{
+		Set:    map[string]string{"x-api-key": "secret", "X-Tenant": "acme"},
+		Remove: []string{"Cookie"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Tenant", "spoofed")
+	r.Header.Set("Cookie", "session=1")
+	r.Header.Set("Accept", "text/plain")
+	rw.Request(r)
+
+	for name, want := range map[string]string{"X-Api-Key": "secret", "X-Tenant": "acme", "Cookie": "", "Accept": "text/plain"} {
+		if got := r.Header.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if got := r.Header.Values("X-Tenant"); len(got) != 1 {
+		t.Errorf("X-Tenant values = %q, want one", got)
+	}
+}
+
+func TestResponse(t *testing.T) {
+	rw, err := New(Config{Response: Rules{
+		Set:    map[string]string{"X-Frame-Options": "DENY"},
+		Remove: []string{"Server", "X-Powered-By"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "nginx/1.2")
+		w.Header().Set("X-Powered-By", "PHP")
+		w.Header().Set("X-Frame-Options", "ALLOW")
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("ok")) //nolint:errcheck
+	})
+
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	backend.ServeHTTP(rw.Response(rec, r), r)
+
+	for name, want := range map[string]string{"Server": "", "X-Powered-By": "", "X-Frame-Options": "DENY", "Content-Type": "text/plain"} {
+		if got := rec.Header().Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if rec.Body.String() != "ok" {
+		t.Errorf("body = %q", rec.Body.String())
+	}
+}
+
+func TestResponseSkipsUpgrades(t *testing.T) {
+	rw, _ := New(Config{Response: Rules{Remove: []string{"Server"}}})
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Upgrade", "websocket")
+	if w := rw.Response(rec, r); w != http.ResponseWriter(rec) {
+		t.Error("WebSocket upgrade got a rewriting writer")
+	}
+}
+
+func TestNilRewriter(t *testing.T) {
+	var rw *Rewriter
+	r := httptest.NewRequest("GET", "/", nil)
+	rw.Request(r)
+	rec := httptest.NewRecorder()
+	if w := rw.Response(rec, r); w != http.ResponseWriter(rec) {
+		t.Error("nil rewriter wrapped the writer")
+	}
+}
+
+func TestString(t *testing.T) {
+	rw, _ := New(Config{
+		Request:  Rules{Set: map[string]string{"x-b": "1", "x-a": "2"}},
+		Response: Rules{Remove: []string{"server"}},
+	})
+	if got, want := rw.String(), "request: set X-A, X-B; response: remove Server"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
@@ -158,6 +158,14 @@ func (c *Client) ProvisionKVBuckets(ctx context.Context) error {
 	return nil
 }
 
+// Ping round-trips to the NATS server, failing while disconnected.
+func (c *Client) Ping(ctx context.Context) error {
+	if c.nc == nil || !c.nc.IsConnected() {
+		return fmt.Errorf("hermes not connected")
+	}
+	return c.nc.FlushWithContext(ctx)
+}
+
 // Close drains and closes the NATS connection.
 func (c *Client) Close() error {
 	if c.nc != nil {
@@ -0,0 +1,141 @@
+// Package human parses and formats durations and sizes in the forms people
+// write them: "1h30m", "2d", "10MB". Config, the admin API and CLI flags
+// share it so the same value is accepted everywhere and read back the same
+// way in inspect output.
+package human
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	Day  = 24 * time.Hour
+	Week = 7 * Day
+)
+
+// schedules maps cron's interval descriptors to the period they run at,
+// for settings that say how often something happens.
+var schedules = map[string]time.Duration{
+	"@hourly": time.Hour,
+	"@daily":  Day,
+	"@weekly": Week,
+}
+
+// ParseDuration accepts Go durations ("1h30m", "500ms") plus day and week
+// units ("2d", "1w", "1d12h") and the descriptors @hourly, @daily and
+// @weekly. Spaces between parts are ignored, so "1h 30m" works too.
+func ParseDuration(s string) (time.Duration, error) {
+	in := strings.ReplaceAll(strings.TrimSpace(s), " ", "")
+	if in == "" {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	if d, ok := schedules[strings.ToLower(in)]; ok {
+		return d, nil
+	}
+	if d, err := time.ParseDuration(in); err == nil {
+		return d, nil
+	}
+
+	// Peel off leading day/week parts, then hand the rest to Go.
+	neg := strings.HasPrefix(in, "-")
+	rest := strings.TrimLeft(in, "+-")
+	var total time.Duration
+	for rest != "" {
+		i := 0
+		for i < len(rest) && (rest[i] >= '0' && rest[i] <= '9' || rest[i] == '.') {
+			i++
+		}
+		if i == 0 || i == len(rest) {
+			break
+		}
+		var unit time.Duration
+		switch rest[i] {
+		case 'd':
+			unit = Day
+		case 'w':
+			unit = Week
+		}
+		if unit == 0 {
+			break
+		}
+		n, err := strconv.ParseFloat(rest[:i], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		total += time.Duration(n * float64(unit))
+		rest = rest[i+1:]
+	}
+	if rest != "" {
+		d, err := time.ParseDuration(rest)
+		if err != nil || d < 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		total += d
+	}
+	if neg {
+		total = -total
+	}
+	return total, nil
+}
+
+// FormatDuration renders d compactly, the inverse of ParseDuration: whole
+// days are shown as "d" and zero trailing units are dropped, so 90 minutes
+// is "1h30m" and 36 hours is "1d12h". Sub-second durations use Go's form.
+func FormatDuration(d time.Duration) string {
+	if d == 0 {
+		return "0s"
+	}
+	if d < 0 {
+		return "-" + FormatDuration(-d)
+	}
+	if d < time.Second || d%time.Second != 0 {
+		return d.String()
+	}
+
+	var b strings.Builder
+	for _, u := range []struct {
+		size time.Duration
+		name string
+	}{{Day, "d"}, {time.Hour, "h"}, {time.Minute, "m"}, {time.Second, "s"}} {
+		if n := d / u.size; n > 0 {
+			fmt.Fprintf(&b, "%d%s", n, u.name)
+			d -= n * u.size
+		}
+	}
+	return b.String()
+}
+
+// Duration is a time.Duration that parses and prints in human form. It
+// satisfies the pflag.Value interface, for CLI flags, and reads and writes
+// YAML, for config fields.
+type Duration time.Duration
+
+func (d Duration) String() string { return FormatDuration(time.Duration(d)) }
+
+// Set parses s with ParseDuration.
+func (d *Duration) Set(s string) error {
+	v, err := ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Type names the flag's value type in help output.
+func (d *Duration) Type() string { return "duration" }
+
+// UnmarshalYAML parses the node's value with ParseDuration.
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	return d.Set(node.Value)
+}
+
+// MarshalYAML writes the duration back in human form.
+func (d Duration) MarshalYAML() (any, error) {
+	return d.String(), nil
+}
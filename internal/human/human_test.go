@@ -0,0 +1,163 @@
+package human
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestParseDuration(t *testing.T) {
+	good := map[string]time.Duration{
+		"30m":      30 * time.Minute,
+		"1h30m":    90 * time.Minute,
+		"1h 30m":   90 * time.Minute,
+		"500ms":    500 * time.Millisecond,
+		"2d":       48 * time.Hour,
+		"1d12h":    36 * time.Hour,
+		"1w":       7 * 24 * time.Hour,
+		"1.5d":     36 * time.Hour,
+		"-1d":      -24 * time.Hour,
+		"1w2d3h4m": (9*24+3)*time.Hour + 4*time.Minute,
+		"@hourly":  time.Hour,
+		"@daily":   24 * time.Hour,
+		"@weekly":  7 * 24 * time.Hour,
+	}
+	for in, want := range good {
+		if got, err := ParseDuration(in); err != nil || got != want {
+			t.Errorf("ParseDuration(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "soon", "5 minutes", "1d-2h", "d", "1x", "@yearly"} {
+		if _, err := ParseDuration(in); err == nil {
+			t.Errorf("ParseDuration(%q): expected error", in)
+		}
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	cases := map[time.Duration]string{
+		0:                       "0s",
+		45 * time.Second:        "45s",
+		90 * time.Minute:        "1h30m",
+		36 * time.Hour:          "1d12h",
+		14 * 24 * time.Hour:     "14d",
+		-30 * time.Minute:       "-30m",
+		1500 * time.Millisecond: "1.5s",
+		250 * time.Millisecond:  "250ms",
+	}
+	for d, want := range cases {
+		got := FormatDuration(d)
+		if got != want {
+			t.Errorf("FormatDuration(%v) = %q, want %q", d, got, want)
+		}
+		if back, err := ParseDuration(got); err != nil || back != d {
+			t.Errorf("%q does not round-trip: %v, %v", got, back, err)
+		}
+	}
+}
+
+func TestDurationFlag(t *testing.T) {
+	var d Duration
+	if err := d.Set("2d"); err != nil || time.Duration(d) != 48*time.Hour {
+		t.Fatalf("Set(2d) = %v, %v", time.Duration(d), err)
+	}
+	if d.String() != "2d" || d.Type() != "duration" {
+		t.Errorf("String/Type = %q/%q", d.String(), d.Type())
+	}
+	if err := d.Set("later"); err == nil {
+		t.Error("expected error for bad flag value")
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	good := map[string]int64{
+		"512":    512,
+		"512B":   512,
+		"10MB":   10_000_000,
+		"10mb":   10_000_000,
+		"1MiB":   1 << 20,
+		"64k":    64 << 10,
+		"1.5GiB": 3 << 29,
+		"2 GB":   2_000_000_000,
+	}
+	for in, want := range good {
+		if got, err := ParseSize(in); err != nil || got != want {
+			t.Errorf("ParseSize(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "MB", "10XB", "ten"} {
+		if _, err := ParseSize(in); err == nil {
+			t.Errorf("ParseSize(%q): expected error", in)
+		}
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	cases := map[int64]string{
+		512:        "512B",
+		1 << 20:    "1MiB",
+		10_000_000: "10MB",
+		1536:       "1536B",
+		1500:       "1500B",
+	}
+	for n, want := range cases {
+		if got := FormatSize(n); got != want {
+			t.Errorf("FormatSize(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestSizeYAML(t *testing.T) {
+	var v struct {
+		Limit Size `yaml:"limit"`
+	}
+	if err := yaml.Unmarshal([]byte("limit: 10MB\n"), &v); err != nil || v.Limit != 10_000_000 {
+		t.Fatalf("unmarshal = %d, %v", v.Limit, err)
+	}
+	if err := yaml.Unmarshal([]byte("limit: lots\n"), &v); err == nil {
+		t.Error("expected error for bad size")
+	}
+	out, _ := yaml.Marshal(struct {
+		Limit Size `yaml:"limit"`
+	}{Size(1 << 20)})
+	if string(out) != "limit: 1MiB\n" {
+		t.Errorf("marshal = %q", out)
+	}
+}
+
+func TestRelative(t *testing.T) {
+	now := time.Date(2026, 2, 11, 19, 0, 0, 0, time.UTC)
+	tests := map[time.Duration]string{
+		0:                                    "just now",
+		-5 * time.Second:                     "5s ago",
+		-(5*time.Minute + 20*time.Second):    "5m ago",
+		-(2*time.Hour + 30*time.Minute):      "2h30m ago",
+		-(3*Day + 4*time.Hour + time.Minute): "3d4h ago",
+		-(20*Day + 5*time.Hour):              "20d ago",
+		90 * time.Minute:                     "in 1h30m",
+	}
+	for offset, want := range tests {
+		if got := Relative(now.Add(offset), now); got != want {
+			t.Errorf("Relative(now%+v) = %q, want %q", offset, got, want)
+		}
+	}
+}
+
+func TestDurationYAML(t *testing.T) {
+	var v struct {
+		Every Duration `yaml:"every"`
+	}
+	if err := yaml.Unmarshal([]byte("every: 1d12h\n"), &v); err != nil || time.Duration(v.Every) != 36*time.Hour {
+		t.Fatalf("unmarshal = %v, %v", v.Every, err)
+	}
+	if err := yaml.Unmarshal([]byte("every: soon\n"), &v); err == nil {
+		t.Error("expected error for bad duration")
+	}
+	out, _ := yaml.Marshal(struct {
+		Every Duration `yaml:"every"`
+	}{Duration(90 * time.Minute)})
+	if string(out) != "every: 1h30m\n" {
+		t.Errorf("marshal = %q", out)
+	}
+}
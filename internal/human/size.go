@@ -0,0 +1,92 @@
+package human
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// sizeUnits maps unit suffixes to byte multiples. KB/MB/GB are powers of
+// 1000 and KiB/MiB/GiB powers of 1024; single letters (K, M, G) follow
+// Docker and mean the binary unit.
+var sizeUnits = map[string]int64{
+	"":    1,
+	"b":   1,
+	"kb":  1000,
+	"mb":  1000 * 1000,
+	"gb":  1000 * 1000 * 1000,
+	"tb":  1000 * 1000 * 1000 * 1000,
+	"k":   1 << 10,
+	"m":   1 << 20,
+	"g":   1 << 30,
+	"t":   1 << 40,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+}
+
+// ParseSize parses a byte size such as "512", "10MB", "1.5GiB" or "64k".
+// Units are case-insensitive.
+func ParseSize(s string) (int64, error) {
+	in := strings.TrimSpace(s)
+	i := 0
+	for i < len(in) && (in[i] >= '0' && in[i] <= '9' || in[i] == '.') {
+		i++
+	}
+	unit, ok := sizeUnits[strings.ToLower(strings.TrimSpace(in[i:]))]
+	if i == 0 || !ok {
+		return 0, fmt.Errorf("invalid size %q (use e.g. 512KB, 10MB or 1GiB)", s)
+	}
+	n, err := strconv.ParseFloat(in[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * float64(unit)), nil
+}
+
+// FormatSize renders n with the largest unit that divides it exactly,
+// preferring binary units, so 1048576 is "1MiB" and 10000000 is "10MB".
+// Other values are left in bytes so they round-trip exactly.
+func FormatSize(n int64) string {
+	if n < 0 {
+		return "-" + FormatSize(-n)
+	}
+	exact := []struct {
+		size int64
+		name string
+	}{
+		{1 << 40, "TiB"}, {1000 * 1000 * 1000 * 1000, "TB"},
+		{1 << 30, "GiB"}, {1000 * 1000 * 1000, "GB"},
+		{1 << 20, "MiB"}, {1000 * 1000, "MB"},
+		{1 << 10, "KiB"}, {1000, "KB"},
+	}
+	for _, u := range exact {
+		if n >= u.size && n%u.size == 0 {
+			return fmt.Sprintf("%d%s", n/u.size, u.name)
+		}
+	}
+	return fmt.Sprintf("%dB", n)
+}
+
+// Size is a byte count that reads and writes YAML in human form.
+type Size int64
+
+// UnmarshalYAML accepts a plain number of bytes or a string with a unit.
+func (s *Size) UnmarshalYAML(node *yaml.Node) error {
+	n, err := ParseSize(node.Value)
+	if err != nil {
+		return err
+	}
+	*s = Size(n)
+	return nil
+}
+
+// MarshalYAML writes the size back in human form.
+func (s Size) MarshalYAML() (any, error) {
+	return FormatSize(int64(s)), nil
+}
+
+func (s Size) String() string { return FormatSize(int64(s)) }
@@ -0,0 +1,44 @@
+package human
+
+import "time"
+
+// Relative describes t relative to now: "5m ago", "in 2h30m", or "just now"
+// within a second. Precision coarsens with distance, so a week-old time is
+// "7d ago" rather than "7d0h3m12s ago".
+func Relative(t, now time.Time) string {
+	d := now.Sub(t)
+	future := d < 0
+	if future {
+		d = -d
+	}
+	if d < time.Second {
+		return "just now"
+	}
+	s := Approx(d)
+	if future {
+		return "in " + s
+	}
+	return s + " ago"
+}
+
+// Approx formats d rounded to a precision suited to its size: seconds under
+// a minute, minutes under a day, hours under a week, days beyond. It suits
+// uptimes and countdowns, where "3d4h" reads better than "3d4h12m7s".
+func Approx(d time.Duration) string {
+	if d < 0 {
+		return "-" + Approx(-d)
+	}
+	return FormatDuration(coarsen(d))
+}
+
+func coarsen(d time.Duration) time.Duration {
+	switch {
+	case d < time.Minute:
+		return d.Round(time.Second)
+	case d < Day:
+		return d.Round(time.Minute)
+	case d < Week:
+		return d.Round(time.Hour)
+	}
+	return d.Round(Day)
+}
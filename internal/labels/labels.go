@@ -0,0 +1,108 @@
+// Package labels picks out groups of agents by their labels, with
+// selectors such as "env=staging,team!=infra", so one command can act on
+// all of them.
+package labels
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Validate checks label keys and values. Keys are non-empty; neither may
+// contain the characters selectors are built from, or whitespace.
+func Validate(labels map[string]string) error {
+	for key, value := range labels {
+		if key == "" || strings.ContainsAny(key, "=!, \t\n") {
+			return fmt.Errorf("label key %q must be non-empty without spaces, '=', '!' or ','", key)
+		}
+		if strings.ContainsAny(value, "=!, \t\n") {
+			return fmt.Errorf("label %q value %q must not contain spaces, '=', '!' or ','", key, value)
+		}
+	}
+	return nil
+}
+
+// Selector matches labels against a list of requirements, all of which must
+// hold.
+type Selector []requirement
+
+type requirement struct {
+	key   string
+	op    string // "=", "!=", "exists" or "!exists"
+	value string
+}
+
+// Parse parses a comma-separated selector. Each requirement is key=value,
+// key!=value (also true without the key), key (the key is set) or !key (it
+// isn't). An empty selector matches everything.
+func Parse(s string) (Selector, error) {
+	var sel Selector
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		var r requirement
+		switch {
+		case strings.Contains(part, "!="):
+			r.key, r.value, _ = strings.Cut(part, "!=")
+			r.op = "!="
+		case strings.Contains(part, "="):
+			r.key, r.value, _ = strings.Cut(part, "=")
+			r.value = strings.TrimPrefix(r.value, "=") // "==" reads as "="
+			r.op = "="
+		case strings.HasPrefix(part, "!"):
+			r.key, r.op = part[1:], "!exists"
+		default:
+			r.key, r.op = part, "exists"
+		}
+		r.key, r.value = strings.TrimSpace(r.key), strings.TrimSpace(r.value)
+		if r.key == "" || strings.ContainsAny(r.key, "=! \t") || strings.ContainsAny(r.value, "=! \t") {
+			return nil, fmt.Errorf("invalid selector %q", part)
+		}
+		sel = append(sel, r)
+	}
+	return sel, nil
+}
+
+// Matches reports whether labels meet every requirement.
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, r := range s {
+		value, ok := labels[r.key]
+		switch r.op {
+		case "=":
+			if !ok || value != r.value {
+				return false
+			}
+		case "!=":
+			if ok && value == r.value {
+				return false
+			}
+		case "exists":
+			if !ok {
+				return false
+			}
+		case "!exists":
+			if ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// String renders the selector in the form Parse reads.
+func (s Selector) String() string {
+	parts := make([]string, len(s))
+	for i, r := range s {
+		switch r.op {
+		case "exists":
+			parts[i] = r.key
+		case "!exists":
+			parts[i] = "!" + r.key
+		default:
+			parts[i] = r.key + r.op + r.value
+		}
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,58 @@
+package labels
+
+import "testing"
+
+func TestSelector(t *testing.T) {
+	staging := map[string]string{"env": "staging", "team": "infra"}
+	prod := map[string]string{"env": "prod"}
+
+	tests := []struct {
+		selector      string
+		staging, prod bool
+	}{
+		{"", true, true},
+		{"env=staging", true, false},
+		{"env==staging", true, false},
+		{"env!=staging", false, true},
+		{"env=staging,team=infra", true, false},
+		{"env=staging,team=web", false, false},
+		{"team", true, false},
+		{"!team", false, true},
+		{" env = prod ", false, true},
+		{"team!=web", true, true},
+	}
+	for _, tt := range tests {
+		sel, err := Parse(tt.selector)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.selector, err)
+		}
+		if got := sel.Matches(staging); got != tt.staging {
+			t.Errorf("%q matches staging = %v, want %v", tt.selector, got, tt.staging)
+		}
+		if got := sel.Matches(prod); got != tt.prod {
+			t.Errorf("%q matches prod = %v, want %v", tt.selector, got, tt.prod)
+		}
+	}
+
+	for _, bad := range []string{"=staging", "env=a=b", "env!", "!"} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("Parse(%q) succeeded", bad)
+		}
+	}
+
+	sel, _ := Parse("env=staging, team!=web,owner,!legacy")
+	if got := sel.String(); got != "env=staging,team!=web,owner,!legacy" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Validate(map[string]string{"env": "staging", "tier": ""}); err != nil {
+		t.Errorf("valid labels rejected: %v", err)
+	}
+	for _, bad := range []map[string]string{{"": "x"}, {"on call": "x"}, {"env": "a,b"}, {"env": "a=b"}} {
+		if err := Validate(bad); err == nil {
+			t.Errorf("Validate(%v) succeeded", bad)
+		}
+	}
+}
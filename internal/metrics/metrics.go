@@ -1,7 +1,10 @@
+//go:build !nometrics
+
 package metrics
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -9,6 +12,11 @@ import (
 	"warren/internal/events"
 )
 
+// Enabled reports whether Prometheus metrics are compiled in. Builds with
+// the nometrics tag drop the client library, which saves several MB on
+// small hosts, and serve no /metrics endpoint.
+const Enabled = true
+
 var (
 	AgentState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "warren_agent_state",
@@ -44,6 +52,25 @@ var (
 		Name: "warren_agent_sleep_total",
 		Help: "Sleep events per agent",
 	}, []string{"agent"})
+
+	CircuitOpen = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "warren_agent_circuit_open",
+		Help: "1 while the agent's backend circuit breaker is open",
+	}, []string{"agent"})
+
+	EventsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "warren_events_total",
+		Help: "Events emitted, by type",
+	}, []string{"type"})
+
+	// RequestDuration only sees sampled requests when metrics.sampling is
+	// below 1, so its _count undercounts; use warren_agent_requests_total
+	// for request rates.
+	RequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "warren_request_duration_seconds",
+		Help:    "Latency of proxied requests per agent (sampled when metrics.sampling < 1)",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"agent"})
 )
 
 func init() {
@@ -55,15 +82,123 @@ func init() {
 		ServiceRegistrations,
 		AgentWakeTotal,
 		AgentSleepTotal,
+		CircuitOpen,
+		EventsTotal,
+		RequestDuration,
+	)
+}
+
+// RegisterReplayBuffer exports the usage of the buffer holding request
+// bodies while agents wake. stats is called on every scrape.
+func RegisterReplayBuffer(stats func() (memory, disk int64, spills uint64)) {
+	prometheus.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        "warren_replay_buffer_bytes",
+			Help:        "Bytes of held request bodies by storage",
+			ConstLabels: prometheus.Labels{"storage": "memory"},
+		}, func() float64 { m, _, _ := stats(); return float64(m) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        "warren_replay_buffer_bytes",
+			Help:        "Bytes of held request bodies by storage",
+			ConstLabels: prometheus.Labels{"storage": "disk"},
+		}, func() float64 { _, d, _ := stats(); return float64(d) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "warren_replay_buffer_spills_total",
+			Help: "Held request bodies that spilled to disk",
+		}, func() float64 { _, _, n := stats(); return float64(n) }),
+	)
+}
+
+// RegisterDroppedEvents exports the events lost because a queue was full:
+// the emitter's dispatch queue, before any handler sees them, and the
+// webhook delivery queue. dropped is called on every scrape.
+func RegisterDroppedEvents(dropped func() (queue, webhook uint64)) {
+	prometheus.MustRegister(
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name:        "warren_events_dropped_total",
+			Help:        "Events dropped because a queue was full, by queue",
+			ConstLabels: prometheus.Labels{"queue": "dispatch"},
+		}, func() float64 { q, _ := dropped(); return float64(q) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name:        "warren_events_dropped_total",
+			Help:        "Events dropped because a queue was full, by queue",
+			ConstLabels: prometheus.Labels{"queue": "webhook"},
+		}, func() float64 { _, w := dropped(); return float64(w) }),
 	)
 }
 
-// Handler returns the Prometheus metrics HTTP handler.
+// RegisterBlockedPaths exports the requests each agent's allowed_paths has
+// turned away. counts is called on every scrape.
+func RegisterBlockedPaths(counts func() map[string]int64) {
+	prometheus.MustRegister(blockedPaths{
+		desc: prometheus.NewDesc("warren_agent_blocked_paths_total",
+			"Requests answered 404 for paths outside the agent's allowed_paths", []string{"agent"}, nil),
+		counts: counts,
+	})
+}
+
+type blockedPaths struct {
+	desc   *prometheus.Desc
+	counts func() map[string]int64
+}
+
+func (b blockedPaths) Describe(ch chan<- *prometheus.Desc) { ch <- b.desc }
+
+func (b blockedPaths) Collect(ch chan<- prometheus.Metric) {
+	for agent, n := range b.counts() {
+		ch <- prometheus.MustNewConstMetric(b.desc, prometheus.CounterValue, float64(n), agent)
+	}
+}
+
+// RegisterWakeBudgets exports each budgeted agent's wakes today against its
+// wake.budget.max_per_day. usage is called on every scrape.
+func RegisterWakeBudgets(usage func() (used, max map[string]int)) {
+	prometheus.MustRegister(wakeBudgets{
+		used: prometheus.NewDesc("warren_agent_wakes_today",
+			"Wakes since local midnight, for agents with a wake budget", []string{"agent"}, nil),
+		max: prometheus.NewDesc("warren_agent_wake_budget",
+			"The agent's wake.budget.max_per_day", []string{"agent"}, nil),
+		usage: usage,
+	})
+}
+
+type wakeBudgets struct {
+	used, max *prometheus.Desc
+	usage     func() (used, max map[string]int)
+}
+
+func (b wakeBudgets) Describe(ch chan<- *prometheus.Desc) {
+	ch <- b.used
+	ch <- b.max
+}
+
+func (b wakeBudgets) Collect(ch chan<- prometheus.Metric) {
+	used, max := b.usage()
+	for agent, n := range used {
+		ch <- prometheus.MustNewConstMetric(b.used, prometheus.GaugeValue, float64(n), agent)
+	}
+	for agent, n := range max {
+		ch <- prometheus.MustNewConstMetric(b.max, prometheus.GaugeValue, float64(n), agent)
+	}
+}
+
+func recordRequest(agent string) {
+	AgentRequestsTotal.WithLabelValues(agent).Inc()
+}
+
+func recordDuration(agent string, d time.Duration) {
+	RequestDuration.WithLabelValues(agent).Observe(d.Seconds())
+}
+
+// Handler returns the Prometheus metrics HTTP handler. Scrapers that ask
+// for OpenMetrics get it, with counters' _total suffixes as the format
+// expects.
 func Handler() http.Handler {
-	return promhttp.Handler()
+	return promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true}))
 }
 
-var allStates = []string{"sleeping", "starting", "ready", "degraded"}
+var allStates = []string{"sleeping", "starting", "ready", "degraded", "crashloop"}
 
 func setAgentState(agent, state string) {
 	for _, s := range allStates {
@@ -78,11 +213,14 @@ func setAgentState(agent, state string) {
 // RegisterEventHandler wires metric updates to the event emitter.
 func RegisterEventHandler(emitter *events.Emitter) {
 	emitter.OnEvent(func(ev events.Event) {
+		EventsTotal.WithLabelValues(ev.Type).Inc()
 		switch ev.Type {
 		case events.AgentReady:
 			setAgentState(ev.Agent, "ready")
 		case events.AgentDegraded:
 			setAgentState(ev.Agent, "degraded")
+		case events.AgentCrashLoop:
+			setAgentState(ev.Agent, "crashloop")
 		case events.AgentStarting:
 			setAgentState(ev.Agent, "starting")
 		case events.AgentSleep:
@@ -90,6 +228,10 @@ func RegisterEventHandler(emitter *events.Emitter) {
 			AgentSleepTotal.WithLabelValues(ev.Agent).Inc()
 		case events.AgentWake:
 			AgentWakeTotal.WithLabelValues(ev.Agent).Inc()
+		case events.CircuitOpen:
+			CircuitOpen.WithLabelValues(ev.Agent).Set(1)
+		case events.CircuitClosed:
+			CircuitOpen.WithLabelValues(ev.Agent).Set(0)
 		case events.AgentHealthFailed:
 			AgentHealthChecksTotal.WithLabelValues(ev.Agent, "fail").Inc()
 		}
@@ -0,0 +1,37 @@
+//go:build nometrics
+
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"warren/internal/events"
+)
+
+// Enabled reports whether Prometheus metrics are compiled in.
+const Enabled = false
+
+func recordRequest(string) {}
+
+func recordDuration(string, time.Duration) {}
+
+// RegisterReplayBuffer is a no-op without metrics.
+func RegisterReplayBuffer(func() (memory, disk int64, spills uint64)) {}
+
+// RegisterDroppedEvents is a no-op without metrics.
+func RegisterDroppedEvents(func() (queue, webhook uint64)) {}
+
+// RegisterBlockedPaths is a no-op without metrics.
+func RegisterBlockedPaths(func() map[string]int64) {}
+
+// RegisterWakeBudgets is a no-op without metrics.
+func RegisterWakeBudgets(func() (used, max map[string]int)) {}
+
+// Handler answers 404: there is nothing to scrape.
+func Handler() http.Handler {
+	return http.NotFoundHandler()
+}
+
+// RegisterEventHandler is a no-op without metrics.
+func RegisterEventHandler(*events.Emitter) {}
@@ -1,10 +1,17 @@
+//go:build !nometrics
+
 package metrics
 
 import (
 	"log/slog"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
 	"warren/internal/events"
 )
 
@@ -29,3 +36,50 @@ func TestRegisterEventHandlerUpdatesCounters(t *testing.T) {
 	emitter.Emit(events.Event{Type: events.AgentHealthFailed, Agent: "test"})
 	emitter.Emit(events.Event{Type: events.AgentStarting, Agent: "test"})
 }
+
+func TestRegisterReplayBuffer(t *testing.T) {
+	RegisterReplayBuffer(func() (int64, int64, uint64) { return 10, 20, 3 })
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]float64{}
+	for _, f := range families {
+		for _, m := range f.GetMetric() {
+			switch f.GetName() {
+			case "warren_replay_buffer_bytes":
+				got[m.GetLabel()[0].GetValue()] = m.GetGauge().GetValue()
+			case "warren_replay_buffer_spills_total":
+				got["spills"] = m.GetCounter().GetValue()
+			}
+		}
+	}
+	if got["memory"] != 10 || got["disk"] != 20 || got["spills"] != 3 {
+		t.Errorf("replay buffer metrics = %v", got)
+	}
+}
+
+func TestEventsTotalByType(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	emitter := events.NewEmitter(logger)
+	RegisterEventHandler(emitter)
+	before := testutil.ToFloat64(EventsTotal.WithLabelValues(events.SecurityBanned))
+
+	emitter.Emit(events.Event{Type: events.SecurityBanned})
+	emitter.Emit(events.Event{Type: events.SecurityBanned})
+	if got := testutil.ToFloat64(EventsTotal.WithLabelValues(events.SecurityBanned)) - before; got != 2 {
+		t.Errorf("warren_events_total{type=%q} rose by %v, want 2", events.SecurityBanned, got)
+	}
+
+	// Scrapers asking for OpenMetrics get it.
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, req)
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/openmetrics-text") {
+		t.Errorf("Content-Type = %q, want OpenMetrics", ct)
+	}
+	if body := w.Body.String(); !strings.Contains(body, `warren_events_total{type="security.ip_banned"}`) || !strings.HasSuffix(body, "# EOF\n") {
+		t.Errorf("OpenMetrics body missing the event counter or # EOF:\n%s", body)
+	}
+}
@@ -0,0 +1,129 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var queryClient = &http.Client{Timeout: 10 * time.Second}
+
+// maxQueryBody bounds how much of a query response is read, so a query
+// matching a huge number of series can't exhaust memory.
+const maxQueryBody = 4 << 20
+
+// Toucher records activity for a hostname. Satisfied by proxy.ActivityTracker.
+type Toucher interface {
+	Touch(hostname string)
+}
+
+// QueryWatch describes a PromQL query whose result signals agent activity.
+type QueryWatch struct {
+	Agent    string
+	Hostname string
+	URL      string // Prometheus base URL, e.g. http://prometheus:9090
+	Query    string
+	Interval time.Duration
+	// State reports the agent's policy state; the query only runs while ready.
+	State func() string
+}
+
+// WatchQuery evaluates the query every interval until ctx is done and
+// touches activity whenever any sample in the result is non-zero. This lets
+// application-level signals such as queue depth keep an agent awake. Failed
+// queries are logged and count as idle.
+func WatchQuery(ctx context.Context, activity Toucher, w QueryWatch, logger *slog.Logger) {
+	logger = logger.With("component", "promql-activity", "agent", w.Agent)
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if w.State != nil && w.State() != "ready" {
+				continue
+			}
+			active, err := evalQuery(ctx, w.URL, w.Query)
+			if err != nil {
+				if ctx.Err() == nil {
+					logger.Warn("activity query failed", "error", err)
+				}
+				continue
+			}
+			if active {
+				logger.Debug("activity query non-zero, touching activity")
+				activity.Touch(w.Hostname)
+			}
+		}
+	}
+}
+
+// evalQuery runs an instant query and reports whether any sample is non-zero.
+func evalQuery(ctx context.Context, baseURL, query string) (bool, error) {
+	u := strings.TrimSuffix(baseURL, "/") + "/api/v1/query?" + url.Values{"query": {query}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := queryClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+		Data   struct {
+			ResultType string          `json:"resultType"`
+			Result     json.RawMessage `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(nil, resp.Body, maxQueryBody)).Decode(&body); err != nil {
+		return false, fmt.Errorf("decode query response (status %d): %w", resp.StatusCode, err)
+	}
+	if body.Status != "success" {
+		return false, fmt.Errorf("query failed: %s", body.Error)
+	}
+
+	var values []string
+	switch body.Data.ResultType {
+	case "vector":
+		var samples []struct {
+			Value [2]any `json:"value"`
+		}
+		if err := json.Unmarshal(body.Data.Result, &samples); err != nil {
+			return false, fmt.Errorf("decode vector result: %w", err)
+		}
+		for _, s := range samples {
+			v, _ := s.Value[1].(string)
+			values = append(values, v)
+		}
+	case "scalar":
+		var sample [2]any
+		if err := json.Unmarshal(body.Data.Result, &sample); err != nil {
+			return false, fmt.Errorf("decode scalar result: %w", err)
+		}
+		v, _ := sample[1].(string)
+		values = append(values, v)
+	default:
+		return false, fmt.Errorf("unsupported result type %q", body.Data.ResultType)
+	}
+
+	for _, v := range values {
+		f, err := strconv.ParseFloat(v, 64)
+		if err == nil && f != 0 && !math.IsNaN(f) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
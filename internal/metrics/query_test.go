@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func promServer(t *testing.T, body *string, mu *sync.Mutex) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/query" || r.URL.Query().Get("query") == "" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		w.Write([]byte(*body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestEvalQuery(t *testing.T) {
+	var mu sync.Mutex
+	var body string
+	srv := promServer(t, &body, &mu)
+
+	tests := map[string]bool{
+		`{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1700000000,"0"]},{"metric":{},"value":[1700000000,"3"]}]}}`: true,
+		`{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1700000000,"0"]}]}}`:                                        false,
+		`{"status":"success","data":{"resultType":"vector","result":[]}}`:                                                                              false,
+		`{"status":"success","data":{"resultType":"scalar","result":[1700000000,"1"]}}`:                                                                true,
+		`{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1700000000,"NaN"]}]}}`:                                      false,
+	}
+	for resp, want := range tests {
+		mu.Lock()
+		body = resp
+		mu.Unlock()
+		got, err := evalQuery(context.Background(), srv.URL, "queue_depth")
+		if err != nil {
+			t.Fatalf("%s: %v", resp, err)
+		}
+		if got != want {
+			t.Errorf("%s: got %v, want %v", resp, got, want)
+		}
+	}
+
+	mu.Lock()
+	body = `{"status":"error","error":"parse error"}`
+	mu.Unlock()
+	if _, err := evalQuery(context.Background(), srv.URL, "queue_depth{"); err == nil {
+		t.Error("expected error for failed query")
+	}
+
+	mu.Lock()
+	body = `{"status":"success","data":{"resultType":"vector","result":[` + strings.Repeat(`{"metric":{},"value":[1700000000,"0"]},`, maxQueryBody/32) + `]}}`
+	mu.Unlock()
+	if _, err := evalQuery(context.Background(), srv.URL, "queue_depth"); err == nil {
+		t.Error("expected error for an oversized response")
+	}
+}
+
+type touchCounter struct {
+	mu sync.Mutex
+	n  int
+}
+
+func (c *touchCounter) Touch(string) {
+	c.mu.Lock()
+	c.n++
+	c.mu.Unlock()
+}
+
+func TestWatchQueryTouchesOnNonZero(t *testing.T) {
+	var mu sync.Mutex
+	body := `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1700000000,"2"]}]}}`
+	srv := promServer(t, &body, &mu)
+	touched := &touchCounter{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go WatchQuery(ctx, touched, QueryWatch{
+		Agent:    "a",
+		Hostname: "a.example.com",
+		URL:      srv.URL,
+		Query:    "queue_depth",
+		Interval: 10 * time.Millisecond,
+		State:    func() string { return "ready" },
+	}, slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError})))
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		touched.mu.Lock()
+		n := touched.n
+		touched.mu.Unlock()
+		if n > 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected activity for non-zero query result")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
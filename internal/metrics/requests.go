@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"warren/internal/realip"
+)
+
+// Requests records proxied requests. Per-agent request counters are always
+// exact; the latency histogram and access log, which cost far more per
+// request, only see a random sample on busy hosts.
+type Requests struct {
+	rate      float64
+	accessLog *slog.Logger
+}
+
+// NewRequests records a fraction rate of requests in the histogram and
+// access log. A rate of 0 or less, or 1 or more, records every request.
+// accessLog may be nil to disable access logging.
+func NewRequests(rate float64, accessLog *slog.Logger) *Requests {
+	if rate <= 0 || rate > 1 {
+		rate = 1
+	}
+	return &Requests{rate: rate, accessLog: accessLog}
+}
+
+// Observe records one completed request.
+func (q *Requests) Observe(r *http.Request, agent string, code int, d time.Duration) {
+	recordRequest(agent)
+	if q.rate < 1 && rand.Float64() >= q.rate {
+		return
+	}
+	recordDuration(agent, d)
+	if q.accessLog != nil {
+		q.accessLog.Info("request",
+			"agent", agent,
+			"method", r.Method,
+			"host", r.Host,
+			"path", r.URL.Path,
+			"status", code,
+			"duration", d,
+			"client", realip.From(r),
+		)
+	}
+}
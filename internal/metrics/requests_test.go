@@ -0,0 +1,56 @@
+//go:build !nometrics
+
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRequestsCountsExactlySamplesHistogram(t *testing.T) {
+	var logs bytes.Buffer
+	q := NewRequests(0.0000001, slog.New(slog.NewTextHandler(&logs, nil)))
+	r := httptest.NewRequest("GET", "http://a.example.com/x", nil)
+	before := testutil.ToFloat64(AgentRequestsTotal.WithLabelValues("sampled"))
+	series := testutil.CollectAndCount(RequestDuration)
+	for i := 0; i < 1000; i++ {
+		q.Observe(r, "sampled", 200, time.Millisecond)
+	}
+
+	if got := testutil.ToFloat64(AgentRequestsTotal.WithLabelValues("sampled")) - before; got != 1000 {
+		t.Errorf("requests_total grew by %v, want exactly 1000", got)
+	}
+	// The histogram has no series for the agent unless a request was sampled.
+	if n := testutil.CollectAndCount(RequestDuration); n != series {
+		t.Errorf("histogram series = %d, want %d at a near-zero sampling rate", n, series)
+	}
+	if logs.Len() != 0 {
+		t.Errorf("unsampled requests were logged: %s", logs.String())
+	}
+}
+
+func TestRequestsRecordsAllByDefault(t *testing.T) {
+	var logs bytes.Buffer
+	q := NewRequests(0, slog.New(slog.NewTextHandler(&logs, nil)))
+	r := httptest.NewRequest("POST", "http://a.example.com/api/chat", nil)
+	// A fresh label, so the histogram gains a series however often this runs.
+	agent := fmt.Sprintf("all-%d", time.Now().UnixNano())
+	series := testutil.CollectAndCount(RequestDuration)
+	q.Observe(r, agent, 502, 2*time.Second)
+
+	if n := testutil.CollectAndCount(RequestDuration); n != series+1 {
+		t.Errorf("histogram series = %d, want %d", n, series+1)
+	}
+	for _, want := range []string{"agent=" + agent, "method=POST", "path=/api/chat", "status=502", "duration=2s"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("access log %q missing %q", logs.String(), want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Package openclaw integrates Warren with OpenClaw agents: it reads
+// openclaw.json to derive ports and health endpoints, and polls the gateway
+// for session activity.
+package openclaw
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+const (
+	// DefaultPort is the gateway port Warren assumes when openclaw.json has none.
+	DefaultPort = 18790
+	// DefaultHealthPath is the gateway health endpoint.
+	DefaultHealthPath = "/health"
+	// DefaultSessionsPath is the gateway endpoint listing sessions.
+	DefaultSessionsPath = "/api/sessions"
+)
+
+// Config is the subset of openclaw.json Warren cares about. Both the full
+// gateway format ({"gateway":{"port":...}}) and the flat format written by
+// `warren scaffold` ({"port":...,"health_endpoint":...}) are understood.
+type Config struct {
+	Name           string `json:"name"`
+	FlatPort       int    `json:"port"`
+	HealthEndpoint string `json:"health_endpoint"`
+	Gateway        struct {
+		Port int    `json:"port"`
+		Bind string `json:"bind"`
+	} `json:"gateway"`
+	Agents struct {
+		List []struct {
+			ID      string `json:"id"`
+			Default bool   `json:"default"`
+		} `json:"list"`
+	} `json:"agents"`
+}
+
+// Load reads and parses an openclaw.json file.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read openclaw config: %w", err)
+	}
+	return Parse(data)
+}
+
+// Parse parses openclaw.json content.
+func Parse(data []byte) (*Config, error) {
+	var c Config
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("parse openclaw config: %w", err)
+	}
+	if p := c.Port(); p < 1 || p > 65535 {
+		return nil, fmt.Errorf("openclaw config: invalid port %d", p)
+	}
+	return &c, nil
+}
+
+// Port returns the gateway port, preferring gateway.port over the flat field.
+func (c *Config) Port() int {
+	if c.Gateway.Port != 0 {
+		return c.Gateway.Port
+	}
+	if c.FlatPort != 0 {
+		return c.FlatPort
+	}
+	return DefaultPort
+}
+
+// HealthPath returns the health endpoint path.
+func (c *Config) HealthPath() string {
+	if c.HealthEndpoint != "" {
+		return c.HealthEndpoint
+	}
+	return DefaultHealthPath
+}
+
+// AgentIDs returns the IDs of the OpenClaw agents hosted by the gateway.
+func (c *Config) AgentIDs() []string {
+	ids := make([]string, 0, len(c.Agents.List))
+	for _, a := range c.Agents.List {
+		ids = append(ids, a.ID)
+	}
+	return ids
+}
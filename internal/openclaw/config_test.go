@@ -0,0 +1,50 @@
+package openclaw
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseGatewayFormat(t *testing.T) {
+	c, err := Parse([]byte(`{"gateway":{"port":18800},"agents":{"list":[{"id":"main","default":true},{"id":"ops"}]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Port() != 18800 {
+		t.Errorf("Port() = %d", c.Port())
+	}
+	if c.HealthPath() != DefaultHealthPath {
+		t.Errorf("HealthPath() = %q", c.HealthPath())
+	}
+	if got := c.AgentIDs(); !reflect.DeepEqual(got, []string{"main", "ops"}) {
+		t.Errorf("AgentIDs() = %v", got)
+	}
+}
+
+func TestParseFlatFormat(t *testing.T) {
+	c, err := Parse([]byte(`{"name":"x","port":9000,"health_endpoint":"/healthz"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Port() != 9000 || c.HealthPath() != "/healthz" {
+		t.Errorf("Port/HealthPath = %d %q", c.Port(), c.HealthPath())
+	}
+}
+
+func TestParseDefaults(t *testing.T) {
+	c, err := Parse([]byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Port() != DefaultPort {
+		t.Errorf("Port() = %d, want %d", c.Port(), DefaultPort)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, in := range []string{`{"port":70000}`, `{"gateway":{"port":-1}}`, `not json`} {
+		if _, err := Parse([]byte(in)); err == nil {
+			t.Errorf("Parse(%s): expected error", in)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package openclaw
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxSessionsBody bounds how much of a gateway's sessions response is read.
+const maxSessionsBody = 1 << 20
+
+// Session is a single OpenClaw gateway session.
+type Session struct {
+	Key       string `json:"key"`
+	AgentID   string `json:"agentId,omitempty"`
+	UpdatedAt int64  `json:"updatedAt,omitempty"` // unix millis
+}
+
+// Snapshot is the most recent session poll result for an agent.
+type Snapshot struct {
+	Agent     string    `json:"agent"`
+	Total     int       `json:"total"`
+	Active    int       `json:"active"`
+	Sessions  []Session `json:"sessions"`
+	PolledAt  time.Time `json:"polled_at"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// Toucher records activity for a hostname. Satisfied by proxy.ActivityTracker.
+type Toucher interface {
+	Touch(hostname string)
+}
+
+// Target describes how to poll one agent's gateway.
+type Target struct {
+	Agent        string
+	Hostname     string
+	URL          string
+	Token        string
+	PollInterval time.Duration
+	ActiveWindow time.Duration
+	// State reports the agent's policy state; sessions are only polled while ready.
+	State func() string
+}
+
+// SessionMonitor polls OpenClaw gateways for sessions and touches activity
+// for agents with recently active sessions, keeping them awake.
+type SessionMonitor struct {
+	activity Toucher
+	client   *http.Client
+	logger   *slog.Logger
+
+	mu        sync.RWMutex
+	snapshots map[string]Snapshot
+	cancels   map[string]context.CancelFunc
+}
+
+// NewSessionMonitor creates a new session monitor.
+func NewSessionMonitor(activity Toucher, logger *slog.Logger) *SessionMonitor {
+	return &SessionMonitor{
+		activity:  activity,
+		client:    &http.Client{Timeout: 5 * time.Second},
+		logger:    logger.With("component", "openclaw-sessions"),
+		snapshots: make(map[string]Snapshot),
+		cancels:   make(map[string]context.CancelFunc),
+	}
+}
+
+// Register starts polling for an agent. Any previous registration is replaced.
+func (m *SessionMonitor) Register(ctx context.Context, t Target) {
+	pollCtx, cancel := context.WithCancel(ctx)
+
+	m.mu.Lock()
+	if prev, ok := m.cancels[t.Agent]; ok {
+		prev()
+	}
+	m.cancels[t.Agent] = cancel
+	m.mu.Unlock()
+
+	go m.run(pollCtx, t)
+	m.logger.Info("session polling registered", "agent", t.Agent, "url", t.URL, "interval", t.PollInterval)
+}
+
+// Unregister stops polling for an agent and forgets its snapshot.
+func (m *SessionMonitor) Unregister(agent string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if cancel, ok := m.cancels[agent]; ok {
+		cancel()
+		delete(m.cancels, agent)
+	}
+	delete(m.snapshots, agent)
+}
+
+// Snapshot returns the latest poll result for an agent.
+func (m *SessionMonitor) Snapshot(agent string) (Snapshot, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	s, ok := m.snapshots[agent]
+	return s, ok
+}
+
+// Registered reports whether an agent is being polled.
+func (m *SessionMonitor) Registered(agent string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.cancels[agent]
+	return ok
+}
+
+func (m *SessionMonitor) run(ctx context.Context, t Target) {
+	ticker := time.NewTicker(t.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if t.State != nil && t.State() != "ready" {
+				continue
+			}
+			m.poll(ctx, t)
+		}
+	}
+}
+
+func (m *SessionMonitor) poll(ctx context.Context, t Target) {
+	snap := Snapshot{Agent: t.Agent, PolledAt: time.Now()}
+
+	sessions, err := m.fetch(ctx, t)
+	if err != nil {
+		m.logger.Warn("session poll failed", "agent", t.Agent, "error", err)
+		snap.LastError = err.Error()
+	} else {
+		snap.Sessions = sessions
+		snap.Total = len(sessions)
+		snap.Active = countActive(sessions, t.ActiveWindow, snap.PolledAt)
+	}
+
+	// Unregister and Register cancel ctx under the lock, so a poll that
+	// outlived its registration can't bring back a snapshot or keep the
+	// agent awake.
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if ctx.Err() != nil {
+		return
+	}
+	m.snapshots[t.Agent] = snap
+	if snap.Active > 0 {
+		m.activity.Touch(t.Hostname)
+	}
+}
+
+func (m *SessionMonitor) fetch(ctx context.Context, t Target) ([]Session, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if t.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+t.Token)
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("sessions endpoint returned status %d", resp.StatusCode)
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, maxSessionsBody+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) > maxSessionsBody {
+		return nil, fmt.Errorf("sessions response exceeds %d bytes", maxSessionsBody)
+	}
+	return parseSessions(raw)
+}
+
+// parseSessions accepts either a bare array or {"sessions": [...]}.
+func parseSessions(raw json.RawMessage) ([]Session, error) {
+	var list []Session
+	if err := json.Unmarshal(raw, &list); err == nil {
+		return list, nil
+	}
+	var wrapped struct {
+		Sessions []Session `json:"sessions"`
+	}
+	if err := json.Unmarshal(raw, &wrapped); err != nil {
+		return nil, fmt.Errorf("decode sessions: %w", err)
+	}
+	return wrapped.Sessions, nil
+}
+
+// countActive counts sessions updated within window. Sessions without an
+// updatedAt timestamp are treated as active.
+func countActive(sessions []Session, window time.Duration, now time.Time) int {
+	n := 0
+	for _, s := range sessions {
+		if s.UpdatedAt == 0 || now.Sub(time.UnixMilli(s.UpdatedAt)) <= window {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,175 @@
+package openclaw
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeToucher struct {
+	mu      sync.Mutex
+	touched map[string]int
+}
+
+func (f *fakeToucher) Touch(hostname string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.touched == nil {
+		f.touched = make(map[string]int)
+	}
+	f.touched[hostname]++
+}
+
+func (f *fakeToucher) count(hostname string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.touched[hostname]
+}
+
+func TestSessionMonitorTouchesOnActiveSessions(t *testing.T) {
+	var gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		fmt.Fprintf(w, `{"sessions":[{"key":"a","updatedAt":%d},{"key":"b","updatedAt":1}]}`, time.Now().UnixMilli())
+	}))
+	defer srv.Close()
+
+	toucher := &fakeToucher{}
+	m := NewSessionMonitor(toucher, slog.Default())
+	m.poll(context.Background(), Target{Agent: "a", Hostname: "a.example.com", URL: srv.URL, Token: "tok", ActiveWindow: time.Minute})
+
+	snap, ok := m.Snapshot("a")
+	if !ok {
+		t.Fatal("expected snapshot")
+	}
+	if snap.Total != 2 || snap.Active != 1 {
+		t.Errorf("total/active = %d/%d, want 2/1", snap.Total, snap.Active)
+	}
+	if toucher.count("a.example.com") != 1 {
+		t.Errorf("expected one touch, got %d", toucher.count("a.example.com"))
+	}
+	if gotAuth != "Bearer tok" {
+		t.Errorf("Authorization = %q", gotAuth)
+	}
+}
+
+func TestSessionMonitorNoTouchWhenIdle(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"key":"old","updatedAt":1}]`))
+	}))
+	defer srv.Close()
+
+	toucher := &fakeToucher{}
+	m := NewSessionMonitor(toucher, slog.Default())
+	m.poll(context.Background(), Target{Agent: "a", Hostname: "a.example.com", URL: srv.URL, ActiveWindow: time.Minute})
+
+	snap, _ := m.Snapshot("a")
+	if snap.Total != 1 || snap.Active != 0 {
+		t.Errorf("total/active = %d/%d, want 1/0", snap.Total, snap.Active)
+	}
+	if toucher.count("a.example.com") != 0 {
+		t.Error("idle sessions should not touch activity")
+	}
+}
+
+func TestSessionMonitorRecordsError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	m := NewSessionMonitor(&fakeToucher{}, slog.Default())
+	m.poll(context.Background(), Target{Agent: "a", URL: srv.URL})
+
+	snap, _ := m.Snapshot("a")
+	if snap.LastError == "" {
+		t.Error("expected last_error to be set")
+	}
+}
+
+func TestSessionMonitorSkipsWhenNotReady(t *testing.T) {
+	var mu sync.Mutex
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits++
+		mu.Unlock()
+		w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+
+	m := NewSessionMonitor(&fakeToucher{}, slog.Default())
+	m.Register(context.Background(), Target{
+		Agent:        "a",
+		URL:          srv.URL,
+		PollInterval: 5 * time.Millisecond,
+		State:        func() string { return "sleeping" },
+	})
+	if !m.Registered("a") {
+		t.Fatal("expected agent to be registered")
+	}
+	time.Sleep(30 * time.Millisecond)
+	m.Unregister("a")
+
+	mu.Lock()
+	defer mu.Unlock()
+	if hits != 0 {
+		t.Errorf("expected no polls while sleeping, got %d", hits)
+	}
+	if m.Registered("a") {
+		t.Error("expected agent to be unregistered")
+	}
+}
+
+func TestSessionMonitorRejectsOversizedResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"key":"` + strings.Repeat("x", maxSessionsBody) + `"}]`))
+	}))
+	defer srv.Close()
+
+	m := NewSessionMonitor(&fakeToucher{}, slog.Default())
+	m.poll(context.Background(), Target{Agent: "a", URL: srv.URL})
+
+	snap, _ := m.Snapshot("a")
+	if !strings.Contains(snap.LastError, "exceeds") || snap.Total != 0 {
+		t.Errorf("snapshot = %+v, want a size error", snap)
+	}
+}
+
+func TestSessionMonitorPollAfterUnregister(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		fmt.Fprintf(w, `[{"key":"a","updatedAt":%d}]`, time.Now().UnixMilli())
+	}))
+	defer srv.Close()
+
+	toucher := &fakeToucher{}
+	m := NewSessionMonitor(toucher, slog.Default())
+	ctx, cancel := context.WithCancel(context.Background())
+	m.mu.Lock()
+	m.cancels["a"] = cancel
+	m.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		m.poll(ctx, Target{Agent: "a", Hostname: "a.example.com", URL: srv.URL, ActiveWindow: time.Minute})
+		close(done)
+	}()
+	m.Unregister("a")
+	close(release)
+	<-done
+
+	if _, ok := m.Snapshot("a"); ok {
+		t.Error("a poll finishing after Unregister stored a snapshot")
+	}
+	if toucher.count("a.example.com") != 0 {
+		t.Error("a poll finishing after Unregister touched activity")
+	}
+}
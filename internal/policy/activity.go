@@ -0,0 +1,125 @@
+package policy
+
+import (
+	"sync"
+	"time"
+
+	"warren/internal/clock"
+)
+
+// Activity combination modes for an on-demand agent's activity sources.
+const (
+	ActivityAny = "any" // active while any source is active (default)
+	ActivityAll = "all" // active only while every source is active
+)
+
+// Built-in activity source names.
+const (
+	SourceRequests    = "requests"    // proxied traffic recorded in the ActivitySource
+	SourceConnections = "connections" // open WebSocket and raw port connections
+)
+
+// ActivitySignal reports when an agent was last active by one measure. A
+// zero time means never; a time in the future means busy until then.
+type ActivitySignal interface {
+	LastActive(hostname string) time.Time
+}
+
+// ActivitySignalFunc adapts a function to an ActivitySignal.
+type ActivitySignalFunc func(hostname string) time.Time
+
+// LastActive calls f.
+func (f ActivitySignalFunc) LastActive(hostname string) time.Time { return f(hostname) }
+
+// ActivityLog is an ActivitySignal fed by a poller calling Touch, for sources
+// that should be evaluated on their own rather than counted as requests.
+type ActivityLog struct {
+	clock clock.Clock
+	mu    sync.RWMutex
+	last  map[string]time.Time
+}
+
+// NewActivityLog creates an empty log.
+func NewActivityLog() *ActivityLog {
+	return &ActivityLog{last: make(map[string]time.Time)}
+}
+
+// SetClock sets the time source Touch records; nil uses the system clock.
+func (l *ActivityLog) SetClock(c clock.Clock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.clock = c
+}
+
+// Touch records activity for hostname now.
+func (l *ActivityLog) Touch(hostname string) {
+	l.mu.Lock()
+	l.last[hostname] = clock.Or(l.clock).Now()
+	l.mu.Unlock()
+}
+
+// LastActive returns when hostname was last touched.
+func (l *ActivityLog) LastActive(hostname string) time.Time {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.last[hostname]
+}
+
+// AddActivitySignal registers a named activity source. It is only consulted
+// if its name is listed in the agent's activity sources.
+func (o *OnDemand) AddActivitySignal(name string, s ActivitySignal) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.signals[name] = s
+}
+
+// idleRemaining returns how long until the agent counts as idle, combining
+// its activity sources by the activity mode. Zero or less means idle now.
+func (o *OnDemand) idleRemaining() time.Duration {
+	o.mu.RLock()
+	var last time.Time
+	seen := false
+	for _, name := range o.activitySources {
+		sig, ok := o.signals[name]
+		if !ok {
+			continue
+		}
+		t := sig.LastActive(o.hostname)
+		switch {
+		case !seen:
+			last = t
+		case o.activityMode == ActivityAll && t.Before(last):
+			last = t
+		case o.activityMode != ActivityAll && t.After(last):
+			last = t
+		}
+		seen = true
+	}
+	o.mu.RUnlock()
+
+	if last.IsZero() {
+		return 0
+	}
+	return o.idleTimeout - o.clock.Since(last)
+}
+
+// activeCounter is a WSSource that can tell idle WebSocket connections from
+// live ones.
+type activeCounter interface {
+	Active(hostname string) int64
+}
+
+// connectionSignal treats any open connection as activity right now, except
+// WebSockets the source reports as idle.
+func connectionSignal(ws WSSource, clk clock.Clock) ActivitySignal {
+	count := ws.Count
+	if ac, ok := ws.(activeCounter); ok {
+		count = ac.Active
+	}
+	return ActivitySignalFunc(func(hostname string) time.Time {
+		if count(hostname) > 0 {
+			return clk.Now()
+		}
+		return time.Time{}
+	})
+}
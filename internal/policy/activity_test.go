@@ -0,0 +1,101 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	"warren/internal/clock"
+	"warren/internal/events"
+)
+
+func newActivityTestOnDemand(mode string, sources []string) (*OnDemand, *mockActivity, *mockWSSource) {
+	activity := newMockActivity()
+	ws := &mockWSSource{}
+	od := NewOnDemand(&mockLifecycle{status: "exited"}, OnDemandConfig{
+		Agent:           "test",
+		ContainerName:   "test-svc",
+		Hostname:        "test.com",
+		IdleTimeout:     time.Minute,
+		ActivityMode:    mode,
+		ActivitySources: sources,
+	}, activity, ws, events.NewEmitter(quietLogger()), quietLogger())
+	return od, activity, ws
+}
+
+func TestIdleRemainingDefaultSources(t *testing.T) {
+	od, activity, ws := newActivityTestOnDemand("", nil)
+	if r := od.idleRemaining(); r > 0 {
+		t.Fatalf("expected idle with no activity, got %v", r)
+	}
+
+	ws.count = 1
+	if r := od.idleRemaining(); r < 59*time.Second {
+		t.Errorf("open connection should count as activity now, remaining %v", r)
+	}
+
+	ws.count = 0
+	activity.Touch("test.com")
+	if r := od.idleRemaining(); r <= 0 {
+		t.Error("recent request should count as activity")
+	}
+}
+
+func TestIdleRemainingAllMode(t *testing.T) {
+	cpu := NewActivityLog()
+	od, activity, _ := newActivityTestOnDemand(ActivityAll, []string{SourceRequests, "cpu"})
+	od.AddActivitySignal("cpu", cpu)
+
+	activity.Touch("test.com")
+	if r := od.idleRemaining(); r > 0 {
+		t.Errorf("all mode: requests alone should not keep the agent awake, remaining %v", r)
+	}
+
+	cpu.Touch("test.com")
+	if r := od.idleRemaining(); r <= 0 {
+		t.Error("all mode: expected active when every source is active")
+	}
+}
+
+func TestIdleRemainingAnyModeCustomSource(t *testing.T) {
+	cpu := NewActivityLog()
+	od, _, ws := newActivityTestOnDemand(ActivityAny, []string{"cpu"})
+	od.AddActivitySignal("cpu", cpu)
+
+	ws.count = 1 // connections is not a listed source
+	if r := od.idleRemaining(); r > 0 {
+		t.Errorf("unlisted source should be ignored, remaining %v", r)
+	}
+	cpu.Touch("test.com")
+	if r := od.idleRemaining(); r <= 0 {
+		t.Error("expected listed custom source to count")
+	}
+}
+
+// idleWSSource reports open connections, none of them live.
+type idleWSSource struct{ mockWSSource }
+
+func (idleWSSource) Active(string) int64 { return 0 }
+
+func TestConnectionSignalSkipsIdleWebSockets(t *testing.T) {
+	ws := &idleWSSource{mockWSSource{count: 2}}
+	od := NewOnDemand(&mockLifecycle{status: "exited"}, OnDemandConfig{
+		Agent:         "test",
+		ContainerName: "test-svc",
+		Hostname:      "test.com",
+		IdleTimeout:   time.Minute,
+	}, newMockActivity(), ws, events.NewEmitter(quietLogger()), quietLogger())
+
+	if r := od.idleRemaining(); r > 0 {
+		t.Errorf("idle WebSockets should not count as activity, remaining %v", r)
+	}
+}
+
+func TestActivityLogUsesClock(t *testing.T) {
+	clk := clock.NewFake(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC))
+	l := NewActivityLog()
+	l.SetClock(clk)
+	l.Touch("test.com")
+	if got := l.LastActive("test.com"); !got.Equal(clk.Now()) {
+		t.Errorf("last active = %v, want the fake clock's %v", got, clk.Now())
+	}
+}
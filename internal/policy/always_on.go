@@ -2,10 +2,12 @@ package policy
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"sync"
 	"time"
 
+	"warren/internal/clock"
 	"warren/internal/container"
 	"warren/internal/events"
 )
@@ -16,11 +18,27 @@ type AlwaysOn struct {
 
 	checkInterval time.Duration
 	maxFailures   int
+	wheel         *TimerWheel
+	clock         clock.Clock
 
 	mu       sync.RWMutex
 	state    string
 	failures int
 
+	// Remediation, enabled by EnableRestartOnDegraded.
+	manager         container.Lifecycle
+	containerName   string
+	maxRestarts     int
+	restartCooldown time.Duration
+	restarts        int // restarts since the agent was last healthy
+	lastRestart     time.Time
+
+	// Forced recycling, enabled by EnableMaxLifetime.
+	lifetime   *lifetime
+	readySince time.Time // when the agent last became ready, or its container started if earlier
+	started    bool      // readySince has been checked against the container's start
+	recycling  bool      // restarted by recycleIfDue and not ready again yet
+
 	emitter *events.Emitter
 	logger  *slog.Logger
 }
@@ -30,6 +48,8 @@ type AlwaysOnConfig struct {
 	HealthURL     string
 	CheckInterval time.Duration
 	MaxFailures   int
+	Wheel         *TimerWheel // shared timers; nil uses a runtime timer
+	Clock         clock.Clock // time source; nil uses the system clock
 }
 
 func NewAlwaysOn(cfg AlwaysOnConfig, emitter *events.Emitter, logger *slog.Logger) *AlwaysOn {
@@ -38,6 +58,8 @@ func NewAlwaysOn(cfg AlwaysOnConfig, emitter *events.Emitter, logger *slog.Logge
 		healthURL:     cfg.HealthURL,
 		checkInterval: cfg.CheckInterval,
 		maxFailures:   cfg.MaxFailures,
+		wheel:         cfg.Wheel,
+		clock:         clock.Or(cfg.Clock),
 		state:         "starting",
 		emitter:       emitter,
 		logger:        logger.With("agent", cfg.Agent, "policy", "always-on"),
@@ -47,14 +69,17 @@ func NewAlwaysOn(cfg AlwaysOnConfig, emitter *events.Emitter, logger *slog.Logge
 func (a *AlwaysOn) Start(ctx context.Context) {
 	a.emitter.Emit(events.Event{Type: events.AgentStarting, Agent: a.agent})
 
-	ticker := time.NewTicker(a.checkInterval)
-	defer ticker.Stop()
+	timer := newPolicyTimer(a.wheel, a.clock, a.checkInterval)
+	defer timer.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
+		case <-timer.C:
+			a.mu.RLock()
+			timer.Reset(a.checkInterval)
+			a.mu.RUnlock()
 			a.tick(ctx)
 		}
 	}
@@ -77,13 +102,74 @@ func (a *AlwaysOn) Reconfigure(checkInterval time.Duration, maxFailures int) {
 	a.logger.Info("reconfigured", "check_interval", checkInterval, "max_failures", maxFailures)
 }
 
+// SetHealthURL changes the URL health checks probe, from the next check.
+func (a *AlwaysOn) SetHealthURL(url string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.healthURL = url
+	a.logger.Info("health url changed", "health_url", url)
+}
+
+// EnableRestartOnDegraded makes the policy restart the container while it is
+// degraded, at most maxAttempts times and no more often than cooldown.
+// A nil mgr turns remediation off again, e.g. when a reload drops
+// restart_on_degraded.
+func (a *AlwaysOn) EnableRestartOnDegraded(mgr container.Lifecycle, containerName string, maxAttempts int, cooldown time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.manager = mgr
+	a.containerName = containerName
+	a.maxRestarts = maxAttempts
+	a.restartCooldown = cooldown
+}
+
 func (a *AlwaysOn) tick(ctx context.Context) {
-	err := container.CheckHealth(ctx, a.healthURL)
+	a.mu.RLock()
+	healthURL := a.healthURL
+	a.mu.RUnlock()
+	err := container.CheckHealth(ctx, healthURL)
 	if err == nil {
 		a.onHealthy()
+		a.recycleIfDue(ctx)
 		return
 	}
 	a.onUnhealthy(err)
+	a.remediate(ctx)
+}
+
+// remediate restarts a degraded container if remediation is enabled, the
+// cooldown has passed and attempts remain.
+func (a *AlwaysOn) remediate(ctx context.Context) {
+	a.mu.Lock()
+	if a.manager == nil || a.state != "degraded" || a.restarts > a.maxRestarts {
+		a.mu.Unlock()
+		return
+	}
+	if a.restarts == a.maxRestarts {
+		a.restarts++ // report exhaustion once
+		a.mu.Unlock()
+		a.logger.Error("restart attempts exhausted, leaving agent degraded", "attempts", a.maxRestarts)
+		a.emitter.Emit(events.Event{Type: events.RestartExhausted, Agent: a.agent})
+		return
+	}
+	if !a.lastRestart.IsZero() && a.clock.Since(a.lastRestart) < a.restartCooldown {
+		a.mu.Unlock()
+		return
+	}
+	a.restarts++
+	a.lastRestart = a.clock.Now()
+	attempt := a.restarts
+	a.mu.Unlock()
+
+	a.logger.Warn("restarting degraded agent", "attempt", attempt, "max", a.maxRestarts)
+	a.emitter.Emit(events.Event{
+		Type:   events.AgentRemediating,
+		Agent:  a.agent,
+		Fields: map[string]string{"attempt": fmt.Sprintf("%d", attempt)},
+	})
+	if err := a.manager.Restart(ctx, a.containerName, 10*time.Second); err != nil {
+		a.logger.Error("restart failed", "attempt", attempt, "error", err)
+	}
 }
 
 func (a *AlwaysOn) onHealthy() {
@@ -93,10 +179,27 @@ func (a *AlwaysOn) onHealthy() {
 	prev := a.state
 	a.state = "ready"
 	a.failures = 0
+	restarts := a.restarts
+	a.restarts = 0
+	a.lastRestart = time.Time{}
 
 	if prev != "ready" {
+		a.readySince, a.started = a.clock.Now(), false
+		if a.recycling {
+			a.recycling = false
+			if a.lifetime != nil {
+				a.lifetime.cfg.Gate.release(a.agent)
+			}
+		}
 		a.logger.Info("agent became healthy", "state", "ready")
 		a.emitter.Emit(events.Event{Type: events.AgentReady, Agent: a.agent})
+		if restarts > 0 {
+			a.emitter.Emit(events.Event{
+				Type:   events.AgentRecovered,
+				Agent:  a.agent,
+				Fields: map[string]string{"restarts": fmt.Sprintf("%d", min(restarts, a.maxRestarts))},
+			})
+		}
 	}
 }
 
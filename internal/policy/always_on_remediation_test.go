@@ -0,0 +1,135 @@
+package policy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"warren/internal/events"
+)
+
+func TestAlwaysOnRestartOnDegradedRecovers(t *testing.T) {
+	var healthy int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&healthy) == 1 {
+			w.WriteHeader(200)
+			return
+		}
+		w.WriteHeader(500)
+	}))
+	defer srv.Close()
+
+	emitter := events.NewEmitter(quietLogger())
+	recovered := make(chan events.Event, 1)
+	emitter.OnEvent(func(ev events.Event) {
+		if ev.Type == events.AgentRecovered {
+			recovered <- ev
+		}
+	})
+
+	mgr := &mockLifecycle{status: "running"}
+	ao := NewAlwaysOn(AlwaysOnConfig{
+		Agent:         "test",
+		HealthURL:     srv.URL,
+		CheckInterval: 20 * time.Millisecond,
+		MaxFailures:   2,
+	}, emitter, quietLogger())
+	ao.EnableRestartOnDegraded(mgr, "test-svc", 3, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go ao.Start(ctx)
+
+	deadline := time.After(2 * time.Second)
+	for atomic.LoadInt32(&mgr.restartCalled) == 0 {
+		select {
+		case <-deadline:
+			t.Fatalf("timed out waiting for restart, state = %q", ao.State())
+		default:
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// The cooldown holds back further restarts while still degraded.
+	time.Sleep(100 * time.Millisecond)
+	if n := atomic.LoadInt32(&mgr.restartCalled); n != 1 {
+		t.Errorf("restarts = %d during cooldown, want 1", n)
+	}
+
+	atomic.StoreInt32(&healthy, 1)
+	select {
+	case ev := <-recovered:
+		if ev.Fields["restarts"] != "1" {
+			t.Errorf("restarts field = %q, want 1", ev.Fields["restarts"])
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for recovery event")
+	}
+	if s := ao.State(); s != "ready" {
+		t.Errorf("state = %q, want ready", s)
+	}
+}
+
+func TestAlwaysOnRestartOnDegradedExhausted(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(500)
+	}))
+	defer srv.Close()
+
+	emitter := events.NewEmitter(quietLogger())
+	var exhausted int32
+	emitter.OnEvent(func(ev events.Event) {
+		if ev.Type == events.RestartExhausted {
+			atomic.AddInt32(&exhausted, 1)
+		}
+	})
+
+	mgr := &mockLifecycle{status: "running"}
+	ao := NewAlwaysOn(AlwaysOnConfig{
+		Agent:         "test",
+		HealthURL:     srv.URL,
+		CheckInterval: 10 * time.Millisecond,
+		MaxFailures:   1,
+	}, emitter, quietLogger())
+	ao.EnableRestartOnDegraded(mgr, "test-svc", 2, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go ao.Start(ctx)
+
+	time.Sleep(300 * time.Millisecond)
+	if n := atomic.LoadInt32(&mgr.restartCalled); n != 2 {
+		t.Errorf("restarts = %d, want 2", n)
+	}
+	if n := atomic.LoadInt32(&exhausted); n != 1 {
+		t.Errorf("restart.exhausted emitted %d times, want 1", n)
+	}
+	if s := ao.State(); s != "degraded" {
+		t.Errorf("state = %q, want degraded", s)
+	}
+}
+
+func TestAlwaysOnRestartOnDegradedReconfigured(t *testing.T) {
+	mgr := &mockLifecycle{status: "running"}
+	ao := NewAlwaysOn(AlwaysOnConfig{Agent: "test", MaxFailures: 1}, events.NewEmitter(quietLogger()), quietLogger())
+	ao.EnableRestartOnDegraded(mgr, "test-svc", 3, 0)
+	ao.mu.Lock()
+	ao.state = "degraded"
+	ao.mu.Unlock()
+
+	// A reload that drops restart_on_degraded stops further restarts.
+	ao.EnableRestartOnDegraded(nil, "", 0, 0)
+	ao.remediate(context.Background())
+	if n := atomic.LoadInt32(&mgr.restartCalled); n != 0 {
+		t.Fatalf("restarts = %d with remediation turned off, want 0", n)
+	}
+
+	ao.EnableRestartOnDegraded(mgr, "test-svc", 3, 0)
+	ao.remediate(context.Background())
+	if n := atomic.LoadInt32(&mgr.restartCalled); n != 1 {
+		t.Errorf("restarts = %d after turning remediation back on, want 1", n)
+	}
+}
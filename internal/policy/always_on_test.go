@@ -10,6 +10,7 @@ import (
 	"testing"
 	"time"
 
+	"warren/internal/clock"
 	"warren/internal/events"
 )
 
@@ -31,11 +32,13 @@ func TestAlwaysOnStartingToReady(t *testing.T) {
 		}
 	})
 
+	clk := clock.NewFake(time.Now())
 	ao := NewAlwaysOn(AlwaysOnConfig{
 		Agent:         "test",
 		HealthURL:     srv.URL,
-		CheckInterval: 50 * time.Millisecond,
+		CheckInterval: 10 * time.Second,
 		MaxFailures:   3,
+		Clock:         clk,
 	}, emitter, quietLogger())
 
 	if ao.State() != "starting" {
@@ -46,16 +49,7 @@ func TestAlwaysOnStartingToReady(t *testing.T) {
 	go ao.Start(ctx)
 	defer cancel()
 
-	// Wait for ready
-	deadline := time.After(2 * time.Second)
-	for ao.State() != "ready" {
-		select {
-		case <-deadline:
-			t.Fatal("timed out waiting for ready")
-		default:
-			time.Sleep(10 * time.Millisecond)
-		}
-	}
+	advanceUntil(t, clk, ao, "ready", time.Second)
 
 	if atomic.LoadInt32(&readyCount) < 1 {
 		t.Error("expected AgentReady event")
@@ -82,34 +76,24 @@ func TestAlwaysOnReadyToDegraded(t *testing.T) {
 		}
 	})
 
+	clk := clock.NewFake(time.Now())
 	ao := NewAlwaysOn(AlwaysOnConfig{
 		Agent:         "test",
 		HealthURL:     srv.URL,
-		CheckInterval: 50 * time.Millisecond,
+		CheckInterval: 10 * time.Second,
 		MaxFailures:   2,
+		Clock:         clk,
 	}, emitter, quietLogger())
 
 	ctx, cancel := context.WithCancel(context.Background())
 	go ao.Start(ctx)
 	defer cancel()
 
-	// Wait for ready
-	for ao.State() != "ready" {
-		time.Sleep(10 * time.Millisecond)
-	}
+	advanceUntil(t, clk, ao, "ready", time.Second)
 
-	// Make unhealthy
+	// Two failed checks, ten seconds apart, degrade it.
 	healthy.Store(false)
-
-	deadline := time.After(2 * time.Second)
-	for ao.State() != "degraded" {
-		select {
-		case <-deadline:
-			t.Fatal("timed out waiting for degraded")
-		default:
-			time.Sleep(10 * time.Millisecond)
-		}
-	}
+	advanceUntil(t, clk, ao, "degraded", time.Second)
 
 	if atomic.LoadInt32(&degradedCount) < 1 {
 		t.Error("expected AgentDegraded event")
@@ -129,11 +113,13 @@ func TestAlwaysOnDegradedToReady(t *testing.T) {
 	defer srv.Close()
 
 	emitter := events.NewEmitter(quietLogger())
+	clk := clock.NewFake(time.Now())
 	ao := NewAlwaysOn(AlwaysOnConfig{
 		Agent:         "test",
 		HealthURL:     srv.URL,
-		CheckInterval: 50 * time.Millisecond,
+		CheckInterval: 10 * time.Second,
 		MaxFailures:   2,
+		Clock:         clk,
 	}, emitter, quietLogger())
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -141,25 +127,13 @@ func TestAlwaysOnDegradedToReady(t *testing.T) {
 	defer cancel()
 
 	// Ready → degraded
-	for ao.State() != "ready" {
-		time.Sleep(10 * time.Millisecond)
-	}
+	advanceUntil(t, clk, ao, "ready", time.Second)
 	healthy.Store(false)
-	for ao.State() != "degraded" {
-		time.Sleep(10 * time.Millisecond)
-	}
+	advanceUntil(t, clk, ao, "degraded", time.Second)
 
 	// Recover
 	healthy.Store(true)
-	deadline := time.After(2 * time.Second)
-	for ao.State() != "ready" {
-		select {
-		case <-deadline:
-			t.Fatal("timed out waiting for recovery")
-		default:
-			time.Sleep(10 * time.Millisecond)
-		}
-	}
+	advanceUntil(t, clk, ao, "ready", time.Second)
 }
 
 func TestAlwaysOnReconfigure(t *testing.T) {
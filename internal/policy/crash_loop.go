@@ -0,0 +1,108 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"warren/internal/events"
+)
+
+// backoff returns the delay before the nth retry (n >= 1): the restart
+// backoff doubled per retry, capped at the max restart backoff.
+func (o *OnDemand) backoff(n int) time.Duration {
+	d := o.restartBackoff
+	for i := 1; i < n && d > 0; i++ {
+		d *= 2
+		if o.maxRestartBackoff > 0 && d >= o.maxRestartBackoff {
+			break
+		}
+	}
+	if o.maxRestartBackoff > 0 && d > o.maxRestartBackoff {
+		d = o.maxRestartBackoff
+	}
+	return d
+}
+
+// recordCrash is called when the agent fails while ready. A failure within
+// the crash window of becoming ready counts as a crash; it reports whether
+// the consecutive crashes have reached the crash loop threshold.
+func (o *OnDemand) recordCrash() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.crashLoopThreshold <= 0 {
+		return false
+	}
+	if o.clock.Since(o.readyAt) >= o.crashWindow {
+		o.crashes = 0
+		return false
+	}
+	o.crashes++
+	o.logger.Warn("agent failed shortly after becoming ready", "crashes", o.crashes, "threshold", o.crashLoopThreshold)
+	return o.crashes >= o.crashLoopThreshold
+}
+
+// clearCrashes resets the crash count once the agent has stayed healthy for
+// the crash window.
+func (o *OnDemand) clearCrashes() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.crashes == 0 || o.clock.Since(o.readyAt) < o.crashWindow {
+		return
+	}
+	o.logger.Info("agent stable, clearing crash count", "crashes", o.crashes)
+	o.crashes = 0
+}
+
+// enterCrashLoop stops the container and moves to the crashloop state, where
+// waitForBackoff restarts it after an exponentially growing delay.
+func (o *OnDemand) enterCrashLoop(ctx context.Context) {
+	o.mu.RLock()
+	crashes := o.crashes
+	o.mu.RUnlock()
+	delay := o.backoff(crashes - o.crashLoopThreshold + 1)
+
+	o.logger.Error("crash loop detected, backing off", "crashes", crashes, "backoff", delay)
+	o.stopContainer(ctx)
+	o.setState("crashloop")
+	o.emitter.Emit(events.Event{
+		Type:  events.AgentCrashLoop,
+		Agent: o.agent,
+		Fields: map[string]string{
+			"crashes": fmt.Sprintf("%d", crashes),
+			"backoff": delay.String(),
+		},
+	})
+}
+
+// waitForBackoff waits out the current crash loop backoff and starts the
+// container again. Once the restarts beyond the threshold exceed
+// maxRestartAttempts the agent is marked degraded.
+func (o *OnDemand) waitForBackoff(ctx context.Context) {
+	o.mu.RLock()
+	retry := o.crashes - o.crashLoopThreshold + 1
+	o.mu.RUnlock()
+
+	if retry > o.maxRestartAttempts {
+		o.logger.Error("crash loop restart attempts exhausted")
+		o.emitter.Emit(events.Event{Type: events.RestartExhausted, Agent: o.agent})
+		o.setState("degraded")
+		return
+	}
+
+	select {
+	case <-ctx.Done():
+		return
+	case <-o.clock.After(o.backoff(retry)):
+	}
+
+	o.logger.Info("crash loop backoff elapsed, starting container", "retry", retry)
+	if err := o.manager.Start(ctx, o.containerName); err != nil {
+		o.logger.Error("failed to start container after backoff", "error", err)
+		o.mu.Lock()
+		o.crashes++
+		o.mu.Unlock()
+		return
+	}
+	o.setState("starting")
+}
@@ -0,0 +1,131 @@
+package policy
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"warren/internal/clock"
+	"warren/internal/events"
+)
+
+func TestOnDemandCrashLoop(t *testing.T) {
+	// Healthy once, then failing: the agent crashes right after becoming ready.
+	var checks int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&checks, 1) == 1 {
+			w.WriteHeader(200)
+			return
+		}
+		w.WriteHeader(500)
+	}))
+	defer srv.Close()
+
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	emitter := events.NewEmitter(logger)
+	crashEvents := make(chan events.Event, 1)
+	emitter.OnEvent(func(ev events.Event) {
+		if ev.Type == events.AgentCrashLoop {
+			crashEvents <- ev
+		}
+	})
+
+	mgr := &mockLifecycle{status: "running"}
+	od := NewOnDemand(mgr, OnDemandConfig{
+		Agent:              "test",
+		ContainerName:      "test-svc",
+		HealthURL:          srv.URL,
+		Hostname:           "test.com",
+		CheckInterval:      50 * time.Millisecond,
+		StartupTimeout:     5 * time.Second,
+		IdleTimeout:        time.Hour,
+		MaxFailures:        2,
+		MaxRestartAttempts: 2,
+		CrashWindow:        time.Minute,
+		CrashLoopThreshold: 1,
+		RestartBackoff:     time.Hour,
+		MaxRestartBackoff:  time.Hour,
+	}, newMockActivity(), &mockWSSource{}, emitter, logger)
+	od.SetInitialState(true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go od.Start(ctx)
+
+	select {
+	case ev := <-crashEvents:
+		if ev.Fields["crashes"] != "1" || ev.Fields["backoff"] != "1h0m0s" {
+			t.Errorf("unexpected event fields: %v", ev.Fields)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for crash loop, state = %q", od.State())
+	}
+
+	if s := od.State(); s != "crashloop" {
+		t.Errorf("state = %q, want crashloop", s)
+	}
+	if atomic.LoadInt32(&mgr.stopCalled) != 1 {
+		t.Error("expected the container to be stopped during backoff")
+	}
+	if atomic.LoadInt32(&mgr.restartCalled) != 0 {
+		t.Error("expected no immediate restart in crash loop")
+	}
+}
+
+func TestOnDemandBackoff(t *testing.T) {
+	od := &OnDemand{restartBackoff: 10 * time.Second, maxRestartBackoff: time.Minute}
+	tests := []struct {
+		n    int
+		want time.Duration
+	}{
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{4, time.Minute},
+		{20, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := od.backoff(tt.n); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.n, got, tt.want)
+		}
+	}
+
+	if got := (&OnDemand{}).backoff(3); got != 0 {
+		t.Errorf("zero backoff = %v, want 0", got)
+	}
+}
+
+func TestOnDemandCrashOutsideWindowResets(t *testing.T) {
+	od := &OnDemand{clock: clock.Real, crashWindow: time.Minute, crashLoopThreshold: 2, logger: slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))}
+
+	od.readyAt = time.Now()
+	if od.recordCrash() {
+		t.Fatal("first crash should not reach threshold 2")
+	}
+
+	od.readyAt = time.Now().Add(-2 * time.Minute)
+	if od.recordCrash() || od.crashes != 0 {
+		t.Fatalf("failure outside the crash window should reset, crashes = %d", od.crashes)
+	}
+}
+
+func TestOnDemandCrashesSurviveSleep(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	od := &OnDemand{clock: clock.Real, crashWindow: time.Minute, crashLoopThreshold: 2, logger: logger, emitter: events.NewEmitter(logger)}
+
+	od.setState("ready")
+	if od.recordCrash() {
+		t.Fatal("first crash should not reach threshold 2")
+	}
+	// Sleeping between crashes must not hide a crash loop.
+	od.setState("sleeping")
+	od.setState("ready")
+	if !od.recordCrash() {
+		t.Fatalf("second crash after sleeping should reach the threshold, crashes = %d", od.crashes)
+	}
+}
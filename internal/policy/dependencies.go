@@ -0,0 +1,212 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"warren/internal/clock"
+)
+
+// DependencyRecheck is how long a dependency's sleep is deferred while an
+// agent that depends on it is awake.
+const DependencyRecheck = time.Minute
+
+// Dependencies is the graph of agents' depends_on, shared by all policies.
+// Waking an on-demand agent first wakes its dependencies and waits for them
+// to be ready, and a dependency doesn't go idle while an agent depending on
+// it is awake.
+type Dependencies struct {
+	mu       sync.RWMutex
+	policies map[string]Policy
+	needs    map[string][]string // agent → agents it depends on
+	poll     time.Duration
+	clock    clock.Clock
+	logger   *slog.Logger
+}
+
+// NewDependencies creates an empty dependency graph.
+func NewDependencies(logger *slog.Logger) *Dependencies {
+	return &Dependencies{
+		policies: make(map[string]Policy),
+		needs:    make(map[string][]string),
+		poll:     500 * time.Millisecond,
+		logger:   logger.With("component", "dependencies"),
+	}
+}
+
+// SetClock sets the time source Wake waits on; nil uses the system clock.
+// Call it before any agent wakes.
+func (d *Dependencies) SetClock(c clock.Clock) {
+	d.clock = c
+}
+
+// Set registers an agent's policy and the agents it depends on, replacing
+// any earlier registration, e.g. on reload.
+func (d *Dependencies) Set(agent string, pol Policy, dependsOn []string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.policies[agent] = pol
+	if len(dependsOn) == 0 {
+		delete(d.needs, agent)
+		return
+	}
+	d.needs[agent] = append([]string(nil), dependsOn...)
+}
+
+// Remove forgets an agent. Agents depending on it can't wake until it's
+// back.
+func (d *Dependencies) Remove(agent string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.policies, agent)
+	delete(d.needs, agent)
+}
+
+// Dependents returns the agents that depend on agent directly, sorted.
+func (d *Dependencies) Dependents(agent string) []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.dependents(agent)
+}
+
+func (d *Dependencies) dependents(agent string) []string {
+	var names []string
+	for name, needs := range d.needs {
+		for _, dep := range needs {
+			if dep == agent {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Wake wakes agent's dependencies together and waits until all of them are
+// ready, giving up after timeout or as soon as one is degraded. On-demand
+// dependencies wake their own dependencies first in turn.
+func (d *Dependencies) Wake(ctx context.Context, agent string, timeout time.Duration) error {
+	d.mu.RLock()
+	needs := d.needs[agent]
+	pols := make(map[string]Policy, len(needs))
+	for _, dep := range needs {
+		pols[dep] = d.policies[dep]
+	}
+	d.mu.RUnlock()
+	if len(needs) == 0 {
+		return nil
+	}
+
+	for _, dep := range needs {
+		if pols[dep] == nil {
+			return fmt.Errorf("dependency %s is not a known agent", dep)
+		}
+		if od, ok := pols[dep].(*OnDemand); ok && od.State() == "sleeping" {
+			d.logger.Info("waking dependency", "agent", agent, "dependency", dep)
+			od.Wake()
+		}
+	}
+
+	clk := clock.Or(d.clock)
+	deadline := clk.After(timeout)
+	ticker := clk.NewTicker(d.poll)
+	defer ticker.Stop()
+	for {
+		var waiting []string
+		for _, dep := range needs {
+			switch state := pols[dep].State(); state {
+			case "ready":
+			case "degraded", "crashloop":
+				return fmt.Errorf("dependency %s is %s", dep, state)
+			default:
+				waiting = append(waiting, dep)
+			}
+		}
+		if len(waiting) == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline:
+			return fmt.Errorf("dependencies not ready after %s: %s", timeout, strings.Join(waiting, ", "))
+		case <-ticker.C():
+		}
+	}
+}
+
+// AwakeDependents returns the agents depending on agent directly that
+// aren't asleep, sorted. Putting agent to sleep would pull it out from
+// under them.
+func (d *Dependencies) AwakeDependents(agent string) []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	var awake []string
+	for _, name := range d.dependents(agent) {
+		if pol := d.policies[name]; pol != nil && pol.State() != "sleeping" {
+			awake = append(awake, name)
+		}
+	}
+	return awake
+}
+
+// sleepDeferred keeps agent awake while an agent depending on it is.
+func (d *Dependencies) sleepDeferred(agent string) (time.Duration, string) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, name := range d.dependents(agent) {
+		if pol := d.policies[name]; pol != nil && pol.State() != "sleeping" {
+			return DependencyRecheck, fmt.Sprintf("%s depends on it and is %s", name, pol.State())
+		}
+	}
+	return 0, ""
+}
+
+// SleepOrder groups names into waves to put to sleep one after another:
+// each agent comes in a later wave than every agent depending on it,
+// directly or not. Names within a wave are sorted.
+func (d *Dependencies) SleepOrder(names []string) [][]string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	depth := make(map[string]int)
+	var visit func(name string, seen map[string]bool) int
+	visit = func(name string, seen map[string]bool) int {
+		if n, ok := depth[name]; ok {
+			return n
+		}
+		if seen[name] {
+			return 0 // a cycle, which config validation rules out
+		}
+		seen[name] = true
+		n := 0
+		for _, dependent := range d.dependents(name) {
+			n = max(n, visit(dependent, seen)+1)
+		}
+		depth[name] = n
+		return n
+	}
+
+	var waves [][]string
+	for _, name := range names {
+		n := visit(name, make(map[string]bool))
+		for len(waves) <= n {
+			waves = append(waves, nil)
+		}
+		waves[n] = append(waves[n], name)
+	}
+	order := waves[:0]
+	for _, wave := range waves {
+		if len(wave) > 0 {
+			sort.Strings(wave)
+			order = append(order, wave)
+		}
+	}
+	return order
+}
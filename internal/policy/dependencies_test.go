@@ -0,0 +1,132 @@
+package policy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"warren/internal/clock"
+	"warren/internal/events"
+)
+
+func newDependencyTest(t *testing.T, healthy *atomic.Bool) (*Dependencies, map[string]*OnDemand, *clock.Fake) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	logger := quietLogger()
+	emitter := events.NewEmitter(logger)
+	clk := clock.NewFake(time.Now())
+	deps := NewDependencies(logger)
+	deps.SetClock(clk)
+	pols := make(map[string]*OnDemand)
+	for _, name := range []string{"bot", "db"} {
+		od := NewOnDemand(&mockLifecycle{status: "exited"}, OnDemandConfig{
+			Agent:          name,
+			ContainerName:  name,
+			HealthURL:      srv.URL,
+			Hostname:       name + ".example.com",
+			CheckInterval:  time.Hour,
+			StartupTimeout: 30 * time.Second,
+			StartupProbe:   time.Second,
+			IdleTimeout:    time.Hour,
+			MaxFailures:    2,
+			Clock:          clk,
+		}, newMockActivity(), &mockWSSource{}, emitter, logger)
+		od.SetInitialState(false)
+		od.SetDependencies(deps)
+		pols[name] = od
+	}
+	deps.Set("bot", pols["bot"], []string{"db"})
+	deps.Set("db", pols["db"], nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	for _, od := range pols {
+		go od.Start(ctx)
+	}
+	return deps, pols, clk
+}
+
+func TestDependenciesWakeFirst(t *testing.T) {
+	var healthy atomic.Bool
+	healthy.Store(true)
+	deps, pols, clk := newDependencyTest(t, &healthy)
+	waitState(t, pols["bot"], "sleeping")
+
+	pols["bot"].Wake()
+	advanceUntil(t, clk, pols["bot"], "ready", 100*time.Millisecond)
+	if s := pols["db"].State(); s != "ready" {
+		t.Errorf("db state = %q, want ready before bot", s)
+	}
+
+	// db stays up while bot needs it.
+	if d, reason := pols["db"].sleepDeferred(context.Background()); d != DependencyRecheck || !strings.Contains(reason, "bot") {
+		t.Errorf("db sleep deferral = %v %q, want %v naming bot", d, reason, DependencyRecheck)
+	}
+	if d, _ := pols["bot"].sleepDeferred(context.Background()); d != 0 {
+		t.Errorf("bot sleep deferred %v, want 0", d)
+	}
+	if got := deps.AwakeDependents("db"); !reflect.DeepEqual(got, []string{"bot"}) {
+		t.Errorf("AwakeDependents(db) = %v, want [bot]", got)
+	}
+	pols["bot"].Sleep(context.Background())
+	if d, _ := pols["db"].sleepDeferred(context.Background()); d != 0 {
+		t.Errorf("db sleep deferred %v after bot slept, want 0", d)
+	}
+	if got := deps.AwakeDependents("db"); len(got) != 0 {
+		t.Errorf("AwakeDependents(db) = %v after bot slept, want none", got)
+	}
+
+	if got := deps.Dependents("db"); !reflect.DeepEqual(got, []string{"bot"}) {
+		t.Errorf("Dependents(db) = %v", got)
+	}
+}
+
+func TestDependenciesWakeFailure(t *testing.T) {
+	var healthy atomic.Bool
+	_, pols, clk := newDependencyTest(t, &healthy)
+	waitState(t, pols["bot"], "sleeping")
+
+	// db never becomes healthy, so bot gives up after its startup timeout
+	// and stays asleep.
+	pols["bot"].Wake()
+	for i := 0; ; i++ {
+		if trace, ok := pols["bot"].LastWake(); ok {
+			if trace.Outcome != "dependency_failed" {
+				t.Errorf("outcome = %q, want dependency_failed", trace.Outcome)
+			}
+			break
+		}
+		if i == 1000 {
+			t.Fatal("bot's wake never finished")
+		}
+		clk.Advance(100 * time.Millisecond)
+		time.Sleep(time.Millisecond)
+	}
+	if s := pols["bot"].State(); s != "sleeping" {
+		t.Errorf("bot state = %q, want sleeping", s)
+	}
+}
+
+func TestDependenciesSleepOrder(t *testing.T) {
+	deps := NewDependencies(quietLogger())
+	deps.Set("bot", NewUnmanaged(), []string{"api"})
+	deps.Set("api", NewUnmanaged(), []string{"db", "cache"})
+	deps.Set("worker", NewUnmanaged(), []string{"db"})
+
+	got := deps.SleepOrder([]string{"db", "cache", "bot", "worker", "api", "other"})
+	want := [][]string{{"bot", "other", "worker"}, {"api"}, {"cache", "db"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SleepOrder = %v, want %v", got, want)
+	}
+}
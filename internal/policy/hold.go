@@ -0,0 +1,29 @@
+package policy
+
+import "time"
+
+// Hold keeps the agent awake for d from now. Like a sleep guard, the hold
+// defers idle sleep, LRU eviction and max-uptime recycles; it lapses on its
+// own and a manual Sleep clears it. Hold does not wake the agent.
+func (o *OnDemand) Hold(d time.Duration) {
+	o.mu.Lock()
+	o.heldUntil = o.clock.Now().Add(d)
+	o.mu.Unlock()
+	o.logger.Info("manual hold set", "duration", d)
+}
+
+// HeldUntil returns when the agent's manual hold expires, if one is active.
+func (o *OnDemand) HeldUntil() (time.Time, bool) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	if o.heldUntil.IsZero() || !o.clock.Now().Before(o.heldUntil) {
+		return time.Time{}, false
+	}
+	return o.heldUntil, true
+}
+
+func (o *OnDemand) clearHold() {
+	o.mu.Lock()
+	o.heldUntil = time.Time{}
+	o.mu.Unlock()
+}
@@ -0,0 +1,69 @@
+package policy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOnDemandHoldDefersIdleSleep(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}))
+	defer srv.Close()
+
+	mgr := &mockLifecycle{status: "exited"}
+	od, _ := newTestOnDemand(srv.URL, mgr)
+	od.startupProbe = 20 * time.Millisecond
+	od.SetInitialState(false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go od.Start(ctx)
+
+	time.Sleep(50 * time.Millisecond)
+	od.Hold(600 * time.Millisecond)
+	od.Wake()
+	for od.State() != "ready" {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if _, ok := od.HeldUntil(); !ok {
+		t.Fatal("expected an active hold")
+	}
+
+	// Past the 200ms idle timeout, the hold keeps it awake.
+	time.Sleep(400 * time.Millisecond)
+	if s := od.State(); s != "ready" {
+		t.Fatalf("state = %q, want ready while held", s)
+	}
+
+	// Once the hold lapses the agent sleeps on its own.
+	deadline := time.After(3 * time.Second)
+	for od.State() != "sleeping" {
+		select {
+		case <-deadline:
+			t.Fatalf("timed out waiting for sleep after hold expired, state = %q", od.State())
+		default:
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+	if _, ok := od.HeldUntil(); ok {
+		t.Error("hold should have expired")
+	}
+}
+
+func TestOnDemandSleepClearsHold(t *testing.T) {
+	od, _ := newTestOnDemand("http://127.0.0.1:1/health", &mockLifecycle{status: "exited"})
+	od.setState("ready")
+	od.Hold(time.Hour)
+	if d, reason := od.sleepDeferred(context.Background()); d <= 0 || reason == "" {
+		t.Fatalf("sleepDeferred = %v %q, want deferral while held", d, reason)
+	}
+
+	od.Sleep(context.Background())
+	if _, ok := od.HeldUntil(); ok {
+		t.Error("manual sleep should clear the hold")
+	}
+}
@@ -0,0 +1,169 @@
+package policy
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"warren/internal/clock"
+	"warren/internal/container"
+	"warren/internal/events"
+)
+
+// recycleHoldMax is how long an agent may hold the recycle gate while it
+// comes back up before the next agent is let through anyway.
+const recycleHoldMax = 10 * time.Minute
+
+// RecycleGate lets one agent at a time through a forced recycle, so agents
+// that reach max_lifetime together restart one after another, each waiting
+// for the previous one to be healthy again. The zero value is ready to use;
+// a nil gate lets everyone through.
+type RecycleGate struct {
+	mu     sync.Mutex
+	holder string
+	since  time.Time
+}
+
+func (g *RecycleGate) acquire(agent string, now time.Time) bool {
+	if g == nil {
+		return true
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.holder != "" && g.holder != agent && now.Sub(g.since) < recycleHoldMax {
+		return false
+	}
+	g.holder, g.since = agent, now
+	return true
+}
+
+func (g *RecycleGate) release(agent string) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.holder == agent {
+		g.holder = ""
+	}
+}
+
+// LifetimeConfig sets up forced recycling of a long-running agent.
+type LifetimeConfig struct {
+	ContainerName string
+	Hostname      string        // whose WebSocket connections are drained first
+	MaxLifetime   time.Duration // 0 = never recycle
+	DrainTimeout  time.Duration
+	Gate          *RecycleGate // shared between agents so they recycle in turn
+}
+
+type lifetime struct {
+	cfg LifetimeConfig
+	mgr container.Lifecycle
+	ws  WSSource
+}
+
+// EnableMaxLifetime makes the policy gracefully restart the container once
+// it has been ready for cfg.MaxLifetime, to clear slow leaks. If mgr is a
+// container.Inspector, the lifetime counts from when the container started,
+// so restarting or upgrading the orchestrator doesn't reset it. Calling it
+// again, e.g. on reload, replaces the settings without resetting the clock.
+func (a *AlwaysOn) EnableMaxLifetime(mgr container.Lifecycle, ws WSSource, cfg LifetimeConfig) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if cfg.MaxLifetime <= 0 {
+		a.lifetime = nil
+		return
+	}
+	a.lifetime = &lifetime{cfg: cfg, mgr: mgr, ws: ws}
+}
+
+// recycleIfDue restarts a ready agent that has outlived its max lifetime,
+// once the gate lets it through and its WebSockets have drained.
+func (a *AlwaysOn) recycleIfDue(ctx context.Context) {
+	a.mu.Lock()
+	l := a.lifetime
+	if l == nil || a.state != "ready" || a.readySince.IsZero() {
+		a.mu.Unlock()
+		return
+	}
+	if !a.started {
+		a.mu.Unlock()
+		started, ok := containerStarted(ctx, l.mgr, l.cfg.ContainerName)
+		a.mu.Lock()
+		if ok && started.Before(a.readySince) {
+			a.readySince = started
+		}
+		a.started = true
+		if a.state != "ready" {
+			a.mu.Unlock()
+			return
+		}
+	}
+	now := a.clock.Now()
+	uptime := now.Sub(a.readySince)
+	if uptime < l.cfg.MaxLifetime || !l.cfg.Gate.acquire(a.agent, now) {
+		a.mu.Unlock()
+		return
+	}
+	a.mu.Unlock()
+
+	a.logger.Info("max lifetime reached, recycling container", "max_lifetime", l.cfg.MaxLifetime, "uptime", uptime)
+	drainWebSockets(ctx, a.clock, l.ws, l.cfg.Hostname, l.cfg.DrainTimeout, a.logger)
+	a.emitter.Emit(events.Event{
+		Type:   events.AgentRecycled,
+		Agent:  a.agent,
+		Fields: map[string]string{"max_lifetime": l.cfg.MaxLifetime.String()},
+	})
+	if err := l.mgr.Restart(ctx, l.cfg.ContainerName, 10*time.Second); err != nil {
+		// Tried again after another lifetime rather than every tick.
+		a.logger.Error("recycle restart failed", "error", err)
+		l.cfg.Gate.release(a.agent)
+		a.mu.Lock()
+		a.readySince = a.clock.Now()
+		a.mu.Unlock()
+		return
+	}
+	a.mu.Lock()
+	a.state = "starting"
+	a.readySince = time.Time{}
+	a.recycling = true
+	a.mu.Unlock()
+}
+
+// containerStarted returns when the container started, if the runtime can
+// tell.
+func containerStarted(ctx context.Context, mgr container.Lifecycle, name string) (time.Time, bool) {
+	in, ok := mgr.(container.Inspector)
+	if !ok {
+		return time.Time{}, false
+	}
+	d, err := in.Inspect(ctx, name)
+	if err != nil || d.StartedAt == nil {
+		return time.Time{}, false
+	}
+	return *d.StartedAt, true
+}
+
+// drainWebSockets waits for hostname's WebSocket connections to close, up
+// to timeout.
+func drainWebSockets(ctx context.Context, clk clock.Clock, ws WSSource, hostname string, timeout time.Duration, logger *slog.Logger) {
+	if ws == nil || ws.Count(hostname) == 0 || timeout <= 0 {
+		return
+	}
+	logger.Info("draining WebSocket connections", "active", ws.Count(hostname), "timeout", timeout)
+	deadline := clk.After(timeout)
+	ticker := clk.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for ws.Count(hostname) > 0 {
+		select {
+		case <-ctx.Done():
+			return
+		case <-deadline:
+			logger.Warn("drain timeout reached, recycling anyway", "remaining", ws.Count(hostname))
+			return
+		case <-ticker.C():
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package policy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"warren/internal/container"
+	"warren/internal/events"
+)
+
+func TestAlwaysOnMaxLifetimeRecycles(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}))
+	defer srv.Close()
+
+	emitter := events.NewEmitter(quietLogger())
+	var recycled int32
+	emitter.OnEvent(func(ev events.Event) {
+		if ev.Type == events.AgentRecycled && ev.Fields["max_lifetime"] == "100ms" {
+			atomic.AddInt32(&recycled, 1)
+		}
+	})
+
+	mgr := &mockLifecycle{status: "running"}
+	ws := &mockWSSource{count: 1}
+	ao := NewAlwaysOn(AlwaysOnConfig{
+		Agent:         "test",
+		HealthURL:     srv.URL,
+		CheckInterval: 20 * time.Millisecond,
+		MaxFailures:   2,
+	}, emitter, quietLogger())
+	ao.EnableMaxLifetime(mgr, ws, LifetimeConfig{
+		ContainerName: "test-svc",
+		Hostname:      "test.com",
+		MaxLifetime:   100 * time.Millisecond,
+		DrainTimeout:  100 * time.Millisecond,
+		Gate:          &RecycleGate{},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	start := time.Now()
+	go ao.Start(ctx)
+
+	// An open WebSocket delays the recycle by at most the drain timeout.
+	deadline := time.After(5 * time.Second)
+	for atomic.LoadInt32(&mgr.restartCalled) == 0 {
+		select {
+		case <-deadline:
+			t.Fatalf("timed out waiting for recycle, state = %q", ao.State())
+		default:
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("recycled after %v, before lifetime and drain", elapsed)
+	}
+	if atomic.LoadInt32(&recycled) != 1 {
+		t.Error("no agent.recycled event with max_lifetime")
+	}
+}
+
+// inspectedLifecycle reports when the container started.
+type inspectedLifecycle struct {
+	mockLifecycle
+	startedAt time.Time
+}
+
+func (m *inspectedLifecycle) Inspect(_ context.Context, name string) (*container.Details, error) {
+	return &container.Details{Service: name, State: "running", StartedAt: &m.startedAt}, nil
+}
+
+func TestAlwaysOnMaxLifetimeFromContainerStart(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}))
+	defer srv.Close()
+
+	// The container has been up longer than its lifetime, across an
+	// orchestrator restart, so it's recycled once it's seen ready.
+	mgr := &inspectedLifecycle{mockLifecycle: mockLifecycle{status: "running"}, startedAt: time.Now().Add(-2 * time.Hour)}
+	ao := NewAlwaysOn(AlwaysOnConfig{
+		Agent:         "test",
+		HealthURL:     srv.URL,
+		CheckInterval: 20 * time.Millisecond,
+		MaxFailures:   2,
+	}, events.NewEmitter(quietLogger()), quietLogger())
+	ao.EnableMaxLifetime(mgr, &mockWSSource{}, LifetimeConfig{
+		ContainerName: "test-svc",
+		MaxLifetime:   time.Hour,
+		Gate:          &RecycleGate{},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go ao.Start(ctx)
+
+	deadline := time.After(5 * time.Second)
+	for atomic.LoadInt32(&mgr.restartCalled) == 0 {
+		select {
+		case <-deadline:
+			t.Fatalf("container up for 2h not recycled with a 1h lifetime, state = %q", ao.State())
+		default:
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func TestRecycleGateOneAtATime(t *testing.T) {
+	var g RecycleGate
+	now := time.Now()
+	if !g.acquire("a", now) {
+		t.Fatal("empty gate refused")
+	}
+	if g.acquire("b", now) {
+		t.Fatal("second agent let through while the first recycles")
+	}
+	g.release("b") // not the holder: no effect
+	if g.acquire("b", now.Add(time.Minute)) {
+		t.Fatal("release by another agent freed the gate")
+	}
+	g.release("a")
+	if !g.acquire("b", now.Add(time.Minute)) {
+		t.Fatal("gate still shut after release")
+	}
+	// A holder that never comes back doesn't block the rest for good.
+	if !g.acquire("c", now.Add(time.Minute+recycleHoldMax)) {
+		t.Error("stuck holder kept the gate past recycleHoldMax")
+	}
+	var nilGate *RecycleGate
+	if !nilGate.acquire("a", now) {
+		t.Error("nil gate refused")
+	}
+}
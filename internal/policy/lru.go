@@ -3,7 +3,9 @@ package policy
 import (
 	"context"
 	"log/slog"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -13,6 +15,9 @@ type LRUManager struct {
 	agents   map[string]*OnDemand
 	activity ActivitySource
 	logger   *slog.Logger
+
+	running atomic.Bool // a Trigger run is in progress
+	pending atomic.Bool // a Trigger arrived since the run last checked
 }
 
 // NewLRUManager creates a new LRU eviction manager.
@@ -32,36 +37,39 @@ func (l *LRUManager) Register(name string, pol *OnDemand, hostname string) {
 }
 
 // Evict finds the least-recently-used ready on-demand agent and puts it to sleep.
+// Agents whose sleep guards defer sleep are skipped. Guards such as veto hooks
+// can take seconds, so they are only consulted for candidates in LRU order,
+// without holding the manager's lock.
 // Returns the name of the evicted agent, or empty string if none eligible.
 func (l *LRUManager) Evict(ctx context.Context) string {
+	type candidate struct {
+		name string
+		pol  *OnDemand
+		last time.Time
+	}
+	var candidates []candidate
 	l.mu.RLock()
-	defer l.mu.RUnlock()
-
-	var (
-		lruName string
-		lruTime time.Time
-		lruPol  *OnDemand
-	)
-
 	for name, pol := range l.agents {
 		if pol.State() != "ready" {
 			continue
 		}
-		last := l.activity.LastActivity(pol.hostname)
-		if lruPol == nil || last.Before(lruTime) {
-			lruName = name
-			lruTime = last
-			lruPol = pol
-		}
+		candidates = append(candidates, candidate{name, pol, l.activity.LastActivity(pol.hostname)})
 	}
+	l.mu.RUnlock()
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].last.Before(candidates[j].last) })
 
-	if lruPol == nil {
-		return ""
+	for _, c := range candidates {
+		if d, _ := c.pol.sleepDeferred(ctx); d > 0 {
+			continue
+		}
+		if c.pol.State() != "ready" {
+			continue // woke or slept while its guards ran
+		}
+		l.logger.Info("evicting least-recently-used agent", "agent", c.name, "last_activity", c.last)
+		c.pol.Sleep(ctx)
+		return c.name
 	}
-
-	l.logger.Info("evicting least-recently-used agent", "agent", lruName, "last_activity", lruTime)
-	lruPol.Sleep(ctx)
-	return lruName
+	return ""
 }
 
 // EvictIfNeeded evicts LRU agents until at most maxReady on-demand agents are awake.
@@ -83,6 +91,29 @@ func (l *LRUManager) EvictIfNeeded(ctx context.Context, maxReady int) {
 	}
 }
 
+// Trigger runs EvictIfNeeded in the background so callers, such as event
+// handlers, don't wait on sleep guards. Triggers that arrive while a run is
+// in progress are folded into one more run.
+func (l *LRUManager) Trigger(ctx context.Context, maxReady int) {
+	l.pending.Store(true)
+	if !l.running.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		for {
+			for l.pending.Swap(false) {
+				l.EvictIfNeeded(ctx, maxReady)
+			}
+			l.running.Store(false)
+			// A trigger that came in after the last run but before running
+			// was cleared found it set; pick it up here.
+			if !l.pending.Load() || !l.running.CompareAndSwap(false, true) {
+				return
+			}
+		}
+	}()
+}
+
 func (l *LRUManager) countReady() int {
 	l.mu.RLock()
 	defer l.mu.RUnlock()
@@ -112,3 +112,43 @@ func TestLRUNoEvictionUnderThreshold(t *testing.T) {
 	// No agents registered, maxReady=5 → nothing happens
 	lru.EvictIfNeeded(context.Background(), 5)
 }
+
+func TestLRUTriggerDoesNotWaitOnGuards(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	activity := newMockActivity()
+	activity.Touch("a.com")
+	time.Sleep(10 * time.Millisecond)
+	activity.Touch("b.com")
+
+	agentA := makeLRUAgent(t, "agent-a", "a.com", activity, "http://localhost:1")
+	agentB := makeLRUAgent(t, "agent-b", "b.com", activity, "http://localhost:1")
+	release := make(chan struct{})
+	agentA.SetSleepVeto(func(context.Context) (time.Duration, string) {
+		<-release
+		return 0, ""
+	})
+
+	lru := NewLRUManager(activity, logger)
+	lru.Register("agent-a", agentA, "a.com")
+	lru.Register("agent-b", agentB, "b.com")
+
+	done := make(chan struct{})
+	go func() {
+		lru.Trigger(context.Background(), 1)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Trigger blocked on the veto hook")
+	}
+
+	close(release)
+	deadline := time.Now().Add(2 * time.Second)
+	for agentA.State() == "ready" && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if agentA.State() != "sleeping" || agentB.State() != "ready" {
+		t.Errorf("states = %q, %q; want agent-a evicted once its veto allowed it", agentA.State(), agentB.State())
+	}
+}
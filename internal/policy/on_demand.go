@@ -7,6 +7,7 @@ import (
 	"sync"
 	"time"
 
+	"warren/internal/clock"
 	"warren/internal/container"
 	"warren/internal/events"
 )
@@ -22,6 +23,24 @@ type WSSource interface {
 	Count(hostname string) int64
 }
 
+// SleepGuard is consulted before an idle agent is put to sleep. Returning a
+// positive duration keeps the agent awake and re-checks after that long; the
+// reason is logged.
+type SleepGuard func(ctx context.Context) (deferFor time.Duration, reason string)
+
+// HoldUntil returns a SleepGuard that keeps the agent awake until done is
+// closed, checking again every recheck.
+func HoldUntil(done <-chan struct{}, recheck time.Duration, reason string) SleepGuard {
+	return func(context.Context) (time.Duration, string) {
+		select {
+		case <-done:
+			return 0, ""
+		default:
+			return recheck, reason
+		}
+	}
+}
+
 type OnDemandConfig struct {
 	Agent              string
 	ContainerName      string
@@ -31,14 +50,42 @@ type OnDemandConfig struct {
 	StartupTimeout     time.Duration
 	IdleTimeout        time.Duration
 	WakeCooldown       time.Duration
+	MaxUptime          time.Duration // 0 = no forced recycle
+	DrainTimeout       time.Duration // max wait for WebSockets to close before a recycle
 	MaxFailures        int
 	MaxRestartAttempts int
+	CrashWindow        time.Duration // failing within this long of ready counts as a crash
+	CrashLoopThreshold int           // consecutive crashes before entering crashloop; 0 disables
+	RestartBackoff     time.Duration // initial delay between restarts, doubled per attempt
+	MaxRestartBackoff  time.Duration
+	StartupProbe       time.Duration // first health probe delay during wake, doubled per miss; 0 = fixed 2s
+	StartupProbeMax    time.Duration
+	TCPPrecheck        bool // dial the health port before each HTTP probe during wake
+	PredictiveWake     bool          // wake ahead of historically busy hours
+	PredictiveLead     time.Duration // how far ahead of a busy hour to wake
+	ActivityMode       string        // ActivityAny (default) or ActivityAll
+	ActivitySources    []string      // default: requests and connections
+	IdleMode           string        // IdleModeStop (default) or IdleModePause
+	Wheel              *TimerWheel   // shared timers; nil uses one runtime timer per wait
+	Clock              clock.Clock   // time source; nil uses the system clock
 }
 
 type OnDemand struct {
-	agent, containerName, healthURL, hostname string
+	agent, containerName, healthURL, hostname                string
 	startupTimeout, idleTimeout, checkInterval, wakeCooldown time.Duration
-	maxFailures, maxRestartAttempts                           int
+	maxUptime, drainTimeout                                  time.Duration
+	maxFailures, maxRestartAttempts                          int
+	crashWindow, restartBackoff, maxRestartBackoff           time.Duration
+	crashLoopThreshold                                       int
+	startupProbe, startupProbeMax                            time.Duration
+	tcpPrecheck                                              bool
+	predictor                                                *WakePredictor // nil unless predictive wake is on
+	predictiveLead, predictCheck                             time.Duration
+	activityMode                                             string
+	activitySources                                          []string
+	idleMode                                                 string
+	wheel                                                    *TimerWheel
+	clock                                                    clock.Clock
 
 	manager  container.Lifecycle
 	activity ActivitySource
@@ -46,10 +93,23 @@ type OnDemand struct {
 	emitter  *events.Emitter
 
 	mu            sync.RWMutex
-	state         string        // "sleeping", "starting", "ready", "degraded"
+	state         string        // "sleeping", "starting", "ready", "degraded", "crashloop"
 	initialState  *bool         // set by SetInitialState before Start
 	lastSleepTime time.Time     // tracks when agent last went to sleep
 	wakeCh        chan struct{} // buffered(1), signals wake request
+	guards        []SleepGuard
+	veto          SleepGuard
+	heldUntil     time.Time // manual hold from Hold; zero if none
+	paused        bool      // sleeping with the container paused, not stopped
+	signals       map[string]ActivitySignal
+	wakeRequested time.Time   // when the pending wake signal was sent
+	wake          *wakeTracer // wake in progress, nil otherwise
+	lastWake      *WakeTrace
+	readyAt       time.Time // when the agent last became ready
+	crashes       int       // consecutive crashes, reset only once healthy past the crash window, not by sleeping
+	budget        wakeBudget
+	budgetStore   *BudgetStore  // nil keeps the budget's count in memory only
+	deps          *Dependencies // nil without depends_on support
 
 	// OnReady is called after the agent becomes ready. Used for briefing injection.
 	OnReady func(ctx context.Context, agentID string, lastSleepTime time.Time)
@@ -58,7 +118,7 @@ type OnDemand struct {
 }
 
 func NewOnDemand(mgr container.Lifecycle, cfg OnDemandConfig, activity ActivitySource, ws WSSource, emitter *events.Emitter, logger *slog.Logger) *OnDemand {
-	return &OnDemand{
+	o := &OnDemand{
 		agent:              cfg.Agent,
 		containerName:      cfg.ContainerName,
 		healthURL:          cfg.HealthURL,
@@ -67,8 +127,24 @@ func NewOnDemand(mgr container.Lifecycle, cfg OnDemandConfig, activity ActivityS
 		idleTimeout:        cfg.IdleTimeout,
 		checkInterval:      cfg.CheckInterval,
 		wakeCooldown:       cfg.WakeCooldown,
+		maxUptime:          cfg.MaxUptime,
+		drainTimeout:       cfg.DrainTimeout,
 		maxFailures:        cfg.MaxFailures,
 		maxRestartAttempts: cfg.MaxRestartAttempts,
+		crashWindow:        cfg.CrashWindow,
+		crashLoopThreshold: cfg.CrashLoopThreshold,
+		restartBackoff:     cfg.RestartBackoff,
+		maxRestartBackoff:  cfg.MaxRestartBackoff,
+		startupProbe:       cfg.StartupProbe,
+		startupProbeMax:    cfg.StartupProbeMax,
+		tcpPrecheck:        cfg.TCPPrecheck,
+		predictiveLead:     cfg.PredictiveLead,
+		predictCheck:       time.Minute,
+		activityMode:       cfg.ActivityMode,
+		activitySources:    cfg.ActivitySources,
+		idleMode:           cfg.IdleMode,
+		wheel:              cfg.Wheel,
+		clock:              clock.Or(cfg.Clock),
 		manager:            mgr,
 		activity:           activity,
 		ws:                 ws,
@@ -77,6 +153,20 @@ func NewOnDemand(mgr container.Lifecycle, cfg OnDemandConfig, activity ActivityS
 		wakeCh:             make(chan struct{}, 1),
 		logger:             logger.With("agent", cfg.Agent, "policy", "on-demand"),
 	}
+	if cfg.PredictiveWake {
+		o.predictor = NewWakePredictor()
+	}
+	if o.activityMode == "" {
+		o.activityMode = ActivityAny
+	}
+	if len(o.activitySources) == 0 {
+		o.activitySources = []string{SourceRequests, SourceConnections}
+	}
+	o.signals = map[string]ActivitySignal{
+		SourceRequests:    ActivitySignalFunc(activity.LastActivity),
+		SourceConnections: connectionSignal(ws, o.clock),
+	}
+	return o
 }
 
 // SetInitialState informs the policy whether the container is already running
@@ -87,6 +177,17 @@ func (o *OnDemand) SetInitialState(containerRunning bool) {
 	o.initialState = &containerRunning
 }
 
+// SetInitialPaused informs the policy that the container was found paused,
+// e.g. left frozen by a previous run, so it starts asleep and a wake
+// unpauses it.
+func (o *OnDemand) SetInitialPaused() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	running := false
+	o.initialState = &running
+	o.paused = true
+}
+
 func (o *OnDemand) Start(ctx context.Context) {
 	// Determine initial state: prefer SetInitialState if called, otherwise inspect.
 	o.mu.RLock()
@@ -110,6 +211,12 @@ func (o *OnDemand) Start(ctx context.Context) {
 		} else if status == "running" {
 			o.logger.Info("container already running on startup, verifying health")
 			o.setState("starting")
+		} else if status == "paused" {
+			o.logger.Info("container paused on startup")
+			o.mu.Lock()
+			o.paused = true
+			o.mu.Unlock()
+			o.setState("sleeping")
 		} else {
 			o.logger.Info("container not running on startup", "status", status)
 			o.setState("sleeping")
@@ -127,6 +234,8 @@ func (o *OnDemand) Start(ctx context.Context) {
 			o.waitForReady(ctx)
 		case "ready":
 			o.waitForIdle(ctx)
+		case "crashloop":
+			o.waitForBackoff(ctx)
 		case "degraded":
 			// Stay degraded until context cancelled; Swarm handles recovery.
 			<-ctx.Done()
@@ -142,6 +251,19 @@ func (o *OnDemand) State() string {
 }
 
 func (o *OnDemand) OnRequest() {
+	o.requestWake(false)
+}
+
+// Wake manually triggers a wake signal for this on-demand agent. Unlike a
+// request, it isn't refused by the wake budget.
+func (o *OnDemand) Wake() {
+	o.requestWake(true)
+}
+
+func (o *OnDemand) requestWake(manual bool) {
+	if o.predictor != nil {
+		o.predictor.Record(o.clock.Now())
+	}
 	if o.State() == "sleeping" {
 		// Enforce wake cooldown to prevent rapid wake/sleep cycling.
 		o.mu.RLock()
@@ -149,50 +271,120 @@ func (o *OnDemand) OnRequest() {
 		cooldown := o.wakeCooldown
 		o.mu.RUnlock()
 
-		if cooldown > 0 && !lastSleep.IsZero() && time.Since(lastSleep) < cooldown {
-			o.logger.Info("wake request ignored: cooldown active", "remaining", cooldown-time.Since(lastSleep))
+		if cooldown > 0 && !lastSleep.IsZero() && o.clock.Since(lastSleep) < cooldown {
+			o.logger.Info("wake request ignored: cooldown active", "remaining", cooldown-o.clock.Since(lastSleep))
+			return
+		}
+		if !manual && o.wakeBlocked() {
 			return
 		}
 
 		select {
 		case o.wakeCh <- struct{}{}:
+			o.mu.Lock()
+			o.wakeRequested = o.clock.Now()
+			o.mu.Unlock()
 		default: // already waking
 		}
 	}
 }
 
-// Wake manually triggers a wake signal for this on-demand agent.
-func (o *OnDemand) Wake() {
-	o.OnRequest()
-}
-
 // Sleep manually puts the agent to sleep by stopping the container.
 func (o *OnDemand) Sleep(ctx context.Context) {
 	if o.State() != "ready" && o.State() != "degraded" {
 		return
 	}
 	o.logger.Info("manual sleep requested")
+	o.clearHold()
 	o.stopContainer(ctx)
 	o.setState("sleeping")
 }
 
+// AddSleepGuard registers a guard that can defer idle sleep and LRU eviction.
+func (o *OnDemand) AddSleepGuard(g SleepGuard) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.guards = append(o.guards, g)
+}
+
+// SetSleepVeto replaces the agent's sleep veto hook, which runs after the
+// other sleep guards. A nil guard removes it.
+func (o *OnDemand) SetSleepVeto(g SleepGuard) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.veto = g
+}
+
+// SetDependencies makes the agent wake its dependencies in deps before
+// itself, and stay awake while agents depending on it are.
+func (o *OnDemand) SetDependencies(deps *Dependencies) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.deps = deps
+}
+
+// sleepDeferred checks the manual hold and dependents, then runs the sleep
+// guards and the veto hook and returns the first positive deferral.
+func (o *OnDemand) sleepDeferred(ctx context.Context) (time.Duration, string) {
+	if until, ok := o.HeldUntil(); ok {
+		return o.clock.Until(until), "held awake manually"
+	}
+	o.mu.RLock()
+	guards, deps := o.guards, o.deps
+	if o.veto != nil {
+		guards = append(guards[:len(guards):len(guards)], o.veto)
+	}
+	o.mu.RUnlock()
+	if deps != nil {
+		if d, reason := deps.sleepDeferred(o.agent); d > 0 {
+			return d, reason
+		}
+	}
+	for _, g := range guards {
+		if d, reason := g(ctx); d > 0 {
+			return d, reason
+		}
+	}
+	return 0, ""
+}
+
 // Reconfigure updates runtime parameters that can change safely.
-func (o *OnDemand) Reconfigure(idleTimeout, checkInterval time.Duration, maxFailures, maxRestartAttempts int) {
+// A changed maxUptime applies from the next time the agent becomes ready.
+func (o *OnDemand) Reconfigure(idleTimeout, checkInterval, maxUptime time.Duration, maxFailures, maxRestartAttempts int) {
 	o.mu.Lock()
 	defer o.mu.Unlock()
 	o.idleTimeout = idleTimeout
 	o.checkInterval = checkInterval
+	o.maxUptime = maxUptime
 	o.maxFailures = maxFailures
 	o.maxRestartAttempts = maxRestartAttempts
-	o.logger.Info("reconfigured", "idle_timeout", idleTimeout, "check_interval", checkInterval, "max_failures", maxFailures, "max_restart_attempts", maxRestartAttempts)
+	o.logger.Info("reconfigured", "idle_timeout", idleTimeout, "check_interval", checkInterval, "max_uptime", maxUptime, "max_failures", maxFailures, "max_restart_attempts", maxRestartAttempts)
+}
+
+// SetHealthURL changes the URL health checks probe, from the next check.
+func (o *OnDemand) SetHealthURL(url string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.healthURL = url
+	o.logger.Info("health url changed", "health_url", url)
+}
+
+// health returns the URL health checks probe.
+func (o *OnDemand) health() string {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.healthURL
 }
 
 func (o *OnDemand) setState(s string) {
 	o.mu.Lock()
 	prev := o.state
 	o.state = s
-	if s == "sleeping" {
-		o.lastSleepTime = time.Now()
+	switch s {
+	case "sleeping":
+		o.lastSleepTime = o.clock.Now()
+	case "ready":
+		o.readyAt = o.clock.Now()
 	}
 	o.mu.Unlock()
 
@@ -215,16 +407,72 @@ func (o *OnDemand) setState(s string) {
 // waitForWake blocks until a wake signal arrives, then starts the container.
 func (o *OnDemand) waitForWake(ctx context.Context) {
 	o.logger.Info("waiting for wake signal")
-	select {
-	case <-ctx.Done():
-		return
-	case <-o.wakeCh:
-		o.logger.Info("wake signal received, starting container")
-		o.emitter.Emit(events.Event{Type: events.AgentWake, Agent: o.agent})
+
+	// Predictive wake checks history periodically. Otherwise a sleeping
+	// agent has no timers at all and just waits for a wake signal.
+	var predict *policyTimer
+	if o.predictor != nil {
+		predict = newPolicyTimer(o.wheel, o.clock, o.predictCheck)
+		defer predict.Stop()
+	}
+
+wait:
+	for {
+		var predictC <-chan time.Time // nil never fires
+		if predict != nil {
+			predictC = predict.C
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-o.wakeCh:
+			o.logger.Info("wake signal received, starting container")
+			o.emitter.Emit(events.Event{Type: events.AgentWake, Agent: o.agent})
+			break wait
+		case now := <-predictC:
+			if !o.predictor.Due(now, o.predictiveLead) || o.wakeBlocked() {
+				predict.Reset(o.predictCheck)
+				continue
+			}
+			o.logger.Info("busy hour ahead, waking predictively", "lead", o.predictiveLead)
+			o.emitter.Emit(events.Event{Type: events.AgentWake, Agent: o.agent, Fields: map[string]string{"trigger": "predictive"}})
+			break wait
+		}
+	}
+
+	o.countWake()
+	now := o.clock.Now()
+	o.mu.Lock()
+	triggered := o.wakeRequested
+	o.wakeRequested = time.Time{}
+	if triggered.IsZero() {
+		triggered = now
+	}
+	o.wake = &wakeTracer{triggered: triggered, startCalled: now}
+	deps := o.deps
+	o.mu.Unlock()
+
+	if deps != nil {
+		if err := deps.Wake(ctx, o.agent, o.startupTimeout); err != nil {
+			o.logger.Error("dependencies not ready, staying asleep", "error", err)
+			o.endWake("dependency_failed")
+			return
+		}
+		o.mu.Lock()
+		o.wake.startCalled = o.clock.Now()
+		o.mu.Unlock()
 	}
 
-	if err := o.manager.Start(ctx, o.containerName); err != nil {
+	var err error
+	if !o.resume(ctx) {
+		err = o.manager.Start(ctx, o.containerName)
+	}
+	o.mu.Lock()
+	o.wake.startReturned = o.clock.Now()
+	o.mu.Unlock()
+	if err != nil {
 		o.logger.Error("failed to start container", "error", err)
+		o.endWake("start_failed")
 		// Stay sleeping — next wake request will retry.
 		return
 	}
@@ -233,11 +481,18 @@ func (o *OnDemand) waitForWake(ctx context.Context) {
 }
 
 // waitForReady polls health until the container is ready or startup times out.
+// Probes start at the startup probe interval and back off towards the max, so
+// a fast-booting app is noticed within a few hundred milliseconds.
 func (o *OnDemand) waitForReady(ctx context.Context) {
 	o.logger.Info("polling health, waiting for ready", "timeout", o.startupTimeout)
-	deadline := time.After(o.startupTimeout)
-	ticker := time.NewTicker(2 * time.Second)
-	defer ticker.Stop()
+	deadline := o.clock.After(o.startupTimeout)
+	interval := o.startupProbe
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+	probe := o.clock.NewTimer(interval)
+	defer probe.Stop()
+	portOpen := false
 
 	for {
 		select {
@@ -245,15 +500,40 @@ func (o *OnDemand) waitForReady(ctx context.Context) {
 			return
 		case <-deadline:
 			o.logger.Error("startup timeout exceeded, stopping container")
+			o.endWake("startup_timeout")
 			o.stopContainer(ctx)
 			o.setState("sleeping")
 			return
-		case <-ticker.C:
-			if err := container.CheckHealth(ctx, o.healthURL); err == nil {
+		case <-probe.C():
+			o.traceContainerRunning(ctx)
+			if o.tcpPrecheck {
+				if err := container.CheckTCP(ctx, o.health()); err != nil {
+					interval = o.nextProbe(interval)
+					probe.Reset(interval)
+					continue
+				}
+				if !portOpen {
+					// The app just bound its port; probe HTTP at full speed again.
+					portOpen = true
+					if o.startupProbe > 0 {
+						interval = o.startupProbe
+					}
+				}
+			}
+			if err := container.CheckHealth(ctx, o.health()); err == nil {
 				o.logger.Info("health check passed, agent ready")
+				o.mu.Lock()
+				if o.wake != nil {
+					o.wake.healthy = o.clock.Now()
+					if o.wake.running.IsZero() {
+						o.wake.running = o.wake.healthy
+					}
+				}
+				o.mu.Unlock()
 				o.setState("ready")
 				// Touch activity so idle timer starts from now.
 				o.activity.Touch(o.hostname)
+				o.endWake("ready")
 				// Run briefing hook if configured.
 				if o.OnReady != nil {
 					o.mu.RLock()
@@ -263,29 +543,61 @@ func (o *OnDemand) waitForReady(ctx context.Context) {
 				}
 				return
 			}
+			interval = o.nextProbe(interval)
+			probe.Reset(interval)
 		}
 	}
 }
 
+// nextProbe doubles the startup probe interval up to the max. Without a
+// startup probe configured the interval stays fixed.
+func (o *OnDemand) nextProbe(interval time.Duration) time.Duration {
+	if o.startupProbe <= 0 {
+		return interval
+	}
+	interval *= 2
+	if o.startupProbeMax > 0 && interval > o.startupProbeMax {
+		interval = o.startupProbeMax
+	}
+	return interval
+}
+
 // waitForIdle monitors health and idle timeout while the agent is ready.
 func (o *OnDemand) waitForIdle(ctx context.Context) {
 	o.logger.Info("agent ready, monitoring for idle", "idle_timeout", o.idleTimeout)
 
-	idleTimer := time.NewTimer(o.idleTimeout)
+	idleTimer := newPolicyTimer(o.wheel, o.clock, o.idleTimeout)
 	defer idleTimer.Stop()
 
-	healthTicker := time.NewTicker(o.checkInterval)
-	defer healthTicker.Stop()
+	healthTimer := newPolicyTimer(o.wheel, o.clock, o.checkInterval)
+	defer healthTimer.Stop()
+
+	// Forced recycle after max uptime.
+	var uptimeTimer *policyTimer
+	o.mu.RLock()
+	maxUptime := o.maxUptime
+	o.mu.RUnlock()
+	if maxUptime > 0 {
+		uptimeTimer = newPolicyTimer(o.wheel, o.clock, maxUptime)
+		defer uptimeTimer.Stop()
+	}
 
 	failures := 0
 
 	for {
+		var uptimeC <-chan time.Time // nil never fires
+		if uptimeTimer != nil {
+			uptimeC = uptimeTimer.C
+		}
 		select {
 		case <-ctx.Done():
 			return
 
-		case <-healthTicker.C:
-			if err := container.CheckHealth(ctx, o.healthURL); err != nil {
+		case <-healthTimer.C:
+			o.mu.RLock()
+			healthTimer.Reset(o.checkInterval)
+			o.mu.RUnlock()
+			if err := container.CheckHealth(ctx, o.health()); err != nil {
 				failures++
 				o.logger.Warn("health check failed while ready", "error", err, "consecutive_failures", failures)
 				o.emitter.Emit(events.Event{
@@ -298,6 +610,10 @@ func (o *OnDemand) waitForIdle(ctx context.Context) {
 				})
 
 				if failures >= o.maxFailures {
+					if o.recordCrash() {
+						o.enterCrashLoop(ctx)
+						return
+					}
 					o.logger.Warn("max failures reached, attempting restart")
 					if o.attemptRestart(ctx) {
 						o.setState("starting")
@@ -313,39 +629,96 @@ func (o *OnDemand) waitForIdle(ctx context.Context) {
 					o.logger.Info("health recovered", "previous_failures", failures)
 				}
 				failures = 0
+				o.clearCrashes()
+			}
+
+		case <-uptimeC:
+			if d, reason := o.sleepDeferred(ctx); d > 0 {
+				o.logger.Info("max uptime reached but recycle deferred", "reason", reason, "recheck", d)
+				uptimeTimer.Reset(d)
+				continue
 			}
+			o.recycle(ctx, maxUptime)
+			return
 
 		case <-idleTimer.C:
-			// Check if there are active WebSocket connections.
-			if o.ws.Count(o.hostname) > 0 {
-				o.logger.Info("idle timer fired but WebSocket connections active, resetting")
-				idleTimer.Reset(o.idleTimeout)
+			// Check the activity sources (requests and connections by default).
+			if remaining := o.idleRemaining(); remaining > 0 {
+				o.logger.Info("idle timer fired but recent activity detected, resetting", "remaining", remaining, "mode", o.activityMode)
+				idleTimer.Reset(remaining)
 				continue
 			}
 
-			// Check if there was recent activity.
-			lastActivity := o.activity.LastActivity(o.hostname)
-			if !lastActivity.IsZero() {
-				elapsed := time.Since(lastActivity)
-				if elapsed < o.idleTimeout {
-					remaining := o.idleTimeout - elapsed
-					o.logger.Info("idle timer fired but recent activity detected, resetting", "remaining", remaining)
-					idleTimer.Reset(remaining)
-					continue
-				}
+			if d, reason := o.sleepDeferred(ctx); d > 0 {
+				o.logger.Info("idle timer fired but sleep deferred", "reason", reason, "recheck", d)
+				idleTimer.Reset(d)
+				continue
 			}
 
-			o.logger.Info("idle timeout reached, stopping container")
-			o.stopContainer(ctx)
+			o.hibernate(ctx)
 			o.setState("sleeping")
 			return
 		}
 	}
 }
 
-// attemptRestart tries to restart the container, returning true on success.
+// traceContainerRunning records when the container first reports running
+// during a traced wake.
+func (o *OnDemand) traceContainerRunning(ctx context.Context) {
+	o.mu.RLock()
+	pending := o.wake != nil && o.wake.running.IsZero()
+	o.mu.RUnlock()
+	if !pending {
+		return
+	}
+	status, err := o.manager.Status(ctx, o.containerName)
+	if err != nil || status != "running" {
+		return
+	}
+	o.mu.Lock()
+	if o.wake != nil && o.wake.running.IsZero() {
+		o.wake.running = o.clock.Now()
+	}
+	o.mu.Unlock()
+}
+
+// recycle drains WebSocket connections and restarts the container after it
+// has been up for maxUptime. If the restart fails the agent is put to sleep
+// so the next request wakes a fresh container.
+func (o *OnDemand) recycle(ctx context.Context, uptime time.Duration) {
+	o.logger.Info("max uptime reached, recycling container", "max_uptime", uptime)
+	o.drain(ctx)
+	o.emitter.Emit(events.Event{
+		Type:   events.AgentRecycled,
+		Agent:  o.agent,
+		Fields: map[string]string{"max_uptime": uptime.String()},
+	})
+	if err := o.manager.Restart(ctx, o.containerName, 10*time.Second); err != nil {
+		o.logger.Error("recycle restart failed, sleeping instead", "error", err)
+		o.stopContainer(ctx)
+		o.setState("sleeping")
+		return
+	}
+	o.setState("starting")
+}
+
+// drain waits for the agent's WebSocket connections to close, up to the
+// drain timeout.
+func (o *OnDemand) drain(ctx context.Context) {
+	drainWebSockets(ctx, o.clock, o.ws, o.hostname, o.drainTimeout, o.logger)
+}
+
+// attemptRestart tries to restart the container, backing off between failed
+// attempts, returning true on success.
 func (o *OnDemand) attemptRestart(ctx context.Context) bool {
 	for attempt := 1; attempt <= o.maxRestartAttempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-ctx.Done():
+				return false
+			case <-o.clock.After(o.backoff(attempt - 1)):
+			}
+		}
 		o.logger.Info("restarting container", "attempt", attempt, "max", o.maxRestartAttempts)
 		if err := o.manager.Restart(ctx, o.containerName, 10*time.Second); err != nil {
 			o.logger.Error("restart failed", "attempt", attempt, "error", err)
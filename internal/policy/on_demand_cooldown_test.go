@@ -10,6 +10,7 @@ import (
 	"testing"
 	"time"
 
+	"warren/internal/clock"
 	"warren/internal/events"
 )
 
@@ -21,7 +22,9 @@ func TestOnDemandWakeCooldown(t *testing.T) {
 
 	logger := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
 	emitter := events.NewEmitter(logger)
+	clk := clock.NewFake(time.Now())
 	activity := newMockActivity()
+	activity.clock = clk
 	ws := &mockWSSource{}
 
 	mgr := &mockLifecycle{status: "exited"}
@@ -30,12 +33,14 @@ func TestOnDemandWakeCooldown(t *testing.T) {
 		ContainerName:      "test-svc",
 		HealthURL:          srv.URL,
 		Hostname:           "test.com",
-		CheckInterval:      50 * time.Millisecond,
-		StartupTimeout:     5 * time.Second,
-		IdleTimeout:        150 * time.Millisecond,
-		WakeCooldown:       1 * time.Second,
+		CheckInterval:      time.Minute,
+		StartupTimeout:     5 * time.Minute,
+		StartupProbe:       time.Second,
+		IdleTimeout:        time.Hour,
+		WakeCooldown:       10 * time.Minute,
 		MaxFailures:        3,
 		MaxRestartAttempts: 2,
+		Clock:              clk,
 	}, activity, ws, emitter, logger)
 	od.SetInitialState(false)
 
@@ -43,38 +48,24 @@ func TestOnDemandWakeCooldown(t *testing.T) {
 	defer cancel()
 	go od.Start(ctx)
 
-	// Wait for sleeping state — need to wait longer than cooldown since
-	// setState("sleeping") sets lastSleepTime on init
-	time.Sleep(1100 * time.Millisecond)
+	// setState("sleeping") sets lastSleepTime on init, so let the cooldown
+	// pass before the first wake.
+	for od.State() != "sleeping" {
+		time.Sleep(time.Millisecond)
+	}
+	clk.Advance(11 * time.Minute)
 
-	// Wake it up
 	od.OnRequest()
-	deadline := time.After(3 * time.Second)
-	for od.State() != "ready" {
-		select {
-		case <-deadline:
-			t.Fatalf("timed out waiting for ready, state = %q", od.State())
-		default:
-			time.Sleep(20 * time.Millisecond)
-		}
-	}
+	advanceUntil(t, clk, od, "ready", time.Second)
 
-	// Wait for idle → sleeping
-	deadline = time.After(3 * time.Second)
-	for od.State() != "sleeping" {
-		select {
-		case <-deadline:
-			t.Fatalf("timed out waiting for sleep, state = %q", od.State())
-		default:
-			time.Sleep(20 * time.Millisecond)
-		}
-	}
+	// An hour without requests puts it back to sleep.
+	advanceUntil(t, clk, od, "sleeping", time.Minute)
 
 	startCount := atomic.LoadInt32(&mgr.startCalled)
 
 	// Try to wake immediately — should be ignored due to cooldown
 	od.OnRequest()
-	time.Sleep(100 * time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
 
 	if atomic.LoadInt32(&mgr.startCalled) != startCount {
 		t.Error("wake during cooldown should not trigger container start")
@@ -83,19 +74,9 @@ func TestOnDemandWakeCooldown(t *testing.T) {
 		t.Errorf("state = %q, want sleeping (cooldown active)", od.State())
 	}
 
-	// Wait for cooldown to expire (1s total, already waited ~100ms + some overhead)
-	time.Sleep(1 * time.Second)
+	clk.Advance(10 * time.Minute)
 	od.OnRequest()
-
-	deadline = time.After(3 * time.Second)
-	for od.State() != "ready" {
-		select {
-		case <-deadline:
-			t.Fatalf("timed out waiting for ready after cooldown, state = %q", od.State())
-		default:
-			time.Sleep(20 * time.Millisecond)
-		}
-	}
+	advanceUntil(t, clk, od, "ready", time.Second)
 }
 
 func TestOnDemandNoCooldownWhenZero(t *testing.T) {
@@ -104,62 +85,24 @@ func TestOnDemandNoCooldownWhenZero(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	logger := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
-	emitter := events.NewEmitter(logger)
-	activity := newMockActivity()
-	ws := &mockWSSource{}
-
 	mgr := &mockLifecycle{status: "exited"}
-	od := NewOnDemand(mgr, OnDemandConfig{
-		Agent:              "test",
-		ContainerName:      "test-svc",
-		HealthURL:          srv.URL,
-		Hostname:           "test.com",
-		CheckInterval:      50 * time.Millisecond,
-		StartupTimeout:     5 * time.Second,
-		IdleTimeout:        150 * time.Millisecond,
-		WakeCooldown:       0, // no cooldown
-		MaxFailures:        3,
-		MaxRestartAttempts: 2,
-	}, activity, ws, emitter, logger)
+	od, clk := newFakeClockOnDemand(srv.URL, mgr, nil, OnDemandConfig{
+		WakeCooldown: 0, // no cooldown
+		MaxFailures:  3,
+	})
 	od.SetInitialState(false)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	go od.Start(ctx)
-
-	time.Sleep(50 * time.Millisecond)
+	waitState(t, od, "sleeping")
 
 	// Wake → ready → idle → sleeping → immediate wake should work
 	od.OnRequest()
-	deadline := time.After(3 * time.Second)
-	for od.State() != "ready" {
-		select {
-		case <-deadline:
-			t.Fatal("timed out waiting for ready")
-		default:
-			time.Sleep(20 * time.Millisecond)
-		}
-	}
-	deadline = time.After(3 * time.Second)
-	for od.State() != "sleeping" {
-		select {
-		case <-deadline:
-			t.Fatal("timed out waiting for sleep")
-		default:
-			time.Sleep(20 * time.Millisecond)
-		}
-	}
+	advanceUntil(t, clk, od, "ready", time.Second)
+	advanceUntil(t, clk, od, "sleeping", time.Minute)
 
 	// Immediate re-wake with zero cooldown should succeed
 	od.OnRequest()
-	deadline = time.After(3 * time.Second)
-	for od.State() != "ready" {
-		select {
-		case <-deadline:
-			t.Fatalf("timed out: zero cooldown should allow immediate re-wake, state = %q", od.State())
-		default:
-			time.Sleep(20 * time.Millisecond)
-		}
-	}
+	advanceUntil(t, clk, od, "ready", time.Second)
 }
@@ -0,0 +1,68 @@
+package policy
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"warren/internal/events"
+)
+
+func TestOnDemandMaxUptimeRecycles(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}))
+	defer srv.Close()
+
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	emitter := events.NewEmitter(logger)
+	var recycled int32
+	emitter.OnEvent(func(ev events.Event) {
+		if ev.Type == events.AgentRecycled {
+			atomic.AddInt32(&recycled, 1)
+		}
+	})
+
+	mgr := &mockLifecycle{status: "running"}
+	ws := &mockWSSource{count: 1}
+	od := NewOnDemand(mgr, OnDemandConfig{
+		Agent:              "test",
+		ContainerName:      "test-svc",
+		HealthURL:          srv.URL,
+		Hostname:           "test.com",
+		CheckInterval:      time.Hour,
+		StartupTimeout:     5 * time.Second,
+		IdleTimeout:        time.Hour,
+		MaxUptime:          100 * time.Millisecond,
+		DrainTimeout:       100 * time.Millisecond,
+		MaxFailures:        2,
+		MaxRestartAttempts: 2,
+	}, newMockActivity(), ws, emitter, logger)
+	od.SetInitialState(true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go od.Start(ctx)
+
+	// An open WebSocket delays the recycle by at most the drain timeout.
+	deadline := time.After(5 * time.Second)
+	for atomic.LoadInt32(&mgr.restartCalled) == 0 {
+		select {
+		case <-deadline:
+			t.Fatalf("timed out waiting for recycle, state = %q", od.State())
+		default:
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+	if atomic.LoadInt32(&recycled) == 0 {
+		t.Error("expected agent.recycled event")
+	}
+	if atomic.LoadInt32(&mgr.stopCalled) != 0 {
+		t.Error("recycle should restart, not stop")
+	}
+}
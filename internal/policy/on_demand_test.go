@@ -11,6 +11,7 @@ import (
 	"testing"
 	"time"
 
+	"warren/internal/clock"
 	"warren/internal/container"
 	"warren/internal/events"
 )
@@ -51,6 +52,7 @@ func (m *mockWSSource) Count(_ string) int64 { return atomic.LoadInt64(&m.count)
 type mockActivity struct {
 	mu       sync.Mutex
 	activity map[string]time.Time
+	clock    clock.Clock // nil: real time
 }
 
 func newMockActivity() *mockActivity {
@@ -58,7 +60,7 @@ func newMockActivity() *mockActivity {
 }
 func (m *mockActivity) Touch(hostname string) {
 	m.mu.Lock()
-	m.activity[hostname] = time.Now()
+	m.activity[hostname] = clock.Or(m.clock).Now()
 	m.mu.Unlock()
 }
 func (m *mockActivity) LastActivity(hostname string) time.Time {
@@ -88,6 +90,61 @@ func newTestOnDemand(healthURL string, mgr *mockLifecycle) (*OnDemand, *events.E
 	return od, emitter
 }
 
+// newFakeClockOnDemand creates an on-demand policy on a fake clock, with
+// cfg's unset fields filled in with long intervals the test advances
+// through.
+func newFakeClockOnDemand(healthURL string, mgr *mockLifecycle, ws WSSource, cfg OnDemandConfig) (*OnDemand, *clock.Fake) {
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	clk := clock.NewFake(time.Now())
+	activity := newMockActivity()
+	activity.clock = clk
+	cfg.Agent, cfg.ContainerName, cfg.Hostname, cfg.HealthURL = "test", "test-svc", "test.com", healthURL
+	cfg.Clock = clk
+	if cfg.CheckInterval == 0 {
+		cfg.CheckInterval = 10 * time.Second
+	}
+	if cfg.StartupTimeout == 0 {
+		cfg.StartupTimeout = 5 * time.Minute
+	}
+	if cfg.IdleTimeout == 0 {
+		cfg.IdleTimeout = 10 * time.Minute
+	}
+	if cfg.MaxFailures == 0 {
+		cfg.MaxFailures = 2
+	}
+	if cfg.MaxRestartAttempts == 0 {
+		cfg.MaxRestartAttempts = 2
+	}
+	if ws == nil {
+		ws = &mockWSSource{}
+	}
+	od := NewOnDemand(mgr, cfg, activity, ws, events.NewEmitter(logger), logger)
+	return od, clk
+}
+
+// advanceUntil steps clk forward until pol reports state, giving the
+// policy's goroutine a moment to react after each step.
+func advanceUntil(t *testing.T, clk *clock.Fake, pol Policy, state string, step time.Duration) {
+	t.Helper()
+	for i := 0; i < 1000; i++ {
+		if pol.State() == state {
+			return
+		}
+		clk.Advance(step)
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("state = %q after advancing %s, want %s", pol.State(), 1000*step, state)
+}
+
+// advanceFor steps clk forward by d, giving the policy's goroutine a moment
+// to react after each step.
+func advanceFor(clk *clock.Fake, d, step time.Duration) {
+	for elapsed := time.Duration(0); elapsed < d; elapsed += step {
+		clk.Advance(step)
+		time.Sleep(time.Millisecond)
+	}
+}
+
 func TestOnDemandWakeFlow(t *testing.T) {
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(200)
@@ -95,32 +152,16 @@ func TestOnDemandWakeFlow(t *testing.T) {
 	defer srv.Close()
 
 	mgr := &mockLifecycle{status: "exited"}
-	od, _ := newTestOnDemand(srv.URL, mgr)
+	od, clk := newFakeClockOnDemand(srv.URL, mgr, nil, OnDemandConfig{})
 	od.SetInitialState(false)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	go od.Start(ctx)
+	waitState(t, od, "sleeping")
 
-	// Should start sleeping
-	time.Sleep(50 * time.Millisecond)
-	if s := od.State(); s != "sleeping" {
-		t.Fatalf("state = %q, want sleeping", s)
-	}
-
-	// Wake it
 	od.OnRequest()
-
-	// Wait for ready
-	deadline := time.After(3 * time.Second)
-	for od.State() != "ready" {
-		select {
-		case <-deadline:
-			t.Fatalf("timed out, state = %q", od.State())
-		default:
-			time.Sleep(20 * time.Millisecond)
-		}
-	}
+	advanceUntil(t, clk, od, "ready", time.Second)
 
 	if atomic.LoadInt32(&mgr.startCalled) < 1 {
 		t.Error("expected Start to be called")
@@ -134,32 +175,19 @@ func TestOnDemandIdleTimeout(t *testing.T) {
 	defer srv.Close()
 
 	mgr := &mockLifecycle{status: "exited"}
-	od, _ := newTestOnDemand(srv.URL, mgr)
+	od, clk := newFakeClockOnDemand(srv.URL, mgr, nil, OnDemandConfig{})
 	od.SetInitialState(false)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	go od.Start(ctx)
+	waitState(t, od, "sleeping")
 
-	time.Sleep(50 * time.Millisecond)
 	od.OnRequest()
+	advanceUntil(t, clk, od, "ready", time.Second)
 
-	// Wait for ready
-	for od.State() != "ready" {
-		time.Sleep(20 * time.Millisecond)
-	}
-
-	// Wait for idle timeout → sleeping
-	deadline := time.After(3 * time.Second)
-	for od.State() != "sleeping" {
-		select {
-		case <-deadline:
-			t.Fatalf("timed out waiting for sleep, state = %q", od.State())
-		default:
-			time.Sleep(20 * time.Millisecond)
-		}
-	}
-
+	// Ten minutes without requests puts it back to sleep.
+	advanceUntil(t, clk, od, "sleeping", time.Minute)
 	if atomic.LoadInt32(&mgr.stopCalled) < 1 {
 		t.Error("expected Stop to be called")
 	}
@@ -171,38 +199,21 @@ func TestOnDemandWSPreventsIdleSleep(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	logger := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
-	emitter := events.NewEmitter(logger)
-	activity := newMockActivity()
-	ws := &mockWSSource{count: 1} // active WS connection
-
 	mgr := &mockLifecycle{status: "exited"}
-	od := NewOnDemand(mgr, OnDemandConfig{
-		Agent:              "test",
-		ContainerName:      "test-svc",
-		HealthURL:          srv.URL,
-		Hostname:           "test.com",
-		CheckInterval:      50 * time.Millisecond,
-		StartupTimeout:     5 * time.Second,
-		IdleTimeout:        150 * time.Millisecond,
-		MaxFailures:        3,
-		MaxRestartAttempts: 2,
-	}, activity, ws, emitter, logger)
+	ws := &mockWSSource{count: 1} // active WS connection
+	od, clk := newFakeClockOnDemand(srv.URL, mgr, ws, OnDemandConfig{MaxFailures: 3})
 	od.SetInitialState(false)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	go od.Start(ctx)
+	waitState(t, od, "sleeping")
 
-	time.Sleep(50 * time.Millisecond)
 	od.OnRequest()
+	advanceUntil(t, clk, od, "ready", time.Second)
 
-	for od.State() != "ready" {
-		time.Sleep(20 * time.Millisecond)
-	}
-
-	// Wait longer than idle timeout — should NOT sleep because WS is active
-	time.Sleep(400 * time.Millisecond)
+	// Three idle timeouts pass, but the WebSocket keeps it awake.
+	advanceFor(clk, 30*time.Minute, time.Minute)
 	if od.State() != "ready" {
 		t.Errorf("state = %q, want ready (WS should prevent sleep)", od.State())
 	}
@@ -215,47 +226,20 @@ func TestOnDemandStartupTimeout(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	logger := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
-	emitter := events.NewEmitter(logger)
-	activity := newMockActivity()
-	ws := &mockWSSource{}
-
 	mgr := &mockLifecycle{status: "exited"}
-	od := NewOnDemand(mgr, OnDemandConfig{
-		Agent:              "test",
-		ContainerName:      "test-svc",
-		HealthURL:          srv.URL,
-		Hostname:           "test.com",
-		CheckInterval:      50 * time.Millisecond,
-		StartupTimeout:     500 * time.Millisecond,
-		IdleTimeout:        30 * time.Minute,
-		MaxFailures:        3,
-		MaxRestartAttempts: 2,
-	}, activity, ws, emitter, logger)
+	od, clk := newFakeClockOnDemand(srv.URL, mgr, nil, OnDemandConfig{IdleTimeout: 30 * time.Minute, MaxFailures: 3})
 	od.SetInitialState(false)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	go od.Start(ctx)
+	waitState(t, od, "sleeping")
 
-	time.Sleep(50 * time.Millisecond)
 	od.OnRequest()
+	waitState(t, od, "starting")
 
-	// Wait for starting
-	for od.State() != "starting" {
-		time.Sleep(20 * time.Millisecond)
-	}
-
-	// Should timeout and go back to sleeping
-	deadline := time.After(3 * time.Second)
-	for od.State() != "sleeping" {
-		select {
-		case <-deadline:
-			t.Fatalf("timed out, state = %q", od.State())
-		default:
-			time.Sleep(20 * time.Millisecond)
-		}
-	}
+	// Past the five minute startup timeout it goes back to sleep.
+	advanceUntil(t, clk, od, "sleeping", 10*time.Second)
 }
 
 func TestOnDemandSetInitialStateRunning(t *testing.T) {
@@ -265,7 +249,7 @@ func TestOnDemandSetInitialStateRunning(t *testing.T) {
 	defer srv.Close()
 
 	mgr := &mockLifecycle{status: "running"}
-	od, _ := newTestOnDemand(srv.URL, mgr)
+	od, clk := newFakeClockOnDemand(srv.URL, mgr, nil, OnDemandConfig{})
 	od.SetInitialState(true) // container already running
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -273,15 +257,7 @@ func TestOnDemandSetInitialStateRunning(t *testing.T) {
 	go od.Start(ctx)
 
 	// Should go to ready without needing wake
-	deadline := time.After(3 * time.Second)
-	for od.State() != "ready" {
-		select {
-		case <-deadline:
-			t.Fatalf("timed out, state = %q", od.State())
-		default:
-			time.Sleep(20 * time.Millisecond)
-		}
-	}
+	advanceUntil(t, clk, od, "ready", time.Second)
 
 	// Start should NOT have been called (already running)
 	if atomic.LoadInt32(&mgr.startCalled) != 0 {
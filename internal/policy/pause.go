@@ -0,0 +1,68 @@
+package policy
+
+import (
+	"context"
+
+	"warren/internal/container"
+)
+
+// Idle modes for an on-demand agent.
+const (
+	IdleModeStop  = "stop"  // scale the service to 0 (default)
+	IdleModePause = "pause" // freeze the container, keeping its memory
+)
+
+// hibernate puts the idle agent to sleep using the configured idle mode. In
+// pause mode it falls back to stopping if the container can't be paused.
+func (o *OnDemand) hibernate(ctx context.Context) {
+	if o.idleMode == IdleModePause {
+		p, ok := o.manager.(container.Pauser)
+		switch {
+		case !ok:
+			o.logger.Warn("container manager can't pause, stopping instead")
+		default:
+			err := p.Pause(ctx, o.containerName)
+			if err == nil {
+				o.mu.Lock()
+				o.paused = true
+				o.mu.Unlock()
+				o.logger.Info("idle timeout reached, container paused")
+				return
+			}
+			o.logger.Warn("failed to pause container, stopping instead", "error", err)
+		}
+	}
+	o.logger.Info("idle timeout reached, stopping container")
+	o.stopContainer(ctx)
+}
+
+// resume unpauses a container frozen by hibernate. It reports false if the
+// agent wasn't paused or unpausing failed, in which case the caller should
+// start the container normally.
+func (o *OnDemand) resume(ctx context.Context) bool {
+	o.mu.Lock()
+	paused := o.paused
+	o.paused = false
+	o.mu.Unlock()
+	if !paused {
+		return false
+	}
+	p, ok := o.manager.(container.Pauser)
+	if !ok {
+		return false
+	}
+	if err := p.Unpause(ctx, o.containerName); err != nil {
+		o.logger.Warn("failed to unpause container, starting instead", "error", err)
+		return false
+	}
+	o.logger.Info("container unpaused")
+	return true
+}
+
+// Paused reports whether the sleeping agent's container is paused rather
+// than stopped.
+func (o *OnDemand) Paused() bool {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.paused
+}
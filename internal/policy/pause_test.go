@@ -0,0 +1,144 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"warren/internal/container"
+	"warren/internal/events"
+)
+
+type mockPauser struct {
+	mockLifecycle
+	pauseCalled, unpauseCalled int32
+	pauseErr                   error
+}
+
+func (m *mockPauser) Pause(context.Context, string) error {
+	atomic.AddInt32(&m.pauseCalled, 1)
+	return m.pauseErr
+}
+
+func (m *mockPauser) Unpause(context.Context, string) error {
+	atomic.AddInt32(&m.unpauseCalled, 1)
+	return nil
+}
+
+var _ container.Pauser = (*mockPauser)(nil)
+
+func newPauseTestOnDemand(t *testing.T, mgr *mockPauser) *OnDemand {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}))
+	t.Cleanup(srv.Close)
+	od := NewOnDemand(mgr, OnDemandConfig{
+		Agent:          "test",
+		ContainerName:  "test-svc",
+		HealthURL:      srv.URL,
+		Hostname:       "test.com",
+		CheckInterval:  50 * time.Millisecond,
+		StartupTimeout: 5 * time.Second,
+		StartupProbe:   20 * time.Millisecond,
+		IdleTimeout:    100 * time.Millisecond,
+		MaxFailures:    2,
+		IdleMode:       IdleModePause,
+	}, newMockActivity(), &mockWSSource{}, events.NewEmitter(quietLogger()), quietLogger())
+	od.SetInitialState(true)
+	return od
+}
+
+func waitState(t *testing.T, od *OnDemand, want string) {
+	t.Helper()
+	deadline := time.After(3 * time.Second)
+	for od.State() != want {
+		select {
+		case <-deadline:
+			t.Fatalf("timed out waiting for %q, state = %q", want, od.State())
+		default:
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func TestOnDemandPauseMode(t *testing.T) {
+	mgr := &mockPauser{mockLifecycle: mockLifecycle{status: "running"}}
+	od := newPauseTestOnDemand(t, mgr)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go od.Start(ctx)
+
+	waitState(t, od, "ready")
+	waitState(t, od, "sleeping")
+	if atomic.LoadInt32(&mgr.pauseCalled) != 1 || atomic.LoadInt32(&mgr.stopCalled) != 0 {
+		t.Fatalf("pause=%d stop=%d, want container paused not stopped", mgr.pauseCalled, mgr.stopCalled)
+	}
+	if !od.Paused() {
+		t.Error("expected Paused() while sleeping in pause mode")
+	}
+
+	od.Wake()
+	waitState(t, od, "ready")
+	if atomic.LoadInt32(&mgr.unpauseCalled) != 1 || atomic.LoadInt32(&mgr.startCalled) != 0 {
+		t.Errorf("unpause=%d start=%d, want wake by unpause", mgr.unpauseCalled, mgr.startCalled)
+	}
+	if od.Paused() {
+		t.Error("expected Paused() false after wake")
+	}
+}
+
+func TestOnDemandPauseFallsBackToStop(t *testing.T) {
+	mgr := &mockPauser{mockLifecycle: mockLifecycle{status: "running"}, pauseErr: errors.New("not on this node")}
+	od := newPauseTestOnDemand(t, mgr)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go od.Start(ctx)
+
+	waitState(t, od, "ready")
+	waitState(t, od, "sleeping")
+	if atomic.LoadInt32(&mgr.stopCalled) != 1 || od.Paused() {
+		t.Errorf("stop=%d paused=%v, want stop fallback", mgr.stopCalled, od.Paused())
+	}
+}
+
+func TestOnDemandStartsPaused(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		setup func(*OnDemand)
+	}{
+		{"discovered", func(od *OnDemand) { od.SetInitialPaused() }},
+		{"inspected", func(*OnDemand) {}}, // Status reports paused
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mgr := &mockPauser{mockLifecycle: mockLifecycle{status: "paused"}}
+			od := newPauseTestOnDemand(t, mgr)
+			od.initialState = nil
+			tc.setup(od)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go od.Start(ctx)
+
+			deadline := time.Now().Add(3 * time.Second)
+			for !od.Paused() {
+				if time.Now().After(deadline) {
+					t.Fatal("expected a container found paused to be treated as paused")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			waitState(t, od, "sleeping")
+			od.Wake()
+			waitState(t, od, "ready")
+			if atomic.LoadInt32(&mgr.unpauseCalled) != 1 || atomic.LoadInt32(&mgr.startCalled) != 0 {
+				t.Errorf("unpause=%d start=%d, want wake by unpause", mgr.unpauseCalled, mgr.startCalled)
+			}
+		})
+	}
+}
@@ -7,7 +7,8 @@ type Policy interface {
 	// It blocks until ctx is cancelled.
 	Start(ctx context.Context)
 
-	// State returns the current agent state: "sleeping", "starting", "ready", "degraded".
+	// State returns the current agent state: "sleeping", "starting", "ready", "degraded",
+	// or "crashloop" for on-demand agents backing off after repeated crashes.
 	State() string
 
 	// OnRequest is called by the proxy before forwarding a request.
@@ -0,0 +1,80 @@
+package policy
+
+import (
+	"sync"
+	"time"
+)
+
+// predictorHistory is how far back request hours are remembered: enough for
+// three weeks of weekly periodicity.
+const predictorHistory = 21 * 24 * time.Hour
+
+// WakePredictor learns which hours an agent is usually busy from request
+// arrival times. An hour counts as busy if it saw requests on at least 4 of
+// the previous 7 days (daily traffic) or on the same weekday in at least 2 of
+// the previous 3 weeks (weekly traffic). History is kept in memory only.
+type WakePredictor struct {
+	mu        sync.Mutex
+	active    map[int64]bool // UTC hour slot (unix seconds) → saw requests
+	lastWoken int64          // slot of the last predictive wake
+}
+
+// NewWakePredictor creates a predictor with no history.
+func NewWakePredictor() *WakePredictor {
+	return &WakePredictor{active: make(map[int64]bool)}
+}
+
+// Record notes a request at t.
+func (p *WakePredictor) Record(t time.Time) {
+	slot := hourSlot(t)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.active[slot] {
+		return
+	}
+	p.active[slot] = true
+	cutoff := slot - int64(predictorHistory/time.Second)
+	for s := range p.active {
+		if s < cutoff {
+			delete(p.active, s)
+		}
+	}
+}
+
+// Due reports whether the hour starting within lead of now is historically
+// busy and has not been woken for yet. A true result is only returned once
+// per hour.
+func (p *WakePredictor) Due(now time.Time, lead time.Duration) bool {
+	slot := hourSlot(now.Add(lead))
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if slot == p.lastWoken || p.active[slot] || !p.busyLocked(slot) {
+		return false
+	}
+	p.lastWoken = slot
+	return true
+}
+
+func (p *WakePredictor) busyLocked(slot int64) bool {
+	const day = int64(24 * time.Hour / time.Second)
+	daily := 0
+	for d := int64(1); d <= 7; d++ {
+		if p.active[slot-d*day] {
+			daily++
+		}
+	}
+	if daily >= 4 {
+		return true
+	}
+	weekly := 0
+	for w := int64(1); w <= 3; w++ {
+		if p.active[slot-w*7*day] {
+			weekly++
+		}
+	}
+	return weekly >= 2
+}
+
+func hourSlot(t time.Time) int64 {
+	return t.UTC().Truncate(time.Hour).Unix()
+}
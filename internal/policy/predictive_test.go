@@ -0,0 +1,91 @@
+package policy
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"warren/internal/events"
+)
+
+func TestWakePredictorDaily(t *testing.T) {
+	p := NewWakePredictor()
+	now := time.Date(2026, 3, 10, 8, 56, 0, 0, time.UTC)
+	// Requests at 9:xx on 4 of the last 7 days.
+	for _, d := range []int{1, 2, 3, 5} {
+		p.Record(time.Date(2026, 3, 10-d, 9, 15, 0, 0, time.UTC))
+	}
+
+	if p.Due(now.Add(-time.Hour), 5*time.Minute) {
+		t.Error("8:00 was never busy")
+	}
+	if !p.Due(now, 5*time.Minute) {
+		t.Fatal("expected 9:00 to be due with a 5m lead")
+	}
+	if p.Due(now.Add(time.Minute), 5*time.Minute) {
+		t.Error("expected only one predictive wake per hour")
+	}
+}
+
+func TestWakePredictorWeekly(t *testing.T) {
+	p := NewWakePredictor()
+	monday := time.Date(2026, 3, 16, 14, 0, 0, 0, time.UTC)
+	p.Record(monday.AddDate(0, 0, -7).Add(10 * time.Minute))
+	p.Record(monday.AddDate(0, 0, -14).Add(20 * time.Minute))
+
+	if !p.Due(monday.Add(-2*time.Minute), 5*time.Minute) {
+		t.Error("expected the weekly slot to be due")
+	}
+}
+
+func TestWakePredictorSkipsHoursAlreadyActive(t *testing.T) {
+	p := NewWakePredictor()
+	now := time.Date(2026, 3, 10, 9, 30, 0, 0, time.UTC)
+	for d := 1; d <= 7; d++ {
+		p.Record(now.AddDate(0, 0, -d))
+	}
+	p.Record(now) // the agent was already used this hour
+	if p.Due(now.Add(10*time.Minute), 0) {
+		t.Error("an hour that already saw requests should not trigger a wake")
+	}
+}
+
+func TestOnDemandPredictiveWake(t *testing.T) {
+	mgr := &mockLifecycle{status: "exited"}
+	od, emitter := newTestOnDemand("http://localhost:1", mgr)
+	od.predictor = NewWakePredictor()
+	od.predictCheck = 20 * time.Millisecond
+	od.predictiveLead = 5 * time.Minute
+	od.SetInitialState(false)
+
+	var predictive int32
+	emitter.OnEvent(func(ev events.Event) {
+		if ev.Type == events.AgentWake && ev.Fields["trigger"] == "predictive" {
+			atomic.AddInt32(&predictive, 1)
+		}
+	})
+
+	// Busy in the coming hour every day this week.
+	soon := time.Now().Add(5 * time.Minute)
+	for d := 1; d <= 7; d++ {
+		od.predictor.Record(soon.AddDate(0, 0, -d))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go od.Start(ctx)
+
+	deadline := time.After(2 * time.Second)
+	for atomic.LoadInt32(&mgr.startCalled) == 0 {
+		select {
+		case <-deadline:
+			t.Fatalf("timed out waiting for predictive wake, state = %q", od.State())
+		default:
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if atomic.LoadInt32(&predictive) != 1 {
+		t.Error("expected a predictive wake event")
+	}
+}
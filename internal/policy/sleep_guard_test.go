@@ -0,0 +1,87 @@
+package policy
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestOnDemandSleepGuardDefersIdleSleep(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}))
+	defer srv.Close()
+
+	mgr := &mockLifecycle{status: "exited"}
+	od, clk := newFakeClockOnDemand(srv.URL, mgr, nil, OnDemandConfig{})
+	od.SetInitialState(false)
+
+	var busy atomic.Bool
+	busy.Store(true)
+	var checks int32
+	od.AddSleepGuard(func(context.Context) (time.Duration, string) {
+		atomic.AddInt32(&checks, 1)
+		if busy.Load() {
+			return 5 * time.Minute, "busy"
+		}
+		return 0, ""
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go od.Start(ctx)
+	waitState(t, od, "sleeping")
+
+	od.OnRequest()
+	advanceUntil(t, clk, od, "ready", time.Second)
+
+	// Well past the ten minute idle timeout, the guard keeps it awake.
+	advanceFor(clk, 30*time.Minute, time.Minute)
+	if s := od.State(); s != "ready" {
+		t.Fatalf("state = %q, want ready while guard is busy", s)
+	}
+	if atomic.LoadInt32(&checks) < 2 {
+		t.Errorf("guard checked %d times, expected re-checks", checks)
+	}
+
+	busy.Store(false)
+	advanceUntil(t, clk, od, "sleeping", time.Minute)
+}
+
+func TestLRUSkipsGuardedAgents(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	activity := newMockActivity()
+	activity.Touch("a.com")
+	time.Sleep(10 * time.Millisecond)
+	activity.Touch("b.com")
+
+	agentA := makeLRUAgent(t, "agent-a", "a.com", activity, "http://localhost:1")
+	agentB := makeLRUAgent(t, "agent-b", "b.com", activity, "http://localhost:1")
+	agentA.AddSleepGuard(func(context.Context) (time.Duration, string) { return time.Minute, "job" })
+
+	lru := NewLRUManager(activity, logger)
+	lru.Register("agent-a", agentA, "a.com")
+	lru.Register("agent-b", agentB, "b.com")
+
+	if evicted := lru.Evict(context.Background()); evicted != "agent-b" {
+		t.Errorf("evicted %q, want agent-b (agent-a is guarded)", evicted)
+	}
+}
+
+func TestSetSleepVetoReplacesHook(t *testing.T) {
+	od := makeLRUAgent(t, "agent-a", "a.com", newMockActivity(), "http://localhost:1")
+
+	od.SetSleepVeto(func(context.Context) (time.Duration, string) { return time.Minute, "vetoed" })
+	if d, _ := od.sleepDeferred(context.Background()); d != time.Minute {
+		t.Fatalf("deferred %v, want 1m from the veto hook", d)
+	}
+	od.SetSleepVeto(nil)
+	if d, reason := od.sleepDeferred(context.Background()); d != 0 {
+		t.Errorf("deferred %v (%s) after removing the veto hook", d, reason)
+	}
+}
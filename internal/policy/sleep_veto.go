@@ -0,0 +1,39 @@
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+var vetoClient = &http.Client{Timeout: 5 * time.Second}
+
+// SleepVeto returns a SleepGuard that asks the agent whether it may sleep by
+// POSTing {"agent": name} to url. A 200 allows sleep; any other status
+// defers it for deferFor. If the hook can't be reached the agent is allowed
+// to sleep, so a hung or crashed agent doesn't stay awake forever.
+func SleepVeto(agent, url string, deferFor time.Duration, logger *slog.Logger) SleepGuard {
+	body, _ := json.Marshal(map[string]string{"agent": agent})
+	return func(ctx context.Context) (time.Duration, string) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			logger.Warn("sleep veto request failed, allowing sleep", "agent", agent, "error", err)
+			return 0, ""
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := vetoClient.Do(req)
+		if err != nil {
+			logger.Warn("sleep veto hook unreachable, allowing sleep", "agent", agent, "error", err)
+			return 0, ""
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			return 0, ""
+		}
+		return deferFor, fmt.Sprintf("sleep vetoed by agent (status %d)", resp.StatusCode)
+	}
+}
@@ -0,0 +1,56 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSleepVeto(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	status := http.StatusOK
+	var gotAgent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		gotAgent = body["agent"]
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	guard := SleepVeto("kai", srv.URL, 5*time.Minute, logger)
+
+	if d, _ := guard(context.Background()); d != 0 {
+		t.Errorf("200: deferred %v, want 0", d)
+	}
+	if gotAgent != "kai" {
+		t.Errorf("hook body agent = %q", gotAgent)
+	}
+
+	status = http.StatusConflict
+	if d, reason := guard(context.Background()); d != 5*time.Minute || reason == "" {
+		t.Errorf("409: got %v %q, want 5m deferral", d, reason)
+	}
+
+	unreachable := SleepVeto("kai", "http://127.0.0.1:1/veto", 5*time.Minute, logger)
+	if d, _ := unreachable(context.Background()); d != 0 {
+		t.Errorf("unreachable hook: deferred %v, want 0", d)
+	}
+}
+
+func TestHoldUntil(t *testing.T) {
+	done := make(chan struct{})
+	guard := HoldUntil(done, time.Minute, "draining")
+	if d, reason := guard(context.Background()); d != time.Minute || reason != "draining" {
+		t.Errorf("guard = %v, %q; want a one-minute hold", d, reason)
+	}
+	close(done)
+	if d, _ := guard(context.Background()); d != 0 {
+		t.Errorf("guard = %v after done, want 0", d)
+	}
+}
@@ -0,0 +1,72 @@
+package policy
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"warren/internal/events"
+)
+
+func TestOnDemandStartupProbeDetectsReadyQuickly(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}))
+	defer srv.Close()
+
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	od := NewOnDemand(&mockLifecycle{status: "running"}, OnDemandConfig{
+		Agent:              "test",
+		ContainerName:      "test-svc",
+		HealthURL:          srv.URL,
+		Hostname:           "test.com",
+		CheckInterval:      time.Hour,
+		StartupTimeout:     5 * time.Second,
+		IdleTimeout:        time.Hour,
+		MaxFailures:        2,
+		MaxRestartAttempts: 2,
+		StartupProbe:       20 * time.Millisecond,
+		StartupProbeMax:    time.Second,
+		TCPPrecheck:        true,
+	}, newMockActivity(), &mockWSSource{}, events.NewEmitter(logger), logger)
+	od.SetInitialState(true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go od.Start(ctx)
+
+	deadline := time.After(500 * time.Millisecond)
+	for od.State() != "ready" {
+		select {
+		case <-deadline:
+			t.Fatalf("not ready within 500ms, state = %q", od.State())
+		default:
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+}
+
+func TestOnDemandNextProbe(t *testing.T) {
+	od := &OnDemand{startupProbe: 250 * time.Millisecond, startupProbeMax: time.Second}
+	interval := od.startupProbe
+	var got []time.Duration
+	for i := 0; i < 4; i++ {
+		interval = od.nextProbe(interval)
+		got = append(got, interval)
+	}
+	want := []time.Duration{500 * time.Millisecond, time.Second, time.Second, time.Second}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("probe intervals = %v, want %v", got, want)
+		}
+	}
+
+	fixed := &OnDemand{}
+	if d := fixed.nextProbe(2 * time.Second); d != 2*time.Second {
+		t.Errorf("without a startup probe the interval should stay fixed, got %v", d)
+	}
+}
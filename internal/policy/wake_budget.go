@@ -0,0 +1,242 @@
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"warren/internal/events"
+)
+
+// Wake budget actions.
+const (
+	BudgetBlock = "block" // refuse wakes once the budget is spent
+	BudgetAlert = "alert" // wake anyway, emitting an event once a day
+)
+
+// wakeBudget counts an on-demand agent's cold starts per calendar day.
+type wakeBudget struct {
+	max      int
+	action   string
+	day      time.Time // midnight starting the day being counted
+	used     int
+	exceeded bool // the day's event has been emitted
+}
+
+// rollover starts a new count once now is past the counted day.
+func (b *wakeBudget) rollover(now time.Time) {
+	y, m, d := now.Date()
+	if day := time.Date(y, m, d, 0, 0, 0, 0, now.Location()); !day.Equal(b.day) {
+		b.day, b.used, b.exceeded = day, 0, false
+	}
+}
+
+// spent reports whether the budget refuses automatic wakes.
+func (b *wakeBudget) spent() bool {
+	return b.max > 0 && b.action == BudgetBlock && b.used >= b.max
+}
+
+// budgetDay is the layout of the day a stored count is for.
+const budgetDay = "2006-01-02"
+
+// budgetCount is one agent's stored count.
+type budgetCount struct {
+	Day      string `json:"day"` // local date
+	Used     int    `json:"used"`
+	Exceeded bool   `json:"exceeded,omitempty"`
+}
+
+// BudgetStore keeps agents' wake budget counts in a file, so restarting
+// the orchestrator, or rebuilding an agent on reload, doesn't hand it a
+// fresh budget halfway through the day.
+type BudgetStore struct {
+	file   string
+	logger *slog.Logger
+
+	mu     sync.Mutex
+	counts map[string]budgetCount
+}
+
+// NewBudgetStore returns a store saving to file, with the counts already
+// in it. A missing file starts empty.
+func NewBudgetStore(file string, logger *slog.Logger) (*BudgetStore, error) {
+	s := &BudgetStore{file: file, logger: logger, counts: make(map[string]budgetCount)}
+	data, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.counts); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *BudgetStore) get(agent string) (budgetCount, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.counts[agent]
+	return c, ok
+}
+
+// put records the agent's count and writes the file, replacing it
+// atomically. Counts for earlier days are dropped.
+func (s *BudgetStore) put(agent string, c budgetCount) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts[agent] = c
+	for name, other := range s.counts {
+		if other.Day < c.Day {
+			delete(s.counts, name)
+		}
+	}
+	data, err := json.MarshalIndent(s.counts, "", "  ")
+	if err != nil {
+		s.logger.Error("failed to encode wake budgets", "error", err)
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.file), ".warren-wake-budgets-*")
+	if err != nil {
+		s.logger.Error("failed to save wake budgets", "file", s.file, "error", err)
+		return
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.file)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		s.logger.Error("failed to save wake budgets", "file", s.file, "error", err)
+	}
+}
+
+// SetBudgetStore keeps the agent's wake budget count in s, picking up the
+// count it holds for today. Call it before the policy starts.
+func (o *OnDemand) SetBudgetStore(s *BudgetStore) {
+	if s == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.budgetStore = s
+	now := o.clock.Now()
+	o.budget.rollover(now)
+	if c, ok := s.get(o.agent); ok && c.Day == o.budget.day.Format(budgetDay) {
+		o.budget.used, o.budget.exceeded = c.Used, c.Exceeded
+	}
+}
+
+// saveBudget stores the day's count, for budgeted agents with a store.
+func (o *OnDemand) saveBudget() {
+	o.mu.Lock()
+	s, b := o.budgetStore, o.budget
+	o.mu.Unlock()
+	if s == nil || b.max <= 0 {
+		return
+	}
+	s.put(o.agent, budgetCount{Day: b.day.Format(budgetDay), Used: b.used, Exceeded: b.exceeded})
+}
+
+// SetWakeBudget limits the agent to max wakes a day, counted from local
+// midnight. Once they're spent, BudgetBlock leaves it asleep until the next
+// day and BudgetAlert wakes it anyway; either way one
+// agent.wake_budget_exceeded event is emitted that day. Manual wakes are
+// never refused but do count. max 0 removes the budget. Changing it, e.g.
+// on reload, keeps the day's count.
+func (o *OnDemand) SetWakeBudget(max int, action string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if action == "" {
+		action = BudgetBlock
+	}
+	o.budget.max, o.budget.action = max, action
+}
+
+// WakeBudget returns how many times the agent has woken today, its budget
+// and the action taken once it's spent. max is 0 without a budget.
+func (o *OnDemand) WakeBudget() (used, max int, action string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.budget.rollover(o.clock.Now())
+	return o.budget.used, o.budget.max, o.budget.action
+}
+
+// WakeRefused reports whether the wake budget refuses automatic wakes now,
+// and when the next day's budget starts, so the proxy can say so instead of
+// showing a splash page for a wake that isn't coming.
+func (o *OnDemand) WakeRefused() (until time.Time, refused bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	b := &o.budget
+	b.rollover(o.clock.Now())
+	if !b.spent() {
+		return time.Time{}, false
+	}
+	return b.day.AddDate(0, 0, 1), true
+}
+
+// wakeBlocked reports whether the budget refuses an automatic wake now,
+// emitting the day's event the first time it does.
+func (o *OnDemand) wakeBlocked() bool {
+	o.mu.Lock()
+	b := &o.budget
+	b.rollover(o.clock.Now())
+	if !b.spent() {
+		o.mu.Unlock()
+		return false
+	}
+	first := !b.exceeded
+	b.exceeded = true
+	used, max := b.used, b.max
+	o.mu.Unlock()
+
+	if first {
+		o.saveBudget()
+		o.logger.Warn("wake budget spent, refusing wakes until tomorrow", "max_per_day", max)
+		o.emitBudgetExceeded(used, max, BudgetBlock)
+	}
+	return true
+}
+
+// countWake records a wake against the day's budget.
+func (o *OnDemand) countWake() {
+	o.mu.Lock()
+	b := &o.budget
+	b.rollover(o.clock.Now())
+	b.used++
+	alert := b.max > 0 && b.used > b.max && !b.exceeded
+	if alert {
+		b.exceeded = true
+	}
+	used, max, action := b.used, b.max, b.action
+	o.mu.Unlock()
+	o.saveBudget()
+
+	if alert {
+		o.logger.Warn("wake budget exceeded", "wakes_today", used, "max_per_day", max)
+		o.emitBudgetExceeded(used, max, action)
+	}
+}
+
+func (o *OnDemand) emitBudgetExceeded(used, max int, action string) {
+	o.emitter.Emit(events.Event{
+		Type:  events.AgentWakeBudget,
+		Agent: o.agent,
+		Fields: map[string]string{
+			"wakes_today": strconv.Itoa(used),
+			"max_per_day": strconv.Itoa(max),
+			"action":      action,
+		},
+	})
+}
@@ -0,0 +1,172 @@
+package policy
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"warren/internal/clock"
+	"warren/internal/events"
+)
+
+func TestOnDemandWakeBudget(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}))
+	defer srv.Close()
+
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	emitter := events.NewEmitter(logger)
+	var mu sync.Mutex
+	var exceeded []events.Event
+	emitter.OnEvent(func(ev events.Event) {
+		if ev.Type == events.AgentWakeBudget {
+			mu.Lock()
+			exceeded = append(exceeded, ev)
+			mu.Unlock()
+		}
+	})
+	clk := clock.NewFake(time.Date(2026, 3, 2, 9, 0, 0, 0, time.Local))
+	activity := newMockActivity()
+	activity.clock = clk
+
+	mgr := &mockLifecycle{status: "exited"}
+	od := NewOnDemand(mgr, OnDemandConfig{
+		Agent:              "test",
+		ContainerName:      "test-svc",
+		HealthURL:          srv.URL,
+		Hostname:           "test.com",
+		CheckInterval:      time.Minute,
+		StartupTimeout:     5 * time.Minute,
+		StartupProbe:       time.Second,
+		IdleTimeout:        10 * time.Minute,
+		MaxFailures:        3,
+		MaxRestartAttempts: 2,
+		Clock:              clk,
+	}, activity, &mockWSSource{}, emitter, logger)
+	od.SetWakeBudget(2, BudgetBlock)
+	od.SetInitialState(false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go od.Start(ctx)
+	for od.State() != "sleeping" {
+		time.Sleep(time.Millisecond)
+	}
+
+	for i := 0; i < 2; i++ {
+		od.OnRequest()
+		advanceUntil(t, clk, od, "ready", time.Second)
+		advanceUntil(t, clk, od, "sleeping", time.Minute)
+	}
+	if used, max, action := od.WakeBudget(); used != 2 || max != 2 || action != BudgetBlock {
+		t.Fatalf("WakeBudget() = %d, %d, %q, want 2, 2, block", used, max, action)
+	}
+
+	// The budget is spent: requests no longer wake the agent.
+	starts := atomic.LoadInt32(&mgr.startCalled)
+	od.OnRequest()
+	od.OnRequest()
+	time.Sleep(50 * time.Millisecond)
+	if got := atomic.LoadInt32(&mgr.startCalled); got != starts {
+		t.Fatalf("container started %d more times over budget, want none", got-starts)
+	}
+	mu.Lock()
+	if len(exceeded) != 1 || exceeded[0].Fields["action"] != BudgetBlock || exceeded[0].Fields["max_per_day"] != "2" {
+		t.Errorf("budget events = %+v, want one block event", exceeded)
+	}
+	mu.Unlock()
+
+	// A manual wake goes ahead and counts.
+	od.Wake()
+	advanceUntil(t, clk, od, "ready", time.Second)
+	if used, _, _ := od.WakeBudget(); used != 3 {
+		t.Errorf("wakes today = %d after a manual wake, want 3", used)
+	}
+	advanceUntil(t, clk, od, "sleeping", time.Minute)
+
+	// The count starts over at midnight.
+	clk.Advance(24 * time.Hour)
+	if used, _, _ := od.WakeBudget(); used != 0 {
+		t.Errorf("wakes the next day = %d, want 0", used)
+	}
+	od.OnRequest()
+	advanceUntil(t, clk, od, "ready", time.Second)
+}
+
+func TestOnDemandWakeBudgetAlert(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	emitter := events.NewEmitter(logger)
+	var exceeded atomic.Int32
+	emitter.OnEvent(func(ev events.Event) {
+		if ev.Type == events.AgentWakeBudget {
+			exceeded.Add(1)
+		}
+	})
+	od := NewOnDemand(&mockLifecycle{status: "exited"}, OnDemandConfig{
+		Agent: "test",
+		Clock: clock.NewFake(time.Date(2026, 3, 2, 9, 0, 0, 0, time.Local)),
+	}, newMockActivity(), &mockWSSource{}, emitter, logger)
+	od.SetWakeBudget(1, BudgetAlert)
+
+	for i := 0; i < 3; i++ {
+		if od.wakeBlocked() {
+			t.Fatalf("wake %d blocked with action alert", i+1)
+		}
+		od.countWake()
+	}
+	if n := exceeded.Load(); n != 1 {
+		t.Errorf("got %d budget events, want 1 once the budget was exceeded", n)
+	}
+}
+
+func TestWakeBudgetStore(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	file := filepath.Join(t.TempDir(), "budgets.json")
+	clk := clock.NewFake(time.Date(2026, 3, 2, 9, 0, 0, 0, time.Local))
+	newAgent := func() *OnDemand {
+		store, err := NewBudgetStore(file, logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		od := NewOnDemand(&mockLifecycle{status: "exited"}, OnDemandConfig{Agent: "test", Clock: clk},
+			newMockActivity(), &mockWSSource{}, events.NewEmitter(logger), logger)
+		od.SetWakeBudget(2, BudgetBlock)
+		od.SetBudgetStore(store)
+		return od
+	}
+
+	od := newAgent()
+	od.countWake()
+	od.countWake()
+	if _, refused := od.WakeRefused(); !refused {
+		t.Fatal("budget spent but wakes not refused")
+	}
+
+	// A restart picks up the day's count instead of a fresh budget.
+	od = newAgent()
+	if used, _, _ := od.WakeBudget(); used != 2 {
+		t.Errorf("wakes after restart = %d, want 2", used)
+	}
+	until, refused := od.WakeRefused()
+	if want := time.Date(2026, 3, 3, 0, 0, 0, 0, time.Local); !refused || !until.Equal(want) {
+		t.Errorf("WakeRefused() = %v, %v, want %v, true", until, refused, want)
+	}
+
+	// A count from an earlier day is ignored.
+	clk.Advance(24 * time.Hour)
+	od = newAgent()
+	if used, _, _ := od.WakeBudget(); used != 0 {
+		t.Errorf("wakes the next day = %d, want 0", used)
+	}
+	if _, refused := od.WakeRefused(); refused {
+		t.Error("wakes refused on a new day")
+	}
+}
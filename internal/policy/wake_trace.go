@@ -0,0 +1,66 @@
+package policy
+
+import "time"
+
+// WakeTrace breaks down one on-demand wake into phases, to tell a slow
+// Docker scale-up apart from a slow application boot. Phase durations are in
+// milliseconds. Container start and first healthy are measured on the startup
+// probe, so their resolution is the probe interval at that point.
+type WakeTrace struct {
+	TriggeredAt      time.Time `json:"triggered_at"`
+	QueuedMs         int64     `json:"queued_ms"`          // wake trigger → start call issued, including waiting for dependencies
+	StartCallMs      int64     `json:"start_call_ms"`      // Docker scale-up API call
+	ContainerStartMs int64     `json:"container_start_ms"` // start call returned → container running
+	FirstHealthyMs   int64     `json:"first_healthy_ms"`   // container running → first passing health check
+	RouteReadyMs     int64     `json:"route_ready_ms"`     // healthy → routing traffic
+	TotalMs          int64     `json:"total_ms"`
+	Outcome          string    `json:"outcome"` // "ready", "start_failed", "startup_timeout", "dependency_failed"
+}
+
+// wakeTracer collects timestamps for the wake in progress.
+type wakeTracer struct {
+	triggered, startCalled, startReturned, running, healthy time.Time
+}
+
+func ms(from, to time.Time) int64 {
+	if from.IsZero() || to.IsZero() || to.Before(from) {
+		return 0
+	}
+	return to.Sub(from).Milliseconds()
+}
+
+// finish converts the collected timestamps into a WakeTrace.
+func (w *wakeTracer) finish(outcome string, end time.Time) WakeTrace {
+	return WakeTrace{
+		TriggeredAt:      w.triggered,
+		QueuedMs:         ms(w.triggered, w.startCalled),
+		StartCallMs:      ms(w.startCalled, w.startReturned),
+		ContainerStartMs: ms(w.startReturned, w.running),
+		FirstHealthyMs:   ms(w.running, w.healthy),
+		RouteReadyMs:     ms(w.healthy, end),
+		TotalMs:          ms(w.triggered, end),
+		Outcome:          outcome,
+	}
+}
+
+// LastWake returns the trace of the most recent wake attempt.
+func (o *OnDemand) LastWake() (WakeTrace, bool) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	if o.lastWake == nil {
+		return WakeTrace{}, false
+	}
+	return *o.lastWake, true
+}
+
+// endWake records the wake in progress as the last wake.
+func (o *OnDemand) endWake(outcome string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.wake == nil {
+		return
+	}
+	t := o.wake.finish(outcome, o.clock.Now())
+	o.lastWake = &t
+	o.wake = nil
+}
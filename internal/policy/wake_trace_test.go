@@ -0,0 +1,90 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOnDemandRecordsWakeTrace(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}))
+	defer srv.Close()
+
+	mgr := &mockLifecycle{status: "running"}
+	od, _ := newTestOnDemand(srv.URL, mgr)
+	od.SetInitialState(false)
+
+	if _, ok := od.LastWake(); ok {
+		t.Fatal("expected no wake trace before first wake")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go od.Start(ctx)
+
+	time.Sleep(50 * time.Millisecond)
+	od.OnRequest()
+
+	deadline := time.After(5 * time.Second)
+	for {
+		if _, ok := od.LastWake(); ok {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatalf("timed out waiting for wake trace, state = %q", od.State())
+		default:
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+
+	trace, _ := od.LastWake()
+	if trace.Outcome != "ready" {
+		t.Errorf("outcome = %q, want ready", trace.Outcome)
+	}
+	if trace.TriggeredAt.IsZero() {
+		t.Error("expected triggered_at")
+	}
+	// The first health poll happens after one 2s tick.
+	if trace.TotalMs < 1500 {
+		t.Errorf("total = %dms, expected at least one health poll interval", trace.TotalMs)
+	}
+	sum := trace.QueuedMs + trace.StartCallMs + trace.ContainerStartMs + trace.FirstHealthyMs + trace.RouteReadyMs
+	if sum > trace.TotalMs || trace.TotalMs-sum > 5 {
+		t.Errorf("phases sum to %dms, total %dms", sum, trace.TotalMs)
+	}
+}
+
+func TestOnDemandWakeTraceStartFailed(t *testing.T) {
+	mgr := &mockLifecycle{status: "exited", startErr: errors.New("docker unavailable")}
+	od, _ := newTestOnDemand("http://localhost:1", mgr)
+	od.SetInitialState(false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go od.Start(ctx)
+
+	time.Sleep(50 * time.Millisecond)
+	od.OnRequest()
+
+	deadline := time.After(2 * time.Second)
+	for {
+		if trace, ok := od.LastWake(); ok {
+			if trace.Outcome != "start_failed" {
+				t.Errorf("outcome = %q, want start_failed", trace.Outcome)
+			}
+			return
+		}
+		select {
+		case <-deadline:
+			t.Fatal("timed out waiting for wake trace")
+		default:
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+}
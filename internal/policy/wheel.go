@@ -0,0 +1,159 @@
+package policy
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"warren/internal/clock"
+)
+
+// TimerWheel runs the periodic timers of many policies off one goroutine.
+// With hundreds of agents, each policy's health ticks, idle timers and
+// predictive-wake checks would otherwise be separate runtime timers, each
+// waking its own goroutine. Timers on the wheel fire on its tick, so they
+// are accurate to one tick; Run must be running for any of them to fire.
+type TimerWheel struct {
+	tick  time.Duration
+	clock clock.Clock
+
+	mu    sync.Mutex
+	slots []map[*wheelTimer]struct{}
+	pos   int
+}
+
+type wheelTimer struct {
+	c      chan time.Time
+	slot   int
+	rounds int // full turns of the wheel left before firing
+}
+
+// NewTimerWheel creates a wheel advancing every tick with the given number
+// of slots. A turn of the wheel (tick × slots) should cover the common
+// timer lengths; longer timers wait out extra turns.
+func NewTimerWheel(tick time.Duration, slots int) *TimerWheel {
+	if slots < 1 {
+		slots = 1
+	}
+	w := &TimerWheel{tick: tick, slots: make([]map[*wheelTimer]struct{}, slots)}
+	for i := range w.slots {
+		w.slots[i] = make(map[*wheelTimer]struct{})
+	}
+	return w
+}
+
+// SetClock sets the time source the wheel ticks on; nil uses the system
+// clock. Call it before Run.
+func (w *TimerWheel) SetClock(c clock.Clock) {
+	w.clock = c
+}
+
+// Run advances the wheel until ctx is done.
+func (w *TimerWheel) Run(ctx context.Context) {
+	ticker := clock.Or(w.clock).NewTicker(w.tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C():
+			w.advance(now)
+		}
+	}
+}
+
+// advance moves the wheel on one tick and fires the timers that are due.
+func (w *TimerWheel) advance(now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pos = (w.pos + 1) % len(w.slots)
+	for t := range w.slots[w.pos] {
+		if t.rounds > 0 {
+			t.rounds--
+			continue
+		}
+		delete(w.slots[w.pos], t)
+		t.c <- now // buffered, and each timer fires once
+	}
+}
+
+// schedule adds a one-shot timer firing after at least d.
+func (w *TimerWheel) schedule(d time.Duration) *wheelTimer {
+	ticks := int((d + w.tick - 1) / w.tick)
+	if ticks < 1 {
+		ticks = 1
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	t := &wheelTimer{
+		c:      make(chan time.Time, 1),
+		slot:   (w.pos + ticks) % len(w.slots),
+		rounds: (ticks - 1) / len(w.slots),
+	}
+	w.slots[t.slot][t] = struct{}{}
+	return t
+}
+
+// cancel removes a timer that hasn't fired.
+func (w *TimerWheel) cancel(t *wheelTimer) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.slots[t.slot], t)
+}
+
+// Len returns the number of pending timers.
+func (w *TimerWheel) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n := 0
+	for _, s := range w.slots {
+		n += len(s)
+	}
+	return n
+}
+
+// policyTimer is a one-shot timer taken from a TimerWheel, or from the
+// policy's clock when it has no wheel. Read C afresh on every select:
+// Reset replaces it.
+type policyTimer struct {
+	C <-chan time.Time
+
+	wheel *TimerWheel
+	clock clock.Clock
+	wt    *wheelTimer
+	rt    clock.Timer
+}
+
+func newPolicyTimer(w *TimerWheel, clk clock.Clock, d time.Duration) *policyTimer {
+	t := &policyTimer{wheel: w, clock: clk}
+	t.start(d)
+	return t
+}
+
+func (t *policyTimer) start(d time.Duration) {
+	if t.wheel != nil {
+		t.wt = t.wheel.schedule(d)
+		t.C = t.wt.c
+		return
+	}
+	t.rt = t.clock.NewTimer(d)
+	t.C = t.rt.C()
+}
+
+// Reset re-arms the timer to fire after d.
+func (t *policyTimer) Reset(d time.Duration) {
+	t.Stop()
+	t.start(d)
+}
+
+// Stop cancels the timer if it hasn't fired.
+func (t *policyTimer) Stop() {
+	if t.wt != nil {
+		t.wheel.cancel(t.wt)
+		t.wt = nil
+	}
+	if t.rt != nil {
+		t.rt.Stop()
+		t.rt = nil
+	}
+}
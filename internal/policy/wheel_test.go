@@ -0,0 +1,135 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"warren/internal/clock"
+	"warren/internal/events"
+)
+
+func fired(c <-chan time.Time) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestTimerWheelFiresAfterItsTicks(t *testing.T) {
+	w := NewTimerWheel(time.Second, 4)
+	short := w.schedule(2 * time.Second)
+	long := w.schedule(10 * time.Second) // more than one turn of the wheel
+	now := time.Now()
+
+	for tick := 1; tick <= 10; tick++ {
+		w.advance(now)
+		if got, want := fired(short.c), tick == 2; got != want {
+			t.Errorf("tick %d: short fired = %v, want %v", tick, got, want)
+		}
+		if got, want := fired(long.c), tick == 10; got != want {
+			t.Errorf("tick %d: long fired = %v, want %v", tick, got, want)
+		}
+	}
+	if w.Len() != 0 {
+		t.Errorf("Len = %d after all timers fired", w.Len())
+	}
+}
+
+func TestTimerWheelCancel(t *testing.T) {
+	w := NewTimerWheel(time.Second, 4)
+	timer := newPolicyTimer(w, clock.Real, time.Second)
+	timer.Stop()
+	w.advance(time.Now())
+	if fired(timer.C) || w.Len() != 0 {
+		t.Error("stopped timer fired")
+	}
+
+	// Reset re-arms from the current position.
+	timer.Reset(2 * time.Second)
+	w.advance(time.Now())
+	if fired(timer.C) {
+		t.Error("reset timer fired early")
+	}
+	w.advance(time.Now())
+	if !fired(timer.C) {
+		t.Error("reset timer didn't fire")
+	}
+}
+
+func TestAlwaysOnOnTimerWheel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	clk := clock.NewFake(time.Now())
+	wheel := NewTimerWheel(time.Second, 16)
+	wheel.SetClock(clk)
+	go wheel.Run(ctx)
+	clk.BlockUntil(1) // the wheel's ticker
+
+	ao := NewAlwaysOn(AlwaysOnConfig{
+		Agent:         "test",
+		HealthURL:     srv.URL,
+		CheckInterval: 2 * time.Second,
+		MaxFailures:   3,
+		Wheel:         wheel,
+		Clock:         clk,
+	}, events.NewEmitter(quietLogger()), quietLogger())
+	go ao.Start(ctx)
+
+	// One tick at a time: the wheel only sees ticks it is waiting for.
+	advanceUntil(t, clk, ao, "ready", time.Second)
+}
+
+func TestSleepingAgentsHoldNoTimers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	wheel := NewTimerWheel(time.Hour, 16) // never ticks during the test
+
+	var policies []*OnDemand
+	for i := 0; i < 100; i++ {
+		od := NewOnDemand(&mockLifecycle{}, OnDemandConfig{
+			Agent:         fmt.Sprintf("agent-%d", i),
+			ContainerName: "c",
+			IdleTimeout:   time.Minute,
+			CheckInterval: time.Minute,
+			Wheel:         wheel,
+		}, newMockActivity(), &mockWSSource{}, events.NewEmitter(quietLogger()), quietLogger())
+		od.SetInitialState(false)
+		go od.Start(ctx)
+		policies = append(policies, od)
+	}
+	time.Sleep(50 * time.Millisecond)
+	for _, od := range policies {
+		if od.State() != "sleeping" {
+			t.Fatalf("%s: state = %s, want sleeping", od.agent, od.State())
+		}
+	}
+	if n := wheel.Len(); n != 0 {
+		t.Errorf("sleeping agents hold %d timers, want 0", n)
+	}
+}
+
+func BenchmarkTimerWheelSchedule(b *testing.B) {
+	w := NewTimerWheel(100*time.Millisecond, 600)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		t := newPolicyTimer(w, clock.Real, 30*time.Second)
+		t.Stop()
+	}
+}
+
+func BenchmarkRuntimeTimerSchedule(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		t := newPolicyTimer(nil, clock.Real, 30*time.Second)
+		t.Stop()
+	}
+}
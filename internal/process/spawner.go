@@ -237,7 +237,7 @@ func (s *Spawner) spawnWorker(task taskAssignment) {
 			s.logger.Info("picoclaw worker completed", "task_id", taskID)
 		}
 
-	case <-time.After(s.cfg.DefaultTimeout):
+	case <-time.After(time.Duration(s.cfg.DefaultTimeout)):
 		s.logger.Warn("picoclaw worker timed out, killing",
 			"task_id", taskID,
 			"timeout", s.cfg.DefaultTimeout,
@@ -9,6 +9,7 @@ import (
 
 	"warren/internal/config"
 	"warren/internal/hermes"
+	"warren/internal/human"
 )
 
 func TestTruncateID(t *testing.T) {
@@ -39,7 +40,7 @@ func TestSpawnerFiltersPicoClawRuntime(t *testing.T) {
 	cfg := config.PicoClawConfig{
 		Binary:         "picoclaw",
 		MissionBaseDir: t.TempDir(),
-		DefaultTimeout: 5 * time.Minute,
+		DefaultTimeout: human.Duration(5 * time.Minute),
 		MaxConcurrent:  20,
 	}
 
@@ -76,7 +77,7 @@ func TestSpawnerConcurrencyLimit(t *testing.T) {
 	cfg := config.PicoClawConfig{
 		Binary:         "picoclaw",
 		MissionBaseDir: t.TempDir(),
-		DefaultTimeout: 5 * time.Minute,
+		DefaultTimeout: human.Duration(5 * time.Minute),
 		MaxConcurrent:  2,
 	}
 
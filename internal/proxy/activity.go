@@ -3,9 +3,12 @@ package proxy
 import (
 	"sync"
 	"time"
+
+	"warren/internal/clock"
 )
 
 type ActivityTracker struct {
+	clock    clock.Clock
 	mu       sync.RWMutex
 	activity map[string]time.Time // hostname → last activity
 }
@@ -16,9 +19,31 @@ func NewActivityTracker() *ActivityTracker {
 	}
 }
 
+// SetClock sets the time source Touch records; nil uses the system clock.
+func (a *ActivityTracker) SetClock(c clock.Clock) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.clock = c
+}
+
 func (a *ActivityTracker) Touch(hostname string) {
+	a.mu.RLock()
+	clk := a.clock
+	a.mu.RUnlock()
+	a.Extend(hostname, clock.Or(clk).Now())
+}
+
+// Extend records activity at until, which may be in the future for agents
+// that report being busy, by at most maxBusyDuration. Activity never moves
+// backwards, so a later Touch does not cut a reported busy period short.
+func (a *ActivityTracker) Extend(hostname string, until time.Time) {
 	a.mu.Lock()
-	a.activity[hostname] = time.Now()
+	if max := clock.Or(a.clock).Now().Add(maxBusyDuration); until.After(max) {
+		until = max
+	}
+	if until.After(a.activity[hostname]) {
+		a.activity[hostname] = until
+	}
 	a.mu.Unlock()
 }
 
@@ -3,6 +3,8 @@ package proxy
 import (
 	"testing"
 	"time"
+
+	"warren/internal/clock"
 )
 
 func TestTouchAndLastActivity(t *testing.T) {
@@ -21,3 +23,28 @@ func TestLastActivityZeroForUnknown(t *testing.T) {
 		t.Errorf("expected zero time, got %v", last)
 	}
 }
+
+func TestTouchUsesClock(t *testing.T) {
+	clk := clock.NewFake(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC))
+	a := NewActivityTracker()
+	a.SetClock(clk)
+	a.Touch("test.com")
+	if got := a.LastActivity("test.com"); !got.Equal(clk.Now()) {
+		t.Errorf("last activity = %v, want the fake clock's %v", got, clk.Now())
+	}
+}
+
+func TestExtendCapsFutureTimestamps(t *testing.T) {
+	clk := clock.NewFake(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC))
+	a := NewActivityTracker()
+	a.SetClock(clk)
+
+	a.Extend("test.com", clk.Now().Add(time.Hour))
+	if got := a.LastActivity("test.com"); !got.Equal(clk.Now().Add(time.Hour)) {
+		t.Errorf("last activity = %v, want an hour ahead", got)
+	}
+	a.Extend("test.com", clk.Now().Add(365*24*time.Hour))
+	if got := a.LastActivity("test.com"); !got.Equal(clk.Now().Add(maxBusyDuration)) {
+		t.Errorf("last activity = %v, want capped at %v ahead", got, maxBusyDuration)
+	}
+}
@@ -0,0 +1,174 @@
+package proxy
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"warren/internal/human"
+)
+
+// maxBusyDuration caps how far ahead an agent may report itself busy, so a
+// bad timestamp can't keep a container awake indefinitely.
+const maxBusyDuration = 24 * time.Hour
+
+// activityRequest is the body of POST /api/agents/{name}/activity. An empty
+// body is a plain heartbeat.
+type activityRequest struct {
+	BusyUntil time.Time `json:"busy_until"`
+	BusyFor   string    `json:"busy_for"`
+}
+
+// HandleAgentAPI routes /api/agents/{name}/... requests made by agents
+// themselves, authenticated with the agent's own token. Intended for admin
+// mux only.
+func (p *Proxy) HandleAgentAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	rest := strings.TrimPrefix(r.URL.Path, "/api/agents/")
+	name, action, _ := strings.Cut(rest, "/")
+	if name == "" {
+		http.Error(w, `{"error":"agent name required"}`, http.StatusBadRequest)
+		return
+	}
+
+	hostnames, token := p.agentRoutes(name)
+	if len(hostnames) == 0 {
+		http.Error(w, `{"error":"agent not found"}`, http.StatusNotFound)
+		return
+	}
+	if token == "" {
+		http.Error(w, `{"error":"agent API not enabled for this agent"}`, http.StatusForbidden)
+		return
+	}
+	got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+		p.strike(r, "agent api token")
+		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && action == "activity":
+		p.handleActivity(w, r, name, hostnames)
+	case r.Method == http.MethodGet && action == "jobs":
+		_ = json.NewEncoder(w).Encode(p.jobs.List(name))
+	case r.Method == http.MethodPost && action == "jobs":
+		p.handleAddJob(w, r, name)
+	case strings.HasPrefix(action, "jobs/"):
+		id, sub, _ := strings.Cut(strings.TrimPrefix(action, "jobs/"), "/")
+		if id == "" || !(r.Method == http.MethodDelete && sub == "" || r.Method == http.MethodPost && sub == "complete") {
+			http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+			return
+		}
+		p.handleCompleteJob(w, name, id, hostnames)
+	default:
+		http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+	}
+}
+
+func (p *Proxy) handleActivity(w http.ResponseWriter, r *http.Request, name string, hostnames []string) {
+	r.Body = http.MaxBytesReader(w, r.Body, p.maxBody.Load())
+	var req activityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	until := now
+	switch {
+	case req.BusyFor != "":
+		d, err := human.ParseDuration(req.BusyFor)
+		if err != nil || d < 0 {
+			http.Error(w, `{"error":"invalid busy_for"}`, http.StatusBadRequest)
+			return
+		}
+		until = now.Add(d)
+	case !req.BusyUntil.IsZero():
+		until = req.BusyUntil
+	}
+	if until.Before(now) {
+		until = now
+	}
+	if max := now.Add(maxBusyDuration); until.After(max) {
+		until = max
+	}
+
+	for _, h := range hostnames {
+		p.activity.Extend(h, until)
+	}
+	p.logger.Debug("agent reported activity", "agent", name, "until", until)
+	_ = json.NewEncoder(w).Encode(map[string]any{"agent": name, "busy_until": until})
+}
+
+// jobRequest is the body of POST /api/agents/{name}/jobs.
+type jobRequest struct {
+	ID          string `json:"id"`
+	Description string `json:"description"`
+	TTL         string `json:"ttl"`
+}
+
+func (p *Proxy) handleAddJob(w http.ResponseWriter, r *http.Request, name string) {
+	r.Body = http.MaxBytesReader(w, r.Body, p.maxBody.Load())
+	var req jobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+		return
+	}
+	if strings.Contains(req.ID, "/") {
+		http.Error(w, `{"error":"job id must not contain '/'"}`, http.StatusBadRequest)
+		return
+	}
+
+	ttl := defaultJobTTL
+	if req.TTL != "" {
+		d, err := human.ParseDuration(req.TTL)
+		if err != nil || d <= 0 {
+			http.Error(w, `{"error":"invalid ttl"}`, http.StatusBadRequest)
+			return
+		}
+		ttl = d
+	}
+	if ttl > maxBusyDuration {
+		ttl = maxBusyDuration
+	}
+
+	job := p.jobs.Add(name, req.ID, req.Description, ttl)
+	p.logger.Info("agent job registered", "agent", name, "job", job.ID, "expires_at", job.ExpiresAt)
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(job)
+}
+
+func (p *Proxy) handleCompleteJob(w http.ResponseWriter, name, id string, hostnames []string) {
+	job, ok := p.jobs.Complete(name, id)
+	if !ok {
+		http.Error(w, `{"error":"job not found"}`, http.StatusNotFound)
+		return
+	}
+	// Finishing work counts as activity, so the idle timeout starts now.
+	for _, h := range hostnames {
+		p.activity.Touch(h)
+	}
+	p.logger.Info("agent job completed", "agent", name, "job", id, "duration", time.Since(job.StartedAt))
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// agentRoutes returns the hostnames routed to an agent and its agent token.
+func (p *Proxy) agentRoutes(name string) ([]string, string) {
+	var hostnames []string
+	var token string
+	for h, b := range p.Backends() {
+		if b.AgentName != name {
+			continue
+		}
+		hostnames = append(hostnames, h)
+		if b.Options.AgentToken != "" {
+			token = b.Options.AgentToken
+		}
+	}
+	return hostnames, token
+}
@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"warren/internal/services"
+)
+
+func setupAgentAPI(t *testing.T, token string) *Proxy {
+	t.Helper()
+	p := New(services.NewRegistry(testLogger()), "", testLogger())
+	u, _ := url.Parse("http://localhost:1")
+	opts := RouteOptions{AgentToken: token}
+	p.RegisterWithOptions("a.com", "a", u, &mockPolicy{state: "ready"}, opts)
+	p.RegisterWithOptions("alias.a.com", "a", u, &mockPolicy{state: "ready"}, opts)
+	return p
+}
+
+func postActivity(p *Proxy, agent, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/api/agents/"+agent+"/activity", strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	p.HandleAgentAPI(w, req)
+	return w
+}
+
+func TestAgentActivity_Heartbeat(t *testing.T) {
+	p := setupAgentAPI(t, "agent-secret")
+
+	before := time.Now()
+	w := postActivity(p, "a", "agent-secret", "")
+	if w.Code != 200 {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	for _, h := range []string{"a.com", "alias.a.com"} {
+		if last := p.Activity().LastActivity(h); last.Before(before) {
+			t.Errorf("%s: activity not recorded", h)
+		}
+	}
+}
+
+func TestAgentActivity_BusyFor(t *testing.T) {
+	p := setupAgentAPI(t, "agent-secret")
+
+	w := postActivity(p, "a", "agent-secret", `{"busy_for":"10m"}`)
+	if w.Code != 200 {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	last := p.Activity().LastActivity("a.com")
+	if until := time.Until(last); until < 9*time.Minute || until > 11*time.Minute {
+		t.Errorf("busy until %v from now, want ~10m", until)
+	}
+
+	// A later plain request must not shorten the busy period.
+	p.Activity().Touch("a.com")
+	if !p.Activity().LastActivity("a.com").Equal(last) {
+		t.Error("Touch moved activity backwards")
+	}
+}
+
+func TestAgentActivity_BusyUntilCapped(t *testing.T) {
+	p := setupAgentAPI(t, "agent-secret")
+
+	far := time.Now().Add(30 * 24 * time.Hour).Format(time.RFC3339)
+	w := postActivity(p, "a", "agent-secret", `{"busy_until":"`+far+`"}`)
+	if w.Code != 200 {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	if until := time.Until(p.Activity().LastActivity("a.com")); until > maxBusyDuration {
+		t.Errorf("busy period %v exceeds cap", until)
+	}
+}
+
+func TestAgentActivity_Auth(t *testing.T) {
+	p := setupAgentAPI(t, "agent-secret")
+	if w := postActivity(p, "a", "", ""); w.Code != 401 {
+		t.Errorf("no token: status = %d, want 401", w.Code)
+	}
+	if w := postActivity(p, "a", "wrong", ""); w.Code != 401 {
+		t.Errorf("wrong token: status = %d, want 401", w.Code)
+	}
+	if w := postActivity(p, "missing", "agent-secret", ""); w.Code != 404 {
+		t.Errorf("unknown agent: status = %d, want 404", w.Code)
+	}
+
+	disabled := setupAgentAPI(t, "")
+	if w := postActivity(disabled, "a", "anything", ""); w.Code != 403 {
+		t.Errorf("no agent token configured: status = %d, want 403", w.Code)
+	}
+}
+
+func TestAgentActivity_InvalidBody(t *testing.T) {
+	p := setupAgentAPI(t, "agent-secret")
+	if w := postActivity(p, "a", "agent-secret", `{"busy_for":"soon"}`); w.Code != 400 {
+		t.Errorf("bad duration: status = %d, want 400", w.Code)
+	}
+	if w := postActivity(p, "a", "agent-secret", `not json`); w.Code != 400 {
+		t.Errorf("bad json: status = %d, want 400", w.Code)
+	}
+}
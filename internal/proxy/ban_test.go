@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"warren/internal/ban"
+	"warren/internal/services"
+)
+
+func TestBasicAuthFailuresBanClient(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer s.Close()
+
+	p := New(services.NewRegistry(testLogger()), "", testLogger())
+	jail, _ := ban.New(ban.Config{MaxStrikes: 2}, testLogger())
+	p.SetJail(jail)
+	u, _ := url.Parse(s.URL)
+	p.RegisterWithOptions("a.com", "a", u, &mockPolicy{state: "ready"}, RouteOptions{
+		BasicAuth: testBasicAuth(t, "alice", "pw"),
+	})
+
+	serve := func(user, pass string) int {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Host = "a.com"
+		req.RemoteAddr = "203.0.113.7:5000"
+		if user != "" {
+			req.SetBasicAuth(user, pass)
+		}
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Browsers ask without credentials first; that isn't a failure.
+	serve("", "")
+	serve("", "")
+	if jail.Banned("203.0.113.7") {
+		t.Fatal("requests without credentials counted as failures")
+	}
+
+	serve("alice", "wrong")
+	serve("alice", "guess")
+	if code := serve("alice", "pw"); code != http.StatusForbidden {
+		t.Fatalf("right password after two wrong ones: %d, want 403 from the ban", code)
+	}
+	jail.Unban("203.0.113.7")
+	if code := serve("alice", "pw"); code != http.StatusOK {
+		t.Errorf("after unban: %d, want 200", code)
+	}
+}
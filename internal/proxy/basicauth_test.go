@@ -0,0 +1,147 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"warren/internal/auth"
+	"warren/internal/services"
+)
+
+func testBasicAuth(t *testing.T, user, pass string) *auth.Basic {
+	t.Helper()
+	hash, _ := bcrypt.GenerateFromPassword([]byte(pass), bcrypt.MinCost)
+	b, err := auth.NewBasic("test", []string{user + ":" + string(hash)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestBasicAuth_Backend(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer s.Close()
+
+	// The global proxy token must not be required on a basic-auth hostname.
+	p := New(services.NewRegistry(testLogger()), "secret-token", testLogger())
+	u, _ := url.Parse(s.URL)
+	p.RegisterWithOptions("a.com", "a", u, &mockPolicy{state: "ready"}, RouteOptions{
+		BasicAuth: testBasicAuth(t, "alice", "pw"),
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Host = "a.com"
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	if w.Code != 401 {
+		t.Fatalf("no credentials: status = %d, want 401", w.Code)
+	}
+	if !strings.HasPrefix(w.Header().Get("WWW-Authenticate"), "Basic ") {
+		t.Error("missing WWW-Authenticate challenge")
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Host = "a.com"
+	req.SetBasicAuth("alice", "wrong")
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	if w.Code != 401 {
+		t.Fatalf("bad password: status = %d, want 401", w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Host = "a.com"
+	req.SetBasicAuth("alice", "pw")
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	if w.Code != 200 || w.Body.String() != "ok" {
+		t.Fatalf("valid credentials: status = %d body = %q", w.Code, w.Body.String())
+	}
+
+	// Health stays open, matching the proxy token behaviour.
+	req = httptest.NewRequest("GET", "/api/health", nil)
+	req.Host = "a.com"
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Errorf("health: status = %d, want 200", w.Code)
+	}
+}
+
+func TestBasicAuth_SetOptions(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer s.Close()
+	p := setupProxy(t, map[string]*mockBackendInfo{
+		"a.com": {server: s, agentName: "a", policy: &mockPolicy{state: "ready"}},
+	})
+	p.SetOptions("a.com", RouteOptions{BasicAuth: testBasicAuth(t, "alice", "pw")})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Host = "a.com"
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	if w.Code != 401 {
+		t.Errorf("status = %d, want 401 after enabling basic auth", w.Code)
+	}
+}
+
+func TestBasicAuth_DynamicServiceAPI(t *testing.T) {
+	registry := services.NewRegistry(testLogger())
+	p := New(registry, "", testLogger())
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("pw"), bcrypt.MinCost)
+	body := `{"hostname":"x.com","target":"http://10.0.0.5:3000","agent":"a","basic_auth":{"users":["bob:` + string(hash) + `"]}}`
+	req := httptest.NewRequest("POST", "/api/services", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	p.HandleServiceAPI(w, req)
+	if w.Code != 201 {
+		t.Fatalf("register status = %d: %s", w.Code, w.Body.String())
+	}
+
+	svc, ok := registry.Lookup("x.com")
+	if !ok || svc.BasicAuth == nil {
+		t.Fatal("expected service with basic auth")
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Host = "x.com"
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	if w.Code != 401 {
+		t.Errorf("status = %d, want 401", w.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/api/services", strings.NewReader(`{"hostname":"y.com","target":"http://10.0.0.5:3000","basic_auth":{"users":["bob:plaintext"]}}`))
+	w = httptest.NewRecorder()
+	p.HandleServiceAPI(w, req)
+	if w.Code != 422 || !strings.Contains(w.Body.String(), `"field":"basic_auth"`) {
+		t.Errorf("non-bcrypt hash: status = %d %s, want 422 on basic_auth", w.Code, w.Body.String())
+	}
+}
+
+func TestBasicAuth_ServiceAPIWithProxyToken(t *testing.T) {
+	registry := services.NewRegistry(testLogger())
+	p := New(registry, "secret-token", testLogger())
+	hash, _ := bcrypt.GenerateFromPassword([]byte("pw"), bcrypt.MinCost)
+	register := func(auth string) *httptest.ResponseRecorder {
+		body := `{"hostname":"x.com","target":"http://10.0.0.5:3000","basic_auth":{"users":["bob:` + string(hash) + `"]` + auth + `}}`
+		w := httptest.NewRecorder()
+		p.HandleServiceAPI(w, httptest.NewRequest("POST", "/api/services", strings.NewReader(body)))
+		return w
+	}
+
+	// Basic auth would take the token's place, so it must be asked for.
+	if w := register(""); w.Code != 422 || !strings.Contains(w.Body.String(), `"field":"basic_auth.replace_proxy_token"`) {
+		t.Errorf("without replace_proxy_token: status = %d %s, want 422", w.Code, w.Body.String())
+	}
+	if w := register(`,"replace_proxy_token":true`); w.Code != 201 {
+		t.Errorf("with replace_proxy_token: status = %d %s, want 201", w.Code, w.Body.String())
+	}
+}
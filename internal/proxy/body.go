@@ -0,0 +1,34 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+)
+
+// limitBody caps the request body at limit bytes before it is proxied, so a
+// multi-GB upload can't swamp a small agent backend. A declared
+// Content-Length over the limit is refused with 413 straight away; a
+// chunked body is cut off when it crosses the limit, which the proxy's
+// error handler turns into a 413 via bodyTooLarge. Zero means no limit.
+func limitBody(w http.ResponseWriter, r *http.Request, limit int64) bool {
+	if limit <= 0 || r.Body == nil || r.Body == http.NoBody {
+		return true
+	}
+	if r.ContentLength > limit {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return false
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	return true
+}
+
+// bodyTooLarge answers 413 if err is limitBody cutting off a request body,
+// reporting whether it did.
+func bodyTooLarge(w http.ResponseWriter, err error) bool {
+	var maxErr *http.MaxBytesError
+	if !errors.As(err, &maxErr) {
+		return false
+	}
+	http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+	return true
+}
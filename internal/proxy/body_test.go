@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"warren/internal/services"
+)
+
+func TestMaxProxyBody(t *testing.T) {
+	var hits atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		w.Write(body)
+	}))
+	defer backend.Close()
+	target, _ := url.Parse(backend.URL)
+
+	p := New(services.NewRegistry(testLogger()), "", testLogger())
+	p.SetMaxProxyBody(10)
+	p.Register("small.com", "small", target, &mockPolicy{state: "ready"})
+	p.RegisterWithOptions("big.com", "big", target, &mockPolicy{state: "ready"}, RouteOptions{MaxBody: 100})
+
+	post := func(host string, body io.Reader) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "http://"+host+"/upload", body)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := post("small.com", strings.NewReader("0123456789abcdef")); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("over limit: %d, want 413", w.Code)
+	}
+	if n := hits.Load(); n != 0 {
+		t.Errorf("backend hits = %d, want 0 (oversized body should not be forwarded)", n)
+	}
+
+	// A body without a declared length is cut off once it crosses the limit.
+	chunked := io.MultiReader(strings.NewReader("0123456789"), strings.NewReader("abcdef"))
+	if w := post("small.com", chunked); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("chunked over limit: %d, want 413", w.Code)
+	}
+
+	if w := post("small.com", strings.NewReader("hello")); w.Code != 200 || w.Body.String() != "hello" {
+		t.Errorf("under limit: %d %q", w.Code, w.Body.String())
+	}
+	if w := post("big.com", strings.NewReader("0123456789abcdef")); w.Code != 200 {
+		t.Errorf("per-route override: %d, want 200", w.Code)
+	}
+}
+
+func TestServiceMaxBody(t *testing.T) {
+	registry := services.NewRegistry(testLogger())
+	p := New(registry, "", testLogger())
+
+	w := httptest.NewRecorder()
+	p.HandleServiceAPI(w, httptest.NewRequest("POST", "/api/services", strings.NewReader(
+		`{"hostname":"x.com","target":"http://10.0.0.1:80","max_body":"10"}`)))
+	if w.Code != 201 {
+		t.Fatalf("register: %d %s", w.Code, w.Body.String())
+	}
+	if svc, _ := registry.Lookup("x.com"); svc.MaxBody != 10 {
+		t.Errorf("max_body = %d, want 10", svc.MaxBody)
+	}
+
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("POST", "http://x.com/upload", strings.NewReader("0123456789abcdef")))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("over service limit: %d, want 413", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	p.HandleServiceAPI(w, httptest.NewRequest("POST", "/api/services", strings.NewReader(
+		`{"hostname":"y.com","target":"http://10.0.0.1:80","max_body":"lots"}`)))
+	if w.Code != 422 || !strings.Contains(w.Body.String(), `"field":"max_body"`) {
+		t.Errorf("invalid max_body: %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,59 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"warren/internal/breaker"
+)
+
+// guardCircuit consults the backend's circuit breaker, if any. When the
+// circuit is open it writes a fast 503 and returns ok=false. Otherwise it
+// returns the writer to proxy through and a func to call when the response
+// is done, which records whether the backend failed.
+func (p *Proxy) guardCircuit(w http.ResponseWriter, r *http.Request, hostname string, br *breaker.Breaker) (http.ResponseWriter, func(), bool) {
+	if br == nil || IsWebSocket(r) {
+		return w, func() {}, true
+	}
+	done, ok := br.Allow()
+	if !ok {
+		retry := int(br.RetryAfter().Round(time.Second) / time.Second)
+		if retry < 1 {
+			retry = 1
+		}
+		p.logger.Debug("circuit open, rejecting request", "hostname", hostname)
+		w.Header().Set("Retry-After", strconv.Itoa(retry))
+		p.proxyError(w, r, http.StatusServiceUnavailable, "service unavailable: backend circuit open")
+		return w, nil, false
+	}
+	rec := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+	return rec, func() { done(!backendFailed(rec.code)) }, true
+}
+
+// backendFailed reports whether a response status means the backend, not the
+// request, was at fault. 502–504 are what the reverse proxy writes for
+// transport errors and what a struggling upstream tends to return.
+func backendFailed(code int) bool {
+	return code == http.StatusBadGateway || code == http.StatusServiceUnavailable || code == http.StatusGatewayTimeout
+}
+
+// statusRecorder remembers the status code written through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	code  int
+	wrote bool
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if !s.wrote {
+		s.code, s.wrote = code, true
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, so
+// streaming responses can still be flushed.
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
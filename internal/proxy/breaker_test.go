@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"warren/internal/breaker"
+	"warren/internal/services"
+)
+
+func TestCircuitBreakerFailsFast(t *testing.T) {
+	var hits atomic.Int32
+	var healthy atomic.Bool
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+	target, _ := url.Parse(backend.URL)
+
+	br, err := breaker.New(breaker.Config{Threshold: 1, MinRequests: 2, OpenFor: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := New(services.NewRegistry(testLogger()), "", testLogger())
+	p.RegisterWithOptions("a.com", "a", target, &mockPolicy{state: "ready"}, RouteOptions{Breaker: br})
+
+	get := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "http://a.com/", nil)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+		return w
+	}
+
+	get()
+	get()
+	if br.State() != breaker.Open {
+		t.Fatalf("state = %s after two failures, want open", br.State())
+	}
+	w := get()
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("open circuit: %d, Retry-After %q; want 503 with Retry-After", w.Code, w.Header().Get("Retry-After"))
+	}
+	if n := hits.Load(); n != 2 {
+		t.Errorf("backend hits = %d, want 2 (open circuit should not forward)", n)
+	}
+
+	// After open_for a probe goes through; a success closes the circuit.
+	healthy.Store(true)
+	time.Sleep(25 * time.Millisecond)
+	if w := get(); w.Code != 200 || w.Body.String() != "ok" {
+		t.Fatalf("probe: %d %q", w.Code, w.Body.String())
+	}
+	if br.State() != breaker.Closed {
+		t.Errorf("state = %s after successful probe, want closed", br.State())
+	}
+}
+
+func TestSetOptionsKeepsBreaker(t *testing.T) {
+	target, _ := url.Parse("http://10.0.0.1:80")
+	p := New(services.NewRegistry(testLogger()), "", testLogger())
+	live, _ := breaker.New(breaker.Config{Threshold: 0.5})
+	p.RegisterWithOptions("a.com", "a", target, &mockPolicy{state: "ready"}, RouteOptions{Breaker: live})
+
+	same, _ := breaker.New(breaker.Config{Threshold: 0.5})
+	p.SetOptions("a.com", RouteOptions{Breaker: same})
+	if p.Backends()["a.com"].Options.Breaker != live {
+		t.Error("unchanged breaker settings should keep the live breaker")
+	}
+	changed, _ := breaker.New(breaker.Config{Threshold: 0.9})
+	p.SetOptions("a.com", RouteOptions{Breaker: changed})
+	if p.Backends()["a.com"].Options.Breaker != changed {
+		t.Error("changed settings should replace the breaker")
+	}
+}
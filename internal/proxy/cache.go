@@ -0,0 +1,21 @@
+package proxy
+
+import (
+	"net/http"
+
+	"warren/internal/cache"
+)
+
+// serveCached answers a request from its route's cache, reporting whether
+// it could.
+func (p *Proxy) serveCached(w http.ResponseWriter, r *http.Request, c *cache.Cache, compress bool) bool {
+	if c == nil {
+		return false
+	}
+	if compress {
+		var closeCompress func()
+		w, closeCompress = compressResponse(w, r)
+		defer closeCompress()
+	}
+	return c.Serve(w, r)
+}
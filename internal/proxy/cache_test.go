@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"warren/internal/cache"
+	"warren/internal/services"
+)
+
+func TestCacheServesWithoutWaking(t *testing.T) {
+	var hits atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		switch r.URL.Path {
+		case "/static/app.js":
+			w.Header().Set("Content-Type", "text/javascript")
+			w.Write([]byte("console.log(1)"))
+		case "/static/private.js":
+			w.Header().Set("Cache-Control", "private")
+			w.Write([]byte("secret"))
+		case "/static/cookie.js":
+			w.Header().Set("Set-Cookie", "session=1")
+			w.Write([]byte("x"))
+		}
+	}))
+	defer backend.Close()
+	target, _ := url.Parse(backend.URL)
+
+	pol := &mockPolicy{state: "ready"}
+	p := New(services.NewRegistry(testLogger()), "", testLogger())
+	p.RegisterWithOptions("a.com", "a", target, pol, RouteOptions{
+		Cache: cache.New(cache.Config{Paths: []string{"/static/"}, TTL: time.Minute}),
+	})
+	get := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, httptest.NewRequest(method, "http://a.com"+path, nil))
+		return w
+	}
+
+	if w := get("GET", "/static/app.js"); w.Header().Get("X-Cache") != "MISS" || w.Body.String() != "console.log(1)" {
+		t.Fatalf("first request: %q %q", w.Header().Get("X-Cache"), w.Body.String())
+	}
+
+	// Once cached, the asset is served even while the agent sleeps, and
+	// the request doesn't wake it.
+	pol.state = "sleeping"
+	pol.woken = false
+	w := get("GET", "/static/app.js")
+	if w.Code != 200 || w.Header().Get("X-Cache") != "HIT" || w.Body.String() != "console.log(1)" {
+		t.Fatalf("cached request: %d %q %q", w.Code, w.Header().Get("X-Cache"), w.Body.String())
+	}
+	if w.Header().Get("Content-Type") != "text/javascript" {
+		t.Errorf("cached Content-Type = %q", w.Header().Get("Content-Type"))
+	}
+	if w := get("HEAD", "/static/app.js"); w.Header().Get("X-Cache") != "HIT" || w.Body.Len() != 0 {
+		t.Errorf("HEAD: %q, body %d bytes", w.Header().Get("X-Cache"), w.Body.Len())
+	}
+	if pol.woken || hits.Load() != 1 {
+		t.Errorf("woken = %v, backend hits = %d; want false and 1", pol.woken, hits.Load())
+	}
+
+	pol.state = "ready"
+	for _, path := range []string{"/static/private.js", "/static/cookie.js"} {
+		get("GET", path)
+		if w := get("GET", path); w.Header().Get("X-Cache") == "HIT" {
+			t.Errorf("%s was cached", path)
+		}
+	}
+	if st := p.mustBackend(t, "a.com").Options.Cache.Stats(); st.Entries != 1 || st.Hits != 2 {
+		t.Errorf("stats = %+v", st)
+	}
+}
+
+func TestCacheDynamicService(t *testing.T) {
+	var hits atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Write([]byte("asset"))
+	}))
+	defer backend.Close()
+
+	registry := services.NewRegistry(testLogger())
+	registry.RegisterUnsafe("dash.example.com", backend.URL, "")
+	svc, _ := registry.Lookup("dash.example.com")
+	svc.Cache = cache.New(cache.Config{Paths: []string{"/static/"}})
+	p := New(registry, "", testLogger())
+
+	get := func(auth string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "http://dash.example.com/static/app.js", nil)
+		if auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		return w
+	}
+	get("")
+	if w := get(""); w.Header().Get("X-Cache") != "HIT" || w.Body.String() != "asset" {
+		t.Errorf("second request: %q %q, want a cache hit", w.Header().Get("X-Cache"), w.Body.String())
+	}
+	if w := get("Basic dTpw"); w.Header().Get("X-Cache") == "HIT" {
+		t.Error("request with credentials was answered from the cache")
+	}
+	if hits.Load() != 2 {
+		t.Errorf("backend hits = %d, want 2", hits.Load())
+	}
+}
+
+func (p *Proxy) mustBackend(t *testing.T, hostname string) *Backend {
+	t.Helper()
+	b, ok := p.Backend(hostname)
+	if !ok {
+		t.Fatalf("no backend for %s", hostname)
+	}
+	return b
+}
@@ -0,0 +1,183 @@
+package proxy
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"warren/internal/brotli"
+)
+
+// minCompressSize is the smallest response worth compressing; below it the
+// framing outweighs the savings.
+const minCompressSize = 1024
+
+// encoder is a compressing writer that can be pooled.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// encoders pools writers by Content-Encoding.
+var encoders = map[string]*sync.Pool{
+	"br": {New: func() any { return brotli.NewWriter(io.Discard) }},
+	"gzip": {New: func() any {
+		zw, _ := gzip.NewWriterLevel(io.Discard, gzip.DefaultCompression)
+		return zw
+	}},
+}
+
+// compressible reports whether responses of a Content-Type are worth
+// compressing: text and the structured formats agent APIs return. Event
+// streams are left alone so each event reaches the client as it's sent.
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case mediaType == "text/event-stream":
+		return false
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+json"),
+		strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/javascript", "application/xml",
+		"application/x-ndjson", "application/wasm", "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+// acceptedEncoding picks the response encoding for the client: Brotli if it
+// accepts it, else gzip, else "" for none.
+func acceptedEncoding(r *http.Request) string {
+	accepted := make(map[string]bool)
+	for _, v := range r.Header.Values("Accept-Encoding") {
+		for _, enc := range strings.Split(v, ",") {
+			name, params, _ := strings.Cut(strings.TrimSpace(enc), ";")
+			name = strings.ToLower(strings.TrimSpace(name))
+			// "gzip;q=0" explicitly refuses it.
+			ok := true
+			if q, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+				if f, err := strconv.ParseFloat(q, 64); err == nil && f == 0 {
+					ok = false
+				}
+			}
+			if _, seen := accepted[name]; !seen {
+				accepted[name] = ok
+			}
+		}
+	}
+	for _, enc := range []string{"br", "gzip"} {
+		if accepted[enc] {
+			return enc
+		}
+	}
+	return ""
+}
+
+// compressResponse compresses the backend's response with Brotli or gzip if
+// the client accepts it and the backend didn't compress it already. Call
+// the returned func once the response is complete.
+func compressResponse(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, func()) {
+	if r.Method == http.MethodHead || IsWebSocket(r) {
+		return w, func() {}
+	}
+	enc := acceptedEncoding(r)
+	if enc == "" {
+		return w, func() {}
+	}
+	cw := &compressWriter{ResponseWriter: w, encoding: enc}
+	return cw, cw.close
+}
+
+// compressWriter decides when the response headers are written whether to
+// compress the body.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string  // Content-Encoding to use
+	zw       encoder // nil when passing the body through
+	decided  bool
+}
+
+func (c *compressWriter) WriteHeader(code int) {
+	if c.decided || code < http.StatusOK {
+		c.ResponseWriter.WriteHeader(code)
+		return
+	}
+	c.decided = true
+	h := c.Header()
+	h.Add("Vary", "Accept-Encoding")
+	if c.shouldCompress(code) {
+		h.Del("Content-Length")
+		h.Del("Accept-Ranges")
+		h.Set("Content-Encoding", c.encoding)
+		// The backend's validator names the uncompressed body.
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+		zw := encoders[c.encoding].Get().(encoder)
+		zw.Reset(c.ResponseWriter)
+		c.zw = zw
+	}
+	c.ResponseWriter.WriteHeader(code)
+}
+
+func (c *compressWriter) shouldCompress(code int) bool {
+	h := c.Header()
+	if code == http.StatusNoContent || code == http.StatusNotModified || code == http.StatusPartialContent {
+		return false
+	}
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" || !compressible(h.Get("Content-Type")) {
+		return false
+	}
+	if n, err := strconv.ParseInt(h.Get("Content-Length"), 10, 64); err == nil && n < minCompressSize {
+		return false
+	}
+	return true
+}
+
+func (c *compressWriter) Write(b []byte) (int, error) {
+	if !c.decided {
+		if c.Header().Get("Content-Type") == "" {
+			c.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		c.WriteHeader(http.StatusOK)
+	}
+	if c.zw != nil {
+		return c.zw.Write(b)
+	}
+	return c.ResponseWriter.Write(b)
+}
+
+// Flush sends what has been compressed so far, so streamed responses keep
+// flowing.
+func (c *compressWriter) Flush() {
+	if c.zw != nil {
+		_ = c.zw.Flush()
+	}
+	_ = http.NewResponseController(c.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (c *compressWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+func (c *compressWriter) close() {
+	if c.zw == nil {
+		return
+	}
+	_ = c.zw.Close()
+	c.zw.Reset(io.Discard)
+	encoders[c.encoding].Put(c.zw)
+	c.zw = nil
+}
@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"warren/internal/services"
+)
+
+func TestCompressResponses(t *testing.T) {
+	big := strings.Repeat(`{"message":"hello"}`, 200)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/json":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(big))
+		case "/small":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{}`))
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte(big))
+		case "/gzipped":
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Encoding", "gzip")
+			zw := gzip.NewWriter(w)
+			zw.Write([]byte(big))
+			zw.Close()
+		}
+	}))
+	defer backend.Close()
+	target, _ := url.Parse(backend.URL)
+
+	p := New(services.NewRegistry(testLogger()), "", testLogger())
+	p.RegisterWithOptions("a.com", "a", target, &mockPolicy{state: "ready"}, RouteOptions{})
+	off := false
+	p.RegisterWithOptions("plain.com", "b", target, &mockPolicy{state: "ready"}, RouteOptions{Compress: &off})
+	p.SetCompress(true)
+
+	get := func(host, path, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "http://"+host+path, nil)
+		if accept != "" {
+			req.Header.Set("Accept-Encoding", accept)
+		}
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("a.com", "/json", "br;q=0, gzip")
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("json: Content-Encoding = %q, want gzip", w.Header().Get("Content-Encoding"))
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(zr); string(body) != big {
+		t.Error("decompressed body differs from the backend's")
+	}
+
+	// Brotli is preferred when the client accepts it.
+	w = get("a.com", "/json", "gzip, br")
+	if w.Header().Get("Content-Encoding") != "br" || w.Body.Len() == 0 || w.Body.Len() >= len(big)/4 {
+		t.Errorf("json with br: Content-Encoding = %q, %d bytes", w.Header().Get("Content-Encoding"), w.Body.Len())
+	}
+
+	for _, tc := range []struct{ name, host, path, accept string }{
+		{"client without compression", "a.com", "/json", ""},
+		{"gzip refused", "a.com", "/json", "gzip;q=0"},
+		{"small body", "a.com", "/small", "gzip"},
+		{"binary type", "a.com", "/image", "gzip"},
+		{"compression disabled", "plain.com", "/json", "gzip"},
+	} {
+		if w := get(tc.host, tc.path, tc.accept); w.Header().Get("Content-Encoding") != "" {
+			t.Errorf("%s: Content-Encoding = %q, want none", tc.name, w.Header().Get("Content-Encoding"))
+		}
+	}
+
+	// A response the backend compressed itself isn't compressed twice.
+	w = get("a.com", "/gzipped", "gzip")
+	zr, err = gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(zr); string(body) != big {
+		t.Error("backend-compressed body was altered")
+	}
+}
@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"warren/internal/cors"
+	"warren/internal/services"
+)
+
+func TestRouteCORS(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+	target, _ := url.Parse(backend.URL)
+
+	policy, err := cors.New(cors.Config{Origins: []string{"https://app.example.com"}, Headers: []string{"Authorization"}, Credentials: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := New(services.NewRegistry(testLogger()), "secret-token", testLogger())
+	p.RegisterWithOptions("a.com", "a", target, &mockPolicy{state: "ready"}, RouteOptions{CORS: policy})
+
+	// Preflights carry no credentials, so they're answered before auth.
+	req := httptest.NewRequest(http.MethodOptions, "http://a.com/api/chat", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	req.Header.Set("Access-Control-Request-Headers", "authorization")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" {
+		t.Fatalf("preflight: %d %v", w.Code, w.Header())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "http://a.com/api/chat", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Authorization", "Bearer secret-token")
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	if w.Code != 200 || w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Errorf("request: %d %v", w.Code, w.Header())
+	}
+
+	// Auth failures still carry CORS headers so the frontend can read them.
+	req = httptest.NewRequest(http.MethodGet, "http://a.com/", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	if w.Code != 401 || w.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" {
+		t.Errorf("unauthorized: %d %v", w.Code, w.Header())
+	}
+}
+
+func TestServiceAPICORS(t *testing.T) {
+	registry := services.NewRegistry(testLogger())
+	p := New(registry, "", testLogger())
+
+	w := httptest.NewRecorder()
+	p.HandleServiceAPI(w, httptest.NewRequest("POST", "/api/services", strings.NewReader(
+		`{"hostname":"x.com","target":"http://10.0.0.1:80","cors":{"origins":["https://app.example.com"],"max_age":"1h"}}`)))
+	if w.Code != 201 {
+		t.Fatalf("register: %d %s", w.Code, w.Body.String())
+	}
+	svc, _ := registry.Lookup("x.com")
+	if svc.CORS == nil || !svc.CORS.AllowsOrigin("https://app.example.com") {
+		t.Fatalf("cors = %+v", svc.CORS)
+	}
+	w = httptest.NewRecorder()
+	p.HandleServiceAPI(w, httptest.NewRequest("GET", "/api/services/x.com", nil))
+	if !strings.Contains(w.Body.String(), `"cors":"https://app.example.com"`) {
+		t.Errorf("inspect = %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	p.HandleServiceAPI(w, httptest.NewRequest("POST", "/api/services", strings.NewReader(
+		`{"hostname":"y.com","target":"http://10.0.0.1:80","cors":{"origins":["*"],"credentials":true}}`)))
+	if w.Code != 422 || !strings.Contains(w.Body.String(), `"field":"cors"`) {
+		t.Errorf("wildcard with credentials: %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+)
+
+// ErrorPageStatuses are the statuses error pages can replace.
+var ErrorPageStatuses = []int{http.StatusNotFound, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+
+// ErrorPages renders the pages shown to browsers in place of the proxy's
+// plain-text 404 (for paths outside allowed_paths), 502, 503 and 504
+// responses.
+type ErrorPages struct {
+	pages map[int]*template.Template
+}
+
+// errorPageData is passed to error page templates.
+type errorPageData struct {
+	Agent      string
+	Hostname   string
+	State      string
+	Status     int
+	StatusText string
+}
+
+// NewErrorPages parses one template per status from paths. It returns nil
+// when paths is empty.
+func NewErrorPages(paths map[int]string) (*ErrorPages, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	e := &ErrorPages{pages: make(map[int]*template.Template, len(paths))}
+	for code, path := range paths {
+		tmpl, err := template.ParseFiles(path)
+		if err != nil {
+			return nil, fmt.Errorf("error page %d: %w", code, err)
+		}
+		e.pages[code] = tmpl
+	}
+	return e, nil
+}
+
+// page returns the template for code, or nil if none is configured.
+func (e *ErrorPages) page(code int) *template.Template {
+	if e == nil {
+		return nil
+	}
+	return e.pages[code]
+}
+
+// SetErrorPages sets the error pages used by agents without their own. Nil
+// restores the plain-text responses.
+func (p *Proxy) SetErrorPages(e *ErrorPages) {
+	p.errorPages.Store(e)
+}
+
+// proxyError writes an error the proxy generated for an agent hostname: the
+// agent's or the proxy-wide error page for browsers, plain text otherwise.
+func (p *Proxy) proxyError(w http.ResponseWriter, r *http.Request, code int, msg string) {
+	if IsGRPC(r) {
+		if backend, ok := p.lookup(normalizeHost(r.Host)); ok && backend.Options.GRPC {
+			grpcError(w, code, msg)
+			return
+		}
+	}
+	if wantsHTML(r) {
+		hostname := normalizeHost(r.Host)
+		if backend, ok := p.lookup(hostname); ok {
+			tmpl := backend.Options.ErrorPages.page(code)
+			if tmpl == nil {
+				tmpl = p.errorPages.Load().page(code)
+			}
+			if tmpl != nil {
+				data := errorPageData{
+					Agent:      backend.AgentName,
+					Hostname:   hostname,
+					State:      backend.Policy.State(),
+					Status:     code,
+					StatusText: http.StatusText(code),
+				}
+				var buf bytes.Buffer
+				err := tmpl.Execute(&buf, data)
+				if err == nil {
+					w.Header().Set("Content-Type", "text/html; charset=utf-8")
+					w.Header().Set("Cache-Control", "no-store")
+					w.WriteHeader(code)
+					_, _ = w.Write(buf.Bytes())
+					return
+				}
+				p.logger.Error("error page template failed, falling back to plain text", "agent", backend.AgentName, "status", code, "error", err)
+			}
+		}
+	}
+	http.Error(w, msg, code)
+}
+
+// backendError answers a request the backend failed: 504 if it timed out,
+// whether dialing or waiting for response headers, 502 otherwise.
+func (p *Proxy) backendError(w http.ResponseWriter, r *http.Request, err error) {
+	code, msg := gatewayStatus(err)
+	p.proxyError(w, r, code, msg)
+}
+
+// gatewayStatus is the status and message for a failed backend request.
+func gatewayStatus(err error) (int, string) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout, "gateway timeout"
+	}
+	return http.StatusBadGateway, "bad gateway"
+}
@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"warren/internal/balance"
+	"warren/internal/services"
+	"warren/internal/transport"
+)
+
+func writePage(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "page.html")
+	if err := os.WriteFile(path, []byte(body), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestErrorPages(t *testing.T) {
+	global, err := NewErrorPages(map[int]string{502: writePage(t, `<p>global {{.Status}} {{.StatusText}} for {{.Agent}}</p>`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	own, err := NewErrorPages(map[int]string{502: writePage(t, `<p>{{.Agent}} on {{.Hostname}} is {{.State}}</p>`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing listens on port 1, so every request is a bad gateway.
+	target, _ := url.Parse("http://127.0.0.1:1")
+	p := New(services.NewRegistry(testLogger()), "", testLogger())
+	p.SetErrorPages(global)
+	p.RegisterWithOptions("a.com", "a", target, &mockPolicy{state: "ready"}, RouteOptions{})
+	p.RegisterWithOptions("b.com", "b", target, &mockPolicy{state: "ready"}, RouteOptions{ErrorPages: own})
+
+	get := func(host, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "http://"+host+"/", nil)
+		req.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("a.com", "text/html")
+	if w.Code != http.StatusBadGateway || w.Body.String() != "<p>global 502 Bad Gateway for a</p>" {
+		t.Errorf("global page: %d %q", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if w := get("b.com", "text/html"); w.Body.String() != "<p>b on b.com is ready</p>" {
+		t.Errorf("agent page: %q", w.Body.String())
+	}
+	if w := get("a.com", "application/json"); w.Code != http.StatusBadGateway || w.Body.String() != "bad gateway\n" {
+		t.Errorf("API client: %d %q", w.Code, w.Body.String())
+	}
+
+	p.SetErrorPages(nil)
+	if w := get("a.com", "text/html"); w.Body.String() != "bad gateway\n" {
+		t.Errorf("after clearing pages: %q", w.Body.String())
+	}
+}
+
+func TestErrorPagesForPools(t *testing.T) {
+	pages, _ := NewErrorPages(map[int]string{502: writePage(t, `down: {{.Agent}}`)})
+	target, _ := url.Parse("http://127.0.0.1:1")
+	pool, err := balance.New([]*url.URL{target}, "", testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := New(services.NewRegistry(testLogger()), "", testLogger())
+	p.RegisterWithOptions("a.com", "a", target, &mockPolicy{state: "ready"}, RouteOptions{Pool: pool, ErrorPages: pages})
+
+	req := httptest.NewRequest("GET", "http://a.com/", nil)
+	req.Header.Set("Accept", "text/html")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	if w.Code != http.StatusBadGateway || w.Body.String() != "down: a" {
+		t.Errorf("pool error: %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestErrorPagesForTimeouts(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer backend.Close()
+	target, _ := url.Parse(backend.URL)
+
+	pages, _ := NewErrorPages(map[int]string{504: writePage(t, `slow: {{.Agent}} {{.Status}}`)})
+	p := New(services.NewRegistry(testLogger()), "", testLogger())
+	p.RegisterWithOptions("a.com", "a", target, &mockPolicy{state: "ready"}, RouteOptions{
+		ErrorPages: pages,
+		Timeouts:   &transport.Timeouts{ResponseHeader: 10 * time.Millisecond},
+	})
+
+	req := httptest.NewRequest("GET", "http://a.com/", nil)
+	req.Header.Set("Accept", "text/html")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	if w.Code != http.StatusGatewayTimeout || w.Body.String() != "slow: a 504" {
+		t.Errorf("timeout: %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestNewErrorPagesInvalid(t *testing.T) {
+	if _, err := NewErrorPages(map[int]string{502: writePage(t, `{{.Agent`)}); err == nil {
+		t.Error("expected parse error")
+	}
+	if e, err := NewErrorPages(nil); e != nil || err != nil {
+		t.Errorf("empty paths = %v, %v; want nil, nil", e, err)
+	}
+}
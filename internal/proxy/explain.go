@@ -0,0 +1,225 @@
+package proxy
+
+import (
+	"net/http"
+	"time"
+
+	"warren/internal/headers"
+	"warren/internal/services"
+)
+
+// Route describes how the proxy would handle a request, for debugging
+// misrouted traffic without sending any.
+type Route struct {
+	Host string `json:"host"`
+	Path string `json:"path"`
+	// Kind is what answers the request: "redirect", "agent", "service",
+	// "reserved" for paths the public port never serves, "banned" for
+	// jailed clients, or "none".
+	Kind     string `json:"kind"`
+	Redirect string `json:"redirect,omitempty"` // Location, for redirects
+	Status   int    `json:"status,omitempty"`   // set when the proxy answers itself, e.g. 301 or 404
+
+	Agent   string   `json:"agent,omitempty"`   // the agent the hostname belongs to, or the service's owner
+	Service string   `json:"service,omitempty"` // the dynamic service's hostname
+	Target  string   `json:"target,omitempty"`
+	Targets []string `json:"targets,omitempty"` // replicas, when balanced
+	Balance string   `json:"balance,omitempty"`
+
+	// Handler is what serves the request once routed: "health", "wake",
+	// "cache", "websocket", "grpc" or "proxy", or "blocked" for paths
+	// outside the agent's allowed_paths.
+	Handler string `json:"handler,omitempty"`
+	// Middlewares apply in this order.
+	Middlewares []string `json:"middlewares"`
+
+	State string `json:"state,omitempty"` // the agent's current state
+	// Wake reports whether the request would wake a sleeping agent, and
+	// WakeResponse what the client gets meanwhile: "splash" (503 or the
+	// splash page) or "hold" (held until ready, then replayed).
+	Wake         bool   `json:"wake"`
+	WakeResponse string `json:"wake_response,omitempty"`
+}
+
+// Explain routes r the way ServeHTTP would, without serving it, waking
+// anything or counting activity.
+func (p *Proxy) Explain(r *http.Request) Route {
+	r, d := p.dispatch(r)
+	route := Route{Host: d.hostname, Path: r.URL.Path, Middlewares: []string{}}
+
+	switch {
+	case d.banned:
+		route.Kind, route.Status = "banned", http.StatusForbidden
+		return route
+	case d.redirect != "":
+		route.Kind, route.Redirect, route.Status = "redirect", d.redirect, d.code
+		return route
+	case d.reserved:
+		route.Kind, route.Status = "reserved", http.StatusNotFound
+		return route
+	case !d.routed():
+		route.Kind, route.Status = "none", http.StatusNotFound
+		return route
+	}
+
+	if d.backend != nil {
+		route.Kind, route.Agent, route.Target = "agent", d.agent, d.backend.Target.String()
+		route.State = d.backend.Policy.State()
+	} else {
+		route.Kind, route.Service, route.Agent, route.Target = "service", d.svc.Hostname, d.agent, d.svc.Target
+	}
+	if d.h2c {
+		route.Status = http.StatusHTTPVersionNotSupported
+		return route
+	}
+	if d.blocked {
+		route.Handler, route.Status = "blocked", http.StatusNotFound
+		return route
+	}
+	if d.cors != nil {
+		route.add("cors")
+	}
+	if !d.healthCheck {
+		route.addAuth(d.basic != nil, d.forward != nil, p.authToken != "")
+	}
+
+	if d.backend != nil {
+		p.explainBackend(&route, r, d.backend)
+	} else {
+		p.explainService(&route, r, d.svc, d.owner)
+	}
+	return route
+}
+
+func (p *Proxy) explainBackend(route *Route, r *http.Request, backend *Backend) {
+	opts := backend.Options
+	switch {
+	case r.URL.Path == "/api/health" && r.Method == http.MethodGet:
+		route.Handler = "health"
+		return
+	case r.URL.Path == "/api/wake" && r.Method == http.MethodPost:
+		route.Handler = "wake"
+		route.Wake = route.State == "sleeping"
+		return
+	}
+
+	if opts.Headers != nil {
+		route.add("headers")
+		r = rewritten(r, opts.Headers)
+	}
+	if c := opts.Cache; c != nil {
+		route.add("cache")
+		if c.Has(r) {
+			// Cache hits don't count as activity, so nothing wakes.
+			route.Handler = "cache"
+			return
+		}
+	}
+
+	route.explainWake(r, opts.WakeHold)
+	if opts.MaxBody > 0 || p.maxProxy.Load() > 0 {
+		route.add("max_body")
+	}
+	if opts.Breaker != nil {
+		route.add("circuit_breaker")
+	}
+	if opts.Retry != nil {
+		route.add("retry")
+	}
+	if p.compresses(opts) {
+		route.add("compress")
+	}
+
+	route.Handler = "proxy"
+	switch {
+	case opts.GRPC && IsGRPC(r):
+		route.Handler = "grpc"
+	case IsWebSocket(r):
+		route.Handler = "websocket"
+		if opts.MaxWebSockets > 0 {
+			route.add("max_websockets")
+		}
+	}
+	if pool := opts.Pool; pool != nil {
+		route.Targets, route.Balance = pool.Targets(), pool.Strategy()
+		route.add("load_balancer")
+	}
+}
+
+func (p *Proxy) explainService(route *Route, r *http.Request, svc *services.Service, owner *Backend) {
+	if svc.Headers != nil {
+		route.add("headers")
+		r = rewritten(r, svc.Headers)
+	}
+	if c := svc.Cache; c != nil {
+		route.add("cache")
+		if c.Has(r) {
+			route.Handler = "cache"
+			return
+		}
+	}
+	if owner != nil {
+		route.State = owner.Policy.State()
+		route.explainWake(r, owner.Options.WakeHold)
+	}
+	if svc.MaxBody > 0 || p.maxProxy.Load() > 0 {
+		route.add("max_body")
+	}
+	if svc.Pool != nil {
+		route.Targets, route.Balance = svc.Pool.Targets(), svc.Pool.Strategy()
+		route.add("load_balancer")
+	}
+	if svc.Fallback != nil {
+		route.add("fallback")
+	}
+	route.Handler = "proxy"
+	if IsWebSocket(r) {
+		route.Handler = "websocket"
+	}
+}
+
+// rewritten returns a copy of r with rw's request rewrites applied, as the
+// cache sees it when serving.
+func rewritten(r *http.Request, rw *headers.Rewriter) *http.Request {
+	r = r.Clone(r.Context())
+	rw.Request(r)
+	return r
+}
+
+func (route *Route) add(middleware string) {
+	route.Middlewares = append(route.Middlewares, middleware)
+}
+
+// addAuth records the authentication ServeHTTP would apply: a hostname's
+// own basic or forward auth in place of the global proxy token.
+func (route *Route) addAuth(basic, forward, token bool) {
+	switch {
+	case basic:
+		route.add("basic_auth")
+	case forward:
+		route.add("forward_auth")
+	case token:
+		route.add("proxy_token")
+	}
+}
+
+// explainWake records whether the request would wake the agent in
+// route.State, and how it would be answered while it does.
+func (route *Route) explainWake(r *http.Request, hold time.Duration) {
+	if !sleepingState(route.State) {
+		return
+	}
+	route.Wake = route.State == "sleeping"
+	if hold > 0 && !wantsHTML(r) && !IsWebSocket(r) {
+		route.WakeResponse = "hold"
+		route.add("wake_hold")
+	} else {
+		route.WakeResponse = "splash"
+	}
+}
+
+// sleepingState reports whether an agent in state can't take traffic until
+// it wakes.
+func sleepingState(state string) bool {
+	return state == "sleeping" || state == "starting" || state == "crashloop"
+}
@@ -0,0 +1,147 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	"warren/internal/auth"
+	"warren/internal/ban"
+	"warren/internal/cache"
+	"warren/internal/headers"
+	"warren/internal/redirect"
+	"warren/internal/services"
+)
+
+func TestExplainAgent(t *testing.T) {
+	p := New(services.NewRegistry(testLogger()), "secret", testLogger())
+	target, _ := url.Parse("http://10.0.0.1:3000")
+	pol := &mockPolicy{state: "sleeping"}
+	p.RegisterWithOptions("a.com", "a", target, pol, RouteOptions{
+		BasicAuth:     &auth.Basic{},
+		Retry:         &Retry{Attempts: 2},
+		WakeHold:      10 * time.Second,
+		MaxWebSockets: 5,
+	})
+
+	route := p.Explain(httptest.NewRequest("POST", "http://A.com:8080/api/chat", nil))
+	if route.Kind != "agent" || route.Agent != "a" || route.Target != "http://10.0.0.1:3000" || route.Handler != "proxy" {
+		t.Errorf("route = %+v, want agent a proxied to its backend", route)
+	}
+	if !route.Wake || route.WakeResponse != "hold" || route.State != "sleeping" {
+		t.Errorf("route = %+v, want a held wake", route)
+	}
+	want := []string{"basic_auth", "wake_hold", "retry"}
+	if !slices.Equal(route.Middlewares, want) {
+		t.Errorf("middlewares = %v, want %v", route.Middlewares, want)
+	}
+	if pol.woken {
+		t.Error("explaining a route must not wake the agent")
+	}
+
+	ws := httptest.NewRequest("GET", "http://a.com/socket", nil)
+	ws.Header.Set("Connection", "Upgrade")
+	ws.Header.Set("Upgrade", "websocket")
+	route = p.Explain(ws)
+	if route.Handler != "websocket" || route.WakeResponse != "splash" || !slices.Contains(route.Middlewares, "max_websockets") {
+		t.Errorf("websocket route = %+v, want the splash while waking and the websocket limit", route)
+	}
+
+	route = p.Explain(httptest.NewRequest("GET", "http://a.com/api/health", nil))
+	if route.Handler != "health" || route.Wake || len(route.Middlewares) != 0 {
+		t.Errorf("health route = %+v, want the unauthenticated health handler", route)
+	}
+}
+
+func TestExplainCacheHitDoesNotWake(t *testing.T) {
+	p := New(services.NewRegistry(testLogger()), "", testLogger())
+	target, _ := url.Parse("http://10.0.0.1:3000")
+	c := cache.New(cache.Config{Paths: []string{"/static/"}})
+	p.RegisterWithOptions("a.com", "a", target, &mockPolicy{state: "sleeping"}, RouteOptions{Cache: c})
+
+	r := httptest.NewRequest("GET", "http://a.com/static/app.js", nil)
+	if route := p.Explain(r); route.Handler != "proxy" || !route.Wake {
+		t.Errorf("uncached route = %+v, want a proxied request that wakes", route)
+	}
+	w, store := c.Record(httptest.NewRecorder(), r)
+	w.Write([]byte("js"))
+	store()
+	if route := p.Explain(r); route.Handler != "cache" || route.Wake {
+		t.Errorf("cached route = %+v, want a cache hit that doesn't wake", route)
+	}
+	if c.Stats().Hits != 0 {
+		t.Error("explaining a route must not count cache hits")
+	}
+}
+
+func TestExplainMatchesServing(t *testing.T) {
+	p := New(services.NewRegistry(testLogger()), "", testLogger())
+	jail, _ := ban.New(ban.Config{MaxStrikes: 1}, testLogger())
+	p.SetJail(jail)
+	target, _ := url.Parse("http://10.0.0.1:3000")
+	c := cache.New(cache.Config{Paths: []string{"/static/"}})
+	rw, err := headers.New(headers.Config{Request: headers.Rules{Remove: []string{"Cookie"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.RegisterWithOptions("a.com", "a", target, &mockPolicy{state: "sleeping"}, RouteOptions{Cache: c, Headers: rw})
+
+	w, store := c.Record(httptest.NewRecorder(), httptest.NewRequest("GET", "http://a.com/static/app.js", nil))
+	w.Write([]byte("js"))
+	store()
+
+	// The cookie is stripped before the cache is checked, so it's a hit.
+	r := httptest.NewRequest("GET", "http://a.com/static/app.js", nil)
+	r.Header.Set("Cookie", "session=1")
+	if route := p.Explain(r); route.Handler != "cache" || route.Wake {
+		t.Errorf("route = %+v, want a cache hit after the header rewrite", route)
+	}
+	if r.Header.Get("Cookie") == "" {
+		t.Error("explaining a route must not rewrite the request")
+	}
+
+	r.RemoteAddr = "203.0.113.7:5000"
+	jail.Strike("203.0.113.7", "test")
+	if route := p.Explain(r); route.Kind != "banned" || route.Status != http.StatusForbidden {
+		t.Errorf("route = %+v, want the jailed client turned away", route)
+	}
+	sw := httptest.NewRecorder()
+	p.ServeHTTP(sw, r)
+	if sw.Code != http.StatusForbidden {
+		t.Errorf("serving the jailed client: %d, want 403", sw.Code)
+	}
+}
+
+func TestExplainServiceRedirectAndUnknown(t *testing.T) {
+	registry := services.NewRegistry(testLogger())
+	p := New(registry, "", testLogger())
+	target, _ := url.Parse("http://10.0.0.1:3000")
+	p.Register("a.com", "a", target, &mockPolicy{state: "sleeping"})
+	registry.RegisterUnsafe("preview.a.com", "http://10.0.0.2:8000", "a")
+	table, err := redirect.New([]redirect.Rule{{From: "www.a.com", To: "a.com"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.SetRedirects(table)
+
+	route := p.Explain(httptest.NewRequest("GET", "http://preview.a.com/x", nil))
+	if route.Kind != "service" || route.Service != "preview.a.com" || route.Agent != "a" || route.Target != "http://10.0.0.2:8000" {
+		t.Errorf("service route = %+v", route)
+	}
+	if !route.Wake || route.WakeResponse != "splash" {
+		t.Errorf("service route = %+v, want it to wake its sleeping owner", route)
+	}
+
+	route = p.Explain(httptest.NewRequest("GET", "http://www.a.com/docs", nil))
+	if route.Kind != "redirect" || route.Redirect != "http://a.com/docs" || route.Status != http.StatusMovedPermanently {
+		t.Errorf("redirect route = %+v", route)
+	}
+
+	route = p.Explain(httptest.NewRequest("GET", "http://nope.com/", nil))
+	if route.Kind != "none" || route.Status != http.StatusNotFound {
+		t.Errorf("unknown route = %+v, want 404", route)
+	}
+}
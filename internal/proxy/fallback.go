@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"warren/internal/services"
+)
+
+// defaultServiceWakeHold bounds how long a service request waits for its
+// agent under fallback wake when the agent has no wake_hold of its own.
+const defaultServiceWakeHold = 30 * time.Second
+
+// Attempts at reaching a dynamic service, in the order fallbacks try them.
+const (
+	attemptTarget = iota
+	attemptAfterWake
+	attemptFallbackURL
+)
+
+// serveServiceTarget forwards a request to the service's target, or to its
+// fallback URL for attemptFallbackURL. A connection failure moves on to the
+// service's next fallback.
+func (p *Proxy) serveServiceTarget(w http.ResponseWriter, r *http.Request, hostname string, svc *services.Service, attempt int) {
+	rp := *svc.Proxy // a copy, so the error handler can know the attempt
+	if attempt == attemptFallbackURL {
+		rp = *svc.FallbackProxy
+	}
+	if fb := svc.Fallback; fb != nil && (fb.Retries > 0 || attempt == attemptAfterWake) {
+		next := rp.Transport
+		if next == nil {
+			next = http.DefaultTransport
+		}
+		rp.Transport = &retryTransport{next: next, logger: p.logger}
+		// A woken agent may still be binding its port, so retry then even
+		// without configured retries.
+		r = withRetry(r, &Retry{Attempts: fb.Retries})
+	}
+	rp.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		if bodyTooLarge(w, err) {
+			return
+		}
+		svc.Stats.RecordFailure()
+		p.logger.Error("dynamic service proxy error", "hostname", hostname, "error", err)
+		p.serviceFallback(w, r, hostname, svc, attempt, err)
+	}
+	rp.ServeHTTP(w, r)
+}
+
+// serviceFallback answers a request whose attempt failed with err with the
+// service's next fallback, or a plain 502 (504 if it timed out).
+func (p *Proxy) serviceFallback(w http.ResponseWriter, r *http.Request, hostname string, svc *services.Service, failed int, err error) {
+	fb := svc.Fallback
+	if fb == nil {
+		code, msg := gatewayStatus(err)
+		http.Error(w, msg, code)
+		return
+	}
+	resend := (r.Body == nil || r.Body == http.NoBody) && r.Context().Err() == nil
+
+	if resend && fb.Wake && failed < attemptAfterWake {
+		if owner, _ := p.agentBackend(svc.Agent); owner != nil {
+			hold := owner.Options.WakeHold
+			if hold <= 0 {
+				hold = defaultServiceWakeHold
+			}
+			p.ws.Inc(hostname)
+			err := waitRoutable(r.Context(), owner.Policy, hold)
+			p.ws.Dec(hostname)
+			if err == nil {
+				p.serveServiceTarget(w, r, hostname, svc, attemptAfterWake)
+				return
+			}
+		}
+	}
+
+	if resend && svc.FallbackProxy != nil && failed < attemptFallbackURL {
+		svc.Stats.RecordFallback()
+		p.serveServiceTarget(w, r, hostname, svc, attemptFallbackURL)
+		return
+	}
+
+	if fb.Page != "" {
+		if failed != attemptFallbackURL {
+			svc.Stats.RecordFallback() // already counted when handed to the URL
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusBadGateway)
+		_, _ = io.WriteString(w, fb.Page)
+		return
+	}
+	code, msg := gatewayStatus(err)
+	http.Error(w, msg, code)
+}
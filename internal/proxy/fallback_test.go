@@ -0,0 +1,162 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"warren/internal/services"
+)
+
+// downService registers a service whose target refuses connections.
+func downService(t *testing.T, fb *services.Fallback) (*Proxy, *services.Service) {
+	t.Helper()
+	registry := services.NewRegistry(testLogger())
+	p := New(registry, "", testLogger())
+	registry.RegisterUnsafe("svc.com", "http://127.0.0.1:1", "a")
+	svc, _ := registry.Lookup("svc.com")
+	svc.Fallback = fb
+	svc.Stats = &services.Stats{}
+	return p, svc
+}
+
+func TestServiceFallbackPage(t *testing.T) {
+	p, svc := downService(t, &services.Fallback{Page: "<h1>back soon</h1>"})
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", "http://svc.com/", nil))
+	if w.Code != http.StatusBadGateway || w.Body.String() != "<h1>back soon</h1>" {
+		t.Errorf("got %d %q, want 502 with the fallback page", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Content-Type = %q, want text/html", ct)
+	}
+	if svc.Stats.Failures() != 1 || svc.Stats.Fallbacks() != 1 {
+		t.Errorf("failures, fallbacks = %d, %d, want 1, 1", svc.Stats.Failures(), svc.Stats.Fallbacks())
+	}
+}
+
+func TestServiceFallbackURL(t *testing.T) {
+	spare := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("spare " + r.URL.Path))
+	}))
+	defer spare.Close()
+	u, _ := url.Parse(spare.URL)
+
+	p, svc := downService(t, &services.Fallback{URL: spare.URL, Page: "unused"})
+	svc.FallbackProxy = httputil.NewSingleHostReverseProxy(u)
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", "http://svc.com/status", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "spare /status" {
+		t.Errorf("got %d %q, want the fallback target's response", w.Code, w.Body.String())
+	}
+
+	// A request with a body can't be re-sent, so it gets the page.
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("POST", "http://svc.com/", strings.NewReader("data")))
+	if w.Code != http.StatusBadGateway || w.Body.String() != "unused" {
+		t.Errorf("POST got %d %q, want the fallback page", w.Code, w.Body.String())
+	}
+	if svc.Stats.Failures() != 2 || svc.Stats.Fallbacks() != 2 {
+		t.Errorf("failures, fallbacks = %d, %d, want 2, 2", svc.Stats.Failures(), svc.Stats.Fallbacks())
+	}
+}
+
+// serveLater starts a server on a free address after delay, for targets
+// that come up while a request is being retried.
+func serveLater(t *testing.T, delay time.Duration, body string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	})}
+	time.AfterFunc(delay, func() {
+		if ln, err := net.Listen("tcp", addr); err == nil {
+			srv.Serve(ln) //nolint:errcheck
+		}
+	})
+	t.Cleanup(func() { srv.Close() })
+	return addr
+}
+
+func TestServiceFallbackRetries(t *testing.T) {
+	addr := serveLater(t, 100*time.Millisecond, "up")
+	registry := services.NewRegistry(testLogger())
+	p := New(registry, "", testLogger())
+	registry.RegisterUnsafe("svc.com", "http://"+addr, "a")
+	svc, _ := registry.Lookup("svc.com")
+	svc.Fallback = &services.Fallback{Retries: 5}
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", "http://svc.com/", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "up" {
+		t.Errorf("got %d %q, want the retried response", w.Code, w.Body.String())
+	}
+}
+
+func TestServiceFallbackWake(t *testing.T) {
+	// The owning agent is up but the service's port isn't bound yet.
+	addr := serveLater(t, 100*time.Millisecond, "woken")
+	registry := services.NewRegistry(testLogger())
+	p := New(registry, "", testLogger())
+	target, _ := url.Parse("http://127.0.0.1:1")
+	pol := &mockPolicy{state: "ready"}
+	p.Register("a.com", "a", target, pol)
+	registry.RegisterUnsafe("svc.com", "http://"+addr, "a")
+	svc, _ := registry.Lookup("svc.com")
+	svc.Fallback = &services.Fallback{Wake: true}
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", "http://svc.com/", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "woken" {
+		t.Errorf("got %d %q, want the response after waking", w.Code, w.Body.String())
+	}
+	if !pol.woken {
+		t.Error("expected the owning agent to be woken")
+	}
+}
+
+func TestServiceAPIFallback(t *testing.T) {
+	registry := services.NewRegistry(testLogger())
+	p := New(registry, "", testLogger())
+
+	w := httptest.NewRecorder()
+	p.HandleServiceAPI(w, httptest.NewRequest("POST", "/api/services", strings.NewReader(
+		`{"hostname":"x.com","target":"http://10.0.0.1:80","fallback":{"retries":99,"url":"spare","wake":true}}`)))
+	if w.Code != 422 {
+		t.Fatalf("status = %d, want 422", w.Code)
+	}
+	for _, field := range []string{`"field":"fallback.retries"`, `"field":"fallback.url"`, `"field":"fallback.wake"`} {
+		if !strings.Contains(w.Body.String(), field) {
+			t.Errorf("missing %s in %s", field, w.Body.String())
+		}
+	}
+
+	w = httptest.NewRecorder()
+	p.HandleServiceAPI(w, httptest.NewRequest("POST", "/api/services", strings.NewReader(
+		`{"hostname":"x.com","target":"http://10.0.0.1:80","agent":"a","fallback":{"retries":2,"url":"http://10.0.0.9:80","wake":true}}`)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	svc, _ := registry.Lookup("x.com")
+	if svc.Fallback == nil || svc.Fallback.Retries != 2 || svc.FallbackProxy == nil {
+		t.Errorf("fallback = %+v, proxy %v", svc.Fallback, svc.FallbackProxy)
+	}
+
+	w = httptest.NewRecorder()
+	p.HandleServiceAPI(w, httptest.NewRequest("GET", "/api/services/x.com", nil))
+	if !strings.Contains(w.Body.String(), `"stats":{"failures":0,"fallbacks":0}`) {
+		t.Errorf("service detail missing stats: %s", w.Body.String())
+	}
+}
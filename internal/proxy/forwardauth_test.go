@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"warren/internal/auth"
+	"warren/internal/services"
+)
+
+func TestForwardAuth_Backend(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("user=" + r.Header.Get("X-Auth-User")))
+	}))
+	defer backend.Close()
+
+	authSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Cookie") != "session=ok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("X-Auth-User", "alice")
+	}))
+	defer authSrv.Close()
+
+	fwd, err := auth.NewForward(authSrv.URL, nil, []string{"X-Auth-User"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The global proxy token must not be required on a forward-auth hostname.
+	p := New(services.NewRegistry(testLogger()), "secret-token", testLogger())
+	u, _ := url.Parse(backend.URL)
+	p.RegisterWithOptions("a.com", "a", u, &mockPolicy{state: "ready"}, RouteOptions{ForwardAuth: fwd})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Host = "a.com"
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	if w.Code != 401 {
+		t.Fatalf("no session: status = %d, want 401", w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Host = "a.com"
+	req.Header.Set("Cookie", "session=ok")
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	if w.Code != 200 || w.Body.String() != "user=alice" {
+		t.Fatalf("with session: status = %d, body = %q", w.Code, w.Body.String())
+	}
+
+	// Health checks bypass forward auth.
+	req = httptest.NewRequest("GET", "/api/health", nil)
+	req.Host = "a.com"
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("health: status = %d, want 200", w.Code)
+	}
+}
@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// gRPC status codes the proxy answers with itself.
+const (
+	grpcUnavailable       = 14
+	grpcResourceExhausted = 8
+	grpcUnauthenticated   = 16
+	grpcPermissionDenied  = 7
+)
+
+// IsGRPC reports whether r is a gRPC call, by its content type.
+func IsGRPC(r *http.Request) bool {
+	ct := r.Header.Get("Content-Type")
+	return ct == "application/grpc" || strings.HasPrefix(ct, "application/grpc+") || strings.HasPrefix(ct, "application/grpc;")
+}
+
+// grpcStatus maps an HTTP status the proxy would have sent to a gRPC code,
+// following gRPC's HTTP-to-status mapping.
+func grpcStatus(code int) int {
+	switch code {
+	case http.StatusUnauthorized:
+		return grpcUnauthenticated
+	case http.StatusForbidden:
+		return grpcPermissionDenied
+	case http.StatusRequestEntityTooLarge:
+		return grpcResourceExhausted
+	default:
+		return grpcUnavailable
+	}
+}
+
+// grpcError answers a gRPC call with a Trailers-Only response: HTTP 200
+// with grpc-status in the headers, which gRPC clients understand and retry
+// on UNAVAILABLE, unlike a bare HTTP error.
+func grpcError(w http.ResponseWriter, code int, msg string) {
+	h := w.Header()
+	h.Set("Content-Type", "application/grpc")
+	h.Set("Grpc-Status", strconv.Itoa(grpcStatus(code)))
+	h.Set("Grpc-Message", url.PathEscape(msg))
+	w.WriteHeader(http.StatusOK)
+}
+
+// grpcAuthRecorder stands in for the response writer while forward auth
+// checks a gRPC call, keeping only the status the auth service answered.
+type grpcAuthRecorder struct {
+	header http.Header
+	code   int
+}
+
+func (g *grpcAuthRecorder) Header() http.Header         { return g.header }
+func (g *grpcAuthRecorder) Write(b []byte) (int, error) { return len(b), nil }
+func (g *grpcAuthRecorder) WriteHeader(code int)        { g.code = code }
+
+// serveGRPC forwards a gRPC call, counting it as an open connection while
+// it lasts so that long-lived streams keep the agent awake like
+// WebSockets do, and touching activity again when it ends.
+func (p *Proxy) serveGRPC(w http.ResponseWriter, r *http.Request, hostname string, next http.Handler) {
+	p.ws.Inc(hostname)
+	defer func() {
+		p.ws.Dec(hostname)
+		p.activity.Touch(hostname)
+	}()
+	next.ServeHTTP(w, r)
+}
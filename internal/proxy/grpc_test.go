@@ -0,0 +1,151 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"warren/internal/services"
+	"warren/internal/transport"
+)
+
+// h2cServer starts a server accepting HTTP/2 without TLS, as gRPC needs.
+func h2cServer(h http.Handler) *httptest.Server {
+	s := httptest.NewUnstartedServer(h)
+	s.Config.Protocols = new(http.Protocols)
+	s.Config.Protocols.SetHTTP1(true)
+	s.Config.Protocols.SetUnencryptedHTTP2(true)
+	s.Start()
+	return s
+}
+
+func grpcCall(t *testing.T, url string) *http.Response {
+	t.Helper()
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: &protocols}}
+	req, _ := http.NewRequest("POST", url+"/echo.Echo/Say", strings.NewReader("\x00\x00\x00\x00\x02hi"))
+	req.Host = "a.com"
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("call: %v", err)
+	}
+	return resp
+}
+
+func TestGRPCProxiesTrailersAndCountsCalls(t *testing.T) {
+	var p *Proxy
+	var open int64
+	backend := h2cServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		open = p.WSCounter().Count("a.com")
+		if r.ProtoMajor != 2 {
+			t.Errorf("backend saw %s, want HTTP/2", r.Proto)
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+		_, _ = w.Write(body)
+	}))
+	defer backend.Close()
+	target, _ := url.Parse(backend.URL)
+
+	p = New(services.NewRegistry(testLogger()), "", testLogger())
+	p.RegisterWithOptions("a.com", "a", target, &mockPolicy{state: "ready"}, RouteOptions{GRPC: true, Protocol: transport.H2C})
+	front := h2cServer(p)
+	defer front.Close()
+
+	resp := grpcCall(t, front.URL)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "\x00\x00\x00\x00\x02hi" {
+		t.Errorf("body = %q", body)
+	}
+	if got := resp.Trailer.Get("Grpc-Status"); got != "0" {
+		t.Errorf("grpc-status trailer = %q, want 0 (trailers %v)", got, resp.Trailer)
+	}
+	if open != 1 {
+		t.Errorf("open calls during the call = %d, want 1", open)
+	}
+	if n := p.WSCounter().Count("a.com"); n != 0 {
+		t.Errorf("open calls after = %d, want 0", n)
+	}
+	if p.Activity().LastActivity("a.com").IsZero() {
+		t.Error("call not recorded as activity")
+	}
+}
+
+func TestGRPCErrorsAreStatuses(t *testing.T) {
+	p := New(services.NewRegistry(testLogger()), "", testLogger())
+	dead, _ := url.Parse("http://127.0.0.1:1")
+	pol := &mockPolicy{state: "sleeping"}
+	p.RegisterWithOptions("a.com", "a", dead, pol, RouteOptions{GRPC: true, Protocol: transport.H2C})
+	front := h2cServer(p)
+	defer front.Close()
+
+	// Asleep: UNAVAILABLE, so clients retry.
+	resp := grpcCall(t, front.URL)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Grpc-Status") != "14" {
+		t.Errorf("sleeping: status %d, grpc-status %q, want 200 and 14", resp.StatusCode, resp.Header.Get("Grpc-Status"))
+	}
+	if !pol.woken {
+		t.Error("call did not wake the agent")
+	}
+
+	// Unreachable backend: UNAVAILABLE instead of a 502.
+	pol.state = "ready"
+	resp = grpcCall(t, front.URL)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Grpc-Status") != "14" {
+		t.Errorf("bad gateway: status %d, grpc-status %q, want 200 and 14", resp.StatusCode, resp.Header.Get("Grpc-Status"))
+	}
+}
+
+func TestGRPCAuthFailuresAreStatuses(t *testing.T) {
+	p := New(services.NewRegistry(testLogger()), "secret", testLogger())
+	dead, _ := url.Parse("http://127.0.0.1:1")
+	p.RegisterWithOptions("a.com", "a", dead, &mockPolicy{state: "ready"}, RouteOptions{GRPC: true, Protocol: transport.H2C})
+	front := h2cServer(p)
+	defer front.Close()
+
+	resp := grpcCall(t, front.URL)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Grpc-Status") != "16" {
+		t.Errorf("no token: status %d, grpc-status %q, want 200 and 16", resp.StatusCode, resp.Header.Get("Grpc-Status"))
+	}
+}
+
+func TestH2COnlyForGRPCRoutes(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+	target, _ := url.Parse(backend.URL)
+
+	p := New(services.NewRegistry(testLogger()), "", testLogger())
+	p.RegisterWithOptions("a.com", "a", target, &mockPolicy{state: "ready"}, RouteOptions{})
+	front := h2cServer(p)
+	defer front.Close()
+
+	// Prior-knowledge HTTP/2 to a plain route is turned away...
+	resp := grpcCall(t, front.URL)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusHTTPVersionNotSupported {
+		t.Errorf("h2c to a non-gRPC route: status %d, want 505", resp.StatusCode)
+	}
+
+	// ...while HTTP/1.1 is served as usual.
+	req, _ := http.NewRequest("GET", front.URL, nil)
+	req.Host = "a.com"
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("HTTP/1.1: status %d, want 200", resp.StatusCode)
+	}
+}
@@ -0,0 +1,95 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+
+	"warren/internal/headers"
+	"warren/internal/services"
+)
+
+func TestRouteHeaders(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "gunicorn")
+		w.Header().Set("X-Seen-Key", r.Header.Get("X-Api-Key"))
+		w.Header().Set("X-Seen-Cookie", r.Header.Get("Cookie"))
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+	target, _ := url.Parse(backend.URL)
+
+	rw, err := headers.New(headers.Config{
+		Request:  headers.Rules{Set: map[string]string{"X-Api-Key": "backend-key"}, Remove: []string{"Cookie"}},
+		Response: headers.Rules{Remove: []string{"Server"}, Set: map[string]string{"X-Served-By": "warren"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := New(services.NewRegistry(testLogger()), "", testLogger())
+	p.RegisterWithOptions("a.com", "a", target, &mockPolicy{state: "ready"}, RouteOptions{Headers: rw})
+
+	req := httptest.NewRequest("GET", "http://a.com/", nil)
+	req.Header.Set("X-Api-Key", "client-supplied")
+	req.Header.Set("Cookie", "session=1")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+
+	if w.Code != 200 {
+		t.Fatalf("status = %d", w.Code)
+	}
+	for name, want := range map[string]string{
+		"X-Seen-Key":    "backend-key",
+		"X-Seen-Cookie": "",
+		"Server":        "",
+		"X-Served-By":   "warren",
+	} {
+		if got := w.Header().Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestServiceAPIHeaders(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "gunicorn")
+		w.Header().Set("X-Seen-Token", r.Header.Get("X-Token"))
+	}))
+	defer backend.Close()
+
+	registry := services.NewRegistry(testLogger())
+	p := New(registry, "", testLogger())
+
+	w := httptest.NewRecorder()
+	p.HandleServiceAPI(w, httptest.NewRequest("POST", "/api/services", strings.NewReader(
+		`{"hostname":"x.com","target":"http://10.0.0.1:80","headers":{"request":{"set":{"X-Token":"t"}},"response":{"remove":["Server"]}}}`)))
+	if w.Code != 201 {
+		t.Fatalf("register: %d %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	p.HandleServiceAPI(w, httptest.NewRequest("GET", "/api/services/x.com", nil))
+	if !strings.Contains(w.Body.String(), `"headers":"request: set X-Token; response: remove Server"`) {
+		t.Errorf("inspect = %s", w.Body.String())
+	}
+
+	// The registry refuses loopback targets, so serve the registered
+	// rewrites against the test backend directly.
+	svc, _ := registry.Lookup("x.com")
+	target, _ := url.Parse(backend.URL)
+	local := &services.Service{Hostname: "x.com", TargetURL: target, Proxy: httputil.NewSingleHostReverseProxy(target), Headers: svc.Headers}
+	w = httptest.NewRecorder()
+	p.serveDynamicService(w, httptest.NewRequest("GET", "http://x.com/", nil), "x.com", local)
+	if w.Header().Get("X-Seen-Token") != "t" || w.Header().Get("Server") != "" {
+		t.Errorf("proxied headers = %v", w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	p.HandleServiceAPI(w, httptest.NewRequest("POST", "/api/services", strings.NewReader(
+		`{"hostname":"z.com","target":"http://10.0.0.1:80","headers":{"request":{"set":{"Host":"evil"}}}}`)))
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "Host can't be rewritten") {
+		t.Errorf("reserved header: %d %s", w.Code, w.Body.String())
+	}
+}
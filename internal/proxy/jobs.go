@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"warren/internal/policy"
+)
+
+// defaultJobTTL applies when a job is registered without a ttl.
+const defaultJobTTL = time.Hour
+
+// Job is an in-flight unit of work an agent has asked Warren not to
+// interrupt.
+type Job struct {
+	ID          string    `json:"id"`
+	Description string    `json:"description,omitempty"`
+	StartedAt   time.Time `json:"started_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// JobTracker records in-flight jobs per agent. Jobs block sleep until they
+// are completed or their TTL expires.
+type JobTracker struct {
+	mu   sync.Mutex
+	jobs map[string]map[string]Job // agent → id → job
+}
+
+// NewJobTracker creates an empty job tracker.
+func NewJobTracker() *JobTracker {
+	return &JobTracker{jobs: make(map[string]map[string]Job)}
+}
+
+// Add registers a job for an agent. An empty id is generated. Registering an
+// existing id refreshes its TTL.
+func (t *JobTracker) Add(agent, id, description string, ttl time.Duration) Job {
+	if id == "" {
+		id = uuid.New().String()
+	}
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.jobs[agent] == nil {
+		t.jobs[agent] = make(map[string]Job)
+	}
+	job, ok := t.jobs[agent][id]
+	if !ok {
+		job = Job{ID: id, StartedAt: now}
+	}
+	if description != "" {
+		job.Description = description
+	}
+	job.ExpiresAt = now.Add(ttl)
+	t.jobs[agent][id] = job
+	return job
+}
+
+// Complete removes a job, reporting whether it was in flight.
+func (t *JobTracker) Complete(agent, id string) (Job, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pruneLocked(agent, time.Now())
+	job, ok := t.jobs[agent][id]
+	if ok {
+		delete(t.jobs[agent], id)
+	}
+	return job, ok
+}
+
+// List returns an agent's unexpired jobs, oldest first.
+func (t *JobTracker) List(agent string) []Job {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pruneLocked(agent, time.Now())
+	list := make([]Job, 0, len(t.jobs[agent]))
+	for _, j := range t.jobs[agent] {
+		list = append(list, j)
+	}
+	sort.Slice(list, func(i, k int) bool { return list[i].StartedAt.Before(list[k].StartedAt) })
+	return list
+}
+
+// Forget drops all jobs for an agent, e.g. when it is removed.
+func (t *JobTracker) Forget(agent string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.jobs, agent)
+}
+
+// SleepGuard returns a policy guard that keeps the agent awake while it has
+// jobs in flight, re-checking when the earliest job expires.
+func (t *JobTracker) SleepGuard(agent string) policy.SleepGuard {
+	return func(context.Context) (time.Duration, string) {
+		jobs := t.List(agent)
+		if len(jobs) == 0 {
+			return 0, ""
+		}
+		earliest := jobs[0].ExpiresAt
+		for _, j := range jobs[1:] {
+			if j.ExpiresAt.Before(earliest) {
+				earliest = j.ExpiresAt
+			}
+		}
+		d := time.Until(earliest)
+		if d < time.Second {
+			d = time.Second
+		}
+		return d, fmt.Sprintf("%d job(s) in flight", len(jobs))
+	}
+}
+
+func (t *JobTracker) pruneLocked(agent string, now time.Time) {
+	for id, j := range t.jobs[agent] {
+		if !now.Before(j.ExpiresAt) {
+			delete(t.jobs[agent], id)
+		}
+	}
+}
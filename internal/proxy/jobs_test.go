@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJobTracker(t *testing.T) {
+	jt := NewJobTracker()
+	guard := jt.SleepGuard("a")
+	if d, _ := guard(context.Background()); d != 0 {
+		t.Fatalf("no jobs: guard deferred %v", d)
+	}
+
+	job := jt.Add("a", "", "nightly batch", time.Minute)
+	if job.ID == "" {
+		t.Fatal("expected generated id")
+	}
+	jt.Add("a", "short", "", 10*time.Second)
+
+	d, reason := guard(context.Background())
+	if d <= 0 || d > 10*time.Second || !strings.Contains(reason, "2 job") {
+		t.Errorf("guard = %v %q, want <=10s with 2 jobs", d, reason)
+	}
+	if jobs := jt.List("a"); len(jobs) != 2 || jobs[0].ID != job.ID {
+		t.Errorf("List = %+v", jobs)
+	}
+
+	if _, ok := jt.Complete("a", job.ID); !ok {
+		t.Error("expected job to complete")
+	}
+	if _, ok := jt.Complete("a", job.ID); ok {
+		t.Error("completing twice should fail")
+	}
+
+	// Expired jobs are pruned and no longer block sleep.
+	jt.Add("b", "x", "", -time.Second)
+	if jobs := jt.List("b"); len(jobs) != 0 {
+		t.Errorf("expired job still listed: %+v", jobs)
+	}
+}
+
+func TestAgentJobsAPI(t *testing.T) {
+	p := setupAgentAPI(t, "agent-secret")
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer agent-secret")
+		w := httptest.NewRecorder()
+		p.HandleAgentAPI(w, req)
+		return w
+	}
+
+	w := do("POST", "/api/agents/a/jobs", `{"id":"batch-1","description":"reindex","ttl":"2h"}`)
+	if w.Code != 201 {
+		t.Fatalf("add: status = %d: %s", w.Code, w.Body.String())
+	}
+	var job Job
+	json.Unmarshal(w.Body.Bytes(), &job)
+	if job.ID != "batch-1" || time.Until(job.ExpiresAt) < 119*time.Minute {
+		t.Errorf("unexpected job: %+v", job)
+	}
+
+	if w := do("POST", "/api/agents/a/jobs", `{"ttl":"forever"}`); w.Code != 400 {
+		t.Errorf("bad ttl: status = %d, want 400", w.Code)
+	}
+
+	w = do("GET", "/api/agents/a/jobs", "")
+	var jobs []Job
+	json.Unmarshal(w.Body.Bytes(), &jobs)
+	if len(jobs) != 1 {
+		t.Fatalf("list = %s", w.Body.String())
+	}
+
+	if w := do("POST", "/api/agents/a/jobs/batch-1/complete", ""); w.Code != 200 {
+		t.Fatalf("complete: status = %d: %s", w.Code, w.Body.String())
+	}
+	if p.Activity().LastActivity("a.com").IsZero() {
+		t.Error("completing a job should touch activity")
+	}
+	if w := do("DELETE", "/api/agents/a/jobs/batch-1", ""); w.Code != 404 {
+		t.Errorf("complete again: status = %d, want 404", w.Code)
+	}
+}
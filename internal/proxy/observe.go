@@ -0,0 +1,36 @@
+package proxy
+
+import (
+	"net/http"
+	"time"
+)
+
+// RequestObserver is told about every request proxied to a backend or
+// dynamic service once its response is complete.
+type RequestObserver func(r *http.Request, agent string, code int, d time.Duration)
+
+// SetRequestObserver sets the function that records proxied requests, e.g.
+// for metrics and access logs. nil disables it.
+func (p *Proxy) SetRequestObserver(fn RequestObserver) {
+	if fn == nil {
+		p.observer.Store(nil)
+		return
+	}
+	p.observer.Store(&fn)
+}
+
+// observe starts timing a request for the observer, if one is set. It
+// returns the writer to respond through and a func to call when done.
+func (p *Proxy) observe(w http.ResponseWriter, r *http.Request, agent string) (http.ResponseWriter, func()) {
+	fn := p.observer.Load()
+	if fn == nil {
+		return w, func() {}
+	}
+	start := time.Now()
+	if IsWebSocket(r) {
+		// The connection is hijacked, so there's no status to record.
+		return w, func() { (*fn)(r, agent, http.StatusSwitchingProtocols, time.Since(start)) }
+	}
+	rec := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+	return rec, func() { (*fn)(r, agent, rec.code, time.Since(start)) }
+}
@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"warren/internal/services"
+)
+
+func TestRequestObserver(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer backend.Close()
+	target, _ := url.Parse(backend.URL)
+
+	registry := services.NewRegistry(testLogger())
+	p := New(registry, "", testLogger())
+	p.Register("a.com", "agent-a", target, &mockPolicy{state: "ready"})
+	registry.RegisterUnsafe("svc.com", backend.URL, "agent-b")
+
+	type observed struct {
+		agent string
+		code  int
+	}
+	var got []observed
+	p.SetRequestObserver(func(r *http.Request, agent string, code int, d time.Duration) {
+		got = append(got, observed{agent, code})
+	})
+
+	for _, host := range []string{"a.com", "svc.com", "unknown.com"} {
+		p.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://"+host+"/", nil))
+	}
+	want := []observed{{"agent-a", http.StatusTeapot}, {"agent-b", http.StatusTeapot}}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("observed %v, want %v", got, want)
+	}
+
+	p.SetRequestObserver(nil)
+	p.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://a.com/", nil))
+	if len(got) != 2 {
+		t.Errorf("observer called after being removed")
+	}
+}
@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"warren/internal/cache"
+)
+
+// pathBlocked reports whether an agent's allowed_paths turn r away.
+// Warren's own health and wake endpoints are always allowed.
+func pathBlocked(r *http.Request, allowed []string) bool {
+	if len(allowed) == 0 {
+		return false
+	}
+	if (r.URL.Path == "/api/health" && r.Method == http.MethodGet) || (r.URL.Path == "/api/wake" && r.Method == http.MethodPost) {
+		return false
+	}
+	return !cache.MatchPath(allowed, cleanPath(r.URL.Path))
+}
+
+// cleanPath resolves the dot segments in a decoded request path, so
+// "/static/../wp-admin" and its %2e%2e form are matched as the /wp-admin
+// the backend will serve. A trailing slash is kept, since patterns such as
+// "/api/" depend on it.
+func cleanPath(p string) string {
+	cleaned := path.Clean("/" + p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// blockedCounter counts requests turned away by agents' allowed_paths. The
+// zero value is ready to use.
+type blockedCounter struct {
+	counts sync.Map // agent → *atomic.Int64
+}
+
+func (c *blockedCounter) add(agent string) {
+	v, _ := c.counts.LoadOrStore(agent, new(atomic.Int64))
+	v.(*atomic.Int64).Add(1)
+}
+
+// BlockedPaths returns how many requests each agent's allowed_paths has
+// rejected since startup, for agents that have rejected any.
+func (p *Proxy) BlockedPaths() map[string]int64 {
+	out := make(map[string]int64)
+	p.blocked.counts.Range(func(k, v any) bool {
+		out[k.(string)] = v.(*atomic.Int64).Load()
+		return true
+	})
+	return out
+}
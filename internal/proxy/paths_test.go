@@ -0,0 +1,113 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"warren/internal/services"
+)
+
+func TestAllowedPathsBlockProbes(t *testing.T) {
+	var hits atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+	target, _ := url.Parse(backend.URL)
+
+	pol := &mockPolicy{state: "sleeping"}
+	p := New(services.NewRegistry(testLogger()), "secret", testLogger())
+	p.RegisterWithOptions("a.com", "a", target, pol, RouteOptions{AllowedPaths: []string{"/api/", "/ws", "*.js"}})
+
+	// Dot segments are resolved before matching, whether sent plainly or
+	// percent-encoded.
+	for _, path := range []string{"/wp-admin/install.php", "/.env", "/api", "/wsx", "/api/../wp-admin/install.php", "/api/%2e%2e/.env"} {
+		w := httptest.NewRecorder()
+		// No token: blocked paths are answered before auth.
+		p.ServeHTTP(w, httptest.NewRequest("GET", "http://a.com"+path, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("GET %s = %d, want 404", path, w.Code)
+		}
+	}
+	if pol.woken || hits.Load() != 0 {
+		t.Errorf("blocked probes woke the agent (%v) or reached it (%d requests)", pol.woken, hits.Load())
+	}
+	if got := p.BlockedPaths()["a"]; got != 6 {
+		t.Errorf("BlockedPaths()[a] = %d, want 6", got)
+	}
+
+	// Allowed paths and Warren's own health endpoint go through as usual.
+	pol.state = "ready"
+	for _, path := range []string{"/api/chat", "/ws", "/static/app.js", "/api/health", "/api/./chat"} {
+		req := httptest.NewRequest("GET", "http://a.com"+path, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("GET %s = %d, want 200", path, w.Code)
+		}
+	}
+	if got := p.BlockedPaths()["a"]; got != 6 {
+		t.Errorf("allowed requests were counted as blocked: %d", got)
+	}
+
+	route := p.Explain(httptest.NewRequest("GET", "http://a.com/wp-admin/", nil))
+	if route.Handler != "blocked" || route.Status != http.StatusNotFound || route.Wake {
+		t.Errorf("route = %+v, want a blocked 404", route)
+	}
+	if got := p.BlockedPaths()["a"]; got != 6 {
+		t.Errorf("explaining a route counted it as blocked: %d", got)
+	}
+}
+
+func TestAllowedPathsCoverAgentServices(t *testing.T) {
+	var hits atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer backend.Close()
+	target, _ := url.Parse(backend.URL)
+
+	registry := services.NewRegistry(testLogger())
+	registry.RegisterUnsafe("dash.a.com", backend.URL, "a")
+	p := New(registry, "", testLogger())
+	p.RegisterWithOptions("a.com", "a", target, &mockPolicy{state: "ready"}, RouteOptions{AllowedPaths: []string{"/api/"}})
+
+	for path, want := range map[string]int{"/api/x": 200, "/wp-admin": 404, "/api/../.env": 404} {
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, httptest.NewRequest("GET", "http://dash.a.com"+path, nil))
+		if w.Code != want {
+			t.Errorf("GET dash.a.com%s = %d, want %d", path, w.Code, want)
+		}
+	}
+	if hits.Load() != 1 {
+		t.Errorf("backend hits = %d, want only the allowed path", hits.Load())
+	}
+}
+
+func TestAllowedPathsCustom404(t *testing.T) {
+	page := filepath.Join(t.TempDir(), "404.html")
+	os.WriteFile(page, []byte(`<h1>Nothing at this address on {{.Hostname}}</h1>`), 0644)
+	pages, err := NewErrorPages(map[int]string{404: page})
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, _ := url.Parse("http://127.0.0.1:1")
+	p := New(services.NewRegistry(testLogger()), "", testLogger())
+	p.RegisterWithOptions("a.com", "a", target, &mockPolicy{state: "ready"}, RouteOptions{AllowedPaths: []string{"/app/"}, ErrorPages: pages})
+
+	req := httptest.NewRequest("GET", "http://a.com/wp-login.php", nil)
+	req.Header.Set("Accept", "text/html")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "Nothing at this address on a.com") {
+		t.Errorf("got %d %q, want the agent's 404 page", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,435 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"warren/internal/policy"
+)
+
+const (
+	// defaultPortWakeTimeout bounds how long a raw connection is held while
+	// its agent wakes.
+	defaultPortWakeTimeout = 60 * time.Second
+
+	// udpSessionTimeout ends a UDP flow after this long without datagrams
+	// from the client.
+	udpSessionTimeout = 60 * time.Second
+
+	// udpQueueSize is how many datagrams a UDP flow buffers while its agent
+	// wakes; later ones are dropped.
+	udpQueueSize = 64
+
+	// udpMaxFlows caps the UDP flows open on one port. Datagrams from new
+	// client addresses beyond it are dropped until flows end.
+	udpMaxFlows = 1024
+)
+
+// PortSpec describes a raw port forwarded to an agent.
+type PortSpec struct {
+	Proto       string // "tcp" or "udp"
+	Listen      int
+	Target      int
+	WakeTimeout time.Duration
+}
+
+// PortTarget is an agent whose raw ports are forwarded.
+type PortTarget struct {
+	Agent    string
+	Hostname string // primary hostname, used for activity and connection counts
+	Host     string // backend host the target ports are dialled on
+	Policy   policy.Policy
+	Ports    []PortSpec
+}
+
+// PortStatus is a forwarded port and how many connections it has open.
+type PortStatus struct {
+	Proto  string `json:"proto"`
+	Listen int    `json:"listen"`
+	Target int    `json:"target"`
+	Open   int64  `json:"open"` // TCP connections, or UDP client flows
+}
+
+// portListener is one open listener and its live connection count.
+type portListener struct {
+	spec   PortSpec
+	closer io.Closer
+	open   atomic.Int64
+}
+
+// PortForwarder accepts connections on agents' raw ports, wakes the agent and
+// splices each connection to the backend once it is ready. This lets
+// database-style, SSH and game-server clients use scale-to-zero agents. UDP
+// is forwarded per client address, with each datagram counting as activity.
+// A flow the backend has answered counts as an open connection until it
+// goes quiet; unanswered ones, such as from scanners or spoofed addresses,
+// don't keep the agent awake.
+type PortForwarder struct {
+	activity *ActivityTracker
+	conns    *WSCounter // open connections keep the agent awake like WebSockets
+	logger   *slog.Logger
+	listener Listener
+
+	// connCtx ends spliced connections. It outlives the context listeners
+	// are registered with, so on shutdown or an upgrade connections drain
+	// like WebSockets instead of being cut when the policies stop.
+	connCtx    context.Context
+	closeConns context.CancelFunc
+
+	mu     sync.Mutex
+	agents map[string][]*portListener
+}
+
+// NewPortForwarder creates a forwarder with no listeners.
+func NewPortForwarder(activity *ActivityTracker, conns *WSCounter, logger *slog.Logger) *PortForwarder {
+	connCtx, closeConns := context.WithCancel(context.Background())
+	return &PortForwarder{
+		activity:   activity,
+		conns:      conns,
+		logger:     logger.With("component", "ports"),
+		listener:   netListener{},
+		connCtx:    connCtx,
+		closeConns: closeConns,
+		agents:     make(map[string][]*portListener),
+	}
+}
+
+// CloseConnections ends the TCP connections still being spliced, once they
+// have had their chance to drain.
+func (f *PortForwarder) CloseConnections() {
+	f.closeConns()
+}
+
+// Listener opens the sockets the forwarder accepts on.
+// *handoff.Listeners satisfies it, so ports carry over to an upgraded
+// process.
+type Listener interface {
+	Listen(network, addr string) (net.Listener, error)
+	ListenPacket(network, addr string) (net.PacketConn, error)
+}
+
+type netListener struct{}
+
+func (netListener) Listen(network, addr string) (net.Listener, error) {
+	return net.Listen(network, addr)
+}
+
+func (netListener) ListenPacket(network, addr string) (net.PacketConn, error) {
+	return net.ListenPacket(network, addr)
+}
+
+// SetListener sets how sockets are opened for ports registered from now on.
+func (f *PortForwarder) SetListener(l Listener) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.listener = l
+}
+
+// Register opens listeners for the target's ports, replacing any the agent
+// already had. On error no listeners are left open for the agent.
+func (f *PortForwarder) Register(ctx context.Context, t PortTarget) error {
+	f.Unregister(t.Agent)
+	if len(t.Ports) == 0 {
+		return nil
+	}
+
+	var listeners []*portListener
+	for _, spec := range t.Ports {
+		l := &portListener{spec: spec}
+		if err := f.listen(ctx, t, l); err != nil {
+			for _, l := range listeners {
+				l.closer.Close()
+			}
+			return err
+		}
+		listeners = append(listeners, l)
+	}
+
+	f.mu.Lock()
+	f.agents[t.Agent] = listeners
+	f.mu.Unlock()
+	return nil
+}
+
+// Unregister closes an agent's listeners. Established connections are left
+// to finish.
+func (f *PortForwarder) Unregister(agent string) {
+	f.mu.Lock()
+	listeners := f.agents[agent]
+	delete(f.agents, agent)
+	f.mu.Unlock()
+	for _, l := range listeners {
+		l.closer.Close()
+	}
+}
+
+// Status returns the agent's forwarded ports with their open connection
+// counts, in config order.
+func (f *PortForwarder) Status(agent string) []PortStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var status []PortStatus
+	for _, l := range f.agents[agent] {
+		proto := l.spec.Proto
+		if proto == "" {
+			proto = "tcp"
+		}
+		status = append(status, PortStatus{Proto: proto, Listen: l.spec.Listen, Target: l.spec.Target, Open: l.open.Load()})
+	}
+	return status
+}
+
+func (f *PortForwarder) listen(ctx context.Context, t PortTarget, l *portListener) error {
+	spec := l.spec
+	switch spec.Proto {
+	case "", "tcp":
+		ln, err := f.listener.Listen("tcp", ":"+strconv.Itoa(spec.Listen))
+		if err != nil {
+			return fmt.Errorf("ports: agent %q: %w", t.Agent, err)
+		}
+		f.logger.Info("forwarding tcp port", "agent", t.Agent, "listen", spec.Listen, "target", spec.Target)
+		l.closer = ln
+		go f.serveTCP(ctx, ln, t, l)
+		return nil
+	case "udp":
+		pc, err := f.listener.ListenPacket("udp", ":"+strconv.Itoa(spec.Listen))
+		if err != nil {
+			return fmt.Errorf("ports: agent %q: %w", t.Agent, err)
+		}
+		f.logger.Info("forwarding udp port", "agent", t.Agent, "listen", spec.Listen, "target", spec.Target)
+		l.closer = pc
+		go f.serveUDP(ctx, pc, t, l)
+		return nil
+	default:
+		return fmt.Errorf("ports: agent %q: unsupported proto %q", t.Agent, spec.Proto)
+	}
+}
+
+func (f *PortForwarder) serveTCP(ctx context.Context, ln net.Listener, t PortTarget, l *portListener) {
+	stop := context.AfterFunc(ctx, func() { ln.Close() })
+	defer stop()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return // listener closed
+		}
+		go f.handleTCP(ctx, conn, t, l)
+	}
+}
+
+func (f *PortForwarder) handleTCP(ctx context.Context, client net.Conn, t PortTarget, l *portListener) {
+	defer client.Close()
+	spec := l.spec
+	logger := f.logger.With("agent", t.Agent, "port", spec.Listen)
+
+	// Count the connection from accept so the agent can't be slept while the
+	// client waits for it to wake.
+	f.conns.Inc(t.Hostname)
+	defer f.conns.Dec(t.Hostname)
+	l.open.Add(1)
+	defer l.open.Add(-1)
+	f.activity.Touch(t.Hostname)
+
+	timeout := spec.WakeTimeout
+	if timeout <= 0 {
+		timeout = defaultPortWakeTimeout
+	}
+	if err := waitRoutable(ctx, t.Policy, timeout); err != nil {
+		logger.Warn("dropping connection", "error", err)
+		return
+	}
+
+	addr := net.JoinHostPort(t.Host, strconv.Itoa(spec.Target))
+	backend, err := net.DialTimeout("tcp", addr, 10*time.Second)
+	if err != nil {
+		logger.Error("failed to dial backend", "backend", addr, "error", err)
+		return
+	}
+	defer backend.Close()
+
+	splice(f.connCtx, client, backend, t.Hostname, f.activity)
+}
+
+// splice copies between client and backend until both sides are done or ctx
+// ends, counting traffic in both directions as activity for hostname. When
+// one side finishes sending, only the other's write half is shut so a reply
+// still in flight gets through.
+func splice(ctx context.Context, client, backend net.Conn, hostname string, activity *ActivityTracker) {
+	stop := context.AfterFunc(ctx, func() {
+		client.Close()
+		backend.Close()
+	})
+	defer stop()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		io.Copy(&activityWriter{w: backend, hostname: hostname, activity: activity}, client) //nolint:errcheck
+		closeWrite(backend)
+	}()
+	go func() {
+		defer wg.Done()
+		io.Copy(&activityWriter{w: client, hostname: hostname, activity: activity}, backend) //nolint:errcheck
+		closeWrite(client)
+	}()
+	wg.Wait()
+}
+
+// closeWrite shuts the write half of conn, or closes it outright when it
+// doesn't support half-close.
+func closeWrite(conn net.Conn) {
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite() //nolint:errcheck
+		return
+	}
+	conn.Close()
+}
+
+// udpFlow is the datagrams from one client address.
+type udpFlow struct {
+	in chan []byte
+}
+
+func (f *PortForwarder) serveUDP(ctx context.Context, pc net.PacketConn, t PortTarget, l *portListener) {
+	spec := l.spec
+	stop := context.AfterFunc(ctx, func() { pc.Close() })
+	defer stop()
+
+	var mu sync.Mutex
+	flows := make(map[string]*udpFlow)
+	full := false // at udpMaxFlows; logged once each time
+	buf := make([]byte, 64*1024)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			return // listener closed
+		}
+
+		mu.Lock()
+		flow, ok := flows[addr.String()]
+		if !ok && len(flows) >= udpMaxFlows {
+			if !full {
+				full = true
+				f.logger.Warn("too many udp flows, dropping datagrams from new clients", "agent", t.Agent, "port", spec.Listen, "flows", len(flows))
+			}
+			mu.Unlock()
+			continue
+		}
+		if !ok {
+			full = false
+			flow = &udpFlow{in: make(chan []byte, udpQueueSize)}
+			flows[addr.String()] = flow
+			l.open.Add(1)
+			go func() {
+				defer l.open.Add(-1)
+				f.handleUDP(ctx, pc, addr, flow, t, spec)
+				mu.Lock()
+				delete(flows, addr.String())
+				mu.Unlock()
+			}()
+		}
+		mu.Unlock()
+
+		f.activity.Touch(t.Hostname)
+		pkt := append([]byte(nil), buf[:n]...)
+
+		select {
+		case flow.in <- pkt:
+		default:
+			f.logger.Warn("udp queue full, dropping datagram", "agent", t.Agent, "port", spec.Listen, "client", addr.String())
+		}
+	}
+}
+
+// handleUDP wakes the agent, then relays the flow's datagrams to the backend
+// and replies back to the client until the flow goes quiet.
+func (f *PortForwarder) handleUDP(ctx context.Context, pc net.PacketConn, client net.Addr, flow *udpFlow, t PortTarget, spec PortSpec) {
+	logger := f.logger.With("agent", t.Agent, "port", spec.Listen, "client", client.String())
+
+	timeout := spec.WakeTimeout
+	if timeout <= 0 {
+		timeout = defaultPortWakeTimeout
+	}
+	if err := waitRoutable(ctx, t.Policy, timeout); err != nil {
+		logger.Warn("dropping udp flow", "error", err)
+		return
+	}
+
+	addr := net.JoinHostPort(t.Host, strconv.Itoa(spec.Target))
+	backend, err := net.Dial("udp", addr)
+	if err != nil {
+		logger.Error("failed to dial backend", "backend", addr, "error", err)
+		return
+	}
+	defer backend.Close()
+
+	go func() {
+		buf := make([]byte, 64*1024)
+		for answered := false; ; answered = true {
+			n, err := backend.Read(buf)
+			if err != nil {
+				return // closed when the flow ends
+			}
+			if !answered {
+				// Once answered, the flow counts as an open connection until
+				// it goes quiet, so a game session isn't slept between
+				// bursts of datagrams.
+				f.conns.Inc(t.Hostname)
+				defer f.conns.Dec(t.Hostname)
+			}
+			f.activity.Touch(t.Hostname)
+			if _, err := pc.WriteTo(buf[:n], client); err != nil {
+				return
+			}
+		}
+	}()
+
+	idle := time.NewTimer(udpSessionTimeout)
+	defer idle.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-idle.C:
+			return
+		case pkt := <-flow.in:
+			if _, err := backend.Write(pkt); err != nil {
+				logger.Warn("failed to write datagram to backend", "error", err)
+			}
+			idle.Reset(udpSessionTimeout)
+		}
+	}
+}
+
+// waitRoutable wakes the agent and waits until it can take traffic.
+func waitRoutable(ctx context.Context, pol policy.Policy, timeout time.Duration) error {
+	deadline := time.After(timeout)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for tick := 0; ; tick++ {
+		// Re-signal every second: a wake ignored during cooldown is retried.
+		if tick%10 == 0 {
+			pol.OnRequest()
+		}
+		switch pol.State() {
+		case "sleeping", "starting", "crashloop":
+		default:
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline:
+			return fmt.Errorf("agent not ready after %s", timeout)
+		case <-ticker.C:
+		}
+	}
+}
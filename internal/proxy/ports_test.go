@@ -0,0 +1,444 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// wakingPolicy becomes ready shortly after the first wake request.
+type wakingPolicy struct {
+	mu    sync.Mutex
+	state string
+	woken int
+}
+
+func (w *wakingPolicy) Start(context.Context) {}
+
+func (w *wakingPolicy) State() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.state
+}
+
+func (w *wakingPolicy) OnRequest() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.woken++
+	if w.woken == 1 {
+		time.AfterFunc(200*time.Millisecond, func() {
+			w.mu.Lock()
+			w.state = "ready"
+			w.mu.Unlock()
+		})
+	}
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func echoServer(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn) //nolint:errcheck
+			}()
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestPortForwarderWakesAndSplices(t *testing.T) {
+	activity := NewActivityTracker()
+	conns := NewWSCounter()
+	f := NewPortForwarder(activity, conns, slog.Default())
+	pol := &wakingPolicy{state: "sleeping"}
+
+	listen := freePort(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := f.Register(ctx, PortTarget{
+		Agent:    "db",
+		Hostname: "db.example.com",
+		Host:     "127.0.0.1",
+		Policy:   pol,
+		Ports:    []PortSpec{{Proto: "tcp", Listen: listen, Target: echoServer(t), WakeTimeout: 5 * time.Second}},
+	})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	defer f.Unregister("db")
+
+	conn, err := net.Dial("tcp", "127.0.0.1:"+strconv.Itoa(listen))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	// The client can write before the agent is awake; the bytes are held.
+	if _, err := conn.Write([]byte("ping\n")); err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if line != "ping\n" {
+		t.Errorf("got %q, want ping", line)
+	}
+	if pol.State() != "ready" {
+		t.Errorf("expected the connection to wake the agent")
+	}
+	if conns.Count("db.example.com") != 1 {
+		t.Errorf("open connections = %d, want 1", conns.Count("db.example.com"))
+	}
+	if activity.LastActivity("db.example.com").IsZero() {
+		t.Error("expected activity to be recorded")
+	}
+}
+
+func TestPortForwarderWakeTimeout(t *testing.T) {
+	f := NewPortForwarder(NewActivityTracker(), NewWSCounter(), slog.Default())
+	pol := &mockPolicy{state: "starting"}
+
+	listen := freePort(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := f.Register(ctx, PortTarget{
+		Agent:  "db",
+		Host:   "127.0.0.1",
+		Policy: pol,
+		Ports:  []PortSpec{{Listen: listen, Target: echoServer(t), WakeTimeout: 100 * time.Millisecond}},
+	})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	defer f.Unregister("db")
+
+	conn, err := net.Dial("tcp", "127.0.0.1:"+strconv.Itoa(listen))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("expected the connection to be closed after the wake timeout, got %v", err)
+	}
+}
+
+func TestPortForwarderUnregisterClosesListener(t *testing.T) {
+	f := NewPortForwarder(NewActivityTracker(), NewWSCounter(), slog.Default())
+	listen := freePort(t)
+	err := f.Register(context.Background(), PortTarget{
+		Agent:  "db",
+		Host:   "127.0.0.1",
+		Policy: &mockPolicy{state: "ready"},
+		Ports:  []PortSpec{{Listen: listen, Target: 1}},
+	})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	f.Unregister("db")
+
+	if _, err := net.DialTimeout("tcp", "127.0.0.1:"+strconv.Itoa(listen), time.Second); err == nil {
+		t.Error("expected listener to be closed")
+	}
+}
+
+func TestPortForwarderUDP(t *testing.T) {
+	echo, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echo.Close()
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := echo.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			echo.WriteTo(buf[:n], addr) //nolint:errcheck
+		}
+	}()
+
+	// Reserve a free UDP port for the listener.
+	probe, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listen := probe.LocalAddr().(*net.UDPAddr).Port
+	probe.Close()
+
+	activity := NewActivityTracker()
+	conns := NewWSCounter()
+	f := NewPortForwarder(activity, conns, slog.Default())
+	pol := &wakingPolicy{state: "sleeping"}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err = f.Register(ctx, PortTarget{
+		Agent:    "dns",
+		Hostname: "dns.example.com",
+		Host:     "127.0.0.1",
+		Policy:   pol,
+		Ports:    []PortSpec{{Proto: "udp", Listen: listen, Target: echo.LocalAddr().(*net.UDPAddr).Port, WakeTimeout: 5 * time.Second}},
+	})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	defer f.Unregister("dns")
+
+	conn, err := net.Dial("udp", "127.0.0.1:"+strconv.Itoa(listen))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Datagrams sent while the agent wakes are queued and delivered.
+	if _, err := conn.Write([]byte("query")); err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 1500)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if string(buf[:n]) != "query" {
+		t.Errorf("got %q, want query", buf[:n])
+	}
+	if pol.State() != "ready" {
+		t.Error("expected the datagram to wake the agent")
+	}
+	if activity.LastActivity("dns.example.com").IsZero() {
+		t.Error("expected datagrams to count as activity")
+	}
+	if st := f.Status("dns"); len(st) != 1 || st[0].Open != 1 {
+		t.Errorf("Status() = %+v, want one udp port with 1 open flow", st)
+	}
+	if got := conns.Count("dns.example.com"); got != 1 {
+		t.Errorf("Count() = %d, want the answered flow counted", got)
+	}
+}
+
+func TestPortForwarderUDPUnansweredFlows(t *testing.T) {
+	// A backend that never replies, as for datagrams from a scanner.
+	silent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+
+	probe, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listen := probe.LocalAddr().(*net.UDPAddr).Port
+	probe.Close()
+
+	conns := NewWSCounter()
+	f := NewPortForwarder(NewActivityTracker(), conns, slog.Default())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err = f.Register(ctx, PortTarget{
+		Agent:    "dns",
+		Hostname: "dns.example.com",
+		Host:     "127.0.0.1",
+		Policy:   &mockPolicy{state: "ready"},
+		Ports:    []PortSpec{{Proto: "udp", Listen: listen, Target: silent.LocalAddr().(*net.UDPAddr).Port}},
+	})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	defer f.Unregister("dns")
+
+	conn, err := net.Dial("udp", "127.0.0.1:"+strconv.Itoa(listen))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("probe")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Wait for the datagram to reach the backend.
+	_ = silent.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 1500)
+	if _, _, err := silent.ReadFrom(buf); err != nil {
+		t.Fatalf("backend read: %v", err)
+	}
+	if st := f.Status("dns"); len(st) != 1 || st[0].Open != 1 {
+		t.Errorf("Status() = %+v, want one udp port with 1 open flow", st)
+	}
+	if got := conns.Count("dns.example.com"); got != 0 {
+		t.Errorf("Count() = %d, want unanswered flows not to keep the agent awake", got)
+	}
+}
+
+func TestPortForwarderStatusCountsConnections(t *testing.T) {
+	conns := NewWSCounter()
+	f := NewPortForwarder(NewActivityTracker(), conns, slog.Default())
+	listen := freePort(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := f.Register(ctx, PortTarget{
+		Agent:    "ssh",
+		Hostname: "ssh.example.com",
+		Host:     "127.0.0.1",
+		Policy:   &mockPolicy{state: "ready"},
+		Ports:    []PortSpec{{Listen: listen, Target: echoServer(t)}},
+	})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	defer f.Unregister("ssh")
+
+	conn, err := net.Dial("tcp", "127.0.0.1:"+strconv.Itoa(listen))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	waitFor(t, func() bool { return conns.Count("ssh.example.com") == 1 })
+	st := f.Status("ssh")
+	if len(st) != 1 || st[0].Proto != "tcp" || st[0].Listen != listen || st[0].Open != 1 {
+		t.Errorf("Status() = %+v, want one tcp port with 1 open connection", st)
+	}
+
+	conn.Close()
+	waitFor(t, func() bool { return f.Status("ssh")[0].Open == 0 })
+	if f.Status("nobody") != nil {
+		t.Error("expected no status for an agent without ports")
+	}
+}
+
+func TestPortForwarderHalfClose(t *testing.T) {
+	// The backend replies only after the client has finished sending.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		req, _ := io.ReadAll(conn)
+		conn.Write(append([]byte("got "), req...)) //nolint:errcheck
+	}()
+
+	f := NewPortForwarder(NewActivityTracker(), NewWSCounter(), slog.Default())
+	listen := freePort(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err = f.Register(ctx, PortTarget{
+		Agent:  "batch",
+		Host:   "127.0.0.1",
+		Policy: &mockPolicy{state: "ready"},
+		Ports:  []PortSpec{{Listen: listen, Target: ln.Addr().(*net.TCPAddr).Port}},
+	})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	defer f.Unregister("batch")
+
+	conn, err := net.Dial("tcp", "127.0.0.1:"+strconv.Itoa(listen))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("job")) //nolint:errcheck
+	conn.(*net.TCPConn).CloseWrite()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	resp, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if string(resp) != "got job" {
+		t.Errorf("got %q, want the reply sent after the client's half-close", resp)
+	}
+}
+
+func TestPortForwarderSpliceOutlivesPolicyContext(t *testing.T) {
+	conns := NewWSCounter()
+	f := NewPortForwarder(NewActivityTracker(), conns, slog.Default())
+	listen := freePort(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	err := f.Register(ctx, PortTarget{
+		Agent:    "db",
+		Hostname: "db.example.com",
+		Host:     "127.0.0.1",
+		Policy:   &mockPolicy{state: "ready"},
+		Ports:    []PortSpec{{Listen: listen, Target: echoServer(t)}},
+	})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	defer f.Unregister("db")
+
+	conn, err := net.Dial("tcp", "127.0.0.1:"+strconv.Itoa(listen))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	conn.Write([]byte("one\n")) //nolint:errcheck
+	if line, err := r.ReadString('\n'); err != nil || line != "one\n" {
+		t.Fatalf("read = %q, %v", line, err)
+	}
+
+	// Stopping the policies, as shutdown and upgrades do, leaves the
+	// connection to drain.
+	cancel()
+	conn.Write([]byte("two\n")) //nolint:errcheck
+	if line, err := r.ReadString('\n'); err != nil || line != "two\n" {
+		t.Fatalf("read after cancel = %q, %v", line, err)
+	}
+	if conns.Count("db.example.com") != 1 {
+		t.Errorf("open connections = %d, want 1 while draining", conns.Count("db.example.com"))
+	}
+
+	f.CloseConnections()
+	if _, err := r.ReadString('\n'); err == nil {
+		t.Error("expected CloseConnections to end the connection")
+	}
+	waitFor(t, func() bool { return conns.Count("db.example.com") == 0 })
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
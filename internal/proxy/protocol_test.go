@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"warren/internal/services"
+	"warren/internal/transport"
+)
+
+func TestRouteBackendProtocol(t *testing.T) {
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Proto)
+	}))
+	backend.Config.Protocols = new(http.Protocols)
+	backend.Config.Protocols.SetHTTP1(true)
+	backend.Config.Protocols.SetUnencryptedHTTP2(true)
+	backend.Start()
+	defer backend.Close()
+	target, _ := url.Parse(backend.URL)
+
+	p := New(services.NewRegistry(testLogger()), "", testLogger())
+	p.Register("a.com", "a", target, &mockPolicy{state: "ready"})
+
+	get := func() string {
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, httptest.NewRequest("GET", "http://a.com/", nil))
+		return w.Body.String()
+	}
+	if got := get(); got != "HTTP/1.1" {
+		t.Errorf("default protocol: backend saw %s, want HTTP/1.1", got)
+	}
+
+	p.SetOptions("a.com", RouteOptions{Protocol: transport.H2C})
+	if got := get(); got != "HTTP/2.0" {
+		t.Errorf("h2c: backend saw %s, want HTTP/2.0", got)
+	}
+}
+
+func TestUpgradeWithHTTP2Protocol(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Connection", "Upgrade")
+		w.Header().Set("Upgrade", r.Header.Get("Upgrade"))
+		w.WriteHeader(http.StatusSwitchingProtocols)
+	}))
+	defer backend.Close()
+	target, _ := url.Parse(backend.URL)
+
+	p := New(services.NewRegistry(testLogger()), "", testLogger())
+	p.RegisterWithOptions("a.com", "a", target, &mockPolicy{state: "ready"}, RouteOptions{Protocol: transport.H2C})
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	// HTTP/2 can't upgrade a connection, so the handshake goes over HTTP/1.1.
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	req, _ := http.NewRequest("GET", "http://a.com/", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "tls/1.3")
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Errorf("upgrade: %d, want 101", resp.StatusCode)
+	}
+}
@@ -2,14 +2,36 @@ package proxy
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
+
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"path"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"warren/internal/auth"
+	"warren/internal/balance"
+	"warren/internal/ban"
+	"warren/internal/breaker"
+	"warren/internal/cache"
+	"warren/internal/cors"
+	"warren/internal/events"
+	"warren/internal/headers"
 	"warren/internal/policy"
+	"warren/internal/realip"
+	"warren/internal/redirect"
+	"warren/internal/revisions"
+	"warren/internal/security"
 	"warren/internal/services"
+	"warren/internal/transport"
+	"warren/internal/validate"
 )
 
 type Backend struct {
@@ -17,43 +39,234 @@ type Backend struct {
 	Target    *url.URL
 	Proxy     *httputil.ReverseProxy
 	Policy    policy.Policy
+	Options   RouteOptions
+}
+
+// RouteOptions holds optional per-hostname proxy behaviour.
+type RouteOptions struct {
+	// BasicAuth, when set, gates the hostname behind HTTP basic auth instead
+	// of the global proxy token. Config and the service API only allow it
+	// with a proxy token when asked to replace it.
+	BasicAuth *auth.Basic
+	// ForwardAuth, when set, delegates authentication to an external
+	// service (e.g. an OIDC proxy) instead of the global proxy token.
+	ForwardAuth *auth.Forward
+	// AgentToken authenticates the agent itself on /api/agents/{name}/...
+	// endpoints. Empty disables the agent API for this agent.
+	AgentToken string
+	// Splash overrides the proxy-wide wake splash page for this hostname.
+	Splash *Splash
+	// Pool, when set, balances requests across several backend replicas
+	// instead of sending them all to the backend's Target.
+	Pool *balance.Pool
+	// Breaker, when set, fails requests fast with 503 while the backend's
+	// error rate is over its threshold.
+	Breaker *breaker.Breaker
+	// Retry, when set, re-sends GET and HEAD requests that fail with a
+	// connection error before answering 502.
+	Retry *Retry
+	// Timeouts, when set, replaces the default transport timeouts for this
+	// backend, e.g. a long response-header wait for streaming LLM agents.
+	Timeouts *transport.Timeouts
+	// Protocol, when set, is how the backend is spoken to: transport.HTTP1,
+	// transport.HTTP2 or transport.H2C.
+	Protocol string
+	// GRPC marks a gRPC backend: calls in progress count as open
+	// connections, and errors the proxy generates for gRPC clients are
+	// gRPC statuses rather than HTTP errors.
+	GRPC bool
+	// MaxBody, when positive, overrides the proxy-wide request body limit
+	// for this backend.
+	MaxBody int64
+	// CORS, when set, answers preflight requests and adds CORS headers to
+	// responses for browser frontends on other origins.
+	CORS *cors.Policy
+	// Headers, when set, rewrites the headers of requests to the backend
+	// and of responses to the client.
+	Headers *headers.Rewriter
+	// Compress compresses text and JSON responses with Brotli or gzip for
+	// clients that accept it, unless the backend compressed them already.
+	// Nil follows SetCompress.
+	Compress *bool
+	// Cache, when set, keeps responses for matching paths in memory and
+	// serves them without waking the agent.
+	Cache *cache.Cache
+	// ErrorPages overrides the proxy-wide error pages for this hostname,
+	// status by status.
+	ErrorPages *ErrorPages
+	// WakeHold, when set, holds requests that arrive while the agent is
+	// asleep until it's ready, up to this long, and then replays them.
+	// Browsers navigating to a page still get the splash page.
+	WakeHold time.Duration
+	// WebSocketIdle, when set, stops a WebSocket connection counting as
+	// activity once it has gone this long without a data frame. Pings and
+	// pongs don't count.
+	WebSocketIdle time.Duration
+	// MaxWebSockets caps concurrent WebSocket connections across the
+	// agent's hostnames. Further upgrades get 503. Zero is unlimited.
+	MaxWebSockets int
+	// AllowedPaths, when set, are the only paths passed to the agent, in
+	// the cache's pattern syntax. Anything else, such as scanner probes for
+	// /wp-admin, gets 404 from the proxy without waking the agent.
+	AllowedPaths []string
 }
 
 type Proxy struct {
-	backends  map[string]*Backend // hostname → backend
-	registry  *services.Registry
-	activity  *ActivityTracker
-	ws        *WSCounter
-	authToken string
-	logger    *slog.Logger
+	routes     atomic.Pointer[routeTable] // hostname → backend, swapped whole
+	agentHosts atomic.Pointer[agentIndex] // agent → its hostnames, rebuilt with routes
+	routesMu   sync.Mutex                 // serialises route table writers
+	registry   *services.Registry
+	activity   *ActivityTracker
+	ws         *WSCounter
+	authToken  string
+	splash     *Splash
+	wakeTimes  *WakeTimes
+	jobs       *JobTracker
+	ports      *PortForwarder
+	sni        *SNIRouter
+	revisions  *revisions.Log
+	maxBody    atomic.Int64 // request body cap for the service and agent APIs
+	maxProxy   atomic.Int64 // request body cap for proxied traffic; 0 = none
+	compress   atomic.Bool  // compress routes that don't choose for themselves
+	clientIP   atomic.Pointer[realip.Resolver]
+	observer   atomic.Pointer[RequestObserver]
+	errorPages atomic.Pointer[ErrorPages]
+	redirects  atomic.Pointer[redirect.Table]
+	replay     replayBuffer
+	wsLimits   wsLimiter
+	blocked    blockedCounter
+	emitter    atomic.Pointer[events.Emitter]
+	limitHits  *events.Throttle
+	jail       atomic.Pointer[ban.Jail]
+	transport  http.RoundTripper
+	logger     *slog.Logger
 }
 
 func New(registry *services.Registry, authToken string, logger *slog.Logger) *Proxy {
-	return &Proxy{
-		backends:  make(map[string]*Backend),
+	activity := NewActivityTracker()
+	ws := NewWSCounter()
+	p := &Proxy{
 		registry:  registry,
-		activity:  NewActivityTracker(),
-		ws:        NewWSCounter(),
+		activity:  activity,
+		ws:        ws,
 		authToken: authToken,
+		splash:    defaultSplash,
+		wakeTimes: NewWakeTimes(),
+		jobs:      NewJobTracker(),
+		ports:     NewPortForwarder(activity, ws, logger),
+		sni:       NewSNIRouter(activity, ws, logger),
+		limitHits: events.NewThrottle(time.Minute),
+		transport: &retryTransport{next: http.DefaultTransport, logger: logger},
 		logger:    logger,
 	}
+	p.routes.Store(&routeTable{})
+	p.agentHosts.Store(&agentIndex{})
+	p.maxBody.Store(defaultMaxBody)
+	p.replay.limit.Store(DefaultReplayMemory)
+	untrusting, _ := realip.New(nil, "")
+	p.clientIP.Store(untrusting)
+	return p
+}
+
+// SetEmitter reports requests turned away by a limit as security events.
+func (p *Proxy) SetEmitter(e *events.Emitter) {
+	p.emitter.Store(e)
+}
+
+// SetJail turns away banned client addresses and counts failed auth and
+// limit hits against the client.
+func (p *Proxy) SetJail(j *ban.Jail) {
+	p.jail.Store(j)
+}
+
+// strike counts a failure against r's client address in the jail, if any.
+func (p *Proxy) strike(r *http.Request, reason string) {
+	if j := p.jail.Load(); j != nil {
+		j.Strike(realip.From(r), reason)
+	}
+}
+
+// limitHit emits a security event for a request rejected by limit, at most
+// once a minute per agent and client, and counts it against the client.
+func (p *Proxy) limitHit(r *http.Request, hostname, agent, limit string) {
+	p.strike(r, limit)
+	emitter := p.emitter.Load()
+	if emitter == nil {
+		return
+	}
+	remote := realip.From(r)
+	ok, suppressed := p.limitHits.Allow(agent + " " + remote)
+	if !ok {
+		return
+	}
+	fields := map[string]string{"hostname": hostname, "remote": remote, "limit": limit}
+	if suppressed > 0 {
+		fields["suppressed"] = strconv.Itoa(suppressed)
+	}
+	emitter.Emit(events.Event{Type: events.SecurityRateLimited, Agent: agent, Fields: fields})
+}
+
+// SetClientIPResolver sets which load balancers' forwarding headers are
+// believed. By default none are: forwarding headers from clients are
+// stripped before proxying.
+func (p *Proxy) SetClientIPResolver(r *realip.Resolver) {
+	p.clientIP.Store(r)
+}
+
+// defaultMaxBody caps API request bodies unless SetMaxRequestBody says
+// otherwise.
+const defaultMaxBody = 1 << 20
+
+// SetMaxRequestBody sets the largest request body the service and agent
+// APIs accept. Zero or less restores the 1MiB default.
+func (p *Proxy) SetMaxRequestBody(n int64) {
+	if n <= 0 {
+		n = defaultMaxBody
+	}
+	p.maxBody.Store(n)
+}
+
+// SetMaxProxyBody sets the largest request body proxied to a backend, for
+// routes without their own MaxBody. Zero or less removes the limit.
+func (p *Proxy) SetMaxProxyBody(n int64) {
+	p.maxProxy.Store(max(n, 0))
+}
+
+// SetCompress sets whether responses are compressed on routes whose
+// options leave Compress unset.
+func (p *Proxy) SetCompress(on bool) {
+	p.compress.Store(on)
+}
+
+// compresses reports whether a route's responses are compressed.
+func (p *Proxy) compresses(opts RouteOptions) bool {
+	if opts.Compress != nil {
+		return *opts.Compress
+	}
+	return p.compress.Load()
 }
 
 func (p *Proxy) Register(hostname, agentName string, target *url.URL, pol policy.Policy) {
-	rp := httputil.NewSingleHostReverseProxy(target)
-	rp.FlushInterval = -1 // streaming/SSE support
+	p.RegisterWithOptions(hostname, agentName, target, pol, RouteOptions{})
+}
 
-	rp.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
-		p.logger.Error("proxy error", "agent", agentName, "error", err)
-		http.Error(w, "bad gateway", http.StatusBadGateway)
+// RegisterWithOptions is Register with additional per-hostname settings.
+func (p *Proxy) RegisterWithOptions(hostname, agentName string, target *url.URL, pol policy.Policy, opts RouteOptions) {
+	rt := p.roundTripper(opts.Timeouts, opts.Protocol)
+	if opts.Pool != nil {
+		opts.Pool.SetTransport(rt)
+		opts.Pool.SetErrorHandler(p.backendError)
 	}
 
-	p.backends[hostname] = &Backend{
+	hostname = strings.ToLower(hostname)
+	b := &Backend{
 		AgentName: agentName,
 		Target:    target,
-		Proxy:     rp,
+		Proxy:     p.reverseProxy(agentName, target, rt),
 		Policy:    pol,
+		Options:   opts,
 	}
+	p.updateRoutes(func(t routeTable) { t[hostname] = b })
 
 	// Reserve this hostname in the registry to prevent hijacking.
 	p.registry.ReserveHostname(hostname)
@@ -61,54 +274,420 @@ func (p *Proxy) Register(hostname, agentName string, target *url.URL, pol policy
 	p.logger.Info("registered backend", "hostname", hostname, "agent", agentName, "target", target)
 }
 
+// reverseProxy builds the proxy for a single backend target.
+func (p *Proxy) reverseProxy(agentName string, target *url.URL, rt http.RoundTripper) *httputil.ReverseProxy {
+	rp := httputil.NewSingleHostReverseProxy(target)
+	rp.FlushInterval = -1 // streaming/SSE support
+	rp.Transport = rt
+
+	rp.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		if bodyTooLarge(w, err) {
+			return
+		}
+		p.logger.Error("proxy error", "agent", agentName, "error", err)
+		p.backendError(w, r, err)
+	}
+	return rp
+}
+
+// roundTripper returns the transport for a route: the shared one, or one
+// with the route's own timeouts and protocol.
+func (p *Proxy) roundTripper(t *transport.Timeouts, protocol string) http.RoundTripper {
+	if t == nil && protocol == "" {
+		return p.transport
+	}
+	var timeouts transport.Timeouts
+	if t != nil {
+		timeouts = *t
+	}
+	var next http.RoundTripper = transport.NewWithProtocol(timeouts, protocol)
+	if protocol == transport.HTTP2 || protocol == transport.H2C {
+		next = &upgradeTransport{next: next, upgrade: transport.NewWithProtocol(timeouts, transport.HTTP1)}
+	}
+	return &retryTransport{next: next, logger: p.logger}
+}
+
+// upgradeTransport sends requests to switch protocols, such as WebSocket
+// handshakes, over HTTP/1.1, since an HTTP/2 transport can't upgrade a
+// connection.
+type upgradeTransport struct {
+	next    http.RoundTripper
+	upgrade http.RoundTripper
+}
+
+func (t *upgradeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Upgrade") != "" {
+		return t.upgrade.RoundTrip(req)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// CloseIdleConnections closes the idle connections of both transports.
+func (t *upgradeTransport) CloseIdleConnections() {
+	closeIdle(t.next)
+	closeIdle(t.upgrade)
+}
+
+// closeIdle closes a transport's idle connections, if it keeps any.
+func closeIdle(rt http.RoundTripper) {
+	if c, ok := rt.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// SetOptions replaces the per-hostname settings of a registered backend.
+func (p *Proxy) SetOptions(hostname string, opts RouteOptions) {
+	hostname = strings.ToLower(hostname)
+	p.updateRoutes(func(t routeTable) {
+		old, ok := t[hostname]
+		if !ok {
+			return
+		}
+		// In-flight requests may still hold the old backend, so change a copy.
+		b := *old
+		sameTransport := sameTimeouts(b.Options.Timeouts, opts.Timeouts) && b.Options.Protocol == opts.Protocol
+		rt := old.Proxy.Transport
+		if !sameTransport {
+			rt = p.roundTripper(opts.Timeouts, opts.Protocol)
+			b.Proxy = p.reverseProxy(b.AgentName, b.Target, rt)
+			// Requests in flight finish on the old transport, but nothing
+			// will reuse its idle connections.
+			if old.Proxy.Transport != p.transport {
+				closeIdle(old.Proxy.Transport)
+			}
+		}
+		// Keep the live pool, and its health state, if the replicas and
+		// transport are unchanged.
+		if sameTransport && b.Options.Pool != nil && b.Options.Pool.SameTargets(opts.Pool) {
+			opts.Pool = b.Options.Pool
+		} else if opts.Pool != nil {
+			opts.Pool.SetTransport(rt)
+			opts.Pool.SetErrorHandler(p.backendError)
+		}
+		// Likewise keep the breaker's state and cached responses if their
+		// settings are unchanged.
+		if b.Options.Breaker != nil && b.Options.Breaker.Same(opts.Breaker) {
+			opts.Breaker = b.Options.Breaker
+		}
+		if b.Options.Cache != nil && b.Options.Cache.Same(opts.Cache) {
+			opts.Cache = b.Options.Cache
+		}
+		b.Options = opts
+		t[hostname] = &b
+	})
+}
+
+// sameTimeouts reports whether two routes' timeout overrides match.
+func sameTimeouts(a, b *transport.Timeouts) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
 // Deregister removes a backend by hostname.
 func (p *Proxy) Deregister(hostname string) {
-	delete(p.backends, hostname)
+	hostname = strings.ToLower(hostname)
+	p.updateRoutes(func(t routeTable) { delete(t, hostname) })
 	p.logger.Info("deregistered backend", "hostname", hostname)
 }
 
-// Backends returns the backends map (for inspection by admin).
+// Backend returns the backend registered for a hostname.
+func (p *Proxy) Backend(hostname string) (*Backend, bool) {
+	return p.lookup(strings.ToLower(hostname))
+}
+
+// agentBackend returns a configured backend for the named agent, and all of
+// the agent's hostnames, or nil when the agent has none.
+func (p *Proxy) agentBackend(agent string) (*Backend, []string) {
+	if agent == "" {
+		return nil, nil
+	}
+	// The index may be a table behind or ahead of the routes, so each
+	// hostname is checked against the routes as well.
+	routes := *p.routes.Load()
+	var found *Backend
+	var hostnames []string
+	for _, h := range (*p.agentHosts.Load())[agent] {
+		if b, ok := routes[h]; ok && b.AgentName == agent {
+			found = b
+			hostnames = append(hostnames, h)
+		}
+	}
+	return found, hostnames
+}
+
+// WebSockets returns the agent's open WebSocket connections counted against
+// its max_websockets. Agents without a limit aren't counted.
+func (p *Proxy) WebSockets(agent string) int64 {
+	return p.wsLimits.open(agent)
+}
+
+// Backends returns a snapshot of the backends by hostname (for inspection
+// by admin). It must not be modified.
 func (p *Proxy) Backends() map[string]*Backend {
-	return p.backends
+	return *p.routes.Load()
 }
 
 func (p *Proxy) Activity() *ActivityTracker {
 	return p.activity
 }
 
+// Jobs returns the in-flight job tracker fed by the agent API.
+func (p *Proxy) Jobs() *JobTracker {
+	return p.jobs
+}
+
+// Ports returns the forwarder for agents' raw TCP and UDP ports.
+func (p *Proxy) Ports() *PortForwarder {
+	return p.ports
+}
+
+// SNI returns the router for TLS connections passed through to agents.
+func (p *Proxy) SNI() *SNIRouter {
+	return p.sni
+}
+
+// CloseConnections ends forwarded TCP and TLS passthrough connections still
+// open at shutdown, after the drain.
+func (p *Proxy) CloseConnections() {
+	p.ports.CloseConnections()
+	p.sni.CloseConnections()
+}
+
 func (p *Proxy) WSCounter() *WSCounter {
 	return p.ws
 }
 
-func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	hostname := stripPort(r.Host)
+// SetRevisionLog records dynamic service changes made through the service
+// API and serves their history.
+func (p *Proxy) SetRevisionLog(l *revisions.Log) {
+	p.revisions = l
+}
 
+// serviceSpec is the definition of a dynamic service kept in its revisions.
+type serviceSpec struct {
+	Target    string              `yaml:"target"`
+	Agent     string              `yaml:"agent,omitempty"`
+	Replicas  []string            `yaml:"replicas,omitempty"`
+	Balance   string              `yaml:"balance,omitempty"`
+	Weights   []int               `yaml:"weights,omitempty"`
+	Sticky    *balance.Sticky     `yaml:"sticky,omitempty"`
+	Timeouts  *transport.Timeouts `yaml:"timeouts,omitempty"`
+	CORS      *cors.Config        `yaml:"cors,omitempty"`
+	Headers   *headers.Config     `yaml:"headers,omitempty"`
+	Cache     *cache.Config       `yaml:"cache,omitempty"`
+	BasicAuth bool                `yaml:"basic_auth,omitempty"`
+	Fallback  *services.Fallback  `yaml:"fallback,omitempty"`
+	MaxBody   int64               `yaml:"max_body,omitempty"`
+}
+
+// recordService appends a revision for the service, if history is enabled.
+func (p *Proxy) recordService(r *http.Request, hostname, action string) {
+	if p.revisions == nil {
+		return
+	}
+	var spec any
+	if svc, ok := p.registry.Lookup(hostname); ok && action != revisions.ActionRemoved {
+		s := serviceSpec{Target: svc.Target, Agent: svc.Agent, Balance: svc.Balance, Weights: svc.Weights, Sticky: svc.Sticky, Timeouts: svc.Timeouts, BasicAuth: svc.BasicAuth != nil, Fallback: svc.Fallback, MaxBody: svc.MaxBody}
+		if len(svc.Targets) > 1 {
+			s.Replicas = svc.Targets[1:]
+		}
+		if svc.CORS != nil {
+			c := svc.CORS.Config()
+			s.CORS = &c
+		}
+		if svc.Headers != nil {
+			h := svc.Headers.Config()
+			s.Headers = &h
+		}
+		if svc.Cache != nil {
+			c := svc.Cache.Config()
+			s.Cache = &c
+		}
+		spec = s
+	}
+	if _, err := p.revisions.Record(revisions.KindService, hostname, action, revisions.Actor(r), "", spec); err != nil {
+		p.logger.Error("failed to record service revision", "hostname", hostname, "error", err)
+	}
+}
+
+// dispatch is how ServeHTTP routes a request, decided before anything is
+// served. Explain reports the same decision, so the two can't disagree.
+type dispatch struct {
+	hostname string
+	banned   bool // the client is jailed
+	// redirect is where a redirect rule sends the request, with code.
+	redirect string
+	code     int
+	reserved bool // the service API, which the public port never serves
+
+	backend *Backend
+	svc     *services.Service
+	owner   *Backend // the service's agent, when it has one
+
+	agent        string
+	basic        *auth.Basic
+	forward      *auth.Forward
+	cors         *cors.Policy
+	allowedPaths []string
+
+	healthCheck bool // health checks skip auth
+	grpcRoute   bool
+	h2c         bool // HTTP/2 without TLS, which only gRPC routes take
+	blocked     bool // outside the agent's allowed_paths
+}
+
+// dispatch decides how r is routed, returning it with the client address
+// resolved.
+func (p *Proxy) dispatch(r *http.Request) (*http.Request, dispatch) {
+	d := dispatch{hostname: normalizeHost(r.Host)}
+	r = p.clientIP.Load().Apply(r)
+
+	if j := p.jail.Load(); j != nil && j.Banned(realip.From(r)) {
+		d.banned = true
+		return r, d
+	}
+	if target, code, ok := p.redirects.Load().Match(r, d.hostname); ok {
+		d.redirect, d.code = target, code
+		return r, d
+	}
 	// Service API is NOT served on the public port — admin only.
 	if strings.HasPrefix(r.URL.Path, "/api/services") {
+		d.reserved = true
+		return r, d
+	}
+
+	d.healthCheck = r.URL.Path == "/api/health" && r.Method == http.MethodGet
+
+	// Hostnames with basic or forward auth use it in place of the global
+	// proxy token.
+	if backend, ok := p.lookup(d.hostname); ok {
+		d.backend = backend
+		d.agent = backend.AgentName
+		d.basic = backend.Options.BasicAuth
+		d.forward = backend.Options.ForwardAuth
+		d.cors = backend.Options.CORS
+		d.allowedPaths = backend.Options.AllowedPaths
+		d.grpcRoute = backend.Options.GRPC
+	} else if svc, ok := p.registry.Lookup(d.hostname); ok {
+		d.svc = svc
+		d.agent = svc.Agent
+		d.basic = svc.BasicAuth
+		d.cors = svc.CORS
+		// A service belonging to an agent is held to its allowed_paths.
+		if d.owner, _ = p.agentBackend(svc.Agent); d.owner != nil {
+			d.allowedPaths = d.owner.Options.AllowedPaths
+		}
+	}
+
+	// The listener takes HTTP/2 without TLS for gRPC clients, which is all
+	// it's for: other routes only speak it over TLS.
+	d.h2c = r.ProtoMajor == 2 && r.TLS == nil && !d.grpcRoute
+	// Paths outside an agent's allowlist are turned away before anything
+	// else, auth included, so probes never reach or wake it.
+	d.blocked = pathBlocked(r, d.allowedPaths)
+	return r, d
+}
+
+// routed reports whether d found an agent or service for the request.
+func (d dispatch) routed() bool {
+	return d.backend != nil || d.svc != nil
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r, d := p.dispatch(r)
+	switch {
+	case d.banned:
+		http.Error(w, `{"error":"forbidden"}`, http.StatusForbidden)
+		return
+	case d.redirect != "":
+		http.Redirect(w, r, d.redirect, d.code)
+		return
+	case d.reserved:
 		http.Error(w, "not found", http.StatusNotFound)
 		return
 	}
 
-	// Allow health checks without auth.
-	isHealthCheck := r.URL.Path == "/api/health" && r.Method == http.MethodGet
+	if d.routed() {
+		var done func()
+		w, done = p.observe(w, r, d.agent)
+		defer done()
+	}
+
+	if d.h2c {
+		http.Error(w, "HTTP/2 without TLS is only accepted for gRPC routes", http.StatusHTTPVersionNotSupported)
+		return
+	}
+	// gRPC clients need failures as gRPC statuses, not HTTP errors.
+	grpcCall := d.grpcRoute && IsGRPC(r)
+
+	if d.blocked {
+		p.blocked.add(d.agent)
+		p.logger.Debug("path not allowed, answering 404", "agent", d.agent, "path", r.URL.Path)
+		p.proxyError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	// Browsers send CORS preflights without credentials, so they're
+	// answered before auth.
+	if d.cors != nil {
+		var ok bool
+		if w, ok = d.cors.Handle(w, r); !ok {
+			return
+		}
+	}
 
 	// All other endpoints require auth.
-	if !isHealthCheck && p.authToken != "" {
+	if !d.healthCheck && d.basic != nil {
+		if _, ok := d.basic.Authenticate(r); !ok {
+			// A request without credentials is a browser yet to prompt,
+			// not a failed attempt.
+			if r.Header.Get("Authorization") != "" {
+				p.strike(r, "basic auth")
+			}
+			if grpcCall {
+				grpcError(w, http.StatusUnauthorized, "unauthorized")
+				return
+			}
+			d.basic.Challenge(w)
+			return
+		}
+	} else if !d.healthCheck && d.forward != nil {
+		if grpcCall {
+			// The auth service's own response is meant for browsers;
+			// only its status is passed on.
+			rec := &grpcAuthRecorder{header: http.Header{}}
+			if !d.forward.Check(rec, r) {
+				grpcError(w, rec.code, http.StatusText(rec.code))
+				return
+			}
+		} else if !d.forward.Check(w, r) {
+			return
+		}
+	} else if !d.healthCheck && p.authToken != "" {
 		if r.Header.Get("Authorization") != "Bearer "+p.authToken {
+			if r.Header.Get("Authorization") != "" {
+				p.strike(r, "proxy token")
+			}
+			if grpcCall {
+				grpcError(w, http.StatusUnauthorized, "unauthorized")
+				return
+			}
 			http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
 			return
 		}
 	}
 
 	// Check configured backends first.
-	if backend, ok := p.backends[hostname]; ok {
-		p.serveBackend(w, r, hostname, backend)
+	if d.backend != nil {
+		p.serveBackend(w, r, d.hostname, d.backend)
 		return
 	}
 
 	// Fallback: check the dynamic service registry.
-	if svc, ok := p.registry.Lookup(hostname); ok {
-		p.serveDynamicService(w, r, hostname, svc)
+	if d.svc != nil {
+		p.serveDynamicService(w, r, d.hostname, d.svc)
 		return
 	}
 
@@ -130,32 +709,179 @@ func (p *Proxy) serveBackend(w http.ResponseWriter, r *http.Request, hostname st
 		return
 	}
 
+	// Rewrites apply to cached responses too, and to the request before
+	// it's matched against the cache.
+	if rw := backend.Options.Headers; rw != nil {
+		rw.Request(r)
+		w = rw.Response(w, r)
+	}
+
+	// Cache hits don't count as activity, so a sleeping agent stays asleep.
+	if p.serveCached(w, r, backend.Options.Cache, p.compresses(backend.Options)) {
+		return
+	}
+
 	backend.Policy.OnRequest()
 	p.activity.Touch(hostname)
 
-	// If the backend is sleeping or starting, return 503 instead of forwarding.
+	// If the backend is sleeping, starting or backing off from a crash loop,
+	// return 503 instead of forwarding.
 	state := backend.Policy.State()
-	if state == "sleeping" || state == "starting" {
-		w.Header().Set("Content-Type", "application/json")
-		w.Header().Set("Cache-Control", "no-cache")
-		w.Header().Set("Retry-After", "3")
-		w.WriteHeader(http.StatusServiceUnavailable)
-		_ = json.NewEncoder(w).Encode(healthResponse{Status: state, Agent: backend.AgentName})
+	waking := state == "sleeping" || state == "starting" || state == "crashloop"
+	hold := backend.Options.WakeHold
+	if state == "sleeping" && p.serveWakeRefused(w, r, backend) {
+		return
+	}
+	if waking && (hold <= 0 || wantsHTML(r) || IsWebSocket(r)) {
+		p.serveWaking(w, r, hostname, state, backend)
+		return
+	}
+
+	limit := backend.Options.MaxBody
+	if limit <= 0 {
+		limit = p.maxProxy.Load()
+	}
+	if !limitBody(w, r, limit) {
+		return
+	}
+
+	if waking {
+		release, ok := p.holdForWake(w, r, hostname, backend, hold)
+		if !ok {
+			return
+		}
+		defer release()
+	}
+
+	w, done, ok := p.guardCircuit(w, r, hostname, backend.Options.Breaker)
+	if !ok {
+		return
+	}
+	defer done()
+
+	r = withRetry(r, backend.Options.Retry)
+
+	if p.compresses(backend.Options) {
+		var closeCompress func()
+		w, closeCompress = compressResponse(w, r)
+		defer closeCompress()
+	}
+	if c := backend.Options.Cache; c != nil {
+		var store func()
+		w, store = c.Record(w, r)
+		defer store()
+	}
+
+	if backend.Options.GRPC && IsGRPC(r) {
+		var next http.Handler = backend.Proxy
+		if pool := backend.Options.Pool; pool != nil {
+			next = pool
+		}
+		p.serveGRPC(w, r, hostname, next)
+		return
+	}
+
+	release, ok := p.acquireWebSocket(w, r, hostname, backend)
+	if !ok {
+		return
+	}
+	defer release()
+
+	if pool := backend.Options.Pool; pool != nil {
+		p.servePool(w, r, hostname, pool, backend.Options.WebSocketIdle)
 		return
 	}
 
 	// WebSocket passthrough.
 	if IsWebSocket(r) {
-		HandleWebSocket(w, r, backend.Target, hostname, p.ws, p.activity, p.logger)
+		handleWebSocket(r.Context(), w, r, backend.Target, hostname, backend.Options.WebSocketIdle, p.ws, p.activity, p.logger)
 		return
 	}
 
 	backend.Proxy.ServeHTTP(w, r)
 }
 
+// servePool forwards a request to one of several backend replicas.
+func (p *Proxy) servePool(w http.ResponseWriter, r *http.Request, hostname string, pool *balance.Pool, wsIdle time.Duration) {
+	if IsWebSocket(r) {
+		u := pool.PickFor(r)
+		release := u.Acquire()
+		defer release()
+		handleWebSocket(r.Context(), w, r, u.Target, hostname, wsIdle, p.ws, p.activity, p.logger)
+		return
+	}
+	pool.ServeHTTP(w, r)
+}
+
 func (p *Proxy) serveDynamicService(w http.ResponseWriter, r *http.Request, hostname string, svc *services.Service) {
+	if rw := svc.Headers; rw != nil {
+		rw.Request(r)
+		w = rw.Response(w, r)
+	}
+	// As for agents, cache hits neither wake the owner nor count as
+	// activity.
+	if p.serveCached(w, r, svc.Cache, false) {
+		return
+	}
 	p.activity.Touch(hostname)
 
+	// Requests wake the owning agent like its own hostnames do, and count
+	// as its activity.
+	owner, ownerHosts := p.agentBackend(svc.Agent)
+	var waking bool
+	if owner != nil {
+		owner.Policy.OnRequest()
+		for _, h := range ownerHosts {
+			p.activity.Touch(h)
+		}
+		state := owner.Policy.State()
+		waking = state == "sleeping" || state == "starting" || state == "crashloop"
+		if state == "sleeping" && p.serveWakeRefused(w, r, owner) {
+			return
+		}
+		if waking && (owner.Options.WakeHold <= 0 || wantsHTML(r) || IsWebSocket(r)) {
+			p.serveWaking(w, r, hostname, state, owner)
+			return
+		}
+	}
+
+	limit := svc.MaxBody
+	if limit <= 0 {
+		limit = p.maxProxy.Load()
+	}
+	if !limitBody(w, r, limit) {
+		return
+	}
+
+	if waking {
+		release, ok := p.holdForWake(w, r, hostname, owner, owner.Options.WakeHold)
+		if !ok {
+			return
+		}
+		defer release()
+	}
+
+	if c := svc.Cache; c != nil {
+		var store func()
+		w, store = c.Record(w, r)
+		defer store()
+	}
+
+	// WebSockets to an agent's services count against its max_websockets
+	// like those to its own hostnames.
+	if owner != nil {
+		release, ok := p.acquireWebSocket(w, r, hostname, owner)
+		if !ok {
+			return
+		}
+		defer release()
+	}
+
+	if svc.Pool != nil {
+		p.servePool(w, r, hostname, svc.Pool, 0)
+		return
+	}
+
 	// Use cached TargetURL and Proxy from registration (L2).
 	if svc.TargetURL == nil || svc.Proxy == nil {
 		p.logger.Error("dynamic service missing cached proxy", "hostname", hostname)
@@ -168,11 +894,36 @@ func (p *Proxy) serveDynamicService(w http.ResponseWriter, r *http.Request, host
 		return
 	}
 
-	svc.Proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
-		p.logger.Error("dynamic service proxy error", "hostname", hostname, "error", err)
-		http.Error(w, "bad gateway", http.StatusBadGateway)
+	p.serveServiceTarget(w, r, hostname, svc, attemptTarget)
+}
+
+// acquireWebSocket takes one of the agent's max_websockets for a WebSocket
+// upgrade, answering 503 when all are in use. Other requests, and agents
+// without a limit, always get a slot; release must be called either way.
+func (p *Proxy) acquireWebSocket(w http.ResponseWriter, r *http.Request, hostname string, agent *Backend) (release func(), ok bool) {
+	max := agent.Options.MaxWebSockets
+	if max <= 0 || !IsWebSocket(r) {
+		return func() {}, true
+	}
+	release, ok = p.wsLimits.acquire(agent.AgentName, max)
+	if !ok {
+		p.logger.Warn("websocket limit reached, rejecting upgrade", "agent", agent.AgentName, "limit", max)
+		p.limitHit(r, hostname, agent.AgentName, "max_websockets")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"error": "too many websocket connections",
+			"agent": agent.AgentName,
+			"limit": max,
+		})
 	}
-	svc.Proxy.ServeHTTP(w, r)
+	return release, ok
+}
+
+// headerRules is the JSON form of headers.Rules in service registrations.
+type headerRules struct {
+	Set    map[string]string `json:"set"`
+	Remove []string          `json:"remove"`
 }
 
 // HandleServiceAPI routes /api/services requests. Intended for admin mux only.
@@ -184,35 +935,310 @@ func (p *Proxy) HandleServiceAPI(w http.ResponseWriter, r *http.Request) {
 		_ = json.NewEncoder(w).Encode(p.registry.List())
 
 	case r.Method == http.MethodPost && r.URL.Path == "/api/services":
-		// Limit request body to 1MB to prevent memory exhaustion.
-		r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+		// Limit request body size to prevent memory exhaustion.
+		r.Body = http.MaxBytesReader(w, r.Body, p.maxBody.Load())
 		var req struct {
-			Hostname string `json:"hostname"`
-			Target   string `json:"target"`
-			Agent    string `json:"agent"`
+			Hostname string   `json:"hostname"`
+			Target   string   `json:"target"`
+			Agent    string   `json:"agent"`
+			Replicas []string `json:"replicas"`
+			Balance  string   `json:"balance"`
+			Weights  []int    `json:"weights"`
+			Sticky   *struct {
+				Cookie string `json:"cookie"`
+				TTL    string `json:"ttl"`
+			} `json:"sticky"`
+			Timeouts *struct {
+				Dial           string `json:"dial"`
+				ResponseHeader string `json:"response_header"`
+				Idle           string `json:"idle"`
+			} `json:"timeouts"`
+			BasicAuth *struct {
+				Realm             string   `json:"realm"`
+				Users             []string `json:"users"`
+				ReplaceProxyToken bool     `json:"replace_proxy_token"`
+			} `json:"basic_auth"`
+			CORS *struct {
+				Origins       []string `json:"origins"`
+				Methods       []string `json:"methods"`
+				Headers       []string `json:"headers"`
+				ExposeHeaders []string `json:"expose_headers"`
+				Credentials   bool     `json:"credentials"`
+				MaxAge        string   `json:"max_age"`
+			} `json:"cors"`
+			Headers *struct {
+				Request  headerRules `json:"request"`
+				Response headerRules `json:"response"`
+			} `json:"headers"`
+			Cache *struct {
+				Paths    []string `json:"paths"`
+				Methods  []string `json:"methods"`
+				TTL      string   `json:"ttl"`
+				MaxSize  string   `json:"max_size"`
+				MaxEntry string   `json:"max_entry"`
+			} `json:"cache"`
+			Wake     bool               `json:"wake"`
+			Fallback *services.Fallback `json:"fallback"`
+			MaxBody  string             `json:"max_body"`
+		}
+		errs := validate.Decode(r, &req)
+		if len(errs) == 0 {
+			errs.Required("hostname", req.Hostname)
+			if req.Hostname != "" {
+				if err := security.ValidateHostname(req.Hostname); err != nil {
+					errs.Add("hostname", "%v", err)
+				}
+			}
+			errs.Required("target", req.Target)
+			errs.URL("target", req.Target)
+			for i, replica := range req.Replicas {
+				errs.URL(fmt.Sprintf("replicas[%d]", i), replica)
+			}
+			errs.OneOf("balance", req.Balance, balance.RoundRobin, balance.LeastConnections, balance.Weighted)
+			if len(req.Weights) > 0 && len(req.Weights) != 1+len(req.Replicas) {
+				errs.Add("weights", "needs one weight per target (%d), got %d", 1+len(req.Replicas), len(req.Weights))
+			}
+			if fb := req.Fallback; fb != nil {
+				if fb.Retries < 0 || fb.Retries > services.MaxFallbackRetries {
+					errs.Add("fallback.retries", "must be between 0 and %d", services.MaxFallbackRetries)
+				}
+				if fb.URL != "" {
+					errs.URL("fallback.url", fb.URL)
+				}
+				if fb.Wake && req.Agent == "" {
+					errs.Add("fallback.wake", "needs an owning agent")
+				}
+				if len(req.Replicas) > 0 {
+					errs.Add("fallback", "cannot be used with replicas")
+				}
+			}
+		}
+		opts := services.Options{Replicas: req.Replicas, Balance: req.Balance, Weights: req.Weights, Wake: req.Wake, Fallback: req.Fallback}
+		if len(errs) == 0 {
+			opts.MaxBody = errs.Size("max_body", req.MaxBody)
+		}
+		if len(errs) == 0 && req.Sticky != nil {
+			if len(req.Replicas) == 0 {
+				errs.Add("sticky", "needs at least one replica")
+			}
+			if c := req.Sticky.Cookie; c != "" && !balance.ValidCookieName(c) {
+				errs.Add("sticky.cookie", "%q is not a valid cookie name", c)
+			}
+			ttl := errs.Duration("sticky.ttl", req.Sticky.TTL)
+			opts.Sticky = &balance.Sticky{Cookie: req.Sticky.Cookie, TTL: ttl}
+		}
+		if len(errs) == 0 && req.Timeouts != nil {
+			opts.Timeouts = &transport.Timeouts{
+				Dial:           errs.Duration("timeouts.dial", req.Timeouts.Dial),
+				ResponseHeader: errs.Duration("timeouts.response_header", req.Timeouts.ResponseHeader),
+				Idle:           errs.Duration("timeouts.idle", req.Timeouts.Idle),
+			}
+		}
+		if len(errs) == 0 && req.BasicAuth != nil {
+			basic, err := auth.NewBasic(req.BasicAuth.Realm, req.BasicAuth.Users)
+			if err != nil {
+				errs.Add("basic_auth", "%v", err)
+			}
+			// Basic auth takes the Authorization header the proxy token
+			// would, so a service can't drop the token without saying so.
+			if p.authToken != "" && !req.BasicAuth.ReplaceProxyToken {
+				errs.Add("basic_auth.replace_proxy_token", "must be true: basic auth replaces the proxy token for this hostname")
+			}
+			opts.BasicAuth = basic
+		}
+		if len(errs) == 0 && req.CORS != nil {
+			policy, err := cors.New(cors.Config{
+				Origins:       req.CORS.Origins,
+				Methods:       req.CORS.Methods,
+				Headers:       req.CORS.Headers,
+				ExposeHeaders: req.CORS.ExposeHeaders,
+				Credentials:   req.CORS.Credentials,
+				MaxAge:        errs.Duration("cors.max_age", req.CORS.MaxAge),
+			})
+			if err != nil {
+				errs.Add("cors", "%s", strings.TrimPrefix(err.Error(), "cors: "))
+			}
+			opts.CORS = policy
+		}
+		if len(errs) == 0 && req.Headers != nil {
+			rw, err := headers.New(headers.Config{
+				Request:  headers.Rules(req.Headers.Request),
+				Response: headers.Rules(req.Headers.Response),
+			})
+			if err != nil {
+				errs.Add("headers", "%s", strings.TrimPrefix(err.Error(), "headers: "))
+			}
+			opts.Headers = rw
+		}
+		if len(errs) == 0 && req.Cache != nil {
+			if len(req.Cache.Paths) == 0 {
+				errs.Add("cache.paths", "must list at least one path")
+			}
+			for _, pattern := range req.Cache.Paths {
+				if _, err := path.Match(pattern, ""); err != nil {
+					errs.Add("cache.paths", "invalid pattern %q", pattern)
+				}
+			}
+			for _, m := range req.Cache.Methods {
+				if !strings.EqualFold(m, http.MethodGet) && !strings.EqualFold(m, http.MethodHead) {
+					errs.Add("cache.methods", "only GET and HEAD can be cached, got %q", m)
+				}
+			}
+			opts.Cache = cache.New(cache.Config{
+				Paths:    req.Cache.Paths,
+				Methods:  req.Cache.Methods,
+				TTL:      errs.Duration("cache.ttl", req.Cache.TTL),
+				MaxSize:  errs.Size("cache.max_size", req.Cache.MaxSize),
+				MaxEntry: errs.Size("cache.max_entry", req.Cache.MaxEntry),
+			})
 		}
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+		if validate.Write(w, errs) {
 			return
 		}
-		if req.Hostname == "" || req.Target == "" {
-			http.Error(w, `{"error":"hostname and target required"}`, http.StatusBadRequest)
+		// Re-registering a service from the config file would be undone
+		// by the next reload, as an update would.
+		if p.registry.Configured(req.Hostname) {
+			http.Error(w, `{"error":"`+services.ErrConfigured.Error()+`"}`, http.StatusConflict)
 			return
 		}
-		if err := p.registry.Register(req.Hostname, req.Target, req.Agent); err != nil {
+		_, existed := p.registry.Lookup(req.Hostname)
+		if err := p.registry.RegisterWithOptions(req.Hostname, req.Target, req.Agent, opts); err != nil {
 			http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
 			return
 		}
+		action := revisions.ActionCreated
+		if existed {
+			action = revisions.ActionUpdated
+		}
+		p.recordService(r, req.Hostname, action)
 		w.WriteHeader(http.StatusCreated)
 		_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/api/services/") && strings.HasSuffix(r.URL.Path, "/restore"):
+		hostname := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/services/"), "/restore")
+		if err := p.registry.Restore(hostname); err != nil {
+			code := http.StatusConflict
+			if errors.Is(err, services.ErrNotInTrash) {
+				code = http.StatusNotFound
+			}
+			http.Error(w, `{"error":"`+err.Error()+`"}`, code)
+			return
+		}
+		p.recordService(r, hostname, revisions.ActionRestored)
+		_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok", "hostname": hostname})
+
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/api/services/") && strings.HasSuffix(r.URL.Path, "/revisions"):
+		hostname := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/services/"), "/revisions")
+		if p.revisions == nil {
+			http.Error(w, `{"error":"revision history not available"}`, http.StatusServiceUnavailable)
+			return
+		}
+		revs := p.revisions.List(revisions.KindService, hostname)
+		if len(revs) == 0 {
+			http.Error(w, `{"error":"no revisions for service"}`, http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(revs)
+
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/api/services/"):
+		hostname := strings.TrimPrefix(r.URL.Path, "/api/services/")
+		svc, ok := p.registry.Lookup(hostname)
+		if !ok {
+			http.Error(w, `{"error":"service not found"}`, http.StatusNotFound)
+			return
+		}
+		resp := map[string]any{
+			"service":     svc,
+			"connections": p.ws.Count(hostname),
+		}
+		if svc.Pool != nil {
+			resp["backends"] = svc.Pool.Status()
+			if st := svc.Pool.Sticky(); st != nil {
+				resp["sticky"] = st.String()
+			}
+		}
+		if svc.Timeouts != nil {
+			resp["timeouts"] = svc.Timeouts.String()
+		}
+		if svc.CORS != nil {
+			resp["cors"] = svc.CORS.String()
+		}
+		if svc.Headers != nil {
+			resp["headers"] = svc.Headers.String()
+		}
+		if svc.Cache != nil {
+			resp["cache"] = svc.Cache.Stats()
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+
+	case r.Method == http.MethodPatch && strings.HasPrefix(r.URL.Path, "/api/services/"):
+		hostname := strings.TrimPrefix(r.URL.Path, "/api/services/")
+		r.Body = http.MaxBytesReader(w, r.Body, p.maxBody.Load())
+		// Omitted fields are left as they are; an empty list of replicas
+		// leaves just the target and an empty fallback removes it.
+		var req struct {
+			Target   string             `json:"target"`
+			Replicas []string           `json:"replicas"`
+			Weights  []int              `json:"weights"`
+			Balance  *string            `json:"balance"`
+			Wake     *bool              `json:"wake"`
+			Fallback *services.Fallback `json:"fallback"`
+		}
+		errs := validate.Decode(r, &req)
+		if len(errs) == 0 {
+			errs.Required("target", req.Target)
+			errs.URL("target", req.Target)
+			for i, replica := range req.Replicas {
+				errs.URL(fmt.Sprintf("replicas[%d]", i), replica)
+			}
+			if req.Balance != nil {
+				errs.OneOf("balance", *req.Balance, balance.RoundRobin, balance.LeastConnections, balance.Weighted)
+			}
+			if fb := req.Fallback; fb != nil {
+				if fb.Retries < 0 || fb.Retries > services.MaxFallbackRetries {
+					errs.Add("fallback.retries", "must be between 0 and %d", services.MaxFallbackRetries)
+				}
+				if fb.URL != "" {
+					errs.URL("fallback.url", fb.URL)
+				}
+			}
+		}
+		if validate.Write(w, errs) {
+			return
+		}
+		patch := services.Patch{Target: req.Target, Replicas: req.Replicas, Weights: req.Weights, Balance: req.Balance, Wake: req.Wake, Fallback: req.Fallback}
+		if err := p.registry.Update(hostname, patch); err != nil {
+			code := http.StatusBadRequest
+			switch {
+			case errors.Is(err, services.ErrNotFound):
+				code = http.StatusNotFound
+			case errors.Is(err, services.ErrConfigured):
+				code = http.StatusConflict
+			}
+			http.Error(w, `{"error":"`+err.Error()+`"}`, code)
+			return
+		}
+		p.recordService(r, hostname, revisions.ActionUpdated)
+		_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok", "hostname": hostname})
+
 	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/api/services/"):
 		hostname := strings.TrimPrefix(r.URL.Path, "/api/services/")
 		if hostname == "" {
 			http.Error(w, `{"error":"hostname required"}`, http.StatusBadRequest)
 			return
 		}
-		p.registry.Deregister(hostname)
+		// Refuse to cut off open connections unless forced.
+		if conns := p.ws.Count(hostname); conns > 0 && r.URL.Query().Get("force") != "true" {
+			w.WriteHeader(http.StatusConflict)
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"error":       "service has active connections, use force=true to remove anyway",
+				"connections": conns,
+			})
+			return
+		}
+		if p.registry.Remove(hostname) {
+			p.recordService(r, hostname, revisions.ActionRemoved)
+		}
 		_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 
 	default:
@@ -12,6 +12,8 @@ import (
 	"strings"
 	"testing"
 
+	"warren/internal/balance"
+	"warren/internal/revisions"
 	"warren/internal/services"
 )
 
@@ -225,6 +227,219 @@ func TestServiceAPIRegisterAndList(t *testing.T) {
 	}
 }
 
+func TestServiceAPIRemoveWithConnections(t *testing.T) {
+	registry := services.NewRegistry(testLogger())
+	p := New(registry, "", testLogger())
+	if err := registry.Register("x.com", "http://localhost:1234", "a"); err != nil {
+		t.Fatal(err)
+	}
+	p.WSCounter().Inc("x.com")
+
+	req := httptest.NewRequest("GET", "/api/services/x.com", nil)
+	w := httptest.NewRecorder()
+	p.HandleServiceAPI(w, req)
+	if w.Code != 200 || !strings.Contains(w.Body.String(), `"connections":1`) {
+		t.Errorf("get = %d %s, want 200 with 1 connection", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest("DELETE", "/api/services/x.com", nil)
+	w = httptest.NewRecorder()
+	p.HandleServiceAPI(w, req)
+	if w.Code != 409 {
+		t.Errorf("delete status = %d, want 409", w.Code)
+	}
+	if _, ok := registry.Lookup("x.com"); !ok {
+		t.Fatal("service removed despite active connections")
+	}
+
+	req = httptest.NewRequest("DELETE", "/api/services/x.com?force=true", nil)
+	w = httptest.NewRecorder()
+	p.HandleServiceAPI(w, req)
+	if w.Code != 200 {
+		t.Errorf("forced delete status = %d, want 200", w.Code)
+	}
+	if _, ok := registry.Lookup("x.com"); ok {
+		t.Error("service still registered after forced delete")
+	}
+
+	req = httptest.NewRequest("POST", "/api/services/x.com/restore", nil)
+	w = httptest.NewRecorder()
+	p.HandleServiceAPI(w, req)
+	if w.Code != 200 {
+		t.Errorf("restore status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	if _, ok := registry.Lookup("x.com"); !ok {
+		t.Error("service not registered after restore")
+	}
+
+	req = httptest.NewRequest("POST", "/api/services/x.com/restore", nil)
+	w = httptest.NewRecorder()
+	p.HandleServiceAPI(w, req)
+	if w.Code != 404 {
+		t.Errorf("second restore = %d, want 404", w.Code)
+	}
+}
+
+func TestBackendPool(t *testing.T) {
+	var hits [2]int
+	var targets []*url.URL
+	for i := range hits {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits[i]++
+		}))
+		defer srv.Close()
+		u, _ := url.Parse(srv.URL)
+		targets = append(targets, u)
+	}
+	pool, err := balance.New(targets, balance.RoundRobin, testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registry := services.NewRegistry(testLogger())
+	p := New(registry, "", testLogger())
+	p.RegisterWithOptions("multi.com", "multi", targets[0], &mockPolicy{state: "ready"}, RouteOptions{Pool: pool})
+
+	for i := 0; i < 4; i++ {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Host = "multi.com"
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+		if w.Code != 200 {
+			t.Fatalf("status = %d, want 200", w.Code)
+		}
+	}
+	if hits[0] != 2 || hits[1] != 2 {
+		t.Errorf("hits = %v, want [2 2]", hits)
+	}
+}
+
+func TestServiceAPIValidation(t *testing.T) {
+	registry := services.NewRegistry(testLogger())
+	p := New(registry, "", testLogger())
+
+	w := httptest.NewRecorder()
+	p.HandleServiceAPI(w, httptest.NewRequest("POST", "/api/services", strings.NewReader(
+		`{"hostname":"x.com","target":"10.0.0.1:80","replicas":["http://10.0.0.2:80"],"balance":"fastest","weights":[100]}`)))
+	if w.Code != 422 {
+		t.Fatalf("status = %d, want 422", w.Code)
+	}
+	for _, field := range []string{`"field":"target"`, `"field":"balance"`, `"field":"weights"`} {
+		if !strings.Contains(w.Body.String(), field) {
+			t.Errorf("missing %s in %s", field, w.Body.String())
+		}
+	}
+
+	w = httptest.NewRecorder()
+	p.HandleServiceAPI(w, httptest.NewRequest("POST", "/api/services", strings.NewReader(
+		`{"hostname":"x.com","target":"http://10.0.0.1:80","weights":"90/10"}`)))
+	if w.Code != 422 || !strings.Contains(w.Body.String(), `"field":"weights","message":"must be a list, got string"`) {
+		t.Errorf("wrong type: %d %s", w.Code, w.Body.String())
+	}
+	if _, ok := registry.Lookup("x.com"); ok {
+		t.Error("invalid service should not have been registered")
+	}
+}
+
+func TestServiceAPISticky(t *testing.T) {
+	registry := services.NewRegistry(testLogger())
+	p := New(registry, "", testLogger())
+
+	w := httptest.NewRecorder()
+	p.HandleServiceAPI(w, httptest.NewRequest("POST", "/api/services", strings.NewReader(
+		`{"hostname":"x.com","target":"http://10.0.0.1:80","replicas":["http://10.0.0.2:80"],"sticky":{"ttl":"30m"}}`)))
+	if w.Code != 201 {
+		t.Fatalf("register: %d %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	p.HandleServiceAPI(w, httptest.NewRequest("GET", "/api/services/x.com", nil))
+	if !strings.Contains(w.Body.String(), `"sticky":"cookie warren_backend, ttl 30m0s"`) {
+		t.Errorf("inspect = %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	p.HandleServiceAPI(w, httptest.NewRequest("POST", "/api/services", strings.NewReader(
+		`{"hostname":"y.com","target":"http://10.0.0.1:80","sticky":{"ttl":"soon"}}`)))
+	if w.Code != 422 || !strings.Contains(w.Body.String(), `"field":"sticky"`) || !strings.Contains(w.Body.String(), `"field":"sticky.ttl"`) {
+		t.Errorf("invalid sticky: %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	p.HandleServiceAPI(w, httptest.NewRequest("POST", "/api/services", strings.NewReader(
+		`{"hostname":"y.com","target":"http://10.0.0.1:80","replicas":["http://10.0.0.2:80"],"sticky":{"cookie":"my pin"}}`)))
+	if w.Code != 422 || !strings.Contains(w.Body.String(), `"field":"sticky.cookie"`) {
+		t.Errorf("invalid sticky cookie: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestServiceAPIRevisions(t *testing.T) {
+	registry := services.NewRegistry(testLogger())
+	p := New(registry, "", testLogger())
+	p.SetRevisionLog(revisions.NewLog(0))
+	api := p.ServiceAPI([]string{"ci-token"})
+
+	for _, target := range []string{"http://10.0.0.1:1234", "http://10.0.0.2:1234"} {
+		req := httptest.NewRequest("POST", "/api/services", strings.NewReader(`{"hostname":"x.com","target":"`+target+`"}`))
+		req.Header.Set("Authorization", "Bearer ci-token")
+		api.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	w := httptest.NewRecorder()
+	p.HandleServiceAPI(w, httptest.NewRequest("GET", "/api/services/x.com/revisions", nil))
+	var revs []revisions.Revision
+	json.Unmarshal(w.Body.Bytes(), &revs)
+	if len(revs) != 2 || revs[0].Action != "updated" || !strings.HasPrefix(revs[0].Actor, "token:") {
+		t.Fatalf("revisions = %s", w.Body.String())
+	}
+	if len(revs[0].Changes) != 1 || revs[0].Changes[0].New != "http://10.0.0.2:1234" {
+		t.Errorf("changes = %+v", revs[0].Changes)
+	}
+}
+
+func TestServiceAPIUpdate(t *testing.T) {
+	registry := services.NewRegistry(testLogger())
+	p := New(registry, "", testLogger())
+	p.SetRevisionLog(revisions.NewLog(0))
+	if err := registry.Register("x.com", "http://10.0.0.1:1234", "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	p.HandleServiceAPI(w, httptest.NewRequest("PATCH", "/api/services/x.com", strings.NewReader(`{"target":"http://10.0.0.2:1234"}`)))
+	if w.Code != 200 {
+		t.Fatalf("update = %d %s, want 200", w.Code, w.Body.String())
+	}
+	svc, _ := registry.Lookup("x.com")
+	if svc.Target != "http://10.0.0.2:1234" || svc.Agent != "a" {
+		t.Errorf("service = %+v, want new target and same agent", svc)
+	}
+	if revs := p.revisions.List(revisions.KindService, "x.com"); len(revs) != 1 || revs[0].Action != "updated" {
+		t.Errorf("revisions = %+v, want one update", revs)
+	}
+
+	w = httptest.NewRecorder()
+	p.HandleServiceAPI(w, httptest.NewRequest("PATCH", "/api/services/x.com", strings.NewReader(`{"target":"ftp://10.0.0.3"}`)))
+	if w.Code != 422 || !strings.Contains(w.Body.String(), `"field":"target"`) {
+		t.Errorf("invalid target = %d %s, want 422", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	p.HandleServiceAPI(w, httptest.NewRequest("PATCH", "/api/services/y.com", strings.NewReader(`{"target":"http://10.0.0.2:1234"}`)))
+	if w.Code != 404 {
+		t.Errorf("unknown service = %d, want 404", w.Code)
+	}
+	registry.SetConfigured([]string{"x.com"})
+	w = httptest.NewRecorder()
+	p.HandleServiceAPI(w, httptest.NewRequest("PATCH", "/api/services/x.com", strings.NewReader(`{"target":"http://10.0.0.3:1234"}`)))
+	if w.Code != 409 {
+		t.Errorf("configured service = %d, want 409", w.Code)
+	}
+	w = httptest.NewRecorder()
+	p.HandleServiceAPI(w, httptest.NewRequest("POST", "/api/services", strings.NewReader(`{"hostname":"X.com","target":"http://10.0.0.3:1234"}`)))
+	if w.Code != 409 {
+		t.Errorf("re-registering configured service = %d, want 409", w.Code)
+	}
+}
+
 func TestServiceAPINotOnPublicPort(t *testing.T) {
 	registry := services.NewRegistry(testLogger())
 	p := New(registry, "", testLogger())
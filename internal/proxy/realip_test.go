@@ -0,0 +1,46 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"warren/internal/realip"
+	"warren/internal/services"
+)
+
+func TestClientIPHeadersToBackend(t *testing.T) {
+	var got http.Header
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer backend.Close()
+	target, _ := url.Parse(backend.URL)
+
+	p := New(services.NewRegistry(testLogger()), "", testLogger())
+	p.Register("a.com", "a", target, &mockPolicy{state: "ready"})
+	send := func(peer string) {
+		req := httptest.NewRequest("GET", "http://a.com/", nil)
+		req.RemoteAddr = peer + ":5555"
+		req.Header.Set("X-Forwarded-For", "6.6.6.6")
+		req.Header.Set("X-Real-IP", "6.6.6.6")
+		p.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// By default nobody is trusted: spoofed headers are replaced.
+	send("203.0.113.9")
+	if xff, real := got.Get("X-Forwarded-For"), got.Get("X-Real-IP"); xff != "203.0.113.9" || real != "203.0.113.9" {
+		t.Errorf("untrusted: X-Forwarded-For %q, X-Real-IP %q; want the peer in both", xff, real)
+	}
+
+	res, err := realip.New([]string{"10.0.0.0/8"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.SetClientIPResolver(res)
+	send("10.0.0.7")
+	if xff, real := got.Get("X-Forwarded-For"), got.Get("X-Real-IP"); xff != "6.6.6.6, 10.0.0.7" || real != "6.6.6.6" {
+		t.Errorf("trusted: X-Forwarded-For %q, X-Real-IP %q", xff, real)
+	}
+}
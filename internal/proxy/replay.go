@@ -0,0 +1,218 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultReplayMemory is how many bytes of held request bodies are kept in
+// memory, across all requests, before further bodies spill to disk.
+const DefaultReplayMemory = 32 << 20
+
+// DefaultReplayDisk is how many bytes of held request bodies may spill to
+// disk, across all requests, before further requests are refused.
+const DefaultReplayDisk = 1 << 30
+
+// Errors for bodies the replay buffer can't hold: one body bigger than the
+// whole disk budget, or the budget used up by other held requests.
+var (
+	errReplayTooLarge = errors.New("replay buffer: request body larger than the disk budget")
+	errReplayFull     = errors.New("replay buffer: disk budget used up")
+)
+
+// replayBuffer holds the bodies of requests waiting for an agent to wake, so
+// the requests can be replayed once it's ready. Bodies share one memory
+// budget; once it's used up, the rest of each body spills to a temp file,
+// up to a second budget for the disk.
+type replayBuffer struct {
+	limit     atomic.Int64
+	diskLimit atomic.Int64 // 0 means DefaultReplayDisk
+	dir       atomic.Pointer[string]
+	memory    atomic.Int64  // body bytes held in memory
+	disk      atomic.Int64  // body bytes spilled to temp files
+	spills    atomic.Uint64 // bodies that needed a temp file
+}
+
+// ReplayBufferStats reports the replay buffer's usage.
+type ReplayBufferStats struct {
+	MemoryBytes int64
+	DiskBytes   int64
+	Spills      uint64
+}
+
+// SetReplayBuffer sets the memory and disk budgets for request bodies held
+// while agents wake and the directory bodies over the memory budget spill
+// to; an empty dir means the system temp directory. Budgets of 0 use
+// DefaultReplayMemory and DefaultReplayDisk.
+func (p *Proxy) SetReplayBuffer(limit, disk int64, dir string) {
+	if limit <= 0 {
+		limit = DefaultReplayMemory
+	}
+	p.replay.limit.Store(limit)
+	p.replay.diskLimit.Store(max(disk, 0))
+	p.replay.dir.Store(&dir)
+}
+
+// ReplayBufferStats returns the current replay buffer usage.
+func (p *Proxy) ReplayBufferStats() ReplayBufferStats {
+	return ReplayBufferStats{
+		MemoryBytes: p.replay.memory.Load(),
+		DiskBytes:   p.replay.disk.Load(),
+		Spills:      p.replay.spills.Load(),
+	}
+}
+
+// read consumes body into memory, spilling to a temp file past the shared
+// budget. The caller must Close the result to release its share.
+func (b *replayBuffer) read(body io.Reader) (*bufferedBody, error) {
+	bb := &bufferedBody{buf: b}
+	var mem bytes.Buffer
+	chunk := make([]byte, 32<<10)
+	for {
+		n, err := body.Read(chunk)
+		if n > 0 {
+			if werr := bb.write(&mem, chunk[:n]); werr != nil {
+				bb.Close()
+				return nil, werr
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			bb.Close()
+			return nil, err
+		}
+	}
+	bb.Reader = bytes.NewReader(mem.Bytes())
+	if bb.file != nil {
+		bb.Reader = io.MultiReader(bb.Reader, io.NewSectionReader(bb.file, 0, bb.onDisk))
+	}
+	return bb, nil
+}
+
+// bufferedBody is a request body held by the replay buffer.
+type bufferedBody struct {
+	io.Reader
+	buf      *replayBuffer
+	inMemory int64
+	file     *os.File
+	onDisk   int64
+	once     sync.Once
+}
+
+func (bb *bufferedBody) write(mem *bytes.Buffer, p []byte) error {
+	n := int64(len(p))
+	if bb.file == nil {
+		if bb.buf.memory.Add(n) <= bb.buf.limit.Load() {
+			bb.inMemory += n
+			mem.Write(p)
+			return nil
+		}
+		bb.buf.memory.Add(-n)
+		if err := bb.spill(); err != nil {
+			return err
+		}
+	}
+	limit := bb.buf.diskLimit.Load()
+	if limit <= 0 {
+		limit = DefaultReplayDisk
+	}
+	if bb.onDisk+n > limit {
+		return errReplayTooLarge
+	}
+	if bb.buf.disk.Add(n) > limit {
+		bb.buf.disk.Add(-n)
+		return errReplayFull
+	}
+	if _, err := bb.file.Write(p); err != nil {
+		bb.buf.disk.Add(-n)
+		return fmt.Errorf("replay buffer: %w", err)
+	}
+	bb.onDisk += n
+	return nil
+}
+
+// spill opens the temp file the rest of the body goes to. Its name is
+// removed straight away, so the space is reclaimed when the file is closed
+// even if Warren dies first.
+func (bb *bufferedBody) spill() error {
+	dir := ""
+	if d := bb.buf.dir.Load(); d != nil {
+		dir = *d
+	}
+	f, err := os.CreateTemp(dir, "warren-replay-*")
+	if err != nil {
+		return fmt.Errorf("replay buffer: %w", err)
+	}
+	os.Remove(f.Name()) //nolint:errcheck
+	bb.file = f
+	bb.buf.spills.Add(1)
+	return nil
+}
+
+// Close releases the body's memory and temp file. It's safe to call more
+// than once.
+func (bb *bufferedBody) Close() error {
+	bb.once.Do(func() {
+		bb.buf.memory.Add(-bb.inMemory)
+		if bb.file != nil {
+			bb.file.Close()
+			bb.buf.disk.Add(-bb.onDisk)
+		}
+	})
+	return nil
+}
+
+// size is the body's length in bytes.
+func (bb *bufferedBody) size() int64 {
+	return bb.inMemory + bb.onDisk
+}
+
+// holdForWake buffers the request body and waits up to hold for the agent
+// to become routable. It reports false, having written the response, if
+// the request can't be replayed. The returned func releases the buffer.
+func (p *Proxy) holdForWake(w http.ResponseWriter, r *http.Request, hostname string, backend *Backend, hold time.Duration) (func(), bool) {
+	release := func() {}
+	if r.Body != nil && r.Body != http.NoBody {
+		body, err := p.replay.read(r.Body)
+		if err != nil {
+			switch {
+			case bodyTooLarge(w, err):
+			case errors.Is(err, errReplayTooLarge):
+				p.proxyError(w, r, http.StatusRequestEntityTooLarge, "request body too large to hold while the agent wakes")
+			case errors.Is(err, errReplayFull):
+				p.logger.Warn("replay buffer full, refusing held request", "agent", backend.AgentName)
+				p.proxyError(w, r, http.StatusServiceUnavailable, "service unavailable: can't hold request")
+			default:
+				p.logger.Error("failed to buffer request body for replay", "agent", backend.AgentName, "error", err)
+				p.proxyError(w, r, http.StatusServiceUnavailable, "service unavailable: can't hold request")
+			}
+			return nil, false
+		}
+		r.Body = body
+		r.ContentLength = body.size()
+		release = func() { body.Close() }
+	}
+
+	// Count the request as a connection so the agent can't be slept while
+	// it waits.
+	p.ws.Inc(hostname)
+	err := waitRoutable(r.Context(), backend.Policy, hold)
+	p.ws.Dec(hostname)
+	if err != nil {
+		release()
+		if r.Context().Err() == nil {
+			p.serveWaking(w, r, hostname, backend.Policy.State(), backend)
+		}
+		return nil, false
+	}
+	return release, true
+}
@@ -0,0 +1,180 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"warren/internal/services"
+)
+
+func TestReplayBufferSpillsToDisk(t *testing.T) {
+	dir := t.TempDir()
+	b := &replayBuffer{}
+	b.limit.Store(100)
+	b.dir.Store(&dir)
+
+	small, err := b.read(strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := bytes.Repeat([]byte("x"), 200_000)
+	large, err := b.read(bytes.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.memory.Load() != 5 || b.disk.Load() != 200_000 || b.spills.Load() != 1 {
+		t.Errorf("memory %d, disk %d, spills %d", b.memory.Load(), b.disk.Load(), b.spills.Load())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("spill file left visible in %s: %v", dir, entries)
+	}
+
+	got, _ := io.ReadAll(large)
+	if !bytes.Equal(got, payload) || large.size() != int64(len(payload)) {
+		t.Errorf("read back %d bytes, want %d", len(got), len(payload))
+	}
+	if got, _ := io.ReadAll(small); string(got) != "hello" {
+		t.Errorf("small body = %q", got)
+	}
+
+	small.Close()
+	large.Close()
+	large.Close()
+	if b.memory.Load() != 0 || b.disk.Load() != 0 {
+		t.Errorf("after close: memory %d, disk %d", b.memory.Load(), b.disk.Load())
+	}
+}
+
+func TestReplayBufferDiskBudget(t *testing.T) {
+	dir := t.TempDir()
+	b := &replayBuffer{}
+	b.limit.Store(10)
+	b.diskLimit.Store(1000)
+	b.dir.Store(&dir)
+
+	if _, err := b.read(bytes.NewReader(make([]byte, 2000))); !errors.Is(err, errReplayTooLarge) {
+		t.Errorf("body over the disk budget: %v, want errReplayTooLarge", err)
+	}
+	held, err := b.read(bytes.NewReader(make([]byte, 800)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.read(bytes.NewReader(make([]byte, 500))); !errors.Is(err, errReplayFull) {
+		t.Errorf("body past the shared budget: %v, want errReplayFull", err)
+	}
+	if b.disk.Load() != 800 || b.memory.Load() != 0 {
+		t.Errorf("after refusals: memory %d, disk %d, want only the held body", b.memory.Load(), b.disk.Load())
+	}
+	held.Close()
+	if _, err := b.read(bytes.NewReader(make([]byte, 500))); err != nil {
+		t.Errorf("budget not released on close: %v", err)
+	}
+}
+
+func TestWakeHoldRefusesOverDiskBudget(t *testing.T) {
+	target, _ := url.Parse("http://127.0.0.1:1")
+	p := New(services.NewRegistry(testLogger()), "", testLogger())
+	p.SetReplayBuffer(4, 16, t.TempDir())
+	p.RegisterWithOptions("a.com", "a", target, &mockPolicy{state: "sleeping"}, RouteOptions{WakeHold: 5 * time.Second})
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("POST", "http://a.com/upload", strings.NewReader(strings.Repeat("x", 100))))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("held request over the disk budget: %d, want 413", w.Code)
+	}
+	if st := p.ReplayBufferStats(); st.MemoryBytes != 0 || st.DiskBytes != 0 {
+		t.Errorf("stats after refusal = %+v", st)
+	}
+}
+
+func TestWakeHoldReplaysRequest(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write([]byte(r.Method + " " + string(body)))
+	}))
+	defer backend.Close()
+	target, _ := url.Parse(backend.URL)
+
+	p := New(services.NewRegistry(testLogger()), "", testLogger())
+	p.SetReplayBuffer(4, 0, t.TempDir())
+	p.RegisterWithOptions("a.com", "a", target, &wakingPolicy{state: "sleeping"}, RouteOptions{WakeHold: 5 * time.Second})
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("POST", "http://a.com/upload", strings.NewReader("large upload")))
+	if w.Code != http.StatusOK || w.Body.String() != "POST large upload" {
+		t.Errorf("held request: %d %q", w.Code, w.Body.String())
+	}
+	if st := p.ReplayBufferStats(); st.MemoryBytes != 0 || st.DiskBytes != 0 || st.Spills != 1 {
+		t.Errorf("stats after replay = %+v", st)
+	}
+}
+
+func TestDynamicServiceWakesAgent(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("preview"))
+	}))
+	defer backend.Close()
+	target, _ := url.Parse("http://127.0.0.1:1")
+
+	registry := services.NewRegistry(testLogger())
+	p := New(registry, "", testLogger())
+	pol := &wakingPolicy{state: "sleeping"}
+	p.RegisterWithOptions("a.com", "a", target, pol, RouteOptions{WakeHold: 5 * time.Second})
+	registry.RegisterUnsafe("preview.a.com", backend.URL, "a")
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", "http://preview.a.com/", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "preview" {
+		t.Errorf("held service request: %d %q", w.Code, w.Body.String())
+	}
+	if pol.State() != "ready" {
+		t.Error("expected the service request to wake its agent")
+	}
+	if p.Activity().LastActivity("a.com").IsZero() {
+		t.Error("expected service traffic to count as the agent's activity")
+	}
+}
+
+func TestDynamicServiceWakingWithoutHold(t *testing.T) {
+	registry := services.NewRegistry(testLogger())
+	p := New(registry, "", testLogger())
+	target, _ := url.Parse("http://127.0.0.1:1")
+	p.Register("a.com", "a", target, &mockPolicy{state: "sleeping"})
+	registry.RegisterUnsafe("preview.a.com", "http://127.0.0.1:1", "a")
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", "http://preview.a.com/", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("service of a sleeping agent: %d, Retry-After %q, want 503 like the agent's own hostname", w.Code, w.Header().Get("Retry-After"))
+	}
+}
+
+func TestWakeHoldTimesOut(t *testing.T) {
+	target, _ := url.Parse("http://127.0.0.1:1")
+	p := New(services.NewRegistry(testLogger()), "", testLogger())
+	p.RegisterWithOptions("a.com", "a", target, &mockPolicy{state: "sleeping"}, RouteOptions{WakeHold: 50 * time.Millisecond})
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("POST", "http://a.com/", strings.NewReader("body")))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("timed out hold: %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	// Browsers get the splash page straight away.
+	req := httptest.NewRequest("GET", "http://a.com/", nil)
+	req.Header.Set("Accept", "text/html")
+	w = httptest.NewRecorder()
+	start := time.Now()
+	p.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable || time.Since(start) > 40*time.Millisecond {
+		t.Errorf("browser request: %d after %s", w.Code, time.Since(start))
+	}
+}
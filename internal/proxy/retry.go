@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// Defaults for unset Retry fields.
+const (
+	DefaultRetryAttempts = 2
+	DefaultRetryDelay    = 250 * time.Millisecond
+)
+
+// Retry re-sends idempotent requests that fail to reach the backend at all,
+// which is common in the moments after a wake while the backend is still
+// binding its port.
+type Retry struct {
+	Attempts int           // retries after the first try; default 2
+	Delay    time.Duration // pause between tries; default 250ms
+}
+
+func (r *Retry) attempts() int {
+	if r.Attempts <= 0 {
+		return DefaultRetryAttempts
+	}
+	return r.Attempts
+}
+
+func (r *Retry) delay() time.Duration {
+	if r.Delay <= 0 {
+		return DefaultRetryDelay
+	}
+	return r.Delay
+}
+
+type retryKey struct{}
+
+// withRetry attaches the route's retry settings to the request for
+// retryTransport to find.
+func withRetry(r *http.Request, retry *Retry) *http.Request {
+	if retry == nil {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), retryKey{}, retry))
+}
+
+// retryTransport retries GET and HEAD requests whose round trip fails
+// because the backend couldn't be reached, as configured by the request's
+// route. Responses, even 5xx ones, and errors after the connection was made,
+// such as header timeouts and resets, are never retried: the backend may
+// have received the request and acted on it.
+type retryTransport struct {
+	next   http.RoundTripper
+	logger *slog.Logger
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	retry, _ := req.Context().Value(retryKey{}).(*Retry)
+	resp, err := t.next.RoundTrip(req)
+	if retry == nil || !retryable(req) {
+		return resp, err
+	}
+	for i := 0; err != nil && unreachable(err) && i < retry.attempts(); i++ {
+		if req.Context().Err() != nil {
+			break // the client went away; nothing to retry for
+		}
+		t.logger.Debug("retrying request after connection error", "host", req.URL.Host, "attempt", i+1, "error", err)
+		timer := time.NewTimer(retry.delay())
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+		resp, err = t.next.RoundTrip(req)
+	}
+	return resp, err
+}
+
+// CloseIdleConnections closes the wrapped transport's idle connections.
+func (t *retryTransport) CloseIdleConnections() {
+	closeIdle(t.next)
+}
+
+// retryable reports whether req can safely be sent again: an idempotent
+// method with no body to replay.
+func retryable(req *http.Request) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	return req.Body == nil || req.Body == http.NoBody
+}
+
+// unreachable reports whether err means the request never reached the
+// backend: dialing failed, e.g. with connection refused.
+func unreachable(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
@@ -0,0 +1,133 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"warren/internal/services"
+	"warren/internal/transport"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestRetryTransport(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		retry  *Retry
+		err    error
+		fails  int
+		calls  int
+		wantOK bool
+	}{
+		{"get recovers", "GET", "", &Retry{Attempts: 3, Delay: time.Millisecond}, refused, 2, 3, true},
+		{"head recovers", "HEAD", "", &Retry{Attempts: 1, Delay: time.Millisecond}, refused, 1, 2, true},
+		{"attempts exhausted", "GET", "", &Retry{Attempts: 2, Delay: time.Millisecond}, refused, 5, 3, false},
+		{"post not retried", "POST", "x", &Retry{Attempts: 3, Delay: time.Millisecond}, refused, 1, 1, false},
+		{"no retry configured", "GET", "", nil, refused, 1, 1, false},
+		// The backend was reached: it may have acted on the request.
+		{"header timeout not retried", "GET", "", &Retry{Attempts: 3, Delay: time.Millisecond}, errors.New("net/http: timeout awaiting response headers"), 1, 1, false},
+		{"reset not retried", "GET", "", &Retry{Attempts: 3, Delay: time.Millisecond}, &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}, 1, 1, false},
+		{"eof not retried", "GET", "", &Retry{Attempts: 3, Delay: time.Millisecond}, io.EOF, 1, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			rt := &retryTransport{logger: testLogger(), next: roundTripFunc(func(*http.Request) (*http.Response, error) {
+				calls++
+				if calls <= tt.fails {
+					return nil, tt.err
+				}
+				return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+			})}
+
+			req := httptest.NewRequest(tt.method, "http://a.com/", nil)
+			if tt.body != "" {
+				req = httptest.NewRequest(tt.method, "http://a.com/", strings.NewReader(tt.body))
+			}
+			resp, err := rt.RoundTrip(withRetry(req, tt.retry))
+			if calls != tt.calls {
+				t.Errorf("calls = %d, want %d", calls, tt.calls)
+			}
+			if ok := err == nil && resp.StatusCode == 200; ok != tt.wantOK {
+				t.Errorf("ok = %v (err %v), want %v", ok, err, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestRetrySlowBackendOnce(t *testing.T) {
+	// A backend that takes the request but answers too late is hit once,
+	// not once per retry.
+	var hits atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer backend.Close()
+
+	target, _ := url.Parse(backend.URL)
+	p := New(services.NewRegistry(testLogger()), "", testLogger())
+	p.RegisterWithOptions("a.com", "a", target, &mockPolicy{state: "ready"}, RouteOptions{
+		Retry:    &Retry{Attempts: 3, Delay: time.Millisecond},
+		Timeouts: &transport.Timeouts{ResponseHeader: 20 * time.Millisecond},
+	})
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", "http://a.com/", nil))
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("status = %d, want 504", w.Code)
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("backend hit %d times, want 1", n)
+	}
+}
+
+func TestRetryAfterWake(t *testing.T) {
+	// Reserve a port, then bring the backend up on it shortly after the
+	// first request, as a freshly woken container would.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	backend := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("awake"))
+	})}
+	defer backend.Close()
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return
+		}
+		backend.Serve(ln)
+	}()
+
+	target, _ := url.Parse("http://" + addr)
+	p := New(services.NewRegistry(testLogger()), "", testLogger())
+	p.RegisterWithOptions("a.com", "a", target, &mockPolicy{state: "ready"}, RouteOptions{
+		Retry: &Retry{Attempts: 20, Delay: 10 * time.Millisecond},
+	})
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", "http://a.com/", nil))
+	if w.Code != 200 || w.Body.String() != "awake" {
+		t.Errorf("got %d %q, want 200 awake", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,59 @@
+package proxy
+
+import (
+	"sort"
+	"strings"
+
+	"warren/internal/redirect"
+)
+
+// routeTable maps lower-cased hostnames to backends. A published table is
+// never modified: writers copy it, change the copy and swap it in, so the
+// request path reads routes without taking a lock.
+type routeTable map[string]*Backend
+
+// agentIndex maps agent names to their hostnames in a routeTable, sorted,
+// so per-request lookups by agent don't scan every route.
+type agentIndex map[string][]string
+
+// lookup returns the backend for a normalised hostname.
+func (p *Proxy) lookup(hostname string) (*Backend, bool) {
+	b, ok := (*p.routes.Load())[hostname]
+	return b, ok
+}
+
+// updateRoutes applies fn to a copy of the routing table and publishes it.
+func (p *Proxy) updateRoutes(fn func(routeTable)) {
+	p.routesMu.Lock()
+	defer p.routesMu.Unlock()
+	old := *p.routes.Load()
+	next := make(routeTable, len(old)+1)
+	for h, b := range old {
+		next[h] = b
+	}
+	fn(next)
+	index := make(agentIndex)
+	for h, b := range next {
+		index[b.AgentName] = append(index[b.AgentName], h)
+	}
+	for _, hosts := range index {
+		sort.Strings(hosts)
+	}
+	p.routes.Store(&next)
+	p.agentHosts.Store(&index)
+}
+
+// normalizeHost strips any port from a Host header and lower-cases it.
+// Hostnames that are already lower case, as browsers send them, are
+// returned without allocating.
+func normalizeHost(host string) string {
+	host = stripPort(host)
+	host = strings.TrimSuffix(host, ".")
+	return strings.ToLower(host)
+}
+
+// SetRedirects sets the redirect rules answered before routing. Nil
+// disables redirects.
+func (p *Proxy) SetRedirects(t *redirect.Table) {
+	p.redirects.Store(t)
+}
@@ -0,0 +1,249 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"warren/internal/realip"
+	"warren/internal/redirect"
+	"warren/internal/services"
+	"warren/internal/transport"
+)
+
+func TestNormalizeHost(t *testing.T) {
+	for in, want := range map[string]string{
+		"a.com":           "a.com",
+		"A.Com:8080":      "a.com",
+		"a.com.":          "a.com",
+		"App.Example.Com": "app.example.com",
+	} {
+		if got := normalizeHost(in); got != want {
+			t.Errorf("normalizeHost(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRoutesAreCaseInsensitive(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+	target, _ := url.Parse(backend.URL)
+
+	registry := services.NewRegistry(testLogger())
+	p := New(registry, "", testLogger())
+	p.Register("Agent.Example.com", "a", target, &mockPolicy{state: "ready"})
+	registry.RegisterUnsafe("Svc.Example.com", backend.URL, "a")
+
+	for _, host := range []string{"agent.example.com", "AGENT.EXAMPLE.COM:443", "svc.example.com", "Svc.Example.Com."} {
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, httptest.NewRequest("GET", "http://"+host+"/", nil))
+		if w.Code != 200 {
+			t.Errorf("%s: status = %d, want 200", host, w.Code)
+		}
+	}
+	if err := registry.Register("AGENT.example.com", "http://10.0.0.1:80", "b"); err == nil {
+		t.Error("registering a configured hostname in another case should be rejected")
+	}
+}
+
+func TestSetOptionsPublishesNewBackend(t *testing.T) {
+	p := New(services.NewRegistry(testLogger()), "", testLogger())
+	target, _ := url.Parse("http://10.0.0.1:80")
+	p.Register("a.com", "a", target, &mockPolicy{state: "ready"})
+
+	before, _ := p.Backend("a.com")
+	p.SetOptions("a.com", RouteOptions{AgentToken: "t"})
+	after, _ := p.Backend("a.com")
+	if before.Options.AgentToken != "" {
+		t.Error("SetOptions modified the backend in-flight requests hold")
+	}
+	if after.Options.AgentToken != "t" {
+		t.Errorf("new backend token = %q, want t", after.Options.AgentToken)
+	}
+}
+
+func TestSetOptionsClosesReplacedTransport(t *testing.T) {
+	closed := make(chan struct{}, 1)
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	backend.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			closed <- struct{}{}
+		}
+	}
+	backend.Start()
+	defer backend.Close()
+	target, _ := url.Parse(backend.URL)
+
+	p := New(services.NewRegistry(testLogger()), "", testLogger())
+	opts := RouteOptions{Timeouts: &transport.Timeouts{Dial: time.Second}}
+	p.RegisterWithOptions("a.com", "a", target, &mockPolicy{state: "ready"}, opts)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", "http://a.com/", nil))
+	if w.Code != 200 {
+		t.Fatalf("status = %d", w.Code)
+	}
+
+	// Settings that keep the transport reuse it.
+	before, _ := p.Backend("a.com")
+	opts.AgentToken = "t"
+	p.SetOptions("a.com", opts)
+	if after, _ := p.Backend("a.com"); after.Proxy.Transport != before.Proxy.Transport {
+		t.Error("unchanged timeouts built a new transport")
+	}
+
+	p.SetOptions("a.com", RouteOptions{Timeouts: &transport.Timeouts{Dial: 2 * time.Second}})
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Error("the replaced transport's idle connection was left open")
+	}
+}
+
+func TestRouteLookupDoesNotAllocate(t *testing.T) {
+	p := benchProxy(100)
+	allocs := testing.AllocsPerRun(1000, func() {
+		if _, ok := p.lookup(normalizeHost("agent-50.example.com:443")); !ok {
+			t.Fatal("route not found")
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("lookup allocates %v times per request, want 0", allocs)
+	}
+}
+
+func benchProxy(n int) *Proxy {
+	p := New(services.NewRegistry(testLogger()), "", testLogger())
+	target, _ := url.Parse("http://10.0.0.1:80")
+	for i := 0; i < n; i++ {
+		p.Register(fmt.Sprintf("agent-%d.example.com", i), "a", target, &mockPolicy{state: "ready"})
+	}
+	return p
+}
+
+func BenchmarkRouteLookup(b *testing.B) {
+	p := benchProxy(100)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			p.lookup(normalizeHost("agent-50.example.com:443"))
+		}
+	})
+}
+
+// BenchmarkRouteLookupDuringReload measures lookups while another goroutine
+// keeps replacing a route's options, as a config reload does.
+func BenchmarkRouteLookupDuringReload(b *testing.B) {
+	p := benchProxy(100)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				p.SetOptions("agent-1.example.com", RouteOptions{})
+			}
+		}
+	}()
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			p.lookup(normalizeHost("agent-50.example.com:443"))
+		}
+	})
+}
+
+func BenchmarkServiceLookup(b *testing.B) {
+	registry := services.NewRegistry(testLogger())
+	for i := 0; i < 100; i++ {
+		registry.RegisterUnsafe(fmt.Sprintf("svc-%d.example.com", i), "http://10.0.0.1:80", "a")
+	}
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			registry.Lookup("svc-50.example.com")
+		}
+	})
+}
+
+func TestRedirectsBeforeRouting(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("agent"))
+	}))
+	defer backend.Close()
+	target, _ := url.Parse(backend.URL)
+
+	p := New(services.NewRegistry(testLogger()), "", testLogger())
+	p.Register("example.com", "a", target, &mockPolicy{state: "ready"})
+	table, err := redirect.New([]redirect.Rule{{From: "www.example.com", To: "example.com"}}, []string{"example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.SetRedirects(table)
+	res, err := realip.New([]string{"10.0.0.0/8"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.SetClientIPResolver(res)
+
+	get := func(rawURL, proto string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", rawURL, nil)
+		req.RemoteAddr = "10.0.0.7:5555"
+		req.Header.Set("X-Forwarded-Proto", proto)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+		return w
+	}
+	if w := get("http://WWW.example.com:8080/x", "https"); w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "https://example.com/x" {
+		t.Errorf("alias: %d %q", w.Code, w.Header().Get("Location"))
+	}
+	if w := get("http://example.com/x", "http"); w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "https://example.com/x" {
+		t.Errorf("force https: %d %q", w.Code, w.Header().Get("Location"))
+	}
+	if w := get("http://example.com/x", "https"); w.Code != http.StatusOK || w.Body.String() != "agent" {
+		t.Errorf("https request: %d %q", w.Code, w.Body.String())
+	}
+
+	// A client that isn't a trusted proxy can't claim HTTPS.
+	req := httptest.NewRequest("GET", "http://example.com/x", nil)
+	req.RemoteAddr = "203.0.113.9:5555"
+	req.Header.Set("X-Forwarded-Proto", "https")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "https://example.com/x" {
+		t.Errorf("untrusted X-Forwarded-Proto: %d %q, want redirect to https", w.Code, w.Header().Get("Location"))
+	}
+}
+
+func TestAgentBackendIndex(t *testing.T) {
+	p := New(services.NewRegistry(testLogger()), "", testLogger())
+	target, _ := url.Parse("http://127.0.0.1:1")
+	p.Register("b.com", "a", target, &mockPolicy{state: "ready"})
+	p.Register("A.com", "a", target, &mockPolicy{state: "ready"})
+	p.Register("c.com", "c", target, &mockPolicy{state: "ready"})
+
+	if b, hosts := p.agentBackend("a"); b == nil || fmt.Sprint(hosts) != "[a.com b.com]" {
+		t.Errorf("agentBackend(a) = %v, %v, want a backend on [a.com b.com]", b, hosts)
+	}
+	p.Deregister("b.com")
+	if _, hosts := p.agentBackend("a"); fmt.Sprint(hosts) != "[a.com]" {
+		t.Errorf("after deregistering b.com: hosts = %v, want [a.com]", hosts)
+	}
+	// A hostname moving to another agent leaves the old one's index.
+	p.Register("a.com", "c", target, &mockPolicy{state: "ready"})
+	if b, hosts := p.agentBackend("a"); b != nil || hosts != nil {
+		t.Errorf("agentBackend(a) = %v, %v after its hostname moved, want none", b, hosts)
+	}
+	if _, hosts := p.agentBackend("c"); fmt.Sprint(hosts) != "[a.com c.com]" {
+		t.Errorf("agentBackend(c) hosts = %v, want [a.com c.com]", hosts)
+	}
+}
@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"warren/internal/revisions"
+)
+
+// ServiceAPI serves the service registration API on a listener of its own,
+// so agent containers that register themselves needn't reach the admin
+// port. Requests need a bearer token from the configured set, and nothing
+// but /api/services is served.
+type ServiceAPI struct {
+	p      *Proxy
+	tokens atomic.Pointer[[]string]
+}
+
+// ServiceAPI returns the service API accepting tokens.
+func (p *Proxy) ServiceAPI(tokens []string) *ServiceAPI {
+	s := &ServiceAPI{p: p}
+	s.SetTokens(tokens)
+	return s
+}
+
+// SetTokens replaces the accepted tokens, e.g. on reload.
+func (s *ServiceAPI) SetTokens(tokens []string) {
+	tokens = append([]string(nil), tokens...)
+	s.tokens.Store(&tokens)
+}
+
+func (s *ServiceAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/api/services" && !strings.HasPrefix(r.URL.Path, "/api/services/") {
+		http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+		return
+	}
+	token, ok := s.authorized(r)
+	if !ok {
+		s.p.strike(r, "service api token")
+		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+	r = r.WithContext(revisions.WithActor(r.Context(), revisions.TokenActor(token, r)))
+	s.p.HandleServiceAPI(w, r)
+}
+
+// authorized returns the configured token the request carries, if any.
+// Every token is compared, so the time taken doesn't reveal which one
+// matched.
+func (s *ServiceAPI) authorized(r *http.Request) (string, bool) {
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || got == "" {
+		return "", false
+	}
+	var matched string
+	match := 0
+	for _, token := range *s.tokens.Load() {
+		eq := subtle.ConstantTimeCompare([]byte(got), []byte(token))
+		if eq == 1 {
+			matched = token
+		}
+		match |= eq
+	}
+	return matched, match == 1
+}
@@ -0,0 +1,49 @@
+package proxy
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"warren/internal/services"
+)
+
+func TestServiceAPITokens(t *testing.T) {
+	p := New(services.NewRegistry(testLogger()), "", testLogger())
+	api := p.ServiceAPI([]string{"old", "new"})
+
+	do := func(method, path, token, body string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	for _, token := range []string{"", "wrong", "ol"} {
+		if code := do("GET", "/api/services", token, ""); code != 401 {
+			t.Errorf("token %q: status = %d, want 401", token, code)
+		}
+	}
+	if code := do("GET", "/api/services", "old", ""); code != 200 {
+		t.Errorf("old token: status = %d, want 200", code)
+	}
+	if code := do("POST", "/api/services", "new", `{"hostname":"svc.example.com","target":"http://10.0.0.5:8080"}`); code != 201 {
+		t.Errorf("register: status = %d, want 201", code)
+	}
+	if _, ok := p.registry.Lookup("svc.example.com"); !ok {
+		t.Error("service not registered")
+	}
+
+	// Only the service API is served here.
+	if code := do("GET", "/admin/agents", "new", ""); code != 404 {
+		t.Errorf("/admin/agents: status = %d, want 404", code)
+	}
+
+	api.SetTokens([]string{"new"})
+	if code := do("GET", "/api/services", "old", ""); code != 401 {
+		t.Errorf("rotated-out token: status = %d, want 401", code)
+	}
+}
@@ -0,0 +1,281 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"warren/internal/policy"
+)
+
+// helloTimeout bounds how long a client has to send its TLS ClientHello.
+const helloTimeout = 10 * time.Second
+
+// SNITarget is an agent whose TLS connections are passed through untouched.
+type SNITarget struct {
+	Agent       string
+	Hostnames   []string // server names routed to the agent; the first is used for activity
+	Host        string   // backend host the port is dialled on
+	Port        int
+	Policy      policy.Policy
+	WakeTimeout time.Duration
+}
+
+// SNIRouter accepts TLS connections on one port and routes each to an agent
+// by the server name in its ClientHello, without terminating TLS. Agents
+// that manage their own certificates can share Warren's public port this
+// way, and still sleep and wake like HTTP agents.
+type SNIRouter struct {
+	activity *ActivityTracker
+	conns    *WSCounter
+	logger   *slog.Logger
+
+	// connCtx ends spliced connections; like PortForwarder's, it outlives
+	// the context Serve stops accepting on.
+	connCtx    context.Context
+	closeConns context.CancelFunc
+
+	mu     sync.RWMutex
+	routes map[string]*SNITarget // server name → target
+}
+
+// NewSNIRouter creates a router with no routes.
+func NewSNIRouter(activity *ActivityTracker, conns *WSCounter, logger *slog.Logger) *SNIRouter {
+	connCtx, closeConns := context.WithCancel(context.Background())
+	return &SNIRouter{
+		activity:   activity,
+		conns:      conns,
+		logger:     logger.With("component", "sni"),
+		connCtx:    connCtx,
+		closeConns: closeConns,
+		routes:     make(map[string]*SNITarget),
+	}
+}
+
+// CloseConnections ends the connections still being spliced, once they
+// have had their chance to drain.
+func (s *SNIRouter) CloseConnections() {
+	s.closeConns()
+}
+
+// Register routes the target's hostnames to it, replacing the agent's
+// previous routes. A target with no port removes them.
+func (s *SNIRouter) Register(t SNITarget) {
+	s.Unregister(t.Agent)
+	if t.Port == 0 || len(t.Hostnames) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, h := range t.Hostnames {
+		s.routes[strings.ToLower(h)] = &t
+	}
+}
+
+// Unregister removes the agent's routes. Established connections are left
+// to finish.
+func (s *SNIRouter) Unregister(agent string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for h, t := range s.routes {
+		if t.Agent == agent {
+			delete(s.routes, h)
+		}
+	}
+}
+
+// Hostnames returns the hostnames routed to the agent, sorted.
+func (s *SNIRouter) Hostnames(agent string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []string
+	for h, t := range s.routes {
+		if t.Agent == agent {
+			out = append(out, h)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (s *SNIRouter) lookup(serverName string) (*SNITarget, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.routes[strings.ToLower(serverName)]
+	return t, ok
+}
+
+// Serve accepts connections on ln until it's closed or ctx is done.
+// Connections for server names with no route are dropped.
+func (s *SNIRouter) Serve(ctx context.Context, ln net.Listener) {
+	s.serve(ctx, ln, nil)
+}
+
+// ServeShared accepts connections on ln like Serve, in the background, and
+// hands those for server names with no route to the returned listener, so
+// an HTTPS server terminating TLS itself can share the port. The returned
+// listener closes once ln does.
+func (s *SNIRouter) ServeShared(ctx context.Context, ln net.Listener) net.Listener {
+	fallback := &fallbackListener{addr: ln.Addr(), conns: make(chan net.Conn), done: make(chan struct{})}
+	go func() {
+		defer fallback.Close()
+		s.serve(ctx, ln, fallback)
+	}()
+	return fallback
+}
+
+func (s *SNIRouter) serve(ctx context.Context, ln net.Listener, fallback *fallbackListener) {
+	stop := context.AfterFunc(ctx, func() { ln.Close() })
+	defer stop()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return // listener closed
+		}
+		go s.handle(ctx, conn, fallback)
+	}
+}
+
+func (s *SNIRouter) handle(ctx context.Context, client net.Conn, fallback *fallbackListener) {
+	client.SetReadDeadline(time.Now().Add(helloTimeout)) //nolint:errcheck
+	serverName, hello, err := readClientHello(client)
+	if err != nil {
+		s.logger.Debug("dropping connection without a usable ClientHello", "client", client.RemoteAddr().String(), "error", err)
+		client.Close()
+		return
+	}
+	client.SetReadDeadline(time.Time{}) //nolint:errcheck
+
+	t, ok := s.lookup(serverName)
+	if !ok {
+		// The hello was consumed, so replay it to whoever terminates TLS.
+		replayed := &replayConn{Conn: client, r: io.MultiReader(bytes.NewReader(hello), client)}
+		if fallback == nil || !fallback.deliver(ctx, replayed) {
+			s.logger.Debug("dropping connection for unknown server name", "server_name", serverName)
+			client.Close()
+		}
+		return
+	}
+	defer client.Close()
+	hostname := t.Hostnames[0]
+	logger := s.logger.With("agent", t.Agent, "server_name", serverName)
+
+	// Count the connection from accept so the agent can't be slept while the
+	// client waits for it to wake.
+	s.conns.Inc(hostname)
+	defer s.conns.Dec(hostname)
+	s.activity.Touch(hostname)
+
+	timeout := t.WakeTimeout
+	if timeout <= 0 {
+		timeout = defaultPortWakeTimeout
+	}
+	if err := waitRoutable(ctx, t.Policy, timeout); err != nil {
+		logger.Warn("dropping connection", "error", err)
+		return
+	}
+
+	addr := net.JoinHostPort(t.Host, strconv.Itoa(t.Port))
+	backend, err := net.DialTimeout("tcp", addr, 10*time.Second)
+	if err != nil {
+		logger.Error("failed to dial backend", "backend", addr, "error", err)
+		return
+	}
+	defer backend.Close()
+
+	if _, err := backend.Write(hello); err != nil {
+		logger.Error("failed to forward ClientHello", "backend", addr, "error", err)
+		return
+	}
+	splice(s.connCtx, client, backend, hostname, s.activity)
+}
+
+var errHelloRead = errors.New("client hello read")
+
+// readClientHello reads the TLS ClientHello from conn and returns the server
+// name it asks for, empty if none, along with the bytes read so they can be
+// replayed to the backend. The handshake is abandoned as soon as the hello
+// is parsed.
+func readClientHello(conn net.Conn) (string, []byte, error) {
+	var buf bytes.Buffer
+	var serverName string
+	err := tls.Server(helloConn{r: io.TeeReader(conn, &buf)}, &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			serverName = hello.ServerName
+			return nil, errHelloRead
+		},
+	}).Handshake()
+	if !errors.Is(err, errHelloRead) {
+		return "", nil, err
+	}
+	return serverName, buf.Bytes(), nil
+}
+
+// fallbackListener is the listener ServeShared hands unrouted connections
+// to.
+type fallbackListener struct {
+	addr  net.Addr
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+// deliver waits for conn to be accepted, and reports whether it was.
+func (l *fallbackListener) deliver(ctx context.Context, conn net.Conn) bool {
+	select {
+	case l.conns <- conn:
+		return true
+	case <-l.done:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (l *fallbackListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *fallbackListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *fallbackListener) Addr() net.Addr { return l.addr }
+
+// replayConn reads from r, which starts with bytes already read from Conn.
+type replayConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c *replayConn) Read(p []byte) (int, error) { return c.r.Read(p) }
+
+// helloConn is a read-only net.Conn for parsing a ClientHello; anything
+// the TLS stack tries to send back is discarded.
+type helloConn struct {
+	r io.Reader
+}
+
+func (c helloConn) Read(p []byte) (int, error)       { return c.r.Read(p) }
+func (c helloConn) Write(p []byte) (int, error)      { return 0, io.ErrClosedPipe }
+func (c helloConn) Close() error                     { return nil }
+func (c helloConn) LocalAddr() net.Addr              { return nil }
+func (c helloConn) RemoteAddr() net.Addr             { return nil }
+func (c helloConn) SetDeadline(time.Time) error      { return nil }
+func (c helloConn) SetReadDeadline(time.Time) error  { return nil }
+func (c helloConn) SetWriteDeadline(time.Time) error { return nil }
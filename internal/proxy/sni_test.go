@@ -0,0 +1,144 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// startSNIRouter serves a router on a local port and returns its address.
+func startSNIRouter(t *testing.T, s *SNIRouter) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go s.Serve(ctx, ln)
+	return ln.Addr().String()
+}
+
+func TestSNIRouterPassesThroughTLS(t *testing.T) {
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "from "+r.TLS.ServerName) //nolint:errcheck
+	}))
+	defer backend.Close()
+	u, _ := url.Parse(backend.URL)
+	port, _ := strconv.Atoi(u.Port())
+
+	activity := NewActivityTracker()
+	s := NewSNIRouter(activity, NewWSCounter(), testLogger())
+	pol := &wakingPolicy{state: "sleeping"}
+	s.Register(SNITarget{Agent: "kai", Hostnames: []string{"kai.example.com", "alt.example.com"}, Host: "127.0.0.1", Port: port, Policy: pol, WakeTimeout: 5 * time.Second})
+	addr := startSNIRouter(t, s)
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}
+	resp, err := client.Get("https://ALT.example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	// Routing ignores case; the backend terminated TLS itself and saw the
+	// server name exactly as the client sent it.
+	if string(body) != "from ALT.example.com" {
+		t.Errorf("body = %q", body)
+	}
+	if cert := resp.TLS.PeerCertificates[0]; !cert.Equal(backend.Certificate()) {
+		t.Error("client didn't get the backend's certificate")
+	}
+	if pol.State() != "ready" {
+		t.Error("expected the connection to wake the agent")
+	}
+	if activity.LastActivity("kai.example.com").IsZero() {
+		t.Error("connection didn't count as activity")
+	}
+}
+
+func TestSNIRouterDropsUnknownServerName(t *testing.T) {
+	s := NewSNIRouter(NewActivityTracker(), NewWSCounter(), testLogger())
+	s.Register(SNITarget{Agent: "kai", Hostnames: []string{"kai.example.com"}, Host: "127.0.0.1", Port: 1, Policy: &mockPolicy{state: "ready"}})
+	addr := startSNIRouter(t, s)
+
+	for _, name := range []string{"other.example.com", ""} {
+		conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: name, InsecureSkipVerify: true})
+		if err == nil {
+			conn.Close()
+			t.Errorf("handshake for %q succeeded", name)
+		}
+	}
+
+	// Registering without a port removes the agent's routes.
+	s.Register(SNITarget{Agent: "kai"})
+	if _, ok := s.lookup("kai.example.com"); ok {
+		t.Error("route survived re-registration without tls_passthrough")
+	}
+}
+
+func TestSNIRouterSharesPortWithHTTPS(t *testing.T) {
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "passed through") //nolint:errcheck
+	}))
+	defer backend.Close()
+	u, _ := url.Parse(backend.URL)
+	port, _ := strconv.Atoi(u.Port())
+
+	s := NewSNIRouter(NewActivityTracker(), NewWSCounter(), testLogger())
+	s.Register(SNITarget{Agent: "kai", Hostnames: []string{"kai.example.com"}, Host: "127.0.0.1", Port: port, Policy: &mockPolicy{state: "ready"}})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Warren's own HTTPS server takes the connections passthrough doesn't.
+	https := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "terminated for "+r.TLS.ServerName) //nolint:errcheck
+	}))
+	https.Listener = s.ServeShared(ctx, ln)
+	https.StartTLS()
+	defer https.Close()
+
+	addr := ln.Addr().String()
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}
+	for host, want := range map[string]string{
+		"kai.example.com":   "passed through",
+		"other.example.com": "terminated for other.example.com",
+	} {
+		resp, err := client.Get("https://" + host + "/")
+		if err != nil {
+			t.Fatalf("%s: %v", host, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != want {
+			t.Errorf("%s: body = %q, want %q", host, body, want)
+		}
+	}
+
+	// Stopping the router closes the shared listener too.
+	cancel()
+	if _, err := https.Listener.Accept(); err == nil {
+		t.Error("shared listener still accepting after the router stopped")
+	}
+}
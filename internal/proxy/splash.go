@@ -0,0 +1,265 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"warren/internal/events"
+)
+
+// defaultRetryAfter is the client retry hint while an agent wakes with no
+// better estimate available.
+const defaultRetryAfter = 3 * time.Second
+
+const defaultSplashHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Waking {{.Agent}}…</title>
+<noscript><meta http-equiv="refresh" content="{{.RetryAfter}}"></noscript>
+<style>
+body{font-family:system-ui,sans-serif;display:flex;align-items:center;justify-content:center;height:100vh;margin:0;background:#111;color:#eee}
+main{text-align:center}
+.spinner{width:40px;height:40px;margin:0 auto 1.5em;border:4px solid #444;border-top-color:#eee;border-radius:50%;animation:spin 1s linear infinite}
+@keyframes spin{to{transform:rotate(360deg)}}
+small{color:#999}
+</style>
+</head>
+<body>
+<main>
+<div class="spinner"></div>
+<h1>Waking {{.Agent}}</h1>
+<p id="eta">{{if .EstimatedSeconds}}Usually ready in about {{.EstimatedSeconds}}s.{{else}}This should only take a moment.{{end}}</p>
+<small>This page reloads automatically when the agent is ready.</small>
+</main>
+<script>
+(function(){
+  var retry = {{.RetryAfter}} * 1000;
+  function poll(){
+    fetch("/api/health", {cache: "no-store"}).then(function(r){ return r.json(); }).then(function(h){
+      if (h.status === "ready") { location.reload(); return; }
+      setTimeout(poll, retry);
+    }).catch(function(){ setTimeout(poll, retry); });
+  }
+  setTimeout(poll, retry);
+})();
+</script>
+</body>
+</html>
+`
+
+// Splash renders the page shown to browsers while an agent is waking.
+type Splash struct {
+	tmpl *template.Template
+}
+
+var defaultSplash = &Splash{tmpl: template.Must(template.New("splash").Parse(defaultSplashHTML))}
+
+// splashData is passed to splash templates.
+type splashData struct {
+	Agent            string
+	Hostname         string
+	State            string
+	EstimatedSeconds int // 0 when no wake has been observed yet
+	RetryAfter       int
+}
+
+// NewSplash parses a splash template from path, or the built-in page when
+// path is empty.
+func NewSplash(path string) (*Splash, error) {
+	if path == "" {
+		return defaultSplash, nil
+	}
+	tmpl, err := template.ParseFiles(path)
+	if err != nil {
+		return nil, fmt.Errorf("splash template: %w", err)
+	}
+	return &Splash{tmpl: tmpl}, nil
+}
+
+// WakeTimes tracks how long each agent takes from wake to ready, to estimate
+// the next wake.
+type WakeTimes struct {
+	mu      sync.Mutex
+	started map[string]time.Time
+	avg     map[string]time.Duration
+}
+
+// NewWakeTimes creates an empty wake time tracker.
+func NewWakeTimes() *WakeTimes {
+	return &WakeTimes{
+		started: make(map[string]time.Time),
+		avg:     make(map[string]time.Duration),
+	}
+}
+
+// HandleEvent updates wake timings from agent lifecycle events.
+func (t *WakeTimes) HandleEvent(ev events.Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch ev.Type {
+	case events.AgentWake:
+		t.started[ev.Agent] = time.Now()
+	case events.AgentReady:
+		start, ok := t.started[ev.Agent]
+		if !ok {
+			return
+		}
+		delete(t.started, ev.Agent)
+		d := time.Since(start)
+		if prev, ok := t.avg[ev.Agent]; ok {
+			d = (prev + d) / 2
+		}
+		t.avg[ev.Agent] = d
+	case events.AgentSleep, events.AgentDegraded:
+		delete(t.started, ev.Agent)
+	}
+}
+
+// Remaining estimates how long until the agent is ready. The second return
+// is false when no wake has been observed for the agent.
+func (t *WakeTimes) Remaining(agent string) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	avg, ok := t.avg[agent]
+	if !ok {
+		return 0, false
+	}
+	if start, waking := t.started[agent]; waking {
+		avg -= time.Since(start)
+	}
+	if avg < time.Second {
+		avg = time.Second
+	}
+	return avg, true
+}
+
+// SetSplash replaces the default splash page for waking agents. A nil
+// splash disables it, leaving only the JSON 503 response.
+func (p *Proxy) SetSplash(s *Splash) {
+	p.splash = s
+}
+
+// WakeTimes returns the wake time tracker used for splash estimates.
+func (p *Proxy) WakeTimes() *WakeTimes {
+	return p.wakeTimes
+}
+
+// serveWaking answers a request for an agent that is sleeping or starting:
+// an HTML splash page for browsers, JSON for everything else.
+func (p *Proxy) serveWaking(w http.ResponseWriter, r *http.Request, hostname, state string, backend *Backend) {
+	retry := defaultRetryAfter
+	estimate, known := p.wakeTimes.Remaining(backend.AgentName)
+	if known && estimate < retry {
+		retry = estimate
+	}
+	retrySecs := int(retry.Round(time.Second) / time.Second)
+
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Retry-After", strconv.Itoa(retrySecs))
+
+	if backend.Options.GRPC && IsGRPC(r) {
+		grpcError(w, http.StatusServiceUnavailable, "agent "+backend.AgentName+" is "+state)
+		return
+	}
+
+	splash := backend.Options.Splash
+	if splash == nil {
+		splash = p.splash
+	}
+	if splash != nil && wantsHTML(r) {
+		data := splashData{
+			Agent:      backend.AgentName,
+			Hostname:   hostname,
+			State:      state,
+			RetryAfter: retrySecs,
+		}
+		if known {
+			data.EstimatedSeconds = int(estimate.Round(time.Second) / time.Second)
+		}
+		var buf bytes.Buffer
+		err := splash.tmpl.Execute(&buf, data)
+		if err == nil {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write(buf.Bytes())
+			return
+		}
+		p.logger.Error("splash template failed, falling back to JSON", "agent", backend.AgentName, "error", err)
+	}
+
+	resp := wakingResponse{
+		Status:     state,
+		Agent:      backend.AgentName,
+		RetryAfter: retrySecs,
+	}
+	if known {
+		resp.EstimatedSeconds = int(estimate.Round(time.Second) / time.Second)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// wakeRefuser is implemented by policies that can refuse to wake for
+// requests, such as an on-demand agent whose wake budget is spent.
+type wakeRefuser interface {
+	WakeRefused() (until time.Time, refused bool)
+}
+
+// serveWakeRefused answers 503 with the reason, and Retry-After set to when
+// wakes resume, if the backend's sleeping agent won't wake for requests,
+// rather than a splash page or a held request waiting for a wake that isn't
+// coming. It reports whether it did.
+func (p *Proxy) serveWakeRefused(w http.ResponseWriter, r *http.Request, backend *Backend) bool {
+	wr, ok := backend.Policy.(wakeRefuser)
+	if !ok {
+		return false
+	}
+	until, refused := wr.WakeRefused()
+	if !refused {
+		return false
+	}
+	retrySecs := max(int(time.Until(until).Round(time.Second)/time.Second), 1)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Retry-After", strconv.Itoa(retrySecs))
+
+	if wantsHTML(r) || (backend.Options.GRPC && IsGRPC(r)) {
+		p.proxyError(w, r, http.StatusServiceUnavailable, "agent "+backend.AgentName+" has used its wake budget for today")
+		return true
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	_ = json.NewEncoder(w).Encode(wakingResponse{
+		Status:     "sleeping",
+		Agent:      backend.AgentName,
+		Reason:     "wake_budget_spent",
+		RetryAfter: retrySecs,
+	})
+	return true
+}
+
+type wakingResponse struct {
+	Status           string `json:"status"`
+	Agent            string `json:"agent"`
+	Reason           string `json:"reason,omitempty"` // why no wake is coming
+	EstimatedSeconds int    `json:"estimated_wake_seconds,omitempty"`
+	RetryAfter       int    `json:"retry_after"`
+}
+
+// wantsHTML reports whether the client is a browser navigating to a page
+// rather than an API client.
+func wantsHTML(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
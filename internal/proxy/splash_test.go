@@ -0,0 +1,175 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"warren/internal/events"
+	"warren/internal/services"
+)
+
+func setupSleeping(t *testing.T, opts RouteOptions) *Proxy {
+	t.Helper()
+	p := New(services.NewRegistry(testLogger()), "", testLogger())
+	u, _ := url.Parse("http://localhost:1")
+	p.RegisterWithOptions("a.com", "a", u, &mockPolicy{state: "sleeping"}, opts)
+	return p
+}
+
+func TestSplash_BrowserGetsHTML(t *testing.T) {
+	p := setupSleeping(t, RouteOptions{})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Host = "a.com"
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+
+	if w.Code != 503 {
+		t.Fatalf("status = %d, want 503", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("content-type = %q", ct)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, "Waking a") || !strings.Contains(body, "/api/health") {
+		t.Errorf("unexpected splash body:\n%s", body)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("missing Retry-After")
+	}
+}
+
+func TestSplash_APIClientGetsJSON(t *testing.T) {
+	p := setupSleeping(t, RouteOptions{})
+	p.WakeTimes().HandleEvent(events.Event{Type: events.AgentWake, Agent: "a"})
+	p.WakeTimes().HandleEvent(events.Event{Type: events.AgentReady, Agent: "a"})
+
+	req := httptest.NewRequest("GET", "/v1/chat", nil)
+	req.Host = "a.com"
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+
+	if w.Code != 503 {
+		t.Fatalf("status = %d, want 503", w.Code)
+	}
+	var resp wakingResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("expected JSON body: %v", err)
+	}
+	if resp.Status != "sleeping" || resp.Agent != "a" || resp.RetryAfter < 1 {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+	if resp.EstimatedSeconds != 1 {
+		t.Errorf("estimated_wake_seconds = %d, want 1 (floor)", resp.EstimatedSeconds)
+	}
+}
+
+// budgetPolicy is a sleeping agent whose wake budget is spent.
+type budgetPolicy struct {
+	mockPolicy
+	until time.Time
+}
+
+func (b *budgetPolicy) WakeRefused() (time.Time, bool) { return b.until, true }
+
+func TestSplash_WakeBudgetSpent(t *testing.T) {
+	p := New(services.NewRegistry(testLogger()), "", testLogger())
+	u, _ := url.Parse("http://localhost:1")
+	p.RegisterWithOptions("a.com", "a", u, &budgetPolicy{mockPolicy: mockPolicy{state: "sleeping"}, until: time.Now().Add(time.Hour)},
+		RouteOptions{WakeHold: time.Minute})
+
+	get := func(accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Host = "a.com"
+		req.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+		return w
+	}
+
+	// Answered straight away, not held for a wake that isn't coming.
+	w := get("application/json")
+	if w.Code != 503 {
+		t.Fatalf("status = %d, want 503", w.Code)
+	}
+	var resp wakingResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("expected JSON body: %v", err)
+	}
+	if resp.Reason != "wake_budget_spent" || resp.RetryAfter < 3500 {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+
+	w = get("text/html")
+	if w.Code != 503 || strings.Contains(w.Body.String(), "Waking") || !strings.Contains(w.Body.String(), "wake budget") {
+		t.Errorf("browser got %d:\n%s", w.Code, w.Body.String())
+	}
+}
+
+func TestSplash_PerAgentTemplate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "splash.html")
+	os.WriteFile(path, []byte(`<p>{{.Agent}} is {{.State}}, retry in {{.RetryAfter}}s</p>`), 0644)
+	splash, err := NewSplash(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := setupSleeping(t, RouteOptions{Splash: splash})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Host = "a.com"
+	req.Header.Set("Accept", "text/html")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+
+	if got := w.Body.String(); got != "<p>a is sleeping, retry in 3s</p>" {
+		t.Errorf("body = %q", got)
+	}
+}
+
+func TestNewSplash_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.html")
+	os.WriteFile(path, []byte(`{{.Agent`), 0644)
+	if _, err := NewSplash(path); err == nil {
+		t.Error("expected parse error")
+	}
+	if _, err := NewSplash(filepath.Join(t.TempDir(), "missing.html")); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
+
+func TestWakeTimes(t *testing.T) {
+	wt := NewWakeTimes()
+	if _, ok := wt.Remaining("a"); ok {
+		t.Fatal("expected no estimate before any wake")
+	}
+
+	wt.HandleEvent(events.Event{Type: events.AgentWake, Agent: "a"})
+	wt.started["a"] = time.Now().Add(-20 * time.Second)
+	wt.HandleEvent(events.Event{Type: events.AgentReady, Agent: "a"})
+
+	d, ok := wt.Remaining("a")
+	if !ok || d < 19*time.Second || d > 21*time.Second {
+		t.Errorf("Remaining = %v, %v; want ~20s", d, ok)
+	}
+
+	// Mid-wake, the estimate counts down.
+	wt.HandleEvent(events.Event{Type: events.AgentWake, Agent: "a"})
+	wt.started["a"] = time.Now().Add(-15 * time.Second)
+	if d, _ := wt.Remaining("a"); d > 6*time.Second {
+		t.Errorf("Remaining mid-wake = %v, want ~5s", d)
+	}
+
+	// Ready without a preceding wake (startup reconciliation) is ignored.
+	wt.HandleEvent(events.Event{Type: events.AgentReady, Agent: "b"})
+	if _, ok := wt.Remaining("b"); ok {
+		t.Error("ready without wake should not record an estimate")
+	}
+}
@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"warren/internal/services"
+	"warren/internal/transport"
+)
+
+func TestRouteTimeouts(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte("slow"))
+	}))
+	defer backend.Close()
+	target, _ := url.Parse(backend.URL)
+
+	p := New(services.NewRegistry(testLogger()), "", testLogger())
+	p.RegisterWithOptions("a.com", "a", target, &mockPolicy{state: "ready"}, RouteOptions{
+		Timeouts: &transport.Timeouts{ResponseHeader: 10 * time.Millisecond},
+	})
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, httptest.NewRequest("GET", "http://a.com/", nil))
+		return w
+	}
+
+	if w := get(); w.Code != http.StatusGatewayTimeout {
+		t.Errorf("short response_header timeout: %d, want 504", w.Code)
+	}
+
+	// Raising the timeout on reload takes effect for the next request.
+	p.SetOptions("a.com", RouteOptions{Timeouts: &transport.Timeouts{ResponseHeader: time.Second}})
+	if w := get(); w.Code != 200 || w.Body.String() != "slow" {
+		t.Errorf("after reload: %d %q, want 200 slow", w.Code, w.Body.String())
+	}
+}
+
+func TestServiceAPITimeouts(t *testing.T) {
+	registry := services.NewRegistry(testLogger())
+	p := New(registry, "", testLogger())
+
+	w := httptest.NewRecorder()
+	p.HandleServiceAPI(w, httptest.NewRequest("POST", "/api/services", strings.NewReader(
+		`{"hostname":"x.com","target":"http://10.0.0.1:80","timeouts":{"dial":"5s","response_header":"10m"}}`)))
+	if w.Code != 201 {
+		t.Fatalf("register: %d %s", w.Code, w.Body.String())
+	}
+	svc, _ := registry.Lookup("x.com")
+	if svc.Timeouts == nil || svc.Timeouts.ResponseHeader != 10*time.Minute {
+		t.Errorf("timeouts = %+v", svc.Timeouts)
+	}
+	w = httptest.NewRecorder()
+	p.HandleServiceAPI(w, httptest.NewRequest("GET", "/api/services/x.com", nil))
+	if !strings.Contains(w.Body.String(), `"timeouts":"dial 5s, response_header 10m"`) {
+		t.Errorf("inspect = %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	p.HandleServiceAPI(w, httptest.NewRequest("POST", "/api/services", strings.NewReader(
+		`{"hostname":"y.com","target":"http://10.0.0.1:80","timeouts":{"idle":"forever"}}`)))
+	if w.Code != 422 || !strings.Contains(w.Body.String(), `"field":"timeouts.idle"`) {
+		t.Errorf("invalid timeout: %d %s", w.Code, w.Body.String())
+	}
+}
@@ -2,6 +2,8 @@ package proxy
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/binary"
 	"io"
 	"log/slog"
 	"net"
@@ -23,11 +25,80 @@ type WSCounter struct {
 	counts sync.Map  // hostname → *int64
 	total  int64     // total across all hostnames
 	done   chan struct{}
+
+	mu      sync.Mutex
+	watched map[string]map[*wsConn]struct{} // hostname → WebSocket connections with an idle timeout
 }
 
 func NewWSCounter() *WSCounter {
 	return &WSCounter{
-		done: make(chan struct{}, 1),
+		done:    make(chan struct{}, 1),
+		watched: make(map[string]map[*wsConn]struct{}),
+	}
+}
+
+// wsLimiter counts WebSocket connections per agent against the agent's
+// max_websockets. The zero value is ready to use.
+type wsLimiter struct {
+	counts sync.Map // agent → *atomic.Int64
+}
+
+// acquire takes one of the agent's max connections, returning false when
+// all are in use. release must be called once the connection closes.
+func (l *wsLimiter) acquire(agent string, max int) (release func(), ok bool) {
+	v, _ := l.counts.LoadOrStore(agent, new(atomic.Int64))
+	n := v.(*atomic.Int64)
+	if n.Add(1) > int64(max) {
+		n.Add(-1)
+		return nil, false
+	}
+	return func() { n.Add(-1) }, true
+}
+
+// open returns the agent's WebSocket connections counted by acquire.
+func (l *wsLimiter) open(agent string) int64 {
+	v, ok := l.counts.Load(agent)
+	if !ok {
+		return 0
+	}
+	return v.(*atomic.Int64).Load()
+}
+
+// wsConn is a WebSocket connection whose data frames are watched, so it can
+// stop counting as activity once it goes quiet.
+type wsConn struct {
+	last atomic.Int64 // unix nanoseconds of the last data frame
+	idle time.Duration
+}
+
+func (c *wsConn) touch() {
+	c.last.Store(time.Now().UnixNano())
+}
+
+func (c *wsConn) stale(now time.Time) bool {
+	return now.Sub(time.Unix(0, c.last.Load())) > c.idle
+}
+
+// watch registers a connection on hostname that goes stale after idle
+// without data frames.
+func (w *WSCounter) watch(hostname string, idle time.Duration) *wsConn {
+	c := &wsConn{idle: idle}
+	c.touch()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.watched[hostname] == nil {
+		w.watched[hostname] = make(map[*wsConn]struct{})
+	}
+	w.watched[hostname][c] = struct{}{}
+	return c
+}
+
+func (w *WSCounter) unwatch(hostname string, c *wsConn) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.watched[hostname], c)
+	if len(w.watched[hostname]) == 0 {
+		delete(w.watched, hostname)
 	}
 }
 
@@ -59,6 +130,22 @@ func (w *WSCounter) Count(hostname string) int64 {
 	return atomic.LoadInt64(v.(*int64))
 }
 
+// Active is Count less the WebSocket connections that have gone without data
+// frames for longer than their idle timeout. Idle detection uses it so a
+// forgotten browser tab doesn't keep an agent awake forever.
+func (w *WSCounter) Active(hostname string) int64 {
+	n := w.Count(hostname)
+	now := time.Now()
+	w.mu.Lock()
+	for c := range w.watched[hostname] {
+		if c.stale(now) {
+			n--
+		}
+	}
+	w.mu.Unlock()
+	return max(n, 0)
+}
+
 // Total returns the total number of active WebSocket connections.
 func (w *WSCounter) Total() int64 {
 	return atomic.LoadInt64(&w.total)
@@ -112,6 +199,104 @@ func (aw *activityWriter) Write(p []byte) (int, error) {
 	return aw.w.Write(p)
 }
 
+// frameWatcher parses the WebSocket frames written through it and calls
+// onData at the start of each data frame, so pings, pongs and close frames
+// don't count as activity. Frames may be split across writes. skipHTTP
+// passes over the handshake response that precedes the backend's frames.
+type frameWatcher struct {
+	w        io.Writer
+	onData   func()
+	skipHTTP bool
+
+	match   int      // bytes of the blank line ending the handshake matched so far
+	hdr     [14]byte // the current frame header
+	hdrLen  int      // header bytes buffered
+	need    int      // header bytes needed, 2 until the length and mask bits are read
+	payload uint64   // payload bytes left in the current frame
+}
+
+func (f *frameWatcher) Write(p []byte) (int, error) {
+	f.scan(p)
+	return f.w.Write(p)
+}
+
+func (f *frameWatcher) scan(p []byte) {
+	for len(p) > 0 {
+		if f.skipHTTP {
+			i := f.endOfHandshake(p)
+			if i < 0 {
+				return
+			}
+			f.skipHTTP = false
+			p = p[i:]
+			continue
+		}
+		if f.payload > 0 {
+			n := min(uint64(len(p)), f.payload)
+			f.payload -= n
+			p = p[n:]
+			continue
+		}
+
+		if f.need == 0 {
+			f.need = 2
+		}
+		n := copy(f.hdr[f.hdrLen:f.need], p)
+		f.hdrLen += n
+		p = p[n:]
+		if f.hdrLen < f.need {
+			return
+		}
+		if f.hdrLen == 2 {
+			switch f.hdr[1] & 0x7f {
+			case 126:
+				f.need += 2
+			case 127:
+				f.need += 8
+			}
+			if f.hdr[1]&0x80 != 0 {
+				f.need += 4 // masking key
+			}
+			if f.need > 2 {
+				continue
+			}
+		}
+
+		length := uint64(f.hdr[1] & 0x7f)
+		switch length {
+		case 126:
+			length = uint64(binary.BigEndian.Uint16(f.hdr[2:4]))
+		case 127:
+			length = binary.BigEndian.Uint64(f.hdr[2:10])
+		}
+		if f.hdr[0]&0x0f < 0x8 { // continuation, text or binary
+			f.onData()
+		}
+		f.payload = length
+		f.hdrLen, f.need = 0, 0
+	}
+}
+
+// endOfHandshake returns the index just past the "\r\n\r\n" ending the
+// handshake response, or -1 if p doesn't contain it.
+func (f *frameWatcher) endOfHandshake(p []byte) int {
+	const end = "\r\n\r\n"
+	for i, b := range p {
+		switch {
+		case b == end[f.match]:
+			f.match++
+		case b == '\r':
+			f.match = 1
+		default:
+			f.match = 0
+		}
+		if f.match == len(end) {
+			return i + 1
+		}
+	}
+	return -1
+}
+
 func IsWebSocket(r *http.Request) bool {
 	return connectionHasUpgrade(r.Header.Get("Connection")) &&
 		strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
@@ -129,21 +314,37 @@ func connectionHasUpgrade(value string) bool {
 }
 
 func HandleWebSocket(w http.ResponseWriter, r *http.Request, backend *url.URL, hostname string, ws *WSCounter, activity *ActivityTracker, logger *slog.Logger) {
-	handleWebSocket(r.Context(), w, r, backend, hostname, ws, activity, logger)
+	handleWebSocket(r.Context(), w, r, backend, hostname, 0, ws, activity, logger)
 }
 
-func handleWebSocket(ctx context.Context, w http.ResponseWriter, r *http.Request, backend *url.URL, hostname string, ws *WSCounter, activity *ActivityTracker, logger *slog.Logger) {
+// handleWebSocket splices a WebSocket connection to backend. With idle set,
+// only data frames count as activity, and the connection stops keeping the
+// agent awake after idle without one.
+func handleWebSocket(ctx context.Context, w http.ResponseWriter, r *http.Request, backend *url.URL, hostname string, idle time.Duration, ws *WSCounter, activity *ActivityTracker, logger *slog.Logger) {
 	// Dial the backend.
+	secure := backend.Scheme == "https" || backend.Scheme == "wss"
 	backendAddr := backend.Host
 	if !strings.Contains(backendAddr, ":") {
-		if backend.Scheme == "https" || backend.Scheme == "wss" {
+		if secure {
 			backendAddr += ":443"
 		} else {
 			backendAddr += ":80"
 		}
 	}
 
-	backConn, err := net.DialTimeout("tcp", backendAddr, 10*time.Second)
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	var backConn net.Conn
+	var err error
+	if secure {
+		// Offer only HTTP/1.1, which is what can be upgraded, even to
+		// backends that otherwise speak HTTP/2.
+		backConn, err = tls.DialWithDialer(dialer, "tcp", backendAddr, &tls.Config{
+			ServerName: backend.Hostname(),
+			NextProtos: []string{"http/1.1"},
+		})
+	} else {
+		backConn, err = dialer.Dial("tcp", backendAddr)
+	}
 	if err != nil {
 		logger.Error("websocket: failed to dial backend", "error", err, "backend", backendAddr)
 		http.Error(w, "bad gateway", http.StatusBadGateway)
@@ -187,8 +388,18 @@ func handleWebSocket(ctx context.Context, w http.ResponseWriter, r *http.Request
 	}()
 
 	// Bidirectional copy with activity tracking on every frame.
-	clientActivity := &activityWriter{w: dlBackend, hostname: hostname, activity: activity}
-	backendActivity := &activityWriter{w: dlClient, hostname: hostname, activity: activity}
+	var clientActivity, backendActivity io.Writer = &activityWriter{w: dlBackend, hostname: hostname, activity: activity},
+		&activityWriter{w: dlClient, hostname: hostname, activity: activity}
+	if idle > 0 {
+		conn := ws.watch(hostname, idle)
+		defer ws.unwatch(hostname, conn)
+		onData := func() {
+			conn.touch()
+			activity.Touch(hostname)
+		}
+		clientActivity = &frameWatcher{w: dlBackend, onData: onData}
+		backendActivity = &frameWatcher{w: dlClient, onData: onData, skipHTTP: true}
+	}
 
 	var wg sync.WaitGroup
 	wg.Add(2)
@@ -1,8 +1,20 @@
 package proxy
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
+
+	"warren/internal/events"
+	"warren/internal/services"
 )
 
 func TestIsWebSocket(t *testing.T) {
@@ -37,3 +49,217 @@ func TestIsWebSocket(t *testing.T) {
 		})
 	}
 }
+
+// wsFrame encodes a WebSocket frame, masked as clients send them.
+func wsFrame(opcode byte, payload []byte, masked bool) []byte {
+	frame := []byte{0x80 | opcode}
+	var mask byte
+	if masked {
+		mask = 0x80
+	}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, mask|byte(n))
+	case n <= 0xffff:
+		frame = append(frame, mask|126, byte(n>>8), byte(n))
+	default:
+		frame = append(frame, mask|127, 0, 0, 0, 0, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	if masked {
+		frame = append(frame, 1, 2, 3, 4)
+	}
+	return append(frame, payload...)
+}
+
+func TestFrameWatcher(t *testing.T) {
+	var stream []byte
+	stream = append(stream, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\n\r\n"...)
+	stream = append(stream, wsFrame(0x9, []byte("ping"), false)...)                   // ping
+	stream = append(stream, wsFrame(0x1, []byte("hello"), false)...)                  // text
+	stream = append(stream, wsFrame(0xA, nil, true)...)                               // pong
+	stream = append(stream, wsFrame(0x2, bytes.Repeat([]byte{0x9}, 300), true)...)    // binary, 16-bit length
+	stream = append(stream, wsFrame(0x2, bytes.Repeat([]byte{0xA}, 70000), false)...) // binary, 64-bit length
+	stream = append(stream, wsFrame(0x8, []byte{0x03, 0xe8}, false)...)               // close
+
+	// Feed the stream in awkward chunks so headers straddle writes.
+	for _, chunk := range []int{1, 3, 7, 4096} {
+		data := 0
+		var out bytes.Buffer
+		f := &frameWatcher{w: &out, onData: func() { data++ }, skipHTTP: true}
+		for rest := stream; len(rest) > 0; {
+			n := min(chunk, len(rest))
+			if _, err := f.Write(rest[:n]); err != nil {
+				t.Fatal(err)
+			}
+			rest = rest[n:]
+		}
+		if data != 3 {
+			t.Errorf("chunk %d: data frames = %d, want 3", chunk, data)
+		}
+		if !bytes.Equal(out.Bytes(), stream) {
+			t.Errorf("chunk %d: stream altered in transit", chunk)
+		}
+	}
+}
+
+func TestWSCounterActive(t *testing.T) {
+	ws := NewWSCounter()
+	ws.Inc("a.com")
+	ws.Inc("a.com")
+	live := ws.watch("a.com", time.Hour)
+	stale := ws.watch("a.com", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	if n := ws.Active("a.com"); n != 1 {
+		t.Errorf("Active = %d, want 1 with one connection idle past its timeout", n)
+	}
+	if n := ws.Count("a.com"); n != 2 {
+		t.Errorf("Count = %d, want both connections", n)
+	}
+
+	stale.idle = time.Hour
+	stale.touch()
+	if n := ws.Active("a.com"); n != 2 {
+		t.Errorf("Active after a data frame = %d, want 2", n)
+	}
+	ws.unwatch("a.com", live)
+	ws.unwatch("a.com", stale)
+}
+
+// upgradeBackend accepts WebSocket upgrades and holds the connections open.
+func upgradeBackend(t *testing.T) *url.URL {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if _, err := http.ReadRequest(bufio.NewReader(conn)); err != nil {
+					return
+				}
+				io.WriteString(conn, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n") //nolint:errcheck
+				io.Copy(io.Discard, conn)                                                                                     //nolint:errcheck
+			}()
+		}
+	}()
+	return &url.URL{Scheme: "http", Host: ln.Addr().String()}
+}
+
+// dialWebSocket sends an upgrade request for host through the proxy at addr
+// and returns the connection and the response status.
+func dialWebSocket(t *testing.T, addr, host string) (net.Conn, *http.Response) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	req, _ := http.NewRequest("GET", "http://"+host+"/ws", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, resp
+}
+
+func TestMaxWebSockets(t *testing.T) {
+	p := New(services.NewRegistry(testLogger()), "", testLogger())
+	p.RegisterWithOptions("a.com", "a", upgradeBackend(t), &mockPolicy{state: "ready"}, RouteOptions{MaxWebSockets: 1})
+	p.Register("b.com", "b", upgradeBackend(t), &mockPolicy{state: "ready"})
+	emitter := events.NewEmitter(testLogger())
+	hits := make(chan events.Event, 4)
+	emitter.OnEvent(func(ev events.Event) { hits <- ev })
+	p.SetEmitter(emitter)
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+	addr := strings.TrimPrefix(srv.URL, "http://")
+
+	first, resp := dialWebSocket(t, addr, "a.com")
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("first upgrade: %d, want 101", resp.StatusCode)
+	}
+
+	_, resp = dialWebSocket(t, addr, "a.com")
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("second upgrade: %d, want 503", resp.StatusCode)
+	}
+	var body struct {
+		Error string `json:"error"`
+		Agent string `json:"agent"`
+		Limit int    `json:"limit"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	if body.Agent != "a" || body.Limit != 1 || body.Error == "" {
+		t.Errorf("error body = %+v", body)
+	}
+	select {
+	case ev := <-hits:
+		if ev.Type != events.SecurityRateLimited || ev.Agent != "a" || ev.Fields["limit"] != "max_websockets" {
+			t.Errorf("security event = %+v, want rate_limited for a", ev)
+		}
+	case <-time.After(time.Second):
+		t.Error("no security event for the rejected upgrade")
+	}
+	if n := p.WebSockets("a"); n != 1 {
+		t.Errorf("WebSockets(a) = %d, want 1", n)
+	}
+
+	// Other agents have their own limit.
+	if _, resp := dialWebSocket(t, addr, "b.com"); resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Errorf("unlimited agent: %d, want 101", resp.StatusCode)
+	}
+
+	// Closing the first connection frees its slot.
+	first.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for p.WebSockets("a") != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, resp := dialWebSocket(t, addr, "a.com"); resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Errorf("upgrade after close: %d, want 101", resp.StatusCode)
+	}
+}
+
+func TestMaxWebSocketsCountsServices(t *testing.T) {
+	registry := services.NewRegistry(testLogger())
+	p := New(registry, "", testLogger())
+	p.RegisterWithOptions("a.com", "a", upgradeBackend(t), &mockPolicy{state: "ready"}, RouteOptions{MaxWebSockets: 1})
+	registry.RegisterUnsafe("svc.a.com", upgradeBackend(t).String(), "a")
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+	addr := strings.TrimPrefix(srv.URL, "http://")
+
+	first, resp := dialWebSocket(t, addr, "svc.a.com")
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("upgrade to the agent's service: %d, want 101", resp.StatusCode)
+	}
+	if n := p.WebSockets("a"); n != 1 {
+		t.Errorf("WebSockets(a) = %d, want the service's connection counted", n)
+	}
+	if _, resp := dialWebSocket(t, addr, "a.com"); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("upgrade to the agent with its slot taken by the service: %d, want 503", resp.StatusCode)
+	}
+
+	first.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for p.WebSockets("a") != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := p.WebSockets("a"); n != 0 {
+		t.Errorf("WebSockets(a) = %d after the service's connection closed, want 0", n)
+	}
+}
@@ -0,0 +1,147 @@
+// Package realip works out the real client IP of a request that may have
+// come through a load balancer or CDN. Forwarding headers are only believed
+// when the connection comes from a trusted proxy; from anyone else they are
+// stripped, so a client can't spoof its address to the backends.
+package realip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// DefaultHeader is the forwarding header read from trusted proxies unless
+// configured otherwise.
+const DefaultHeader = "X-Forwarded-For"
+
+// forwardingHeaders are removed from requests that don't come from a
+// trusted proxy. X-Forwarded-Proto is among them because redirects and
+// forward auth believe it about whether the client used HTTPS.
+var forwardingHeaders = []string{"X-Forwarded-For", "X-Real-IP", "X-Forwarded-Proto", "Forwarded"}
+
+// Resolver decides which requests' forwarding headers to believe.
+type Resolver struct {
+	trusted []netip.Prefix
+	header  string
+}
+
+// New creates a resolver trusting the given CIDRs or bare IPs. header names
+// where trusted proxies put the client IP: X-Forwarded-For (the default)
+// holds a list appended to by each hop, while headers such as X-Real-IP or
+// CF-Connecting-IP hold a single address.
+func New(trusted []string, header string) (*Resolver, error) {
+	r := &Resolver{header: http.CanonicalHeaderKey(header)}
+	if r.header == "" {
+		r.header = DefaultHeader
+	}
+	for _, s := range trusted {
+		s = strings.TrimSpace(s)
+		if !strings.Contains(s, "/") {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", s, err)
+			}
+			r.trusted = append(r.trusted, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", s, err)
+		}
+		r.trusted = append(r.trusted, prefix.Masked())
+	}
+	return r, nil
+}
+
+// Trusted reports whether ip belongs to a trusted proxy.
+func (r *Resolver) Trusted(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range r.trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address of the client that made req. For requests
+// from a trusted proxy it reads the configured header, walking a
+// X-Forwarded-For list from the right past any further trusted hops.
+func (r *Resolver) ClientIP(req *http.Request) string {
+	peer := peerIP(req)
+	if !r.Trusted(peer) {
+		return peer
+	}
+	values := req.Header.Values(r.header)
+	if len(values) == 0 {
+		return peer
+	}
+	if r.header != "X-Forwarded-For" {
+		if ip := strings.TrimSpace(values[len(values)-1]); validIP(ip) {
+			return ip
+		}
+		return peer
+	}
+	var hops []string
+	for _, v := range values {
+		for _, hop := range strings.Split(v, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		if !validIP(hops[i]) {
+			break // garbage: stop at the last address we can vouch for
+		}
+		client = hops[i]
+		if !r.Trusted(hops[i]) {
+			break
+		}
+	}
+	return client
+}
+
+// Apply resolves req's client IP, strips forwarding headers unless req came
+// from a trusted proxy, and sets X-Real-IP to the client IP for backends.
+// The returned request carries the IP for From.
+func (r *Resolver) Apply(req *http.Request) *http.Request {
+	ip := r.ClientIP(req)
+	if !r.Trusted(peerIP(req)) {
+		for _, h := range forwardingHeaders {
+			req.Header.Del(h)
+		}
+		req.Header.Del(r.header)
+	}
+	req.Header.Set("X-Real-IP", ip)
+	return req.WithContext(context.WithValue(req.Context(), ctxKey{}, ip))
+}
+
+type ctxKey struct{}
+
+// From returns the client IP resolved by Apply, or the connection's peer
+// address for requests that haven't been through it.
+func From(req *http.Request) string {
+	if ip, ok := req.Context().Value(ctxKey{}).(string); ok {
+		return ip
+	}
+	return peerIP(req)
+}
+
+func peerIP(req *http.Request) string {
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		return host
+	}
+	return req.RemoteAddr
+}
+
+func validIP(s string) bool {
+	_, err := netip.ParseAddr(s)
+	return err == nil
+}
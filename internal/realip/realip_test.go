@@ -0,0 +1,93 @@
+package realip
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	xff, err := New([]string{"10.0.0.0/8", "192.168.1.1"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cf, err := New([]string{"173.245.48.0/20"}, "cf-connecting-ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		r      *Resolver
+		peer   string
+		header string
+		value  string
+		want   string
+	}{
+		{"untrusted peer ignores header", xff, "203.0.113.9", "X-Forwarded-For", "1.2.3.4", "203.0.113.9"},
+		{"trusted peer, one hop", xff, "10.1.2.3", "X-Forwarded-For", "1.2.3.4", "1.2.3.4"},
+		{"skips trusted hops from the right", xff, "10.1.2.3", "X-Forwarded-For", "6.6.6.6, 1.2.3.4, 192.168.1.1", "1.2.3.4"},
+		{"spoofed left entries are ignored", xff, "10.1.2.3", "X-Forwarded-For", "9.9.9.9, 1.2.3.4", "1.2.3.4"},
+		{"all hops trusted", xff, "10.1.2.3", "X-Forwarded-For", "10.9.9.9", "10.9.9.9"},
+		{"garbage hop", xff, "10.1.2.3", "X-Forwarded-For", "nonsense", "10.1.2.3"},
+		{"no header", xff, "10.1.2.3", "", "", "10.1.2.3"},
+		{"single-value header", cf, "173.245.48.5", "CF-Connecting-IP", "2001:db8::1", "2001:db8::1"},
+		{"single-value header from untrusted peer", cf, "203.0.113.9", "CF-Connecting-IP", "1.2.3.4", "203.0.113.9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.peer + ":4321"
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			if got := tt.r.ClientIP(req); got != tt.want {
+				t.Errorf("ClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyStripsSpoofedHeaders(t *testing.T) {
+	r, _ := New([]string{"10.0.0.0/8"}, "")
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "203.0.113.9:4321"
+	req.Header.Set("X-Forwarded-For", "1.2.3.4")
+	req.Header.Set("X-Real-IP", "1.2.3.4")
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req = r.Apply(req)
+	if v := req.Header.Get("X-Forwarded-For"); v != "" {
+		t.Errorf("X-Forwarded-For = %q, want stripped", v)
+	}
+	if v := req.Header.Get("X-Forwarded-Proto"); v != "" {
+		t.Errorf("X-Forwarded-Proto = %q, want stripped", v)
+	}
+	if v := req.Header.Get("X-Real-IP"); v != "203.0.113.9" {
+		t.Errorf("X-Real-IP = %q, want the peer", v)
+	}
+	if ip := From(req); ip != "203.0.113.9" {
+		t.Errorf("From = %q", ip)
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.2:4321"
+	req.Header.Set("X-Forwarded-For", "1.2.3.4")
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req = r.Apply(req)
+	if v := req.Header.Get("X-Forwarded-For"); v != "1.2.3.4" {
+		t.Errorf("trusted X-Forwarded-For = %q, want kept", v)
+	}
+	if v := req.Header.Get("X-Forwarded-Proto"); v != "https" {
+		t.Errorf("trusted X-Forwarded-Proto = %q, want kept", v)
+	}
+	if ip := From(req); ip != "1.2.3.4" {
+		t.Errorf("From = %q, want 1.2.3.4", ip)
+	}
+}
+
+func TestNewRejectsBadCIDR(t *testing.T) {
+	for _, bad := range []string{"10.0.0.0/33", "not-an-ip"} {
+		if _, err := New([]string{bad}, ""); err == nil {
+			t.Errorf("New(%q): expected error", bad)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+// Package redirect answers requests that should go somewhere else before
+// they're routed: plain-HTTP requests for hostnames that require HTTPS,
+// hostname aliases such as www, and moved paths.
+package redirect
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Rule redirects requests matching From to To.
+type Rule struct {
+	// From is a hostname, optionally followed by a path: "www.example.com"
+	// matches every request for the host, "example.com/old" only that path
+	// and "example.com/docs/*" everything under /docs/.
+	From string
+	// To is a hostname ("example.com"), a path on the same host ("/new")
+	// or an absolute URL. For hostname and prefix rules the rest of the
+	// request path is appended.
+	To string
+	// Code is 301 (the default), 302, 307 or 308.
+	Code int
+}
+
+// Table holds every redirect rule, indexed by hostname.
+type Table struct {
+	https map[string]bool
+	rules map[string][]rule // hostname → rules, most specific first
+}
+
+type rule struct {
+	path   string // "" matches any path
+	prefix bool   // path ends in /* and matches everything under it
+	toHost string // set for hostname targets
+	to     *url.URL
+	code   int
+}
+
+// New validates rules and builds a table. Requests for httpsHosts arriving
+// over plain HTTP are redirected to HTTPS before any rule applies.
+func New(rules []Rule, httpsHosts []string) (*Table, error) {
+	t := &Table{https: make(map[string]bool), rules: make(map[string][]rule)}
+	for _, h := range httpsHosts {
+		t.https[strings.ToLower(h)] = true
+	}
+	for _, r := range rules {
+		parsed, host, err := parse(r)
+		if err != nil {
+			return nil, err
+		}
+		t.rules[host] = append(t.rules[host], parsed)
+	}
+	// Exact paths beat prefixes, which beat whole-host rules; longer
+	// prefixes beat shorter ones.
+	for _, rs := range t.rules {
+		for i := 1; i < len(rs); i++ {
+			for j := i; j > 0 && moreSpecific(rs[j], rs[j-1]); j-- {
+				rs[j], rs[j-1] = rs[j-1], rs[j]
+			}
+		}
+	}
+	return t, nil
+}
+
+func moreSpecific(a, b rule) bool {
+	rank := func(r rule) int {
+		switch {
+		case r.path == "":
+			return 0
+		case r.prefix:
+			return 1
+		}
+		return 2
+	}
+	if rank(a) != rank(b) {
+		return rank(a) > rank(b)
+	}
+	return len(a.path) > len(b.path)
+}
+
+func parse(r Rule) (rule, string, error) {
+	if r.From == "" || r.To == "" {
+		return rule{}, "", fmt.Errorf("redirect: from and to are required")
+	}
+	out := rule{code: r.Code}
+	switch r.Code {
+	case 0:
+		out.code = http.StatusMovedPermanently
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return rule{}, "", fmt.Errorf("redirect %s: code must be 301, 302, 307 or 308, got %d", r.From, r.Code)
+	}
+
+	host, path, _ := strings.Cut(r.From, "/")
+	host = strings.ToLower(host)
+	if host == "" || strings.Contains(host, ":") {
+		return rule{}, "", fmt.Errorf("redirect %s: from must start with a hostname", r.From)
+	}
+	if path != "" || strings.HasSuffix(r.From, "/") {
+		out.path = "/" + path
+		if strings.HasSuffix(out.path, "/*") {
+			out.prefix = true
+			out.path = strings.TrimSuffix(out.path, "*")
+		} else if strings.Contains(out.path, "*") {
+			return rule{}, "", fmt.Errorf("redirect %s: * is only allowed at the end of the path, after /", r.From)
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(r.To, "/"):
+		if out.path == "" || (out.prefix && strings.HasPrefix(r.To, out.path)) {
+			return rule{}, "", fmt.Errorf("redirect %s: redirecting to %s would loop", r.From, r.To)
+		}
+		out.to = &url.URL{Path: r.To}
+	case strings.Contains(r.To, "://"):
+		u, err := url.Parse(r.To)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return rule{}, "", fmt.Errorf("redirect %s: to must be a hostname, a path or an http(s) URL, got %q", r.From, r.To)
+		}
+		out.to = u
+	default:
+		if strings.ContainsAny(r.To, "/?#") {
+			return rule{}, "", fmt.Errorf("redirect %s: to must be a hostname, a path or an http(s) URL, got %q", r.From, r.To)
+		}
+		out.toHost = strings.ToLower(r.To)
+		if out.toHost == host && out.path == "" {
+			return rule{}, "", fmt.Errorf("redirect %s: redirects to itself", r.From)
+		}
+	}
+	return out, host, nil
+}
+
+// Handle redirects r if a rule matches, reporting whether it did. hostname
+// is r's host, lowercased and without a port.
+func (t *Table) Handle(w http.ResponseWriter, r *http.Request, hostname string) bool {
+	target, code, ok := t.Match(r, hostname)
+	if ok {
+		http.Redirect(w, r, target, code)
+	}
+	return ok
+}
+
+// Match returns where Handle would redirect r and with which status, without
+// redirecting it.
+func (t *Table) Match(r *http.Request, hostname string) (target string, code int, ok bool) {
+	if t == nil {
+		return "", 0, false
+	}
+	secure := isHTTPS(r)
+	if !secure && t.https[hostname] {
+		u := url.URL{Scheme: "https", Host: hostname, Path: r.URL.Path, RawPath: r.URL.RawPath, RawQuery: r.URL.RawQuery}
+		code := http.StatusMovedPermanently
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			code = http.StatusPermanentRedirect // keep the method and body
+		}
+		return u.String(), code, true
+	}
+	for _, rl := range t.rules[hostname] {
+		rest, ok := rl.match(r.URL.Path)
+		if !ok {
+			continue
+		}
+		return rl.target(r, secure, hostname, rest), rl.code, true
+	}
+	return "", 0, false
+}
+
+// match reports whether path matches the rule and returns the part of it
+// to carry over to the target.
+func (rl rule) match(path string) (string, bool) {
+	switch {
+	case rl.path == "":
+		return path, true
+	case rl.prefix:
+		if path+"/" == rl.path {
+			return "", true
+		}
+		if rest, ok := strings.CutPrefix(path, rl.path); ok {
+			return rest, true
+		}
+		return "", false
+	}
+	return "", path == rl.path
+}
+
+func (rl rule) target(r *http.Request, secure bool, hostname, rest string) string {
+	scheme := "http"
+	if secure {
+		scheme = "https"
+	}
+	var u url.URL
+	switch {
+	case rl.toHost != "":
+		u = url.URL{Scheme: scheme, Host: rl.toHost, Path: r.URL.Path}
+		if rl.path != "" {
+			u.Path = "/" + rest
+		}
+	default:
+		u = *rl.to
+		if u.Host == "" {
+			u.Scheme, u.Host = scheme, hostname
+		}
+		if rl.path == "" || rl.prefix {
+			u.Path = strings.TrimSuffix(u.Path, "/") + "/" + strings.TrimPrefix(rest, "/")
+		}
+	}
+	if u.RawQuery == "" {
+		u.RawQuery = r.URL.RawQuery
+	}
+	return u.String()
+}
+
+// isHTTPS reports whether the client connected over HTTPS, either to Warren
+// or to the proxy in front of it. X-Forwarded-Proto is only there if a
+// trusted proxy sent it: realip strips it from everyone else.
+func isHTTPS(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	return strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
@@ -0,0 +1,86 @@
+package redirect
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandle(t *testing.T) {
+	table, err := New([]Rule{
+		{From: "www.example.com", To: "example.com"},
+		{From: "example.com/old", To: "/new", Code: http.StatusFound},
+		{From: "example.com/docs/*", To: "https://docs.example.com/"},
+		{From: "example.com/docs/legacy/*", To: "https://archive.example.com/docs/"},
+		{From: "moved.example.com", To: "https://new.example.com/base"},
+	}, []string{"Secure.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		method, url string
+		https       bool
+		code        int
+		location    string
+	}{
+		{"GET", "http://www.example.com/a/b?x=1", true, 301, "https://example.com/a/b?x=1"},
+		{"GET", "http://www.example.com/", false, 301, "http://example.com/"},
+		{"GET", "http://example.com/old?q=2", true, 302, "https://example.com/new?q=2"},
+		{"GET", "http://example.com/docs/guide/intro", true, 301, "https://docs.example.com/guide/intro"},
+		{"GET", "http://example.com/docs", true, 301, "https://docs.example.com/"},
+		{"GET", "http://example.com/docs/legacy/v1", true, 301, "https://archive.example.com/docs/v1"},
+		{"GET", "http://moved.example.com/x", true, 301, "https://new.example.com/base/x"},
+		{"GET", "http://secure.example.com/p?a=b", false, 301, "https://secure.example.com/p?a=b"},
+		{"POST", "http://secure.example.com/p", false, 308, "https://secure.example.com/p"},
+		{"GET", "http://secure.example.com/p", true, 0, ""},
+		{"GET", "http://example.com/other", true, 0, ""},
+		{"GET", "http://example.com/older", true, 0, ""},
+	} {
+		req := httptest.NewRequest(tc.method, tc.url, nil)
+		if tc.https {
+			req.TLS = &tls.ConnectionState{}
+		}
+		w := httptest.NewRecorder()
+		host := strings.ToLower(req.Host)
+		handled := table.Handle(w, req, host)
+		if tc.code == 0 {
+			if handled {
+				t.Errorf("%s %s: redirected to %s, want no redirect", tc.method, tc.url, w.Header().Get("Location"))
+			}
+			continue
+		}
+		if !handled || w.Code != tc.code || w.Header().Get("Location") != tc.location {
+			t.Errorf("%s %s: %d %q, want %d %q", tc.method, tc.url, w.Code, w.Header().Get("Location"), tc.code, tc.location)
+		}
+	}
+}
+
+func TestForwardedProto(t *testing.T) {
+	table, _ := New(nil, []string{"a.com"})
+	req := httptest.NewRequest("GET", "http://a.com/", nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	if table.Handle(httptest.NewRecorder(), req, "a.com") {
+		t.Error("request that reached the edge over HTTPS was redirected")
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	for _, r := range []Rule{
+		{From: "a.com"},
+		{From: "a.com", To: "a.com"},
+		{From: "a.com", To: "/new"},
+		{From: "a.com/docs/*", To: "/docs/v2/"},
+		{From: "a.com/*/x", To: "/y"},
+		{From: "a.com", To: "ftp://b.com"},
+		{From: "a.com", To: "b.com/path"},
+		{From: "a.com", To: "b.com", Code: 200},
+		{From: "/path", To: "b.com"},
+	} {
+		if _, err := New([]Rule{r}, nil); err == nil {
+			t.Errorf("New(%+v) succeeded, want error", r)
+		}
+	}
+}
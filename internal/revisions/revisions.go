@@ -0,0 +1,265 @@
+// Package revisions records the change history of agent and service
+// definitions: who changed what and when, with field-level diffs and a
+// snapshot of each revision to roll back to.
+package revisions
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Resource kinds.
+const (
+	KindAgent   = "agent"
+	KindService = "service"
+)
+
+// Actions recorded against a resource.
+const (
+	ActionCreated    = "created"
+	ActionLoaded     = "loaded" // present in the config at startup
+	ActionUpdated    = "updated"
+	ActionRemoved    = "removed"
+	ActionRestored   = "restored"
+	ActionRolledBack = "rolled-back"
+)
+
+// DefaultMax is how many revisions are kept per resource.
+const DefaultMax = 50
+
+// redacted marks fields whose values never appear in diffs.
+var redacted = []string{"token", "password", "users", "secret"}
+
+// Change is one field that differs between consecutive revisions.
+type Change struct {
+	Field string `json:"field"`
+	Old   string `json:"old,omitempty"`
+	New   string `json:"new,omitempty"`
+}
+
+// Revision is one recorded change to a resource.
+type Revision struct {
+	Number  int       `json:"revision"`
+	Kind    string    `json:"kind"`
+	Name    string    `json:"name"`
+	Action  string    `json:"action"`
+	Actor   string    `json:"actor"`
+	At      time.Time `json:"at"`
+	Note    string    `json:"note,omitempty"`
+	Changes []Change  `json:"changes,omitempty"`
+	// Spec is the resource's YAML definition after the change; empty once
+	// removed. Kept out of API responses since it may contain secrets.
+	Spec string `json:"-"`
+}
+
+// Log holds recent revisions per resource in memory.
+type Log struct {
+	mu   sync.RWMutex
+	revs map[string][]Revision // kind/name → revisions, oldest first
+	max  int
+}
+
+// NewLog creates a log keeping up to max revisions per resource (DefaultMax
+// if max <= 0).
+func NewLog(max int) *Log {
+	if max <= 0 {
+		max = DefaultMax
+	}
+	return &Log{revs: make(map[string][]Revision), max: max}
+}
+
+// Record appends a revision for the resource. spec is its definition after
+// the change (nil when removed); the diff is taken against the previous
+// revision's spec. note is optional free text, e.g. the rollback source.
+func (l *Log) Record(kind, name, action, actor, note string, spec any) (Revision, error) {
+	var text string
+	if spec != nil {
+		data, err := yaml.Marshal(spec)
+		if err != nil {
+			return Revision{}, fmt.Errorf("revisions: marshal %s %q: %w", kind, name, err)
+		}
+		text = string(data)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := kind + "/" + name
+	revs := l.revs[key]
+	var prev string
+	number := 1
+	if n := len(revs); n > 0 {
+		prev = revs[n-1].Spec
+		number = revs[n-1].Number + 1
+	}
+
+	rev := Revision{
+		Number:  number,
+		Kind:    kind,
+		Name:    name,
+		Action:  action,
+		Actor:   actor,
+		At:      time.Now(),
+		Note:    note,
+		Changes: diff(prev, text),
+		Spec:    text,
+	}
+	revs = append(revs, rev)
+	if len(revs) > l.max {
+		revs = revs[len(revs)-l.max:]
+	}
+	l.revs[key] = revs
+	return rev, nil
+}
+
+// List returns the resource's revisions, newest first.
+func (l *Log) List(kind, name string) []Revision {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	revs := l.revs[kind+"/"+name]
+	out := make([]Revision, len(revs))
+	for i, r := range revs {
+		out[len(revs)-1-i] = r
+	}
+	return out
+}
+
+// Get returns one revision of the resource.
+func (l *Log) Get(kind, name string, number int) (Revision, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, r := range l.revs[kind+"/"+name] {
+		if r.Number == number {
+			return r, true
+		}
+	}
+	return Revision{}, false
+}
+
+type actorKey struct{}
+
+// WithActor returns a context naming the authenticated caller, for Actor.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// TokenActor names a caller authenticated with token: a short fingerprint
+// of the token and the caller's address, e.g. "token:1a2b3c4d@10.0.0.5".
+// The token itself is never recorded.
+func TokenActor(token string, r *http.Request) string {
+	sum := sha256.Sum256([]byte(token))
+	return "token:" + hex.EncodeToString(sum[:4]) + "@" + peer(r)
+}
+
+// Actor identifies who made a request: the authenticated caller if the
+// request's context names one, otherwise the caller's address. Nothing the
+// client sends is trusted for this.
+func Actor(r *http.Request) string {
+	if a, ok := r.Context().Value(actorKey{}).(string); ok && a != "" {
+		return a
+	}
+	return peer(r)
+}
+
+// peer returns the request's remote host, without the port.
+func peer(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// diff compares two YAML documents field by field.
+func diff(oldSpec, newSpec string) []Change {
+	oldFields, newFields := flatten(oldSpec), flatten(newSpec)
+
+	keys := make(map[string]bool)
+	for k := range oldFields {
+		keys[k] = true
+	}
+	for k := range newFields {
+		keys[k] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	var changes []Change
+	for _, k := range sorted {
+		o, n := oldFields[k], newFields[k]
+		if o == n {
+			continue
+		}
+		if isRedacted(k) {
+			o, n = mask(o), mask(n)
+		}
+		changes = append(changes, Change{Field: k, Old: o, New: n})
+	}
+	return changes
+}
+
+// flatten maps a YAML document to dotted field paths and scalar values.
+func flatten(spec string) map[string]string {
+	out := make(map[string]string)
+	if spec == "" {
+		return out
+	}
+	var doc any
+	if err := yaml.Unmarshal([]byte(spec), &doc); err != nil {
+		return out
+	}
+	var walk func(prefix string, v any)
+	walk = func(prefix string, v any) {
+		switch t := v.(type) {
+		case map[string]any:
+			for k, child := range t {
+				walk(join(prefix, k), child)
+			}
+		case []any:
+			for i, child := range t {
+				walk(fmt.Sprintf("%s[%d]", prefix, i), child)
+			}
+		case nil:
+		default:
+			out[prefix] = fmt.Sprint(t)
+		}
+	}
+	walk("", doc)
+	return out
+}
+
+func join(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+func isRedacted(field string) bool {
+	f := strings.ToLower(field)
+	for _, word := range redacted {
+		if strings.Contains(f, word) {
+			return true
+		}
+	}
+	return false
+}
+
+func mask(v string) string {
+	if v == "" {
+		return ""
+	}
+	return "(redacted)"
+}
@@ -0,0 +1,88 @@
+package revisions
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type spec struct {
+	Hostname string        `yaml:"hostname"`
+	Timeout  time.Duration `yaml:"timeout"`
+	Token    string        `yaml:"agent_token,omitempty"`
+	Hosts    []string      `yaml:"hostnames,omitempty"`
+}
+
+func TestRecordDiffs(t *testing.T) {
+	l := NewLog(0)
+	if _, err := l.Record(KindAgent, "a", ActionLoaded, "config", "", spec{Hostname: "a.com", Timeout: time.Minute, Token: "s1"}); err != nil {
+		t.Fatal(err)
+	}
+	rev, err := l.Record(KindAgent, "a", ActionUpdated, "alice", "", spec{Hostname: "a.com", Timeout: time.Hour, Token: "s2", Hosts: []string{"b.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rev.Number != 2 {
+		t.Errorf("number = %d, want 2", rev.Number)
+	}
+
+	changes := map[string]Change{}
+	for _, c := range rev.Changes {
+		changes[c.Field] = c
+	}
+	if len(changes) != 3 {
+		t.Fatalf("changes = %+v, want timeout, agent_token and hostnames[0]", rev.Changes)
+	}
+	if c := changes["timeout"]; c.Old != "1m0s" || c.New != "1h0m0s" {
+		t.Errorf("timeout change = %+v", c)
+	}
+	if c := changes["agent_token"]; c.Old != "(redacted)" || c.New != "(redacted)" {
+		t.Errorf("token change not redacted: %+v", c)
+	}
+	if c := changes["hostnames[0]"]; c.Old != "" || c.New != "b.com" {
+		t.Errorf("hostnames change = %+v", c)
+	}
+
+	rm, _ := l.Record(KindAgent, "a", ActionRemoved, "bob", "", nil)
+	if rm.Spec != "" || len(rm.Changes) != 4 {
+		t.Errorf("removal = %+v, want every field removed", rm)
+	}
+}
+
+func TestListGetAndCap(t *testing.T) {
+	l := NewLog(2)
+	for i := 0; i < 3; i++ {
+		l.Record(KindService, "x.com", ActionUpdated, "a", "", spec{Timeout: time.Duration(i)})
+	}
+	revs := l.List(KindService, "x.com")
+	if len(revs) != 2 || revs[0].Number != 3 || revs[1].Number != 2 {
+		t.Fatalf("revisions = %+v, want #3 then #2", revs)
+	}
+	if _, ok := l.Get(KindService, "x.com", 1); ok {
+		t.Error("revision 1 should have been dropped by the cap")
+	}
+	if r, ok := l.Get(KindService, "x.com", 2); !ok || r.Spec == "" {
+		t.Errorf("Get(2) = %+v, %v", r, ok)
+	}
+	if len(l.List(KindAgent, "x.com")) != 0 {
+		t.Error("kinds should not share history")
+	}
+}
+
+func TestActor(t *testing.T) {
+	r := httptest.NewRequest("POST", "/", nil)
+	r.RemoteAddr = "10.1.2.3:5555"
+	r.Header.Set("X-Warren-Actor", "alice@laptop")
+	if got := Actor(r); got != "10.1.2.3" {
+		t.Errorf("actor = %q, want caller address", got)
+	}
+	r = r.WithContext(WithActor(r.Context(), TokenActor("secret", r)))
+	got := Actor(r)
+	if !strings.HasPrefix(got, "token:") || !strings.HasSuffix(got, "@10.1.2.3") || strings.Contains(got, "secret") {
+		t.Errorf("actor = %q, want token fingerprint and caller address", got)
+	}
+	if other := TokenActor("other", r); other == got {
+		t.Errorf("different tokens share actor %q", got)
+	}
+}
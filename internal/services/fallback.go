@@ -0,0 +1,75 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+)
+
+// MaxFallbackRetries caps Fallback.Retries.
+const MaxFallbackRetries = 10
+
+// Fallback says how a service answers when its target can't be reached,
+// instead of a bare 502. The steps apply in order: retries, then waking the
+// owning agent and trying again, then the fallback URL, then the page.
+// Waking and the fallback URL re-send the request, so they only apply to
+// requests without a body.
+type Fallback struct {
+	Retries int    `json:"retries,omitempty" yaml:"retries,omitempty"` // retries of GET and HEAD requests after a connection error
+	Wake    bool   `json:"wake,omitempty" yaml:"wake,omitempty"`       // wake the owning agent, hold the request until it's ready and try again
+	URL     string `json:"url,omitempty" yaml:"url,omitempty"`         // alternative target, e.g. a static "back soon" site
+	Page    string `json:"page,omitempty" yaml:"page,omitempty"`       // HTML served with 502 when nothing else worked
+}
+
+// validate checks the fallback's own settings; the URL is checked as a
+// target by the registry.
+func (f *Fallback) validate() error {
+	if f.Retries < 0 || f.Retries > MaxFallbackRetries {
+		return fmt.Errorf("fallback retries must be between 0 and %d", MaxFallbackRetries)
+	}
+	return nil
+}
+
+// Stats counts a service's proxy failures. The zero value is ready to use
+// and a nil *Stats discards counts.
+type Stats struct {
+	failures  atomic.Uint64
+	fallbacks atomic.Uint64
+}
+
+// RecordFailure counts a request whose target couldn't be reached.
+func (s *Stats) RecordFailure() {
+	if s != nil {
+		s.failures.Add(1)
+	}
+}
+
+// RecordFallback counts a request answered by the fallback URL or page.
+func (s *Stats) RecordFallback() {
+	if s != nil {
+		s.fallbacks.Add(1)
+	}
+}
+
+// Failures returns how many requests couldn't reach the target.
+func (s *Stats) Failures() uint64 {
+	if s == nil {
+		return 0
+	}
+	return s.failures.Load()
+}
+
+// Fallbacks returns how many requests were answered by the fallback.
+func (s *Stats) Fallbacks() uint64 {
+	if s == nil {
+		return 0
+	}
+	return s.fallbacks.Load()
+}
+
+func (s *Stats) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Failures  uint64 `json:"failures"`
+		Fallbacks uint64 `json:"fallbacks"`
+	}{s.Failures(), s.Fallbacks()})
+}
@@ -0,0 +1,43 @@
+package services
+
+import "sort"
+
+// PortMapping is a host port Warren published for an agent's container.
+type PortMapping struct {
+	Agent     string `json:"agent"`
+	Target    int    `json:"target"`
+	Published int    `json:"published"`
+	Protocol  string `json:"protocol"`
+}
+
+// RecordPorts replaces the host ports recorded for an agent. An empty list
+// forgets the agent.
+func (r *Registry) RecordPorts(agent string, ports []PortMapping) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(ports) == 0 {
+		delete(r.ports, agent)
+		return
+	}
+	r.ports[agent] = append([]PortMapping(nil), ports...)
+	r.logger.Info("host ports recorded", "agent", agent, "count", len(ports))
+}
+
+// Ports returns the host ports recorded for an agent.
+func (r *Registry) Ports(agent string) []PortMapping {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]PortMapping(nil), r.ports[agent]...)
+}
+
+// AllPorts returns every recorded host port, ordered by published port.
+func (r *Registry) AllPorts() []PortMapping {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var all []PortMapping
+	for _, ports := range r.ports {
+		all = append(all, ports...)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Published < all[j].Published })
+	return all
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
@@ -8,35 +9,142 @@ import (
 	"net/url"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"warren/internal/auth"
+	"warren/internal/balance"
+	"warren/internal/cache"
+	"warren/internal/cors"
+	"warren/internal/events"
+	"warren/internal/headers"
 	"warren/internal/security"
+	"warren/internal/transport"
 )
 
 // Service represents a dynamically registered route.
 type Service struct {
-	Hostname  string               `json:"hostname"`
-	Target    string               `json:"target"`
-	Agent     string               `json:"agent"`
-	CreatedAt time.Time            `json:"created_at"`
-	TargetURL *url.URL             `json:"-"`
-	Proxy     *httputil.ReverseProxy `json:"-"`
+	Hostname      string                 `json:"hostname"`
+	Target        string                 `json:"target"`
+	Agent         string                 `json:"agent"`
+	CreatedAt     time.Time              `json:"created_at"`
+	TargetURL     *url.URL               `json:"-"`
+	Proxy         *httputil.ReverseProxy `json:"-"`
+	BasicAuth     *auth.Basic            `json:"-"`
+	Targets       []string               `json:"targets,omitempty"` // all replicas, when more than one
+	Balance       string                 `json:"balance,omitempty"`
+	Weights       []int                  `json:"weights,omitempty"` // per target, for weighted balancing
+	Sticky        *balance.Sticky        `json:"-"`
+	Timeouts      *transport.Timeouts    `json:"-"`
+	CORS          *cors.Policy           `json:"-"`
+	Headers       *headers.Rewriter      `json:"-"`
+	Cache         *cache.Cache           `json:"-"`
+	Pool          *balance.Pool          `json:"-"`
+	Wake          bool                   `json:"wake,omitempty"` // kept while the agent sleeps; requests wake it
+	Fallback      *Fallback              `json:"fallback,omitempty"`
+	MaxBody       int64                  `json:"max_body,omitempty"` // request body limit in bytes, overriding the proxy-wide one
+	FallbackProxy *httputil.ReverseProxy `json:"-"`                  // to Fallback.URL
+	Stats         *Stats                 `json:"stats,omitempty"`
 }
 
+// Options holds optional per-service settings supplied at registration.
+type Options struct {
+	BasicAuth *auth.Basic
+	// Replicas are additional targets to balance across alongside the main
+	// target, using the Balance strategy (default round-robin).
+	Replicas []string
+	Balance  string
+	// Weights splits traffic across the main target and replicas, in that
+	// order (e.g. 90, 10 for a canary). Setting them implies weighted
+	// balancing.
+	Weights []int
+	// Sticky pins each client to one target with a cookie.
+	Sticky *balance.Sticky
+	// Timeouts replaces the default transport timeouts for the service.
+	Timeouts *transport.Timeouts
+	// CORS answers cross-origin browser requests for the service.
+	CORS *cors.Policy
+	// Headers rewrites request and response headers for the service.
+	Headers *headers.Rewriter
+	// Cache keeps the service's static responses in memory.
+	Cache *cache.Cache
+	// Wake keeps the service registered while its agent sleeps, so requests
+	// for it wake the agent instead of finding no route.
+	Wake bool
+	// Fallback answers requests when the target can't be reached.
+	Fallback *Fallback
+	// MaxBody, when positive, overrides the proxy-wide request body limit
+	// for the service.
+	MaxBody int64
+}
+
+// ErrNotFound is returned when updating a hostname with no registered
+// service.
+var ErrNotFound = errors.New("service not found")
+
+// ErrConfigured is returned when updating a service defined in the config
+// file, which the next reload would put back.
+var ErrConfigured = errors.New("service is defined in the config file; change it there")
+
 // Registry holds ephemeral service routes registered by agents.
 type Registry struct {
-	mu               sync.RWMutex
-	services         map[string]*Service // hostname → service
-	reservedHosts    map[string]bool     // hostnames reserved by configured backends
-	logger           *slog.Logger
+	mu             sync.RWMutex
+	services       map[string]*Service                 // hostname → service
+	routes         atomic.Pointer[map[string]*Service] // read-only copy of services for Lookup
+	reservedHosts  map[string]bool                     // hostnames reserved by configured backends
+	configured     map[string]bool                     // hostnames of the config file's services
+	ports          map[string][]PortMapping            // agent → host ports published by Warren
+	trash          map[string]Trashed                  // hostname → removed service, restorable until expiry
+	trashRetention time.Duration
+	emitter        *events.Emitter
+	logger         *slog.Logger
 }
 
 // NewRegistry creates a new service registry.
 func NewRegistry(logger *slog.Logger) *Registry {
-	return &Registry{
-		services:      make(map[string]*Service),
-		reservedHosts: make(map[string]bool),
-		logger:        logger.With("component", "service-registry"),
+	r := &Registry{
+		services:       make(map[string]*Service),
+		reservedHosts:  make(map[string]bool),
+		configured:     make(map[string]bool),
+		ports:          make(map[string][]PortMapping),
+		trash:          make(map[string]Trashed),
+		trashRetention: DefaultTrashRetention,
+		logger:         logger.With("component", "service-registry"),
+	}
+	r.routes.Store(&map[string]*Service{})
+	return r
+}
+
+// publishLocked replaces the copy of the services Lookup reads. Callers
+// hold r.mu and call it after every change to r.services.
+func (r *Registry) publishLocked() {
+	routes := make(map[string]*Service, len(r.services))
+	for h, svc := range r.services {
+		routes[h] = svc
+	}
+	r.routes.Store(&routes)
+}
+
+// SetEmitter reports registrations rejected for their target as security
+// events.
+func (r *Registry) SetEmitter(e *events.Emitter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.emitter = e
+}
+
+// reportBlocked emits a security event for a registration whose target
+// failed validateTarget.
+func (r *Registry) reportBlocked(hostname, target, agent string, err error) {
+	r.mu.RLock()
+	emitter := r.emitter
+	r.mu.RUnlock()
+	if emitter != nil {
+		emitter.Emit(events.Event{Type: events.SecurityTargetBlocked, Agent: agent, Fields: map[string]string{
+			"hostname": hostname,
+			"target":   target,
+			"reason":   err.Error(),
+		}})
 	}
 }
 
@@ -45,31 +153,47 @@ func NewRegistry(logger *slog.Logger) *Registry {
 func (r *Registry) ReserveHostname(hostname string) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	r.reservedHosts[hostname] = true
+	r.reservedHosts[strings.ToLower(hostname)] = true
+}
+
+// SetConfigured records which hostnames come from the config file's
+// services, replacing the previous set. Update refuses them.
+func (r *Registry) SetConfigured(hostnames []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.configured = make(map[string]bool, len(hostnames))
+	for _, h := range hostnames {
+		r.configured[strings.ToLower(h)] = true
+	}
+}
+
+// Configured reports whether hostname is one of the config file's services.
+func (r *Registry) Configured(hostname string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.configured[strings.ToLower(hostname)]
 }
 
 // Register adds an ephemeral route. Returns an error if the hostname is reserved
 // or the target URL is not allowed.
 func (r *Registry) Register(hostname, target, agent string) error {
+	return r.RegisterWithOptions(hostname, target, agent, Options{})
+}
+
+// RegisterWithOptions is Register with additional per-service settings.
+func (r *Registry) RegisterWithOptions(hostname, target, agent string, opts Options) error {
+	hostname = strings.ToLower(hostname)
+
 	// Validate hostname format (L3).
 	if err := security.ValidateHostname(hostname); err != nil {
 		r.logger.Warn("service registration rejected: invalid hostname", "hostname", hostname, "error", err)
 		return fmt.Errorf("invalid hostname: %w", err)
 	}
 
-	// Validate target URL to prevent SSRF.
-	if err := validateTarget(target); err != nil {
-		r.logger.Warn("service registration rejected: invalid target", "hostname", hostname, "target", target, "error", err)
-		return fmt.Errorf("invalid target: %w", err)
-	}
-
-	// Parse and cache the target URL and reverse proxy (L2).
-	targetURL, err := url.Parse(target)
+	svc, err := r.build(hostname, target, agent, opts)
 	if err != nil {
-		return fmt.Errorf("invalid target URL: %w", err)
+		return err
 	}
-	rp := httputil.NewSingleHostReverseProxy(targetURL)
-	rp.FlushInterval = -1
 
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -80,18 +204,245 @@ func (r *Registry) Register(hostname, target, agent string) error {
 		return fmt.Errorf("hostname %q is reserved", hostname)
 	}
 
-	r.services[hostname] = &Service{
-		Hostname:  hostname,
-		Target:    target,
-		Agent:     agent,
-		CreatedAt: time.Now(),
-		TargetURL: targetURL,
-		Proxy:     rp,
+	// Re-registering, e.g. when an agent restarts or the config is
+	// reloaded, keeps the service's counters, as Update does.
+	if old, ok := r.services[hostname]; ok {
+		svc.Stats = old.Stats
 	}
-	r.logger.Info("service registered", "hostname", hostname, "target", target, "agent", agent)
+	r.services[hostname] = svc
+	r.publishLocked()
+	r.logger.Info("service registered", "hostname", hostname, "target", target, "agent", agent, "basic_auth", opts.BasicAuth != nil, "replicas", len(svc.Targets))
 	return nil
 }
 
+// Patch is a change to a registered service. Fields left nil keep the
+// service's current setting.
+type Patch struct {
+	Target   string
+	Replicas []string // empty, not nil, leaves just the target
+	Weights  []int
+	Balance  *string
+	Wake     *bool
+	Fallback *Fallback // a zero Fallback removes it
+}
+
+// Update points a registered service at the patch's target, keeping its
+// agent and any option the patch leaves nil. Replicas and weights replace
+// the service's own when not nil; new replicas without weights drop the old
+// weights, so a weighted service goes back to round-robin. The new service,
+// with its reverse proxy, is built before it replaces the old one in a
+// single swap, so requests never find the hostname unrouted.
+func (r *Registry) Update(hostname string, patch Patch) error {
+	target, replicas, weights := patch.Target, patch.Replicas, patch.Weights
+	hostname = strings.ToLower(hostname)
+	r.mu.RLock()
+	old, ok := r.services[hostname]
+	configured := r.configured[hostname]
+	r.mu.RUnlock()
+	if !ok {
+		return ErrNotFound
+	}
+	if configured {
+		return ErrConfigured
+	}
+
+	opts := old.options()
+	if replicas != nil {
+		opts.Replicas = replicas
+		if weights == nil {
+			// The old weights were for the old targets.
+			opts.Weights = nil
+			if opts.Balance == balance.Weighted {
+				opts.Balance = ""
+			}
+		}
+		if len(opts.Replicas) == 0 {
+			// Back to a single target: nothing left to balance.
+			opts.Balance, opts.Sticky = "", nil
+		}
+	}
+	if weights != nil {
+		// Weights imply weighted balancing, whatever the service used.
+		opts.Weights, opts.Balance = weights, ""
+	}
+	if patch.Balance != nil {
+		opts.Balance = *patch.Balance
+	}
+	if patch.Wake != nil {
+		opts.Wake = *patch.Wake
+	}
+	if fb := patch.Fallback; fb != nil {
+		opts.Fallback = fb
+		if *fb == (Fallback{}) {
+			opts.Fallback = nil
+		}
+	}
+	svc, err := r.build(hostname, target, old.Agent, opts)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.services[hostname] != old {
+		return fmt.Errorf("service %s changed during the update", hostname)
+	}
+	svc.CreatedAt, svc.Stats = old.CreatedAt, old.Stats
+	r.services[hostname] = svc
+	r.publishLocked()
+	r.logger.Info("service updated", "hostname", hostname, "target", target, "previous_target", old.Target, "replicas", len(svc.Targets))
+	return nil
+}
+
+// options returns the registration options the service was built with, so
+// it can be rebuilt with some of them changed.
+func (s *Service) options() Options {
+	opts := Options{
+		BasicAuth: s.BasicAuth,
+		Balance:   s.Balance,
+		Weights:   s.Weights,
+		Sticky:    s.Sticky,
+		Timeouts:  s.Timeouts,
+		CORS:      s.CORS,
+		Headers:   s.Headers,
+		Cache:     s.Cache,
+		Wake:      s.Wake,
+		Fallback:  s.Fallback,
+		MaxBody:   s.MaxBody,
+	}
+	if len(s.Targets) > 1 {
+		opts.Replicas = s.Targets[1:]
+	}
+	return opts
+}
+
+// build validates a service's targets and options and creates its reverse
+// proxies, without touching the registry.
+func (r *Registry) build(hostname, target, agent string, opts Options) (*Service, error) {
+	// Validate target URL to prevent SSRF.
+	if err := validateTarget(target); err != nil {
+		r.logger.Warn("service registration rejected: invalid target", "hostname", hostname, "target", target, "error", err)
+		r.reportBlocked(hostname, target, agent, err)
+		return nil, fmt.Errorf("invalid target: %w", err)
+	}
+
+	// Parse and cache the target URL and reverse proxy (L2).
+	targetURL, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target URL: %w", err)
+	}
+	rp := httputil.NewSingleHostReverseProxy(targetURL)
+	rp.FlushInterval = -1
+
+	var targets []string
+	var strategy string
+	var weights []int
+	var sticky *balance.Sticky
+	var pool *balance.Pool
+	if len(opts.Weights) > 0 && len(opts.Replicas) == 0 {
+		return nil, fmt.Errorf("weights need at least one replica to split traffic with")
+	}
+	if opts.Sticky != nil && len(opts.Replicas) == 0 {
+		return nil, fmt.Errorf("sticky sessions need at least one replica")
+	}
+	if opts.Sticky != nil && opts.Sticky.Cookie != "" && !balance.ValidCookieName(opts.Sticky.Cookie) {
+		return nil, fmt.Errorf("sticky cookie %q is not a valid cookie name", opts.Sticky.Cookie)
+	}
+	if len(opts.Replicas) > 0 {
+		targets = append([]string{target}, opts.Replicas...)
+		urls := []*url.URL{targetURL}
+		for _, replica := range opts.Replicas {
+			if err := validateTarget(replica); err != nil {
+				r.logger.Warn("service registration rejected: invalid target", "hostname", hostname, "target", replica, "error", err)
+				r.reportBlocked(hostname, replica, agent, err)
+				return nil, fmt.Errorf("invalid target: %w", err)
+			}
+			u, err := url.Parse(replica)
+			if err != nil {
+				return nil, fmt.Errorf("invalid target URL: %w", err)
+			}
+			urls = append(urls, u)
+		}
+		switch {
+		case len(opts.Weights) > 0:
+			if opts.Balance != "" && opts.Balance != balance.Weighted {
+				return nil, fmt.Errorf("weights cannot be used with %s balancing", opts.Balance)
+			}
+			pool, err = balance.NewWeighted(urls, opts.Weights, r.logger)
+		default:
+			pool, err = balance.New(urls, opts.Balance, r.logger)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if opts.Sticky != nil {
+			pool.SetSticky(*opts.Sticky)
+			sticky = pool.Sticky()
+		}
+		strategy = pool.Strategy()
+		weights = pool.Weights()
+	}
+	var fallbackProxy *httputil.ReverseProxy
+	if fb := opts.Fallback; fb != nil {
+		if pool != nil {
+			return nil, fmt.Errorf("fallback cannot be used with replicas")
+		}
+		if fb.Wake && agent == "" {
+			return nil, fmt.Errorf("fallback wake needs an owning agent")
+		}
+		if err := fb.validate(); err != nil {
+			return nil, err
+		}
+		if fb.URL != "" {
+			if err := validateTarget(fb.URL); err != nil {
+				r.logger.Warn("service registration rejected: invalid fallback", "hostname", hostname, "target", fb.URL, "error", err)
+				r.reportBlocked(hostname, fb.URL, agent, err)
+				return nil, fmt.Errorf("invalid fallback url: %w", err)
+			}
+			u, err := url.Parse(fb.URL)
+			if err != nil {
+				return nil, fmt.Errorf("invalid fallback url: %w", err)
+			}
+			fallbackProxy = httputil.NewSingleHostReverseProxy(u)
+			fallbackProxy.FlushInterval = -1
+		}
+	}
+	if opts.Timeouts != nil {
+		tr := transport.New(*opts.Timeouts)
+		rp.Transport = tr
+		if pool != nil {
+			pool.SetTransport(tr)
+		}
+		if fallbackProxy != nil {
+			fallbackProxy.Transport = tr
+		}
+	}
+
+	return &Service{
+		Hostname:      hostname,
+		Target:        target,
+		Agent:         agent,
+		CreatedAt:     time.Now(),
+		TargetURL:     targetURL,
+		Proxy:         rp,
+		BasicAuth:     opts.BasicAuth,
+		Targets:       targets,
+		Balance:       strategy,
+		Weights:       weights,
+		Sticky:        sticky,
+		Timeouts:      opts.Timeouts,
+		CORS:          opts.CORS,
+		Headers:       opts.Headers,
+		Cache:         opts.Cache,
+		Pool:          pool,
+		Wake:          opts.Wake,
+		Fallback:      opts.Fallback,
+		MaxBody:       opts.MaxBody,
+		FallbackProxy: fallbackProxy,
+		Stats:         &Stats{},
+	}, nil
+}
+
 // validateTarget checks that a service target URL is safe to proxy to.
 func validateTarget(target string) error {
 	u, err := url.Parse(target)
@@ -144,34 +495,47 @@ func (r *Registry) Deregister(hostname string) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	hostname = strings.ToLower(hostname)
 	if _, ok := r.services[hostname]; ok {
 		delete(r.services, hostname)
+		r.publishLocked()
 		r.logger.Info("service deregistered", "hostname", hostname)
 	}
 }
 
 // DeregisterByAgent purges all routes for an agent.
 func (r *Registry) DeregisterByAgent(agent string) {
+	r.deregisterByAgent(agent, false)
+}
+
+// DeregisterSleeping purges an agent's routes when it goes to sleep, except
+// those registered with Wake.
+func (r *Registry) DeregisterSleeping(agent string) {
+	r.deregisterByAgent(agent, true)
+}
+
+func (r *Registry) deregisterByAgent(agent string, keepWake bool) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	var removed []string
 	for hostname, svc := range r.services {
-		if svc.Agent == agent {
+		if svc.Agent == agent && !(keepWake && svc.Wake) {
 			delete(r.services, hostname)
 			removed = append(removed, hostname)
 		}
 	}
 	if len(removed) > 0 {
+		r.publishLocked()
 		r.logger.Info("services deregistered by agent", "agent", agent, "hostnames", removed)
 	}
 }
 
-// Lookup checks if a service is registered for the given hostname.
+// Lookup checks if a service is registered for the given hostname. It's
+// called for every proxied request, so it reads the published copy of the
+// services rather than taking the lock.
 func (r *Registry) Lookup(hostname string) (*Service, bool) {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-	svc, ok := r.services[hostname]
+	svc, ok := (*r.routes.Load())[strings.ToLower(hostname)]
 	return svc, ok
 }
 
@@ -190,6 +554,7 @@ func (r *Registry) List() []Service {
 // RegisterUnsafe adds an ephemeral route without target validation.
 // Intended for testing only.
 func (r *Registry) RegisterUnsafe(hostname, target, agent string) {
+	hostname = strings.ToLower(hostname)
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	targetURL, _ := url.Parse(target)
@@ -206,4 +571,5 @@ func (r *Registry) RegisterUnsafe(hostname, target, agent string) {
 		TargetURL: targetURL,
 		Proxy:     rp,
 	}
+	r.publishLocked()
 }
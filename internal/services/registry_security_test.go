@@ -1,8 +1,12 @@
 package services
 
 import (
+	"io"
+	"log/slog"
 	"strings"
 	"testing"
+
+	"warren/internal/events"
 )
 
 func TestRegistry_CachedReverseProxy(t *testing.T) {
@@ -96,3 +100,25 @@ func TestRegistry_ValidTargetAccepted(t *testing.T) {
 		t.Errorf("valid local target rejected: %v", err)
 	}
 }
+
+func TestRegistry_BlockedTargetEmitsSecurityEvent(t *testing.T) {
+	r := testRegistry()
+	emitter := events.NewEmitter(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	var got []events.Event
+	emitter.OnEvent(func(ev events.Event) { got = append(got, ev) })
+	r.SetEmitter(emitter)
+
+	if err := r.Register("meta.example.com", "http://169.254.169.254/latest", "agent-a"); err == nil {
+		t.Fatal("expected metadata target to be rejected")
+	}
+	if err := r.Register("bad host", "http://localhost:3000", "agent-a"); err == nil {
+		t.Fatal("expected invalid hostname to be rejected")
+	}
+	if len(got) != 1 {
+		t.Fatalf("got %d events, want 1 for the blocked target only", len(got))
+	}
+	ev := got[0]
+	if ev.Type != events.SecurityTargetBlocked || ev.Agent != "agent-a" || ev.Fields["target"] != "http://169.254.169.254/latest" {
+		t.Errorf("event = %+v", ev)
+	}
+}
@@ -3,7 +3,16 @@ package services
 import (
 	"log/slog"
 	"os"
+	"reflect"
 	"testing"
+	"time"
+
+	"warren/internal/auth"
+	"warren/internal/balance"
+	"warren/internal/cache"
+	"warren/internal/cors"
+	"warren/internal/headers"
+	"warren/internal/transport"
 )
 
 func testRegistry() *Registry {
@@ -61,6 +70,43 @@ func TestDeregisterByAgent(t *testing.T) {
 	}
 }
 
+func TestDeregisterSleepingKeepsWake(t *testing.T) {
+	r := testRegistry()
+	r.Register("a.com", "http://x", "agent1")
+	if err := r.RegisterWithOptions("b.com", "http://y", "agent1", Options{Wake: true}); err != nil {
+		t.Fatal(err)
+	}
+	r.DeregisterSleeping("agent1")
+
+	if _, ok := r.Lookup("a.com"); ok {
+		t.Error("a.com should be gone")
+	}
+	if svc, ok := r.Lookup("b.com"); !ok || !svc.Wake {
+		t.Error("b.com should survive the agent sleeping")
+	}
+
+	r.DeregisterByAgent("agent1")
+	if _, ok := r.Lookup("b.com"); ok {
+		t.Error("DeregisterByAgent should purge wake services too")
+	}
+}
+
+func TestRegisterFallbackValidation(t *testing.T) {
+	r := testRegistry()
+	for name, opts := range map[string]Options{
+		"blocked url":   {Fallback: &Fallback{URL: "http://169.254.169.254/"}},
+		"retries":       {Fallback: &Fallback{Retries: MaxFallbackRetries + 1}},
+		"with replicas": {Fallback: &Fallback{Page: "down"}, Replicas: []string{"http://b:80"}},
+	} {
+		if err := r.RegisterWithOptions("a.com", "http://a:80", "agent1", opts); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	if err := r.RegisterWithOptions("a.com", "http://a:80", "", Options{Fallback: &Fallback{Wake: true}}); err == nil {
+		t.Error("expected error for wake without an agent")
+	}
+}
+
 func TestList(t *testing.T) {
 	r := testRegistry()
 	r.Register("a.com", "http://x", "a")
@@ -83,3 +129,230 @@ func TestDuplicateHostnameOverwrites(t *testing.T) {
 		t.Errorf("agent = %q, want b", svc.Agent)
 	}
 }
+
+func TestReregisterKeepsStats(t *testing.T) {
+	r := testRegistry()
+	r.Register("a.com", "http://10.0.0.1:3000", "a")
+	old, _ := r.Lookup("a.com")
+	old.Stats.RecordFailure()
+
+	r.Register("a.com", "http://10.0.0.2:3000", "a")
+	svc, _ := r.Lookup("a.com")
+	if svc == old || svc.Stats.Failures() != 1 {
+		t.Errorf("failures after re-registering = %d, want 1 carried over", svc.Stats.Failures())
+	}
+}
+
+func TestRecordPorts(t *testing.T) {
+	r := testRegistry()
+	r.RecordPorts("kai", []PortMapping{{Agent: "kai", Target: 8080, Published: 30001, Protocol: "tcp"}})
+	r.RecordPorts("mc", []PortMapping{{Agent: "mc", Target: 8080, Published: 30000, Protocol: "tcp"}})
+
+	if got := r.Ports("kai"); len(got) != 1 || got[0].Published != 30001 {
+		t.Errorf("kai ports = %+v", got)
+	}
+	all := r.AllPorts()
+	if len(all) != 2 || all[0].Agent != "mc" {
+		t.Errorf("all ports = %+v, want mc first", all)
+	}
+
+	r.RecordPorts("kai", nil)
+	if got := r.Ports("kai"); len(got) != 0 {
+		t.Errorf("expected kai ports forgotten, got %+v", got)
+	}
+}
+
+func TestRegisterWithReplicas(t *testing.T) {
+	r := testRegistry()
+	err := r.RegisterWithOptions("a.com", "http://10.0.0.1:3000", "a", Options{
+		Replicas: []string{"http://10.0.0.2:3000"},
+		Balance:  "least-connections",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc, _ := r.Lookup("a.com")
+	if svc.Pool == nil || len(svc.Targets) != 2 || svc.Balance != "least-connections" {
+		t.Errorf("service = %+v, want a least-connections pool over 2 targets", svc)
+	}
+
+	if err := r.RegisterWithOptions("b.com", "http://10.0.0.1:3000", "a", Options{
+		Replicas: []string{"http://169.254.169.254/"},
+	}); err == nil {
+		t.Error("expected blocked replica to be rejected")
+	}
+	if err := r.RegisterWithOptions("c.com", "http://10.0.0.1:3000", "a", Options{
+		Replicas: []string{"http://10.0.0.2:3000"},
+		Balance:  "random",
+	}); err == nil {
+		t.Error("expected unknown balance strategy to be rejected")
+	}
+}
+
+func TestRegisterWithWeights(t *testing.T) {
+	r := testRegistry()
+	err := r.RegisterWithOptions("a.com", "http://10.0.0.1:3000", "a", Options{
+		Replicas: []string{"http://10.0.0.2:3000"},
+		Weights:  []int{90, 10},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc, _ := r.Lookup("a.com")
+	if svc.Balance != "weighted" || len(svc.Weights) != 2 || svc.Weights[1] != 10 {
+		t.Errorf("service = %+v, want a 90/10 weighted pool", svc)
+	}
+
+	if err := r.RegisterWithOptions("b.com", "http://10.0.0.1:3000", "a", Options{Weights: []int{100}}); err == nil {
+		t.Error("expected weights without replicas to be rejected")
+	}
+	if err := r.RegisterWithOptions("c.com", "http://10.0.0.1:3000", "a", Options{
+		Replicas: []string{"http://10.0.0.2:3000"},
+		Balance:  "least-connections",
+		Weights:  []int{90, 10},
+	}); err == nil {
+		t.Error("expected weights with least-connections to be rejected")
+	}
+	if err := r.RegisterWithOptions("d.com", "http://10.0.0.1:3000", "a", Options{
+		Replicas: []string{"http://10.0.0.2:3000"},
+		Weights:  []int{90},
+	}); err == nil {
+		t.Error("expected mismatched weight count to be rejected")
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	r := testRegistry()
+	err := r.RegisterWithOptions("a.com", "http://10.0.0.1:3000", "agent-a", Options{
+		Replicas: []string{"http://10.0.0.2:3000"},
+		Weights:  []int{90, 10},
+		Wake:     true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, _ := r.Lookup("a.com")
+
+	// Replicas and weights are kept unless given.
+	if err := r.Update("A.com", Patch{Target: "http://10.0.0.3:3000"}); err != nil {
+		t.Fatal(err)
+	}
+	svc, _ := r.Lookup("a.com")
+	if svc == old || svc.Target != "http://10.0.0.3:3000" || svc.TargetURL.Host != "10.0.0.3:3000" {
+		t.Errorf("service = %+v, want a new service targeting 10.0.0.3", svc)
+	}
+	if svc.Agent != "agent-a" || !svc.Wake || svc.Weights[0] != 90 || len(svc.Targets) != 2 {
+		t.Errorf("service = %+v, want agent, wake and weights kept", svc)
+	}
+	if svc.CreatedAt != old.CreatedAt || svc.Stats != old.Stats {
+		t.Error("update should keep the service's creation time and stats")
+	}
+
+	// New replicas without weights: the old weights no longer fit, so
+	// they're dropped rather than rejected.
+	if err := r.Update("a.com", Patch{Target: "http://10.0.0.3:3000", Replicas: []string{"http://10.0.0.5:3000", "http://10.0.0.6:3000"}}); err != nil {
+		t.Fatalf("update replicas of a weighted service: %v", err)
+	}
+	if svc, _ := r.Lookup("a.com"); len(svc.Targets) != 3 || len(svc.Weights) != 0 || svc.Balance != "round-robin" {
+		t.Errorf("service = %+v, want 3 targets balanced round-robin", svc)
+	}
+	if err := r.Update("a.com", Patch{Target: "http://10.0.0.3:3000", Weights: []int{50, 25, 25}}); err != nil {
+		t.Fatalf("update weights: %v", err)
+	}
+	if svc, _ := r.Lookup("a.com"); svc.Balance != "weighted" || len(svc.Weights) != 3 {
+		t.Errorf("service = %+v, want 50/25/25 weighted", svc)
+	}
+
+	// No replicas left: back to a single target.
+	if err := r.Update("a.com", Patch{Target: "http://10.0.0.4:3000", Replicas: []string{}}); err != nil {
+		t.Fatal(err)
+	}
+	if svc, _ := r.Lookup("a.com"); svc.Pool != nil || svc.Balance != "" || len(svc.Weights) != 0 {
+		t.Errorf("service = %+v, want no pool", svc)
+	}
+
+	// Balance, wake and fallback change only when given.
+	off, leastConn := false, "least-connections"
+	if err := r.Update("a.com", Patch{Target: "http://10.0.0.4:3000", Wake: &off, Fallback: &Fallback{Page: "<p>back soon</p>"}}); err != nil {
+		t.Fatal(err)
+	}
+	if svc, _ := r.Lookup("a.com"); svc.Wake || svc.Fallback == nil || svc.Fallback.Page == "" {
+		t.Errorf("service = %+v, want wake off and the fallback page", svc)
+	}
+	if err := r.Update("a.com", Patch{Target: "http://10.0.0.4:3000", Replicas: []string{"http://10.0.0.5:3000"}, Balance: &leastConn, Fallback: &Fallback{}}); err != nil {
+		t.Fatal(err)
+	}
+	if svc, _ := r.Lookup("a.com"); svc.Balance != leastConn || svc.Fallback != nil {
+		t.Errorf("service = %+v, want least-connections and no fallback", svc)
+	}
+
+	if err := r.Update("a.com", Patch{Target: "http://169.254.169.254/"}); err == nil {
+		t.Error("expected blocked target to be rejected")
+	}
+	if svc, _ := r.Lookup("a.com"); svc.Target != "http://10.0.0.4:3000" {
+		t.Errorf("rejected update changed target to %q", svc.Target)
+	}
+	if err := r.Update("b.com", Patch{Target: "http://10.0.0.1:3000"}); err != ErrNotFound {
+		t.Errorf("update of unknown service = %v, want ErrNotFound", err)
+	}
+
+	// Services from the config file would be put back by the next reload.
+	r.SetConfigured([]string{"A.com"})
+	if err := r.Update("a.com", Patch{Target: "http://10.0.0.1:3000"}); err != ErrConfigured {
+		t.Errorf("update of configured service = %v, want ErrConfigured", err)
+	}
+	r.SetConfigured(nil)
+	if err := r.Update("a.com", Patch{Target: "http://10.0.0.1:3000"}); err != nil {
+		t.Errorf("update after the service left the config: %v", err)
+	}
+}
+
+func TestServiceOptionsRoundTrip(t *testing.T) {
+	basic, err := auth.NewBasic("test", []string{"u:$2a$10$abcdefghijklmnopqrstuu5Ki0jZxtj3Mdp7yXIBRpH1v2u0NiFSm"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := cors.New(cors.Config{Origins: []string{"https://app.example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rw, err := headers.New(headers.Config{Request: headers.Rules{Set: map[string]string{"X-From": "warren"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	balanced := Options{
+		BasicAuth: basic,
+		Replicas:  []string{"http://10.0.0.2:3000"},
+		Balance:   "weighted",
+		Weights:   []int{90, 10},
+		Sticky:    &balance.Sticky{Cookie: "route", TTL: time.Hour},
+		Timeouts:  &transport.Timeouts{ResponseHeader: time.Second},
+		CORS:      policy,
+		Headers:   rw,
+		Cache:     cache.New(cache.Config{Paths: []string{"/static/"}}),
+		Wake:      true,
+		MaxBody:   1 << 20,
+	}
+	// Fallback can't be combined with replicas.
+	single := Options{Fallback: &Fallback{Page: "<p>back soon</p>"}}
+
+	// Every option is set in one of them, so one the helper forgets shows
+	// up below.
+	a, b := reflect.ValueOf(balanced), reflect.ValueOf(single)
+	for i := 0; i < a.NumField(); i++ {
+		if a.Field(i).IsZero() && b.Field(i).IsZero() {
+			t.Fatalf("test sets no %s; add it here and to Service.options", a.Type().Field(i).Name)
+		}
+	}
+
+	r := testRegistry()
+	for host, opts := range map[string]Options{"a.com": balanced, "b.com": single} {
+		if err := r.RegisterWithOptions(host, "http://10.0.0.1:3000", "agent-a", opts); err != nil {
+			t.Fatal(err)
+		}
+		svc, _ := r.Lookup(host)
+		if got := svc.options(); !reflect.DeepEqual(got, opts) {
+			t.Errorf("%s: options() = %+v\nwant %+v", host, got, opts)
+		}
+	}
+}
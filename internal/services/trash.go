@@ -0,0 +1,110 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrNotInTrash is returned when restoring a hostname with no trashed service.
+var ErrNotInTrash = errors.New("service not in trash")
+
+// DefaultTrashRetention is how long removed services stay restorable unless
+// SetTrashRetention says otherwise.
+const DefaultTrashRetention = 24 * time.Hour
+
+// Trashed is a removed service, kept so it can be restored until ExpiresAt.
+type Trashed struct {
+	Service
+	RemovedAt time.Time `json:"removed_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// SetTrashRetention sets how long removed services can be restored. Zero or
+// less disables the trash: removed services are gone immediately.
+func (r *Registry) SetTrashRetention(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.trashRetention = d
+}
+
+// Remove deregisters a service and keeps it in the trash for the retention
+// period. It reports whether a service was registered under hostname.
+func (r *Registry) Remove(hostname string) bool {
+	hostname = strings.ToLower(hostname)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	svc, ok := r.services[hostname]
+	if !ok {
+		return false
+	}
+	delete(r.services, hostname)
+	r.publishLocked()
+	if r.trashRetention > 0 {
+		now := time.Now()
+		r.trash[hostname] = Trashed{Service: *svc, RemovedAt: now, ExpiresAt: now.Add(r.trashRetention)}
+	}
+	r.logger.Info("service removed", "hostname", hostname, "restorable_for", r.trashRetention)
+	return true
+}
+
+// Restore re-registers a trashed service with its original targets and
+// options. It fails if the hostname has been taken in the meantime. The
+// hostname is checked and claimed in one step, so no other registration can
+// take it in between.
+func (r *Registry) Restore(hostname string) error {
+	hostname = strings.ToLower(hostname)
+	r.mu.Lock()
+	r.purgeTrashLocked()
+	t, ok := r.trash[hostname]
+	r.mu.Unlock()
+	if !ok {
+		return ErrNotInTrash
+	}
+
+	svc, err := r.build(hostname, t.Target, t.Agent, t.options())
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if cur, ok := r.trash[hostname]; !ok || cur.RemovedAt != t.RemovedAt {
+		return ErrNotInTrash // restored or replaced meanwhile
+	}
+	if _, taken := r.services[hostname]; taken || r.reservedHosts[hostname] {
+		return fmt.Errorf("hostname %s is in use", hostname)
+	}
+	r.services[hostname] = svc
+	delete(r.trash, hostname)
+	r.publishLocked()
+	r.logger.Info("service restored", "hostname", hostname, "target", t.Target, "agent", t.Agent)
+	return nil
+}
+
+// Trash lists restorable services, most recently removed first.
+func (r *Registry) Trash() []Trashed {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.purgeTrashLocked()
+
+	result := make([]Trashed, 0, len(r.trash))
+	for _, t := range r.trash {
+		result = append(result, t)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].RemovedAt.After(result[j].RemovedAt) })
+	return result
+}
+
+// purgeTrashLocked drops expired entries. Caller must hold r.mu.
+func (r *Registry) purgeTrashLocked() {
+	now := time.Now()
+	for hostname, t := range r.trash {
+		if now.After(t.ExpiresAt) {
+			delete(r.trash, hostname)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRemoveAndRestore(t *testing.T) {
+	r := testRegistry()
+	if err := r.RegisterWithOptions("a.com", "http://10.0.0.1:3000", "agent-a", Options{
+		Replicas: []string{"http://10.0.0.2:3000"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !r.Remove("a.com") {
+		t.Fatal("expected Remove to report a registered service")
+	}
+	if _, ok := r.Lookup("a.com"); ok {
+		t.Fatal("service still routable after Remove")
+	}
+	trash := r.Trash()
+	if len(trash) != 1 || trash[0].Hostname != "a.com" || trash[0].ExpiresAt.Before(time.Now().Add(23*time.Hour)) {
+		t.Fatalf("trash = %+v", trash)
+	}
+
+	if err := r.Restore("a.com"); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	svc, ok := r.Lookup("a.com")
+	if !ok || svc.Agent != "agent-a" || len(svc.Targets) != 2 || svc.Pool == nil {
+		t.Errorf("restored service = %+v", svc)
+	}
+	if len(r.Trash()) != 0 {
+		t.Error("restored service still in trash")
+	}
+	if err := r.Restore("a.com"); err != ErrNotInTrash {
+		t.Errorf("second restore = %v, want ErrNotInTrash", err)
+	}
+}
+
+func TestRestoreHostnameTaken(t *testing.T) {
+	r := testRegistry()
+	r.Register("a.com", "http://10.0.0.1:3000", "a")
+	r.Remove("a.com")
+	r.Register("a.com", "http://10.0.0.9:3000", "b")
+
+	if err := r.Restore("a.com"); err == nil || err == ErrNotInTrash {
+		t.Errorf("restore over a live service = %v, want in-use error", err)
+	}
+
+	// An agent taking the hostname reserves it against the restore too.
+	r.Register("b.com", "http://10.0.0.1:3000", "a")
+	r.Remove("b.com")
+	r.ReserveHostname("b.com")
+	if err := r.Restore("b.com"); err == nil || err == ErrNotInTrash {
+		t.Errorf("restore over a reserved hostname = %v, want in-use error", err)
+	}
+	if _, ok := r.Lookup("b.com"); ok {
+		t.Error("restore registered a reserved hostname")
+	}
+}
+
+func TestTrashExpiryAndDisabled(t *testing.T) {
+	r := testRegistry()
+	r.SetTrashRetention(time.Millisecond)
+	r.Register("a.com", "http://10.0.0.1:3000", "a")
+	r.Remove("a.com")
+	time.Sleep(5 * time.Millisecond)
+	if len(r.Trash()) != 0 {
+		t.Error("expired service still in trash")
+	}
+
+	r.SetTrashRetention(0)
+	r.Register("b.com", "http://10.0.0.1:3000", "a")
+	r.Remove("b.com")
+	if err := r.Restore("b.com"); err != ErrNotInTrash {
+		t.Errorf("restore with trash disabled = %v, want ErrNotInTrash", err)
+	}
+}
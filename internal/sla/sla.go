@@ -0,0 +1,232 @@
+// Package sla tracks each agent's availability over a rolling window and
+// emits agent.sla_breach when it falls below the agent's target, so paging
+// follows sustained problems rather than single failed health checks.
+package sla
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"warren/internal/clock"
+	"warren/internal/events"
+	"warren/internal/human"
+)
+
+// DefaultWindow is the availability window unless configured otherwise.
+const DefaultWindow = 24 * time.Hour
+
+// CheckInterval is how often availability is compared against targets.
+const CheckInterval = time.Minute
+
+// Status is an agent's availability over its window.
+type Status struct {
+	Availability float64 // percent
+	Target       float64 // percent
+	Window       time.Duration
+	Downtime     time.Duration
+	Breached     bool
+}
+
+// span is a period an agent was down.
+type span struct {
+	start, end time.Time
+}
+
+type agentSLA struct {
+	target   float64
+	window   time.Duration
+	down     bool
+	since    time.Time // when the current outage began
+	outages  []span    // ended outages, oldest first
+	breached bool
+}
+
+// Tracker follows agents' health from their events. An agent counts as
+// down while degraded, crash-looping or being restarted, and as up
+// otherwise, including while it sleeps. Time before Warren started counts
+// as up, so a restart doesn't turn a short outage into a breach.
+type Tracker struct {
+	emitter *events.Emitter
+	logger  *slog.Logger
+	clock   clock.Clock
+
+	mu     sync.Mutex
+	agents map[string]*agentSLA
+}
+
+// New creates a tracker. Agents are tracked once given a target with Set.
+func New(emitter *events.Emitter, logger *slog.Logger) *Tracker {
+	return &Tracker{
+		emitter: emitter,
+		logger:  logger.With("component", "sla"),
+		clock:   clock.Real,
+		agents:  make(map[string]*agentSLA),
+	}
+}
+
+// SetClock replaces the system clock, e.g. with a fake in tests.
+func (t *Tracker) SetClock(c clock.Clock) {
+	t.clock = c
+}
+
+// Set sets an agent's target availability in percent, e.g. 99.5, over
+// window (DefaultWindow if zero). A zero target stops tracking the agent.
+// Outages already recorded are kept when the target changes.
+func (t *Tracker) Set(agent string, target float64, window time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if target <= 0 {
+		delete(t.agents, agent)
+		return
+	}
+	if window <= 0 {
+		window = DefaultWindow
+	}
+	a, ok := t.agents[agent]
+	if !ok {
+		a = &agentSLA{}
+		t.agents[agent] = a
+	}
+	a.target, a.window = target, window
+}
+
+// HandleEvent records agents going down and coming back up.
+func (t *Tracker) HandleEvent(ev events.Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	a, ok := t.agents[ev.Agent]
+	if !ok {
+		return
+	}
+	now := t.clock.Now()
+	switch ev.Type {
+	case events.AgentDegraded, events.AgentCrashLoop, events.AgentRemediating, events.RestartExhausted:
+		if !a.down {
+			a.down, a.since = true, now
+		}
+	case events.AgentReady, events.AgentSleep:
+		if a.down {
+			a.outages = append(a.outages, span{a.since, now})
+			a.down = false
+		}
+	case events.AgentRemoved:
+		delete(t.agents, ev.Agent)
+	}
+}
+
+// Status returns an agent's availability, and false if it has no target.
+func (t *Tracker) Status(agent string) (Status, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	a, ok := t.agents[agent]
+	if !ok {
+		return Status{}, false
+	}
+	return a.status(t.clock.Now()), true
+}
+
+// Run checks every CheckInterval until ctx is cancelled.
+func (t *Tracker) Run(ctx context.Context) {
+	ticker := t.clock.NewTicker(CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			t.Check()
+		}
+	}
+}
+
+// Check emits agent.sla_breach for each agent whose availability has
+// fallen below its target since the last check. An agent breaches again
+// only after climbing back to its target.
+func (t *Tracker) Check() {
+	now := t.clock.Now()
+	var breaches []events.Event
+	t.mu.Lock()
+	for name, a := range t.agents {
+		a.prune(now)
+		st := a.status(now)
+		switch {
+		case st.Breached && !a.breached:
+			a.breached = true
+			breaches = append(breaches, events.Event{Type: events.AgentSLABreach, Agent: name, Fields: map[string]string{
+				"availability": formatPercent(st.Availability),
+				"target":       formatPercent(st.Target),
+				"window":       human.FormatDuration(st.Window),
+				"window_start": now.Add(-st.Window).UTC().Format(time.RFC3339),
+				"window_end":   now.UTC().Format(time.RFC3339),
+				"downtime":     human.FormatDuration(st.Downtime.Round(time.Second)),
+			}})
+		case !st.Breached && a.breached:
+			a.breached = false
+			t.logger.Info("agent back within its SLA", "agent", name, "availability", formatPercent(st.Availability))
+		}
+	}
+	t.mu.Unlock()
+
+	// Emitted unlocked: a synchronous emitter calls HandleEvent.
+	for _, ev := range breaches {
+		t.logger.Warn("agent SLA breached", "agent", ev.Agent, "availability", ev.Fields["availability"], "target", ev.Fields["target"])
+		t.emitter.Emit(ev)
+	}
+}
+
+// status computes availability over the window ending at now.
+func (a *agentSLA) status(now time.Time) Status {
+	start := now.Add(-a.window)
+	var down time.Duration
+	overlap := func(s span) {
+		if s.start.Before(start) {
+			s.start = start
+		}
+		if s.end.After(s.start) {
+			down += s.end.Sub(s.start)
+		}
+	}
+	for _, s := range a.outages {
+		overlap(s)
+	}
+	if a.down {
+		overlap(span{a.since, now})
+	}
+	availability := 100 * (1 - float64(down)/float64(a.window))
+	return Status{
+		Availability: availability,
+		Target:       a.target,
+		Window:       a.window,
+		Downtime:     down,
+		Breached:     availability < a.target,
+	}
+}
+
+// prune drops outages that ended before the window.
+func (a *agentSLA) prune(now time.Time) {
+	start := now.Add(-a.window)
+	i := 0
+	for i < len(a.outages) && a.outages[i].end.Before(start) {
+		i++
+	}
+	a.outages = a.outages[i:]
+}
+
+// formatPercent formats a percentage without trailing zeros, e.g. "99.5%".
+func formatPercent(p float64) string {
+	return strconv.FormatFloat(float64(int64(p*1000))/1000, 'f', -1, 64) + "%"
+}
+
+// String describes the status for agent inspect, e.g. "99.2% of 99.5%
+// over 24h (breached)".
+func (s Status) String() string {
+	str := fmt.Sprintf("%s of %s over %s", formatPercent(s.Availability), formatPercent(s.Target), human.FormatDuration(s.Window))
+	if s.Breached {
+		str += " (breached)"
+	}
+	return str
+}
@@ -0,0 +1,101 @@
+package sla
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"warren/internal/clock"
+	"warren/internal/events"
+)
+
+func newTracker(t *testing.T) (*Tracker, *events.Emitter, *clock.Fake, *[]events.Event) {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	emitter := events.NewEmitter(logger)
+	var breaches []events.Event
+	tr := New(emitter, logger)
+	emitter.OnEvent(tr.HandleEvent)
+	emitter.OnEvent(func(ev events.Event) {
+		if ev.Type == events.AgentSLABreach {
+			breaches = append(breaches, ev)
+		}
+	})
+	fake := clock.NewFake(time.Date(2026, 2, 11, 0, 0, 0, 0, time.UTC))
+	tr.SetClock(fake)
+	return tr, emitter, fake, &breaches
+}
+
+func TestBreach(t *testing.T) {
+	tr, emitter, fake, breaches := newTracker(t)
+	tr.Set("kai", 99, time.Hour) // 36s of downtime allowed
+
+	// Single failed checks don't count; only time spent degraded does.
+	emitter.Emit(events.Event{Type: events.AgentHealthFailed, Agent: "kai"})
+	emitter.Emit(events.Event{Type: events.AgentDegraded, Agent: "kai"})
+	fake.Advance(30 * time.Second)
+	emitter.Emit(events.Event{Type: events.AgentReady, Agent: "kai"})
+	tr.Check()
+	if len(*breaches) != 0 {
+		t.Fatalf("breached after 30s down: %+v", *breaches)
+	}
+
+	emitter.Emit(events.Event{Type: events.AgentCrashLoop, Agent: "kai"})
+	fake.Advance(10 * time.Second)
+	tr.Check()
+	if len(*breaches) != 1 {
+		t.Fatalf("breaches = %+v, want one after 40s down", *breaches)
+	}
+	got := (*breaches)[0].Fields
+	if got["availability"] != "98.888%" || got["target"] != "99%" || got["window"] != "1h" || got["downtime"] != "40s" ||
+		got["window_start"] != "2026-02-10T23:00:40Z" || got["window_end"] != "2026-02-11T00:00:40Z" {
+		t.Errorf("fields = %v", got)
+	}
+	if st, _ := tr.Status("kai"); st.String() != "98.888% of 99% over 1h (breached)" {
+		t.Errorf("status = %s", st)
+	}
+
+	// Still breached: no repeat.
+	fake.Advance(time.Minute)
+	tr.Check()
+	if len(*breaches) != 1 {
+		t.Errorf("breaches = %d, want no repeat while breached", len(*breaches))
+	}
+
+	// Once the outage leaves the window, the agent can breach again.
+	emitter.Emit(events.Event{Type: events.AgentSleep, Agent: "kai"})
+	fake.Advance(2 * time.Hour)
+	tr.Check()
+	if st, _ := tr.Status("kai"); st.Breached || st.Availability != 100 || len(tr.agents["kai"].outages) != 0 {
+		t.Errorf("status = %+v, outages = %v", st, tr.agents["kai"].outages)
+	}
+	emitter.Emit(events.Event{Type: events.AgentRemediating, Agent: "kai"})
+	fake.Advance(time.Minute)
+	tr.Check()
+	if len(*breaches) != 2 {
+		t.Errorf("breaches = %d, want a second breach", len(*breaches))
+	}
+}
+
+func TestUntracked(t *testing.T) {
+	tr, emitter, fake, breaches := newTracker(t)
+	tr.Set("kai", 99, 0)
+	if st, ok := tr.Status("kai"); !ok || st.Window != DefaultWindow {
+		t.Errorf("status = %+v, %v", st, ok)
+	}
+
+	emitter.Emit(events.Event{Type: events.AgentDegraded, Agent: "other"})
+	emitter.Emit(events.Event{Type: events.AgentRemoved, Agent: "kai"})
+	fake.Advance(time.Hour)
+	tr.Check()
+	if _, ok := tr.Status("kai"); ok || len(*breaches) != 0 {
+		t.Errorf("removed agent still tracked, breaches = %+v", *breaches)
+	}
+
+	tr.Set("kai", 99, time.Hour)
+	tr.Set("kai", 0, 0)
+	if _, ok := tr.Status("kai"); ok {
+		t.Error("agent still tracked after its target was cleared")
+	}
+}
@@ -0,0 +1,85 @@
+// Package transport builds the HTTP transports Warren proxies through, with
+// per-route timeouts. The defaults suit ordinary web backends; LLM agents
+// that stream for minutes before sending headers need longer ones.
+package transport
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"warren/internal/human"
+)
+
+// Timeouts overrides the default transport's timeouts. Zero fields keep the
+// default.
+type Timeouts struct {
+	// Dial bounds establishing the TCP connection to the backend.
+	Dial time.Duration `yaml:"dial,omitempty"`
+	// ResponseHeader bounds the wait for response headers after the request
+	// is sent. The default is no limit.
+	ResponseHeader time.Duration `yaml:"response_header,omitempty"`
+	// Idle is how long a kept-alive connection may sit unused.
+	Idle time.Duration `yaml:"idle,omitempty"`
+}
+
+// Protocols a backend can be spoken to in. The default, "", uses HTTP/2
+// when an https backend offers it and HTTP/1.1 otherwise.
+const (
+	HTTP1 = "http1" // HTTP/1.1 only
+	HTTP2 = "http2" // HTTP/2 over TLS only; the backend must be https
+	H2C   = "h2c"   // HTTP/2 without TLS, with prior knowledge; the backend must be http
+)
+
+// GRPCProtocol is the protocol for a gRPC backend at backendURL: gRPC needs
+// HTTP/2, which plain http backends speak as h2c.
+func GRPCProtocol(backendURL string) string {
+	if strings.HasPrefix(strings.ToLower(backendURL), "https:") {
+		return HTTP2
+	}
+	return H2C
+}
+
+// New returns a transport like http.DefaultTransport with t applied.
+func New(t Timeouts) *http.Transport {
+	return NewWithProtocol(t, "")
+}
+
+// NewWithProtocol is New for a backend that must be spoken to in protocol.
+func NewWithProtocol(t Timeouts, protocol string) *http.Transport {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	switch protocol {
+	case HTTP1, HTTP2, H2C:
+		var p http.Protocols
+		p.SetHTTP1(protocol == HTTP1)
+		p.SetHTTP2(protocol == HTTP2)
+		p.SetUnencryptedHTTP2(protocol == H2C)
+		tr.Protocols = &p
+	}
+	if t.Dial > 0 {
+		dialer := &net.Dialer{Timeout: t.Dial, KeepAlive: 30 * time.Second}
+		tr.DialContext = dialer.DialContext
+	}
+	if t.ResponseHeader > 0 {
+		tr.ResponseHeaderTimeout = t.ResponseHeader
+	}
+	if t.Idle > 0 {
+		tr.IdleConnTimeout = t.Idle
+	}
+	return tr
+}
+
+// String describes the timeouts that are set, e.g. "dial 5s, response_header 10m".
+func (t Timeouts) String() string {
+	var parts []string
+	for _, f := range []struct {
+		name string
+		d    time.Duration
+	}{{"dial", t.Dial}, {"response_header", t.ResponseHeader}, {"idle", t.Idle}} {
+		if f.d > 0 {
+			parts = append(parts, f.name+" "+human.FormatDuration(f.d))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,63 @@
+package transport
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	def := http.DefaultTransport.(*http.Transport)
+
+	tr := New(Timeouts{ResponseHeader: 10 * time.Minute, Idle: time.Minute})
+	if tr.ResponseHeaderTimeout != 10*time.Minute {
+		t.Errorf("ResponseHeaderTimeout = %v, want 10m", tr.ResponseHeaderTimeout)
+	}
+	if tr.IdleConnTimeout != time.Minute {
+		t.Errorf("IdleConnTimeout = %v, want 1m", tr.IdleConnTimeout)
+	}
+	if tr.TLSHandshakeTimeout != def.TLSHandshakeTimeout {
+		t.Errorf("TLSHandshakeTimeout = %v, want default %v", tr.TLSHandshakeTimeout, def.TLSHandshakeTimeout)
+	}
+
+	tr = New(Timeouts{})
+	if tr.ResponseHeaderTimeout != def.ResponseHeaderTimeout || tr.IdleConnTimeout != def.IdleConnTimeout {
+		t.Errorf("zero Timeouts changed defaults: %v, %v", tr.ResponseHeaderTimeout, tr.IdleConnTimeout)
+	}
+}
+
+func TestTimeoutsString(t *testing.T) {
+	got := Timeouts{Dial: 5 * time.Second, ResponseHeader: 10 * time.Minute}.String()
+	if want := "dial 5s, response_header 10m"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestNewWithProtocol(t *testing.T) {
+	for _, tc := range []struct {
+		protocol          string
+		http1, http2, h2c bool
+	}{
+		{HTTP1, true, false, false},
+		{HTTP2, false, true, false},
+		{H2C, false, false, true},
+	} {
+		tr := NewWithProtocol(Timeouts{}, tc.protocol)
+		p := tr.Protocols
+		if p == nil || p.HTTP1() != tc.http1 || p.HTTP2() != tc.http2 || p.UnencryptedHTTP2() != tc.h2c {
+			t.Errorf("%s: Protocols = %v", tc.protocol, p)
+		}
+	}
+	if tr := NewWithProtocol(Timeouts{}, ""); tr.Protocols != nil || !tr.ForceAttemptHTTP2 {
+		t.Errorf("default protocol changed the transport: %v", tr.Protocols)
+	}
+}
+
+func TestGRPCProtocol(t *testing.T) {
+	if got := GRPCProtocol("http://10.0.0.1:50051"); got != H2C {
+		t.Errorf("http backend: %q, want %q", got, H2C)
+	}
+	if got := GRPCProtocol("HTTPS://api.internal:443"); got != HTTP2 {
+		t.Errorf("https backend: %q, want %q", got, HTTP2)
+	}
+}
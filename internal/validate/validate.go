@@ -0,0 +1,166 @@
+// Package validate decodes admin API request bodies strictly and reports
+// every problem with a request at once, per field, so a typo fails loudly
+// instead of half-configuring an agent or service.
+package validate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"warren/internal/human"
+)
+
+// FieldError is one problem with one field of a request body. Field is
+// empty for problems with the body as a whole, such as malformed JSON.
+type FieldError struct {
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// Errors collects the field errors for a request.
+type Errors []FieldError
+
+// Add records a problem with field.
+func (e *Errors) Add(field, format string, args ...any) {
+	*e = append(*e, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Response is the 422 body: a summary plus the per-field list.
+type Response struct {
+	Error  string       `json:"error"`
+	Fields []FieldError `json:"fields"`
+}
+
+// Decode reads a JSON body into v, rejecting unknown fields and values of
+// the wrong type. An empty body leaves v untouched. Errors are returned as
+// field errors ready to Write.
+func Decode(r *http.Request, v any) Errors {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(v)
+	if err == nil || errors.Is(err, io.EOF) {
+		return nil
+	}
+
+	var errs Errors
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.As(err, &typeErr):
+		t := typeErr.Type
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		errs.Add(typeErr.Field, "must be %s, got %s", article(t.Kind()), typeErr.Value)
+	case errors.As(err, &syntaxErr):
+		errs.Add("", "invalid json at offset %d", syntaxErr.Offset)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		errs.Add(field, "unknown field")
+	default:
+		errs.Add("", "invalid json: %v", err)
+	}
+	return errs
+}
+
+// Write sends errs as a 422 response. It reports whether there were any, so
+// handlers can write `if validate.Write(w, errs) { return }`.
+func Write(w http.ResponseWriter, errs Errors) bool {
+	if len(errs) == 0 {
+		return false
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	_ = json.NewEncoder(w).Encode(Response{Error: "invalid request", Fields: errs})
+	return true
+}
+
+// Required records an error if value is empty.
+func (e *Errors) Required(field, value string) {
+	if value == "" {
+		e.Add(field, "is required")
+	}
+}
+
+// OneOf records an error if value is set and not one of allowed.
+func (e *Errors) OneOf(field, value string, allowed ...string) {
+	if value == "" {
+		return
+	}
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	e.Add(field, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+}
+
+// Duration parses value as a positive duration, recording an error if it
+// is malformed. An empty value yields zero with no error.
+func (e *Errors) Duration(field, value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	d, err := human.ParseDuration(value)
+	if err != nil {
+		e.Add(field, "invalid duration %q (use e.g. 30s, 15m, 1h30m or 2d)", value)
+		return 0
+	}
+	if d <= 0 {
+		e.Add(field, "must be positive, got %s", value)
+		return 0
+	}
+	return d
+}
+
+// Size parses value as a byte size such as "10MiB", recording an error if
+// it is malformed. An empty value yields zero with no error.
+func (e *Errors) Size(field, value string) int64 {
+	if value == "" {
+		return 0
+	}
+	n, err := human.ParseSize(value)
+	if err != nil {
+		e.Add(field, "invalid size %q (use e.g. 512KB, 10MB or 1GiB)", value)
+		return 0
+	}
+	return n
+}
+
+// URL parses value as an absolute http(s) URL, recording an error if it
+// isn't one. An empty value yields nil with no error.
+func (e *Errors) URL(field, value string) *url.URL {
+	if value == "" {
+		return nil
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		e.Add(field, "must be an absolute http or https URL, got %q", value)
+		return nil
+	}
+	return u
+}
+
+// article describes a Go kind for an error message: "a string", "a list".
+func article(kind reflect.Kind) string {
+	switch kind {
+	case reflect.Slice, reflect.Array:
+		return "a list"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return "an integer"
+	case reflect.Float64:
+		return "a number"
+	case reflect.Bool:
+		return "true or false"
+	}
+	return "a " + kind.String()
+}
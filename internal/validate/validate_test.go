@@ -0,0 +1,92 @@
+package validate
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type body struct {
+	Name    string   `json:"name"`
+	Timeout string   `json:"timeout"`
+	Tags    []string `json:"tags"`
+}
+
+func decode(t *testing.T, s string) Errors {
+	t.Helper()
+	var b body
+	return Decode(httptest.NewRequest("POST", "/", strings.NewReader(s)), &b)
+}
+
+func TestDecode(t *testing.T) {
+	if errs := decode(t, `{"name":"a","tags":["x"]}`); errs != nil {
+		t.Errorf("valid body: %v", errs)
+	}
+	if errs := decode(t, ``); errs != nil {
+		t.Errorf("empty body: %v", errs)
+	}
+
+	cases := map[string]FieldError{
+		`{"nmae":"a"}`:  {Field: "nmae", Message: "unknown field"},
+		`{"tags":"x"}`:  {Field: "tags", Message: "must be a list, got string"},
+		`{"name":5}`:    {Field: "name", Message: "must be a string, got number"},
+		`{"name":"a",}`: {Message: "invalid json at offset 13"},
+	}
+	for in, want := range cases {
+		errs := decode(t, in)
+		if len(errs) != 1 || errs[0] != want {
+			t.Errorf("%s: errors = %+v, want %+v", in, errs, want)
+		}
+	}
+}
+
+func TestChecks(t *testing.T) {
+	var errs Errors
+	errs.Required("name", "")
+	errs.OneOf("policy", "on-demnd", "on-demand", "always-on")
+	errs.OneOf("balance", "", "round-robin")
+	if d := errs.Duration("timeout", "5 minutes"); d != 0 {
+		t.Errorf("bad duration parsed as %v", d)
+	}
+	errs.Duration("grace", "-1s")
+	if n := errs.Size("max_body", "10MiB"); n != 10<<20 {
+		t.Errorf("size parsed as %d", n)
+	}
+	errs.Size("max_entry", "lots")
+	if u := errs.URL("backend", "localhost:80"); u != nil {
+		t.Errorf("bad URL parsed as %v", u)
+	}
+	if u := errs.URL("health", "http://a:8080/health"); u == nil {
+		t.Error("valid URL rejected")
+	}
+
+	var fields []string
+	for _, e := range errs {
+		fields = append(fields, e.Field)
+	}
+	if got := strings.Join(fields, ","); got != "name,policy,timeout,grace,max_entry,backend" {
+		t.Errorf("fields = %s", got)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	w := httptest.NewRecorder()
+	if Write(w, nil) {
+		t.Error("Write with no errors should report false")
+	}
+
+	var errs Errors
+	errs.Add("policy", "must be one of %s", "on-demand")
+	if !Write(w, errs) {
+		t.Fatal("Write with errors should report true")
+	}
+	if w.Code != 422 {
+		t.Errorf("status = %d, want 422", w.Code)
+	}
+	var resp Response
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Error != "invalid request" || len(resp.Fields) != 1 || resp.Fields[0].Field != "policy" {
+		t.Errorf("body = %s", w.Body.String())
+	}
+}
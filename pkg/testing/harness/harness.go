@@ -0,0 +1,399 @@
+// Package harness runs Warren's proxy, event bus and agent policies
+// in-process against a fake container runtime, for end-to-end tests of whole
+// flows: a request wakes a sleeping agent, the agent goes idle and sleeps,
+// a failing health check degrades it.
+//
+// Agents are built from config by the orchestrator's own constructor, and
+// their timers run on a fake clock the harness advances while it waits, so
+// a minute-long idle timeout takes well under a second.
+//
+//	h := harness.New(t)
+//	h.AddAgent(harness.AgentSpec{Name: "kai", IdleTimeout: time.Minute})
+//	resp := h.SendRequest("GET", "kai.test", "/", nil)
+//	h.WaitForState("kai", "ready", time.Minute)
+package harness
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"warren/internal/agents"
+	"warren/internal/clock"
+	"warren/internal/config"
+	"warren/internal/events"
+	"warren/internal/human"
+	"warren/internal/policy"
+	"warren/internal/proxy"
+	"warren/internal/services"
+)
+
+// Harness is a running Warren instance with fake agents. Everything it
+// starts is torn down when the test ends.
+type Harness struct {
+	Proxy    *proxy.Proxy
+	Registry *services.Registry
+	Emitter  *events.Emitter
+	Runtime  *FakeRuntime
+
+	// Clock is the time source of the agents' policies and backends. The
+	// Wait methods and Advance move it on.
+	Clock *clock.Fake
+
+	// URL is the address of the proxy's HTTP server.
+	URL string
+	// AdminURL is the address of the admin-only APIs the orchestrator
+	// mounts beside the dashboard: /api/services and /api/agents/.
+	AdminURL string
+
+	t      testing.TB
+	ctx    context.Context
+	server *httptest.Server
+	admin  *httptest.Server
+	logger *slog.Logger
+	build  *agents.Builder
+
+	mu     sync.Mutex
+	events []events.Event
+	agents map[string]*Agent
+}
+
+// Event is an event emitted by Warren. Its Type is one of the "agent.*"
+// event names, e.g. "agent.ready".
+type Event = events.Event
+
+// Option configures a Harness.
+type Option func(*Harness)
+
+// WithLogger sends Warren's logs to logger instead of discarding them.
+func WithLogger(logger *slog.Logger) Option {
+	return func(h *Harness) { h.logger = logger }
+}
+
+// step is how far the fake clock moves at a time. Between steps the
+// harness yields briefly, so health checks and requests on real
+// connections can complete.
+const step = 100 * time.Millisecond
+
+// New starts a harness with no agents.
+func New(t testing.TB, opts ...Option) *Harness {
+	t.Helper()
+	h := &Harness{
+		Runtime: NewFakeRuntime(),
+		Clock:   clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)),
+		t:       t,
+		logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+		agents:  make(map[string]*Agent),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h.ctx = ctx
+	h.Emitter = events.NewEmitter(h.logger)
+	h.Emitter.OnEvent(func(ev events.Event) {
+		h.mu.Lock()
+		h.events = append(h.events, ev)
+		h.mu.Unlock()
+	})
+	h.Registry = services.NewRegistry(h.logger)
+	h.Proxy = proxy.New(h.Registry, "", h.logger)
+	h.Proxy.Activity().SetClock(h.Clock)
+	deps := policy.NewDependencies(h.logger)
+	deps.SetClock(h.Clock)
+	h.build = &agents.Builder{
+		Runtime: h.Runtime,
+		Proxy:   h.Proxy,
+		Emitter: h.Emitter,
+		Deps:    deps,
+		Clock:   h.Clock,
+		Logger:  h.logger,
+	}
+	h.server = httptest.NewServer(h.Proxy)
+	h.URL = h.server.URL
+	adminMux := http.NewServeMux()
+	adminMux.HandleFunc("/api/services", h.Proxy.HandleServiceAPI)
+	adminMux.HandleFunc("/api/services/", h.Proxy.HandleServiceAPI)
+	adminMux.HandleFunc("/api/agents/", h.Proxy.HandleAgentAPI)
+	h.admin = httptest.NewServer(adminMux)
+	h.AdminURL = h.admin.URL
+
+	t.Cleanup(func() {
+		cancel()
+		h.server.Close()
+		h.admin.Close()
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		for _, a := range h.agents {
+			a.Backend.close()
+		}
+	})
+	return h
+}
+
+// AgentSpec describes a fake agent. Its durations are on the harness's
+// fake clock.
+type AgentSpec struct {
+	Name     string
+	Hostname string // default: Name + ".test"
+
+	// Policy is "on-demand" (default), "always-on" or "unmanaged".
+	Policy string
+
+	// Handler serves the agent's requests. The default answers with the
+	// agent's name.
+	Handler http.Handler
+
+	// Running starts the agent's container before its policy starts, as if
+	// Warren found it already up.
+	Running bool
+
+	StartupDelay  time.Duration // how long the container takes to come up
+	IdleTimeout   time.Duration // on-demand idle timeout; default 1m
+	CheckInterval time.Duration // health check interval; default 1s
+	MaxFailures   int           // failed checks before a restart or degrade; default 2
+}
+
+// Agent is a fake agent added to the harness.
+type Agent struct {
+	Name     string
+	Hostname string
+	Config   *config.Agent
+	Policy   policy.Policy
+	Backend  *FakeAgent
+}
+
+// AddAgent creates a fake agent, routes its hostname through the proxy and
+// starts its policy. The agent goes through config parsing, defaults and
+// validation, then the orchestrator's agent constructor, as one in the
+// config file would.
+func (h *Harness) AddAgent(spec AgentSpec) *Agent {
+	h.t.Helper()
+	if spec.Name == "" {
+		h.t.Fatal("harness: agent name required")
+	}
+	if spec.Hostname == "" {
+		spec.Hostname = spec.Name + ".test"
+	}
+	if spec.Policy == "" {
+		spec.Policy = "on-demand"
+	}
+	if spec.Handler == nil {
+		name := spec.Name
+		spec.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name)) //nolint:errcheck
+		})
+	}
+	if spec.IdleTimeout <= 0 {
+		spec.IdleTimeout = time.Minute
+	}
+	if spec.CheckInterval <= 0 {
+		spec.CheckInterval = time.Second
+	}
+	if spec.MaxFailures <= 0 {
+		spec.MaxFailures = 2
+	}
+
+	backend := newFakeAgent(spec.Handler, spec.StartupDelay, h.Clock)
+	h.Runtime.mu.Lock()
+	h.Runtime.agents[spec.Name] = backend
+	h.Runtime.mu.Unlock()
+	if spec.Running || spec.Policy == "always-on" || spec.Policy == "unmanaged" {
+		backend.start()
+	}
+
+	agent := h.agentConfig(spec, backend)
+	target, err := url.Parse(agent.Backend)
+	if err != nil {
+		h.t.Fatalf("harness: %v", err)
+	}
+	opts, err := h.build.RouteOptions(spec.Name, agent)
+	if err != nil {
+		h.t.Fatalf("harness: agent %q: %v", spec.Name, err)
+	}
+	pol, cancel := h.build.Policy(spec.Name, agent)
+	h.t.Cleanup(cancel)
+	h.build.Route(spec.Name, agent, target, pol, opts)
+	if err := h.build.OpenPorts(h.ctx, spec.Name, agent, target, pol); err != nil {
+		h.t.Fatalf("harness: agent %q: %v", spec.Name, err)
+	}
+	go pol.Start(h.ctx)
+
+	a := &Agent{Name: spec.Name, Hostname: spec.Hostname, Config: agent, Policy: pol, Backend: backend}
+	h.mu.Lock()
+	h.agents[spec.Name] = a
+	h.mu.Unlock()
+
+	// An agent found asleep at startup refuses wakes for its wake cooldown,
+	// as after any sleep. Let it pass so the agent can be woken right away.
+	if spec.Policy == "on-demand" && !spec.Running {
+		h.WaitForState(spec.Name, "sleeping", time.Second)
+		h.Clock.Advance(time.Duration(agent.Idle.WakeCooldown))
+	}
+	return a
+}
+
+// agentConfig writes spec as an agent in a config file and loads it back.
+func (h *Harness) agentConfig(spec AgentSpec, backend *FakeAgent) *config.Agent {
+	h.t.Helper()
+	agent := &config.Agent{
+		Hostname:  spec.Hostname,
+		Backend:   backend.URL(),
+		Policy:    spec.Policy,
+		Container: config.Container{Name: spec.Name},
+		Health: config.Health{
+			URL:             backend.URL() + "/health",
+			CheckInterval:   human.Duration(spec.CheckInterval),
+			StartupTimeout:  human.Duration(10 * time.Second),
+			MaxFailures:     spec.MaxFailures,
+			StartupProbe:    human.Duration(100 * time.Millisecond),
+			StartupProbeMax: human.Duration(500 * time.Millisecond),
+		},
+	}
+	if spec.Policy == "on-demand" {
+		agent.Idle.Timeout = human.Duration(spec.IdleTimeout)
+	}
+	data, err := yaml.Marshal(map[string]any{"agents": map[string]*config.Agent{spec.Name: agent}})
+	if err != nil {
+		h.t.Fatalf("harness: %v", err)
+	}
+	cfg, err := config.Parse(data, config.DefaultLimits)
+	if err != nil {
+		h.t.Fatalf("harness: agent %q: %v", spec.Name, err)
+	}
+	return cfg.Agents[spec.Name]
+}
+
+// Agent returns the named agent, failing the test if there's none.
+func (h *Harness) Agent(name string) *Agent {
+	h.t.Helper()
+	h.mu.Lock()
+	a, ok := h.agents[name]
+	h.mu.Unlock()
+	if !ok {
+		h.t.Fatalf("harness: no agent %q", name)
+	}
+	return a
+}
+
+// WaitForState advances the clock until the named agent's policy reports
+// state, failing the test if it hasn't within timeout of fake time.
+func (h *Harness) WaitForState(name, state string, timeout time.Duration) {
+	h.t.Helper()
+	pol := h.Agent(name).Policy
+	if !h.advanceUntil(timeout, func() bool { return pol.State() == state }) {
+		h.t.Fatalf("harness: agent %q is %s, not %s, after %s", name, pol.State(), state, timeout)
+	}
+}
+
+// Advance moves the clock on by d, a step at a time, firing the timers
+// that come due on the way.
+func (h *Harness) Advance(d time.Duration) {
+	h.advanceUntil(d, func() bool { return false })
+}
+
+// advanceUntil steps the clock until done reports true or d has passed,
+// and reports whether done did.
+func (h *Harness) advanceUntil(d time.Duration, done func() bool) bool {
+	for elapsed := time.Duration(0); ; elapsed += step {
+		// Let goroutines woken by the last step run before looking.
+		time.Sleep(time.Millisecond)
+		if done() {
+			return true
+		}
+		if elapsed >= d {
+			return false
+		}
+		h.Clock.Advance(step)
+	}
+}
+
+// Response is a proxied response with its body read.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       string
+}
+
+// SendRequest sends a request for hostname through the proxy's HTTP server.
+func (h *Harness) SendRequest(method, hostname, path string, body io.Reader) *Response {
+	h.t.Helper()
+	req, err := http.NewRequest(method, h.URL+path, body)
+	if err != nil {
+		h.t.Fatalf("harness: %v", err)
+	}
+	req.Host = hostname
+	return h.Do(req)
+}
+
+// AdminRequest sends a request to the admin APIs, e.g. a POST to
+// /api/services to register a dynamic service.
+func (h *Harness) AdminRequest(method, path string, body io.Reader) *Response {
+	h.t.Helper()
+	req, err := http.NewRequest(method, h.AdminURL+path, body)
+	if err != nil {
+		h.t.Fatalf("harness: %v", err)
+	}
+	return h.Do(req)
+}
+
+// Do sends req, usually through the proxy's HTTP server. Set req.Host to
+// the hostname to route to.
+func (h *Harness) Do(req *http.Request) *Response {
+	h.t.Helper()
+	resp, err := h.server.Client().Do(req)
+	if err != nil {
+		h.t.Fatalf("harness: %s %s: %v", req.Method, req.URL.Path, err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		h.t.Fatalf("harness: reading response: %v", err)
+	}
+	return &Response{StatusCode: resp.StatusCode, Header: resp.Header, Body: string(b)}
+}
+
+// CollectEvents returns the events emitted so far, in order, optionally
+// only those of the given types.
+func (h *Harness) CollectEvents(types ...string) []Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var out []Event
+	for _, ev := range h.events {
+		if len(types) == 0 || slices.Contains(types, ev.Type) {
+			out = append(out, ev)
+		}
+	}
+	return out
+}
+
+// WaitForEvent advances the clock until an event of type typ has been
+// emitted for the named agent, failing the test if none has within timeout
+// of fake time.
+func (h *Harness) WaitForEvent(agent, typ string, timeout time.Duration) Event {
+	h.t.Helper()
+	var found Event
+	ok := h.advanceUntil(timeout, func() bool {
+		for _, ev := range h.CollectEvents(typ) {
+			if ev.Agent == agent {
+				found = ev
+				return true
+			}
+		}
+		return false
+	})
+	if !ok {
+		h.t.Fatalf("harness: no %s event for %q after %s", typ, agent, timeout)
+	}
+	return found
+}
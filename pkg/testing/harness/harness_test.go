@@ -0,0 +1,128 @@
+package harness
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"warren/internal/events"
+)
+
+func TestWakeServeAndSleep(t *testing.T) {
+	h := New(t)
+	h.AddAgent(AgentSpec{Name: "kai", IdleTimeout: time.Minute, StartupDelay: 5 * time.Second})
+	h.WaitForState("kai", "sleeping", time.Second)
+
+	if resp := h.SendRequest("GET", "kai.test", "/", nil); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("request to a sleeping agent: %d, want 503", resp.StatusCode)
+	}
+	h.WaitForState("kai", "ready", time.Minute)
+	if resp := h.SendRequest("GET", "kai.test", "/", nil); resp.StatusCode != http.StatusOK || resp.Body != "kai" {
+		t.Fatalf("request to a ready agent: %d %q", resp.StatusCode, resp.Body)
+	}
+
+	h.WaitForState("kai", "sleeping", 2*time.Minute)
+	if h.Agent("kai").Backend.Running() {
+		t.Error("container still running after idle sleep")
+	}
+
+	var types []string
+	for _, ev := range h.CollectEvents(events.AgentWake, events.AgentStarting, events.AgentReady, events.AgentSleep) {
+		types = append(types, ev.Type)
+	}
+	want := []string{events.AgentWake, events.AgentStarting, events.AgentReady, events.AgentSleep}
+	if !slices.Equal(types, want) {
+		t.Errorf("events = %v, want %v", types, want)
+	}
+	if calls := h.Runtime.Calls(); !slices.Equal(calls, []string{"start kai", "stop kai"}) {
+		t.Errorf("runtime calls = %v", calls)
+	}
+}
+
+func TestAlwaysOnDegrades(t *testing.T) {
+	h := New(t)
+	a := h.AddAgent(AgentSpec{Name: "ops", Policy: "always-on"})
+	h.WaitForState("ops", "ready", time.Minute)
+
+	a.Backend.SetHealthy(false)
+	h.WaitForEvent("ops", events.AgentDegraded, time.Minute)
+}
+
+func TestFailedStartStaysAsleep(t *testing.T) {
+	h := New(t)
+	h.AddAgent(AgentSpec{Name: "kai"})
+	h.WaitForState("kai", "sleeping", time.Second)
+	h.Runtime.FailNextStart("kai", errors.New("no such image"))
+
+	h.SendRequest("GET", "kai.test", "/", nil)
+	h.WaitForEvent("kai", events.AgentWake, time.Second)
+	h.Advance(time.Second)
+	if got := h.Agent("kai").Policy.State(); got != "sleeping" {
+		t.Errorf("state after failed start = %s, want sleeping", got)
+	}
+}
+
+func TestRoutesByHostname(t *testing.T) {
+	h := New(t)
+	h.AddAgent(AgentSpec{Name: "agent-1", Hostname: "agent1.example.com", Policy: "unmanaged"})
+	h.AddAgent(AgentSpec{Name: "agent-2", Hostname: "agent2.example.com", Policy: "unmanaged"})
+
+	for host, want := range map[string]string{"agent1.example.com": "agent-1", "agent2.example.com": "agent-2"} {
+		if resp := h.SendRequest("GET", host, "/", nil); resp.StatusCode != http.StatusOK || resp.Body != want {
+			t.Errorf("%s: %d %q, want 200 %q", host, resp.StatusCode, resp.Body, want)
+		}
+	}
+	if resp := h.SendRequest("GET", "unknown.example.com", "/", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown host: %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestDynamicServiceRouting(t *testing.T) {
+	h := New(t)
+	a := h.AddAgent(AgentSpec{Name: "a", Policy: "unmanaged", Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("dynamic-service")) //nolint:errcheck
+	})})
+
+	// Loopback IPs are refused as service targets, so go by name.
+	target := strings.Replace(a.Backend.URL(), "127.0.0.1", "localhost", 1)
+	body := strings.NewReader(`{"hostname":"dyn.example.com","target":"` + target + `","agent":"a"}`)
+	if resp := h.SendRequest("POST", "any.com", "/api/services", body); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("service API on the public port: %d, want 404", resp.StatusCode)
+	}
+	body = strings.NewReader(`{"hostname":"dyn.example.com","target":"` + target + `","agent":"a"}`)
+	if resp := h.AdminRequest("POST", "/api/services", body); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("register: %d %s", resp.StatusCode, resp.Body)
+	}
+	if resp := h.SendRequest("GET", "dyn.example.com", "/", nil); resp.Body != "dynamic-service" {
+		t.Errorf("dynamic service: %d %q", resp.StatusCode, resp.Body)
+	}
+}
+
+func TestUnavailableWhileStarting(t *testing.T) {
+	h := New(t)
+	h.AddAgent(AgentSpec{Name: "agent-s", Hostname: "starting.example.com", StartupDelay: 5 * time.Second})
+	h.WaitForState("agent-s", "sleeping", time.Second)
+
+	h.SendRequest("GET", "starting.example.com", "/", nil)
+	h.WaitForState("agent-s", "starting", time.Second)
+	if resp := h.SendRequest("GET", "starting.example.com", "/", nil); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("while starting: %d, want 503", resp.StatusCode)
+	}
+
+	h.WaitForState("agent-s", "ready", time.Minute)
+	if resp := h.SendRequest("GET", "starting.example.com", "/", nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("once ready: %d, want 200", resp.StatusCode)
+	}
+	resp := h.SendRequest("GET", "starting.example.com", "/api/health", nil)
+	var health struct{ Status string }
+	if err := json.Unmarshal([]byte(resp.Body), &health); err != nil {
+		t.Fatalf("health: %v: %s", err, resp.Body)
+	}
+	if health.Status != "ready" {
+		t.Errorf("health status = %q, want ready", health.Status)
+	}
+}
@@ -0,0 +1,217 @@
+package harness
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"warren/internal/clock"
+)
+
+// FakeRuntime stands in for Docker. It implements container.Lifecycle over
+// in-process fake agents: starting a "container" brings its agent's HTTP
+// server up, stopping it takes it down.
+type FakeRuntime struct {
+	mu     sync.Mutex
+	agents map[string]*FakeAgent // container name → agent
+	calls  []string
+	fail   map[string]error // container name → error for the next Start
+}
+
+// NewFakeRuntime creates a runtime with no containers.
+func NewFakeRuntime() *FakeRuntime {
+	return &FakeRuntime{
+		agents: make(map[string]*FakeAgent),
+		fail:   make(map[string]error),
+	}
+}
+
+func (r *FakeRuntime) agent(name string) (*FakeAgent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	a, ok := r.agents[name]
+	if !ok {
+		return nil, fmt.Errorf("no such container: %s", name)
+	}
+	return a, nil
+}
+
+func (r *FakeRuntime) record(call string) {
+	r.mu.Lock()
+	r.calls = append(r.calls, call)
+	r.mu.Unlock()
+}
+
+// Start brings the container's agent up after its startup delay.
+func (r *FakeRuntime) Start(_ context.Context, name string) error {
+	r.record("start " + name)
+	r.mu.Lock()
+	err := r.fail[name]
+	delete(r.fail, name)
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	a, err := r.agent(name)
+	if err != nil {
+		return err
+	}
+	a.start()
+	return nil
+}
+
+// Stop takes the container's agent down.
+func (r *FakeRuntime) Stop(_ context.Context, name string, _ time.Duration) error {
+	r.record("stop " + name)
+	a, err := r.agent(name)
+	if err != nil {
+		return err
+	}
+	a.stop()
+	return nil
+}
+
+// Restart stops and starts the container's agent.
+func (r *FakeRuntime) Restart(_ context.Context, name string, _ time.Duration) error {
+	r.record("restart " + name)
+	a, err := r.agent(name)
+	if err != nil {
+		return err
+	}
+	a.stop()
+	a.start()
+	return nil
+}
+
+// Status reports "running" or "exited", as Docker would.
+func (r *FakeRuntime) Status(_ context.Context, name string) (string, error) {
+	a, err := r.agent(name)
+	if err != nil {
+		return "", err
+	}
+	if a.Running() {
+		return "running", nil
+	}
+	return "exited", nil
+}
+
+// FailNextStart makes the next Start of the container return err.
+func (r *FakeRuntime) FailNextStart(name string, err error) {
+	r.mu.Lock()
+	r.fail[name] = err
+	r.mu.Unlock()
+}
+
+// Calls returns the lifecycle calls made so far, e.g. "start kai".
+func (r *FakeRuntime) Calls() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.calls...)
+}
+
+// FakeAgent is an agent's backend: a real HTTP server whose health endpoint
+// and handler only answer while its container is running.
+type FakeAgent struct {
+	server       *httptest.Server
+	handler      http.Handler
+	startupDelay time.Duration
+	clock        clock.Clock
+
+	mu       sync.Mutex
+	running  bool
+	healthy  bool
+	starting chan struct{} // closed to abandon a pending start
+}
+
+func newFakeAgent(handler http.Handler, startupDelay time.Duration, clk clock.Clock) *FakeAgent {
+	a := &FakeAgent{handler: handler, startupDelay: startupDelay, clock: clk, healthy: true}
+	a.server = httptest.NewServer(http.HandlerFunc(a.serveHTTP))
+	return a
+}
+
+func (a *FakeAgent) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	running, healthy := a.running, a.healthy
+	a.mu.Unlock()
+	if !running {
+		http.Error(w, "container not running", http.StatusServiceUnavailable)
+		return
+	}
+	if r.URL.Path == "/health" {
+		if !healthy {
+			http.Error(w, "unhealthy", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok")) //nolint:errcheck
+		return
+	}
+	a.handler.ServeHTTP(w, r)
+}
+
+func (a *FakeAgent) start() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.cancelStart()
+	if a.startupDelay <= 0 {
+		a.running = true
+		return
+	}
+	abandon := make(chan struct{})
+	a.starting = abandon
+	timer := a.clock.NewTimer(a.startupDelay)
+	go func() {
+		select {
+		case <-timer.C():
+			a.mu.Lock()
+			if a.starting == abandon {
+				a.running = true
+				a.starting = nil
+			}
+			a.mu.Unlock()
+		case <-abandon:
+			timer.Stop()
+		}
+	}()
+}
+
+func (a *FakeAgent) stop() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.cancelStart()
+	a.running = false
+}
+
+// cancelStart abandons a pending start. Call with a.mu held.
+func (a *FakeAgent) cancelStart() {
+	if a.starting != nil {
+		close(a.starting)
+		a.starting = nil
+	}
+}
+
+// Running reports whether the agent's container is up.
+func (a *FakeAgent) Running() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.running
+}
+
+// SetHealthy makes the agent's health endpoint pass or fail.
+func (a *FakeAgent) SetHealthy(healthy bool) {
+	a.mu.Lock()
+	a.healthy = healthy
+	a.mu.Unlock()
+}
+
+// URL is the agent's backend address.
+func (a *FakeAgent) URL() string {
+	return a.server.URL
+}
+
+func (a *FakeAgent) close() {
+	a.stop()
+	a.server.Close()
+}